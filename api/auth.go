@@ -0,0 +1,180 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	// ErrUnauthorized denotes a request without valid credentials.
+	ErrUnauthorized = errors.New("unauthorized")
+
+	// ErrTokenContextMissing denotes a token was not passed into the parsing
+	// middleware's context.
+	ErrTokenContextMissing = errors.New("token up for parsing was not passed through the context")
+
+	// ErrTokenInvalid denotes a token was not able to be validated.
+	ErrTokenInvalid = errors.New("JWT Token was invalid")
+
+	// ErrTokenExpired denotes a token's expire header (exp) has since passed.
+	ErrTokenExpired = errors.New("JWT Token is expired")
+
+	// ErrTokenMalformed denotes a token was not formatted as a JWT token.
+	ErrTokenMalformed = errors.New("JWT Token is malformed")
+
+	// ErrTokenNotActive denotes a token's not before header (nbf) is in the
+	// future.
+	ErrTokenNotActive = errors.New("token is not valid yet")
+
+	// ErrUnexpectedSigningMethod denotes a token was signed with an unexpected
+	// signing method.
+	ErrUnexpectedSigningMethod = errors.New("unexpected signing method")
+
+	// ErrTokenRevoked denotes a token that was revoked before it expired.
+	ErrTokenRevoked = errors.New("JWT Token was revoked")
+
+	// ErrRefreshTokenReused denotes a refresh token presented after it had
+	// already been exchanged, which revokes every token of its family.
+	ErrRefreshTokenReused = errors.New("refresh token was already used")
+)
+
+// jwtSigningMethod is the method tokens are signed and verified with.
+var jwtSigningMethod jwt.SigningMethod = jwt.SigningMethodHS256
+
+const (
+	// TokenTypeAccess marks the access token of a TokenPair.
+	TokenTypeAccess = "access"
+
+	// TokenTypeRefresh marks the refresh token of a TokenPair.
+	TokenTypeRefresh = "refresh"
+)
+
+// TokenClaims are the claims of the tokens issued by CreateToken and
+// TokenIssuer. Type tells access and refresh tokens apart, Family links the
+// refresh tokens rotated from the same login.
+type TokenClaims struct {
+	jwt.RegisteredClaims
+	Type   string                 `json:"typ,omitempty"`
+	Family string                 `json:"fam,omitempty"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+}
+
+// CreateToken issues an access token for subject, valid for ttl, carrying data
+// as a private claim. It is signed with HS256.
+func CreateToken(subject string, data map[string]interface{}, secret []byte, ttl time.Duration) (string, error) {
+	return CreateTokenWithMethod(jwtSigningMethod, secret, "", subject, data, ttl)
+}
+
+// CreateTokenWithMethod is like CreateToken but signs the token with method,
+// using key: a []byte secret for the HMAC methods, an *rsa.PrivateKey for the
+// RS and PS methods or an *ecdsa.PrivateKey for the ES methods. A non-empty
+// kid is written to the token header so verifiers can pick the matching
+// public key from a JWKS.
+func CreateTokenWithMethod(method jwt.SigningMethod, key interface{}, kid string, subject string, data map[string]interface{}, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims := TokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        newTokenID(),
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+		Type: TokenTypeAccess,
+		Data: data,
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	return token.SignedString(key)
+}
+
+// ParseToken verifies the HS256 signature and the time based claims of
+// tokenString. Failures are reported as ErrTokenMalformed, ErrTokenExpired,
+// ErrTokenNotActive, ErrUnexpectedSigningMethod or ErrTokenInvalid.
+func ParseToken(tokenString string, secret []byte) (*TokenClaims, error) {
+	return ParseTokenWithKeyFunc(tokenString, func(*jwt.Token) (interface{}, error) {
+		return secret, nil
+	}, jwtSigningMethod)
+}
+
+// ParseTokenWithKeyFunc is like ParseToken but accepts any of methods and
+// looks the verification key up with keyFunc, for instance
+// JWKSClient.Keyfunc.
+func ParseTokenWithKeyFunc(tokenString string, keyFunc jwt.Keyfunc, methods ...jwt.SigningMethod) (*TokenClaims, error) {
+	claims := &TokenClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		for _, method := range methods {
+			if token.Method.Alg() == method.Alg() {
+				return keyFunc(token)
+			}
+		}
+		return nil, ErrUnexpectedSigningMethod
+	})
+
+	if err != nil {
+		return nil, tokenError(err)
+	}
+
+	if !token.Valid {
+		return nil, ErrTokenInvalid
+	}
+
+	return claims, nil
+}
+
+// verifyIssuerAudience fails with ErrTokenInvalid when issuer is set and is
+// not the iss claim, or when audience is set and none of its values is in the
+// aud claim.
+func (c *TokenClaims) verifyIssuerAudience(issuer string, audience []string) error {
+	if issuer != "" && !c.VerifyIssuer(issuer, true) {
+		return ErrTokenInvalid
+	}
+
+	if len(audience) == 0 {
+		return nil
+	}
+	for _, aud := range audience {
+		if c.VerifyAudience(aud, true) {
+			return nil
+		}
+	}
+	return ErrTokenInvalid
+}
+
+func signToken(claims TokenClaims, secret []byte) (string, error) {
+	return jwt.NewWithClaims(jwtSigningMethod, claims).SignedString(secret)
+}
+
+// tokenError maps the errors of the jwt package to the token errors of this
+// package.
+func tokenError(err error) error {
+	switch {
+	case errors.Is(err, ErrUnexpectedSigningMethod):
+		return ErrUnexpectedSigningMethod
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return ErrTokenMalformed
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return ErrTokenNotActive
+	}
+
+	return fmt.Errorf("%w: %s", ErrTokenInvalid, err)
+}
+
+func newTokenID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
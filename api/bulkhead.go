@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ConcurrencyLimitError is returned by the bulkhead middlewares when a call
+// is rejected because the endpoint is saturated. It wraps ErrUnavailable and
+// reports a 503 status code.
+type ConcurrencyLimitError struct {
+	Max int
+}
+
+func (e *ConcurrencyLimitError) Error() string {
+	return fmt.Sprintf("%s: %d concurrent calls in progress", ErrUnavailable, e.Max)
+}
+
+func (e *ConcurrencyLimitError) Unwrap() error {
+	return ErrUnavailable
+}
+
+func (e *ConcurrencyLimitError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+func (e *ConcurrencyLimitError) Headers() http.Header {
+	return http.Header{"Retry-After": []string{"1"}}
+}
+
+type bulkheadOption struct {
+	maxQueued int
+}
+
+// BulkheadOption sets an optional parameter for NewBulkhead.
+type BulkheadOption func(opt *bulkheadOption)
+
+// MaxQueued sets how many calls may wait for a slot at once, further calls
+// being rejected right away. By default, the number of waiting calls is only
+// bounded by the queue timeout.
+func MaxQueued(n int) BulkheadOption {
+	return func(opt *bulkheadOption) { opt.maxQueued = n }
+}
+
+// Bulkhead limits the number of concurrent calls of an endpoint, so a slow
+// endpoint can't use up the goroutines, connections or memory of the whole
+// service. Its InFlight and Queued counts can be exported as gauges with
+// metrics.RegisterBulkhead.
+type Bulkhead struct {
+	sem          chan struct{}
+	queueTimeout time.Duration
+	maxQueued    int64
+
+	inFlight int64
+	queued   int64
+}
+
+// NewBulkhead creates a Bulkhead allowing max concurrent calls. Calls beyond
+// max wait up to queueTimeout for a slot, or are rejected right away when
+// queueTimeout is 0.
+func NewBulkhead(max int, queueTimeout time.Duration, options ...BulkheadOption) *Bulkhead {
+	opts := &bulkheadOption{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return &Bulkhead{
+		sem:          make(chan struct{}, max),
+		queueTimeout: queueTimeout,
+		maxQueued:    int64(opts.maxQueued),
+	}
+}
+
+// Max returns the number of concurrent calls allowed.
+func (b *Bulkhead) Max() int {
+	return cap(b.sem)
+}
+
+// InFlight returns the number of calls in progress.
+func (b *Bulkhead) InFlight() int {
+	return int(atomic.LoadInt64(&b.inFlight))
+}
+
+// Queued returns the number of calls waiting for a slot.
+func (b *Bulkhead) Queued() int {
+	return int(atomic.LoadInt64(&b.queued))
+}
+
+// Acquire takes a slot, waiting for one as configured, and returns the
+// function releasing it. It fails with a *ConcurrencyLimitError when no slot
+// is available in time, or with the error of ctx when it is done first.
+func (b *Bulkhead) Acquire(ctx context.Context) (func(), error) {
+	select {
+	case b.sem <- struct{}{}:
+		return b.acquired(), nil
+	default:
+	}
+
+	if b.queueTimeout <= 0 {
+		return nil, &ConcurrencyLimitError{Max: cap(b.sem)}
+	}
+
+	if queued := atomic.AddInt64(&b.queued, 1); b.maxQueued > 0 && queued > b.maxQueued {
+		atomic.AddInt64(&b.queued, -1)
+		return nil, &ConcurrencyLimitError{Max: cap(b.sem)}
+	}
+	defer atomic.AddInt64(&b.queued, -1)
+
+	timer := time.NewTimer(b.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case b.sem <- struct{}{}:
+		return b.acquired(), nil
+	case <-timer.C:
+		return nil, &ConcurrencyLimitError{Max: cap(b.sem)}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (b *Bulkhead) acquired() func() {
+	atomic.AddInt64(&b.inFlight, 1)
+
+	var once int32
+	return func() {
+		if atomic.CompareAndSwapInt32(&once, 0, 1) {
+			atomic.AddInt64(&b.inFlight, -1)
+			<-b.sem
+		}
+	}
+}
+
+// ConcurrencyLimitMiddleware returns a Middleware allowing max concurrent
+// calls of the next endpoint, as a Bulkhead created with max and
+// queueTimeout. Use BulkheadMiddleware to share a Bulkhead or export its
+// gauges.
+func ConcurrencyLimitMiddleware[I, O any](max int, queueTimeout time.Duration) Middleware[I, O] {
+	return BulkheadMiddleware[I, O](NewBulkhead(max, queueTimeout))
+}
+
+// BulkheadMiddleware returns a Middleware calling the next endpoint within a
+// slot of b, failing with a *ConcurrencyLimitError when b is saturated.
+func BulkheadMiddleware[I, O any](b *Bulkhead) Middleware[I, O] {
+	return func(next Endpoint[I, O]) Endpoint[I, O] {
+		return func(ctx context.Context, request I) (O, error) {
+			release, err := b.Acquire(ctx)
+			if err != nil {
+				var empty O
+				return empty, err
+			}
+			defer release()
+
+			return next(ctx, request)
+		}
+	}
+}
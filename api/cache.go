@@ -0,0 +1,327 @@
+package api
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CacheEntry is a result of an endpoint kept by a Cache: its response, or
+// the error it failed with when negative caching is enabled.
+type CacheEntry[T any] struct {
+	Value T            `json:"value"`
+	Err   *CachedError `json:"error,omitempty"`
+
+	// FreshUntil is when the entry becomes stale. Stale entries are only
+	// served by CacheMiddleware in stale-while-revalidate mode.
+	FreshUntil time.Time `json:"fresh_until"`
+}
+
+// CachedError is an error of an endpoint kept by a Cache. It reports the
+// status code of the original error, and wraps the sentinel error matching
+// it, such as ErrNotFound for 404, so it is handled like the original one.
+type CachedError struct {
+	Message string `json:"message"`
+	Status  int    `json:"status"`
+}
+
+func (e *CachedError) Error() string {
+	return e.Message
+}
+
+func (e *CachedError) Unwrap() error {
+	return statusSentinels[e.Status]
+}
+
+func (e *CachedError) StatusCode() int {
+	return e.Status
+}
+
+var statusSentinels = map[int]error{
+	http.StatusBadRequest:            ErrBadRequest,
+	http.StatusForbidden:             ErrForbidden,
+	http.StatusNotFound:              ErrNotFound,
+	http.StatusConflict:              ErrConflict,
+	http.StatusTooManyRequests:       ErrTooManyRequests,
+	http.StatusServiceUnavailable:    ErrUnavailable,
+	http.StatusGatewayTimeout:        ErrTimeout,
+	http.StatusRequestEntityTooLarge: ErrRequestTooLarge,
+}
+
+// newCachedError returns the CachedError of err, with the status code
+// reported by err or matching the sentinel error it wraps.
+func newCachedError(err error) *CachedError {
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) {
+		return &CachedError{Message: err.Error(), Status: sc.StatusCode()}
+	}
+
+	for status, sentinel := range statusSentinels {
+		if errors.Is(err, sentinel) {
+			return &CachedError{Message: err.Error(), Status: status}
+		}
+	}
+
+	return &CachedError{Message: err.Error(), Status: http.StatusInternalServerError}
+}
+
+// Cache keeps the results of an endpoint for CacheMiddleware, such as a
+// MemoryCache or a redisstore.ResultCache. Implementations must be safe for
+// concurrent use.
+type Cache[T any] interface {
+	// Get returns the entry cached under key, or nil.
+	Get(ctx context.Context, key string) (*CacheEntry[T], error)
+
+	// Set caches entry under key for ttl.
+	Set(ctx context.Context, key string, entry *CacheEntry[T], ttl time.Duration) error
+}
+
+// CacheKeyFunc returns the key the result of a request is cached under, or
+// an empty string for a request which must not be cached. Keys of a Cache
+// shared by several endpoints must include the endpoint, and keys of
+// per-caller results the caller.
+type CacheKeyFunc[I any] func(ctx context.Context, request I) string
+
+type cacheOption struct {
+	errorTTL time.Duration
+	cacheErr func(error) bool
+	staleFor time.Duration
+}
+
+// CacheOption sets an optional parameter for CacheMiddleware.
+type CacheOption func(opt *cacheOption)
+
+// CacheErrors enables negative caching: the errors for which fn returns true
+// are cached for ttl, and returned to the following requests as a
+// *CachedError. A nil fn caches the errors wrapping ErrNotFound.
+func CacheErrors(ttl time.Duration, fn func(error) bool) CacheOption {
+	return func(opt *cacheOption) {
+		if fn == nil {
+			fn = func(err error) bool { return errors.Is(err, ErrNotFound) }
+		}
+		opt.errorTTL = ttl
+		opt.cacheErr = fn
+	}
+}
+
+// StaleWhileRevalidate keeps the results in the cache for d after they
+// become stale. A stale result is returned as is while the endpoint is
+// called again in the background, with the values but not the cancellation
+// of the request context, to refresh it. A refresh failing with an error
+// which isn't cached keeps the stale result.
+func StaleWhileRevalidate(d time.Duration) CacheOption {
+	return func(opt *cacheOption) { opt.staleFor = d }
+}
+
+// CacheMiddleware returns a Middleware memoizing the results of the next
+// endpoint in store for ttl, under the key returned by keyFn. Unlike the
+// http cache middleware it caches the decoded responses, so they can be
+// shared by endpoints encoding them differently. Failures of store are
+// ignored, the endpoint being called as if the result wasn't cached.
+func CacheMiddleware[I, O any](keyFn CacheKeyFunc[I], ttl time.Duration, store Cache[O], options ...CacheOption) Middleware[I, O] {
+	opts := &cacheOption{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	var (
+		mu         sync.Mutex
+		refreshing = make(map[string]bool)
+	)
+
+	// call calls next and caches its result.
+	call := func(ctx context.Context, next Endpoint[I, O], key string, request I) (O, error) {
+		response, err := next(ctx, request)
+
+		entry := &CacheEntry[O]{Value: response}
+		fresh := ttl
+		switch {
+		case err == nil:
+		case opts.cacheErr != nil && opts.cacheErr(err):
+			entry = &CacheEntry[O]{Err: newCachedError(err)}
+			fresh = opts.errorTTL
+		default:
+			return response, err
+		}
+
+		if fresh+opts.staleFor > 0 {
+			entry.FreshUntil = time.Now().Add(fresh)
+			_ = store.Set(ctx, key, entry, fresh+opts.staleFor)
+		}
+
+		return response, err
+	}
+
+	revalidate := func(ctx context.Context, next Endpoint[I, O], key string, request I) {
+		mu.Lock()
+		if refreshing[key] {
+			mu.Unlock()
+			return
+		}
+		refreshing[key] = true
+		mu.Unlock()
+
+		go func() {
+			defer func() {
+				mu.Lock()
+				delete(refreshing, key)
+				mu.Unlock()
+			}()
+
+			// a panicking refresh is dropped, the stale entry is kept until
+			// the next one
+			defer func() {
+				_ = recover()
+			}()
+
+			// the refresh must complete before the stale result expires
+			ctx, cancel := context.WithTimeout(WithoutCancel(ctx), opts.staleFor)
+			defer cancel()
+
+			call(ctx, next, key, request)
+		}()
+	}
+
+	return func(next Endpoint[I, O]) Endpoint[I, O] {
+		return func(ctx context.Context, request I) (O, error) {
+			key := keyFn(ctx, request)
+			if key == "" {
+				return next(ctx, request)
+			}
+
+			if entry, err := store.Get(ctx, key); err == nil && entry != nil {
+				if time.Now().After(entry.FreshUntil) {
+					if opts.staleFor <= 0 {
+						return call(ctx, next, key, request)
+					}
+					revalidate(ctx, next, key, request)
+				}
+
+				if entry.Err != nil {
+					var empty O
+					return empty, entry.Err
+				}
+				return entry.Value, nil
+			}
+
+			return call(ctx, next, key, request)
+		}
+	}
+}
+
+// WithoutCancel returns a context carrying the values of parent but not its
+// deadline and cancellation, for the work which must complete after the
+// request it belongs to ends, such as recording its outcome.
+func WithoutCancel(parent context.Context) context.Context {
+	return detachedContext{parent}
+}
+
+// detachedContext carries the values of a context without its deadline and
+// cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+func (detachedContext) Err() error { return nil }
+
+// MemoryCache is an in-process Cache keeping at most a fixed number of
+// entries, evicting the least recently used ones.
+type MemoryCache[T any] struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type memoryCacheItem[T any] struct {
+	key       string
+	entry     *CacheEntry[T]
+	expiresAt time.Time
+}
+
+// NewMemoryCache creates a MemoryCache holding up to size entries.
+func NewMemoryCache[T any](size int) *MemoryCache[T] {
+	return &MemoryCache[T]{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get implements Cache.
+func (c *MemoryCache[T]) Get(_ context.Context, key string) (*CacheEntry[T], error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, nil
+	}
+
+	item := el.Value.(*memoryCacheItem[T])
+	if time.Now().After(item.expiresAt) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, nil
+	}
+
+	c.order.MoveToFront(el)
+	return copyCacheEntry(item.entry), nil
+}
+
+// Set implements Cache.
+func (c *MemoryCache[T]) Set(_ context.Context, key string, entry *CacheEntry[T], ttl time.Duration) error {
+	if c.size <= 0 || ttl <= 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item := &memoryCacheItem[T]{key: key, entry: copyCacheEntry(entry), expiresAt: time.Now().Add(ttl)}
+	if el, ok := c.entries[key]; ok {
+		el.Value = item
+		c.order.MoveToFront(el)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(item)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryCacheItem[T]).key)
+	}
+
+	return nil
+}
+
+// Len returns the number of entries, including the expired ones not
+// evicted yet.
+func (c *MemoryCache[T]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+// copyCacheEntry copies entry, so the entries kept by a MemoryCache are not
+// shared with its callers.
+func copyCacheEntry[T any](entry *CacheEntry[T]) *CacheEntry[T] {
+	if entry == nil {
+		return nil
+	}
+
+	cp := *entry
+	if entry.Err != nil {
+		cachedErr := *entry.Err
+		cp.Err = &cachedErr
+	}
+	return &cp
+}
@@ -0,0 +1,279 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every call through while counting failures.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen rejects every call with ErrCircuitOpen until the open
+	// timeout elapses.
+	CircuitOpen
+
+	// CircuitHalfOpen lets a limited number of trial calls through. A success
+	// closes the circuit again, a failure opens it.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type circuitBreakerOption struct {
+	failureThreshold int
+	openTimeout      time.Duration
+	halfOpenRequests int
+	isFailure        func(error) bool
+	onStateChange    func(name string, from, to CircuitState)
+}
+
+// CircuitBreakerOption sets an optional parameter for circuit breakers.
+type CircuitBreakerOption func(opt *circuitBreakerOption)
+
+// FailureThreshold sets the number of consecutive failures that opens the
+// circuit. Defaults to 5.
+func FailureThreshold(n int) CircuitBreakerOption {
+	return func(opt *circuitBreakerOption) { opt.failureThreshold = n }
+}
+
+// OpenTimeout sets how long the circuit stays open before trial calls are let
+// through. Defaults to 30 seconds.
+func OpenTimeout(d time.Duration) CircuitBreakerOption {
+	return func(opt *circuitBreakerOption) { opt.openTimeout = d }
+}
+
+// HalfOpenRequests sets the number of concurrent trial calls allowed while the
+// circuit is half-open. Defaults to 1.
+func HalfOpenRequests(n int) CircuitBreakerOption {
+	return func(opt *circuitBreakerOption) { opt.halfOpenRequests = n }
+}
+
+// IsFailure sets the predicate deciding which errors count as failures. By
+// default every non-nil error except context cancellation does.
+func IsFailure(fn func(error) bool) CircuitBreakerOption {
+	return func(opt *circuitBreakerOption) { opt.isFailure = fn }
+}
+
+// OnStateChange registers a callback invoked on every state transition, e.g.
+// to update metrics. It is called without holding the breaker lock.
+func OnStateChange(fn func(name string, from, to CircuitState)) CircuitBreakerOption {
+	return func(opt *circuitBreakerOption) { opt.onStateChange = fn }
+}
+
+// CircuitBreaker stops calling a failing dependency for a while so it can
+// recover, instead of piling up requests waiting on timeouts.
+type CircuitBreaker struct {
+	name string
+	opts circuitBreakerOption
+
+	mu         sync.Mutex
+	state      CircuitState
+	generation uint64
+	failures   int
+	openedAt   time.Time
+	inFlight   int
+	now        func() time.Time
+}
+
+// NewCircuitBreaker creates a closed CircuitBreaker. name identifies the
+// breaker in state change callbacks.
+func NewCircuitBreaker(name string, options ...CircuitBreakerOption) *CircuitBreaker {
+	opts := circuitBreakerOption{
+		failureThreshold: 5,
+		openTimeout:      30 * time.Second,
+		halfOpenRequests: 1,
+		isFailure: func(err error) bool {
+			return err != nil && !errors.Is(err, context.Canceled)
+		},
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	return &CircuitBreaker{name: name, opts: opts, now: time.Now}
+}
+
+// Name returns the name of the breaker.
+func (cb *CircuitBreaker) Name() string {
+	return cb.name
+}
+
+// State returns the current state of the breaker.
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitOpen && cb.now().Sub(cb.openedAt) >= cb.opts.openTimeout {
+		return CircuitHalfOpen
+	}
+	return cb.state
+}
+
+// Allow reports whether a call may proceed. When it does, the outcome of the
+// call must be reported by calling done exactly once. Outcomes of calls
+// admitted before the last state change are ignored, so a slow call admitted
+// while closed doesn't decide a half-open trial.
+func (cb *CircuitBreaker) Allow() (done func(err error), err error) {
+	cb.mu.Lock()
+	from := cb.state
+
+	switch cb.state {
+	case CircuitOpen:
+		if cb.now().Sub(cb.openedAt) < cb.opts.openTimeout {
+			cb.mu.Unlock()
+			return nil, ErrCircuitOpen
+		}
+		cb.setState(CircuitHalfOpen)
+		fallthrough
+	case CircuitHalfOpen:
+		if cb.inFlight >= cb.opts.halfOpenRequests {
+			to := cb.state
+			cb.mu.Unlock()
+			cb.notify(from, to)
+			return nil, ErrCircuitOpen
+		}
+		cb.inFlight++
+	}
+
+	state, generation := cb.state, cb.generation
+	cb.mu.Unlock()
+	cb.notify(from, state)
+
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { cb.done(state, generation, err) })
+	}, nil
+}
+
+// done records the outcome of a call admitted in state during generation.
+func (cb *CircuitBreaker) done(state CircuitState, generation uint64, err error) {
+	cb.mu.Lock()
+	if generation != cb.generation {
+		cb.mu.Unlock()
+		return
+	}
+
+	from := cb.state
+	failed := errors.Is(err, errCallPanicked) || cb.opts.isFailure(err)
+
+	switch state {
+	case CircuitHalfOpen:
+		cb.inFlight--
+		if failed {
+			cb.open()
+		} else {
+			cb.failures = 0
+			cb.setState(CircuitClosed)
+		}
+	case CircuitClosed:
+		if !failed {
+			cb.failures = 0
+			break
+		}
+		cb.failures++
+		if cb.failures >= cb.opts.failureThreshold {
+			cb.open()
+		}
+	}
+
+	to := cb.state
+	cb.mu.Unlock()
+	cb.notify(from, to)
+}
+
+// Execute runs fn through the breaker.
+func (cb *CircuitBreaker) Execute(fn func() error) (err error) {
+	done, err := cb.Allow()
+	if err != nil {
+		return err
+	}
+	defer finishCall(done, &err)
+
+	return fn()
+}
+
+// errCallPanicked is the outcome of the calls which panicked, always counted
+// as a failure.
+var errCallPanicked = errors.New("call panicked")
+
+// finishCall reports the outcome err of a call to done. Deferred, it reports
+// a panic of the call as a failure, so a half-open trial is not left in
+// flight forever, and raises it again.
+func finishCall(done func(err error), err *error) {
+	if p := recover(); p != nil {
+		done(errCallPanicked)
+		panic(p)
+	}
+	done(*err)
+}
+
+func (cb *CircuitBreaker) open() {
+	cb.openedAt = cb.now()
+	cb.setState(CircuitOpen)
+}
+
+func (cb *CircuitBreaker) setState(state CircuitState) {
+	if cb.state != state {
+		cb.generation++
+		cb.inFlight = 0
+	}
+	cb.state = state
+}
+
+func (cb *CircuitBreaker) notify(from, to CircuitState) {
+	if from != to && cb.opts.onStateChange != nil {
+		cb.opts.onStateChange(cb.name, from, to)
+	}
+}
+
+// CircuitOpenError is returned by CircuitBreakerMiddleware when the circuit
+// is open. It wraps ErrCircuitOpen and reports a 503 status code.
+type CircuitOpenError struct {
+	Name string
+}
+
+func (e *CircuitOpenError) Error() string {
+	return ErrCircuitOpen.Error() + ": " + e.Name
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+func (e *CircuitOpenError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// CircuitBreakerMiddleware returns a Middleware calling the next endpoint
+// through cb. Calls rejected by an open circuit fail with a
+// *CircuitOpenError.
+func CircuitBreakerMiddleware[I, O any](cb *CircuitBreaker) Middleware[I, O] {
+	return func(next Endpoint[I, O]) Endpoint[I, O] {
+		return func(ctx context.Context, request I) (response O, err error) {
+			done, err := cb.Allow()
+			if err != nil {
+				return response, &CircuitOpenError{Name: cb.name}
+			}
+			defer finishCall(done, &err)
+
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidCursor denotes a pagination cursor which is malformed, or was
+// not issued by the CursorCodec decoding it. It wraps ErrBadRequest.
+var ErrInvalidCursor = fmt.Errorf("%w: invalid cursor", ErrBadRequest)
+
+// CursorCodec encodes the position of a page in a list, such as the sort
+// key of its last item, into an opaque cursor handed to clients, signed so
+// they can't forge one.
+//
+//	type position struct {
+//		CreatedAt time.Time `json:"t"`
+//		ID        string    `json:"id"`
+//	}
+//	codec := api.NewCursorCodec[position](secret)
+//
+//	next, _ := codec.Encode(position{last.CreatedAt, last.ID})
+//	pos, err := codec.Decode(req.Cursor)
+type CursorCodec[T any] struct {
+	secret []byte
+}
+
+// NewCursorCodec creates a CursorCodec signing the cursors with secret.
+func NewCursorCodec[T any](secret []byte) *CursorCodec[T] {
+	return &CursorCodec[T]{secret: secret}
+}
+
+// Encode returns the cursor of position: its JSON form, then a signature,
+// both base64url encoded and separated by a dot.
+func (c *CursorCodec[T]) Encode(position T) (string, error) {
+	data, err := json.Marshal(position)
+	if err != nil {
+		return "", err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + c.sign(payload), nil
+}
+
+// Decode returns the position of cursor, or ErrInvalidCursor.
+func (c *CursorCodec[T]) Decode(cursor string) (T, error) {
+	var position T
+
+	payload, sig, ok := strings.Cut(cursor, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(c.sign(payload))) {
+		return position, ErrInvalidCursor
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return position, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &position); err != nil {
+		return position, ErrInvalidCursor
+	}
+
+	return position, nil
+}
+
+func (c *CursorCodec[T]) sign(payload string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"errors"
+)
+
+// ErrBadRequest denotes a request that could not be decoded or failed
+// validation. The root package re-exports it as apikit.ErrBadRequest so both
+// names can be matched with errors.Is.
+var ErrBadRequest = errors.New("bad request")
+
+// ErrNotFound denotes a missing resource.
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict denotes a request conflicting with the current state of a
+// resource.
+var ErrConflict = errors.New("conflict")
+
+// ErrForbidden denotes a caller not allowed to access a resource.
+var ErrForbidden = errors.New("not authorized to access this resource")
+
+// ErrUnavailable denotes a service temporarily unable to handle requests.
+var ErrUnavailable = errors.New("service unavailable")
+
+// ErrTooManyRequests denotes a request rejected by a rate limiter.
+var ErrTooManyRequests = errors.New("too many requests")
+
+// ErrCircuitOpen denotes a call rejected by an open circuit breaker.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// ErrRequestTooLarge denotes a request whose body exceeds the size limit of
+// the server.
+var ErrRequestTooLarge = errors.New("request body too large")
+
+// ErrTimeout denotes a request that did not complete before its deadline.
+var ErrTimeout = errors.New("request timed out")
+
+// ErrIdempotencyInFlight denotes a retry arriving while the first request with
+// the same idempotency key is still being processed.
+var ErrIdempotencyInFlight = errors.New("a request with the same idempotency key is in progress")
+
+// ErrIdempotencyKeyReused denotes a request reusing the idempotency key of a
+// different request.
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+
+// ErrUploadRejected denotes an uploaded file rejected by a content scanner,
+// such as an antivirus.
+var ErrUploadRejected = errors.New("upload rejected")
@@ -0,0 +1,340 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/likearthian/apikit/internal/storeutil"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ErrInsufficientScope denotes a valid token lacking a scope required by the
+// endpoint.
+var ErrInsufficientScope = errors.New("insufficient scope")
+
+// AuthError is returned by the authentication middlewares. It wraps the
+// cause, reports a 401 status code, or 403 for ErrInsufficientScope and
+// ErrTenantRequired, and carries a WWW-Authenticate challenge. Scheme defaults
+// to Bearer, which gets an RFC 6750 error attribute; other schemes are sent as
+// they are, for instance `Basic realm="api"`.
+type AuthError struct {
+	Err    error
+	Scheme string
+}
+
+func (e *AuthError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+func (e *AuthError) StatusCode() int {
+	if errors.Is(e.Err, ErrInsufficientScope) || errors.Is(e.Err, ErrTenantRequired) {
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
+
+func (e *AuthError) Headers() http.Header {
+	if e.Scheme != "" && e.Scheme != "Bearer" {
+		return http.Header{"WWW-Authenticate": []string{e.Scheme}}
+	}
+
+	challenge := "Bearer"
+	switch {
+	case errors.Is(e.Err, ErrInsufficientScope):
+		challenge += ` error="insufficient_scope"`
+	case errors.Is(e.Err, ErrTokenContextMissing):
+	default:
+		challenge += ` error="invalid_token"`
+	}
+
+	return http.Header{"WWW-Authenticate": []string{challenge}}
+}
+
+type introspectionOption struct {
+	clientID     string
+	clientSecret string
+	userInfo     bool
+	httpClient   *http.Client
+	cacheTTL     time.Duration
+}
+
+// IntrospectionOption sets an optional parameter for Introspector.
+type IntrospectionOption func(opt *introspectionOption)
+
+// IntrospectionClientCredentials sets the credentials the resource server
+// authenticates to the introspection endpoint with, using HTTP basic auth.
+func IntrospectionClientCredentials(clientID, clientSecret string) IntrospectionOption {
+	return func(opt *introspectionOption) {
+		opt.clientID = clientID
+		opt.clientSecret = clientSecret
+	}
+}
+
+// IntrospectionUserInfo makes the Introspector call an OIDC userinfo endpoint
+// with the token as bearer credential instead of an RFC 7662 introspection
+// endpoint. Any successful response means the token is active.
+func IntrospectionUserInfo() IntrospectionOption {
+	return func(opt *introspectionOption) { opt.userInfo = true }
+}
+
+// IntrospectionHTTPClient sets the client used to call the endpoint. Defaults
+// to a client with a 10 second timeout.
+func IntrospectionHTTPClient(client *http.Client) IntrospectionOption {
+	return func(opt *introspectionOption) { opt.httpClient = client }
+}
+
+// IntrospectionCacheTTL sets how long introspection results are cached.
+// Active tokens are never cached past their expiry. Defaults to one minute;
+// zero disables caching.
+func IntrospectionCacheTTL(d time.Duration) IntrospectionOption {
+	return func(opt *introspectionOption) { opt.cacheTTL = d }
+}
+
+// Introspector validates opaque bearer tokens against an OAuth2 token
+// introspection endpoint (RFC 7662) or an OIDC userinfo endpoint, caching the
+// results.
+type Introspector struct {
+	endpoint string
+	opts     introspectionOption
+
+	mu      sync.Mutex
+	cache   map[string]introspectionEntry
+	sweeper storeutil.Sweeper
+}
+
+type introspectionEntry struct {
+	claims  *TokenClaims
+	err     error
+	expires time.Time
+}
+
+// NewIntrospector creates an Introspector calling endpoint.
+func NewIntrospector(endpoint string, options ...IntrospectionOption) *Introspector {
+	opts := introspectionOption{
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		cacheTTL:   time.Minute,
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	return &Introspector{
+		endpoint: endpoint,
+		opts:     opts,
+		cache:    make(map[string]introspectionEntry),
+	}
+}
+
+// Introspect returns the claims of token. Inactive or unknown tokens fail
+// with ErrTokenInvalid. The standard introspection members are mapped to the
+// registered claims; every member, including scope and client_id, is also
+// available in Data.
+func (in *Introspector) Introspect(ctx context.Context, token string) (*TokenClaims, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	now := time.Now()
+
+	if in.opts.cacheTTL > 0 {
+		in.mu.Lock()
+		entry, ok := in.cache[key]
+		in.mu.Unlock()
+		if ok && now.Before(entry.expires) {
+			return entry.claims, entry.err
+		}
+	}
+
+	claims, err := in.introspect(ctx, token)
+	var invalid bool
+	if err != nil {
+		if !errors.Is(err, ErrTokenInvalid) {
+			// transient failures of the endpoint are not cached
+			return nil, err
+		}
+		invalid = true
+	}
+
+	if in.opts.cacheTTL > 0 {
+		expires := now.Add(in.opts.cacheTTL)
+		if !invalid && claims.ExpiresAt != nil && claims.ExpiresAt.Time.Before(expires) {
+			expires = claims.ExpiresAt.Time
+		}
+
+		in.mu.Lock()
+		in.sweep(now)
+		in.cache[key] = introspectionEntry{claims: claims, err: err, expires: expires}
+		in.mu.Unlock()
+	}
+
+	return claims, err
+}
+
+func (in *Introspector) introspect(ctx context.Context, token string) (*TokenClaims, error) {
+	var (
+		req *http.Request
+		err error
+	)
+	if in.opts.userInfo {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, in.endpoint, nil)
+		if err == nil {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	} else {
+		form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, in.endpoint, strings.NewReader(form.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	if in.opts.clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(in.opts.clientID), url.QueryEscape(in.opts.clientSecret))
+	}
+
+	resp, err := in.opts.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("introspecting token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if in.opts.userInfo && resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrTokenInvalid
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("introspecting token: unexpected status %s", resp.Status)
+	}
+
+	var data map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("decoding introspection response: %w", err)
+	}
+
+	if !in.opts.userInfo {
+		if active, _ := data["active"].(bool); !active {
+			return nil, ErrTokenInvalid
+		}
+	}
+
+	return introspectionClaims(data), nil
+}
+
+func (in *Introspector) sweep(now time.Time) {
+	if !in.sweeper.Due(now) {
+		return
+	}
+
+	storeutil.DeleteExpired(in.cache, now, func(entry introspectionEntry) time.Time { return entry.expires })
+}
+
+func introspectionClaims(data map[string]interface{}) *TokenClaims {
+	claims := &TokenClaims{Type: TokenTypeAccess, Data: data}
+	claims.Subject, _ = data["sub"].(string)
+	claims.Issuer, _ = data["iss"].(string)
+	claims.ID, _ = data["jti"].(string)
+
+	switch aud := data["aud"].(type) {
+	case string:
+		claims.Audience = jwt.ClaimStrings{aud}
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				claims.Audience = append(claims.Audience, s)
+			}
+		}
+	}
+
+	if exp, ok := data["exp"].(float64); ok {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Unix(int64(exp), 0))
+	}
+	if iat, ok := data["iat"].(float64); ok {
+		claims.IssuedAt = jwt.NewNumericDate(time.Unix(int64(iat), 0))
+	}
+	if nbf, ok := data["nbf"].(float64); ok {
+		claims.NotBefore = jwt.NewNumericDate(time.Unix(int64(nbf), 0))
+	}
+
+	return claims
+}
+
+// Scopes returns the space separated scopes of the "scope" member of the
+// claims data, as found in introspection responses.
+func (c *TokenClaims) Scopes() []string {
+	scope, _ := c.Data["scope"].(string)
+	return strings.Fields(scope)
+}
+
+// RequireScopes fails with ErrInsufficientScope unless claims grant every one
+// of scopes.
+func RequireScopes(claims *TokenClaims, scopes ...string) error {
+	granted := make(map[string]bool)
+	for _, s := range claims.Scopes() {
+		granted[s] = true
+	}
+
+	for _, s := range scopes {
+		if !granted[s] {
+			return fmt.Errorf("%w: missing %s", ErrInsufficientScope, s)
+		}
+	}
+
+	return nil
+}
+
+// Authenticate introspects token, checks it grants scopes and returns a context holding its claims under
+// ContextKeyAuthClaims. Failures are returned as *AuthError.
+func (in *Introspector) Authenticate(ctx context.Context, token string, scopes ...string) (context.Context, error) {
+	if token == "" {
+		return ctx, &AuthError{Err: ErrTokenContextMissing}
+	}
+
+	claims, err := in.Introspect(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrTokenInvalid) {
+			return ctx, &AuthError{Err: err}
+		}
+		return ctx, err
+	}
+
+	if err := RequireScopes(claims, scopes...); err != nil {
+		return ctx, &AuthError{Err: err}
+	}
+
+	return context.WithValue(ctx, ContextKeyAuthClaims, claims), nil
+}
+
+// IntrospectionMiddleware returns a Middleware authenticating requests with
+// the opaque token found under ContextKeyAuthToken, requiring every one of
+// scopes. The claims are stored under ContextKeyAuthClaims.
+func IntrospectionMiddleware[I, O any](in *Introspector, scopes ...string) Middleware[I, O] {
+	return func(next Endpoint[I, O]) Endpoint[I, O] {
+		return func(ctx context.Context, request I) (O, error) {
+			var empty O
+
+			token, _ := ctx.Value(ContextKeyAuthToken).(string)
+			ctx, err := in.Authenticate(ctx, token, scopes...)
+			if err != nil {
+				return empty, err
+			}
+
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ErrUnknownKeyID denotes a token whose kid header matches no key of the JWKS,
+// even after refreshing it.
+var ErrUnknownKeyID = errors.New("unknown signing key id")
+
+type jwksOption struct {
+	httpClient      *http.Client
+	refreshInterval time.Duration
+	minRefresh      time.Duration
+}
+
+// JWKSOption sets an optional parameter for JWKSClient.
+type JWKSOption func(opt *jwksOption)
+
+// JWKSHTTPClient sets the client used to fetch the key set. Defaults to a
+// client with a 10 second timeout.
+func JWKSHTTPClient(client *http.Client) JWKSOption {
+	return func(opt *jwksOption) { opt.httpClient = client }
+}
+
+// JWKSRefreshInterval sets how long a fetched key set is cached. Defaults to
+// one hour.
+func JWKSRefreshInterval(d time.Duration) JWKSOption {
+	return func(opt *jwksOption) { opt.refreshInterval = d }
+}
+
+// JWKSMinRefreshInterval sets the minimum delay between two refreshes
+// triggered by an unknown kid, so tokens with made up key ids can't make the
+// client hammer the identity provider. Defaults to one minute.
+func JWKSMinRefreshInterval(d time.Duration) JWKSOption {
+	return func(opt *jwksOption) { opt.minRefresh = d }
+}
+
+// JWKSClient fetches the public keys published at a jwks_uri and looks them up
+// by key id. The key set is cached and refreshed periodically, or early when a
+// token names a key id the cached set doesn't have, which happens when the
+// provider rotates its keys. Concurrent lookups share a single refresh, and
+// when a refresh fails the previous key set keeps being served, the refresh
+// being retried after the minimum refresh interval.
+type JWKSClient struct {
+	uri  string
+	opts jwksOption
+
+	mu          sync.Mutex
+	keys        map[string]interface{}
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	refreshing  *jwksRefresh
+}
+
+// jwksRefresh is a refresh in progress, awaited by the lookups that need it.
+type jwksRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+// NewJWKSClient creates a JWKSClient for the key set published at uri. Keys
+// are fetched on first use.
+func NewJWKSClient(uri string, options ...JWKSOption) *JWKSClient {
+	opts := jwksOption{
+		httpClient:      &http.Client{Timeout: 10 * time.Second},
+		refreshInterval: time.Hour,
+		minRefresh:      time.Minute,
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	return &JWKSClient{uri: uri, opts: opts}
+}
+
+// Key returns the public key with the given id, an *rsa.PublicKey or an
+// *ecdsa.PublicKey.
+func (c *JWKSClient) Key(ctx context.Context, kid string) (interface{}, error) {
+	now := time.Now()
+	keys, fetchedAt, attemptedAt := c.state()
+	if keys == nil || now.Sub(fetchedAt) >= c.opts.refreshInterval && now.Sub(attemptedAt) >= c.opts.minRefresh {
+		if err := c.refresh(ctx); err != nil && keys == nil {
+			return nil, err
+		}
+		keys, _, attemptedAt = c.state()
+	}
+
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+
+	if time.Since(attemptedAt) < c.opts.minRefresh {
+		return nil, ErrUnknownKeyID
+	}
+
+	if err := c.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	keys, _, _ = c.state()
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, ErrUnknownKeyID
+}
+
+// Keyfunc is a jwt.Keyfunc returning the key named by the kid header of the
+// token. Pass it to WithKeyFunc or ParseTokenWithKeyFunc.
+func (c *JWKSClient) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	return c.Key(context.Background(), kid)
+}
+
+func (c *JWKSClient) state() (keys map[string]interface{}, fetchedAt, attemptedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.keys, c.fetchedAt, c.attemptedAt
+}
+
+// refresh fetches the key set, or waits for the refresh already in progress.
+// The lock is not held while fetching, and the key set is only replaced when
+// the fetch succeeds.
+func (c *JWKSClient) refresh(ctx context.Context) error {
+	c.mu.Lock()
+	if r := c.refreshing; r != nil {
+		c.mu.Unlock()
+		select {
+		case <-r.done:
+			return r.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	r := &jwksRefresh{done: make(chan struct{})}
+	c.refreshing = r
+	c.attemptedAt = time.Now()
+	c.mu.Unlock()
+
+	keys, err := c.fetch(ctx)
+
+	c.mu.Lock()
+	if err == nil {
+		c.keys = keys
+		c.fetchedAt = time.Now()
+	}
+	c.refreshing = nil
+	c.mu.Unlock()
+
+	r.err = err
+	close(r.done)
+	return err
+}
+
+func (c *JWKSClient) fetch(ctx context.Context) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.opts.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching jwks: unexpected status %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decoding jwks: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			// skip keys of unsupported types rather than failing the whole set
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+// jsonWebKey is an RSA or EC public key as described by RFC 7517.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
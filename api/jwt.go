@@ -0,0 +1,208 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/likearthian/apikit/internal/storeutil"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ContextKey is the type of the context keys set by this package.
+type ContextKey int
+
+const (
+	// ContextKeyAuthToken holds the raw bearer token of the request, as a
+	// string. Transports put it into the context for WithJWTAuthEPMiddleware.
+	ContextKeyAuthToken ContextKey = iota
+
+	// ContextKeyAuthClaims holds the claims of the authenticated caller. JWT
+	// authentication and token introspection store a *TokenClaims; other
+	// authentication schemes store their own claims type.
+	ContextKeyAuthClaims
+
+	// ContextKeyTenant holds the *Tenant the authenticated caller belongs to.
+	ContextKeyTenant
+
+	// ContextKeyEndpoint holds the EndpointInfo of the endpoint being called,
+	// as stored by EndpointMiddleware.
+	ContextKeyEndpoint
+
+	// ContextKeyTx holds the *sql.Tx begun by TxMiddleware.
+	ContextKeyTx
+)
+
+// AuthClaimsFromContext returns the claims stored by WithJWTAuthEPMiddleware.
+func AuthClaimsFromContext(ctx context.Context) (*TokenClaims, bool) {
+	claims, ok := ctx.Value(ContextKeyAuthClaims).(*TokenClaims)
+	return claims, ok
+}
+
+type jwtOption struct {
+	isRevoked func(ctx context.Context, jti string) (bool, error)
+	keyFunc   jwt.Keyfunc
+	methods   []jwt.SigningMethod
+	issuer    string
+	audience  []string
+}
+
+// JwtOption sets an optional parameter for WithJWTAuthEPMiddleware.
+type JwtOption func(opt *jwtOption)
+
+// WithRevocationChecker rejects tokens whose id (jti) fn reports as revoked
+// with ErrTokenRevoked. RevocationStore.IsRevoked has the expected signature.
+func WithRevocationChecker(fn func(ctx context.Context, jti string) (bool, error)) JwtOption {
+	return func(opt *jwtOption) { opt.isRevoked = fn }
+}
+
+// WithKeyFunc verifies tokens with the key returned by fn instead of the
+// secret given to WithJWTAuthEPMiddleware. Use it with JWKSClient.Keyfunc to
+// verify tokens signed by an identity provider. Unless WithSigningMethods is
+// also set, RS256 and ES256 signatures are accepted.
+func WithKeyFunc(fn jwt.Keyfunc) JwtOption {
+	return func(opt *jwtOption) { opt.keyFunc = fn }
+}
+
+// WithSigningMethods sets the signing methods tokens are accepted with.
+// Tokens signed with any other method fail with ErrUnexpectedSigningMethod.
+func WithSigningMethods(methods ...jwt.SigningMethod) JwtOption {
+	return func(opt *jwtOption) { opt.methods = methods }
+}
+
+// WithIssuer rejects tokens whose iss claim is not issuer with
+// ErrTokenInvalid.
+func WithIssuer(issuer string) JwtOption {
+	return func(opt *jwtOption) { opt.issuer = issuer }
+}
+
+// WithAudience rejects tokens whose aud claim contains none of audience with
+// ErrTokenInvalid, so tokens issued for other services are not accepted.
+func WithAudience(audience ...string) JwtOption {
+	return func(opt *jwtOption) { opt.audience = audience }
+}
+
+// WithJWTAuthEPMiddleware returns a Middleware authenticating requests with
+// the access token found under ContextKeyAuthToken. Valid tokens have their
+// claims stored under ContextKeyAuthClaims; missing, invalid, expired or
+// revoked tokens fail the request with the matching token error.
+func WithJWTAuthEPMiddleware[I, O any](secret []byte, options ...JwtOption) Middleware[I, O] {
+	opts := &jwtOption{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	if opts.keyFunc == nil {
+		opts.keyFunc = func(*jwt.Token) (interface{}, error) { return secret, nil }
+		if len(opts.methods) == 0 {
+			opts.methods = []jwt.SigningMethod{jwtSigningMethod}
+		}
+	}
+	if len(opts.methods) == 0 {
+		opts.methods = []jwt.SigningMethod{jwt.SigningMethodRS256, jwt.SigningMethodES256}
+	}
+
+	return func(next Endpoint[I, O]) Endpoint[I, O] {
+		return func(ctx context.Context, request I) (O, error) {
+			var empty O
+
+			tokenString, ok := ctx.Value(ContextKeyAuthToken).(string)
+			if !ok || tokenString == "" {
+				return empty, ErrTokenContextMissing
+			}
+
+			claims, err := ParseTokenWithKeyFunc(tokenString, opts.keyFunc, opts.methods...)
+			if err != nil {
+				return empty, err
+			}
+
+			if claims.Type == TokenTypeRefresh {
+				return empty, ErrTokenInvalid
+			}
+
+			if err := claims.verifyIssuerAudience(opts.issuer, opts.audience); err != nil {
+				return empty, err
+			}
+
+			if opts.isRevoked != nil {
+				revoked, err := opts.isRevoked(ctx, claims.ID)
+				if err != nil {
+					return empty, err
+				}
+				if revoked {
+					return empty, ErrTokenRevoked
+				}
+			}
+
+			ctx = context.WithValue(ctx, ContextKeyAuthClaims, claims)
+			return next(ctx, request)
+		}
+	}
+}
+
+// RevocationStore records the ids of tokens revoked before they expire, for
+// logout and forced invalidation. Implementations must be safe for concurrent
+// use.
+type RevocationStore interface {
+	// Revoke marks the token id as revoked. The entry is only needed until
+	// expiresAt, after which the token is rejected as expired anyway.
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+
+	// IsRevoked reports whether the token id was revoked.
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// RevokeToken revokes the token described by claims in store.
+func RevokeToken(ctx context.Context, store RevocationStore, claims *TokenClaims) error {
+	expiresAt := time.Now()
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	return store.Revoke(ctx, claims.ID, expiresAt)
+}
+
+// MemoryRevocationStore is an in-process RevocationStore. Entries are evicted
+// periodically once their token has expired.
+type MemoryRevocationStore struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+	now     func() time.Time
+	sweeper storeutil.Sweeper
+}
+
+// NewMemoryRevocationStore creates an empty MemoryRevocationStore.
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		revoked: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+// Revoke implements RevocationStore.
+func (s *MemoryRevocationStore) Revoke(_ context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(s.now())
+	s.revoked[jti] = expiresAt
+	return nil
+}
+
+// IsRevoked implements RevocationStore.
+func (s *MemoryRevocationStore) IsRevoked(_ context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.revoked[jti]
+	return ok, nil
+}
+
+func (s *MemoryRevocationStore) sweep(now time.Time) {
+	if !s.sweeper.Due(now) {
+		return
+	}
+
+	storeutil.DeleteExpired(s.revoked, now, func(expires time.Time) time.Time { return expires })
+}
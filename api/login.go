@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+var (
+	// ErrInvalidCredentials denotes a login with an unknown user or a wrong
+	// password. It wraps ErrUnauthorized.
+	ErrInvalidCredentials = fmt.Errorf("%w: invalid credentials", ErrUnauthorized)
+
+	// ErrSecondFactorRequired denotes a login with a valid password, but
+	// without the one-time code the user must also present. It wraps
+	// ErrUnauthorized.
+	ErrSecondFactorRequired = fmt.Errorf("%w: second factor required", ErrUnauthorized)
+
+	// ErrInvalidSecondFactor denotes a login with a wrong one-time code. It
+	// wraps ErrUnauthorized.
+	ErrInvalidSecondFactor = fmt.Errorf("%w: invalid second factor", ErrUnauthorized)
+)
+
+// Identity is a user recognized by a PasswordAuthenticator: the subject of
+// the tokens issued to it, and the data they carry.
+type Identity struct {
+	Subject string
+	Data    map[string]interface{}
+}
+
+// PasswordAuthenticator checks the password of a user. It fails with
+// ErrInvalidCredentials when the user is unknown or the password wrong,
+// without telling the two apart.
+type PasswordAuthenticator interface {
+	Authenticate(ctx context.Context, username, password string) (Identity, error)
+}
+
+// PasswordAuthenticatorFunc adapts a function to the PasswordAuthenticator
+// interface.
+type PasswordAuthenticatorFunc func(ctx context.Context, username, password string) (Identity, error)
+
+// Authenticate implements PasswordAuthenticator.
+func (f PasswordAuthenticatorFunc) Authenticate(ctx context.Context, username, password string) (Identity, error) {
+	return f(ctx, username, password)
+}
+
+// SecondFactor checks the one-time codes of the users enrolled in a second
+// authentication factor, such as the TOTP of NewTOTPSecondFactor.
+type SecondFactor interface {
+	// Required reports whether id must present a one-time code.
+	Required(ctx context.Context, id Identity) (bool, error)
+
+	// Verify checks the one-time code of id, failing with
+	// ErrInvalidSecondFactor when it is wrong.
+	Verify(ctx context.Context, id Identity, code string) error
+}
+
+// LoginRequest is the request of the endpoint made by
+// MakePasswordLoginEndpoint. Code is the one-time code of the users enrolled
+// in a second factor.
+type LoginRequest struct {
+	Username string `json:"username" validate:"required"`
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code,omitempty"`
+}
+
+type loginOption struct {
+	secondFactor SecondFactor
+	onLogin      func(ctx context.Context, id Identity, err error)
+}
+
+// LoginOption sets an optional parameter for MakePasswordLoginEndpoint.
+type LoginOption func(opt *loginOption)
+
+// WithSecondFactor requires the users enrolled in sf to present a one-time
+// code with their password.
+func WithSecondFactor(sf SecondFactor) LoginOption {
+	return func(opt *loginOption) { opt.secondFactor = sf }
+}
+
+// OnLogin sets a function called after every login attempt, with the error
+// failing it, if any, such as to audit logins or lock out users after too
+// many failures. The identity is empty when the password was wrong.
+func OnLogin(fn func(ctx context.Context, id Identity, err error)) LoginOption {
+	return func(opt *loginOption) { opt.onLogin = fn }
+}
+
+// MakePasswordLoginEndpoint returns an Endpoint checking the credentials of
+// a LoginRequest with auth, and the one-time code of the users enrolled in a
+// second factor, then issuing them a TokenPair. Users enrolled in a second
+// factor who sent no code fail with ErrSecondFactorRequired, so clients know
+// to prompt for it and send the login again. The pairs are refreshed with the
+// endpoint of MakeRefreshTokenEndpoint, and revoked with the one of
+// MakeLogoutEndpoint.
+func MakePasswordLoginEndpoint(issuer *TokenIssuer, auth PasswordAuthenticator, options ...LoginOption) Endpoint[LoginRequest, TokenPair] {
+	var opts loginOption
+	for _, option := range options {
+		option(&opts)
+	}
+
+	return func(ctx context.Context, request LoginRequest) (TokenPair, error) {
+		id, err := login(ctx, auth, opts.secondFactor, request)
+		if opts.onLogin != nil {
+			opts.onLogin(ctx, id, err)
+		}
+		if err != nil {
+			return TokenPair{}, err
+		}
+
+		return issuer.Issue(ctx, id.Subject, id.Data)
+	}
+}
+
+func login(ctx context.Context, auth PasswordAuthenticator, sf SecondFactor, request LoginRequest) (Identity, error) {
+	id, err := auth.Authenticate(ctx, request.Username, request.Password)
+	if err != nil {
+		return Identity{}, err
+	}
+	if sf == nil {
+		return id, nil
+	}
+
+	required, err := sf.Required(ctx, id)
+	if err != nil || !required {
+		return id, err
+	}
+	if request.Code == "" {
+		return id, ErrSecondFactorRequired
+	}
+
+	return id, sf.Verify(ctx, id, request.Code)
+}
+
+// LogoutRequest is the request of the endpoint made by MakeLogoutEndpoint.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// MakeLogoutEndpoint returns an Endpoint revoking the family of the refresh
+// token of a LogoutRequest, so neither it nor the tokens rotated from the
+// same login can be exchanged again. When revocations is not nil, the access
+// token authenticating the call, found with AuthClaimsFromContext, is
+// revoked in it too, so it is rejected before it expires by the middlewares
+// checking revocations.
+func MakeLogoutEndpoint(issuer *TokenIssuer, revocations RevocationStore) Endpoint[LogoutRequest, struct{}] {
+	return func(ctx context.Context, request LogoutRequest) (struct{}, error) {
+		if err := issuer.Revoke(ctx, request.RefreshToken); err != nil {
+			return struct{}{}, err
+		}
+
+		if revocations != nil {
+			if claims, ok := AuthClaimsFromContext(ctx); ok && claims.ID != "" {
+				if err := RevokeToken(ctx, revocations, claims); err != nil {
+					return struct{}{}, err
+				}
+			}
+		}
+
+		return struct{}{}, nil
+	}
+}
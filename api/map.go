@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+)
+
+// MapRequest returns an adapter serving an Endpoint[I, O] with requests of
+// type I2, converted by fn, such as the DTO of an older version of the API or
+// of an external contract. The endpoint is wrapped as it is, with its
+// middleware chain. Errors of fn are returned as they are, without calling
+// the endpoint; wrap them with ErrBadRequest for requests which can't be
+// converted.
+//
+//	v1 := api.MapRequest(func(ctx context.Context, r CreateUserV1) (CreateUser, error) {
+//		return CreateUser{Name: r.FirstName + " " + r.LastName}, nil
+//	})(createUser)
+func MapRequest[I2, I, O any](fn func(ctx context.Context, request I2) (I, error)) func(Endpoint[I, O]) Endpoint[I2, O] {
+	return func(next Endpoint[I, O]) Endpoint[I2, O] {
+		return func(ctx context.Context, request I2) (O, error) {
+			req, err := fn(ctx, request)
+			if err != nil {
+				var empty O
+				return empty, err
+			}
+
+			return next(ctx, req)
+		}
+	}
+}
+
+// MapResponse returns an adapter converting the responses of an
+// Endpoint[I, O] to O2 with fn. Failing calls are returned as they are,
+// without calling fn.
+func MapResponse[I, O, O2 any](fn func(ctx context.Context, response O) (O2, error)) func(Endpoint[I, O]) Endpoint[I, O2] {
+	return func(next Endpoint[I, O]) Endpoint[I, O2] {
+		return func(ctx context.Context, request I) (O2, error) {
+			response, err := next(ctx, request)
+			if err != nil {
+				var empty O2
+				return empty, err
+			}
+
+			return fn(ctx, response)
+		}
+	}
+}
+
+// Map returns an adapter converting both the requests and the responses of
+// an Endpoint[I, O], with req and res, like MapRequest and MapResponse
+// together.
+func Map[I2, I, O, O2 any](req func(ctx context.Context, request I2) (I, error), res func(ctx context.Context, response O) (O2, error)) func(Endpoint[I, O]) Endpoint[I2, O2] {
+	return func(next Endpoint[I, O]) Endpoint[I2, O2] {
+		return MapResponse[I2](res)(MapRequest[I2, I, O](req)(next))
+	}
+}
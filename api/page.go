@@ -0,0 +1,256 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SortField is a field to sort by, in ascending order unless Desc.
+type SortField struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+// FilterOp is the comparison of a Filter.
+type FilterOp string
+
+// Filter operators. FilterIn matches any of the Values.
+const (
+	FilterEq   FilterOp = "eq"
+	FilterNe   FilterOp = "ne"
+	FilterGt   FilterOp = "gt"
+	FilterGte  FilterOp = "gte"
+	FilterLt   FilterOp = "lt"
+	FilterLte  FilterOp = "lte"
+	FilterLike FilterOp = "like"
+	FilterIn   FilterOp = "in"
+)
+
+var filterOps = map[FilterOp]bool{
+	FilterEq: true, FilterNe: true, FilterGt: true, FilterGte: true,
+	FilterLt: true, FilterLte: true, FilterLike: true, FilterIn: true,
+}
+
+// Filter restricts the items listed to those whose Field compares to Value,
+// or to one of Values for FilterIn.
+type Filter struct {
+	Field  string   `json:"field"`
+	Op     FilterOp `json:"op"`
+	Value  string   `json:"value,omitempty"`
+	Values []string `json:"values,omitempty"`
+}
+
+// PageRequest is the page of a list requested by a client, with its order
+// and filters, as parsed by ParsePageRequest. Page starts at 1. Cursor is the
+// opaque cursor of the page, as issued by a CursorCodec, for lists paginated
+// with cursors rather than offsets.
+type PageRequest struct {
+	Page    int         `json:"page"`
+	Size    int         `json:"size"`
+	Cursor  string      `json:"cursor,omitempty"`
+	Sort    []SortField `json:"sort,omitempty"`
+	Filters []Filter    `json:"filters,omitempty"`
+}
+
+// Offset returns the number of items before the page.
+func (p PageRequest) Offset() int {
+	if p.Page < 1 {
+		return 0
+	}
+	return (p.Page - 1) * p.Size
+}
+
+// Limit returns the number of items of the page.
+func (p PageRequest) Limit() int {
+	return p.Size
+}
+
+// TotalPages returns the number of pages of total items.
+func (p PageRequest) TotalPages(total int) int {
+	if p.Size <= 0 || total <= 0 {
+		return 0
+	}
+	return (total + p.Size - 1) / p.Size
+}
+
+type pageOption struct {
+	defaultSize int
+	maxSize     int
+	sortable    map[string]bool
+	filterable  map[string]bool
+	defaultSort []SortField
+}
+
+// PageOption sets an optional parameter for ParsePageRequest.
+type PageOption func(opt *pageOption)
+
+// PageSize sets the size of the pages when the client doesn't choose one,
+// and the largest size it may choose. Defaults to 20 and 100.
+func PageSize(def, max int) PageOption {
+	return func(opt *pageOption) {
+		opt.defaultSize = def
+		opt.maxSize = max
+	}
+}
+
+// SortableFields sets the fields the client may sort by. By default, sorting
+// is rejected.
+func SortableFields(fields ...string) PageOption {
+	return func(opt *pageOption) {
+		for _, f := range fields {
+			opt.sortable[f] = true
+		}
+	}
+}
+
+// FilterableFields sets the fields the client may filter on. By default,
+// filtering is rejected.
+func FilterableFields(fields ...string) PageOption {
+	return func(opt *pageOption) {
+		for _, f := range fields {
+			opt.filterable[f] = true
+		}
+	}
+}
+
+// DefaultSort sets the order of the pages when the client doesn't choose
+// one.
+func DefaultSort(fields ...SortField) PageOption {
+	return func(opt *pageOption) { opt.defaultSort = fields }
+}
+
+// ParsePageRequest parses the page requested in a query string:
+//
+//	page=2&size=50&sort=created_at:desc,name&filter[status]=open&filter[amount][gte]=10&filter[id][in]=1,2
+//
+// or, for lists paginated with cursors, cursor=<cursor>&size=50.
+//
+// Sort fields are separated by commas, or given in repeated sort params, and
+// are ascending unless suffixed by ":desc". Filters compare with FilterEq
+// unless their operator is given in a second bracket. Only the fields allowed
+// by SortableFields and FilterableFields are accepted; the errors are
+// reported as a *ValidationError.
+func ParsePageRequest(query url.Values, options ...PageOption) (PageRequest, error) {
+	opts := &pageOption{
+		defaultSize: 20,
+		maxSize:     100,
+		sortable:    make(map[string]bool),
+		filterable:  make(map[string]bool),
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	req := PageRequest{Page: 1, Size: opts.defaultSize}
+	verr := NewValidationError()
+
+	if v := query.Get("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			verr.AddCode("page", "invalid", "must be a positive integer")
+		}
+		req.Page = page
+	}
+
+	req.Cursor = query.Get("cursor")
+
+	if v := query.Get("size"); v != "" {
+		size, err := strconv.Atoi(v)
+		switch {
+		case err != nil || size < 1:
+			verr.AddCode("size", "invalid", "must be a positive integer")
+		case opts.maxSize > 0 && size > opts.maxSize:
+			verr.AddCode("size", "max", fmt.Sprintf("must be at most %d", opts.maxSize))
+		}
+		req.Size = size
+	}
+
+	for _, v := range query["sort"] {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+
+			field, dir, _ := strings.Cut(s, ":")
+			if !opts.sortable[field] {
+				verr.AddCode("sort", "not_allowed", fmt.Sprintf("cannot sort by %q", field))
+				continue
+			}
+
+			switch strings.ToLower(dir) {
+			case "", "asc":
+				req.Sort = append(req.Sort, SortField{Field: field})
+			case "desc":
+				req.Sort = append(req.Sort, SortField{Field: field, Desc: true})
+			default:
+				verr.AddCode("sort", "invalid", fmt.Sprintf("invalid direction %q", dir))
+			}
+		}
+	}
+	if len(req.Sort) == 0 {
+		req.Sort = opts.defaultSort
+	}
+
+	// filters are listed in the order of their keys
+	var keys []string
+	for key := range query {
+		if strings.HasPrefix(key, "filter[") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		values := query[key]
+
+		field, op, ok := parseFilterKey(key)
+		if !ok {
+			verr.AddCode(key, "invalid", "invalid filter")
+			continue
+		}
+		if !opts.filterable[field] {
+			verr.AddCode(key, "not_allowed", fmt.Sprintf("cannot filter on %q", field))
+			continue
+		}
+		if !filterOps[op] {
+			verr.AddCode(key, "invalid", fmt.Sprintf("invalid operator %q", op))
+			continue
+		}
+
+		for _, v := range values {
+			f := Filter{Field: field, Op: op, Value: v}
+			if op == FilterIn {
+				f.Value = ""
+				f.Values = strings.Split(v, ",")
+			}
+			req.Filters = append(req.Filters, f)
+		}
+	}
+
+	if verr.HasErrors() {
+		return req, verr
+	}
+
+	return req, nil
+}
+
+// parseFilterKey parses filter[field] and filter[field][op].
+func parseFilterKey(key string) (field string, op FilterOp, ok bool) {
+	rest := strings.TrimPrefix(key, "filter[")
+	field, rest, ok = strings.Cut(rest, "]")
+	if !ok || field == "" {
+		return "", "", false
+	}
+
+	switch {
+	case rest == "":
+		return field, FilterEq, true
+	case strings.HasPrefix(rest, "[") && strings.HasSuffix(rest, "]") && len(rest) > 2:
+		return field, FilterOp(strings.ToLower(rest[1 : len(rest)-1])), true
+	}
+
+	return "", "", false
+}
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ParallelError is returned by the combinators of this file when too many of
+// their endpoints failed. Errors holds the error of each endpoint, in the
+// order of the endpoints, nil for those which succeeded or were cancelled
+// before failing. It unwraps to the first of them.
+type ParallelError struct {
+	Errors []error
+}
+
+func (e *ParallelError) Error() string {
+	var failed int
+	var first error
+	for _, err := range e.Errors {
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			failed++
+		}
+	}
+
+	return fmt.Sprintf("%d of %d calls failed: %v", failed, len(e.Errors), first)
+}
+
+func (e *ParallelError) Unwrap() error {
+	for _, err := range e.Errors {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// callRecover calls ep, recovering its panic, so the combinators of this file
+// raise it again on the calling goroutine, where it can be recovered.
+func callRecover[I, O any](ctx context.Context, ep Endpoint[I, O], request I) (value O, panicked interface{}, err error) {
+	defer func() {
+		panicked = recover()
+	}()
+
+	value, err = ep(ctx, request)
+	return value, nil, err
+}
+
+// Parallel returns an Endpoint calling every endpoint of eps concurrently
+// with its request, and returning their Results, in the order of eps, once
+// they all returned. It never fails: the policy deciding which failures are
+// acceptable belongs to the caller, such as with Successes or MapResponse.
+// A panic of an endpoint is raised again once they all returned.
+func Parallel[I, O any](eps ...Endpoint[I, O]) Endpoint[I, []Result[O]] {
+	return func(ctx context.Context, request I) ([]Result[O], error) {
+		results := make([]Result[O], len(eps))
+		panics := make([]interface{}, len(eps))
+
+		var wg sync.WaitGroup
+		wg.Add(len(eps))
+		for i, ep := range eps {
+			go func(i int, ep Endpoint[I, O]) {
+				defer wg.Done()
+				results[i].value, panics[i], results[i].err = callRecover(ctx, ep, request)
+			}(i, ep)
+		}
+		wg.Wait()
+
+		for _, p := range panics {
+			if p != nil {
+				panic(p)
+			}
+		}
+		return results, nil
+	}
+}
+
+// Successes returns the values of the successful results, in order, when at
+// least min calls succeeded, and a *ParallelError otherwise. With min set to
+// len(results), any failure fails; with 1, partial results are accepted.
+func Successes[O any](results []Result[O], min int) ([]O, error) {
+	values := make([]O, 0, len(results))
+	errs := make([]error, len(results))
+	for i, r := range results {
+		if r.err != nil {
+			errs[i] = r.err
+			continue
+		}
+		values = append(values, r.value)
+	}
+
+	if len(values) < min {
+		return nil, &ParallelError{Errors: errs}
+	}
+	return values, nil
+}
+
+// All returns an Endpoint calling every endpoint of eps concurrently with
+// its request, and returning their responses, in the order of eps. It fails
+// fast: the first error cancels the context of the other calls, and fails
+// with a *ParallelError. A panic of an endpoint cancels the other calls too,
+// and is raised again once they returned.
+func All[I, O any](eps ...Endpoint[I, O]) Endpoint[I, []O] {
+	return func(ctx context.Context, request I) ([]O, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		values := make([]O, len(eps))
+		errs := make([]error, len(eps))
+
+		var (
+			wg       sync.WaitGroup
+			once     sync.Once
+			failed   bool
+			panicked interface{}
+		)
+		wg.Add(len(eps))
+		for i, ep := range eps {
+			go func(i int, ep Endpoint[I, O]) {
+				defer wg.Done()
+
+				value, p, err := callRecover(ctx, ep, request)
+				if p != nil {
+					once.Do(func() {
+						panicked = p
+						cancel()
+					})
+					return
+				}
+				if err != nil {
+					once.Do(func() {
+						errs[i] = err
+						failed = true
+						cancel()
+					})
+					return
+				}
+				values[i] = value
+			}(i, ep)
+		}
+		wg.Wait()
+
+		if panicked != nil {
+			panic(panicked)
+		}
+		if failed {
+			return nil, &ParallelError{Errors: errs}
+		}
+		return values, nil
+	}
+}
+
+// Race returns an Endpoint calling every endpoint of eps concurrently with
+// its request, such as replicas of a service, and returning the first
+// successful response, cancelling the context of the other calls. It fails
+// with a *ParallelError when every call failed. A panic of an endpoint ends
+// the race, and is raised again. It panics when eps is empty.
+func Race[I, O any](eps ...Endpoint[I, O]) Endpoint[I, O] {
+	if len(eps) == 0 {
+		panic("api: Race without endpoints")
+	}
+
+	type outcome struct {
+		i        int
+		value    O
+		err      error
+		panicked interface{}
+	}
+
+	return func(ctx context.Context, request I) (O, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// buffered so the losers don't block once the race is over
+		outcomes := make(chan outcome, len(eps))
+		for i, ep := range eps {
+			go func(i int, ep Endpoint[I, O]) {
+				value, p, err := callRecover(ctx, ep, request)
+				outcomes <- outcome{i: i, value: value, err: err, panicked: p}
+			}(i, ep)
+		}
+
+		errs := make([]error, len(eps))
+		for range eps {
+			o := <-outcomes
+			if o.panicked != nil {
+				panic(o.panicked)
+			}
+			if o.err == nil {
+				return o.value, nil
+			}
+			errs[o.i] = o.err
+		}
+
+		var empty O
+		return empty, &ParallelError{Errors: errs}
+	}
+}
+
+// Join2 returns an Endpoint calling a and b concurrently with its request,
+// and merging their responses, of different types, with merge, such as a
+// gateway endpoint composing a user and their orders from two services. It
+// fails fast, like All.
+func Join2[I, A, B, O any](a Endpoint[I, A], b Endpoint[I, B], merge func(ctx context.Context, a A, b B) (O, error)) Endpoint[I, O] {
+	return func(ctx context.Context, request I) (O, error) {
+		var (
+			ra A
+			rb B
+		)
+		err := join(ctx,
+			func(ctx context.Context) (err error) { ra, err = a(ctx, request); return },
+			func(ctx context.Context) (err error) { rb, err = b(ctx, request); return },
+		)
+		if err != nil {
+			var empty O
+			return empty, err
+		}
+
+		return merge(ctx, ra, rb)
+	}
+}
+
+// Join3 is Join2 with three endpoints.
+func Join3[I, A, B, C, O any](a Endpoint[I, A], b Endpoint[I, B], c Endpoint[I, C], merge func(ctx context.Context, a A, b B, c C) (O, error)) Endpoint[I, O] {
+	return func(ctx context.Context, request I) (O, error) {
+		var (
+			ra A
+			rb B
+			rc C
+		)
+		err := join(ctx,
+			func(ctx context.Context) (err error) { ra, err = a(ctx, request); return },
+			func(ctx context.Context) (err error) { rb, err = b(ctx, request); return },
+			func(ctx context.Context) (err error) { rc, err = c(ctx, request); return },
+		)
+		if err != nil {
+			var empty O
+			return empty, err
+		}
+
+		return merge(ctx, ra, rb, rc)
+	}
+}
+
+// join runs calls concurrently, cancelling the others at the first error.
+func join(ctx context.Context, calls ...func(ctx context.Context) error) error {
+	eps := make([]Endpoint[struct{}, struct{}], len(calls))
+	for i, call := range calls {
+		call := call
+		eps[i] = func(ctx context.Context, _ struct{}) (struct{}, error) {
+			return struct{}{}, call(ctx)
+		}
+	}
+
+	_, err := All(eps...)(ctx, struct{}{})
+	return err
+}
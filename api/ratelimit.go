@@ -0,0 +1,238 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/likearthian/apikit/internal/storeutil"
+)
+
+// RateLimitAlgorithm selects how a RateLimitStore counts requests.
+type RateLimitAlgorithm int
+
+const (
+	// TokenBucketAlgorithm refills Burst tokens at a constant rate of Rate per
+	// Period, allowing short bursts above the average rate.
+	TokenBucketAlgorithm RateLimitAlgorithm = iota
+
+	// SlidingWindowAlgorithm allows at most Rate requests in any window of
+	// Period, approximated from the counts of the current and previous fixed
+	// windows.
+	SlidingWindowAlgorithm
+)
+
+// Limit describes a rate limit.
+type Limit struct {
+	Algorithm RateLimitAlgorithm
+	Rate      int
+	Period    time.Duration
+
+	// Burst is the size of the token bucket. A burst lower than 1 defaults
+	// to Rate.
+	Burst int
+}
+
+// BurstSize returns the size of the token bucket of the limit: Burst, or
+// Rate when Burst is lower than 1.
+func (l Limit) BurstSize() int {
+	if l.Burst < 1 {
+		return l.Rate
+	}
+	return l.Burst
+}
+
+// Validate reports an error when the rate or the period of the limit is not
+// positive.
+func (l Limit) Validate() error {
+	if l.Rate <= 0 || l.Period <= 0 {
+		return fmt.Errorf("invalid rate limit %d per %s", l.Rate, l.Period)
+	}
+	return nil
+}
+
+// TokenBucket returns a token-bucket Limit of rate requests per period with
+// the given burst size. A burst lower than 1 defaults to rate.
+func TokenBucket(rate int, period time.Duration, burst int) Limit {
+	if burst < 1 {
+		burst = rate
+	}
+	return Limit{Algorithm: TokenBucketAlgorithm, Rate: rate, Period: period, Burst: burst}
+}
+
+// SlidingWindow returns a sliding-window Limit of rate requests per window.
+func SlidingWindow(rate int, window time.Duration) Limit {
+	return Limit{Algorithm: SlidingWindowAlgorithm, Rate: rate, Period: window}
+}
+
+// RateLimitResult is the outcome of a RateLimitStore.Allow call.
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// RateLimitStore records requests for a key and decides whether a new one is
+// allowed under limit. Implementations must be safe for concurrent use.
+type RateLimitStore interface {
+	Allow(ctx context.Context, key string, limit Limit) (RateLimitResult, error)
+}
+
+// KeyFunc extracts the rate limiting key (API key, user id, client IP...) from
+// the request context.
+type KeyFunc func(ctx context.Context) string
+
+// RateLimitError is returned by RateLimitMiddleware when a request is
+// rejected. It wraps ErrTooManyRequests, reports a 429 status code and carries
+// a Retry-After header.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s: retry after %s", ErrTooManyRequests, e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrTooManyRequests
+}
+
+func (e *RateLimitError) StatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+func (e *RateLimitError) Headers() http.Header {
+	seconds := int(math.Ceil(e.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return http.Header{"Retry-After": []string{strconv.Itoa(seconds)}}
+}
+
+// RateLimitMiddleware returns a Middleware rejecting requests with a
+// *RateLimitError once the key returned by keyFn exceeds limit in store.
+func RateLimitMiddleware[I, O any](store RateLimitStore, limit Limit, keyFn KeyFunc) Middleware[I, O] {
+	return func(next Endpoint[I, O]) Endpoint[I, O] {
+		return func(ctx context.Context, request I) (O, error) {
+			var empty O
+
+			res, err := store.Allow(ctx, keyFn(ctx), limit)
+			if err != nil {
+				return empty, err
+			}
+
+			if !res.Allowed {
+				return empty, &RateLimitError{RetryAfter: res.RetryAfter}
+			}
+
+			return next(ctx, request)
+		}
+	}
+}
+
+// MemoryRateLimitStore is an in-process RateLimitStore. Idle keys are evicted
+// periodically.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	entries map[string]*rateLimitEntry
+	now     func() time.Time
+	sweeper storeutil.Sweeper
+}
+
+type rateLimitEntry struct {
+	// token bucket state
+	tokens float64
+	last   time.Time
+
+	// sliding window state
+	windowStart time.Time
+	current     int
+	previous    int
+
+	expires time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty MemoryRateLimitStore.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		entries: make(map[string]*rateLimitEntry),
+		now:     time.Now,
+	}
+}
+
+// Allow implements RateLimitStore.
+func (s *MemoryRateLimitStore) Allow(_ context.Context, key string, limit Limit) (RateLimitResult, error) {
+	if err := limit.Validate(); err != nil {
+		return RateLimitResult{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &rateLimitEntry{tokens: float64(limit.BurstSize()), last: now, windowStart: now}
+		s.entries[key] = entry
+	}
+	entry.expires = now.Add(2 * limit.Period)
+
+	if limit.Algorithm == SlidingWindowAlgorithm {
+		return entry.slidingWindow(now, limit), nil
+	}
+
+	return entry.tokenBucket(now, limit), nil
+}
+
+func (e *rateLimitEntry) tokenBucket(now time.Time, limit Limit) RateLimitResult {
+	perToken := limit.Period / time.Duration(limit.Rate)
+	elapsed := now.Sub(e.last)
+	e.last = now
+	e.tokens = math.Min(float64(limit.BurstSize()), e.tokens+float64(elapsed)/float64(perToken))
+
+	if e.tokens < 1 {
+		missing := 1 - e.tokens
+		return RateLimitResult{RetryAfter: time.Duration(missing * float64(perToken))}
+	}
+
+	e.tokens--
+	return RateLimitResult{Allowed: true, Remaining: int(e.tokens)}
+}
+
+func (e *rateLimitEntry) slidingWindow(now time.Time, limit Limit) RateLimitResult {
+	elapsed := now.Sub(e.windowStart)
+	if elapsed >= limit.Period {
+		windows := elapsed / limit.Period
+		if windows == 1 {
+			e.previous = e.current
+		} else {
+			e.previous = 0
+		}
+		e.current = 0
+		e.windowStart = e.windowStart.Add(windows * limit.Period)
+		elapsed = now.Sub(e.windowStart)
+	}
+
+	weight := 1 - float64(elapsed)/float64(limit.Period)
+	count := float64(e.previous)*weight + float64(e.current)
+	if count+1 > float64(limit.Rate) {
+		return RateLimitResult{RetryAfter: limit.Period - elapsed}
+	}
+
+	e.current++
+	return RateLimitResult{Allowed: true, Remaining: limit.Rate - int(math.Ceil(count+1))}
+}
+
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if !s.sweeper.Due(now) {
+		return
+	}
+
+	storeutil.DeleteExpired(s.entries, now, func(entry *rateLimitEntry) time.Time { return entry.expires })
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// validEndpointName matches the names usable as metric label values and
+// OpenAPI operation ids: lower case words separated by dots, such as
+// "users.get" or "billing.invoice_export".
+var validEndpointName = regexp.MustCompile(`^[a-z][a-z0-9_]*(\.[a-z][a-z0-9_]*)*$`)
+
+// EndpointInfo is the identity of an endpoint, shared by the logging,
+// metrics and tracing middlewares and the OpenAPI operation of its route,
+// so they all report it under the same name.
+type EndpointInfo struct {
+	Name        string
+	Summary     string
+	Description string
+	Tags        []string
+	Metadata    map[string]string
+}
+
+// EndpointRegistry holds the endpoints of a service by canonical name.
+type EndpointRegistry struct {
+	mu        sync.RWMutex
+	endpoints map[string]EndpointInfo
+}
+
+// NewEndpointRegistry creates an empty EndpointRegistry.
+func NewEndpointRegistry() *EndpointRegistry {
+	return &EndpointRegistry{endpoints: make(map[string]EndpointInfo)}
+}
+
+// DefaultEndpointRegistry is the registry of RegisterEndpoint.
+var DefaultEndpointRegistry = NewEndpointRegistry()
+
+// RegisterEndpoint registers info in DefaultEndpointRegistry.
+func RegisterEndpoint(info EndpointInfo) (EndpointInfo, error) {
+	return DefaultEndpointRegistry.Register(info)
+}
+
+// MustRegisterEndpoint registers info in DefaultEndpointRegistry, panicking
+// when it can't be, so endpoints can be declared as package variables.
+func MustRegisterEndpoint(info EndpointInfo) EndpointInfo {
+	info, err := DefaultEndpointRegistry.Register(info)
+	if err != nil {
+		panic(err)
+	}
+	return info
+}
+
+// LookupEndpoint returns the endpoint called name in DefaultEndpointRegistry.
+func LookupEndpoint(name string) (EndpointInfo, bool) {
+	return DefaultEndpointRegistry.Lookup(name)
+}
+
+// Register adds info to r. Its name must be made of lower case words
+// separated by dots, and not be registered yet.
+func (r *EndpointRegistry) Register(info EndpointInfo) (EndpointInfo, error) {
+	if !validEndpointName.MatchString(info.Name) {
+		return info, fmt.Errorf("invalid endpoint name %q", info.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.endpoints[info.Name]; ok {
+		return info, fmt.Errorf("endpoint %q already registered", info.Name)
+	}
+	r.endpoints[info.Name] = info
+
+	return info, nil
+}
+
+// Lookup returns the endpoint called name.
+func (r *EndpointRegistry) Lookup(name string) (EndpointInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	info, ok := r.endpoints[name]
+	return info, ok
+}
+
+// Endpoints returns the registered endpoints, sorted by name.
+func (r *EndpointRegistry) Endpoints() []EndpointInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	endpoints := make([]EndpointInfo, 0, len(r.endpoints))
+	for _, info := range r.endpoints {
+		endpoints = append(endpoints, info)
+	}
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].Name < endpoints[j].Name })
+
+	return endpoints
+}
+
+// EndpointFromContext returns the endpoint stored by EndpointMiddleware.
+func EndpointFromContext(ctx context.Context) (EndpointInfo, bool) {
+	info, ok := ctx.Value(ContextKeyEndpoint).(EndpointInfo)
+	return info, ok
+}
+
+// EndpointNameFromContext returns the name of the endpoint stored by
+// EndpointMiddleware, or fallback when there is none.
+func EndpointNameFromContext(ctx context.Context, fallback string) string {
+	if info, ok := EndpointFromContext(ctx); ok {
+		return info.Name
+	}
+	return fallback
+}
+
+// EndpointMiddleware returns a Middleware storing info in the context, so
+// the middlewares it wraps, given an empty endpoint name, report the
+// endpoint under info.Name. It must be the outermost middleware.
+func EndpointMiddleware[I, O any](info EndpointInfo) Middleware[I, O] {
+	return func(next Endpoint[I, O]) Endpoint[I, O] {
+		return func(ctx context.Context, request I) (O, error) {
+			return next(context.WithValue(ctx, ContextKeyEndpoint, info), request)
+		}
+	}
+}
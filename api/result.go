@@ -1,6 +1,22 @@
 package api
 
+// Result is the outcome of a call: its value, or the error failing it.
 type Result[T any] struct {
 	err   error
 	value T
 }
+
+// Value returns the value of a successful call.
+func (r Result[T]) Value() T {
+	return r.value
+}
+
+// Err returns the error of a failed call.
+func (r Result[T]) Err() error {
+	return r.err
+}
+
+// Ok reports whether the call succeeded.
+func (r Result[T]) Ok() bool {
+	return r.err == nil
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+type retryContextKey struct{}
+
+// BackoffStrategy returns how long to wait before the given retry attempt.
+// attempt starts at 1 for the first retry.
+type BackoffStrategy func(attempt int) time.Duration
+
+// ConstantBackoff waits d between attempts.
+func ConstantBackoff(d time.Duration) BackoffStrategy {
+	return func(int) time.Duration { return d }
+}
+
+// ExponentialBackoff doubles the wait after every attempt, starting at base
+// and capped at max.
+func ExponentialBackoff(base, max time.Duration) BackoffStrategy {
+	return func(attempt int) time.Duration {
+		return exponential(base, max, attempt)
+	}
+}
+
+// JitteredBackoff is an ExponentialBackoff where each wait is picked randomly
+// between zero and the exponential value ("full jitter"), which spreads
+// retries of concurrent callers.
+func JitteredBackoff(base, max time.Duration) BackoffStrategy {
+	return func(attempt int) time.Duration {
+		d := exponential(base, max, attempt)
+		if d <= 0 {
+			return 0
+		}
+		return time.Duration(rand.Int63n(int64(d) + 1))
+	}
+}
+
+func exponential(base, max time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d > max || d <= 0 {
+			return max
+		}
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+// Idempotenter may be implemented by request types to tell RetryMiddleware
+// whether replaying them is safe. Requests reporting false are never retried.
+type Idempotenter interface {
+	Idempotent() bool
+}
+
+// IsRetryable is the default retry predicate. It refuses to retry context
+// cancellation, bad requests and open circuits, which won't succeed by trying
+// again.
+func IsRetryable(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, ErrBadRequest),
+		errors.Is(err, ErrCircuitOpen):
+		return false
+	}
+	return true
+}
+
+// RetryMiddleware returns a Middleware invoking the next endpoint up to
+// maxAttempts times while it fails with an error accepted by retryIf (or
+// IsRetryable when nil), waiting between attempts as dictated by backoff.
+// Waiting stops early when the context is done. The current attempt number is
+// available to the next endpoint through AttemptFromContext.
+func RetryMiddleware[I, O any](maxAttempts int, backoff BackoffStrategy, retryIf func(error) bool) Middleware[I, O] {
+	if retryIf == nil {
+		retryIf = IsRetryable
+	}
+
+	return func(next Endpoint[I, O]) Endpoint[I, O] {
+		return func(ctx context.Context, request I) (O, error) {
+			canRetry := true
+			if idem, ok := any(request).(Idempotenter); ok {
+				canRetry = idem.Idempotent()
+			}
+
+			var (
+				response O
+				err      error
+			)
+
+			for attempt := 1; ; attempt++ {
+				response, err = next(context.WithValue(ctx, retryContextKey{}, attempt), request)
+				if err == nil || !canRetry || attempt >= maxAttempts || !retryIf(err) {
+					return response, err
+				}
+
+				var wait time.Duration
+				if backoff != nil {
+					wait = backoff(attempt)
+				}
+
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return response, err
+				case <-timer.C:
+				}
+			}
+		}
+	}
+}
+
+// AttemptFromContext returns the attempt number set by RetryMiddleware,
+// starting at 1. It returns 0 when the endpoint is not wrapped by a retry
+// middleware.
+func AttemptFromContext(ctx context.Context) int {
+	attempt, _ := ctx.Value(retryContextKey{}).(int)
+	return attempt
+}
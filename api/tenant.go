@@ -0,0 +1,39 @@
+package api
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrTenantRequired denotes an authenticated request that could not be
+// attributed to a tenant.
+var ErrTenantRequired = errors.New("tenant required")
+
+// Tenant describes the tenant an authenticated caller belongs to, so
+// multi-tenant services can scope their queries.
+type Tenant struct {
+	ID   string
+	Name string
+	Data map[string]interface{}
+}
+
+// GetTenantFromContext returns the tenant stored under ContextKeyTenant.
+func GetTenantFromContext(ctx context.Context) (*Tenant, bool) {
+	tenant, ok := ctx.Value(ContextKeyTenant).(*Tenant)
+	return tenant, ok && tenant != nil
+}
+
+// RequireTenant returns a Middleware failing with ErrTenantRequired unless a
+// tenant is stored in the context.
+func RequireTenant[I, O any]() Middleware[I, O] {
+	return func(next Endpoint[I, O]) Endpoint[I, O] {
+		return func(ctx context.Context, request I) (O, error) {
+			if _, ok := GetTenantFromContext(ctx); !ok {
+				var empty O
+				return empty, ErrTenantRequired
+			}
+
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// TimeoutError is returned by TimeoutMiddleware when the endpoint doesn't
+// complete in time, and by the http transport Server with ServerTimeout when
+// a request exceeds its deadline. It wraps ErrTimeout and reports a 504
+// status code.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s after %s", ErrTimeout, e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return ErrTimeout
+}
+
+func (e *TimeoutError) StatusCode() int {
+	return http.StatusGatewayTimeout
+}
+
+// TimeoutMiddleware returns a Middleware calling the next endpoint with a
+// context whose deadline is d from now, and failing with a *TimeoutError
+// once it is exceeded, even when the endpoint ignores its context and keeps
+// running in the background. Errors of the endpoint returned before the
+// deadline, including the timeouts of downstream calls with shorter
+// deadlines, are returned as is, and so is the error of a context cancelled
+// by the caller.
+func TimeoutMiddleware[I, O any](d time.Duration) Middleware[I, O] {
+	type result struct {
+		response O
+		err      error
+		panicked interface{}
+	}
+
+	return func(next Endpoint[I, O]) Endpoint[I, O] {
+		return func(ctx context.Context, request I) (O, error) {
+			tctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+
+			done := make(chan result, 1)
+			go func() {
+				var res result
+				defer func() {
+					// panics are raised again by the caller, where they can
+					// be recovered
+					if p := recover(); p != nil {
+						res.panicked = p
+					}
+					done <- res
+				}()
+
+				res.response, res.err = next(tctx, request)
+			}()
+
+			var empty O
+			select {
+			case res := <-done:
+				if res.panicked != nil {
+					panic(res.panicked)
+				}
+				if res.err != nil && ctx.Err() == nil && tctx.Err() == context.DeadlineExceeded {
+					return res.response, &TimeoutError{Timeout: d}
+				}
+				return res.response, res.err
+
+			case <-tctx.Done():
+				if err := ctx.Err(); err != nil {
+					return empty, err
+				}
+				return empty, &TimeoutError{Timeout: d}
+			}
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/likearthian/apikit/internal/storeutil"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// TokenPair is a short lived access token issued together with the longer
+// lived refresh token used to obtain the next pair.
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	TokenType        string    `json:"token_type"`
+	ExpiresIn        int64     `json:"expires_in"`
+	AccessExpiresAt  time.Time `json:"access_expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// RefreshTokenStore keeps track of the refresh tokens issued by a
+// TokenIssuer so each of them can be exchanged only once. Tokens rotated from
+// the same login share a family. Implementations must be safe for concurrent
+// use.
+type RefreshTokenStore interface {
+	// Save records the refresh token id of family, valid until expiresAt.
+	Save(ctx context.Context, family, id string, expiresAt time.Time) error
+
+	// Consume marks the refresh token id as used. It returns
+	// ErrRefreshTokenReused when it already was, and ErrTokenRevoked when the
+	// token or its family is unknown or revoked.
+	Consume(ctx context.Context, family, id string) error
+
+	// RevokeFamily revokes every refresh token of family.
+	RevokeFamily(ctx context.Context, family string) error
+}
+
+type tokenIssuerOption struct {
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	issuer     string
+	audience   []string
+}
+
+// TokenIssuerOption sets an optional parameter for TokenIssuer.
+type TokenIssuerOption func(opt *tokenIssuerOption)
+
+// AccessTokenTTL sets how long access tokens are valid. Defaults to 15
+// minutes.
+func AccessTokenTTL(d time.Duration) TokenIssuerOption {
+	return func(opt *tokenIssuerOption) { opt.accessTTL = d }
+}
+
+// RefreshTokenTTL sets how long refresh tokens are valid. Defaults to 7 days.
+func RefreshTokenTTL(d time.Duration) TokenIssuerOption {
+	return func(opt *tokenIssuerOption) { opt.refreshTTL = d }
+}
+
+// TokenIssuerName sets the iss claim of the issued tokens.
+func TokenIssuerName(issuer string) TokenIssuerOption {
+	return func(opt *tokenIssuerOption) { opt.issuer = issuer }
+}
+
+// TokenAudience sets the aud claim of the issued tokens.
+func TokenAudience(audience ...string) TokenIssuerOption {
+	return func(opt *tokenIssuerOption) { opt.audience = audience }
+}
+
+// TokenIssuer issues access and refresh token pairs and rotates them. Every
+// refresh token can be exchanged once; presenting it again is taken as a sign
+// it leaked, and the whole family is revoked.
+type TokenIssuer struct {
+	secret []byte
+	store  RefreshTokenStore
+	opts   tokenIssuerOption
+}
+
+// NewTokenIssuer creates a TokenIssuer signing with secret and tracking
+// refresh tokens in store.
+func NewTokenIssuer(secret []byte, store RefreshTokenStore, options ...TokenIssuerOption) *TokenIssuer {
+	opts := tokenIssuerOption{
+		accessTTL:  15 * time.Minute,
+		refreshTTL: 7 * 24 * time.Hour,
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	return &TokenIssuer{secret: secret, store: store, opts: opts}
+}
+
+// Issue creates a new token pair for subject, starting a new refresh token
+// family.
+func (ti *TokenIssuer) Issue(ctx context.Context, subject string, data map[string]interface{}) (TokenPair, error) {
+	return ti.issue(ctx, newTokenID(), subject, data)
+}
+
+// Refresh exchanges refreshToken for a new pair of the same family. A refresh
+// token that was already exchanged revokes its family and fails with
+// ErrRefreshTokenReused.
+func (ti *TokenIssuer) Refresh(ctx context.Context, refreshToken string) (TokenPair, error) {
+	claims, err := ti.parseRefreshToken(refreshToken)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	if err := ti.store.Consume(ctx, claims.Family, claims.ID); err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			if rerr := ti.store.RevokeFamily(ctx, claims.Family); rerr != nil {
+				return TokenPair{}, rerr
+			}
+		}
+		return TokenPair{}, err
+	}
+
+	return ti.issue(ctx, claims.Family, claims.Subject, claims.Data)
+}
+
+// Revoke revokes the family of refreshToken, typically on logout.
+func (ti *TokenIssuer) Revoke(ctx context.Context, refreshToken string) error {
+	claims, err := ti.parseRefreshToken(refreshToken)
+	if err != nil {
+		return err
+	}
+
+	return ti.store.RevokeFamily(ctx, claims.Family)
+}
+
+// parseRefreshToken verifies refreshToken, and that it is a refresh token
+// issued with the issuer name and audience of ti.
+func (ti *TokenIssuer) parseRefreshToken(refreshToken string) (*TokenClaims, error) {
+	claims, err := ParseToken(refreshToken, ti.secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Type != TokenTypeRefresh || claims.Family == "" {
+		return nil, ErrTokenInvalid
+	}
+
+	if err := claims.verifyIssuerAudience(ti.opts.issuer, ti.opts.audience); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (ti *TokenIssuer) issue(ctx context.Context, family, subject string, data map[string]interface{}) (TokenPair, error) {
+	now := time.Now()
+	accessExp := now.Add(ti.opts.accessTTL)
+	refreshExp := now.Add(ti.opts.refreshTTL)
+
+	access, err := signToken(ti.claims(TokenTypeAccess, "", subject, data, now, accessExp), ti.secret)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refreshClaims := ti.claims(TokenTypeRefresh, family, subject, data, now, refreshExp)
+	refresh, err := signToken(refreshClaims, ti.secret)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	if err := ti.store.Save(ctx, family, refreshClaims.ID, refreshExp); err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:      access,
+		RefreshToken:     refresh,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(ti.opts.accessTTL.Seconds()),
+		AccessExpiresAt:  accessExp,
+		RefreshExpiresAt: refreshExp,
+	}, nil
+}
+
+func (ti *TokenIssuer) claims(typ, family, subject string, data map[string]interface{}, now, exp time.Time) TokenClaims {
+	return TokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        newTokenID(),
+			Issuer:    ti.opts.issuer,
+			Subject:   subject,
+			Audience:  ti.opts.audience,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(exp),
+		},
+		Type:   typ,
+		Family: family,
+		Data:   data,
+	}
+}
+
+// RefreshTokenRequest is the request of the endpoint made by
+// MakeRefreshTokenEndpoint.
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// MakeRefreshTokenEndpoint returns an Endpoint exchanging a refresh token for
+// a new TokenPair.
+func MakeRefreshTokenEndpoint(issuer *TokenIssuer) Endpoint[RefreshTokenRequest, TokenPair] {
+	return func(ctx context.Context, request RefreshTokenRequest) (TokenPair, error) {
+		return issuer.Refresh(ctx, request.RefreshToken)
+	}
+}
+
+// MemoryRefreshTokenStore is an in-process RefreshTokenStore. Expired
+// families are evicted periodically.
+type MemoryRefreshTokenStore struct {
+	mu       sync.Mutex
+	families map[string]*refreshTokenFamily
+	now      func() time.Time
+	sweeper  storeutil.Sweeper
+}
+
+type refreshTokenFamily struct {
+	revoked bool
+	tokens  map[string]bool
+	expires time.Time
+}
+
+// NewMemoryRefreshTokenStore creates an empty MemoryRefreshTokenStore.
+func NewMemoryRefreshTokenStore() *MemoryRefreshTokenStore {
+	return &MemoryRefreshTokenStore{
+		families: make(map[string]*refreshTokenFamily),
+		now:      time.Now,
+	}
+}
+
+// Save implements RefreshTokenStore.
+func (s *MemoryRefreshTokenStore) Save(_ context.Context, family, id string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(s.now())
+
+	fam, ok := s.families[family]
+	if !ok {
+		fam = &refreshTokenFamily{tokens: make(map[string]bool)}
+		s.families[family] = fam
+	}
+
+	fam.tokens[id] = false
+	if expiresAt.After(fam.expires) {
+		fam.expires = expiresAt
+	}
+
+	return nil
+}
+
+// Consume implements RefreshTokenStore.
+func (s *MemoryRefreshTokenStore) Consume(_ context.Context, family, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fam, ok := s.families[family]
+	if !ok || fam.revoked {
+		return ErrTokenRevoked
+	}
+
+	used, ok := fam.tokens[id]
+	if !ok {
+		return ErrTokenRevoked
+	}
+
+	if used {
+		return ErrRefreshTokenReused
+	}
+
+	fam.tokens[id] = true
+	return nil
+}
+
+// RevokeFamily implements RefreshTokenStore.
+func (s *MemoryRefreshTokenStore) RevokeFamily(_ context.Context, family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if fam, ok := s.families[family]; ok {
+		fam.revoked = true
+	}
+
+	return nil
+}
+
+func (s *MemoryRefreshTokenStore) sweep(now time.Time) {
+	if !s.sweeper.Due(now) {
+		return
+	}
+
+	storeutil.DeleteExpired(s.families, now, func(fam *refreshTokenFamily) time.Time { return fam.expires })
+}
@@ -0,0 +1,181 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/likearthian/apikit/internal/storeutil"
+)
+
+const (
+	totpPeriod = 30 * time.Second
+	totpDigits = 6
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a new random TOTP secret, base32 encoded as
+// expected by authenticator apps.
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPURL returns the otpauth:// URL enrolling secret in an authenticator
+// app, usually shown as a QR code, labelled with issuer and account.
+func TOTPURL(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(int(totpPeriod/time.Second)))
+
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// TOTPCode returns the RFC 6238 code of secret at t: 6 digits, renewed every
+// 30 seconds, with HMAC-SHA1, the parameters every authenticator app
+// supports.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, uint64(t.Unix())/uint64(totpPeriod/time.Second)), nil
+}
+
+// VerifyTOTP reports whether code is the TOTP code of secret at t, or at one
+// of the skew periods before or after it, tolerating clock drift.
+func VerifyTOTP(secret, code string, t time.Time, skew int) bool {
+	_, ok := matchTOTP(secret, code, t, skew)
+	return ok
+}
+
+// matchTOTP returns the counter of the period whose code is code, as checked
+// by VerifyTOTP.
+func matchTOTP(secret, code string, t time.Time, skew int) (int64, bool) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	counter := totpCounter(t)
+	for i := -skew; i <= skew; i++ {
+		if counter+int64(i) < 0 {
+			continue
+		}
+		expected := totpCode(key, uint64(counter+int64(i)))
+		if subtle.ConstantTimeCompare([]byte(code), []byte(expected)) == 1 {
+			return counter + int64(i), true
+		}
+	}
+	return 0, false
+}
+
+func totpCounter(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod/time.Second)
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return totpEncoding.DecodeString(strings.TrimRight(secret, "="))
+}
+
+// totpCode is the HOTP of RFC 4226.
+func totpCode(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// NewTOTPSecondFactor returns a SecondFactor checking TOTP codes against the
+// secret of each user, returned by secret, which returns an empty secret for
+// the users not enrolled. Codes of the previous and next periods are
+// accepted too, but each code only once: a code of the period of the last
+// code accepted for the user, or of an earlier one, is rejected, so a code
+// seen by an eavesdropper can't be replayed. The accepted codes are tracked in
+// process.
+func NewTOTPSecondFactor(secret func(ctx context.Context, id Identity) (string, error)) SecondFactor {
+	return &totpSecondFactor{
+		secret: secret,
+		last:   make(map[string]int64),
+		now:    time.Now,
+	}
+}
+
+type totpSecondFactor struct {
+	secret func(ctx context.Context, id Identity) (string, error)
+
+	mu      sync.Mutex
+	last    map[string]int64
+	now     func() time.Time
+	sweeper storeutil.Sweeper
+}
+
+func (f *totpSecondFactor) Required(ctx context.Context, id Identity) (bool, error) {
+	secret, err := f.secret(ctx, id)
+	return secret != "", err
+}
+
+func (f *totpSecondFactor) Verify(ctx context.Context, id Identity, code string) error {
+	secret, err := f.secret(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if secret == "" {
+		return ErrInvalidSecondFactor
+	}
+
+	now := f.now()
+	counter, ok := matchTOTP(secret, code, now, 1)
+	if !ok {
+		return ErrInvalidSecondFactor
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sweep(now)
+	if last, ok := f.last[id.Subject]; ok && counter <= last {
+		return ErrInvalidSecondFactor
+	}
+	f.last[id.Subject] = counter
+	return nil
+}
+
+// sweep forgets the counters too old for their codes to be accepted anyway.
+func (f *totpSecondFactor) sweep(now time.Time) {
+	if !f.sweeper.Due(now) {
+		return
+	}
+
+	oldest := totpCounter(now) - 1
+	for subject, last := range f.last {
+		if last < oldest {
+			delete(f.last, subject)
+		}
+	}
+}
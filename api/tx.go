@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+)
+
+// BeginTxer begins database transactions, such as *sql.DB and *sql.Conn.
+type BeginTxer interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// Querier runs queries, such as *sql.DB and *sql.Tx, so repositories can
+// work inside and outside transactions alike.
+type Querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type txOption struct {
+	isolation    sql.IsolationLevel
+	readOnly     bool
+	manualCommit bool
+}
+
+// TxOption sets an optional parameter for TxMiddleware.
+type TxOption func(opt *txOption)
+
+// TxIsolation sets the isolation level of the transactions. Defaults to the
+// default level of the driver.
+func TxIsolation(level sql.IsolationLevel) TxOption {
+	return func(opt *txOption) { opt.isolation = level }
+}
+
+// TxReadOnly makes the transactions read-only, for the endpoints which only
+// need a consistent view of the database.
+func TxReadOnly() TxOption {
+	return func(opt *txOption) { opt.readOnly = true }
+}
+
+// TxManualCommit leaves committing the transactions to the endpoints, which
+// end them themselves. The transactions the endpoints haven't ended when they
+// return are rolled back.
+func TxManualCommit() TxOption {
+	return func(opt *txOption) { opt.manualCommit = true }
+}
+
+// TxMiddleware returns a Middleware running every call in a transaction
+// begun with db, stored in the context for TxFromContext and
+// QuerierFromContext. The transaction is committed when the call succeeds,
+// and rolled back when it fails, returns a response whose Failed method
+// reports an error, or panics, in which case the panic goes on. Calls whose
+// context already carries a transaction, such as endpoints called by other
+// transactional endpoints, join it instead of beginning another.
+func TxMiddleware[I, O any](db BeginTxer, options ...TxOption) Middleware[I, O] {
+	var opts txOption
+	for _, option := range options {
+		option(&opts)
+	}
+	txOpts := &sql.TxOptions{Isolation: opts.isolation, ReadOnly: opts.readOnly}
+
+	return func(next Endpoint[I, O]) Endpoint[I, O] {
+		return func(ctx context.Context, request I) (response O, err error) {
+			if _, ok := TxFromContext(ctx); ok {
+				return next(ctx, request)
+			}
+
+			tx, err := db.BeginTx(ctx, txOpts)
+			if err != nil {
+				return response, err
+			}
+
+			committed := false
+			defer func() {
+				if !committed {
+					// the error of the call, or the panic, matters more
+					_ = tx.Rollback()
+				}
+			}()
+
+			response, err = next(context.WithValue(ctx, ContextKeyTx, tx), request)
+			if err != nil {
+				return response, err
+			}
+			if f, ok := any(response).(Failer); ok && f.Failed() != nil {
+				return response, nil
+			}
+			if opts.manualCommit {
+				return response, nil
+			}
+
+			if err := tx.Commit(); err != nil {
+				return response, err
+			}
+			committed = true
+			return response, nil
+		}
+	}
+}
+
+// TxFromContext returns the transaction begun by TxMiddleware.
+func TxFromContext(ctx context.Context) (*sql.Tx, bool) {
+	tx, ok := ctx.Value(ContextKeyTx).(*sql.Tx)
+	return tx, ok
+}
+
+// QuerierFromContext returns the transaction begun by TxMiddleware, or db
+// outside of transactions.
+func QuerierFromContext(ctx context.Context, db Querier) Querier {
+	if tx, ok := TxFromContext(ctx); ok {
+		return tx
+	}
+	return db
+}
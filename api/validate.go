@@ -0,0 +1,226 @@
+package api
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidateTag is the struct tag read by ValidateStruct.
+const ValidateTag = "validate"
+
+// ValidateStruct checks the constraints declared in the `validate` tag of each
+// field of the struct pointed by v, e.g.
+//
+//	Page int    `query:"page" validate:"required,min=1"`
+//	Sort string `query:"sort" validate:"omitempty,oneof=asc desc"`
+//
+// Supported rules are required, omitempty, min, max, len, oneof and email. min,
+// max and len compare the value of numbers and the length of strings, slices
+// and maps. Nested structs are validated recursively. Every failing field is
+// collected into a single *ValidationError; fields are named after the first
+// non-empty tag of nameTags (e.g. "query", "json"), falling back to the Go
+// field name.
+func ValidateStruct(v interface{}, nameTags ...string) error {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+
+	if val.Kind() != reflect.Struct {
+		return nil
+	}
+
+	verr := &ValidationError{}
+	if err := validateStructValue(val, "", nameTags, verr); err != nil {
+		return err
+	}
+
+	if verr.HasErrors() {
+		return verr
+	}
+
+	return nil
+}
+
+func validateStructValue(val reflect.Value, prefix string, nameTags []string, verr *ValidationError) error {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		typeField := typ.Field(i)
+		if !typeField.IsExported() {
+			continue
+		}
+
+		field := val.Field(i)
+		name := prefix + fieldName(typeField, nameTags)
+
+		rules := typeField.Tag.Get(ValidateTag)
+		if rules == "-" {
+			continue
+		}
+
+		if rules != "" {
+			if err := validateField(field, name, rules, verr); err != nil {
+				return err
+			}
+		}
+
+		inner := field
+		for inner.Kind() == reflect.Ptr && !inner.IsNil() {
+			inner = inner.Elem()
+		}
+
+		if inner.Kind() == reflect.Struct && inner.Type() != reflect.TypeOf(time.Time{}) {
+			nested := name + "."
+			if typeField.Anonymous {
+				nested = prefix
+			}
+			if err := validateStructValue(inner, nested, nameTags, verr); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateField(field reflect.Value, name string, rules string, verr *ValidationError) error {
+	for field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			if hasRule(rules, "required") {
+				verr.AddCode(name, "required", "is required")
+			}
+			return nil
+		}
+		field = field.Elem()
+	}
+
+	isZero := field.IsZero()
+	for _, rule := range strings.Split(rules, ",") {
+		key, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch key {
+		case "":
+			continue
+		case "omitempty":
+			if isZero {
+				return nil
+			}
+		case "required":
+			if isZero {
+				verr.AddCode(name, "required", "is required")
+				return nil
+			}
+		case "min", "max", "len":
+			limit, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s rule parameter %q on field %s", key, param, name)
+			}
+			if msg, ok := checkBound(field, key, limit); !ok {
+				verr.AddCode(name, key, msg)
+			}
+		case "oneof":
+			options := strings.Fields(param)
+			str := fmt.Sprintf("%v", field.Interface())
+			if !contains(options, str) {
+				verr.AddCode(name, key, fmt.Sprintf("must be one of [%s]", strings.Join(options, " ")))
+			}
+		case "email":
+			if field.Kind() != reflect.String {
+				return fmt.Errorf("email rule requires a string field, got %s on field %s", field.Kind(), name)
+			}
+			if _, err := mail.ParseAddress(field.String()); err != nil {
+				verr.AddCode(name, key, "must be a valid email address")
+			}
+		default:
+			return fmt.Errorf("unknown validation rule %q on field %s", key, name)
+		}
+	}
+
+	return nil
+}
+
+func checkBound(field reflect.Value, rule string, limit float64) (string, bool) {
+	var (
+		size   float64
+		suffix string
+	)
+
+	switch field.Kind() {
+	case reflect.String:
+		size, suffix = float64(len([]rune(field.String()))), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		size, suffix = float64(field.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(field.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(field.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = field.Float()
+	default:
+		return fmt.Sprintf("%s rule is not supported on %s", rule, field.Kind()), false
+	}
+
+	limitStr := strconv.FormatFloat(limit, 'f', -1, 64)
+	switch rule {
+	case "min":
+		if size < limit {
+			if suffix != "" {
+				return "must have at least " + limitStr + suffix, false
+			}
+			return "must be at least " + limitStr, false
+		}
+	case "max":
+		if size > limit {
+			if suffix != "" {
+				return "must have at most " + limitStr + suffix, false
+			}
+			return "must be at most " + limitStr, false
+		}
+	case "len":
+		if size != limit {
+			if suffix != "" {
+				return "must have exactly " + limitStr + suffix, false
+			}
+			return "must be equal to " + limitStr, false
+		}
+	}
+
+	return "", true
+}
+
+func fieldName(field reflect.StructField, nameTags []string) string {
+	for _, tag := range nameTags {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return field.Name
+}
+
+func hasRule(rules string, rule string) bool {
+	for _, r := range strings.Split(rules, ",") {
+		if strings.TrimSpace(r) == rule {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+
+	return false
+}
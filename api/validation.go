@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Validator may be implemented by request types that need to check their own
+// consistency once they have been decoded. The http decoders call Validate
+// automatically after binding, and ValidationMiddleware does the same at the
+// endpoint level.
+type Validator interface {
+	Validate(ctx context.Context) error
+}
+
+// FieldError describes a validation failure on a single request field. Code
+// identifies the failed rule, such as "required" or "max", so clients can
+// react to it without parsing Message.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationError aggregates the field errors found while validating a
+// request. It wraps ErrBadRequest and reports a 400 status code.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// NewValidationError returns a ValidationError made of the given field errors.
+func NewValidationError(fields ...FieldError) *ValidationError {
+	return &ValidationError{Fields: fields}
+}
+
+// Add appends a field error.
+func (e *ValidationError) Add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+// AddCode appends a field error with the given code.
+func (e *ValidationError) AddCode(field, code, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+// HasErrors reports whether any field error has been recorded.
+func (e *ValidationError) HasErrors() bool {
+	return len(e.Fields) > 0
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = fmt.Sprintf("%s: %s", f.Field, f.Message)
+	}
+
+	return fmt.Sprintf("%s: %s", ErrBadRequest, strings.Join(msgs, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrBadRequest
+}
+
+func (e *ValidationError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// MarshalJSON renders the error as an object holding a field map and the list
+// of field errors, which lets the http DefaultErrorEncoder emit it as JSON.
+func (e *ValidationError) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]string, len(e.Fields))
+	for _, f := range e.Fields {
+		if prev, ok := fields[f.Field]; ok {
+			fields[f.Field] = prev + "; " + f.Message
+			continue
+		}
+		fields[f.Field] = f.Message
+	}
+
+	return json.Marshal(struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+		Errors []FieldError      `json:"errors"`
+	}{
+		Error:  ErrBadRequest.Error(),
+		Fields: fields,
+		Errors: e.Fields,
+	})
+}
+
+// Validate calls v.Validate when v implements Validator. The returned error
+// always wraps ErrBadRequest.
+func Validate(ctx context.Context, v interface{}) error {
+	validator, ok := v.(Validator)
+	if !ok {
+		return nil
+	}
+
+	err := validator.Validate(ctx)
+	if err == nil || errors.Is(err, ErrBadRequest) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %s", ErrBadRequest, err)
+}
+
+// ValidationMiddleware returns a Middleware that validates requests
+// implementing Validator before invoking the next endpoint.
+func ValidationMiddleware[I, O any]() Middleware[I, O] {
+	return func(next Endpoint[I, O]) Endpoint[I, O] {
+		return func(ctx context.Context, request I) (O, error) {
+			var target interface{} = &request
+			if _, ok := any(request).(Validator); ok {
+				target = request
+			}
+
+			if err := Validate(ctx, target); err != nil {
+				var empty O
+				return empty, err
+			}
+
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// Code is a stable, machine readable identifier of an error kind, which
+// clients can switch on rather than parsing messages.
+type Code string
+
+const (
+	CodeBadRequest      Code = "bad_request"
+	CodeUnauthorized    Code = "unauthorized"
+	CodeForbidden       Code = "forbidden"
+	CodeNotFound        Code = "not_found"
+	CodeConflict        Code = "conflict"
+	CodeTooLarge        Code = "payload_too_large"
+	CodeUnprocessable   Code = "unprocessable_entity"
+	CodeTooManyRequests Code = "too_many_requests"
+	CodeInternal        Code = "internal"
+	CodeUnavailable     Code = "unavailable"
+	CodeTimeout         Code = "timeout"
+)
+
+type kind struct {
+	status   int
+	sentinel error
+}
+
+// kinds maps codes to their HTTP status and to the api sentinel errors
+// matching them, so errors.Is(NotFound(...), api.ErrNotFound) holds.
+var kinds = map[Code]kind{
+	CodeBadRequest:      {http.StatusBadRequest, api.ErrBadRequest},
+	CodeUnauthorized:    {http.StatusUnauthorized, api.ErrUnauthorized},
+	CodeForbidden:       {http.StatusForbidden, api.ErrForbidden},
+	CodeNotFound:        {http.StatusNotFound, api.ErrNotFound},
+	CodeConflict:        {http.StatusConflict, api.ErrConflict},
+	CodeTooLarge:        {http.StatusRequestEntityTooLarge, api.ErrRequestTooLarge},
+	CodeUnprocessable:   {http.StatusUnprocessableEntity, nil},
+	CodeTooManyRequests: {http.StatusTooManyRequests, api.ErrTooManyRequests},
+	CodeInternal:        {http.StatusInternalServerError, nil},
+	CodeUnavailable:     {http.StatusServiceUnavailable, api.ErrUnavailable},
+	CodeTimeout:         {http.StatusGatewayTimeout, api.ErrTimeout},
+}
+
+// codes lists the codes in the order From looks for their sentinel errors.
+var codes = []Code{
+	CodeBadRequest,
+	CodeUnauthorized,
+	CodeForbidden,
+	CodeNotFound,
+	CodeConflict,
+	CodeTooLarge,
+	CodeUnprocessable,
+	CodeTooManyRequests,
+	CodeInternal,
+	CodeUnavailable,
+	CodeTimeout,
+}
+
+// Error is an error carrying everything needed to report it to a client: a
+// Code, the HTTP status, a message safe to show, and optional details. Cause
+// holds the underlying error, which is logged but not sent.
+type Error struct {
+	Code       Code                   `json:"code"`
+	HTTPStatus int                    `json:"-"`
+	Message    string                 `json:"message"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	Cause      error                  `json:"-"`
+}
+
+// New returns an Error of the given code, with the HTTP status of the code
+// and a message formatted from format and args.
+func New(code Code, format string, args ...interface{}) *Error {
+	status := http.StatusInternalServerError
+	if k, ok := kinds[code]; ok {
+		status = k.status
+	}
+
+	return &Error{Code: code, HTTPStatus: status, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap returns an Error of the given code caused by err.
+func Wrap(err error, code Code, format string, args ...interface{}) *Error {
+	e := New(code, format, args...)
+	e.Cause = err
+	return e
+}
+
+// BadRequest returns a CodeBadRequest Error.
+func BadRequest(format string, args ...interface{}) *Error {
+	return New(CodeBadRequest, format, args...)
+}
+
+// Unauthorized returns a CodeUnauthorized Error.
+func Unauthorized(format string, args ...interface{}) *Error {
+	return New(CodeUnauthorized, format, args...)
+}
+
+// Forbidden returns a CodeForbidden Error.
+func Forbidden(format string, args ...interface{}) *Error {
+	return New(CodeForbidden, format, args...)
+}
+
+// NotFound returns a CodeNotFound Error.
+func NotFound(format string, args ...interface{}) *Error {
+	return New(CodeNotFound, format, args...)
+}
+
+// Conflict returns a CodeConflict Error.
+func Conflict(format string, args ...interface{}) *Error {
+	return New(CodeConflict, format, args...)
+}
+
+// Unprocessable returns a CodeUnprocessable Error.
+func Unprocessable(format string, args ...interface{}) *Error {
+	return New(CodeUnprocessable, format, args...)
+}
+
+// TooManyRequests returns a CodeTooManyRequests Error.
+func TooManyRequests(format string, args ...interface{}) *Error {
+	return New(CodeTooManyRequests, format, args...)
+}
+
+// Internal returns a CodeInternal Error caused by err. Its message is the
+// generic status text, so the cause isn't leaked to clients.
+func Internal(err error) *Error {
+	return Wrap(err, CodeInternal, "%s", http.StatusText(http.StatusInternalServerError))
+}
+
+// Unavailable returns a CodeUnavailable Error.
+func Unavailable(format string, args ...interface{}) *Error {
+	return New(CodeUnavailable, format, args...)
+}
+
+// WithDetail sets a detail of the error and returns it.
+func (e *Error) WithDetail(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+// WithCause sets the cause of the error and returns it.
+func (e *Error) WithCause(err error) *Error {
+	e.Cause = err
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil && e.Cause.Error() != e.Message {
+		return e.Message + ": " + e.Cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// Is reports whether target is the api sentinel error of the code of e, such
+// as api.ErrNotFound for CodeNotFound.
+func (e *Error) Is(target error) bool {
+	k, ok := kinds[e.Code]
+	return ok && k.sentinel != nil && target == k.sentinel
+}
+
+func (e *Error) StatusCode() int {
+	if e.HTTPStatus == 0 {
+		return http.StatusInternalServerError
+	}
+	return e.HTTPStatus
+}
+
+// StatusCoder is implemented by errors reporting their HTTP status, such as
+// the typed errors of the http transport.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// From converts err into an Error: the Error it wraps, if any, or else one
+// whose code is derived from the status it reports or the api sentinel error
+// it wraps. Other errors become CodeInternal Errors. It returns nil for a nil
+// err.
+func From(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	var sc StatusCoder
+	if errors.As(err, &sc) {
+		return &Error{Code: codeOf(sc.StatusCode()), HTTPStatus: sc.StatusCode(), Message: err.Error(), Cause: err}
+	}
+
+	for _, code := range codes {
+		if k := kinds[code]; k.sentinel != nil && errors.Is(err, k.sentinel) {
+			return &Error{Code: code, HTTPStatus: k.status, Message: err.Error(), Cause: err}
+		}
+	}
+
+	return Internal(err)
+}
+
+// codeOf returns the code of an HTTP status.
+func codeOf(status int) Code {
+	for _, code := range codes {
+		if kinds[code].status == status {
+			return code
+		}
+	}
+
+	if status >= http.StatusInternalServerError {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
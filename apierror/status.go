@@ -0,0 +1,104 @@
+package apierror
+
+import (
+	"errors"
+	"sync"
+)
+
+type errorStatus struct {
+	err    error
+	status int
+}
+
+// StatusMapper maps errors to HTTP status codes, overriding the statuses
+// errors report themselves. Applications register their mappings at startup,
+// for their own sentinel errors or to change the status of a Code.
+type StatusMapper struct {
+	mu       sync.RWMutex
+	errs     []errorStatus
+	codes    map[Code]int
+	fallback *StatusMapper
+}
+
+// NewStatusMapper returns an empty StatusMapper, which defers to fallback,
+// when not nil, for the errors it has no mapping for.
+func NewStatusMapper(fallback *StatusMapper) *StatusMapper {
+	return &StatusMapper{
+		codes:    make(map[Code]int),
+		fallback: fallback,
+	}
+}
+
+// DefaultStatusMapper is the StatusMapper consulted by Err2code and the
+// error encoders of the http transport.
+var DefaultStatusMapper = NewStatusMapper(nil)
+
+// RegisterStatus maps the errors matching err to status in
+// DefaultStatusMapper.
+func RegisterStatus(err error, status int) {
+	DefaultStatusMapper.Register(err, status)
+}
+
+// RegisterCodeStatus maps the Errors of code to status in
+// DefaultStatusMapper.
+func RegisterCodeStatus(code Code, status int) {
+	DefaultStatusMapper.RegisterCode(code, status)
+}
+
+// Register maps the errors matching target, in the sense of errors.Is, to
+// status. When an error matches several registered targets, the last
+// registered one wins.
+func (m *StatusMapper) Register(target error, status int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.errs = append([]errorStatus{{err: target, status: status}}, m.errs...)
+}
+
+// RegisterCode maps the errors wrapping an *Error of the given code to
+// status. Code mappings take precedence over error mappings.
+func (m *StatusMapper) RegisterCode(code Code, status int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.codes[code] = status
+}
+
+// Status returns the status code err is mapped to, looking in the fallback
+// mapper when m has no mapping for it. It reports false for unmapped errors.
+func (m *StatusMapper) Status(err error) (int, bool) {
+	if err == nil {
+		return 0, false
+	}
+
+	m.mu.RLock()
+	status, ok := m.lookup(err)
+	m.mu.RUnlock()
+	if ok {
+		return status, true
+	}
+
+	if m.fallback != nil {
+		return m.fallback.Status(err)
+	}
+	return 0, false
+}
+
+func (m *StatusMapper) lookup(err error) (int, bool) {
+	if len(m.codes) > 0 {
+		var e *Error
+		if errors.As(err, &e) {
+			if status, ok := m.codes[e.Code]; ok {
+				return status, true
+			}
+		}
+	}
+
+	for _, es := range m.errs {
+		if errors.Is(err, es.err) {
+			return es.status, true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,231 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// ErrKeyNotFound is returned by a Store when no key has the requested id.
+var ErrKeyNotFound = errors.New("api key not found")
+
+// Key is the stored part of an API key. The secret itself is never stored,
+// only its SHA-256 hash.
+type Key struct {
+	ID        string
+	Prefix    string
+	Hash      []byte
+	Name      string
+	Owner     string
+	Scopes    []string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Revoked   bool
+}
+
+// Expired reports whether the key has an expiry that has passed.
+func (k *Key) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && now.After(k.ExpiresAt)
+}
+
+// HasScope reports whether the key grants scope. The "*" scope grants every
+// scope.
+func (k *Key) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Store persists API keys. Implementations must be safe for concurrent use.
+type Store interface {
+	// Create stores a new key.
+	Create(ctx context.Context, key *Key) error
+
+	// Get returns the key with the given id, or ErrKeyNotFound.
+	Get(ctx context.Context, id string) (*Key, error)
+
+	// Revoke marks the key with the given id as revoked, or returns
+	// ErrKeyNotFound.
+	Revoke(ctx context.Context, id string) error
+}
+
+// Generate creates a new API key made of prefix, a public id used to look the
+// key up and a random secret, separated by underscores, e.g.
+// "sk_1a2b3c4d5e6f_9f86d081884c...". It returns the key to hand to the client,
+// which can't be recovered later, and the Key to store.
+func Generate(prefix string) (string, *Key, error) {
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+
+	key := &Key{
+		ID:        hex.EncodeToString(id),
+		Prefix:    prefix,
+		CreatedAt: time.Now(),
+	}
+	encoded := hex.EncodeToString(secret)
+	key.Hash = hashSecret(encoded)
+
+	return prefix + "_" + key.ID + "_" + encoded, key, nil
+}
+
+// Parse splits plain into its prefix, id and secret. The prefix may itself
+// contain underscores.
+func Parse(plain string) (prefix, id, secret string, err error) {
+	i := strings.LastIndex(plain, "_")
+	if i < 0 {
+		return "", "", "", fmt.Errorf("%w: malformed api key", api.ErrUnauthorized)
+	}
+	rest, secret := plain[:i], plain[i+1:]
+
+	j := strings.LastIndex(rest, "_")
+	if j < 0 {
+		return "", "", "", fmt.Errorf("%w: malformed api key", api.ErrUnauthorized)
+	}
+
+	return rest[:j], rest[j+1:], secret, nil
+}
+
+func hashSecret(secret string) []byte {
+	sum := sha256.Sum256([]byte(secret))
+	return sum[:]
+}
+
+// Manager issues and verifies API keys kept in a Store.
+type Manager struct {
+	store  Store
+	prefix string
+	now    func() time.Time
+}
+
+// NewManager creates a Manager issuing keys starting with prefix.
+func NewManager(store Store, prefix string) *Manager {
+	return &Manager{store: store, prefix: prefix, now: time.Now}
+}
+
+// Issue generates and stores a new key for owner with the given scopes. A
+// zero ttl issues a key that never expires. The returned string is the only
+// copy of the full key.
+func (m *Manager) Issue(ctx context.Context, name, owner string, scopes []string, ttl time.Duration) (string, *Key, error) {
+	plain, key, err := Generate(m.prefix)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key.Name = name
+	key.Owner = owner
+	key.Scopes = scopes
+	if ttl > 0 {
+		key.ExpiresAt = key.CreatedAt.Add(ttl)
+	}
+
+	if err := m.store.Create(ctx, key); err != nil {
+		return "", nil, err
+	}
+
+	return plain, key, nil
+}
+
+// Verify returns the stored Key of plain. Malformed, unknown, revoked and
+// expired keys, as well as wrong secrets, fail with an error wrapping
+// api.ErrUnauthorized.
+func (m *Manager) Verify(ctx context.Context, plain string) (*Key, error) {
+	prefix, id, secret, err := Parse(plain)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := m.store.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, fmt.Errorf("%w: unknown api key", api.ErrUnauthorized)
+		}
+		return nil, err
+	}
+
+	if prefix != key.Prefix || subtle.ConstantTimeCompare(hashSecret(secret), key.Hash) != 1 {
+		return nil, fmt.Errorf("%w: invalid api key", api.ErrUnauthorized)
+	}
+
+	if key.Revoked {
+		return nil, fmt.Errorf("%w: api key revoked", api.ErrUnauthorized)
+	}
+
+	if key.Expired(m.now()) {
+		return nil, fmt.Errorf("%w: api key expired", api.ErrUnauthorized)
+	}
+
+	return key, nil
+}
+
+// Validate verifies plain and returns its *Key as claims. It has the
+// signature expected by MakeHttpApikeyMiddleware of transport/http.
+func (m *Manager) Validate(ctx context.Context, plain string) (any, error) {
+	return m.Verify(ctx, plain)
+}
+
+// Revoke revokes the key with the given id.
+func (m *Manager) Revoke(ctx context.Context, id string) error {
+	return m.store.Revoke(ctx, id)
+}
+
+// KeyFromContext returns the key stored in the context by
+// MakeHttpApikeyMiddleware when it is given Manager.Validate.
+func KeyFromContext(ctx context.Context) (*Key, bool) {
+	key, ok := ctx.Value(api.ContextKeyAuthClaims).(*Key)
+	return key, ok
+}
+
+// RequireScopes returns a Middleware failing with an error wrapping
+// api.ErrInsufficientScope unless the API key of the request grants every one
+// of scopes. Requests without a key fail with api.ErrUnauthorized.
+func RequireScopes[I, O any](scopes ...string) api.Middleware[I, O] {
+	return func(next api.Endpoint[I, O]) api.Endpoint[I, O] {
+		return func(ctx context.Context, request I) (O, error) {
+			var empty O
+
+			key, ok := KeyFromContext(ctx)
+			if !ok {
+				return empty, api.ErrUnauthorized
+			}
+
+			for _, scope := range scopes {
+				if !key.HasScope(scope) {
+					return empty, fmt.Errorf("%w: missing %s", api.ErrInsufficientScope, scope)
+				}
+			}
+
+			return next(ctx, request)
+		}
+	}
+}
+
+// OwnerTenant is a tenant resolver for the ApikeyTenantResolver option of
+// transport/http, using the owner of the key as tenant id. Keys without an
+// owner fail with api.ErrTenantRequired.
+func OwnerTenant(_ context.Context, claims any) (*api.Tenant, error) {
+	key, ok := claims.(*Key)
+	if !ok || key.Owner == "" {
+		return nil, api.ErrTenantRequired
+	}
+
+	return &api.Tenant{ID: key.Owner}, nil
+}
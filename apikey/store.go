@@ -0,0 +1,181 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/likearthian/apikit/internal/storeutil"
+)
+
+// MemoryStore is an in-memory Store.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	keys map[string]Key
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{keys: make(map[string]Key)}
+}
+
+// Create implements Store.
+func (s *MemoryStore) Create(_ context.Context, key *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[key.ID]; ok {
+		return fmt.Errorf("api key %s already exists", key.ID)
+	}
+	s.keys[key.ID] = cloneKey(key)
+
+	return nil
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(_ context.Context, id string) (*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	k := cloneKey(&key)
+	return &k, nil
+}
+
+// Revoke implements Store.
+func (s *MemoryStore) Revoke(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	key.Revoked = true
+	s.keys[id] = key
+
+	return nil
+}
+
+func cloneKey(key *Key) Key {
+	k := *key
+	k.Hash = append([]byte(nil), key.Hash...)
+	k.Scopes = append([]string(nil), key.Scopes...)
+	return k
+}
+
+type sqlStoreOption struct {
+	ph storeutil.Placeholders
+}
+
+// SQLStoreOption sets an optional parameter for SQLStore.
+type SQLStoreOption func(opt *sqlStoreOption)
+
+// SQLDollarPlaceholders makes SQLStore use $1, $2... placeholders, as
+// required by PostgreSQL drivers, instead of ?.
+func SQLDollarPlaceholders() SQLStoreOption {
+	return func(opt *sqlStoreOption) { opt.ph.Dollar = true }
+}
+
+// SQLStore is a Store keeping keys in a table created with:
+//
+//	CREATE TABLE api_keys (
+//		id         VARCHAR(32) PRIMARY KEY,
+//		prefix     VARCHAR(32) NOT NULL,
+//		hash       BYTEA NOT NULL,
+//		name       VARCHAR(255) NOT NULL,
+//		owner      VARCHAR(255) NOT NULL,
+//		scopes     TEXT NOT NULL,
+//		created_at TIMESTAMP NOT NULL,
+//		expires_at TIMESTAMP NULL,
+//		revoked    BOOLEAN NOT NULL
+//	)
+//
+// Scopes are stored space separated.
+type SQLStore struct {
+	db    *sql.DB
+	table string
+	ph    storeutil.Placeholders
+}
+
+// NewSQLStore creates a SQLStore using table.
+func NewSQLStore(db *sql.DB, table string, options ...SQLStoreOption) (*SQLStore, error) {
+	if !storeutil.ValidIdentifier(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+
+	var opts sqlStoreOption
+	for _, option := range options {
+		option(&opts)
+	}
+
+	return &SQLStore{db: db, table: table, ph: opts.ph}, nil
+}
+
+// Create implements Store.
+func (s *SQLStore) Create(ctx context.Context, key *Key) error {
+	var expiresAt sql.NullTime
+	if !key.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: key.ExpiresAt, Valid: true}
+	}
+
+	query := "INSERT INTO " + s.table +
+		" (id, prefix, hash, name, owner, scopes, created_at, expires_at, revoked) VALUES (" +
+		s.ph.List(9) + ")"
+	_, err := s.db.ExecContext(ctx, query, key.ID, key.Prefix, key.Hash, key.Name, key.Owner,
+		strings.Join(key.Scopes, " "), key.CreatedAt, expiresAt, key.Revoked)
+
+	return err
+}
+
+// Get implements Store.
+func (s *SQLStore) Get(ctx context.Context, id string) (*Key, error) {
+	query := "SELECT id, prefix, hash, name, owner, scopes, created_at, expires_at, revoked FROM " +
+		s.table + " WHERE id = " + s.ph.Nth(1)
+
+	var (
+		key       Key
+		scopes    string
+		expiresAt sql.NullTime
+	)
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&key.ID, &key.Prefix, &key.Hash, &key.Name,
+		&key.Owner, &scopes, &key.CreatedAt, &expiresAt, &key.Revoked)
+	if err == sql.ErrNoRows {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = strings.Fields(scopes)
+	if expiresAt.Valid {
+		key.ExpiresAt = expiresAt.Time
+	}
+
+	return &key, nil
+}
+
+// Revoke implements Store.
+func (s *SQLStore) Revoke(ctx context.Context, id string) error {
+	query := "UPDATE " + s.table + " SET revoked = " + s.ph.Nth(1) + " WHERE id = " + s.ph.Nth(2)
+	res, err := s.db.ExecContext(ctx, query, true, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrKeyNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,327 @@
+// Package apitest is a kit for the tests of apikit services. A TestServer
+// serves a handler over httptest, performs typed requests and decodes their
+// BaseResponse envelopes, and injects into the contexts of the requests what
+// the middlewares of a real deployment would, such as auth claims, request
+// ids and URL parameters:
+//
+//	rec := apitest.NewRecorder()
+//	h := httptransport.NewServer(getUser, decodeGetUser, apikit.MakeJSONEnvelopeResponseEncoder[User](),
+//		httptransport.ServerFinalizer(rec.Finalize))
+//	ts := apitest.NewTestServer(t, h,
+//		apitest.ServerInject(apitest.Claims(&api.TokenClaims{Type: "access"})))
+//
+//	res := apitest.Get[User](ts, "/users/1",
+//		apitest.Inject(apitest.RequestID("req-1"), apitest.URLParams(map[string]string{"id": "1"})))
+//	res.AssertStatus(http.StatusOK)
+//	res.AssertGolden("get_user")
+//	user := res.Data()
+//	rec.AssertFinalized(t, http.MethodGet, "/users/1", http.StatusOK)
+package apitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/likearthian/apikit/api"
+	httptransport "github.com/likearthian/apikit/transport/http"
+)
+
+// headerInjection carries the key of the Injectors of a request from the
+// client to the handler of a TestServer, which removes it.
+const headerInjection = "X-Apitest-Injection"
+
+// Injector modifies the requests received by a TestServer before they reach
+// its handler.
+type Injector func(r *http.Request) *http.Request
+
+// Claims is an Injector storing claims in the context as the auth
+// middlewares do, under api.ContextKeyAuthClaims. Pass an *api.TokenClaims
+// for the endpoints reading them with api.AuthClaimsFromContext.
+func Claims(claims interface{}) Injector {
+	return Context(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, api.ContextKeyAuthClaims, claims)
+	})
+}
+
+// RequestID is an Injector sending id as the X-Request-ID of the request,
+// and storing it in the context as httptransport.PopulateRequestContext
+// does, so the envelopes and the golden files hold a known request id.
+func RequestID(id string) Injector {
+	return func(r *http.Request) *http.Request {
+		r.Header.Set(httptransport.HeaderXRequestID, id)
+		return r.WithContext(context.WithValue(r.Context(), httptransport.ContextKeyRequestXRequestID, id))
+	}
+}
+
+// URLParams is an Injector storing params in the context under
+// httptransport.ContextKeyURLParams, where the decoders read the path
+// parameters from, for the handlers tested without their router. The
+// RequestFuncs of the routers, such as httptransport.ChiURLParamIntoContext,
+// replace them.
+func URLParams(params map[string]string) Injector {
+	return Context(func(ctx context.Context) context.Context {
+		return context.WithValue(ctx, httptransport.ContextKeyURLParams, params)
+	})
+}
+
+// Context is an Injector replacing the context of the request with the one
+// returned by fn.
+func Context(fn func(ctx context.Context) context.Context) Injector {
+	return func(r *http.Request) *http.Request {
+		return r.WithContext(fn(r.Context()))
+	}
+}
+
+// NewContext returns a context holding what the injectors inject into the
+// requests, for the tests calling endpoints directly.
+func NewContext(injectors ...Injector) context.Context {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, inject := range injectors {
+		r = inject(r)
+	}
+	return r.Context()
+}
+
+// TestServer is an httptest.Server serving a handler, closed at the end of
+// the test.
+type TestServer struct {
+	*httptest.Server
+
+	t         testing.TB
+	client    *http.Client
+	injectors []Injector
+	goldenDir string
+
+	next     uint64
+	requests sync.Map // injection key -> []Injector
+}
+
+type testServerOption struct {
+	injectors []Injector
+	client    *http.Client
+	goldenDir string
+}
+
+// TestServerOption sets an optional parameter for test servers.
+type TestServerOption func(opt *testServerOption)
+
+// ServerInject sets the Injectors applied to every request, before those of
+// the request.
+func ServerInject(injectors ...Injector) TestServerOption {
+	return func(opt *testServerOption) { opt.injectors = append(opt.injectors, injectors...) }
+}
+
+// ServerClient sets the client performing the requests. Defaults to the
+// client of the httptest.Server.
+func ServerClient(client *http.Client) TestServerOption {
+	return func(opt *testServerOption) { opt.client = client }
+}
+
+// ServerGoldenDir sets the directory of the golden files. Defaults to
+// "testdata".
+func ServerGoldenDir(dir string) TestServerOption {
+	return func(opt *testServerOption) { opt.goldenDir = dir }
+}
+
+// NewTestServer starts a TestServer serving h.
+func NewTestServer(t testing.TB, h http.Handler, options ...TestServerOption) *TestServer {
+	t.Helper()
+
+	opts := &testServerOption{goldenDir: "testdata"}
+	for _, option := range options {
+		option(opts)
+	}
+
+	ts := &TestServer{
+		t:         t,
+		injectors: opts.injectors,
+		goldenDir: opts.goldenDir,
+	}
+	ts.Server = httptest.NewServer(ts.inject(h))
+	t.Cleanup(ts.Close)
+
+	ts.client = opts.client
+	if ts.client == nil {
+		ts.client = ts.Server.Client()
+	}
+
+	return ts
+}
+
+// inject applies the Injectors of the server and of the request to the
+// requests received by h.
+func (ts *TestServer) inject(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, inject := range ts.injectors {
+			r = inject(r)
+		}
+
+		if key := r.Header.Get(headerInjection); key != "" {
+			r.Header.Del(headerInjection)
+			if injectors, ok := ts.requests.LoadAndDelete(key); ok {
+				for _, inject := range injectors.([]Injector) {
+					r = inject(r)
+				}
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+type requestOption struct {
+	header      http.Header
+	query       url.Values
+	injectors   []Injector
+	contentType string
+}
+
+// RequestOption sets an optional parameter for the requests of a
+// TestServer.
+type RequestOption func(opt *requestOption)
+
+// Header adds a header to the request.
+func Header(key, value string) RequestOption {
+	return func(opt *requestOption) { opt.header.Add(key, value) }
+}
+
+// Query adds a query parameter to the request.
+func Query(key, value string) RequestOption {
+	return func(opt *requestOption) { opt.query.Add(key, value) }
+}
+
+// Bearer sends token in the Authorization header of the request.
+func Bearer(token string) RequestOption {
+	return Header(httptransport.HeaderAuthorization, "Bearer "+token)
+}
+
+// ContentType sets the content type of the body of the request. Defaults to
+// application/json.
+func ContentType(contentType string) RequestOption {
+	return func(opt *requestOption) { opt.contentType = contentType }
+}
+
+// Inject sets the Injectors applied to the request, after those of the
+// server.
+func Inject(injectors ...Injector) RequestOption {
+	return func(opt *requestOption) { opt.injectors = append(opt.injectors, injectors...) }
+}
+
+// Do performs a request to ts, failing the test when it cannot be
+// performed. The body is sent as is when it is a []byte, a string or an
+// io.Reader, and JSON encoded otherwise; a nil body sends none. T is the
+// type of the data of the response.
+func Do[T any](ts *TestServer, method, path string, body interface{}, options ...RequestOption) *Response[T] {
+	ts.t.Helper()
+
+	opts := &requestOption{
+		header:      make(http.Header),
+		query:       make(url.Values),
+		contentType: httptransport.HttpContentTypeJson,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		reader = bytes.NewReader(b)
+	case string:
+		reader = strings.NewReader(b)
+	case io.Reader:
+		reader = b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			ts.t.Fatalf("apitest: encode body of %s %s: %v", method, path, err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		ts.t.Fatalf("apitest: new request %s %s: %v", method, path, err)
+	}
+
+	if len(opts.query) > 0 {
+		query := req.URL.Query()
+		for key, values := range opts.query {
+			query[key] = append(query[key], values...)
+		}
+		req.URL.RawQuery = query.Encode()
+	}
+
+	for key, values := range opts.header {
+		req.Header[key] = values
+	}
+	if reader != nil && req.Header.Get(httptransport.HeaderContentType) == "" {
+		req.Header.Set(httptransport.HeaderContentType, opts.contentType)
+	}
+
+	if len(opts.injectors) > 0 {
+		key := strconv.FormatUint(atomic.AddUint64(&ts.next, 1), 10)
+		ts.requests.Store(key, opts.injectors)
+		req.Header.Set(headerInjection, key)
+	}
+
+	res, err := ts.client.Do(req)
+	if err != nil {
+		ts.t.Fatalf("apitest: %s %s: %v", method, path, err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		ts.t.Fatalf("apitest: read response of %s %s: %v", method, path, err)
+	}
+
+	return &Response[T]{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       data,
+		t:          ts.t,
+		goldenDir:  ts.goldenDir,
+	}
+}
+
+// Get performs a GET request to ts.
+func Get[T any](ts *TestServer, path string, options ...RequestOption) *Response[T] {
+	ts.t.Helper()
+	return Do[T](ts, http.MethodGet, path, nil, options...)
+}
+
+// Post performs a POST request to ts.
+func Post[T any](ts *TestServer, path string, body interface{}, options ...RequestOption) *Response[T] {
+	ts.t.Helper()
+	return Do[T](ts, http.MethodPost, path, body, options...)
+}
+
+// Put performs a PUT request to ts.
+func Put[T any](ts *TestServer, path string, body interface{}, options ...RequestOption) *Response[T] {
+	ts.t.Helper()
+	return Do[T](ts, http.MethodPut, path, body, options...)
+}
+
+// Patch performs a PATCH request to ts.
+func Patch[T any](ts *TestServer, path string, body interface{}, options ...RequestOption) *Response[T] {
+	ts.t.Helper()
+	return Do[T](ts, http.MethodPatch, path, body, options...)
+}
+
+// Delete performs a DELETE request to ts.
+func Delete[T any](ts *TestServer, path string, options ...RequestOption) *Response[T] {
+	ts.t.Helper()
+	return Do[T](ts, http.MethodDelete, path, nil, options...)
+}
@@ -0,0 +1,134 @@
+package apitest
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Finalized is a request seen by the finalizer of a Recorder.
+type Finalized struct {
+	Method string
+	Path   string
+	Code   int
+}
+
+// Recorder records what the finalizers of the servers and the metrics of the
+// endpoints under test observed, for the assertions of the test:
+//
+//	rec := apitest.NewRecorder()
+//	m := metrics.NewMetrics("users", metrics.WithRegisterer(rec.Registerer()))
+//	h := httptransport.NewServer(metrics.InstrumentingMiddleware[I, O](m, "get_user")(e), dec, enc,
+//		httptransport.ServerFinalizer(rec.Finalize))
+//	...
+//	rec.AssertMetric(t, 1, "users_requests_total", "endpoint", "get_user", "status_class", "2xx")
+type Recorder struct {
+	mu        sync.Mutex
+	finalized []Finalized
+	registry  *prometheus.Registry
+}
+
+// NewRecorder returns a Recorder with nothing recorded.
+func NewRecorder() *Recorder {
+	return &Recorder{registry: prometheus.NewRegistry()}
+}
+
+// Finalize is an httptransport.ServerFinalizerFunc recording the requests.
+func (rec *Recorder) Finalize(_ context.Context, code int, r *http.Request) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.finalized = append(rec.finalized, Finalized{Method: r.Method, Path: r.URL.Path, Code: code})
+}
+
+// Finalized returns the requests recorded by Finalize, in order.
+func (rec *Recorder) Finalized() []Finalized {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	return append([]Finalized(nil), rec.finalized...)
+}
+
+// AssertFinalized fails the test when no request to method and path was
+// finalized with code.
+func (rec *Recorder) AssertFinalized(t testing.TB, method, path string, code int) {
+	t.Helper()
+
+	want := Finalized{Method: method, Path: path, Code: code}
+	finalized := rec.Finalized()
+	for _, f := range finalized {
+		if f == want {
+			return
+		}
+	}
+	t.Errorf("apitest: %s %s not finalized with %d, finalized: %v", method, path, code, finalized)
+}
+
+// Registerer returns the registry of the recorder, to register the metrics
+// under test with, such as with metrics.WithRegisterer.
+func (rec *Recorder) Registerer() prometheus.Registerer {
+	return rec.registry
+}
+
+// Metric returns the sum of the values of the series of the metric name
+// having the label pairs labels: the values of counters and gauges, and the
+// counts of samples of histograms and summaries. It returns 0 when no such
+// series was recorded.
+func (rec *Recorder) Metric(name string, labels ...string) float64 {
+	families, err := rec.registry.Gather()
+	if err != nil {
+		return 0
+	}
+
+	var sum float64
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+	metrics:
+		for _, m := range family.GetMetric() {
+			for i := 0; i+1 < len(labels); i += 2 {
+				found := false
+				for _, pair := range m.GetLabel() {
+					if pair.GetName() == labels[i] && pair.GetValue() == labels[i+1] {
+						found = true
+						break
+					}
+				}
+				if !found {
+					continue metrics
+				}
+			}
+
+			switch {
+			case m.Counter != nil:
+				sum += m.GetCounter().GetValue()
+			case m.Gauge != nil:
+				sum += m.GetGauge().GetValue()
+			case m.Histogram != nil:
+				sum += float64(m.GetHistogram().GetSampleCount())
+			case m.Summary != nil:
+				sum += float64(m.GetSummary().GetSampleCount())
+			case m.Untyped != nil:
+				sum += m.GetUntyped().GetValue()
+			}
+		}
+	}
+
+	return sum
+}
+
+// AssertMetric fails the test when the value of the metric name with the
+// label pairs labels, as returned by Metric, is not want.
+func (rec *Recorder) AssertMetric(t testing.TB, want float64, name string, labels ...string) {
+	t.Helper()
+
+	if got := rec.Metric(name, labels...); got != want {
+		t.Errorf("apitest: metric %s{%s} = %v, want %v", name, strings.Join(labels, ","), got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package apitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/likearthian/apikit"
+	"github.com/likearthian/apikit/api"
+)
+
+var update = flag.Bool("apitest.update", false, "rewrite the golden files of apitest with the actual responses")
+
+// BaseResponse is apikit.BaseResponse with data of type T.
+type BaseResponse[T any] struct {
+	RequestID  string                `json:"request_id"`
+	StatusCode int                   `json:"status_code"`
+	StatusText string                `json:"status_text"`
+	Data       T                     `json:"data"`
+	Error      string                `json:"error,omitempty"`
+	Errors     []api.FieldError      `json:"errors,omitempty"`
+	Pagination *apikit.PaginationDTO `json:"pagination,omitempty"`
+}
+
+// Response is the response to a request of a TestServer, whose body is read.
+// Its methods fail the test of the server.
+type Response[T any] struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+
+	t         testing.TB
+	goldenDir string
+}
+
+// Envelope decodes the body as a BaseResponse.
+func (r *Response[T]) Envelope() BaseResponse[T] {
+	r.t.Helper()
+
+	var envelope BaseResponse[T]
+	if err := json.Unmarshal(r.Body, &envelope); err != nil {
+		r.t.Fatalf("apitest: decode envelope: %v\nbody: %s", err, r.Body)
+	}
+	return envelope
+}
+
+// Data decodes the body as a BaseResponse and returns its data.
+func (r *Response[T]) Data() T {
+	r.t.Helper()
+	return r.Envelope().Data
+}
+
+// Decode decodes the body, sent without envelope, as T.
+func (r *Response[T]) Decode() T {
+	r.t.Helper()
+
+	var v T
+	if err := json.Unmarshal(r.Body, &v); err != nil {
+		r.t.Fatalf("apitest: decode body: %v\nbody: %s", err, r.Body)
+	}
+	return v
+}
+
+// AssertStatus fails the test when the status of the response is not code.
+func (r *Response[T]) AssertStatus(code int) {
+	r.t.Helper()
+
+	if r.StatusCode != code {
+		r.t.Errorf("apitest: status %d, want %d\nbody: %s", r.StatusCode, code, r.Body)
+	}
+}
+
+// AssertHeader fails the test when the header key of the response is not
+// value.
+func (r *Response[T]) AssertHeader(key, value string) {
+	r.t.Helper()
+
+	if got := r.Header.Get(key); got != value {
+		r.t.Errorf("apitest: header %s %q, want %q", key, got, value)
+	}
+}
+
+// AssertGolden fails the test when the body differs from the golden file
+// name + ".golden" of the golden directory of the server. JSON bodies are
+// compared indented, so the golden files are readable and diff well. Run the
+// tests with -apitest.update to write the golden files from the actual
+// bodies.
+func (r *Response[T]) AssertGolden(name string) {
+	r.t.Helper()
+
+	body := r.Body
+	var indented bytes.Buffer
+	if json.Indent(&indented, bytes.TrimSpace(body), "", "  ") == nil {
+		indented.WriteByte('\n')
+		body = indented.Bytes()
+	}
+
+	path := filepath.Join(r.goldenDir, name+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			r.t.Fatalf("apitest: %v", err)
+		}
+		if err := os.WriteFile(path, body, 0o644); err != nil {
+			r.t.Fatalf("apitest: %v", err)
+		}
+		return
+	}
+
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		r.t.Fatalf("apitest: %v (run with -apitest.update to create it)", err)
+	}
+
+	if !bytes.Equal(body, golden) {
+		r.t.Errorf("apitest: body differs from %s\ngot:\n%s\nwant:\n%s", path, body, golden)
+	}
+}
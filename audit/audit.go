@@ -0,0 +1,238 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/likearthian/apikit"
+	"github.com/likearthian/apikit/api"
+)
+
+// ErrClosed is reported for the events recorded after the Auditor is closed.
+var ErrClosed = errors.New("audit: auditor closed")
+
+// Outcome tells whether the audited call succeeded.
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	OutcomeFailure Outcome = "failure"
+)
+
+// Event is an entry of the audit trail: who (Actor) did what (Action) to
+// which resource (Target), and how it went.
+type Event struct {
+	Time      time.Time   `json:"time"`
+	RequestID string      `json:"request_id,omitempty"`
+	Actor     string      `json:"actor"`
+	Action    string      `json:"action"`
+	Target    string      `json:"target,omitempty"`
+	Outcome   Outcome     `json:"outcome"`
+	Error     string      `json:"error,omitempty"`
+	Diff      interface{} `json:"diff,omitempty"`
+}
+
+// Sink stores or forwards audit events. Write is only called by the delivery
+// goroutine of the Auditor, one event at a time.
+type Sink interface {
+	Write(ctx context.Context, e Event) error
+}
+
+// SinkFunc adapts a function to the Sink interface.
+type SinkFunc func(ctx context.Context, e Event) error
+
+// Write implements Sink.
+func (f SinkFunc) Write(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+// ActorFunc returns the actor of the call being audited.
+type ActorFunc func(ctx context.Context) string
+
+// ClaimsActor is the default ActorFunc. It returns the subject of the claims
+// stored by api.WithJWTAuthEPMiddleware or token introspection, or "" for
+// anonymous calls.
+func ClaimsActor(ctx context.Context) string {
+	if claims, ok := api.AuthClaimsFromContext(ctx); ok {
+		return claims.Subject
+	}
+	return ""
+}
+
+// TargetFunc returns the resource targeted by request, such as "user:42".
+type TargetFunc[I any] func(ctx context.Context, request I) string
+
+// DiffFunc returns the change made by the call, such as the fields of request
+// that were updated. It is only called for successful calls, and must return
+// a value the sinks can marshal to JSON.
+type DiffFunc[I, O any] func(ctx context.Context, request I, response O) interface{}
+
+type auditorOption struct {
+	actor        ActorFunc
+	buffer       int
+	timeout      time.Duration
+	errorHandler func(err error, e Event)
+}
+
+// AuditorOption sets an optional parameter for NewAuditor.
+type AuditorOption func(opt *auditorOption)
+
+// WithActorFunc sets how the actor is extracted from the request context.
+// Defaults to ClaimsActor.
+func WithActorFunc(fn ActorFunc) AuditorOption {
+	return func(opt *auditorOption) { opt.actor = fn }
+}
+
+// WithBuffer sets how many events may wait for delivery. Recording an event
+// blocks while the buffer is full. Defaults to 1024.
+func WithBuffer(size int) AuditorOption {
+	return func(opt *auditorOption) { opt.buffer = size }
+}
+
+// WithTimeout sets the time allowed to each Sink.Write. Defaults to 5 seconds.
+func WithTimeout(d time.Duration) AuditorOption {
+	return func(opt *auditorOption) { opt.timeout = d }
+}
+
+// WithErrorHandler sets the function called with the events which could not
+// be recorded or delivered, so they can be logged or spooled. By default,
+// they are dropped.
+func WithErrorHandler(fn func(err error, e Event)) AuditorOption {
+	return func(opt *auditorOption) { opt.errorHandler = fn }
+}
+
+// Auditor delivers audit events to a Sink asynchronously, so a slow sink
+// doesn't delay the audited calls.
+type Auditor struct {
+	sink Sink
+	opts *auditorOption
+
+	mu     sync.RWMutex
+	closed bool
+	events chan Event
+	done   chan struct{}
+}
+
+// NewAuditor creates an Auditor delivering events to sink, and starts its
+// delivery goroutine, which runs until Close.
+func NewAuditor(sink Sink, options ...AuditorOption) *Auditor {
+	opts := &auditorOption{
+		actor:   ClaimsActor,
+		buffer:  1024,
+		timeout: 5 * time.Second,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	a := &Auditor{
+		sink:   sink,
+		opts:   opts,
+		events: make(chan Event, opts.buffer),
+		done:   make(chan struct{}),
+	}
+	go a.deliver()
+
+	return a
+}
+
+// Record queues e for delivery, filling its Time, RequestID and Actor from
+// ctx when they are not set. It blocks while the buffer is full, until ctx is
+// done, in which case the event is passed to the error handler.
+func (a *Auditor) Record(ctx context.Context, e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.RequestID == "" {
+		e.RequestID, _ = apikit.ReqIDFromContext(ctx)
+	}
+	if e.Actor == "" {
+		e.Actor = a.opts.actor(ctx)
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		a.fail(ErrClosed, e)
+		return
+	}
+
+	select {
+	case a.events <- e:
+		return
+	default:
+	}
+
+	select {
+	case a.events <- e:
+	case <-ctx.Done():
+		a.fail(ctx.Err(), e)
+	}
+}
+
+// Close stops accepting events and waits for the queued ones to be
+// delivered, or for ctx to be done.
+func (a *Auditor) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.events)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *Auditor) deliver() {
+	defer close(a.done)
+
+	for e := range a.events {
+		// the audited request may be over: deliveries get their own context
+		ctx, cancel := context.WithTimeout(context.Background(), a.opts.timeout)
+		if err := a.sink.Write(ctx, e); err != nil {
+			a.fail(err, e)
+		}
+		cancel()
+	}
+}
+
+func (a *Auditor) fail(err error, e Event) {
+	if a.opts.errorHandler != nil {
+		a.opts.errorHandler(err, e)
+	}
+}
+
+// Middleware returns an endpoint Middleware recording an event for every
+// call, with action as its Action, the resource returned by target (when not
+// nil) as its Target, and the change returned by diff (when not nil) as its
+// Diff. Calls failing with an error are recorded with a failure outcome.
+func Middleware[I, O any](a *Auditor, action string, target TargetFunc[I], diff DiffFunc[I, O]) api.Middleware[I, O] {
+	return func(next api.Endpoint[I, O]) api.Endpoint[I, O] {
+		return func(ctx context.Context, request I) (O, error) {
+			e := Event{Time: time.Now(), Action: action, Outcome: OutcomeSuccess}
+			if target != nil {
+				e.Target = target(ctx, request)
+			}
+
+			response, err := next(ctx, request)
+			if err != nil {
+				e.Outcome = OutcomeFailure
+				e.Error = err.Error()
+			} else if diff != nil {
+				e.Diff = diff(ctx, request, response)
+			}
+
+			a.Record(ctx, e)
+
+			return response, err
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/likearthian/apikit/internal/storeutil"
+)
+
+// JSONSink writes events to an io.Writer, such as os.Stdout, as JSON lines,
+// for log shippers to collect.
+type JSONSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONSink creates a JSONSink writing to w.
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{enc: json.NewEncoder(w)}
+}
+
+// Write implements Sink.
+func (s *JSONSink) Write(_ context.Context, e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.enc.Encode(e)
+}
+
+type sqlSinkOption struct {
+	ph storeutil.Placeholders
+}
+
+// SQLSinkOption sets an optional parameter for NewSQLSink.
+type SQLSinkOption func(opt *sqlSinkOption)
+
+// SQLDollarPlaceholders makes SQLSink use $1, $2... placeholders, as required
+// by PostgreSQL drivers, instead of ?.
+func SQLDollarPlaceholders() SQLSinkOption {
+	return func(opt *sqlSinkOption) { opt.ph.Dollar = true }
+}
+
+// SQLSink inserts events into a table created with:
+//
+//	CREATE TABLE audit_events (
+//		time       TIMESTAMP NOT NULL,
+//		request_id VARCHAR(128) NOT NULL,
+//		actor      VARCHAR(255) NOT NULL,
+//		action     VARCHAR(255) NOT NULL,
+//		target     VARCHAR(255) NOT NULL,
+//		outcome    VARCHAR(16) NOT NULL,
+//		error      TEXT NOT NULL,
+//		diff       TEXT NULL
+//	)
+//
+// Diffs are stored as JSON.
+type SQLSink struct {
+	db    *sql.DB
+	query string
+}
+
+// NewSQLSink creates a SQLSink inserting into table.
+func NewSQLSink(db *sql.DB, table string, options ...SQLSinkOption) (*SQLSink, error) {
+	if !storeutil.ValidIdentifier(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+
+	var opts sqlSinkOption
+	for _, option := range options {
+		option(&opts)
+	}
+
+	query := "INSERT INTO " + table +
+		" (time, request_id, actor, action, target, outcome, error, diff) VALUES (" +
+		opts.ph.List(8) + ")"
+
+	return &SQLSink{db: db, query: query}, nil
+}
+
+// Write implements Sink.
+func (s *SQLSink) Write(ctx context.Context, e Event) error {
+	var diff sql.NullString
+	if e.Diff != nil {
+		data, err := json.Marshal(e.Diff)
+		if err != nil {
+			return fmt.Errorf("audit diff: %w", err)
+		}
+		diff = sql.NullString{String: string(data), Valid: true}
+	}
+
+	_, err := s.db.ExecContext(ctx, s.query, e.Time, e.RequestID, e.Actor, e.Action, e.Target,
+		string(e.Outcome), e.Error, diff)
+
+	return err
+}
+
+// KafkaProducer publishes a message to a Kafka topic. It is satisfied by a
+// thin wrapper around the client of the service, such as a kafka-go Writer
+// or a sarama SyncProducer, so this package doesn't depend on any.
+type KafkaProducer interface {
+	Produce(ctx context.Context, topic string, key, value []byte) error
+}
+
+// KafkaSink publishes events to a Kafka topic as JSON, keyed by target, or
+// by actor for events without target, so the events of a resource keep
+// their order.
+type KafkaSink struct {
+	producer KafkaProducer
+	topic    string
+}
+
+// NewKafkaSink creates a KafkaSink publishing to topic with producer.
+func NewKafkaSink(producer KafkaProducer, topic string) *KafkaSink {
+	return &KafkaSink{producer: producer, topic: topic}
+}
+
+// Write implements Sink.
+func (s *KafkaSink) Write(ctx context.Context, e Event) error {
+	value, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	key := e.Target
+	if key == "" {
+		key = e.Actor
+	}
+
+	return s.producer.Produce(ctx, s.topic, []byte(key), value)
+}
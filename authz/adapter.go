@@ -0,0 +1,158 @@
+package authz
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/likearthian/apikit/internal/storeutil"
+)
+
+// FileAdapter loads a policy from a Casbin style CSV file:
+//
+//	p, alice, /reports/*, GET
+//	p, admin, *, *
+//	p, intern, /reports/{id}, DELETE, deny
+//	g, alice, admin
+//
+// Blank lines and lines starting with # are ignored.
+type FileAdapter struct {
+	path string
+}
+
+// NewFileAdapter creates a FileAdapter reading the policy at path.
+func NewFileAdapter(path string) *FileAdapter {
+	return &FileAdapter{path: path}
+}
+
+// LoadPolicy implements Adapter.
+func (a *FileAdapter) LoadPolicy(_ context.Context) (*Policy, error) {
+	f, err := os.Open(a.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParsePolicy(f)
+}
+
+// ParsePolicy reads a policy in the format of FileAdapter from r.
+func ParsePolicy(r io.Reader) (*Policy, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	policy := &Policy{}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		line, _ := cr.FieldPos(0)
+		if err := policy.add(record); err != nil {
+			return nil, fmt.Errorf("policy line %d: %w", line, err)
+		}
+	}
+
+	return policy, nil
+}
+
+// add appends the rule or grouping described by fields, the first of which is
+// the policy type "p" or "g".
+func (p *Policy) add(fields []string) error {
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	for len(fields) > 0 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	switch fields[0] {
+	case "p":
+		if len(fields) < 4 {
+			return fmt.Errorf("rule needs a subject, an object and an action")
+		}
+
+		rule := Rule{Subject: fields[1], Object: fields[2], Action: fields[3]}
+		if len(fields) > 4 {
+			switch strings.ToLower(fields[4]) {
+			case "allow":
+			case "deny":
+				rule.Deny = true
+			default:
+				return fmt.Errorf("unknown effect %q", fields[4])
+			}
+		}
+		p.Rules = append(p.Rules, rule)
+
+	case "g":
+		if len(fields) < 3 {
+			return fmt.Errorf("grouping needs a subject and a role")
+		}
+		p.Groupings = append(p.Groupings, Grouping{Subject: fields[1], Role: fields[2]})
+
+	default:
+		return fmt.Errorf("unknown policy type %q", fields[0])
+	}
+
+	return nil
+}
+
+// SQLAdapter loads a policy from a table laid out like Casbin's casbin_rule:
+// a ptype column holding "p" or "g" followed by the v0 to v3 columns holding
+// the fields of the line. Missing values may be NULL.
+type SQLAdapter struct {
+	db    *sql.DB
+	table string
+}
+
+// NewSQLAdapter creates a SQLAdapter reading the policy from table.
+func NewSQLAdapter(db *sql.DB, table string) (*SQLAdapter, error) {
+	if !storeutil.ValidIdentifier(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+
+	return &SQLAdapter{db: db, table: table}, nil
+}
+
+// LoadPolicy implements Adapter.
+func (a *SQLAdapter) LoadPolicy(ctx context.Context) (*Policy, error) {
+	rows, err := a.db.QueryContext(ctx, "SELECT ptype, v0, v1, v2, v3 FROM "+a.table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policy := &Policy{}
+	for rows.Next() {
+		var ptype string
+		var v [4]sql.NullString
+		if err := rows.Scan(&ptype, &v[0], &v[1], &v[2], &v[3]); err != nil {
+			return nil, err
+		}
+
+		fields := []string{ptype, v[0].String, v[1].String, v[2].String, v[3].String}
+		if err := policy.add(fields); err != nil {
+			return nil, fmt.Errorf("policy table %s: %w", a.table, err)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
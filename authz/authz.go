@@ -0,0 +1,136 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/likearthian/apikit"
+	"github.com/likearthian/apikit/api"
+)
+
+// Enforcer decides whether subject may perform action on object.
+// Implementations must be safe for concurrent use.
+type Enforcer interface {
+	Enforce(ctx context.Context, subject, object, action string) (bool, error)
+}
+
+// SubjectFunc returns the subject of the request being authorized.
+type SubjectFunc func(ctx context.Context) (string, error)
+
+// ClaimsSubject is the default SubjectFunc. It returns the subject of the
+// claims stored by api.WithJWTAuthEPMiddleware, and apikit.ErrUnauthorized
+// when there are none.
+func ClaimsSubject(ctx context.Context) (string, error) {
+	claims, ok := api.AuthClaimsFromContext(ctx)
+	if !ok || claims.Subject == "" {
+		return "", apikit.ErrUnauthorized
+	}
+
+	return claims.Subject, nil
+}
+
+type authzOption struct {
+	subject      SubjectFunc
+	errorEncoder func(ctx context.Context, err error, w http.ResponseWriter)
+}
+
+// Option sets an optional parameter for the authorization middlewares.
+type Option func(opt *authzOption)
+
+// WithSubjectFunc sets how the subject is extracted from the request context.
+// Defaults to ClaimsSubject.
+func WithSubjectFunc(fn SubjectFunc) Option {
+	return func(opt *authzOption) { opt.subject = fn }
+}
+
+// WithErrorEncoder sets how HTTPMiddleware writes rejections. Defaults to a
+// plain text body with the status code given by apikit.Err2code.
+func WithErrorEncoder(fn func(ctx context.Context, err error, w http.ResponseWriter)) Option {
+	return func(opt *authzOption) { opt.errorEncoder = fn }
+}
+
+func newAuthzOption(options []Option) *authzOption {
+	opts := &authzOption{
+		subject:      ClaimsSubject,
+		errorEncoder: encodeError,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return opts
+}
+
+// Middleware returns an endpoint Middleware allowing the call only when the
+// enforcer lets the subject perform action on object. Denied calls fail with
+// an error wrapping apikit.ErrForbidden.
+func Middleware[I, O any](e Enforcer, object, action string, options ...Option) api.Middleware[I, O] {
+	opts := newAuthzOption(options)
+
+	return func(next api.Endpoint[I, O]) api.Endpoint[I, O] {
+		return func(ctx context.Context, request I) (O, error) {
+			var empty O
+
+			if err := authorize(ctx, e, opts, object, action); err != nil {
+				return empty, err
+			}
+
+			return next(ctx, request)
+		}
+	}
+}
+
+// HTTPMiddleware returns an http middleware authorizing every request with
+// its chi route pattern (or its path, outside chi) as the object and its
+// method as the action. It must be installed with chi's Router.With or
+// Route.Use so the route pattern is known when it runs.
+func HTTPMiddleware(e Enforcer, options ...Option) func(http.Handler) http.Handler {
+	opts := newAuthzOption(options)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if err := authorize(ctx, e, opts, routePattern(r), r.Method); err != nil {
+				opts.errorEncoder(ctx, err, w)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func authorize(ctx context.Context, e Enforcer, opts *authzOption, object, action string) error {
+	subject, err := opts.subject(ctx)
+	if err != nil {
+		return err
+	}
+
+	allowed, err := e.Enforce(ctx, subject, object, action)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		return fmt.Errorf("%w: %s may not %s %s", apikit.ErrForbidden, subject, action, object)
+	}
+
+	return nil
+}
+
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+
+	return r.URL.Path
+}
+
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	http.Error(w, err.Error(), apikit.Err2code(err))
+}
@@ -0,0 +1,185 @@
+package authz
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Rule is a "p" line of a policy: subject may (or, with Deny, may not)
+// perform action on object. Object and action accept "*" as a wildcard;
+// objects also match path patterns with {param} or :param segments and a
+// trailing "/*". Actions may list alternatives separated by "|".
+type Rule struct {
+	Subject string
+	Object  string
+	Action  string
+	Deny    bool
+}
+
+// Grouping is a "g" line of a policy: Subject inherits the rules of Role.
+// Roles can themselves belong to roles.
+type Grouping struct {
+	Subject string
+	Role    string
+}
+
+// Policy is a set of rules and role groupings.
+type Policy struct {
+	Rules     []Rule
+	Groupings []Grouping
+}
+
+// LoadPolicy implements Adapter, so a policy built in code can be given to
+// NewPolicyEnforcer directly.
+func (p *Policy) LoadPolicy(_ context.Context) (*Policy, error) {
+	return p, nil
+}
+
+// Adapter loads a Policy from a storage.
+type Adapter interface {
+	LoadPolicy(ctx context.Context) (*Policy, error)
+}
+
+// PolicyEnforcer is an Enforcer evaluating a Policy loaded through an
+// Adapter. A request is allowed when a rule of the subject or one of its roles
+// matches it and no matching rule denies it.
+type PolicyEnforcer struct {
+	adapter Adapter
+
+	mu     sync.RWMutex
+	rules  map[string][]Rule
+	groups map[string][]string
+}
+
+// NewPolicyEnforcer creates a PolicyEnforcer and loads its policy from
+// adapter.
+func NewPolicyEnforcer(ctx context.Context, adapter Adapter) (*PolicyEnforcer, error) {
+	e := &PolicyEnforcer{adapter: adapter}
+	if err := e.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Reload loads the policy from the adapter again, replacing the current one
+// once it has been read successfully.
+func (e *PolicyEnforcer) Reload(ctx context.Context) error {
+	policy, err := e.adapter.LoadPolicy(ctx)
+	if err != nil {
+		return err
+	}
+
+	rules := make(map[string][]Rule)
+	for _, rule := range policy.Rules {
+		rules[rule.Subject] = append(rules[rule.Subject], rule)
+	}
+
+	groups := make(map[string][]string)
+	for _, g := range policy.Groupings {
+		groups[g.Subject] = append(groups[g.Subject], g.Role)
+	}
+
+	e.mu.Lock()
+	e.rules, e.groups = rules, groups
+	e.mu.Unlock()
+
+	return nil
+}
+
+// Enforce implements Enforcer.
+func (e *PolicyEnforcer) Enforce(_ context.Context, subject, object, action string) (bool, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	allowed := false
+	for _, sub := range e.subjects(subject) {
+		for _, rule := range e.rules[sub] {
+			if !matchObject(rule.Object, object) || !matchAction(rule.Action, action) {
+				continue
+			}
+			if rule.Deny {
+				return false, nil
+			}
+			allowed = true
+		}
+	}
+
+	return allowed, nil
+}
+
+// subjects returns subject, every role it belongs to directly or through
+// other roles, and the "*" subject.
+func (e *PolicyEnforcer) subjects(subject string) []string {
+	seen := map[string]bool{subject: true}
+	subjects := []string{subject}
+	for i := 0; i < len(subjects); i++ {
+		for _, role := range e.groups[subjects[i]] {
+			if !seen[role] {
+				seen[role] = true
+				subjects = append(subjects, role)
+			}
+		}
+	}
+
+	if !seen["*"] {
+		subjects = append(subjects, "*")
+	}
+
+	return subjects
+}
+
+func matchAction(pattern, action string) bool {
+	for _, p := range strings.Split(pattern, "|") {
+		p = strings.TrimSpace(p)
+		if p == "*" || strings.EqualFold(p, action) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchObject(pattern, object string) bool {
+	if pattern == "*" || pattern == object {
+		return true
+	}
+
+	if strings.HasSuffix(pattern, "/*") {
+		prefix := strings.TrimSuffix(pattern, "/*")
+		if object == prefix || strings.HasPrefix(object, prefix+"/") {
+			return true
+		}
+		return matchSegments(prefix, object, true)
+	}
+
+	return matchSegments(pattern, object, false)
+}
+
+// matchSegments matches object against a path pattern whose {param} and
+// :param segments match any single segment. With prefix, object may have more
+// segments than pattern.
+func matchSegments(pattern, object string, prefix bool) bool {
+	ps := strings.Split(strings.Trim(pattern, "/"), "/")
+	segs := strings.Split(strings.Trim(object, "/"), "/")
+	if len(segs) < len(ps) || (!prefix && len(segs) != len(ps)) {
+		return false
+	}
+
+	for i, p := range ps {
+		if isParam(p) {
+			continue
+		}
+		if p != segs[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isParam(segment string) bool {
+	return strings.HasPrefix(segment, ":") ||
+		(strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}"))
+}
@@ -0,0 +1,28 @@
+package apikit
+
+import (
+	"context"
+
+	"github.com/go-chi/chi/v5/middleware"
+	httptransport "github.com/likearthian/apikit/transport/http"
+	"github.com/likearthian/go-http/router"
+)
+
+// ReqIDFromContext returns the request id of ctx, as stored by
+// httptransport.MakeHttpRequestIDMiddleware or PopulateRequestContext, by
+// chi's RequestID middleware, or by the go-http router.
+func ReqIDFromContext(ctx context.Context) (string, bool) {
+	if id, ok := httptransport.RequestIDFromContext(ctx); ok {
+		return id, true
+	}
+
+	if id := middleware.GetReqID(ctx); id != "" {
+		return id, true
+	}
+
+	if id, ok := router.ReqIDFromContext(ctx); ok && id != "" {
+		return id, true
+	}
+
+	return "", false
+}
@@ -0,0 +1,236 @@
+// Package crud generates the endpoints creating, reading, updating, deleting
+// and listing the resources of a Repository, and mounts them on an
+// httptransport.Router:
+//
+//	eps := crud.MakeEndpoints[User, int](repo,
+//		crud.BeforeCreate[User, int](hashPassword),
+//	)
+//	crud.Mount(router, "/users", eps,
+//		crud.PageOptions(api.SortableFields("name"), api.FilterableFields("role")),
+//	)
+//
+// A QueryBuilder translates the pages requested from the List endpoint to SQL,
+// for the repositories.
+package crud
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/likearthian/apikit"
+	"github.com/likearthian/apikit/api"
+)
+
+// Repository stores the resources of type T, identified by an ID. Get,
+// Update and Delete fail with an error wrapping api.ErrNotFound for unknown
+// ids, and Create with one wrapping api.ErrConflict for duplicates, so they
+// are reported with a 404 and a 409 status.
+type Repository[T, ID any] interface {
+	Get(ctx context.Context, id ID) (T, error)
+
+	// List returns the items of page, in its order and with its filters,
+	// and the total count of the items matching the filters.
+	List(ctx context.Context, page api.PageRequest) (items []T, total int, err error)
+
+	// Create stores item, returning it as stored, such as with its
+	// generated id.
+	Create(ctx context.Context, item T) (T, error)
+
+	// Update replaces the resource id with item, returning it as stored.
+	Update(ctx context.Context, id ID, item T) (T, error)
+
+	Delete(ctx context.Context, id ID) error
+}
+
+// ByIDRequestDTO is the request of the endpoints reading and deleting a
+// resource: its id, bound from the {id} path parameter, and, for deletions
+// of Versioned resources, the version expected, from the If-Match header.
+type ByIDRequestDTO[ID any] struct {
+	ID      ID     `json:"id" path:"id" validate:"required"`
+	IfMatch string `json:"-" header:"If-Match"`
+}
+
+// UpdateRequestDTO is the request of the endpoint updating a resource: its
+// id, from the {id} path parameter, its new value, from the body, and, for
+// Versioned resources, the version expected, from the If-Match header.
+type UpdateRequestDTO[T, ID any] struct {
+	ID      ID
+	Item    T
+	IfMatch string
+}
+
+// Endpoints are the endpoints generated for a Repository. They can be
+// wrapped with middlewares, one by one, before being mounted.
+type Endpoints[T, ID any] struct {
+	Get    api.Endpoint[ByIDRequestDTO[ID], T]
+	List   api.Endpoint[api.PageRequest, apikit.BaseResponse]
+	Create api.Endpoint[T, T]
+	Update api.Endpoint[UpdateRequestDTO[T, ID], T]
+	Delete api.Endpoint[ByIDRequestDTO[ID], struct{}]
+}
+
+type endpointsOption[T, ID any] struct {
+	beforeCreate func(ctx context.Context, item T) (T, error)
+	afterCreate  func(ctx context.Context, item T) error
+	beforeUpdate func(ctx context.Context, id ID, item T) (T, error)
+	afterUpdate  func(ctx context.Context, item T) error
+	beforeDelete func(ctx context.Context, id ID) error
+	afterDelete  func(ctx context.Context, id ID) error
+}
+
+// Option sets an optional parameter for MakeEndpoints.
+type Option[T, ID any] func(opt *endpointsOption[T, ID])
+
+// BeforeCreate sets a hook called with the items to create, such as to
+// validate them or set their defaults. The item it returns is created; its
+// errors fail the call.
+func BeforeCreate[T, ID any](fn func(ctx context.Context, item T) (T, error)) Option[T, ID] {
+	return func(opt *endpointsOption[T, ID]) { opt.beforeCreate = fn }
+}
+
+// AfterCreate sets a hook called with the items created. Its errors fail
+// the call, although the item was created.
+func AfterCreate[T, ID any](fn func(ctx context.Context, item T) error) Option[T, ID] {
+	return func(opt *endpointsOption[T, ID]) { opt.afterCreate = fn }
+}
+
+// BeforeUpdate sets a hook called with the new value of the resources to
+// update. The item it returns is stored; its errors fail the call.
+func BeforeUpdate[T, ID any](fn func(ctx context.Context, id ID, item T) (T, error)) Option[T, ID] {
+	return func(opt *endpointsOption[T, ID]) { opt.beforeUpdate = fn }
+}
+
+// AfterUpdate sets a hook called with the items updated, as stored. Its
+// errors fail the call, although the item was updated.
+func AfterUpdate[T, ID any](fn func(ctx context.Context, item T) error) Option[T, ID] {
+	return func(opt *endpointsOption[T, ID]) { opt.afterUpdate = fn }
+}
+
+// BeforeDelete sets a hook called with the id of the resources to delete,
+// whose errors prevent the deletion.
+func BeforeDelete[T, ID any](fn func(ctx context.Context, id ID) error) Option[T, ID] {
+	return func(opt *endpointsOption[T, ID]) { opt.beforeDelete = fn }
+}
+
+// AfterDelete sets a hook called with the id of the resources deleted. Its
+// errors fail the call, although the resource was deleted.
+func AfterDelete[T, ID any](fn func(ctx context.Context, id ID) error) Option[T, ID] {
+	return func(opt *endpointsOption[T, ID]) { opt.afterDelete = fn }
+}
+
+// MakeEndpoints returns the Endpoints of repo. The List endpoint returns the
+// items in the BaseResponse of apikit.SuccessResponse, with their
+// pagination. The updates and deletions of Versioned resources are checked
+// against their current version, and the soft deleted SoftDeletable
+// resources are hidden from Get.
+func MakeEndpoints[T, ID any](repo Repository[T, ID], options ...Option[T, ID]) Endpoints[T, ID] {
+	var opts endpointsOption[T, ID]
+	for _, option := range options {
+		option(&opts)
+	}
+
+	var zero T
+	_, versioned := any(zero).(Versioned)
+
+	return Endpoints[T, ID]{
+		Get: func(ctx context.Context, request ByIDRequestDTO[ID]) (T, error) {
+			return get(ctx, repo, request.ID)
+		},
+
+		List: func(ctx context.Context, request api.PageRequest) (apikit.BaseResponse, error) {
+			items, total, err := repo.List(ctx, request)
+			if err != nil {
+				return apikit.BaseResponse{}, err
+			}
+			if items == nil {
+				items = []T{}
+			}
+
+			reqid, _ := apikit.ReqIDFromContext(ctx)
+			return apikit.SuccessResponse(reqid, items, apikit.NewPaginationDTO(request, total)), nil
+		},
+
+		Create: func(ctx context.Context, item T) (T, error) {
+			var err error
+			if opts.beforeCreate != nil {
+				if item, err = opts.beforeCreate(ctx, item); err != nil {
+					return item, err
+				}
+			}
+
+			if item, err = repo.Create(ctx, item); err != nil {
+				return item, err
+			}
+
+			if opts.afterCreate != nil {
+				err = opts.afterCreate(ctx, item)
+			}
+			return item, err
+		},
+
+		Update: func(ctx context.Context, request UpdateRequestDTO[T, ID]) (T, error) {
+			item := request.Item
+
+			var err error
+			if versioned {
+				if ctx, err = checkVersion(ctx, repo, request.ID, request.IfMatch, &item); err != nil {
+					return item, err
+				}
+			}
+
+			if opts.beforeUpdate != nil {
+				if item, err = opts.beforeUpdate(ctx, request.ID, item); err != nil {
+					return item, err
+				}
+			}
+
+			if item, err = repo.Update(ctx, request.ID, item); err != nil {
+				return item, versionError(err)
+			}
+
+			if opts.afterUpdate != nil {
+				err = opts.afterUpdate(ctx, item)
+			}
+			return item, err
+		},
+
+		Delete: func(ctx context.Context, request ByIDRequestDTO[ID]) (struct{}, error) {
+			if versioned && request.IfMatch != "" {
+				var err error
+				if ctx, err = checkVersion[T](ctx, repo, request.ID, request.IfMatch, nil); err != nil {
+					return struct{}{}, err
+				}
+			}
+
+			if opts.beforeDelete != nil {
+				if err := opts.beforeDelete(ctx, request.ID); err != nil {
+					return struct{}{}, err
+				}
+			}
+
+			if err := repo.Delete(ctx, request.ID); err != nil {
+				return struct{}{}, versionError(err)
+			}
+
+			if opts.afterDelete != nil {
+				return struct{}{}, opts.afterDelete(ctx, request.ID)
+			}
+			return struct{}{}, nil
+		},
+	}
+}
+
+// get returns the resource id, failing with api.ErrNotFound when it is soft
+// deleted and the request doesn't include deleted resources.
+func get[T, ID any](ctx context.Context, repo Repository[T, ID], id ID) (T, error) {
+	item, err := repo.Get(ctx, id)
+	if err != nil {
+		return item, err
+	}
+
+	if d, ok := any(item).(SoftDeletable); ok && d.Deleted() && !IncludeDeleted(ctx) {
+		var empty T
+		return empty, fmt.Errorf("%w: resource was deleted", api.ErrNotFound)
+	}
+	return item, nil
+}
@@ -0,0 +1,174 @@
+package crud
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/likearthian/apikit"
+	"github.com/likearthian/apikit/api"
+	httptransport "github.com/likearthian/apikit/transport/http"
+)
+
+// Identifier is implemented by the resources knowing their id, so the
+// responses of their creation carry a Location header.
+type Identifier interface {
+	ResourceID() string
+}
+
+type mountOption struct {
+	page       []api.PageOption
+	server     []httptransport.ServerOption
+	softDelete bool
+	allow      func(ctx context.Context) bool
+}
+
+// MountOption sets an optional parameter for Mount.
+type MountOption func(opt *mountOption)
+
+// PageOptions sets the options parsing the pages requested from the List
+// endpoint, such as the fields it can be sorted by.
+func PageOptions(options ...api.PageOption) MountOption {
+	return func(opt *mountOption) { opt.page = append(opt.page, options...) }
+}
+
+// ServerOptions sets options of the Servers of the endpoints, applied after
+// the defaults of Mount, which they can override.
+func ServerOptions(options ...httptransport.ServerOption) MountOption {
+	return func(opt *mountOption) { opt.server = append(opt.server, options...) }
+}
+
+// SoftDelete parses the include_deleted query flag of the requests, for
+// IncludeDeleted, which is only set when allow, unless nil, accepts the
+// caller, such as an administrator, once authenticated.
+func SoftDelete(allow func(ctx context.Context) bool) MountOption {
+	return func(opt *mountOption) {
+		opt.softDelete = true
+		opt.allow = allow
+	}
+}
+
+// Mount mounts the endpoints of e on r below pattern, such as "/users":
+//
+//	GET    /users       List, with the page parsed by api.ParsePageRequest
+//	POST   /users       Create, answering 201 Created
+//	GET    /users/{id}  Get
+//	PUT    /users/{id}  Update
+//	DELETE /users/{id}  Delete, answering 204 No Content
+//
+// Responses are written in the envelope of
+// apikit.MakeJSONEnvelopeResponseEncoder, and errors with
+// apikit.JSONErrorEncoder. Versioned resources are sent with their version
+// in the ETag header, and the If-Match header of their updates and
+// deletions is checked.
+func Mount[T, ID any](r *httptransport.Router, pattern string, e Endpoints[T, ID], options ...MountOption) {
+	var opts mountOption
+	for _, option := range options {
+		option(&opts)
+	}
+
+	server := []httptransport.ServerOption{
+		httptransport.ServerErrorEncoder(apikit.JSONErrorEncoder),
+	}
+	if opts.softDelete {
+		server = append(server, httptransport.ServerBefore(includeDeletedIntoContext(opts.allow)))
+	}
+	server = append(server, opts.server...)
+
+	collection := strings.TrimSuffix(pattern, "/")
+	if collection == "" {
+		collection = "/"
+	}
+	item := strings.TrimSuffix(pattern, "/") + "/{id}"
+
+	httptransport.Route(r, http.MethodGet, collection, httptransport.NewServer(
+		e.List,
+		httptransport.MakePageRequestDecoder(opts.page...),
+		apikit.MakeJSONEnvelopeResponseEncoder[apikit.BaseResponse](),
+		server...,
+	))
+
+	create := api.MapResponse[T](func(ctx context.Context, item T) (httptransport.CreatedResponse[T], error) {
+		var location string
+		if id, ok := any(item).(Identifier); ok {
+			location = strings.TrimSuffix(requestPath(ctx), "/") + "/" + id.ResourceID()
+		}
+		return httptransport.Created(location, item), nil
+	})(e.Create)
+	httptransport.Route(r, http.MethodPost, collection, httptransport.NewServer(
+		create,
+		httptransport.CommonPostRequestDecoder[T],
+		versionedCreatedEncoder(apikit.MakeJSONEnvelopeResponseEncoder[httptransport.CreatedResponse[T]]()),
+		server...,
+	))
+
+	httptransport.Route(r, http.MethodGet, item, httptransport.NewServer(
+		e.Get,
+		httptransport.BindRequest[ByIDRequestDTO[ID]],
+		versionedEncoder(apikit.MakeJSONEnvelopeResponseEncoder[T]()),
+		server...,
+	))
+
+	httptransport.Route(r, http.MethodPut, item, httptransport.NewServer(
+		e.Update,
+		decodeUpdateRequest[T, ID],
+		versionedEncoder(apikit.MakeJSONEnvelopeResponseEncoder[T]()),
+		server...,
+	))
+
+	remove := api.MapResponse[ByIDRequestDTO[ID]](func(context.Context, struct{}) (httptransport.NoContent, error) {
+		return httptransport.NoContent{}, nil
+	})(e.Delete)
+	httptransport.Route(r, http.MethodDelete, item, httptransport.NewServer(
+		remove,
+		httptransport.BindRequest[ByIDRequestDTO[ID]],
+		apikit.MakeJSONEnvelopeResponseEncoder[httptransport.NoContent](),
+		server...,
+	))
+}
+
+// decodeUpdateRequest binds the id of the path, then decodes the item from
+// the body.
+func decodeUpdateRequest[T, ID any](ctx context.Context, r *http.Request) (UpdateRequestDTO[T, ID], error) {
+	var request UpdateRequestDTO[T, ID]
+
+	// the body is left for the item
+	idReq := *r
+	idReq.Body = http.NoBody
+	byID, err := httptransport.BindRequest[ByIDRequestDTO[ID]](ctx, &idReq)
+	if err != nil {
+		return request, err
+	}
+	request.ID = byID.ID
+	request.IfMatch = r.Header.Get("If-Match")
+
+	request.Item, err = httptransport.CommonPostRequestDecoder[T](ctx, r)
+	return request, err
+}
+
+func requestPath(ctx context.Context) string {
+	path, _ := ctx.Value(httptransport.ContextKeyRequestPath).(string)
+	return path
+}
+
+// versionedEncoder sets the ETag header of the Versioned responses before
+// encoding them with enc.
+func versionedEncoder[T any](enc httptransport.EncodeResponseFunc[T]) httptransport.EncodeResponseFunc[T] {
+	return func(ctx context.Context, w http.ResponseWriter, response T) error {
+		setETag(w, response)
+		return enc(ctx, w, response)
+	}
+}
+
+func versionedCreatedEncoder[T any](enc httptransport.EncodeResponseFunc[httptransport.CreatedResponse[T]]) httptransport.EncodeResponseFunc[httptransport.CreatedResponse[T]] {
+	return func(ctx context.Context, w http.ResponseWriter, response httptransport.CreatedResponse[T]) error {
+		setETag(w, response.Value)
+		return enc(ctx, w, response)
+	}
+}
+
+func setETag(w http.ResponseWriter, response interface{}) {
+	if v, ok := response.(Versioned); ok && v.ResourceVersion() != "" {
+		w.Header().Set(httptransport.HeaderETag, `"`+v.ResourceVersion()+`"`)
+	}
+}
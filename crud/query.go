@@ -0,0 +1,274 @@
+package crud
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/internal/storeutil"
+)
+
+// likeEscaper escapes the wildcards of the values of FilterLike, with the
+// '!' escape character, which unlike '\' needs no escaping in the string
+// literals of any database.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+type column struct {
+	name  string
+	ops   map[api.FilterOp]bool
+	parse func(value string) (interface{}, error)
+}
+
+type queryOption struct {
+	columns    map[string]*column
+	ph         storeutil.Placeholders
+	softDelete string
+}
+
+// QueryOption sets an optional parameter for NewQueryBuilder.
+type QueryOption func(opt *queryOption)
+
+// Column allows the sorts and filters on field, a field of api.PageRequest,
+// translated to the column name, with the operators ops, or all of them when
+// none is given. Fields not allowed by a Column are rejected.
+func Column(field, name string, ops ...api.FilterOp) QueryOption {
+	return func(opt *queryOption) {
+		c := opt.column(field)
+		c.name = name
+		if len(ops) > 0 {
+			c.ops = make(map[api.FilterOp]bool)
+			for _, op := range ops {
+				c.ops[op] = true
+			}
+		}
+	}
+}
+
+// ColumnValue sets the function converting the filter values of field to
+// the type of its column, such as strconv.Atoi for integers. Values it
+// fails to convert are rejected. By default, values are passed as strings.
+func ColumnValue(field string, parse func(value string) (interface{}, error)) QueryOption {
+	return func(opt *queryOption) { opt.column(field).parse = parse }
+}
+
+// QueryDollarPlaceholders makes the queries use $1, $2... placeholders, as
+// required by PostgreSQL drivers, instead of ?.
+func QueryDollarPlaceholders() QueryOption {
+	return func(opt *queryOption) { opt.ph.Dollar = true }
+}
+
+// SoftDeleteColumn sets the column marking the soft deleted rows, such as
+// deleted_at, which BuildContext excludes unless the request includes
+// deleted resources.
+func SoftDeleteColumn(name string) QueryOption {
+	return func(opt *queryOption) { opt.softDelete = name }
+}
+
+func (opt *queryOption) column(field string) *column {
+	c, ok := opt.columns[field]
+	if !ok {
+		c = &column{name: field}
+		opt.columns[field] = c
+	}
+	return c
+}
+
+// QueryBuilder translates the sorts, filters and page of api.PageRequests to
+// SQL, only for the fields and operators it allows, so the filter syntax of
+// the clients reaches the database safely: columns are never taken from the
+// request, and values are always passed as arguments.
+type QueryBuilder struct {
+	opts *queryOption
+}
+
+// NewQueryBuilder creates a QueryBuilder allowing the fields of its Column
+// options.
+func NewQueryBuilder(options ...QueryOption) (*QueryBuilder, error) {
+	opts := &queryOption{columns: make(map[string]*column)}
+	for _, option := range options {
+		option(opts)
+	}
+
+	for field, c := range opts.columns {
+		if !storeutil.ValidIdentifier(c.name) {
+			return nil, fmt.Errorf("invalid column name %q for field %q", c.name, field)
+		}
+	}
+	if opts.softDelete != "" && !storeutil.ValidIdentifier(opts.softDelete) {
+		return nil, fmt.Errorf("invalid column name %q", opts.softDelete)
+	}
+
+	return &QueryBuilder{opts: opts}, nil
+}
+
+// Query is the SQL translation of an api.PageRequest. Where and OrderBy are
+// empty without filters or sorts. With GORM, it applies as:
+//
+//	db.Where(q.Where, q.Args...).Order(q.OrderBy).Limit(q.Limit).Offset(q.Offset)
+//
+// and with squirrel, as sq.Expr(q.Where, q.Args...).
+type Query struct {
+	Where   string
+	Args    []interface{}
+	OrderBy string
+	Limit   int
+	Offset  int
+}
+
+// Build translates page. Sorts and filters on fields or with operators which
+// are not allowed, and values which can't be converted, are reported as a
+// *api.ValidationError.
+func (b *QueryBuilder) Build(page api.PageRequest) (Query, error) {
+	q := Query{Limit: page.Limit(), Offset: page.Offset()}
+	verr := api.NewValidationError()
+
+	var order []string
+	for _, s := range page.Sort {
+		c, ok := b.opts.columns[s.Field]
+		if !ok {
+			verr.AddCode("sort", "not_allowed", fmt.Sprintf("cannot sort by %q", s.Field))
+			continue
+		}
+
+		if s.Desc {
+			order = append(order, c.name+" DESC")
+		} else {
+			order = append(order, c.name)
+		}
+	}
+	q.OrderBy = strings.Join(order, ", ")
+
+	var conds []string
+	for _, f := range page.Filters {
+		key := "filter[" + f.Field + "]"
+
+		c, ok := b.opts.columns[f.Field]
+		if !ok {
+			verr.AddCode(key, "not_allowed", fmt.Sprintf("cannot filter on %q", f.Field))
+			continue
+		}
+		if c.ops != nil && !c.ops[f.Op] {
+			verr.AddCode(key, "not_allowed", fmt.Sprintf("cannot filter on %q with %q", f.Field, f.Op))
+			continue
+		}
+
+		cond, err := b.condition(c, f, &q.Args)
+		if err != nil {
+			verr.AddCode(key, "invalid", err.Error())
+			continue
+		}
+		conds = append(conds, cond)
+	}
+	q.Where = strings.Join(conds, " AND ")
+
+	if verr.HasErrors() {
+		return Query{}, verr
+	}
+	return q, nil
+}
+
+// BuildContext is Build, excluding the soft deleted rows, whose
+// SoftDeleteColumn is set, unless IncludeDeleted(ctx).
+func (b *QueryBuilder) BuildContext(ctx context.Context, page api.PageRequest) (Query, error) {
+	q, err := b.Build(page)
+	if err != nil || b.opts.softDelete == "" || IncludeDeleted(ctx) {
+		return q, err
+	}
+
+	cond := b.opts.softDelete + " IS NULL"
+	if q.Where != "" {
+		cond += " AND " + q.Where
+	}
+	q.Where = cond
+	return q, nil
+}
+
+func (b *QueryBuilder) condition(c *column, f api.Filter, args *[]interface{}) (string, error) {
+	switch f.Op {
+	case api.FilterIn:
+		if len(f.Values) == 0 {
+			return "", fmt.Errorf("no values")
+		}
+
+		ps := make([]string, len(f.Values))
+		for i, v := range f.Values {
+			p, err := b.arg(c, v, args)
+			if err != nil {
+				return "", err
+			}
+			ps[i] = p
+		}
+		return c.name + " IN (" + strings.Join(ps, ", ") + ")", nil
+
+	case api.FilterLike:
+		*args = append(*args, "%"+likeEscaper.Replace(f.Value)+"%")
+		return c.name + " LIKE " + b.opts.ph.Nth(len(*args)) + " ESCAPE '!'", nil
+	}
+
+	p, err := b.arg(c, f.Value, args)
+	if err != nil {
+		return "", err
+	}
+
+	switch f.Op {
+	case api.FilterEq:
+		return c.name + " = " + p, nil
+	case api.FilterNe:
+		return c.name + " <> " + p, nil
+	case api.FilterGt:
+		return c.name + " > " + p, nil
+	case api.FilterGte:
+		return c.name + " >= " + p, nil
+	case api.FilterLt:
+		return c.name + " < " + p, nil
+	case api.FilterLte:
+		return c.name + " <= " + p, nil
+	}
+	return "", fmt.Errorf("invalid operator %q", f.Op)
+}
+
+// arg appends the converted value to args, and returns its placeholder.
+func (b *QueryBuilder) arg(c *column, value string, args *[]interface{}) (string, error) {
+	var arg interface{} = value
+	if c.parse != nil {
+		var err error
+		if arg, err = c.parse(value); err != nil {
+			return "", fmt.Errorf("invalid value %q", value)
+		}
+	}
+
+	*args = append(*args, arg)
+	return b.opts.ph.Nth(len(*args)), nil
+}
+
+// SQL appends the clauses of q to base, a query such as
+// "SELECT id, name FROM users", with its Args. Its LIMIT clause is left out
+// when Limit is 0.
+func (q Query) SQL(base string) string {
+	var sb strings.Builder
+	sb.WriteString(base)
+	if q.Where != "" {
+		sb.WriteString(" WHERE " + q.Where)
+	}
+	if q.OrderBy != "" {
+		sb.WriteString(" ORDER BY " + q.OrderBy)
+	}
+	if q.Limit > 0 {
+		sb.WriteString(" LIMIT " + strconv.Itoa(q.Limit))
+		if q.Offset > 0 {
+			sb.WriteString(" OFFSET " + strconv.Itoa(q.Offset))
+		}
+	}
+	return sb.String()
+}
+
+// CountSQL appends the WHERE clause of q to base, a query such as
+// "SELECT COUNT(*) FROM users", counting the total of a page, with its Args.
+func (q Query) CountSQL(base string) string {
+	if q.Where == "" {
+		return base
+	}
+	return base + " WHERE " + q.Where
+}
@@ -0,0 +1,49 @@
+package crud
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// SoftDeletable is implemented by the resources deleted by marking them,
+// such as by setting their deleted_at column, rather than by removing them.
+// The Get endpoint answers 404 for those marked deleted, unless the request
+// includes deleted resources.
+type SoftDeletable interface {
+	Deleted() bool
+}
+
+// includeDeleted is the include_deleted flag of a request, and the function
+// allowing the caller to set it.
+type includeDeleted struct {
+	requested bool
+	allow     func(ctx context.Context) bool
+}
+
+// IncludeDeleted reports whether the request asked to include the soft
+// deleted resources, with its include_deleted query flag, and is allowed to.
+// Repositories of SoftDeletable resources check it in their Get and List,
+// as does QueryBuilder.BuildContext.
+func IncludeDeleted(ctx context.Context) bool {
+	flag, ok := ctx.Value(contextKeyIncludeDeleted).(includeDeleted)
+	if !ok || !flag.requested {
+		return false
+	}
+	return flag.allow == nil || flag.allow(ctx)
+}
+
+// WithIncludeDeleted returns a context including the soft deleted resources,
+// such as for internal calls of the repositories.
+func WithIncludeDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKeyIncludeDeleted, includeDeleted{requested: true})
+}
+
+// includeDeletedIntoContext returns a RequestFunc storing the include_deleted
+// query flag of the requests, which allow, unless nil, must accept.
+func includeDeletedIntoContext(allow func(ctx context.Context) bool) func(ctx context.Context, r *http.Request) context.Context {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		requested, _ := strconv.ParseBool(r.URL.Query().Get("include_deleted"))
+		return context.WithValue(ctx, contextKeyIncludeDeleted, includeDeleted{requested: requested, allow: allow})
+	}
+}
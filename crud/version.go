@@ -0,0 +1,94 @@
+package crud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/apierror"
+)
+
+// ErrVersionConflict is returned by the repositories whose Update or Delete
+// found the resource at another version than the expected one, such as
+// when an UPDATE ... WHERE version = ? changed no row. It wraps
+// api.ErrConflict.
+var ErrVersionConflict = fmt.Errorf("%w: version conflict", api.ErrConflict)
+
+// Versioned is implemented by the resources carrying a version, such as a
+// revision number or an updated_at timestamp, for optimistic concurrency:
+// their version is sent in the ETag header, and their updates and deletions
+// are rejected with a 409 status when the version given in the If-Match
+// header, or in the item sent, is no longer current.
+type Versioned interface {
+	ResourceVersion() string
+}
+
+type contextKey int
+
+const (
+	contextKeyExpectedVersion contextKey = iota
+	contextKeyIncludeDeleted
+)
+
+// ExpectedVersion returns the version a resource must be at for the update
+// or deletion in progress to apply, so repositories can check it atomically.
+// It is only set for Versioned resources when the client gave one.
+func ExpectedVersion(ctx context.Context) (string, bool) {
+	version, ok := ctx.Value(contextKeyExpectedVersion).(string)
+	return version, ok
+}
+
+// checkVersion compares the current version of the resource id to expected,
+// the If-Match header of the request, or the version of the item sent. It
+// returns the context passing the version to the repository.
+func checkVersion[T, ID any](ctx context.Context, repo Repository[T, ID], id ID, ifMatch string, item *T) (context.Context, error) {
+	expected := parseIfMatch(ifMatch)
+	if expected == "*" {
+		return ctx, nil
+	}
+	if expected == "" && item != nil {
+		if v, ok := any(*item).(Versioned); ok {
+			expected = v.ResourceVersion()
+		}
+	}
+
+	current, err := get(ctx, repo, id)
+	if err != nil {
+		return ctx, err
+	}
+	v, ok := any(current).(Versioned)
+	if !ok || expected == "" {
+		return ctx, nil
+	}
+
+	if v.ResourceVersion() != expected {
+		return ctx, versionConflict(v.ResourceVersion())
+	}
+	return context.WithValue(ctx, contextKeyExpectedVersion, expected), nil
+}
+
+// versionError reports the ErrVersionConflict of a repository with the
+// typed error of checkVersion.
+func versionError(err error) error {
+	if errors.Is(err, ErrVersionConflict) {
+		return versionConflict("").WithCause(err)
+	}
+	return err
+}
+
+func versionConflict(current string) *apierror.Error {
+	err := apierror.Conflict("the resource was modified by another request")
+	if current != "" {
+		err = err.WithDetail("current_version", current)
+	}
+	return err
+}
+
+// parseIfMatch returns the first entity tag of an If-Match header, unquoted.
+func parseIfMatch(header string) string {
+	tag, _, _ := strings.Cut(header, ",")
+	tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+	return strings.Trim(tag, `"`)
+}
@@ -0,0 +1,225 @@
+package downloads
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	httptransport "github.com/likearthian/apikit/transport/http"
+)
+
+// ErrInvalidLink is returned for download links that are malformed, were not
+// signed by the Signer, or were issued for another audience.
+var ErrInvalidLink = errors.New("invalid download link")
+
+// ErrLinkExpired is returned for download links past their expiry.
+var ErrLinkExpired = errors.New("download link expired")
+
+// LinkError is returned by the Decoder of a Signer for rejected links. It
+// reports a 410 status code for ErrLinkExpired and a 403 status code
+// otherwise.
+type LinkError struct {
+	Err error
+}
+
+func (e *LinkError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *LinkError) Unwrap() error {
+	return e.Err
+}
+
+func (e *LinkError) StatusCode() int {
+	if errors.Is(e.Err, ErrLinkExpired) {
+		return http.StatusGone
+	}
+	return http.StatusForbidden
+}
+
+// Signer mints and verifies download links: URLs carrying a descriptor, made
+// of a file id and an expiry signed with HMAC-SHA256, and the audience the
+// link was issued for, in the `descriptor` and `aud` query parameters of
+// httptransport.GetFileRequestDTO.
+type Signer struct {
+	secret  []byte
+	trusted httptransport.TrustedProxies
+	now     func() time.Time
+}
+
+type signerOption struct {
+	trustedProxies []string
+}
+
+// SignerOption sets an optional parameter for NewSigner.
+type SignerOption func(opt *signerOption)
+
+// SignerTrustedProxies sets the reverse proxies, given as IPs or CIDR ranges,
+// whose X-Forwarded-Proto and X-Forwarded-Host headers are honored by Link.
+// By default, the headers, which any client can set, are ignored.
+func SignerTrustedProxies(proxies ...string) SignerOption {
+	return func(opt *signerOption) { opt.trustedProxies = proxies }
+}
+
+// NewSigner creates a Signer using secret as HMAC key. The secret should be
+// at least 32 random bytes, shared by every instance serving the links. It
+// panics when a trusted proxy is invalid.
+func NewSigner(secret []byte, options ...SignerOption) *Signer {
+	var opts signerOption
+	for _, option := range options {
+		option(&opts)
+	}
+
+	trusted, err := httptransport.ParseTrustedProxies(opts.trustedProxies...)
+	if err != nil {
+		panic(err)
+	}
+
+	return &Signer{secret: secret, trusted: trusted, now: time.Now}
+}
+
+// Descriptor returns the signed descriptor of fileID for audience, valid for
+// ttl.
+func (s *Signer) Descriptor(fileID, audience string, ttl time.Duration) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fileID)) + "." +
+		strconv.FormatInt(s.now().Add(ttl).Unix(), 10)
+
+	return payload + "." + s.sign(payload, audience)
+}
+
+// Verify checks the signature and expiry of descriptor for audience and
+// returns the file it describes.
+func (s *Signer) Verify(descriptor, audience string) (*httptransport.FileDescriptor, error) {
+	i := strings.LastIndexByte(descriptor, '.')
+	if i < 0 {
+		return nil, ErrInvalidLink
+	}
+	payload, sig := descriptor[:i], descriptor[i+1:]
+
+	if !hmac.Equal([]byte(sig), []byte(s.sign(payload, audience))) {
+		return nil, ErrInvalidLink
+	}
+
+	id, expiry, ok := strings.Cut(payload, ".")
+	if !ok {
+		return nil, ErrInvalidLink
+	}
+
+	fileID, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return nil, ErrInvalidLink
+	}
+
+	exp, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidLink
+	}
+	if s.now().Unix() > exp {
+		return nil, ErrLinkExpired
+	}
+
+	return &httptransport.FileDescriptor{FileID: string(fileID), Expiry: exp}, nil
+}
+
+// URL returns the download link of fileID for audience, valid for ttl, below
+// endpoint (e.g. "https://api.example.com/files/download").
+func (s *Signer) URL(endpoint, fileID, audience string, ttl time.Duration) string {
+	query := url.Values{"descriptor": {s.Descriptor(fileID, audience, ttl)}}
+	if audience != "" {
+		query.Set("aud", audience)
+	}
+
+	sep := "?"
+	if strings.Contains(endpoint, "?") {
+		sep = "&"
+	}
+
+	return endpoint + sep + query.Encode()
+}
+
+// Link returns a DownloadLinkDTO for fileID, pointing at path on the host the
+// current request r was sent to, as seen by the client behind the proxies set
+// with SignerTrustedProxies.
+func (s *Signer) Link(r *http.Request, path, fileID, audience string, ttl time.Duration) httptransport.DownloadLinkDTO {
+	base := BaseURL(r)
+	if s.trusted.Trusts(r.RemoteAddr) {
+		base = forwardedBaseURL(r)
+	}
+
+	return httptransport.DownloadLinkDTO{
+		Url: s.URL(base+"/"+strings.TrimPrefix(path, "/"), fileID, audience, ttl),
+	}
+}
+
+// Decoder returns a DecodeRequestFunc decoding the GetFileRequestDTO of a
+// download link and verifying it for audience, the audience the links served
+// by the endpoint are issued for. The aud query parameter, which the client
+// controls, is ignored, so links issued for other audiences by the same
+// Signer are rejected. Rejected links fail with a *LinkError.
+func (s *Signer) Decoder(audience string) httptransport.DecodeRequestFunc[*httptransport.FileDescriptor] {
+	return func(ctx context.Context, r *http.Request) (*httptransport.FileDescriptor, error) {
+		req, err := httptransport.CommonGetRequestDecoder[httptransport.GetFileRequestDTO](ctx, r)
+		if err != nil {
+			return nil, err
+		}
+
+		fd, err := s.Verify(req.Descriptor, audience)
+		if err != nil {
+			return nil, &LinkError{Err: err}
+		}
+
+		return fd, nil
+	}
+}
+
+// BaseURL returns the scheme and host r was received on. The X-Forwarded-Proto
+// and X-Forwarded-Host headers are ignored; links are only built from them
+// for the requests of the proxies set with SignerTrustedProxies.
+func BaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
+
+// forwardedBaseURL returns the scheme and host the client sent r to, honoring
+// the X-Forwarded-Proto and X-Forwarded-Host headers set by reverse proxies.
+func forwardedBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := forwarded(r.Header.Get("X-Forwarded-Proto")); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+
+	host := r.Host
+	if fh := forwarded(r.Header.Get("X-Forwarded-Host")); fh != "" {
+		host = fh
+	}
+
+	return scheme + "://" + host
+}
+
+// forwarded returns the first value of a comma separated forwarded header,
+// the one set by the proxy closest to the client.
+func forwarded(value string) string {
+	first, _, _ := strings.Cut(value, ",")
+	return strings.TrimSpace(first)
+}
+
+func (s *Signer) sign(payload, audience string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%s", payload, audience)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
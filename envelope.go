@@ -0,0 +1,132 @@
+package apikit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	httptransport "github.com/likearthian/apikit/transport/http"
+)
+
+// EnvelopePolicy decides whether MakeJSONEnvelopeResponseEncoder wraps the
+// responses in a BaseResponse.
+type EnvelopePolicy int
+
+const (
+	// EnvelopeAlways wraps every response, but RawResponses.
+	EnvelopeAlways EnvelopePolicy = iota
+
+	// EnvelopeNever sends the responses as they are.
+	EnvelopeNever
+
+	// EnvelopeNegotiated wraps the responses unless the request disables
+	// it, with an X-Envelope header of false, as captured by
+	// EnvelopeIntoContext.
+	EnvelopeNegotiated
+)
+
+// HeaderEnvelope is the request header negotiating the envelope of the
+// response with EnvelopeNegotiated.
+const HeaderEnvelope = "X-Envelope"
+
+type contextKey int
+
+const contextKeyEnvelope contextKey = iota
+
+// EnvelopeIntoContext is an httptransport.RequestFunc capturing the
+// X-Envelope header of the request, for EnvelopeNegotiated.
+func EnvelopeIntoContext(ctx context.Context, r *http.Request) context.Context {
+	v := r.Header.Get(HeaderEnvelope)
+	if v == "" {
+		return ctx
+	}
+
+	wrap, err := strconv.ParseBool(v)
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKeyEnvelope, wrap)
+}
+
+// RawResponse is a response sent as is, without envelope, whatever the
+// policy: its Value is encoded in place of the RawResponse, by any JSON
+// encoder. It suits the responses whose format is imposed by a third
+// party, such as the echo of a webhook challenge.
+type RawResponse[T any] struct {
+	Value T
+}
+
+// Raw returns the RawResponse of v.
+func Raw[T any](v T) RawResponse[T] {
+	return RawResponse[T]{Value: v}
+}
+
+// MarshalJSON encodes the value of the response.
+func (r RawResponse[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Value)
+}
+
+func (r RawResponse[T]) raw() {}
+
+// rawResponse is implemented by RawResponse, whatever its type parameter.
+type rawResponse interface {
+	raw()
+}
+
+// WithEnvelopePolicy sets when MakeJSONEnvelopeResponseEncoder wraps the
+// responses. Defaults to EnvelopeAlways.
+func WithEnvelopePolicy(policy EnvelopePolicy) EnvelopeOption {
+	return func(opt *envelopeOption) { opt.policy = policy }
+}
+
+// MakeJSONEnvelopeResponseEncoder returns an http EncodeResponseFunc writing
+// the responses as JSON, wrapped in the BaseResponse of SuccessResponse,
+// with the request id from ReqIDFromContext, as the policy of the encoder
+// decides. Responses which already are a BaseResponse or a PagedResponse,
+// and RawResponses, are never wrapped again. The status and headers of
+// responses implementing httptransport.StatusCoder and Headerer, such as
+// httptransport.CreatedResponse, are honored.
+func MakeJSONEnvelopeResponseEncoder[T any](options ...EnvelopeOption) httptransport.EncodeResponseFunc[T] {
+	opts := &envelopeOption{policy: EnvelopeAlways}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, response T) error {
+		if !wrapResponse(ctx, opts.policy, response) {
+			return httptransport.CommonJSONResponseEncoder(ctx, w, response)
+		}
+
+		// the envelope hides the status and headers of the response
+		code := httptransport.ResponseStatus(w, response)
+		if code == http.StatusNoContent {
+			w.WriteHeader(code)
+			return nil
+		}
+
+		reqid, _ := ReqIDFromContext(ctx)
+		envelope := SuccessResponse(reqid, response)
+		if code != http.StatusOK {
+			return httptransport.EncodeJSONWithStatus(ctx, w, code, envelope)
+		}
+		return httptransport.CommonJSONResponseEncoder(ctx, w, envelope)
+	}
+}
+
+func wrapResponse(ctx context.Context, policy EnvelopePolicy, response interface{}) bool {
+	switch response.(type) {
+	case rawResponse, BaseResponse, *BaseResponse, PagedResponse, *PagedResponse:
+		return false
+	}
+
+	switch policy {
+	case EnvelopeNever:
+		return false
+	case EnvelopeNegotiated:
+		wrap, ok := ctx.Value(contextKeyEnvelope).(bool)
+		return !ok || wrap
+	default:
+		return true
+	}
+}
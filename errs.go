@@ -3,45 +3,97 @@ package apikit
 import (
 	"errors"
 	"net/http"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/apierror"
 )
 
 var ErrBucketNotFound = errors.New("bucket not found")
 var ErrKeyAlreadyExists = errors.New("key already exists")
 var ErrKeynotFound = errors.New("key not found")
-var ErrBadRequest = errors.New("bad request")
+var ErrBadRequest = api.ErrBadRequest
 var ErrInvalidUserPassword = errors.New("invalid user or password")
-var ErrForbidden = errors.New("not authorized to access this resource")
-var ErrUnauthorized = errors.New("unauthorized")
+var ErrForbidden = api.ErrForbidden
+var ErrNotFound = api.ErrNotFound
+var ErrConflict = api.ErrConflict
+var ErrUnavailable = api.ErrUnavailable
+var ErrUnauthorized = api.ErrUnauthorized
 var ErrNoRow = errors.New("no row")
+var ErrTooManyRequests = api.ErrTooManyRequests
+var ErrCircuitOpen = api.ErrCircuitOpen
+var ErrRequestTooLarge = api.ErrRequestTooLarge
+var ErrTimeout = api.ErrTimeout
+var ErrIdempotencyInFlight = api.ErrIdempotencyInFlight
+var ErrIdempotencyKeyReused = api.ErrIdempotencyKeyReused
+var ErrUploadRejected = api.ErrUploadRejected
 
 var (
 	// ErrTokenContextMissing denotes a token was not passed into the parsing
 	// middleware's context.
-	ErrTokenContextMissing = errors.New("token up for parsing was not passed through the context")
+	ErrTokenContextMissing = api.ErrTokenContextMissing
 
 	// ErrTokenInvalid denotes a token was not able to be validated.
-	ErrTokenInvalid = errors.New("JWT Token was invalid")
+	ErrTokenInvalid = api.ErrTokenInvalid
 
 	// ErrTokenExpired denotes a token's expire header (exp) has since passed.
-	ErrTokenExpired = errors.New("JWT Token is expired")
+	ErrTokenExpired = api.ErrTokenExpired
 
 	// ErrTokenMalformed denotes a token was not formatted as a JWT token.
-	ErrTokenMalformed = errors.New("JWT Token is malformed")
+	ErrTokenMalformed = api.ErrTokenMalformed
 
 	// ErrTokenNotActive denotes a token's not before header (nbf) is in the
 	// future.
-	ErrTokenNotActive = errors.New("token is not valid yet")
+	ErrTokenNotActive = api.ErrTokenNotActive
 
 	// ErrUnexpectedSigningMethod denotes a token was signed with an unexpected
 	// signing method.
-	ErrUnexpectedSigningMethod = errors.New("unexpected signing method")
+	ErrUnexpectedSigningMethod = api.ErrUnexpectedSigningMethod
+
+	// ErrTokenRevoked denotes a token that was revoked before it expired.
+	ErrTokenRevoked = api.ErrTokenRevoked
+
+	// ErrRefreshTokenReused denotes a refresh token presented after it had
+	// already been exchanged, which revokes every token of its family.
+	ErrRefreshTokenReused = api.ErrRefreshTokenReused
+
+	// ErrInsufficientScope denotes a valid token lacking a scope required by
+	// the endpoint.
+	ErrInsufficientScope = api.ErrInsufficientScope
+
+	// ErrTenantRequired denotes an authenticated request that could not be
+	// attributed to a tenant.
+	ErrTenantRequired = api.ErrTenantRequired
+
+	// ErrInvalidCredentials denotes a login with an unknown user or a wrong
+	// password.
+	ErrInvalidCredentials = api.ErrInvalidCredentials
+
+	// ErrSecondFactorRequired denotes a login with a valid password, but
+	// without the one-time code the user must also present.
+	ErrSecondFactorRequired = api.ErrSecondFactorRequired
+
+	// ErrInvalidSecondFactor denotes a login with a wrong one-time code.
+	ErrInvalidSecondFactor = api.ErrInvalidSecondFactor
 )
 
+// Err2code returns the HTTP status code reported for err: the status it is
+// mapped to in apierror.DefaultStatusMapper, if any, or else the status of
+// the *apierror.Error it wraps, or else the status matching the sentinel error
+// it wraps.
 func Err2code(err error) int {
+	if status, ok := apierror.DefaultStatusMapper.Status(err); ok {
+		return status
+	}
+
+	var aerr *apierror.Error
+	if errors.As(err, &aerr) {
+		return aerr.StatusCode()
+	}
+
 	var status = http.StatusInternalServerError
 
 	switch {
-	case errors.Is(err, ErrKeynotFound):
+	case errors.Is(err, ErrKeynotFound), errors.Is(err, ErrNotFound):
 		status = http.StatusNotFound
 	case errors.Is(err, ErrBadRequest):
 		status = http.StatusBadRequest
@@ -49,12 +101,29 @@ func Err2code(err error) int {
 		status = http.StatusNetworkAuthenticationRequired
 	case errors.Is(err, ErrUnauthorized):
 		status = http.StatusUnauthorized
-	case errors.Is(err, ErrForbidden):
+	case errors.Is(err, ErrForbidden), errors.Is(err, ErrInsufficientScope), errors.Is(err, ErrTenantRequired):
 		status = http.StatusForbidden
-	case errors.Is(err, ErrTokenExpired),
+	case errors.Is(err, ErrTooManyRequests):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, ErrCircuitOpen), errors.Is(err, ErrUnavailable):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, ErrRequestTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrTimeout):
+		status = http.StatusGatewayTimeout
+	case errors.Is(err, ErrIdempotencyInFlight):
+		status = http.StatusConflict
+	case errors.Is(err, ErrIdempotencyKeyReused), errors.Is(err, ErrUploadRejected):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, ErrTokenContextMissing),
+		errors.Is(err, ErrTokenExpired),
 		errors.Is(err, ErrTokenInvalid),
 		errors.Is(err, ErrTokenMalformed),
-		errors.Is(err, ErrTokenNotActive):
+		errors.Is(err, ErrTokenNotActive),
+		errors.Is(err, ErrTokenRevoked),
+		errors.Is(err, ErrRefreshTokenReused):
 
 		status = http.StatusUnauthorized
 	}
@@ -0,0 +1,63 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Pinger is implemented by clients able to check their connection, such as
+// *sql.DB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// PingCheck returns a Checker pinging p, such as a database connection pool.
+func PingCheck(p Pinger) Checker {
+	return p.PingContext
+}
+
+// URLCheck returns a Checker sending a GET request to url, typically the
+// health endpoint of a downstream service, which fails unless the response
+// status is lower than 400. A nil client means http.DefaultClient.
+func URLCheck(url string, client *http.Client) Checker {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// DiskSpaceCheck returns a Checker failing when the file system holding path
+// has less than minFree bytes available.
+func DiskSpaceCheck(path string, minFree uint64) Checker {
+	return func(ctx context.Context) error {
+		free, err := diskFree(path)
+		if err != nil {
+			return err
+		}
+
+		if free < minFree {
+			return fmt.Errorf("%d bytes free on %s, %d required", free, path, minFree)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,264 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Checker checks a dependency of the service, such as a database or a
+// downstream API, returning an error when it is unhealthy. It should honor
+// the deadline of ctx.
+type Checker func(ctx context.Context) error
+
+// Status is the status of a check or of the whole service.
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+// CheckResult is the outcome of a check.
+type CheckResult struct {
+	Status    Status    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Latency   float64   `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the outcome of the checks of a Registry, keyed by check name. The
+// service is down when any of its checks is.
+type Report struct {
+	Status Status                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+type registryOption struct {
+	interval time.Duration
+	timeout  time.Duration
+}
+
+// RegistryOption sets an optional parameter for NewRegistry.
+type RegistryOption func(opt *registryOption)
+
+// WithInterval sets the interval at which Start runs the checks, which is
+// also how long the handlers reuse check results when Start is not running.
+// Defaults to 10 seconds.
+func WithInterval(d time.Duration) RegistryOption {
+	return func(opt *registryOption) { opt.interval = d }
+}
+
+// WithTimeout sets the time allowed to each check run. Defaults to 5 seconds.
+func WithTimeout(d time.Duration) RegistryOption {
+	return func(opt *registryOption) { opt.timeout = d }
+}
+
+type checkOption struct {
+	liveness bool
+}
+
+// CheckOption sets an optional parameter for Registry.Register.
+type CheckOption func(opt *checkOption)
+
+// Liveness makes the check count for the liveness of the service, reported
+// by LivenessHandler, on top of its readiness. Only checks whose failure
+// requires restarting the service should be liveness checks.
+func Liveness() CheckOption {
+	return func(opt *checkOption) { opt.liveness = true }
+}
+
+type check struct {
+	fn       Checker
+	liveness bool
+
+	// mu serializes the runs of the check, so concurrent probes share a
+	// single run rather than hitting the dependency each.
+	mu     sync.Mutex
+	result CheckResult
+}
+
+// Registry holds the named checks of a service and serves their aggregated
+// results to liveness and readiness probes. Check results are cached, either
+// refreshed in the background by Start or for the check interval, so probe
+// storms don't reach the dependencies.
+type Registry struct {
+	mu       sync.RWMutex
+	checks   map[string]*check
+	interval time.Duration
+	timeout  time.Duration
+	started  bool
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry(options ...RegistryOption) *Registry {
+	opts := &registryOption{
+		interval: 10 * time.Second,
+		timeout:  5 * time.Second,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return &Registry{
+		checks:   make(map[string]*check),
+		interval: opts.interval,
+		timeout:  opts.timeout,
+	}
+}
+
+// Register adds or replaces the check called name. Checks count for the
+// readiness of the service, and for its liveness too with the Liveness
+// option.
+func (r *Registry) Register(name string, fn Checker, options ...CheckOption) {
+	opts := &checkOption{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = &check{fn: fn, liveness: opts.liveness}
+}
+
+// Start runs the checks, and then runs them again at every interval in the
+// background until ctx is done. The handlers then serve the latest results
+// without running checks themselves.
+func (r *Registry) Start(ctx context.Context) {
+	r.mu.Lock()
+	r.started = true
+	r.mu.Unlock()
+
+	r.run(ctx, false, 0)
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				r.mu.Lock()
+				r.started = false
+				r.mu.Unlock()
+				return
+			case <-ticker.C:
+				r.run(ctx, false, 0)
+			}
+		}
+	}()
+}
+
+// Check runs every check now and returns their results.
+func (r *Registry) Check(ctx context.Context) Report {
+	return r.run(ctx, false, 0)
+}
+
+// LivenessHandler returns the http.Handler of the /healthz endpoint,
+// reporting the liveness checks as a JSON Report, with a 503 status code
+// when any of them fails.
+func (r *Registry) LivenessHandler() http.Handler {
+	return r.handler(true)
+}
+
+// ReadinessHandler returns the http.Handler of the /readyz endpoint,
+// reporting every check as a JSON Report, with a 503 status code when any of
+// them fails.
+func (r *Registry) ReadinessHandler() http.Handler {
+	return r.handler(false)
+}
+
+func (r *Registry) handler(liveness bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.RLock()
+		maxAge := r.interval
+		if r.started {
+			// the background runs keep results fresh
+			maxAge = -1
+		}
+		r.mu.RUnlock()
+
+		// results are shared between probes: a probe giving up must not
+		// fail the checks it triggered
+		report := r.run(context.Background(), liveness, maxAge)
+
+		status := http.StatusOK
+		if report.Status != StatusUp {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		if req.Method != http.MethodHead {
+			json.NewEncoder(w).Encode(report)
+		}
+	})
+}
+
+// run runs the checks concurrently, only the liveness ones if liveness is
+// set, reusing the results younger than maxAge, or any result when maxAge is
+// negative.
+func (r *Registry) run(ctx context.Context, liveness bool, maxAge time.Duration) Report {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.checks))
+	checks := make([]*check, 0, len(r.checks))
+	for name, c := range r.checks {
+		if liveness && !c.liveness {
+			continue
+		}
+		names = append(names, name)
+		checks = append(checks, c)
+	}
+	r.mu.RUnlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, r.timeout, maxAge)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]CheckResult, len(checks))}
+	for i, name := range names {
+		report.Checks[name] = results[i]
+		if results[i].Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+
+	return report
+}
+
+func (c *check) run(ctx context.Context, timeout, maxAge time.Duration) CheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.result.CheckedAt.IsZero() && (maxAge < 0 || time.Since(c.result.CheckedAt) < maxAge) {
+		return c.result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.fn(ctx)
+
+	c.result = CheckResult{
+		Status:    StatusUp,
+		Latency:   float64(time.Since(start).Microseconds()) / 1000,
+		CheckedAt: start,
+	}
+	if err != nil {
+		c.result.Status = StatusDown
+		c.result.Error = err.Error()
+	}
+
+	return c.result
+}
@@ -0,0 +1,190 @@
+package i18n
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Catalog holds translated messages, keyed by language tag and message key.
+// The keys of error messages are apierror codes (e.g. "not_found"), and those
+// of status texts are given by StatusKey. Messages may refer to the details of
+// an error, or other arguments, as {name}.
+type Catalog struct {
+	mu       sync.RWMutex
+	fallback string
+	messages map[string]map[string]string
+}
+
+// NewCatalog returns an empty Catalog, falling back to the fallback language
+// for keys missing in the requested languages.
+func NewCatalog(fallback string) *Catalog {
+	return &Catalog{
+		fallback: normalizeTag(fallback),
+		messages: make(map[string]map[string]string),
+	}
+}
+
+// DefaultCatalog is the Catalog used by the error encoders, falling back to
+// English. Being empty, it leaves messages untranslated until applications
+// add theirs.
+var DefaultCatalog = NewCatalog("en")
+
+// Add adds the message of key in lang to DefaultCatalog.
+func Add(lang, key, message string) {
+	DefaultCatalog.Add(lang, key, message)
+}
+
+// AddMessages adds messages, keyed by message key, in lang to DefaultCatalog.
+func AddMessages(lang string, messages map[string]string) {
+	DefaultCatalog.AddMessages(lang, messages)
+}
+
+// StatusKey returns the key of the text of an HTTP status, such as
+// "status.404".
+func StatusKey(status int) string {
+	return "status." + strconv.Itoa(status)
+}
+
+// Add adds or replaces the message of key in lang.
+func (c *Catalog) Add(lang, key, message string) {
+	c.AddMessages(lang, map[string]string{key: message})
+}
+
+// AddMessages adds or replaces messages, keyed by message key, in lang.
+func (c *Catalog) AddMessages(lang string, messages map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lang = normalizeTag(lang)
+	m, ok := c.messages[lang]
+	if !ok {
+		m = make(map[string]string, len(messages))
+		c.messages[lang] = m
+	}
+	for k, v := range messages {
+		m[k] = v
+	}
+}
+
+// Lookup returns the message of key in the first of langs having it, trying
+// each tag and then its base language ("pt" for "pt-BR"), and then in the
+// fallback language.
+func (c *Catalog) Lookup(langs []string, key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, lang := range langs {
+		lang = normalizeTag(lang)
+		if msg, ok := c.messages[lang][key]; ok {
+			return msg, true
+		}
+		if base, _, ok := strings.Cut(lang, "-"); ok {
+			if msg, ok := c.messages[base][key]; ok {
+				return msg, true
+			}
+		}
+	}
+
+	msg, ok := c.messages[c.fallback][key]
+	return msg, ok
+}
+
+// Message returns the message of key in the languages of ctx, with the
+// {name} placeholders replaced by the matching args.
+func (c *Catalog) Message(ctx context.Context, key string, args map[string]interface{}) (string, bool) {
+	msg, ok := c.Lookup(Languages(ctx), key)
+	if !ok {
+		return "", false
+	}
+
+	if len(args) > 0 && strings.Contains(msg, "{") {
+		pairs := make([]string, 0, 2*len(args))
+		for name, v := range args {
+			pairs = append(pairs, "{"+name+"}", fmt.Sprint(v))
+		}
+		msg = strings.NewReplacer(pairs...).Replace(msg)
+	}
+
+	return msg, true
+}
+
+type contextKey int
+
+const languagesKey contextKey = iota
+
+// WithLanguages returns a copy of ctx carrying the languages preferred for
+// messages, most preferred first.
+func WithLanguages(ctx context.Context, langs ...string) context.Context {
+	return context.WithValue(ctx, languagesKey, langs)
+}
+
+// Languages returns the languages stored in ctx by WithLanguages or
+// AcceptLanguageIntoContext.
+func Languages(ctx context.Context) []string {
+	langs, _ := ctx.Value(languagesKey).([]string)
+	return langs
+}
+
+// AcceptLanguageIntoContext is an http RequestFunc storing the languages
+// accepted by the client, from the Accept-Language header, in the context.
+// Use it with httptransport.ServerBefore.
+func AcceptLanguageIntoContext(ctx context.Context, r *http.Request) context.Context {
+	langs := ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if len(langs) == 0 {
+		return ctx
+	}
+
+	return WithLanguages(ctx, langs...)
+}
+
+// ParseAcceptLanguage returns the language tags of an Accept-Language header
+// value by decreasing quality, leaving out the wildcard and the tags of zero
+// quality.
+func ParseAcceptLanguage(header string) []string {
+	type tag struct {
+		lang string
+		q    float64
+	}
+
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(part, ";")
+		lang = normalizeTag(lang)
+		if lang == "" || lang == "*" {
+			continue
+		}
+
+		t := tag{lang: lang, q: 1}
+		for _, param := range strings.Split(params, ";") {
+			key, val, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || strings.TrimSpace(key) != "q" {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+				t.q = q
+			}
+		}
+		if t.q > 0 {
+			tags = append(tags, t)
+		}
+	}
+
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].q > tags[j].q
+	})
+
+	langs := make([]string, len(tags))
+	for i, t := range tags {
+		langs[i] = t.lang
+	}
+	return langs
+}
+
+func normalizeTag(lang string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+}
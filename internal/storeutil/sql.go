@@ -0,0 +1,40 @@
+// Package storeutil holds the helpers shared by the stores of the other
+// packages: building SQL queries, and sweeping expired entries from memory.
+package storeutil
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// ValidIdentifier reports whether name is a table or column name, optionally
+// qualified by a schema, which may be written into a query as is.
+func ValidIdentifier(name string) bool {
+	return sqlIdentifier.MatchString(name)
+}
+
+// Placeholders writes the placeholders of the arguments of a query: ?, or
+// $1, $2... as required by PostgreSQL drivers when Dollar is set.
+type Placeholders struct {
+	Dollar bool
+}
+
+// Nth returns the placeholder of the i-th argument, counting from 1.
+func (p Placeholders) Nth(i int) string {
+	if p.Dollar {
+		return fmt.Sprintf("$%d", i)
+	}
+	return "?"
+}
+
+// List returns the comma separated placeholders of n arguments.
+func (p Placeholders) List(n int) string {
+	ps := make([]string, n)
+	for i := range ps {
+		ps[i] = p.Nth(i + 1)
+	}
+	return strings.Join(ps, ", ")
+}
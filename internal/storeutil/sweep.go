@@ -0,0 +1,32 @@
+package storeutil
+
+import "time"
+
+// SweepInterval is the minimum time between two sweeps of a Sweeper.
+const SweepInterval = time.Minute
+
+// Sweeper throttles the sweeps of the expired entries of a memory store, run
+// lazily by its calls, to one per SweepInterval. Its zero value is ready to
+// use, and it is guarded by the lock of the store.
+type Sweeper struct {
+	last time.Time
+}
+
+// Due reports whether a sweep is due at now, and records it when it is.
+func (s *Sweeper) Due(now time.Time) bool {
+	if now.Sub(s.last) < SweepInterval {
+		return false
+	}
+	s.last = now
+	return true
+}
+
+// DeleteExpired deletes the entries of m whose expiry, as returned by
+// expires, is before now.
+func DeleteExpired[K comparable, V any](m map[K]V, now time.Time, expires func(V) time.Time) {
+	for key, value := range m {
+		if now.After(expires(value)) {
+			delete(m, key)
+		}
+	}
+}
@@ -0,0 +1,506 @@
+// Package jobs runs background tasks enqueued by endpoints on a pool of
+// workers, retrying the failed ones and dead-lettering those which keep
+// failing. Tasks are kept by a Store: MemoryStore for work which may be lost
+// with the process, or SQLOutbox, which enqueues tasks in the transaction of
+// the business writes they follow up on.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	httptransport "github.com/likearthian/apikit/transport/http"
+)
+
+// ErrClosed is returned when enqueueing jobs after the Dispatcher is shut
+// down.
+var ErrClosed = errors.New("jobs: dispatcher closed")
+
+// ErrUnknownType is the error of the jobs dead-lettered because no handler
+// is registered for their type.
+var ErrUnknownType = errors.New("jobs: no handler for job type")
+
+// ErrDuplicate is returned by MemoryStore when enqueueing a job whose id is
+// already enqueued.
+var ErrDuplicate = errors.New("jobs: duplicate job id")
+
+// Job is a task kept by a Store.
+type Job struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+
+	// Attempts counts the runs of the job, including the current one.
+	Attempts int `json:"attempts"`
+
+	// MaxAttempts is how many times the job runs before being
+	// dead-lettered. 0 uses the default of the Dispatcher.
+	MaxAttempts int `json:"max_attempts,omitempty"`
+
+	RunAt     time.Time `json:"run_at"`
+	CreatedAt time.Time `json:"created_at"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// prepare fills the ID and times of a job about to be enqueued.
+func (j *Job) prepare() {
+	now := time.Now()
+	if j.ID == "" {
+		j.ID = httptransport.NewRequestID()
+	}
+	if j.CreatedAt.IsZero() {
+		j.CreatedAt = now
+	}
+	if j.RunAt.IsZero() {
+		j.RunAt = now
+	}
+}
+
+// Store keeps the jobs until they complete or are dead-lettered.
+// Implementations must be safe for concurrent use, including by the
+// dispatchers of several instances of a service sharing it.
+type Store interface {
+	// Enqueue adds a job.
+	Enqueue(ctx context.Context, job *Job) error
+
+	// Claim returns up to n jobs due to run, which are not returned again
+	// for lease unless they are retried, and counts an attempt of each.
+	Claim(ctx context.Context, n int, lease time.Duration) ([]*Job, error)
+
+	// Complete removes a job which succeeded.
+	Complete(ctx context.Context, job *Job) error
+
+	// Retry schedules a job which failed to run again at job.RunAt.
+	Retry(ctx context.Context, job *Job) error
+
+	// DeadLetter sets aside a job which won't be retried.
+	DeadLetter(ctx context.Context, job *Job) error
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps the error of a handler so the job is dead-lettered at once
+// instead of being retried, such as for an invalid payload.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+type jobOption struct {
+	runAt       time.Time
+	maxAttempts int
+	id          string
+}
+
+// JobOption sets an optional parameter of a job enqueued with a Task.
+type JobOption func(opt *jobOption)
+
+// JobRunAt delays the job until t.
+func JobRunAt(t time.Time) JobOption {
+	return func(opt *jobOption) { opt.runAt = t }
+}
+
+// JobDelay delays the job by d.
+func JobDelay(d time.Duration) JobOption {
+	return func(opt *jobOption) { opt.runAt = time.Now().Add(d) }
+}
+
+// JobMaxAttempts sets how many times the job runs before being
+// dead-lettered, overriding the default of the Dispatcher.
+func JobMaxAttempts(n int) JobOption {
+	return func(opt *jobOption) { opt.maxAttempts = n }
+}
+
+// JobID sets the id of the job, which defaults to a new UUID, so enqueueing
+// the same job twice fails: MemoryStore returns ErrDuplicate, and SQLOutbox
+// the unique constraint violation of the driver.
+func JobID(id string) JobOption {
+	return func(opt *jobOption) { opt.id = id }
+}
+
+// Task is a type of job whose payload is a T, encoded as JSON.
+//
+//	var sendWelcome = jobs.NewTask[WelcomeEmail]("users.send_welcome")
+//
+//	sendWelcome.Handle(dispatcher, func(ctx context.Context, m WelcomeEmail) error {...})
+//	err := sendWelcome.Enqueue(ctx, dispatcher, WelcomeEmail{UserID: id})
+type Task[T any] struct {
+	Type string
+}
+
+// NewTask creates the Task of type typ, which must be unique among the
+// tasks of a Dispatcher.
+func NewTask[T any](typ string) Task[T] {
+	return Task[T]{Type: typ}
+}
+
+// Job returns the job running the task with payload, to be enqueued in a
+// Store, such as with SQLOutbox.EnqueueTx.
+func (t Task[T]) Job(payload T, options ...JobOption) (*Job, error) {
+	var opts jobOption
+	for _, option := range options {
+		option(&opts)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("jobs: %s payload: %w", t.Type, err)
+	}
+
+	job := &Job{
+		ID:          opts.id,
+		Type:        t.Type,
+		Payload:     data,
+		MaxAttempts: opts.maxAttempts,
+		RunAt:       opts.runAt,
+	}
+	job.prepare()
+
+	return job, nil
+}
+
+// Enqueue enqueues the task with payload in d.
+func (t Task[T]) Enqueue(ctx context.Context, d *Dispatcher, payload T, options ...JobOption) error {
+	job, err := t.Job(payload, options...)
+	if err != nil {
+		return err
+	}
+	return d.Enqueue(ctx, job)
+}
+
+// Handle registers fn as the handler of the task in d. A payload which
+// can't be decoded dead-letters the job.
+func (t Task[T]) Handle(d *Dispatcher, fn func(ctx context.Context, payload T) error) {
+	d.Handle(t.Type, func(ctx context.Context, job *Job) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return Permanent(fmt.Errorf("jobs: %s payload: %w", t.Type, err))
+		}
+		return fn(ctx, payload)
+	})
+}
+
+// HandlerFunc runs a job.
+type HandlerFunc func(ctx context.Context, job *Job) error
+
+type dispatcherOption struct {
+	workers      int
+	pollInterval time.Duration
+	lease        time.Duration
+	maxAttempts  int
+	backoff      func(attempts int) time.Duration
+	deadLetter   func(job *Job, err error)
+	errorHandler func(err error, job *Job)
+}
+
+// DispatcherOption sets an optional parameter for NewDispatcher.
+type DispatcherOption func(opt *dispatcherOption)
+
+// Workers sets how many jobs run concurrently. Defaults to 4.
+func Workers(n int) DispatcherOption {
+	return func(opt *dispatcherOption) { opt.workers = n }
+}
+
+// PollInterval sets how often the Store is polled for due jobs when idle.
+// Jobs enqueued through the Dispatcher are picked up at once. Defaults to 1
+// second.
+func PollInterval(d time.Duration) DispatcherOption {
+	return func(opt *dispatcherOption) { opt.pollInterval = d }
+}
+
+// Lease sets how long a job may run, after which its context is cancelled
+// and the Store may hand it out again. Defaults to 5 minutes.
+func Lease(d time.Duration) DispatcherOption {
+	return func(opt *dispatcherOption) { opt.lease = d }
+}
+
+// MaxAttempts sets how many times the jobs run before being dead-lettered,
+// unless they set their own. Defaults to 5.
+func MaxAttempts(n int) DispatcherOption {
+	return func(opt *dispatcherOption) { opt.maxAttempts = n }
+}
+
+// RetryBackoff sets the delay before running again a job which failed
+// attempts times. Defaults to 2^attempts seconds, capped at 1 hour.
+func RetryBackoff(fn func(attempts int) time.Duration) DispatcherOption {
+	return func(opt *dispatcherOption) { opt.backoff = fn }
+}
+
+// OnDeadLetter sets the function called with the jobs dead-lettered and the
+// error of their last attempt, to alert about them.
+func OnDeadLetter(fn func(job *Job, err error)) DispatcherOption {
+	return func(opt *dispatcherOption) { opt.deadLetter = fn }
+}
+
+// WithErrorHandler sets the function called with the errors of the Store,
+// and the job concerned, if any. By default, they are dropped.
+func WithErrorHandler(fn func(err error, job *Job)) DispatcherOption {
+	return func(opt *dispatcherOption) { opt.errorHandler = fn }
+}
+
+func defaultBackoff(attempts int) time.Duration {
+	d := time.Duration(math.Pow(2, float64(attempts))) * time.Second
+	if d <= 0 || d > time.Hour {
+		return time.Hour
+	}
+	return d
+}
+
+// Dispatcher runs the jobs of a Store with the handlers registered for
+// their type, retrying the failed ones with a backoff and dead-lettering
+// those failing too many times or with a Permanent error.
+type Dispatcher struct {
+	store Store
+	opts  *dispatcherOption
+
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+	started  bool
+	closed   bool
+
+	wake   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewDispatcher creates a Dispatcher running the jobs of store. Handlers are
+// registered before calling Start.
+func NewDispatcher(store Store, options ...DispatcherOption) *Dispatcher {
+	opts := &dispatcherOption{
+		workers:      4,
+		pollInterval: time.Second,
+		lease:        5 * time.Minute,
+		maxAttempts:  5,
+		backoff:      defaultBackoff,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	if opts.workers < 1 {
+		opts.workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		store:    store,
+		opts:     opts,
+		handlers: make(map[string]HandlerFunc),
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Handle registers fn as the handler of the jobs of type typ, replacing the
+// previous one.
+func (d *Dispatcher) Handle(typ string, fn HandlerFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.handlers[typ] = fn
+}
+
+// Enqueue adds job to the Store, filling its ID and times when not set, and
+// wakes up an idle worker.
+func (d *Dispatcher) Enqueue(ctx context.Context, job *Job) error {
+	d.mu.RLock()
+	closed := d.closed
+	d.mu.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+
+	job.prepare()
+	if err := d.store.Enqueue(ctx, job); err != nil {
+		return err
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Start starts running the jobs in the background, until Shutdown.
+func (d *Dispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.started || d.closed {
+		return
+	}
+	d.started = true
+
+	go d.loop()
+}
+
+// Shutdown stops claiming jobs and waits for the running ones to complete.
+// When ctx is done first, their contexts are cancelled and ctx.Err() is
+// returned; the jobs interrupted are retried once their lease expires.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.mu.Lock()
+	started := d.started
+	if !d.closed {
+		d.closed = true
+		close(d.stop)
+	}
+	d.mu.Unlock()
+
+	if !started {
+		d.cancel()
+		return nil
+	}
+
+	select {
+	case <-d.done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) loop() {
+	defer close(d.done)
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	slots := make(chan struct{}, d.opts.workers)
+	for {
+		// wait for a free worker, then claim as many jobs as there are
+		select {
+		case slots <- struct{}{}:
+		case <-d.stop:
+			return
+		}
+		n := 1
+	reserve:
+		for n < d.opts.workers {
+			select {
+			case slots <- struct{}{}:
+				n++
+			default:
+				break reserve
+			}
+		}
+
+		jobs, err := d.store.Claim(d.ctx, n, d.opts.lease)
+		if err != nil {
+			d.fail(err, nil)
+		}
+
+		for _, job := range jobs {
+			wg.Add(1)
+			go func(job *Job) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+				d.run(job)
+			}(job)
+		}
+		for i := len(jobs); i < n; i++ {
+			<-slots
+		}
+
+		if err == nil && len(jobs) == n {
+			// more jobs may be due
+			continue
+		}
+
+		timer := time.NewTimer(d.opts.pollInterval)
+		select {
+		case <-d.stop:
+			timer.Stop()
+			return
+		case <-d.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func (d *Dispatcher) run(job *Job) {
+	ctx, cancel := context.WithTimeout(d.ctx, d.opts.lease)
+	err := d.handle(ctx, job)
+	cancel()
+
+	// the outcome is recorded even when the dispatcher is shutting down
+	sctx, scancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer scancel()
+
+	if err == nil {
+		if serr := d.store.Complete(sctx, job); serr != nil {
+			d.fail(serr, job)
+		}
+		return
+	}
+
+	job.LastError = err.Error()
+
+	maxAttempts := job.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = d.opts.maxAttempts
+	}
+
+	var permanent *permanentError
+	if errors.As(err, &permanent) || errors.Is(err, ErrUnknownType) || job.Attempts >= maxAttempts {
+		if serr := d.store.DeadLetter(sctx, job); serr != nil {
+			d.fail(serr, job)
+		}
+		if d.opts.deadLetter != nil {
+			d.opts.deadLetter(job, err)
+		}
+		return
+	}
+
+	job.RunAt = time.Now().Add(d.opts.backoff(job.Attempts))
+	if serr := d.store.Retry(sctx, job); serr != nil {
+		d.fail(serr, job)
+	}
+}
+
+// handle runs the handler of job, recovering its panics as errors.
+func (d *Dispatcher) handle(ctx context.Context, job *Job) (err error) {
+	d.mu.RLock()
+	fn, ok := d.handlers[job.Type]
+	d.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownType, job.Type)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("jobs: %s panic: %v", job.Type, p)
+		}
+	}()
+
+	return fn(ctx, job)
+}
+
+func (d *Dispatcher) fail(err error, job *Job) {
+	if d.opts.errorHandler != nil {
+		d.opts.errorHandler(err, job)
+	}
+}
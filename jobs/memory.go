@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process Store. Its jobs are lost with the process,
+// which makes it fit for best-effort work, or tests.
+type MemoryStore struct {
+	mu     sync.Mutex
+	jobs   map[string]*Job
+	leases map[string]time.Time
+	dead   []*Job
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		jobs:   make(map[string]*Job),
+		leases: make(map[string]time.Time),
+	}
+}
+
+// Enqueue implements Store.
+func (s *MemoryStore) Enqueue(_ context.Context, job *Job) error {
+	job.prepare()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[job.ID]; ok {
+		return ErrDuplicate
+	}
+	j := *job
+	s.jobs[job.ID] = &j
+
+	return nil
+}
+
+// Claim implements Store.
+func (s *MemoryStore) Claim(_ context.Context, n int, lease time.Duration) ([]*Job, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := make([]*Job, 0, n)
+	for id, job := range s.jobs {
+		if job.RunAt.After(now) || now.Before(s.leases[id]) {
+			continue
+		}
+		due = append(due, job)
+	}
+	sort.Slice(due, func(i, k int) bool { return due[i].RunAt.Before(due[k].RunAt) })
+	if len(due) > n {
+		due = due[:n]
+	}
+
+	claimed := make([]*Job, len(due))
+	for i, job := range due {
+		job.Attempts++
+		s.leases[job.ID] = now.Add(lease)
+
+		j := *job
+		claimed[i] = &j
+	}
+
+	return claimed, nil
+}
+
+// Complete implements Store.
+func (s *MemoryStore) Complete(_ context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.jobs, job.ID)
+	delete(s.leases, job.ID)
+
+	return nil
+}
+
+// Retry implements Store.
+func (s *MemoryStore) Retry(_ context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if j, ok := s.jobs[job.ID]; ok {
+		j.RunAt = job.RunAt
+		j.LastError = job.LastError
+	}
+	delete(s.leases, job.ID)
+
+	return nil
+}
+
+// DeadLetter implements Store.
+func (s *MemoryStore) DeadLetter(_ context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[job.ID]; ok {
+		j := *job
+		s.dead = append(s.dead, &j)
+	}
+	delete(s.jobs, job.ID)
+	delete(s.leases, job.ID)
+
+	return nil
+}
+
+// Len returns the number of jobs waiting to run or running.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.jobs)
+}
+
+// DeadLetters returns the dead-lettered jobs.
+func (s *MemoryStore) DeadLetters() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dead := make([]Job, len(s.dead))
+	for i, job := range s.dead {
+		dead[i] = *job
+	}
+	return dead
+}
@@ -0,0 +1,181 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/likearthian/apikit/internal/storeutil"
+)
+
+// Execer executes SQL statements, like *sql.DB, *sql.Tx and *sql.Conn.
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+type sqlOutboxOption struct {
+	ph storeutil.Placeholders
+}
+
+// SQLOutboxOption sets an optional parameter for NewSQLOutbox.
+type SQLOutboxOption func(opt *sqlOutboxOption)
+
+// SQLDollarPlaceholders makes SQLOutbox use $1, $2... placeholders, as
+// required by PostgreSQL drivers, instead of ?.
+func SQLDollarPlaceholders() SQLOutboxOption {
+	return func(opt *sqlOutboxOption) { opt.ph.Dollar = true }
+}
+
+const (
+	outboxPending = "pending"
+	outboxDead    = "dead"
+)
+
+// SQLOutbox is a Store keeping the jobs in a table created with:
+//
+//	CREATE TABLE job_outbox (
+//		id           VARCHAR(64) PRIMARY KEY,
+//		type         VARCHAR(255) NOT NULL,
+//		payload      TEXT NOT NULL,
+//		status       VARCHAR(16) NOT NULL,
+//		attempts     INTEGER NOT NULL,
+//		max_attempts INTEGER NOT NULL,
+//		run_at       TIMESTAMP NOT NULL,
+//		locked_until TIMESTAMP NULL,
+//		last_error   TEXT NOT NULL,
+//		created_at   TIMESTAMP NOT NULL
+//	);
+//	CREATE INDEX job_outbox_due ON job_outbox (status, run_at);
+//
+// With EnqueueTx, a job is enqueued in the transaction of the writes it
+// follows up on, so it is only run once they are committed, and never lost
+// when they are. Completed jobs are deleted, and dead-lettered ones kept
+// with the status "dead". Jobs are claimed by bumping their attempts with a
+// conditional update, so the dispatchers of several instances can share the
+// table without locking it.
+type SQLOutbox struct {
+	db    *sql.DB
+	table string
+	ph    storeutil.Placeholders
+
+	insert string
+}
+
+// NewSQLOutbox creates a SQLOutbox keeping the jobs in table.
+func NewSQLOutbox(db *sql.DB, table string, options ...SQLOutboxOption) (*SQLOutbox, error) {
+	if !storeutil.ValidIdentifier(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+
+	var opts sqlOutboxOption
+	for _, option := range options {
+		option(&opts)
+	}
+
+	return &SQLOutbox{
+		db:    db,
+		table: table,
+		ph:    opts.ph,
+		insert: "INSERT INTO " + table +
+			" (id, type, payload, status, attempts, max_attempts, run_at, last_error, created_at) VALUES (" +
+			opts.ph.List(9) + ")",
+	}, nil
+}
+
+// Enqueue implements Store.
+func (s *SQLOutbox) Enqueue(ctx context.Context, job *Job) error {
+	return s.EnqueueTx(ctx, s.db, job)
+}
+
+// EnqueueTx enqueues job with tx, usually the *sql.Tx of the business
+// writes, filling its ID and times when not set. As the dispatcher isn't
+// notified, the job runs at its next poll.
+func (s *SQLOutbox) EnqueueTx(ctx context.Context, tx Execer, job *Job) error {
+	job.prepare()
+
+	_, err := tx.ExecContext(ctx, s.insert, job.ID, job.Type, string(job.Payload), outboxPending,
+		job.Attempts, job.MaxAttempts, job.RunAt.UTC(), job.LastError, job.CreatedAt.UTC())
+
+	return err
+}
+
+// Claim implements Store.
+func (s *SQLOutbox) Claim(ctx context.Context, n int, lease time.Duration) ([]*Job, error) {
+	now := time.Now().UTC()
+
+	query := fmt.Sprintf("SELECT id, type, payload, attempts, max_attempts, run_at, created_at, last_error FROM %s"+
+		" WHERE status = %s AND run_at <= %s AND (locked_until IS NULL OR locked_until <= %s)"+
+		" ORDER BY run_at LIMIT %d", s.table, s.ph.Nth(1), s.ph.Nth(2), s.ph.Nth(3), n)
+
+	rows, err := s.db.QueryContext(ctx, query, outboxPending, now, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var due []*Job
+	for rows.Next() {
+		var (
+			job     Job
+			payload string
+		)
+		if err := rows.Scan(&job.ID, &job.Type, &payload, &job.Attempts, &job.MaxAttempts,
+			&job.RunAt, &job.CreatedAt, &job.LastError); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		job.Payload = []byte(payload)
+		due = append(due, &job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// the update only succeeds for the dispatcher which read the current
+	// attempts, the others skipping the job
+	claim := fmt.Sprintf("UPDATE %s SET attempts = attempts + 1, locked_until = %s"+
+		" WHERE id = %s AND attempts = %s AND status = %s", s.table, s.ph.Nth(1), s.ph.Nth(2), s.ph.Nth(3), s.ph.Nth(4))
+
+	claimed := due[:0]
+	for _, job := range due {
+		res, err := s.db.ExecContext(ctx, claim, now.Add(lease), job.ID, job.Attempts, outboxPending)
+		if err != nil {
+			return claimed, err
+		}
+		if n, err := res.RowsAffected(); err != nil || n != 1 {
+			continue
+		}
+
+		job.Attempts++
+		claimed = append(claimed, job)
+	}
+
+	return claimed, nil
+}
+
+// Complete implements Store.
+func (s *SQLOutbox) Complete(ctx context.Context, job *Job) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE id = %s", s.table, s.ph.Nth(1))
+
+	_, err := s.db.ExecContext(ctx, query, job.ID)
+	return err
+}
+
+// Retry implements Store.
+func (s *SQLOutbox) Retry(ctx context.Context, job *Job) error {
+	query := fmt.Sprintf("UPDATE %s SET run_at = %s, last_error = %s, locked_until = NULL WHERE id = %s",
+		s.table, s.ph.Nth(1), s.ph.Nth(2), s.ph.Nth(3))
+
+	_, err := s.db.ExecContext(ctx, query, job.RunAt.UTC(), job.LastError, job.ID)
+	return err
+}
+
+// DeadLetter implements Store.
+func (s *SQLOutbox) DeadLetter(ctx context.Context, job *Job) error {
+	query := fmt.Sprintf("UPDATE %s SET status = %s, last_error = %s, locked_until = NULL WHERE id = %s",
+		s.table, s.ph.Nth(1), s.ph.Nth(2), s.ph.Nth(3))
+
+	_, err := s.db.ExecContext(ctx, query, outboxDead, job.LastError, job.ID)
+	return err
+}
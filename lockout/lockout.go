@@ -0,0 +1,307 @@
+// Package lockout protects authentication against brute force: a Guard
+// counts the failed attempts of each principal, such as a username, and of
+// each client IP, in a Store, and locks them out once they fail too often,
+// for a window doubling with every lockout. Its Middleware guards endpoints
+// such as the one of api.MakePasswordLoginEndpoint, and MakeHttpMiddleware
+// guards http middlewares such as httptransport.MakeHttpApikeyMiddleware.
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/audit"
+)
+
+// Actions of the audit events recorded by a Guard.
+const (
+	ActionFailure  = "auth.failure"
+	ActionLockout  = "auth.lockout"
+	ActionRejected = "auth.rejected"
+)
+
+// LockedError is returned for the attempts of a locked out principal or IP.
+// It wraps api.ErrTooManyRequests, reports a 429 status code and carries a
+// Retry-After header.
+type LockedError struct {
+	Until time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s: locked out until %s", api.ErrTooManyRequests, e.Until.Format(time.RFC3339))
+}
+
+func (e *LockedError) Unwrap() error {
+	return api.ErrTooManyRequests
+}
+
+func (e *LockedError) StatusCode() int {
+	return http.StatusTooManyRequests
+}
+
+func (e *LockedError) Headers() http.Header {
+	seconds := int(math.Ceil(time.Until(e.Until).Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return http.Header{"Retry-After": []string{strconv.Itoa(seconds)}}
+}
+
+// State is what a Store keeps for a principal or an IP.
+type State struct {
+	// Failures counts the failures since the last lockout or success.
+	Failures int `json:"failures"`
+
+	// Lockouts counts the lockouts, which double the next window.
+	Lockouts int `json:"lockouts"`
+
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// Locked reports whether s is locked out at now.
+func (s State) Locked(now time.Time) bool {
+	return now.Before(s.LockedUntil)
+}
+
+// Store keeps the State of the principals and IPs, by key. Implementations
+// must be safe for concurrent use. The redisstore package provides a Store
+// backed by Redis, shared by every instance of a service.
+type Store interface {
+	// Get returns the State of key, which is the zero State for unknown
+	// keys.
+	Get(ctx context.Context, key string) (State, error)
+
+	// Set stores the State of key, forgotten after ttl.
+	Set(ctx context.Context, key string, state State, ttl time.Duration) error
+
+	// Increment adds one to the failures of key atomically, keeping them
+	// for ttl at least, and returns their new count, so concurrent attempts
+	// are all counted.
+	Increment(ctx context.Context, key string, ttl time.Duration) (int, error)
+
+	// Delete forgets key.
+	Delete(ctx context.Context, key string) error
+}
+
+type guardOption struct {
+	maxFailures   int
+	maxIPFailures int
+	baseWindow    time.Duration
+	maxWindow     time.Duration
+	resetAfter    time.Duration
+	auditor       *audit.Auditor
+	errorHandler  func(ctx context.Context, err error)
+	clientIP      api.KeyFunc
+}
+
+// GuardOption sets an optional parameter for NewGuard.
+type GuardOption func(opt *guardOption)
+
+// MaxFailures sets how many consecutive failures lock out a principal.
+// Defaults to 5.
+func MaxFailures(n int) GuardOption {
+	return func(opt *guardOption) { opt.maxFailures = n }
+}
+
+// MaxIPFailures sets how many consecutive failures lock out a client IP,
+// whatever the principals it tried. Defaults to 20; 0 disables the lockout
+// of IPs.
+func MaxIPFailures(n int) GuardOption {
+	return func(opt *guardOption) { opt.maxIPFailures = n }
+}
+
+// LockoutWindow sets the length of the first lockout, doubled by every
+// following one up to max. Defaults to 1 minute and 1 hour.
+func LockoutWindow(base, max time.Duration) GuardOption {
+	return func(opt *guardOption) {
+		opt.baseWindow = base
+		opt.maxWindow = max
+	}
+}
+
+// ResetAfter sets how long after its last failure or lockout a principal or
+// IP is forgotten, resetting its lockout window. Defaults to 24 hours.
+func ResetAfter(d time.Duration) GuardOption {
+	return func(opt *guardOption) { opt.resetAfter = d }
+}
+
+// WithAuditor records the failures, lockouts and rejected attempts in a,
+// as security events: ActionFailure, ActionLockout and ActionRejected, whose
+// Actor is the principal and Target the client IP.
+func WithAuditor(a *audit.Auditor) GuardOption {
+	return func(opt *guardOption) { opt.auditor = a }
+}
+
+// WithErrorHandler sets the function called with the errors of the Store.
+// Since they are not allowed to fail the attempts, which would let an outage
+// of the Store lock everyone out, they are dropped by default.
+func WithErrorHandler(fn func(ctx context.Context, err error)) GuardOption {
+	return func(opt *guardOption) { opt.errorHandler = fn }
+}
+
+// ClientIP sets the function returning the client IP of the requests in the
+// middlewares, such as httptransport.MakeClientIPKeyFunc with the addresses
+// of the proxies in front of the service. Defaults to
+// httptransport.ClientIPKeyFunc, the remote address of the request.
+func ClientIP(fn api.KeyFunc) GuardOption {
+	return func(opt *guardOption) { opt.clientIP = fn }
+}
+
+// Guard tracks the failed authentication attempts of principals and client
+// IPs, and locks them out.
+type Guard struct {
+	store Store
+	opts  *guardOption
+}
+
+// NewGuard creates a Guard keeping its state in store.
+func NewGuard(store Store, options ...GuardOption) *Guard {
+	opts := &guardOption{
+		maxFailures:   5,
+		maxIPFailures: 20,
+		baseWindow:    time.Minute,
+		maxWindow:     time.Hour,
+		resetAfter:    24 * time.Hour,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return &Guard{store: store, opts: opts}
+}
+
+func principalKey(principal string) string { return "principal:" + principal }
+func ipKey(ip string) string               { return "ip:" + ip }
+
+// Check fails with a *LockedError when principal or ip is locked out. Empty
+// principals and IPs are not checked.
+func (g *Guard) Check(ctx context.Context, principal, ip string) error {
+	now := time.Now()
+	for _, key := range g.keys(principal, ip) {
+		state, err := g.store.Get(ctx, key)
+		if err != nil {
+			g.fail(ctx, err)
+			continue
+		}
+
+		if state.Locked(now) {
+			g.record(ctx, ActionRejected, principal, ip, nil)
+			return &LockedError{Until: state.LockedUntil}
+		}
+	}
+
+	return nil
+}
+
+// Fail records a failed attempt of principal from ip, locking them out once
+// they reach their maximum failures.
+func (g *Guard) Fail(ctx context.Context, principal, ip string, cause error) {
+	g.record(ctx, ActionFailure, principal, ip, cause)
+
+	if principal != "" {
+		g.failKey(ctx, principalKey(principal), g.opts.maxFailures, principal, ip)
+	}
+	if ip != "" && g.opts.maxIPFailures > 0 {
+		g.failKey(ctx, ipKey(ip), g.opts.maxIPFailures, principal, ip)
+	}
+}
+
+func (g *Guard) failKey(ctx context.Context, key string, max int, principal, ip string) {
+	failures, err := g.store.Increment(ctx, key, g.opts.resetAfter)
+	if err != nil {
+		g.fail(ctx, err)
+		return
+	}
+	if max <= 0 || failures < max {
+		return
+	}
+
+	state, err := g.store.Get(ctx, key)
+	if err != nil {
+		g.fail(ctx, err)
+		return
+	}
+
+	now := time.Now()
+	if state.Locked(now) {
+		// locked out by a concurrent attempt
+		return
+	}
+
+	state.LockedUntil = now.Add(g.window(state.Lockouts))
+	state.Lockouts++
+	state.Failures = 0
+	g.record(ctx, ActionLockout, principal, ip, &LockedError{Until: state.LockedUntil})
+
+	if err := g.store.Set(ctx, key, state, state.LockedUntil.Sub(now)+g.opts.resetAfter); err != nil {
+		g.fail(ctx, err)
+	}
+}
+
+// window returns the length of the lockout following lockouts others.
+func (g *Guard) window(lockouts int) time.Duration {
+	w := g.opts.baseWindow
+	for i := 0; i < lockouts && w < g.opts.maxWindow; i++ {
+		w *= 2
+	}
+	if w > g.opts.maxWindow {
+		w = g.opts.maxWindow
+	}
+	return w
+}
+
+// Succeed forgets the failures of principal after a successful attempt. The
+// failures of the IP are kept, so an attacker owning one account can't use
+// it to try the passwords of others.
+func (g *Guard) Succeed(ctx context.Context, principal, ip string) {
+	if principal == "" {
+		return
+	}
+
+	if err := g.store.Delete(ctx, principalKey(principal)); err != nil {
+		g.fail(ctx, err)
+	}
+}
+
+func (g *Guard) keys(principal, ip string) []string {
+	keys := make([]string, 0, 2)
+	if principal != "" {
+		keys = append(keys, principalKey(principal))
+	}
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+	return keys
+}
+
+func (g *Guard) record(ctx context.Context, action, principal, ip string, err error) {
+	if g.opts.auditor == nil {
+		return
+	}
+
+	e := audit.Event{
+		Time:    time.Now(),
+		Actor:   principal,
+		Action:  action,
+		Target:  ip,
+		Outcome: audit.OutcomeFailure,
+	}
+	if e.Actor == "" {
+		e.Actor = "anonymous"
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	g.opts.auditor.Record(ctx, e)
+}
+
+func (g *Guard) fail(ctx context.Context, err error) {
+	if g.opts.errorHandler != nil {
+		g.opts.errorHandler(ctx, err)
+	}
+}
@@ -0,0 +1,111 @@
+package lockout
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/likearthian/apikit/api"
+	httptransport "github.com/likearthian/apikit/transport/http"
+)
+
+// PrincipalFunc returns the principal attempting to authenticate with
+// request, such as its username.
+type PrincipalFunc[I any] func(ctx context.Context, request I) string
+
+// LoginPrincipal is the PrincipalFunc of the requests of
+// api.MakePasswordLoginEndpoint: their username.
+func LoginPrincipal(_ context.Context, request api.LoginRequest) string {
+	return request.Username
+}
+
+// Middleware returns an endpoint Middleware rejecting the calls of the
+// principals and client IPs locked out by g with a *LockedError, and
+// recording the calls failing with an error wrapping api.ErrUnauthorized as
+// failed attempts, except api.ErrSecondFactorRequired, which only asks for a
+// one-time code. The client IP is given by the ClientIP option of g.
+//
+//	login := lockout.Middleware(guard, lockout.LoginPrincipal)(
+//		api.MakePasswordLoginEndpoint(issuer, authenticator),
+//	)
+func Middleware[I, O any](g *Guard, principal PrincipalFunc[I]) api.Middleware[I, O] {
+	return func(next api.Endpoint[I, O]) api.Endpoint[I, O] {
+		return func(ctx context.Context, request I) (O, error) {
+			p := principal(ctx, request)
+			ip := g.clientIP(ctx)
+
+			if err := g.Check(ctx, p, ip); err != nil {
+				var empty O
+				return empty, err
+			}
+
+			response, err := next(ctx, request)
+			switch {
+			case err == nil:
+				g.Succeed(ctx, p, ip)
+			case errors.Is(err, api.ErrUnauthorized) && !errors.Is(err, api.ErrSecondFactorRequired):
+				g.Fail(ctx, p, ip, err)
+			}
+
+			return response, err
+		}
+	}
+}
+
+// MakeHttpMiddleware returns an http middleware rejecting the requests of the
+// client IPs locked out by g with a 429 response, and recording the requests
+// answered with a 401 status as failed attempts of their IP. It wraps
+// authentication middlewares whose principal is not known before the
+// credentials are checked, such as httptransport.MakeHttpApikeyMiddleware:
+//
+//	handler = lockout.MakeHttpMiddleware(guard)(
+//		httptransport.MakeHttpApikeyMiddleware(manager.Validate)(handler),
+//	)
+func MakeHttpMiddleware(g *Guard) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := httptransport.PopulateRequestContext(r.Context(), r)
+			ip := g.clientIP(ctx)
+
+			if err := g.Check(ctx, "", ip); err != nil {
+				httptransport.DefaultErrorEncoder(ctx, err, w)
+				return
+			}
+
+			sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+			next.ServeHTTP(sw, r)
+
+			if sw.code == http.StatusUnauthorized {
+				g.Fail(ctx, "", ip, api.ErrUnauthorized)
+			}
+		})
+	}
+}
+
+// clientIP returns the client IP of the request of ctx.
+func (g *Guard) clientIP(ctx context.Context) string {
+	if g.opts.clientIP != nil {
+		return g.opts.clientIP(ctx)
+	}
+	return httptransport.ClientIPKeyFunc(ctx)
+}
+
+// statusWriter captures the status code of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
@@ -0,0 +1,88 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/likearthian/apikit/internal/storeutil"
+)
+
+type memoryEntry struct {
+	state     State
+	expiresAt time.Time
+}
+
+// MemoryStore is an in-memory Store, for single instance services. Expired
+// entries are evicted periodically.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	sweeper storeutil.Sweeper
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(_ context.Context, key string) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || time.Now().After(e.expiresAt) {
+		return State{}, nil
+	}
+	return e.state, nil
+}
+
+// Set implements Store.
+func (s *MemoryStore) Set(_ context.Context, key string, state State, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	s.entries[key] = memoryEntry{state: state, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// Increment implements Store.
+func (s *MemoryStore) Increment(_ context.Context, key string, ttl time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	e, ok := s.entries[key]
+	if !ok || now.After(e.expiresAt) {
+		e = memoryEntry{}
+	}
+	e.state.Failures++
+	if expiresAt := now.Add(ttl); expiresAt.After(e.expiresAt) {
+		e.expiresAt = expiresAt
+	}
+	s.entries[key] = e
+
+	return e.state.Failures, nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) sweep(now time.Time) {
+	if !s.sweeper.Due(now) {
+		return
+	}
+
+	storeutil.DeleteExpired(s.entries, now, func(e memoryEntry) time.Time { return e.expiresAt })
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/apex/log"
@@ -14,10 +15,11 @@ type apexLogFunc interface {
 }
 
 type apexLogger struct {
-	logger *log.Logger
+	logger  *log.Logger
+	keyvals []interface{}
 }
 
-func NewApexLogger(logger *log.Logger) Logger {
+func NewApexLogger(logger *log.Logger) LoggerV2 {
 	return &apexLogger{logger: logger}
 }
 
@@ -57,6 +59,10 @@ func (a *apexLogger) SetLevel(level Level) {
 }
 
 func (a *apexLogger) makeFieldLogger(keyvals ...interface{}) apexLogFunc {
+	if len(a.keyvals) > 0 {
+		keyvals = append(a.keyvals[:len(a.keyvals):len(a.keyvals)], keyvals...)
+	}
+
 	var logger *log.Entry
 	num := len(keyvals)
 	for i := 0; i < num; i += 2 {
@@ -79,3 +85,28 @@ func (a *apexLogger) makeFieldLogger(keyvals ...interface{}) apexLogFunc {
 
 	return logger
 }
+
+func (a *apexLogger) With(keyvals ...interface{}) LoggerV2 {
+	bound := append(a.keyvals[:len(a.keyvals):len(a.keyvals)], keyvals...)
+	return &apexLogger{logger: a.logger, keyvals: bound}
+}
+
+func (a *apexLogger) ErrorE(msg string, err error, keyvals ...interface{}) {
+	a.Error(msg, errorFields(err, 1, keyvals)...)
+}
+
+func (a *apexLogger) InfoCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	a.Info(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (a *apexLogger) DebugCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	a.Debug(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (a *apexLogger) WarnCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	a.Warn(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (a *apexLogger) ErrorCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	a.Error(msg, ContextFields(ctx, keyvals...)...)
+}
@@ -0,0 +1,81 @@
+package logger
+
+import "context"
+
+type contextKey struct{}
+
+// IntoContext returns a copy of ctx carrying l, for FromContext.
+func IntoContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the Logger stored in ctx by IntoContext, or a no-op
+// Logger when there is none, so it can always be used.
+func FromContext(ctx context.Context) LoggerV2 {
+	if l, ok := ctx.Value(contextKey{}).(Logger); ok {
+		return V2(l)
+	}
+	return NewNoopLogger()
+}
+
+// withLogger implements LoggerV2 over a Logger, prepending its bound fields.
+type withLogger struct {
+	logger  Logger
+	keyvals []interface{}
+}
+
+// With returns a LoggerV2 adding keyvals to the key-value pairs of every entry
+// written to l.
+func With(l Logger, keyvals ...interface{}) LoggerV2 {
+	return V2(l).With(keyvals...)
+}
+
+func (w *withLogger) With(keyvals ...interface{}) LoggerV2 {
+	return &withLogger{logger: w.logger, keyvals: w.fields(keyvals)}
+}
+
+func (w *withLogger) Info(msg string, keyvals ...interface{}) {
+	w.logger.Info(msg, w.fields(keyvals)...)
+}
+
+func (w *withLogger) Debug(msg string, keyvals ...interface{}) {
+	w.logger.Debug(msg, w.fields(keyvals)...)
+}
+
+func (w *withLogger) Warn(msg string, keyvals ...interface{}) {
+	w.logger.Warn(msg, w.fields(keyvals)...)
+}
+
+func (w *withLogger) Error(msg string, keyvals ...interface{}) {
+	w.logger.Error(msg, w.fields(keyvals)...)
+}
+
+func (w *withLogger) SetLevel(level Level) {
+	w.logger.SetLevel(level)
+}
+
+func (w *withLogger) fields(keyvals []interface{}) []interface{} {
+	fields := make([]interface{}, 0, len(w.keyvals)+len(keyvals))
+	fields = append(fields, w.keyvals...)
+	return append(fields, keyvals...)
+}
+
+func (w *withLogger) ErrorE(msg string, err error, keyvals ...interface{}) {
+	w.Error(msg, errorFields(err, 1, keyvals)...)
+}
+
+func (w *withLogger) InfoCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	w.Info(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (w *withLogger) DebugCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	w.Debug(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (w *withLogger) WarnCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	w.Warn(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (w *withLogger) ErrorCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	w.Error(msg, ContextFields(ctx, keyvals...)...)
+}
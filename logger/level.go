@@ -0,0 +1,272 @@
+package logger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var levelNames = map[Level]string{
+	DebugLevel: "debug",
+	InfoLevel:  "info",
+	WarnLevel:  "warn",
+	ErrorLevel: "error",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return "invalid"
+}
+
+// ParseLevel returns the level called name, such as "info" or "ERROR".
+// "warning" is accepted for WarnLevel.
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "warning" {
+		return WarnLevel, nil
+	}
+	for level, n := range levelNames {
+		if n == name {
+			return level, nil
+		}
+	}
+	return InvalidLevel, fmt.Errorf("unknown log level %q", name)
+}
+
+// Namer is implemented by the loggers deriving loggers with their own level
+// by name, such as LevelController.
+type Namer interface {
+	Named(name string) LoggerV2
+}
+
+// LevelController filters the entries of a Logger by a level which can be
+// changed at runtime, with Handler, and overridden for named loggers, such as
+// the loggers of noisy endpoints. It is a LoggerV2 itself, logging at the
+// global level.
+//
+// Passed to apikit.MakeEndpointLoggingMiddleware, it logs the calls of each
+// endpoint with the logger named after the endpoint.
+type LevelController struct {
+	*leveledLogger
+
+	base LoggerV2
+
+	mu        sync.RWMutex
+	level     Level
+	overrides map[string]Level
+}
+
+// NewLevelController creates a LevelController filtering the entries of l
+// below level.
+func NewLevelController(l Logger, level Level) *LevelController {
+	c := &LevelController{
+		base:      V2(l),
+		level:     level,
+		overrides: make(map[string]Level),
+	}
+	c.leveledLogger = &leveledLogger{c: c, next: c.base}
+	c.apply()
+
+	return c
+}
+
+// Named returns the logger called name, logging at the level overriding the
+// global one for name, if any.
+func (c *LevelController) Named(name string) LoggerV2 {
+	return &leveledLogger{c: c, name: name, next: c.base}
+}
+
+// SetLevel sets the global level.
+func (c *LevelController) SetLevel(level Level) {
+	c.mu.Lock()
+	c.level = level
+	c.mu.Unlock()
+	c.apply()
+}
+
+// SetOverride sets the level of the logger called name, or removes its
+// override when level is InvalidLevel.
+func (c *LevelController) SetOverride(name string, level Level) {
+	c.mu.Lock()
+	if level == InvalidLevel {
+		delete(c.overrides, name)
+	} else {
+		c.overrides[name] = level
+	}
+	c.mu.Unlock()
+	c.apply()
+}
+
+// Levels returns the global level and the overrides.
+func (c *LevelController) Levels() (Level, map[string]Level) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	overrides := make(map[string]Level, len(c.overrides))
+	for name, level := range c.overrides {
+		overrides[name] = level
+	}
+	return c.level, overrides
+}
+
+// levelsBody is the body of the requests and responses of Handler.
+type levelsBody struct {
+	Level     string            `json:"level,omitempty"`
+	Name      string            `json:"name,omitempty"`
+	Overrides map[string]string `json:"overrides,omitempty"`
+}
+
+// Handler returns the admin http.Handler, to be mounted on a path such as
+// /internal/loglevel, of c. GET returns the levels:
+//
+//	{"level": "info", "overrides": {"reports.export": "error"}}
+//
+// PUT changes the global level with {"level": "debug"}, or the level of a
+// named logger with {"name": "reports.export", "level": "error"}, an empty
+// level removing the override, and returns the new levels.
+func (c *LevelController) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPut:
+			var body levelsBody
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			level := InvalidLevel
+			if body.Level != "" || body.Name == "" {
+				var err error
+				if level, err = ParseLevel(body.Level); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+
+			if body.Name == "" {
+				c.SetLevel(level)
+			} else {
+				c.SetOverride(body.Name, level)
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		level, overrides := c.Levels()
+		body := levelsBody{Level: level.String(), Overrides: make(map[string]string, len(overrides))}
+		for name, level := range overrides {
+			body.Overrides[name] = level.String()
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method != http.MethodHead {
+			json.NewEncoder(w).Encode(body)
+		}
+	})
+}
+
+// enabled reports whether the logger called name logs entries at level.
+func (c *LevelController) enabled(name string, level Level) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	threshold := c.level
+	if override, ok := c.overrides[name]; ok && name != "" {
+		threshold = override
+	}
+	return level >= threshold
+}
+
+// apply sets the level of the underlying logger to the lowest level in use,
+// so it doesn't drop the entries of a more verbose named logger.
+func (c *LevelController) apply() {
+	c.mu.RLock()
+	lowest := c.level
+	for _, level := range c.overrides {
+		if level < lowest {
+			lowest = level
+		}
+	}
+	c.mu.RUnlock()
+
+	c.base.SetLevel(lowest)
+}
+
+// leveledLogger is a logger of a LevelController.
+type leveledLogger struct {
+	c    *LevelController
+	name string
+	next LoggerV2
+}
+
+func (l *leveledLogger) Info(msg string, keyvals ...interface{}) {
+	if l.c.enabled(l.name, InfoLevel) {
+		l.next.Info(msg, keyvals...)
+	}
+}
+
+func (l *leveledLogger) Debug(msg string, keyvals ...interface{}) {
+	if l.c.enabled(l.name, DebugLevel) {
+		l.next.Debug(msg, keyvals...)
+	}
+}
+
+func (l *leveledLogger) Warn(msg string, keyvals ...interface{}) {
+	if l.c.enabled(l.name, WarnLevel) {
+		l.next.Warn(msg, keyvals...)
+	}
+}
+
+func (l *leveledLogger) Error(msg string, keyvals ...interface{}) {
+	if l.c.enabled(l.name, ErrorLevel) {
+		l.next.Error(msg, keyvals...)
+	}
+}
+
+// SetLevel sets the override of the named logger, or the global level.
+func (l *leveledLogger) SetLevel(level Level) {
+	if l.name == "" {
+		l.c.SetLevel(level)
+		return
+	}
+	l.c.SetOverride(l.name, level)
+}
+
+func (l *leveledLogger) Named(name string) LoggerV2 {
+	return &leveledLogger{c: l.c, name: name, next: l.next}
+}
+
+func (l *leveledLogger) With(keyvals ...interface{}) LoggerV2 {
+	return &leveledLogger{c: l.c, name: l.name, next: l.next.With(keyvals...)}
+}
+
+func (l *leveledLogger) ErrorE(msg string, err error, keyvals ...interface{}) {
+	if l.c.enabled(l.name, ErrorLevel) {
+		l.next.Error(msg, errorFields(err, 1, keyvals)...)
+	}
+}
+
+func (l *leveledLogger) InfoCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.Info(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (l *leveledLogger) DebugCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.Debug(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (l *leveledLogger) WarnCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.Warn(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (l *leveledLogger) ErrorCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	l.Error(msg, ContextFields(ctx, keyvals...)...)
+}
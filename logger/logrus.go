@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/sirupsen/logrus"
@@ -14,11 +15,12 @@ type logrusLogFunc interface {
 }
 
 type ruslog struct {
-	logger *logrus.Logger
+	logger  *logrus.Logger
+	keyvals []interface{}
 }
 
-func NewRusLog(logger *logrus.Logger) Logger {
-	return &ruslog{logger}
+func NewRusLog(logger *logrus.Logger) LoggerV2 {
+	return &ruslog{logger: logger}
 }
 
 func (rl *ruslog) Info(msg string, keyvals ...interface{}) {
@@ -57,6 +59,10 @@ func (rl *ruslog) SetLevel(level Level) {
 }
 
 func (rl *ruslog) makeFieldLogger(keyvals ...interface{}) logrusLogFunc {
+	if len(rl.keyvals) > 0 {
+		keyvals = append(rl.keyvals[:len(rl.keyvals):len(rl.keyvals)], keyvals...)
+	}
+
 	var logger *logrus.Entry
 	num := len(keyvals)
 	for i := 0; i < num; i += 2 {
@@ -79,3 +85,28 @@ func (rl *ruslog) makeFieldLogger(keyvals ...interface{}) logrusLogFunc {
 
 	return logger
 }
+
+func (rl *ruslog) With(keyvals ...interface{}) LoggerV2 {
+	bound := append(rl.keyvals[:len(rl.keyvals):len(rl.keyvals)], keyvals...)
+	return &ruslog{logger: rl.logger, keyvals: bound}
+}
+
+func (rl *ruslog) ErrorE(msg string, err error, keyvals ...interface{}) {
+	rl.Error(msg, errorFields(err, 1, keyvals)...)
+}
+
+func (rl *ruslog) InfoCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	rl.Info(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (rl *ruslog) DebugCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	rl.Debug(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (rl *ruslog) WarnCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	rl.Warn(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (rl *ruslog) ErrorCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	rl.Error(msg, ContextFields(ctx, keyvals...)...)
+}
@@ -1,8 +1,10 @@
 package logger
 
+import "context"
+
 type noop struct{}
 
-func NewNoopLogger() Logger {
+func NewNoopLogger() LoggerV2 {
 	return noop{}
 }
 
@@ -25,3 +27,27 @@ func (n noop) Error(msg string, keyvals ...interface{}) {
 func (n noop) SetLevel(level Level) {
 	return
 }
+
+func (n noop) With(keyvals ...interface{}) LoggerV2 {
+	return n
+}
+
+func (n noop) ErrorE(msg string, err error, keyvals ...interface{}) {
+	return
+}
+
+func (n noop) InfoCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	return
+}
+
+func (n noop) DebugCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	return
+}
+
+func (n noop) WarnCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	return
+}
+
+func (n noop) ErrorCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	return
+}
@@ -0,0 +1,83 @@
+//go:build go1.21
+
+package logger
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+	level  *slog.LevelVar
+}
+
+// NewSlogLogger returns a Logger writing to logger. Until SetLevel is
+// called, the level of its handler applies.
+func NewSlogLogger(logger *slog.Logger) LoggerV2 {
+	s := &slogLogger{logger: logger, level: new(slog.LevelVar)}
+	s.level.Set(slog.LevelDebug)
+	return s
+}
+
+func (s *slogLogger) Info(msg string, keyvals ...interface{}) {
+	s.log(slog.LevelInfo, msg, keyvals...)
+}
+
+func (s *slogLogger) Debug(msg string, keyvals ...interface{}) {
+	s.log(slog.LevelDebug, msg, keyvals...)
+}
+
+func (s *slogLogger) Warn(msg string, keyvals ...interface{}) {
+	s.log(slog.LevelWarn, msg, keyvals...)
+}
+
+func (s *slogLogger) Error(msg string, keyvals ...interface{}) {
+	s.log(slog.LevelError, msg, keyvals...)
+}
+
+func (s *slogLogger) SetLevel(level Level) {
+	switch level {
+	case DebugLevel:
+		s.level.Set(slog.LevelDebug)
+	case InfoLevel:
+		s.level.Set(slog.LevelInfo)
+	case WarnLevel:
+		s.level.Set(slog.LevelWarn)
+	case ErrorLevel:
+		s.level.Set(slog.LevelError)
+	default:
+		s.level.Set(slog.LevelInfo)
+	}
+}
+
+func (s *slogLogger) log(level slog.Level, msg string, keyvals ...interface{}) {
+	if level < s.level.Level() {
+		return
+	}
+	s.logger.Log(context.Background(), level, msg, keyvals...)
+}
+
+func (s *slogLogger) With(keyvals ...interface{}) LoggerV2 {
+	return &slogLogger{logger: s.logger.With(keyvals...), level: s.level}
+}
+
+func (s *slogLogger) ErrorE(msg string, err error, keyvals ...interface{}) {
+	s.Error(msg, errorFields(err, 1, keyvals)...)
+}
+
+func (s *slogLogger) InfoCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	s.Info(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (s *slogLogger) DebugCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	s.Debug(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (s *slogLogger) WarnCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	s.Warn(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (s *slogLogger) ErrorCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	s.Error(msg, ContextFields(ctx, keyvals...)...)
+}
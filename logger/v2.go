@@ -0,0 +1,111 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// LoggerV2 is a Logger binding fields with With, logging errors with their
+// stack trace with ErrorE, and adding the fields of a context, such as the
+// request and trace ids, with the Ctx methods. The adapters of this package
+// implement it; V2 upgrades any other Logger.
+type LoggerV2 interface {
+	Logger
+
+	// With returns a LoggerV2 adding keyvals to every entry.
+	With(keyvals ...interface{}) LoggerV2
+
+	// ErrorE logs msg at error level with err and its stack trace: the one
+	// carried by err, such as those of github.com/pkg/errors, or else the
+	// stack of the caller.
+	ErrorE(msg string, err error, keyvals ...interface{})
+
+	InfoCtx(ctx context.Context, msg string, keyvals ...interface{})
+	DebugCtx(ctx context.Context, msg string, keyvals ...interface{})
+	WarnCtx(ctx context.Context, msg string, keyvals ...interface{})
+	ErrorCtx(ctx context.Context, msg string, keyvals ...interface{})
+}
+
+// V2 returns l as a LoggerV2, wrapping it when it doesn't implement it.
+func V2(l Logger) LoggerV2 {
+	if v2, ok := l.(LoggerV2); ok {
+		return v2
+	}
+	return &withLogger{logger: l}
+}
+
+// ContextFieldsFunc returns the key-value pairs to add to the entries logged
+// with a context, or nil.
+type ContextFieldsFunc func(ctx context.Context) []interface{}
+
+var (
+	contextFieldsMu sync.RWMutex
+	contextFields   []ContextFieldsFunc
+)
+
+// RegisterContextFields adds fn to the functions extracting fields from the
+// context of the Ctx methods. The http transport registers one adding the
+// request and trace ids.
+func RegisterContextFields(fn ContextFieldsFunc) {
+	contextFieldsMu.Lock()
+	defer contextFieldsMu.Unlock()
+	contextFields = append(contextFields, fn)
+}
+
+// ContextFields returns the fields extracted from ctx by the registered
+// ContextFieldsFuncs, followed by keyvals.
+func ContextFields(ctx context.Context, keyvals ...interface{}) []interface{} {
+	contextFieldsMu.RLock()
+	defer contextFieldsMu.RUnlock()
+
+	var fields []interface{}
+	for _, fn := range contextFields {
+		fields = append(fields, fn(ctx)...)
+	}
+	if len(fields) == 0 {
+		return keyvals
+	}
+
+	return append(fields, keyvals...)
+}
+
+// errorFields returns keyvals followed by the error and stack fields of err,
+// skipping skip frames of the caller stack when err carries none.
+func errorFields(err error, skip int, keyvals []interface{}) []interface{} {
+	fields := make([]interface{}, 0, len(keyvals)+4)
+	fields = append(fields, keyvals...)
+	if err == nil {
+		return fields
+	}
+
+	fields = append(fields, "error", err.Error())
+
+	// errors carrying a stack print it with %+v
+	if _, ok := err.(fmt.Formatter); ok {
+		if verbose := fmt.Sprintf("%+v", err); verbose != err.Error() {
+			return append(fields, "stack", verbose)
+		}
+	}
+
+	return append(fields, "stack", callerStack(skip+1))
+}
+
+func callerStack(skip int) string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var sb strings.Builder
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&sb, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+
+	return sb.String()
+}
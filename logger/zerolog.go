@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"context"
+
 	"github.com/rs/zerolog"
 )
 
@@ -8,7 +10,7 @@ type zlog struct {
 	logger zerolog.Logger
 }
 
-func NewZerolog(logger zerolog.Logger) Logger {
+func NewZerolog(logger zerolog.Logger) LoggerV2 {
 	return &zlog{logger}
 }
 
@@ -42,3 +44,27 @@ func (z *zlog) SetLevel(level Level) {
 		z.logger = z.logger.Level(zerolog.InfoLevel)
 	}
 }
+
+func (z *zlog) With(keyvals ...interface{}) LoggerV2 {
+	return &zlog{z.logger.With().Fields(keyvals).Logger()}
+}
+
+func (z *zlog) ErrorE(msg string, err error, keyvals ...interface{}) {
+	z.Error(msg, errorFields(err, 1, keyvals)...)
+}
+
+func (z *zlog) InfoCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	z.Info(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (z *zlog) DebugCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	z.Debug(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (z *zlog) WarnCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	z.Warn(msg, ContextFields(ctx, keyvals...)...)
+}
+
+func (z *zlog) ErrorCtx(ctx context.Context, msg string, keyvals ...interface{}) {
+	z.Error(msg, ContextFields(ctx, keyvals...)...)
+}
@@ -2,29 +2,84 @@ package apikit
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/likearthian/apikit/api"
 	log "github.com/likearthian/apikit/logger"
-	"github.com/likearthian/go-http/router"
+	httptransport "github.com/likearthian/apikit/transport/http"
 )
 
-func MakeEndpointLoggingMiddleware[I, O any](logger log.Logger, endPointMethod string) api.Middleware[I, O] {
+type loggingOption struct {
+	every     uint64
+	rateLimit int
+	slow      time.Duration
+}
+
+// LoggingOption sets an optional parameter for MakeEndpointLoggingMiddleware.
+type LoggingOption func(opt *loggingOption)
+
+// LogSampleEvery logs only one in n successful calls. Failed calls are always
+// logged.
+func LogSampleEvery(n int) LoggingOption {
+	return func(opt *loggingOption) {
+		if n > 0 {
+			opt.every = uint64(n)
+		}
+	}
+}
+
+// LogRateLimit logs at most perSecond successful calls per second, the
+// others being dropped. Failed calls are always logged.
+func LogRateLimit(perSecond int) LoggingOption {
+	return func(opt *loggingOption) { opt.rateLimit = perSecond }
+}
+
+// LogSlowCalls always logs the calls lasting longer than threshold in full,
+// with their request and response, at warn level, whatever the sampling.
+func LogSlowCalls(threshold time.Duration) LoggingOption {
+	return func(opt *loggingOption) { opt.slow = threshold }
+}
+
+// MakeEndpointLoggingMiddleware returns a Middleware logging the calls of the
+// endpoint endPointMethod, or of the endpoint stored by api.EndpointMiddleware,
+// with their request id and duration. Calls failing
+// with a server error are logged at error level, and the others at info
+// level unless sampled out by the options. With a logger.LevelController,
+// the level overriding the global one for the endpoint applies.
+func MakeEndpointLoggingMiddleware[I, O any](logger log.Logger, endPointMethod string, options ...LoggingOption) api.Middleware[I, O] {
 	if logger == nil {
 		return nil
 	}
 
+	opts := &loggingOption{every: 1}
+	for _, option := range options {
+		option(opts)
+	}
+
+	var calls uint64
+	limiter := &logLimiter{perSecond: opts.rateLimit}
+
 	return func(next api.Endpoint[I, O]) api.Endpoint[I, O] {
 		return func(ctx context.Context, request I) (O, error) {
-			reqid, ok := router.ReqIDFromContext(ctx)
+			reqid, ok := ReqIDFromContext(ctx)
 			if !ok {
-				reqid = ""
+				// generated once, for the endpoint and its encoders to share
+				reqid = httptransport.NewRequestID()
+				ctx = context.WithValue(ctx, httptransport.ContextKeyRequestXRequestID, reqid)
+			}
+
+			endpoint := api.EndpointNameFromContext(ctx, endPointMethod)
+			epLogger := logger
+			if named, ok := logger.(log.Namer); ok {
+				epLogger = named.Named(endpoint)
 			}
 
 			var fields = []interface{}{
 				"event", "endpoint return",
 				"request-id", reqid,
-				"endpoint", endPointMethod,
+				"endpoint", endpoint,
 				"ts", time.Now(),
 			}
 
@@ -33,7 +88,8 @@ func MakeEndpointLoggingMiddleware[I, O any](logger log.Logger, endPointMethod s
 			isErrLog := false
 
 			defer func(begin time.Time) {
-				fields = append(fields, "duration", time.Since(begin))
+				duration := time.Since(begin)
+				fields = append(fields, "duration", duration)
 				if err != nil {
 					fields = append(fields, "error", err.Error())
 					code := Err2code(err)
@@ -43,18 +99,62 @@ func MakeEndpointLoggingMiddleware[I, O any](logger log.Logger, endPointMethod s
 				}
 
 				if isErrLog {
-					logger.Error("request failed", fields...)
+					epLogger.Error("request failed", fields...)
 					return
 				}
 
-				logger.Info("request success", fields...)
+				if opts.slow > 0 && duration > opts.slow {
+					fields = append(fields, "request", request, "response", result)
+					epLogger.Warn("slow request", fields...)
+					return
+				}
+
+				if err == nil {
+					if atomic.AddUint64(&calls, 1)%opts.every != 0 || !limiter.allow() {
+						return
+					}
+				}
+
+				epLogger.Info("request success", fields...)
 			}(time.Now())
 
 			result, err = next(ctx, request)
 			if err != nil {
-				result = ErrorResponse(reqid, 500, err)
+				if res, ok := any(ErrorResponse(reqid, 500, err)).(O); ok {
+					result = res
+				}
 			}
 			return result, err
 		}
 	}
 }
+
+// logLimiter allows up to perSecond entries per second, or any number when
+// perSecond is not positive.
+type logLimiter struct {
+	perSecond int
+
+	mu     sync.Mutex
+	window time.Time
+	count  int
+}
+
+func (l *logLimiter) allow() bool {
+	if l.perSecond <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.window) >= time.Second {
+		l.window = now
+		l.count = 0
+	}
+	if l.count >= l.perSecond {
+		return false
+	}
+	l.count++
+	return true
+}
@@ -0,0 +1,201 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/likearthian/apikit"
+	"github.com/likearthian/apikit/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds the Prometheus collectors shared by every instrumented
+// endpoint of a service.
+type Metrics struct {
+	requests   *prometheus.CounterVec
+	errors     *prometheus.CounterVec
+	latency    *prometheus.HistogramVec
+	statusFunc func(error) int
+}
+
+type metricsOption struct {
+	subsystem  string
+	registerer prometheus.Registerer
+	buckets    []float64
+	statusFunc func(error) int
+}
+
+// MetricsOption sets an optional parameter for Metrics.
+type MetricsOption func(opt *metricsOption)
+
+// WithSubsystem sets the Prometheus subsystem of the collectors.
+func WithSubsystem(subsystem string) MetricsOption {
+	return func(opt *metricsOption) { opt.subsystem = subsystem }
+}
+
+// WithRegisterer sets the registerer the collectors are registered with.
+// Defaults to prometheus.DefaultRegisterer.
+func WithRegisterer(reg prometheus.Registerer) MetricsOption {
+	return func(opt *metricsOption) { opt.registerer = reg }
+}
+
+// WithBuckets sets the latency histogram buckets, in seconds. Defaults to
+// prometheus.DefBuckets.
+func WithBuckets(buckets []float64) MetricsOption {
+	return func(opt *metricsOption) { opt.buckets = buckets }
+}
+
+// WithStatusFunc sets the function mapping endpoint errors to an HTTP status
+// code, used to derive the status class label. Defaults to apikit.Err2code.
+func WithStatusFunc(fn func(error) int) MetricsOption {
+	return func(opt *metricsOption) { opt.statusFunc = fn }
+}
+
+// NewMetrics creates and registers the request counter, error counter and
+// latency histogram under the given namespace. All of them are labeled by
+// endpoint and status_class.
+func NewMetrics(namespace string, options ...MetricsOption) *Metrics {
+	opts := &metricsOption{
+		registerer: prometheus.DefaultRegisterer,
+		buckets:    prometheus.DefBuckets,
+		statusFunc: apikit.Err2code,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	labels := []string{"endpoint", "status_class"}
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: opts.subsystem,
+			Name:      "requests_total",
+			Help:      "Number of endpoint invocations.",
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: opts.subsystem,
+			Name:      "errors_total",
+			Help:      "Number of endpoint invocations that returned an error.",
+		}, labels),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: opts.subsystem,
+			Name:      "request_duration_seconds",
+			Help:      "Endpoint invocation latency in seconds.",
+			Buckets:   opts.buckets,
+		}, labels),
+		statusFunc: opts.statusFunc,
+	}
+
+	opts.registerer.MustRegister(m.requests, m.errors, m.latency)
+	return m
+}
+
+// Observe records a single invocation of the named endpoint.
+func (m *Metrics) Observe(endpoint string, err error, duration time.Duration) {
+	class := "2xx"
+	if err != nil {
+		class = StatusClass(m.statusFunc(err))
+		m.errors.WithLabelValues(endpoint, class).Inc()
+	}
+
+	m.requests.WithLabelValues(endpoint, class).Inc()
+	m.latency.WithLabelValues(endpoint, class).Observe(duration.Seconds())
+}
+
+// InstrumentingMiddleware returns a Middleware recording the invocations of
+// the next endpoint under the given endpoint name, or the name of the
+// endpoint stored by api.EndpointMiddleware.
+func InstrumentingMiddleware[I, O any](m *Metrics, endpointName string) api.Middleware[I, O] {
+	return func(next api.Endpoint[I, O]) api.Endpoint[I, O] {
+		return func(ctx context.Context, request I) (response O, err error) {
+			defer func(begin time.Time) {
+				m.Observe(api.EndpointNameFromContext(ctx, endpointName), err, time.Since(begin))
+			}(time.Now())
+
+			return next(ctx, request)
+		}
+	}
+}
+
+// RegisterBulkhead registers gauges of the calls in progress and waiting in
+// b, labeled with the given endpoint name, under namespace. Only the
+// subsystem and registerer options apply.
+func RegisterBulkhead(namespace, endpoint string, b *api.Bulkhead, options ...MetricsOption) {
+	opts := &metricsOption{registerer: prometheus.DefaultRegisterer}
+	for _, option := range options {
+		option(opts)
+	}
+
+	labels := prometheus.Labels{"endpoint": endpoint}
+	opts.registerer.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   opts.subsystem,
+			Name:        "in_flight_requests",
+			Help:        "Number of endpoint invocations in progress.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(b.InFlight()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   opts.subsystem,
+			Name:        "queued_requests",
+			Help:        "Number of endpoint invocations waiting for a concurrency slot.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(b.Queued()) }),
+	)
+}
+
+// NewDeprecationCounter creates and registers a counter of the calls to
+// deprecated endpoints under namespace, labeled by route and caller, and
+// returns the function incrementing it, for
+// httptransport.DeprecationCounter. Only the subsystem and registerer options
+// apply.
+func NewDeprecationCounter(namespace string, options ...MetricsOption) func(route, caller string) {
+	opts := &metricsOption{registerer: prometheus.DefaultRegisterer}
+	for _, option := range options {
+		option(opts)
+	}
+
+	calls := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: opts.subsystem,
+		Name:      "deprecated_requests_total",
+		Help:      "Number of calls to deprecated endpoints.",
+	}, []string{"route", "caller"})
+	opts.registerer.MustRegister(calls)
+
+	return func(route, caller string) {
+		calls.WithLabelValues(route, caller).Inc()
+	}
+}
+
+// StatusClass returns the class of an HTTP status code, e.g. "4xx".
+func StatusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "5xx"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// Handler returns the Prometheus scrape handler for the default gatherer.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// HandlerFor returns the Prometheus scrape handler for the given gatherer.
+func HandlerFor(gatherer prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+}
+
+// Mount registers the Prometheus scrape handler on mux under path, e.g.
+// metrics.Mount(r, "/metrics") with a chi router or an http.ServeMux.
+func Mount(mux interface {
+	Handle(pattern string, handler http.Handler)
+}, path string) {
+	mux.Handle(path, Handler())
+}
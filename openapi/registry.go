@@ -0,0 +1,412 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Version is the OpenAPI specification version emitted by the Registry.
+const Version = "3.1.0"
+
+var pathParamPattern = regexp.MustCompile(`\{([^}:]+)(?::[^}]*)?\}`)
+
+// Operation holds the metadata recorded for a single method+path registration.
+type Operation struct {
+	Method       string
+	Path         string
+	OperationID  string
+	Summary      string
+	Description  string
+	Tags         []string
+	Auth         []string
+	Deprecated   bool
+	RequestType  reflect.Type
+	ResponseType reflect.Type
+	StatusCode   int
+	ContentType  string
+}
+
+// OperationOption annotates an Operation.
+type OperationOption func(op *Operation)
+
+// Summary sets the operation summary.
+func Summary(summary string) OperationOption {
+	return func(op *Operation) { op.Summary = summary }
+}
+
+// Description sets the operation description.
+func Description(desc string) OperationOption {
+	return func(op *Operation) { op.Description = desc }
+}
+
+// OperationID sets the operation id. By default it is derived from the method
+// and path.
+func OperationID(id string) OperationOption {
+	return func(op *Operation) { op.OperationID = id }
+}
+
+// Tags groups the operation under the given tags.
+func Tags(tags ...string) OperationOption {
+	return func(op *Operation) { op.Tags = append(op.Tags, tags...) }
+}
+
+// Auth requires one of the named security schemes, registered with
+// WithSecurityScheme, to call the operation.
+func Auth(schemes ...string) OperationOption {
+	return func(op *Operation) { op.Auth = append(op.Auth, schemes...) }
+}
+
+// Deprecated flags the operation as deprecated.
+func Deprecated() OperationOption {
+	return func(op *Operation) { op.Deprecated = true }
+}
+
+// ResponseStatus sets the status code of the successful response. Defaults to
+// 200.
+func ResponseStatus(code int) OperationOption {
+	return func(op *Operation) { op.StatusCode = code }
+}
+
+// ResponseContentType sets the content type of the successful response.
+// Defaults to application/json.
+func ResponseContentType(contentType string) OperationOption {
+	return func(op *Operation) { op.ContentType = contentType }
+}
+
+// ResponseOf overrides the documented response type, e.g. to describe the
+// payload carried in the Data field of apikit.BaseResponse.
+func ResponseOf(v interface{}) OperationOption {
+	return func(op *Operation) { op.ResponseType = reflect.TypeOf(v) }
+}
+
+// Registry collects operations and renders them as an OpenAPI document.
+type Registry struct {
+	mu              sync.RWMutex
+	info            Info
+	servers         []Server
+	securitySchemes map[string]*SecurityScheme
+	operations      []Operation
+}
+
+type registryOption struct {
+	description     string
+	servers         []Server
+	securitySchemes map[string]*SecurityScheme
+}
+
+// RegistryOption sets an optional parameter for registries.
+type RegistryOption func(opt *registryOption)
+
+// WithDescription sets the API description.
+func WithDescription(desc string) RegistryOption {
+	return func(opt *registryOption) { opt.description = desc }
+}
+
+// WithServer adds a server URL to the document.
+func WithServer(url, description string) RegistryOption {
+	return func(opt *registryOption) {
+		opt.servers = append(opt.servers, Server{URL: url, Description: description})
+	}
+}
+
+// WithSecurityScheme declares a security scheme that operations can refer to
+// with the Auth option.
+func WithSecurityScheme(name string, scheme *SecurityScheme) RegistryOption {
+	return func(opt *registryOption) { opt.securitySchemes[name] = scheme }
+}
+
+// NewRegistry creates an empty Registry for the API with the given title and
+// version.
+func NewRegistry(title, version string, options ...RegistryOption) *Registry {
+	opts := &registryOption{securitySchemes: make(map[string]*SecurityScheme)}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return &Registry{
+		info:            Info{Title: title, Version: version, Description: opts.description},
+		servers:         opts.servers,
+		securitySchemes: opts.securitySchemes,
+	}
+}
+
+// Register records an operation whose endpoint takes I and returns O. It is
+// meant to be called next to NewServer, with the same type parameters as the
+// endpoint.
+func Register[I, O any](r *Registry, method, path string, options ...OperationOption) {
+	op := Operation{
+		Method:       strings.ToUpper(method),
+		Path:         path,
+		RequestType:  reflect.TypeOf((*I)(nil)).Elem(),
+		ResponseType: reflect.TypeOf((*O)(nil)).Elem(),
+		StatusCode:   http.StatusOK,
+		ContentType:  "application/json",
+	}
+
+	for _, option := range options {
+		option(&op)
+	}
+
+	r.Add(op)
+}
+
+// Add records an already built operation.
+func (r *Registry) Add(op Operation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.operations = append(r.operations, op)
+}
+
+// Operations returns a copy of the registered operations.
+func (r *Registry) Operations() []Operation {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ops := make([]Operation, len(r.operations))
+	copy(ops, r.operations)
+	return ops
+}
+
+// Spec builds the OpenAPI document from the registered operations.
+func (r *Registry) Spec() *Document {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	gen := newSchemaGenerator()
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    r.info,
+		Servers: r.servers,
+		Paths:   make(map[string]*PathItem),
+	}
+
+	for _, op := range r.operations {
+		path := pathParamPattern.ReplaceAllString(op.Path, "{$1}")
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = &PathItem{}
+			doc.Paths[path] = item
+		}
+
+		setOperation(item, op.Method, buildOperation(gen, op))
+	}
+
+	if len(gen.schemas) > 0 || len(r.securitySchemes) > 0 {
+		doc.Components = &Components{}
+		if len(gen.schemas) > 0 {
+			doc.Components.Schemas = gen.schemas
+		}
+		if len(r.securitySchemes) > 0 {
+			doc.Components.SecuritySchemes = r.securitySchemes
+		}
+	}
+
+	return doc
+}
+
+// SpecJSON renders the document as JSON.
+func (r *Registry) SpecJSON() ([]byte, error) {
+	return json.MarshalIndent(r.Spec(), "", "  ")
+}
+
+// SpecYAML renders the document as YAML.
+func (r *Registry) SpecYAML() ([]byte, error) {
+	return yaml.Marshal(r.Spec())
+}
+
+// Handler returns an http.Handler serving the document, as YAML when the
+// request path ends with .yaml or .yml and as JSON otherwise.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var (
+			body        []byte
+			err         error
+			contentType = "application/json; charset=utf-8"
+		)
+
+		if strings.HasSuffix(req.URL.Path, ".yaml") || strings.HasSuffix(req.URL.Path, ".yml") {
+			body, err = r.SpecYAML()
+			contentType = "application/yaml; charset=utf-8"
+		} else {
+			body, err = r.SpecJSON()
+		}
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Write(body)
+	})
+}
+
+func buildOperation(gen *schemaGenerator, op Operation) *OperationObject {
+	obj := &OperationObject{
+		OperationID: op.OperationID,
+		Summary:     op.Summary,
+		Description: op.Description,
+		Tags:        op.Tags,
+		Deprecated:  op.Deprecated,
+		Responses:   make(map[string]Response),
+	}
+
+	if obj.OperationID == "" {
+		obj.OperationID = defaultOperationID(op.Method, op.Path)
+	}
+
+	pathParams := make(map[string]struct{})
+	for _, m := range pathParamPattern.FindAllStringSubmatch(op.Path, -1) {
+		pathParams[m[1]] = struct{}{}
+	}
+
+	if op.RequestType != nil {
+		obj.Parameters = buildParameters(gen, op.RequestType, pathParams)
+		if hasBody(op.Method) {
+			obj.RequestBody = &RequestBody{
+				Required: true,
+				Content: map[string]MediaType{
+					"application/json": {Schema: gen.schemaOf(op.RequestType)},
+				},
+			}
+		}
+	}
+
+	// make sure every path parameter is documented even if the request type
+	// doesn't bind it.
+	for name := range pathParams {
+		if !hasParameter(obj.Parameters, name, "path") {
+			obj.Parameters = append(obj.Parameters, Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+
+	resp := Response{Description: http.StatusText(op.StatusCode)}
+	if op.ResponseType != nil && op.StatusCode != http.StatusNoContent {
+		resp.Content = map[string]MediaType{
+			op.ContentType: {Schema: gen.schemaOf(op.ResponseType)},
+		}
+	}
+	obj.Responses[strconv.Itoa(op.StatusCode)] = resp
+	obj.Responses["default"] = Response{Description: "Error"}
+
+	for _, scheme := range op.Auth {
+		obj.Security = append(obj.Security, map[string][]string{scheme: {}})
+	}
+
+	return obj
+}
+
+// buildParameters documents the fields of the request type bound from the
+// path, query string, headers and cookies.
+func buildParameters(gen *schemaGenerator, typ reflect.Type, pathParams map[string]struct{}) []Parameter {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var params []Parameter
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		var param *Parameter
+		for _, in := range []string{"path", "query", "header", "cookie"} {
+			name, _ := tagName(field.Tag.Get(in))
+			if name == "" || name == "-" {
+				continue
+			}
+
+			location := in
+			if _, ok := pathParams[name]; ok && in == "query" {
+				location = "path"
+			}
+			param = &Parameter{Name: name, In: location}
+			break
+		}
+
+		if param == nil {
+			// untagged nested structs are bound field by field by the binders.
+			if fieldType.Kind() == reflect.Struct && fieldType != timeType && field.Tag.Get("json") == "" {
+				params = append(params, buildParameters(gen, fieldType, pathParams)...)
+			}
+			continue
+		}
+
+		param.Schema = gen.schemaOf(field.Type)
+		param.Description = field.Tag.Get("description")
+		param.Required = param.In == "path" || applyValidateTag(param.Schema, field.Tag.Get("validate"))
+		if hasParameter(params, param.Name, param.In) {
+			continue
+		}
+		params = append(params, *param)
+	}
+
+	sort.SliceStable(params, func(i, j int) bool {
+		return params[i].In == "path" && params[j].In != "path"
+	})
+
+	return params
+}
+
+func hasParameter(params []Parameter, name, in string) bool {
+	for _, p := range params {
+		if p.Name == name && p.In == in {
+			return true
+		}
+	}
+	return false
+}
+
+func hasBody(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return true
+	}
+	return false
+}
+
+func setOperation(item *PathItem, method string, op *OperationObject) {
+	switch method {
+	case http.MethodGet:
+		item.Get = op
+	case http.MethodPut:
+		item.Put = op
+	case http.MethodPost:
+		item.Post = op
+	case http.MethodDelete:
+		item.Delete = op
+	case http.MethodOptions:
+		item.Options = op
+	case http.MethodHead:
+		item.Head = op
+	case http.MethodPatch:
+		item.Patch = op
+	}
+}
+
+func defaultOperationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '-' || r == '_' || r == '.' || r == ':'
+	}) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
@@ -0,0 +1,258 @@
+package openapi
+
+import (
+	"encoding"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// schemaGenerator converts Go types into JSON schemas, collecting named struct
+// types into reusable component schemas.
+type schemaGenerator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{
+		schemas: make(map[string]*Schema),
+		names:   make(map[reflect.Type]string),
+	}
+}
+
+func (g *schemaGenerator) schemaOf(typ reflect.Type) *Schema {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch {
+	case typ == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case typ == durationType:
+		return &Schema{Type: "string", Format: "duration"}
+	case typ.Kind() != reflect.Struct && reflect.PtrTo(typ).Implements(textUnmarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schemaOf(typ.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaOf(typ.Elem())}
+	case reflect.Struct:
+		return g.structRef(typ)
+	}
+
+	// interface{} and other dynamic types accept any value.
+	return &Schema{}
+}
+
+func (g *schemaGenerator) structRef(typ reflect.Type) *Schema {
+	if typ.Name() == "" {
+		return g.structSchema(typ)
+	}
+
+	if name, ok := g.names[typ]; ok {
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+
+	name := g.uniqueName(typ)
+	g.names[typ] = name
+	// register a placeholder first so recursive types resolve to the reference.
+	g.schemas[name] = &Schema{}
+	*g.schemas[name] = *g.structSchema(typ)
+
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func (g *schemaGenerator) uniqueName(typ reflect.Type) string {
+	name := sanitizeName(typ.Name())
+	if _, taken := g.schemas[name]; !taken {
+		return name
+	}
+
+	pkg := typ.PkgPath()
+	if idx := strings.LastIndex(pkg, "/"); idx >= 0 {
+		pkg = pkg[idx+1:]
+	}
+	name = sanitizeName(pkg + "." + typ.Name())
+	for i := 2; ; i++ {
+		if _, taken := g.schemas[name]; !taken {
+			return name
+		}
+		name = sanitizeName(pkg+"."+typ.Name()) + strconv.Itoa(i)
+	}
+}
+
+func (g *schemaGenerator) structSchema(typ reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	g.collectProperties(typ, schema)
+	return schema
+}
+
+func (g *schemaGenerator) collectProperties(typ reflect.Type, schema *Schema) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, opts := tagName(field.Tag.Get("json"))
+		if name == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			g.collectProperties(fieldType, schema)
+			continue
+		}
+
+		if name == "" {
+			// fields bound from the path, query string, headers or cookies
+			// are documented as parameters, not as body properties.
+			if isParameterField(field) {
+				continue
+			}
+			name = field.Name
+		}
+
+		prop := g.schemaOf(field.Type)
+		if desc := field.Tag.Get("description"); desc != "" {
+			prop = withDescription(prop, desc)
+		}
+		if applyValidateTag(prop, field.Tag.Get("validate")) {
+			schema.Required = append(schema.Required, name)
+		} else if !strings.Contains(opts, "omitempty") && field.Type.Kind() != reflect.Ptr && isRequiredByTag(field) {
+			schema.Required = append(schema.Required, name)
+		}
+
+		schema.Properties[name] = prop
+	}
+}
+
+// withDescription attaches a description to a schema. References can't carry
+// siblings in older tooling, so the description is dropped for them.
+func withDescription(schema *Schema, desc string) *Schema {
+	if schema.Ref != "" {
+		return schema
+	}
+	schema.Description = desc
+	return schema
+}
+
+// applyValidateTag translates the rules of a `validate` tag into schema
+// keywords. It reports whether the field is required.
+func applyValidateTag(schema *Schema, rules string) bool {
+	if rules == "" || schema.Ref != "" {
+		return strings.Contains(rules, "required")
+	}
+
+	required := false
+	for _, rule := range strings.Split(rules, ",") {
+		key, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch key {
+		case "required":
+			required = true
+		case "oneof":
+			for _, opt := range strings.Fields(param) {
+				schema.Enum = append(schema.Enum, opt)
+			}
+		case "email":
+			schema.Format = "email"
+		case "min", "max", "len":
+			limit, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			applyBound(schema, key, limit)
+		}
+	}
+
+	return required
+}
+
+func applyBound(schema *Schema, rule string, limit float64) {
+	n := int(limit)
+	switch schema.Type {
+	case "string":
+		if rule == "min" || rule == "len" {
+			schema.MinLength = &n
+		}
+		if rule == "max" || rule == "len" {
+			schema.MaxLength = &n
+		}
+	case "array":
+		if rule == "min" || rule == "len" {
+			schema.MinItems = &n
+		}
+		if rule == "max" || rule == "len" {
+			schema.MaxItems = &n
+		}
+	case "integer", "number":
+		if rule == "min" || rule == "len" {
+			schema.Minimum = &limit
+		}
+		if rule == "max" || rule == "len" {
+			schema.Maximum = &limit
+		}
+	}
+}
+
+// isRequiredByTag reports whether the field is explicitly flagged with
+// `required:"true"`.
+func isRequiredByTag(field reflect.StructField) bool {
+	required, _ := strconv.ParseBool(field.Tag.Get("required"))
+	return required
+}
+
+func isParameterField(field reflect.StructField) bool {
+	for _, tag := range []string{"path", "query", "header", "cookie"} {
+		if name, _ := tagName(field.Tag.Get(tag)); name != "" && name != "-" {
+			return true
+		}
+	}
+	return false
+}
+
+func tagName(tag string) (string, string) {
+	name, opts, _ := strings.Cut(tag, ",")
+	return name, opts
+}
+
+func sanitizeName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, name)
+}
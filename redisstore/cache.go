@@ -0,0 +1,51 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	httptransport "github.com/likearthian/apikit/transport/http"
+	"github.com/redis/go-redis/v9"
+)
+
+// CacheStore is an httptransport.CacheStore backed by Redis, shared by all
+// the instances of a service.
+type CacheStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewCacheStore creates a CacheStore storing responses under keys starting
+// with prefix.
+func NewCacheStore(client redis.Cmdable, prefix string) *CacheStore {
+	return &CacheStore{client: client, prefix: prefix}
+}
+
+// Get implements httptransport.CacheStore.
+func (s *CacheStore) Get(ctx context.Context, key string) (*httptransport.CachedResponse, error) {
+	data, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var res httptransport.CachedResponse
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+
+	return &res, nil
+}
+
+// Set implements httptransport.CacheStore.
+func (s *CacheStore) Set(ctx context.Context, key string, res *httptransport.CachedResponse, ttl time.Duration) error {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	return s.client.Set(ctx, s.prefix+key, data, ttl).Err()
+}
@@ -0,0 +1,123 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/likearthian/apikit/reports"
+	"github.com/redis/go-redis/v9"
+)
+
+// exportRetention is how long the exports are kept in Redis after they
+// expired, for reports.Exporter.Cleanup to find them and delete their files.
+const exportRetention = 7 * 24 * time.Hour
+
+// ExportStore is a reports.Store backed by Redis, so the exports started on
+// an instance of a service can be polled and downloaded on any other. The
+// exports are indexed by expiry in a sorted set, under prefix + "expiry".
+type ExportStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewExportStore creates an ExportStore storing exports under keys starting
+// with prefix.
+func NewExportStore(client redis.Cmdable, prefix string) *ExportStore {
+	return &ExportStore{client: client, prefix: prefix}
+}
+
+// exportRecord is the JSON of a reports.Export, with its fields hidden from
+// the clients.
+type exportRecord struct {
+	reports.Export
+	Owner string `json:"owner"`
+	Key   string `json:"key"`
+}
+
+// Save implements reports.Store.
+func (s *ExportStore) Save(ctx context.Context, export *reports.Export) error {
+	data, err := json.Marshal(exportRecord{Export: *export, Owner: export.Owner, Key: export.Key})
+	if err != nil {
+		return err
+	}
+
+	ttl := time.Until(export.ExpiresAt) + exportRetention
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.prefix+export.ID, data, ttl)
+		pipe.ZAdd(ctx, s.prefix+"expiry", redis.Z{Score: float64(export.ExpiresAt.Unix()), Member: export.ID})
+		return nil
+	})
+	return err
+}
+
+// Get implements reports.Store.
+func (s *ExportStore) Get(ctx context.Context, id string) (*reports.Export, error) {
+	data, err := s.client.Get(ctx, s.prefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, reports.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeExport(data)
+}
+
+// Delete implements reports.Store.
+func (s *ExportStore) Delete(ctx context.Context, id string) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.prefix+id)
+		pipe.ZRem(ctx, s.prefix+"expiry", id)
+		return nil
+	})
+	return err
+}
+
+// Expired implements reports.Store. Exports whose record is gone, having
+// outlived their retention, are returned with their ID only.
+func (s *ExportStore) Expired(ctx context.Context, t time.Time) ([]*reports.Export, error) {
+	ids, err := s.client.ZRangeByScore(ctx, s.prefix+"expiry", &redis.ZRangeBy{
+		Min: "-inf",
+		Max: "(" + strconv.FormatInt(t.Unix(), 10),
+	}).Result()
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = s.prefix + id
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	expired := make([]*reports.Export, len(ids))
+	for i, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			expired[i] = &reports.Export{ID: ids[i]}
+			continue
+		}
+		if expired[i], err = decodeExport([]byte(data)); err != nil {
+			return nil, err
+		}
+	}
+
+	return expired, nil
+}
+
+func decodeExport(data []byte) (*reports.Export, error) {
+	var record exportRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+
+	export := record.Export
+	export.Owner = record.Owner
+	export.Key = record.Key
+	return &export, nil
+}
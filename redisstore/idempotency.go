@@ -0,0 +1,82 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+	httptransport "github.com/likearthian/apikit/transport/http"
+	"github.com/redis/go-redis/v9"
+)
+
+// IdempotencyStore is an httptransport.IdempotencyStore backed by Redis, so
+// retries reaching another instance of a service are replayed too.
+type IdempotencyStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewIdempotencyStore creates an IdempotencyStore storing responses under
+// keys starting with prefix.
+func NewIdempotencyStore(client redis.Cmdable, prefix string) *IdempotencyStore {
+	return &IdempotencyStore{client: client, prefix: prefix}
+}
+
+// idempotencyRecord is stored while the request is in progress, then
+// replaced by the recorded response.
+type idempotencyRecord struct {
+	Pending  bool                              `json:"pending,omitempty"`
+	Response *httptransport.IdempotentResponse `json:"response,omitempty"`
+}
+
+// Begin implements httptransport.IdempotencyStore.
+func (s *IdempotencyStore) Begin(ctx context.Context, key, _ string, ttl time.Duration) (*httptransport.IdempotentResponse, error) {
+	pending, err := json.Marshal(idempotencyRecord{Pending: true})
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := s.client.SetNX(ctx, s.prefix+key, pending, ttl).Result()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return nil, nil
+	}
+
+	data, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if err == redis.Nil {
+		// expired in between: the caller may retry right away
+		return nil, api.ErrIdempotencyInFlight
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+
+	if record.Pending || record.Response == nil {
+		return nil, api.ErrIdempotencyInFlight
+	}
+
+	return record.Response, nil
+}
+
+// Complete implements httptransport.IdempotencyStore.
+func (s *IdempotencyStore) Complete(ctx context.Context, key string, res *httptransport.IdempotentResponse, ttl time.Duration) error {
+	data, err := json.Marshal(idempotencyRecord{Response: res})
+	if err != nil {
+		return err
+	}
+
+	return s.client.Set(ctx, s.prefix+key, data, ttl).Err()
+}
+
+// Release implements httptransport.IdempotencyStore.
+func (s *IdempotencyStore) Release(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key).Err()
+}
@@ -0,0 +1,90 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/likearthian/apikit/lockout"
+	"github.com/redis/go-redis/v9"
+)
+
+// LockoutStore is a lockout.Store backed by Redis, so a principal locked out
+// on one instance of a service is locked out on all of them. The failures of
+// a key are counted apart from its state, under key + ":failures", so they
+// are incremented atomically.
+type LockoutStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewLockoutStore creates a LockoutStore storing states under keys starting
+// with prefix.
+func NewLockoutStore(client redis.Cmdable, prefix string) *LockoutStore {
+	return &LockoutStore{client: client, prefix: prefix}
+}
+
+func (s *LockoutStore) failuresKey(key string) string {
+	return s.prefix + key + ":failures"
+}
+
+// Get implements lockout.Store.
+func (s *LockoutStore) Get(ctx context.Context, key string) (lockout.State, error) {
+	var state lockout.State
+
+	values, err := s.client.MGet(ctx, s.prefix+key, s.failuresKey(key)).Result()
+	if err != nil {
+		return state, err
+	}
+
+	if data, ok := values[0].(string); ok {
+		if err := json.Unmarshal([]byte(data), &state); err != nil {
+			return state, err
+		}
+	}
+
+	state.Failures = 0
+	if count, ok := values[1].(string); ok {
+		if state.Failures, err = strconv.Atoi(count); err != nil {
+			return state, err
+		}
+	}
+
+	return state, nil
+}
+
+// Set implements lockout.Store.
+func (s *LockoutStore) Set(ctx context.Context, key string, state lockout.State, ttl time.Duration) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.prefix+key, data, ttl)
+		pipe.Set(ctx, s.failuresKey(key), state.Failures, ttl)
+		return nil
+	})
+	return err
+}
+
+// Increment implements lockout.Store.
+func (s *LockoutStore) Increment(ctx context.Context, key string, ttl time.Duration) (int, error) {
+	var incr *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, s.failuresKey(key))
+		pipe.Expire(ctx, s.failuresKey(key), ttl)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(incr.Val()), nil
+}
+
+// Delete implements lockout.Store.
+func (s *LockoutStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key, s.failuresKey(key)).Err()
+}
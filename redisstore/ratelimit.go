@@ -0,0 +1,127 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript refills and consumes a token atomically. It returns
+// {allowed, remaining, retry_after_ms}.
+var tokenBucketScript = redis.NewScript(`
+local key = KEYS[1]
+local burst = tonumber(ARGV[1])
+local per_token = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+
+local state = redis.call("HMGET", key, "tokens", "last")
+local tokens = tonumber(state[1])
+local last = tonumber(state[2])
+if tokens == nil then
+	tokens = burst
+	last = now
+end
+
+tokens = math.min(burst, tokens + (now - last) / per_token)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * per_token)
+end
+
+redis.call("HSET", key, "tokens", tokens, "last", now)
+redis.call("PEXPIRE", key, ttl)
+return {allowed, math.floor(tokens), retry}
+`)
+
+// slidingWindowScript approximates a sliding window from the counters of the
+// current and previous fixed windows. It returns {allowed, remaining,
+// retry_after_ms}.
+var slidingWindowScript = redis.NewScript(`
+local current_key = KEYS[1]
+local previous_key = KEYS[2]
+local rate = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local elapsed = tonumber(ARGV[3])
+
+local current = tonumber(redis.call("GET", current_key) or "0")
+local previous = tonumber(redis.call("GET", previous_key) or "0")
+local count = previous * (1 - elapsed / window) + current
+
+if count + 1 > rate then
+	return {0, 0, window - elapsed}
+end
+
+redis.call("INCR", current_key)
+redis.call("PEXPIRE", current_key, window * 2)
+return {1, math.floor(rate - count - 1), 0}
+`)
+
+// RateLimitStore is an api.RateLimitStore backed by Redis, sharing limits
+// across every instance of a service.
+type RateLimitStore struct {
+	client redis.Scripter
+	prefix string
+}
+
+// NewRateLimitStore creates a RateLimitStore storing its counters under keys
+// starting with prefix.
+func NewRateLimitStore(client redis.Scripter, prefix string) *RateLimitStore {
+	return &RateLimitStore{client: client, prefix: prefix}
+}
+
+// Allow implements api.RateLimitStore. The limits are counted in
+// milliseconds, so their period must be 1ms or longer.
+func (s *RateLimitStore) Allow(ctx context.Context, key string, limit api.Limit) (api.RateLimitResult, error) {
+	if err := limit.Validate(); err != nil {
+		return api.RateLimitResult{}, err
+	}
+	if limit.Period < time.Millisecond {
+		return api.RateLimitResult{}, fmt.Errorf("rate limit period %s is shorter than 1ms", limit.Period)
+	}
+
+	now := time.Now()
+
+	var (
+		res []int64
+		err error
+	)
+
+	if limit.Algorithm == api.SlidingWindowAlgorithm {
+		window := limit.Period.Milliseconds()
+		start := now.UnixMilli() / window
+		elapsed := now.UnixMilli() - start*window
+		res, err = slidingWindowScript.Run(ctx, s.client,
+			[]string{s.key(key, start), s.key(key, start-1)},
+			limit.Rate, window, elapsed,
+		).Int64Slice()
+	} else {
+		perToken := float64(limit.Period.Milliseconds()) / float64(limit.Rate)
+		res, err = tokenBucketScript.Run(ctx, s.client,
+			[]string{s.prefix + key},
+			limit.BurstSize(), perToken, now.UnixMilli(), limit.Period.Milliseconds()*2,
+		).Int64Slice()
+	}
+
+	if err != nil {
+		return api.RateLimitResult{}, err
+	}
+
+	return api.RateLimitResult{
+		Allowed:    res[0] == 1,
+		Remaining:  int(res[1]),
+		RetryAfter: time.Duration(res[2]) * time.Millisecond,
+	}, nil
+}
+
+func (s *RateLimitStore) key(key string, window int64) string {
+	return s.prefix + key + ":" + strconv.FormatInt(window, 10)
+}
@@ -0,0 +1,52 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/redis/go-redis/v9"
+)
+
+// ResultCache is an api.Cache backed by Redis, sharing the results memoized
+// by api.CacheMiddleware between all the instances of a service. Results are
+// stored as JSON, so T must round-trip through encoding/json.
+type ResultCache[T any] struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewResultCache creates a ResultCache storing results under keys starting
+// with prefix.
+func NewResultCache[T any](client redis.Cmdable, prefix string) *ResultCache[T] {
+	return &ResultCache[T]{client: client, prefix: prefix}
+}
+
+// Get implements api.Cache.
+func (s *ResultCache[T]) Get(ctx context.Context, key string) (*api.CacheEntry[T], error) {
+	data, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entry api.CacheEntry[T]
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+// Set implements api.Cache.
+func (s *ResultCache[T]) Set(ctx context.Context, key string, entry *api.CacheEntry[T], ttl time.Duration) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return s.client.Set(ctx, s.prefix+key, data, ttl).Err()
+}
@@ -0,0 +1,42 @@
+package redisstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RevocationStore is an api.RevocationStore backed by Redis, so a token
+// revoked on one instance of a service is rejected by all of them.
+type RevocationStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRevocationStore creates a RevocationStore storing revoked token ids under
+// keys starting with prefix.
+func NewRevocationStore(client redis.Cmdable, prefix string) *RevocationStore {
+	return &RevocationStore{client: client, prefix: prefix}
+}
+
+// Revoke implements api.RevocationStore. The key expires together with the
+// token.
+func (s *RevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	return s.client.Set(ctx, s.prefix+jti, 1, ttl).Err()
+}
+
+// IsRevoked implements api.RevocationStore.
+func (s *RevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := s.client.Exists(ctx, s.prefix+jti).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
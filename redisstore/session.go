@@ -0,0 +1,45 @@
+package redisstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/likearthian/apikit/sessions"
+	"github.com/redis/go-redis/v9"
+)
+
+// SessionStore is a sessions.Store backed by Redis, so the sessions are
+// shared by every instance of a service.
+type SessionStore struct {
+	client redis.Cmdable
+	prefix string
+}
+
+// NewSessionStore creates a SessionStore storing sessions under keys
+// starting with prefix.
+func NewSessionStore(client redis.Cmdable, prefix string) *SessionStore {
+	return &SessionStore{client: client, prefix: prefix}
+}
+
+// Get implements sessions.Store.
+func (s *SessionStore) Get(ctx context.Context, id string) ([]byte, error) {
+	data, err := s.client.Get(ctx, s.prefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, sessions.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Set implements sessions.Store. The key expires together with the session.
+func (s *SessionStore) Set(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+id, data, ttl).Err()
+}
+
+// Delete implements sessions.Store.
+func (s *SessionStore) Delete(ctx context.Context, id string) error {
+	return s.client.Del(ctx, s.prefix+id).Err()
+}
@@ -0,0 +1,512 @@
+// Package reports generates reports asynchronously: an endpoint starts an
+// export, which runs as a job of the jobs package, clients poll its status
+// and progress, then download the file generated once it is done, through a
+// signed link, until it expires.
+//
+//	exporter := reports.NewExporter(dispatcher, reports.NewMemoryStore(), blobs,
+//		reports.DownloadLinks(signer, "https://api.example.com/exports/download", 15*time.Minute),
+//	)
+//	sales := reports.NewReport(exporter, "sales", httptransport.HttpContentTypeCsv,
+//		func(ctx context.Context, p SalesParams, out *reports.Output) error {
+//			out.SetFilename("sales-" + p.Month + ".csv")
+//			...
+//		})
+//
+//	r.Post("/reports/sales", httptransport.NewServer(sales.MakeStartEndpoint(), ...))
+//	r.Get("/exports/{id}", httptransport.NewServer(exporter.MakeStatusEndpoint(), ...))
+//	r.Get("/exports/download", exporter.DownloadHandler())
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/downloads"
+	"github.com/likearthian/apikit/jobs"
+	"github.com/likearthian/apikit/storage"
+	httptransport "github.com/likearthian/apikit/transport/http"
+)
+
+// ErrNotFound is returned for exports which don't exist, expired, or belong
+// to another user. It wraps api.ErrNotFound.
+var ErrNotFound = fmt.Errorf("%w: export not found", api.ErrNotFound)
+
+// ErrNotReady is returned when downloading an export which is not done. It
+// wraps api.ErrConflict.
+var ErrNotReady = fmt.Errorf("%w: export not ready", api.ErrConflict)
+
+// linkAudience is the audience of the download links, so the descriptors
+// signed for other downloads sharing the Signer are not accepted.
+const linkAudience = "exports"
+
+// Status is the stage of an export.
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusRunning Status = "running"
+	StatusDone    Status = "done"
+	StatusFailed  Status = "failed"
+)
+
+// Export is the state of an export, as returned by the status endpoint.
+// Progress is a percentage, and DownloadURL the link to the file, set by the
+// status endpoint once the export is done.
+type Export struct {
+	ID          string    `json:"id"`
+	Report      string    `json:"report"`
+	Status      Status    `json:"status"`
+	Progress    int       `json:"progress"`
+	Error       string    `json:"error,omitempty"`
+	Filename    string    `json:"filename,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Size        int64     `json:"size,omitempty"`
+	DownloadURL string    `json:"download_url,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+
+	// Owner is the user who started the export, the only one allowed to
+	// poll and download it.
+	Owner string `json:"-"`
+
+	// Key is the key of the file in the BlobStore.
+	Key string `json:"-"`
+}
+
+// StatusRequest is the request of the status endpoint.
+type StatusRequest struct {
+	ID string `json:"id" path:"id" validate:"required"`
+}
+
+type exporterOption struct {
+	ttl          time.Duration
+	signer       *downloads.Signer
+	endpoint     string
+	linkTTL      time.Duration
+	owner        func(ctx context.Context) string
+	prefix       string
+	errorHandler func(err error, export *Export)
+}
+
+// ExporterOption sets an optional parameter for NewExporter.
+type ExporterOption func(opt *exporterOption)
+
+// ExportTTL sets how long the exports, and their files, are kept after they
+// are started, and again after they are done. Defaults to 24 hours.
+func ExportTTL(d time.Duration) ExporterOption {
+	return func(opt *exporterOption) { opt.ttl = d }
+}
+
+// DownloadLinks makes the download links point at endpoint, served by the
+// DownloadHandler of the Exporter, signed by signer and valid for ttl. By
+// default, the links are the signed URLs of the BlobStore, valid for 15
+// minutes.
+func DownloadLinks(signer *downloads.Signer, endpoint string, ttl time.Duration) ExporterOption {
+	return func(opt *exporterOption) {
+		opt.signer = signer
+		opt.endpoint = endpoint
+		opt.linkTTL = ttl
+	}
+}
+
+// ExportOwner sets the function returning the user starting or polling an
+// export. Defaults to the subject of the claims of api.AuthClaimsFromContext.
+func ExportOwner(fn func(ctx context.Context) string) ExporterOption {
+	return func(opt *exporterOption) { opt.owner = fn }
+}
+
+// ExportKeyPrefix sets the prefix of the keys of the files in the BlobStore.
+// Defaults to "exports/".
+func ExportKeyPrefix(prefix string) ExporterOption {
+	return func(opt *exporterOption) { opt.prefix = prefix }
+}
+
+// WithErrorHandler sets the function called with the errors failing the
+// exports, which are not disclosed to the clients, and with the errors of
+// Cleanup. By default, they are dropped.
+func WithErrorHandler(fn func(err error, export *Export)) ExporterOption {
+	return func(opt *exporterOption) { opt.errorHandler = fn }
+}
+
+func defaultOwner(ctx context.Context) string {
+	if claims, ok := api.AuthClaimsFromContext(ctx); ok {
+		return claims.Subject
+	}
+	return ""
+}
+
+// Exporter runs the exports of its Reports as jobs of a Dispatcher, keeping
+// their state in a Store and their files in a BlobStore.
+type Exporter struct {
+	dispatcher *jobs.Dispatcher
+	store      Store
+	blobs      storage.BlobStore
+	opts       *exporterOption
+}
+
+// NewExporter creates an Exporter.
+func NewExporter(d *jobs.Dispatcher, store Store, blobs storage.BlobStore, options ...ExporterOption) *Exporter {
+	opts := &exporterOption{
+		ttl:     24 * time.Hour,
+		linkTTL: 15 * time.Minute,
+		owner:   defaultOwner,
+		prefix:  "exports/",
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return &Exporter{dispatcher: d, store: store, blobs: blobs, opts: opts}
+}
+
+// MakeStatusEndpoint returns an Endpoint returning the state of an export,
+// with its download link once it is done. Exports of other users fail with
+// ErrNotFound.
+func (e *Exporter) MakeStatusEndpoint() api.Endpoint[StatusRequest, Export] {
+	return func(ctx context.Context, request StatusRequest) (Export, error) {
+		export, err := e.get(ctx, request.ID)
+		if err != nil {
+			return Export{}, err
+		}
+		if export.Owner != e.opts.owner(ctx) {
+			return Export{}, ErrNotFound
+		}
+
+		if export.Status == StatusDone {
+			if export.DownloadURL, err = e.link(ctx, export); err != nil {
+				return Export{}, err
+			}
+		}
+
+		return *export, nil
+	}
+}
+
+// MakeDownloadEndpoint returns an Endpoint streaming the file of the export
+// described by a download link, decoded by the Decoder of the Signer set
+// with DownloadLinks. The caller must close the Content of the response.
+func (e *Exporter) MakeDownloadEndpoint() api.Endpoint[*httptransport.FileDescriptor, *httptransport.FileResponse] {
+	return func(ctx context.Context, fd *httptransport.FileDescriptor) (*httptransport.FileResponse, error) {
+		export, err := e.get(ctx, fd.FileID)
+		if err != nil {
+			return nil, err
+		}
+		if export.Status != StatusDone {
+			return nil, ErrNotReady
+		}
+
+		content, _, err := e.blobs.Get(ctx, export.Key)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return &httptransport.FileResponse{
+			Filename:    export.Filename,
+			Content:     content,
+			ContentType: export.ContentType,
+		}, nil
+	}
+}
+
+// DownloadHandler returns the Server of the endpoint of MakeDownloadEndpoint,
+// serving the links set with DownloadLinks.
+func (e *Exporter) DownloadHandler(options ...httptransport.ServerOption) *httptransport.Server[*httptransport.FileDescriptor, *httptransport.FileResponse] {
+	dec := func(ctx context.Context, r *http.Request) (*httptransport.FileDescriptor, error) {
+		return nil, ErrNotFound
+	}
+	if e.opts.signer != nil {
+		dec = e.opts.signer.Decoder(linkAudience)
+	}
+
+	return httptransport.NewServer(e.MakeDownloadEndpoint(), dec, encodeDownload, options...)
+}
+
+func encodeDownload(ctx context.Context, w http.ResponseWriter, response *httptransport.FileResponse) error {
+	defer response.Content.Close()
+	return httptransport.CommonFileResponseEncoder(ctx, w, response)
+}
+
+// Cleanup deletes the exports which expired, and their files, returning how
+// many were deleted. Run it periodically, such as with the schedule package.
+func (e *Exporter) Cleanup(ctx context.Context) (int, error) {
+	expired, err := e.store.Expired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, export := range expired {
+		if export.Key != "" {
+			if err := e.blobs.Delete(ctx, export.Key); err != nil {
+				e.fail(err, export)
+				continue
+			}
+		}
+		if err := e.store.Delete(ctx, export.ID); err != nil {
+			e.fail(err, export)
+			continue
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// get returns the export id, unless it expired.
+func (e *Exporter) get(ctx context.Context, id string) (*Export, error) {
+	export, err := e.store.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !export.ExpiresAt.After(time.Now()) {
+		return nil, ErrNotFound
+	}
+	return export, nil
+}
+
+// link returns the download link of export.
+func (e *Exporter) link(ctx context.Context, export *Export) (string, error) {
+	ttl := e.opts.linkTTL
+	if left := time.Until(export.ExpiresAt); left < ttl {
+		ttl = left
+	}
+
+	if e.opts.signer != nil {
+		return e.opts.signer.URL(e.opts.endpoint, export.ID, linkAudience, ttl), nil
+	}
+	return e.blobs.SignedURL(ctx, export.Key, http.MethodGet, ttl)
+}
+
+func (e *Exporter) fail(err error, export *Export) {
+	if e.opts.errorHandler != nil {
+		e.opts.errorHandler(err, export)
+	}
+}
+
+// Generator writes the report for params to out.
+type Generator[P any] func(ctx context.Context, params P, out *Output) error
+
+// Output is the file a Generator writes, streamed to the BlobStore as it is
+// written.
+type Output struct {
+	w        io.Writer
+	filename string
+	progress func(percent int)
+}
+
+// Write implements io.Writer.
+func (o *Output) Write(p []byte) (int, error) {
+	return o.w.Write(p)
+}
+
+// SetFilename sets the name of the file downloaded. Defaults to the name of
+// the report, with the extension of its content type.
+func (o *Output) SetFilename(name string) {
+	o.filename = name
+}
+
+// Progress reports that done of total steps, such as rows, were written.
+// The progress polled is updated at most once per second.
+func (o *Output) Progress(done, total int) {
+	if total <= 0 {
+		return
+	}
+	percent := done * 100 / total
+	if percent > 99 {
+		// 100 is left for the export being done
+		percent = 99
+	}
+	o.progress(percent)
+}
+
+// exportJob is the payload of the jobs of a Report.
+type exportJob[P any] struct {
+	ExportID string `json:"export_id"`
+	Params   P      `json:"params"`
+}
+
+// Report is a type of export, whose parameters are a P, encoded as JSON in
+// its jobs.
+type Report[P any] struct {
+	exporter    *Exporter
+	name        string
+	contentType string
+	generate    Generator[P]
+	task        jobs.Task[exportJob[P]]
+}
+
+// NewReport creates the Report name, generating files of contentType with
+// generate, and registers its jobs in the Dispatcher of e, as the
+// "reports.<name>" task. Reports are registered before the Dispatcher is
+// started.
+func NewReport[P any](e *Exporter, name, contentType string, generate Generator[P]) *Report[P] {
+	r := &Report[P]{
+		exporter:    e,
+		name:        name,
+		contentType: contentType,
+		generate:    generate,
+		task:        jobs.NewTask[exportJob[P]]("reports." + name),
+	}
+	r.task.Handle(e.dispatcher, r.run)
+
+	return r
+}
+
+// MakeStartEndpoint returns an Endpoint starting the export of the report
+// for the parameters of its request, answering with a 202 status and the
+// pending Export, whose id the clients poll with the status endpoint.
+func (r *Report[P]) MakeStartEndpoint() api.Endpoint[P, httptransport.AcceptedResponse[Export]] {
+	e := r.exporter
+	return func(ctx context.Context, params P) (httptransport.AcceptedResponse[Export], error) {
+		now := time.Now()
+		export := &Export{
+			ID:        httptransport.NewRequestID(),
+			Report:    r.name,
+			Status:    StatusPending,
+			Owner:     e.opts.owner(ctx),
+			CreatedAt: now,
+			UpdatedAt: now,
+			ExpiresAt: now.Add(e.opts.ttl),
+		}
+		if err := e.store.Save(ctx, export); err != nil {
+			return httptransport.AcceptedResponse[Export]{}, err
+		}
+
+		// exports are not retried: a failed export is started again by the
+		// user, who sees it failed
+		job := exportJob[P]{ExportID: export.ID, Params: params}
+		if err := r.task.Enqueue(ctx, e.dispatcher, job, jobs.JobID(export.ID), jobs.JobMaxAttempts(1)); err != nil {
+			_ = e.store.Delete(ctx, export.ID)
+			return httptransport.AcceptedResponse[Export]{}, err
+		}
+
+		return httptransport.Accepted("", *export), nil
+	}
+}
+
+// run generates the export of job, streaming it to the BlobStore.
+func (r *Report[P]) run(ctx context.Context, job exportJob[P]) error {
+	e := r.exporter
+
+	export, err := e.store.Get(ctx, job.ExportID)
+	if errors.Is(err, ErrNotFound) {
+		// expired before it ran
+		return jobs.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+	if export.Status == StatusDone {
+		return nil
+	}
+
+	export.Status = StatusRunning
+	export.UpdatedAt = time.Now()
+	if err := e.store.Save(ctx, export); err != nil {
+		return err
+	}
+
+	obj, filename, err := r.generateInto(ctx, export, job.Params)
+	if err != nil {
+		e.fail(err, export)
+		export.Status = StatusFailed
+		export.Error = "the export failed"
+		export.UpdatedAt = time.Now()
+		if serr := e.store.Save(ctx, export); serr != nil {
+			return serr
+		}
+		return jobs.Permanent(err)
+	}
+
+	now := time.Now()
+	export.Status = StatusDone
+	export.Progress = 100
+	export.Key = obj.Key
+	export.Size = obj.Size
+	export.ContentType = r.contentType
+	export.Filename = filename
+	export.UpdatedAt = now
+	export.ExpiresAt = now.Add(e.opts.ttl)
+	return e.store.Save(ctx, export)
+}
+
+// generateInto runs the Generator of the report, piping its Output into the
+// BlobStore, and returns the object stored and its filename.
+func (r *Report[P]) generateInto(ctx context.Context, export *Export, params P) (*storage.Object, string, error) {
+	e := r.exporter
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	out := &Output{w: pw, filename: r.defaultFilename()}
+
+	var mu sync.Mutex
+	var last time.Time
+	out.progress = func(percent int) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if percent <= export.Progress || time.Since(last) < time.Second {
+			return
+		}
+		last = time.Now()
+		export.Progress = percent
+		export.UpdatedAt = last
+		if err := e.store.Save(ctx, export); err != nil {
+			e.fail(err, export)
+		}
+	}
+
+	genErr := make(chan error, 1)
+	go func() {
+		err := r.generate(ctx, params, out)
+		pw.CloseWithError(err)
+		genErr <- err
+	}()
+
+	obj, err := e.blobs.Put(ctx, e.opts.prefix+export.ID+extension(r.contentType), pr, r.contentType)
+	// unblock the generator when the upload failed
+	pr.CloseWithError(err)
+	if gerr := <-genErr; gerr != nil {
+		if obj != nil {
+			_ = e.blobs.Delete(ctx, obj.Key)
+		}
+		return nil, "", gerr
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return obj, out.filename, nil
+}
+
+func (r *Report[P]) defaultFilename() string {
+	return r.name + extension(r.contentType)
+}
+
+// extension returns the usual extension of contentType, if any.
+func extension(contentType string) string {
+	switch contentType {
+	case httptransport.HttpContentTypeCsv:
+		return ".csv"
+	case httptransport.HttpContentTypeXLSX:
+		return ".xlsx"
+	}
+
+	exts, _ := mime.ExtensionsByType(contentType)
+	if len(exts) == 0 {
+		return ""
+	}
+	return exts[0]
+}
@@ -0,0 +1,81 @@
+package reports
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Store keeps the state of the exports. Implementations must be safe for
+// concurrent use; stores shared by the instances of a service, such as
+// redisstore.ExportStore, let any of them answer the polling of an export
+// generated by another.
+type Store interface {
+	// Save creates or replaces an export.
+	Save(ctx context.Context, export *Export) error
+
+	// Get returns the export id, or ErrNotFound.
+	Get(ctx context.Context, id string) (*Export, error)
+
+	// Delete removes the export id.
+	Delete(ctx context.Context, id string) error
+
+	// Expired returns the exports which expired before t.
+	Expired(ctx context.Context, t time.Time) ([]*Export, error)
+}
+
+// MemoryStore is an in-process Store, fit for a single instance, or tests.
+type MemoryStore struct {
+	mu      sync.Mutex
+	exports map[string]Export
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{exports: make(map[string]Export)}
+}
+
+// Save implements Store.
+func (s *MemoryStore) Save(_ context.Context, export *Export) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.exports[export.ID] = *export
+	return nil
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(_ context.Context, id string) (*Export, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	export, ok := s.exports[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &export, nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.exports, id)
+	return nil
+}
+
+// Expired implements Store.
+func (s *MemoryStore) Expired(_ context.Context, t time.Time) ([]*Export, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []*Export
+	for _, export := range s.exports {
+		if export.ExpiresAt.Before(t) {
+			export := export
+			expired = append(expired, &export)
+		}
+	}
+	return expired, nil
+}
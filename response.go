@@ -1,17 +1,24 @@
 package apikit
 
 import (
+	"context"
 	"errors"
 	"net/http"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/apierror"
+	"github.com/likearthian/apikit/i18n"
+	httptransport "github.com/likearthian/apikit/transport/http"
 )
 
 type BaseResponse struct {
-	RequestID  string         `json:"request_id"`
-	StatusCode int            `json:"status_code"`
-	StatusText string         `json:"status_text"`
-	Data       interface{}    `json:"data"`
-	Error      string         `json:"error,omitempty"`
-	Pagination *PaginationDTO `json:"pagination,omitempty"`
+	RequestID  string           `json:"request_id"`
+	StatusCode int              `json:"status_code"`
+	StatusText string           `json:"status_text"`
+	Data       interface{}      `json:"data"`
+	Error      string           `json:"error,omitempty"`
+	Errors     []api.FieldError `json:"errors,omitempty"`
+	Pagination *PaginationDTO   `json:"pagination,omitempty"`
 }
 
 type PagedResponse struct {
@@ -19,9 +26,34 @@ type PagedResponse struct {
 	Pagination PaginationDTO `json:"pagination,omitempty"`
 }
 
+// PaginationDTO is the pagination of a list: its page and total for offset
+// pagination, or the cursors of the next and previous pages, as issued by an
+// api.CursorCodec, for cursor pagination. The response encoders of
+// httptransport send the cursors in Link headers too.
 type PaginationDTO struct {
-	Page  int `json:"page"`
-	Total int `json:"total"`
+	Page       int    `json:"page"`
+	Total      int    `json:"total"`
+	Size       int    `json:"size,omitempty"`
+	TotalPages int    `json:"total_pages,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+// NewCursorPaginationDTO returns the pagination of a page of size items of a
+// list paginated with cursors, to pass to SuccessResponse.
+func NewCursorPaginationDTO(size int, next, prev string) PaginationDTO {
+	return PaginationDTO{Size: size, NextCursor: next, PrevCursor: prev}
+}
+
+// NewPaginationDTO returns the pagination of the page req of a list of total
+// items, to pass to SuccessResponse.
+func NewPaginationDTO(req api.PageRequest, total int) PaginationDTO {
+	return PaginationDTO{
+		Page:       req.Page,
+		Total:      total,
+		Size:       req.Size,
+		TotalPages: req.TotalPages(total),
+	}
 }
 
 var ResponseType = map[int]string{
@@ -32,6 +64,20 @@ var ResponseType = map[int]string{
 	404: "Not Found",
 	500: "Internal Server Error : Api Error",
 	409: "Conflict Data",
+	429: "Too Many Requests",
+}
+
+// PageCursors implements httptransport.CursorPaginator.
+func (r BaseResponse) PageCursors() (next, prev string) {
+	if r.Pagination == nil {
+		return "", ""
+	}
+	return r.Pagination.NextCursor, r.Pagination.PrevCursor
+}
+
+// PageCursors implements httptransport.CursorPaginator.
+func (r PagedResponse) PageCursors() (next, prev string) {
+	return r.Pagination.NextCursor, r.Pagination.PrevCursor
 }
 
 // SuccessResponse output response 200
@@ -50,6 +96,14 @@ func SuccessResponse(requestID string, data interface{}, pagination ...Paginatio
 }
 
 func ErrorResponse(requestID string, code int, err error) BaseResponse {
+	message := err.Error()
+
+	var aerr *apierror.Error
+	if errors.As(err, &aerr) {
+		code = aerr.StatusCode()
+		message = aerr.Message
+	}
+
 	if errors.Is(err, ErrBadRequest) {
 		code = 400
 	}
@@ -62,10 +116,112 @@ func ErrorResponse(requestID string, code int, err error) BaseResponse {
 		code = http.StatusNotFound
 	}
 
-	return BaseResponse{
+	if status, ok := apierror.DefaultStatusMapper.Status(err); ok {
+		code = status
+	}
+
+	respon := BaseResponse{
 		RequestID:  requestID,
 		StatusCode: code,
 		StatusText: http.StatusText(code),
-		Error:      err.Error(),
+		Error:      message,
+	}
+
+	var verr *api.ValidationError
+	if errors.As(err, &verr) {
+		respon.Errors = verr.Fields
+	}
+
+	return respon
+}
+
+type envelopeOption struct {
+	status  func(error) int
+	catalog *i18n.Catalog
+	policy  EnvelopePolicy
+}
+
+// EnvelopeOption sets an optional parameter for MakeJSONEnvelopeErrorEncoder
+// and MakeJSONEnvelopeResponseEncoder.
+type EnvelopeOption func(opt *envelopeOption)
+
+// EnvelopeStatus sets the function giving the status code of errors. By
+// default, it is the one mapped in apierror.DefaultStatusMapper, or else the
+// one reported by errors implementing httptransport.StatusCoder, or else the
+// one given by Err2code.
+func EnvelopeStatus(fn func(error) int) EnvelopeOption {
+	return func(opt *envelopeOption) { opt.status = fn }
+}
+
+// EnvelopeCatalog sets the Catalog translating the status texts and error
+// messages into the languages stored in the context by
+// i18n.AcceptLanguageIntoContext. Status texts are looked up by
+// i18n.StatusKey and messages by the apierror code of the error, filled with
+// its details. Defaults to i18n.DefaultCatalog.
+func EnvelopeCatalog(c *i18n.Catalog) EnvelopeOption {
+	return func(opt *envelopeOption) { opt.catalog = c }
+}
+
+// JSONErrorEncoder is an http ErrorEncoder writing errors in the BaseResponse
+// envelope, with the default options of MakeJSONEnvelopeErrorEncoder.
+func JSONErrorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
+	defaultEnvelopeEncoder(ctx, err, w)
+}
+
+var defaultEnvelopeEncoder = MakeJSONEnvelopeErrorEncoder()
+
+// MakeJSONEnvelopeErrorEncoder returns an http ErrorEncoder writing errors as
+// a JSON BaseResponse, the envelope of successful responses, so clients
+// handle a single format. The request id comes from ReqIDFromContext, the
+// field errors of validation and binding failures are listed in Errors, and
+// the body is compressed as negotiated by httptransport.PopulateRequestContext.
+// Status texts and messages are translated with the Catalog of the encoder.
+// Use it as the error encoder of a server with
+// httptransport.ServerErrorEncoder.
+func MakeJSONEnvelopeErrorEncoder(options ...EnvelopeOption) httptransport.ErrorEncoder {
+	opts := &envelopeOption{
+		status:  errorStatus,
+		catalog: i18n.DefaultCatalog,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return func(ctx context.Context, err error, w http.ResponseWriter) {
+		reqid, _ := ReqIDFromContext(ctx)
+		res := ErrorResponse(reqid, opts.status(err), err)
+		if text, ok := opts.catalog.Message(ctx, i18n.StatusKey(res.StatusCode), nil); ok {
+			res.StatusText = text
+		}
+		if aerr := apierror.From(err); aerr != nil {
+			if msg, ok := opts.catalog.Message(ctx, string(aerr.Code), aerr.Details); ok {
+				res.Error = msg
+			}
+		}
+
+		var headerer httptransport.Headerer
+		if errors.As(err, &headerer) {
+			for k, values := range headerer.Headers() {
+				for _, v := range values {
+					w.Header().Add(k, v)
+				}
+			}
+		}
+
+		httptransport.EncodeJSONWithStatus(ctx, w, res.StatusCode, res)
+	}
+}
+
+// errorStatus returns the status code err is mapped to in
+// apierror.DefaultStatusMapper, or else the one of the
+// httptransport.StatusCoder it wraps, or else the one given by Err2code.
+func errorStatus(err error) int {
+	if status, ok := apierror.DefaultStatusMapper.Status(err); ok {
+		return status
+	}
+	var sc httptransport.StatusCoder
+	if errors.As(err, &sc) {
+		return sc.StatusCode()
 	}
+	return Err2code(err)
 }
@@ -0,0 +1,345 @@
+// Package schedule calls endpoints periodically, on cron schedules, with
+// requests made by a factory at each activation. Runs go through the
+// middlewares of the job, so they are logged and measured like the calls
+// of the transports, under the name of the job:
+//
+//	r := schedule.NewRunner()
+//	schedule.Register(r, "reports.daily", "0 6 * * MON-FRI", sendReports,
+//		func(ctx context.Context, at time.Time) (ReportsRequest, error) {
+//			return ReportsRequest{Day: at.AddDate(0, 0, -1)}, nil
+//		},
+//		schedule.JobJitter(time.Minute),
+//		schedule.JobTimeout(10*time.Minute),
+//		schedule.JobMiddleware(
+//			apikit.MakeEndpointLoggingMiddleware[ReportsRequest, ReportsResponse](logger, ""),
+//			metrics.InstrumentingMiddleware[ReportsRequest, ReportsResponse](m, ""),
+//		),
+//	)
+//	r.Start()
+//	defer r.Shutdown(ctx)
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// ErrClosed is returned when registering jobs after the Runner is shut
+// down.
+var ErrClosed = errors.New("schedule: runner closed")
+
+// ErrOverlap is reported to the error handler of the Runner when a run is
+// skipped because the previous run of the job is still in progress.
+var ErrOverlap = errors.New("schedule: previous run still in progress")
+
+// PanicError is the error of a run whose endpoint panicked. It reports a
+// 500 status code.
+type PanicError struct {
+	Job   string
+	Value interface{}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("schedule: job %s panic: %v", e.Job, e.Value)
+}
+
+func (e *PanicError) StatusCode() int {
+	return http.StatusInternalServerError
+}
+
+// RequestFactory makes the request of the run of a job activated at at.
+type RequestFactory[I any] func(ctx context.Context, at time.Time) (I, error)
+
+type jobOption struct {
+	jitter       time.Duration
+	timeout      time.Duration
+	allowOverlap bool
+	middlewares  []interface{}
+}
+
+// JobOption sets an optional parameter for Register.
+type JobOption func(opt *jobOption)
+
+// JobJitter delays each run of the job by a random duration up to d, to
+// spread the load of the jobs sharing a schedule, across jobs and
+// instances. By default, runs start on schedule.
+func JobJitter(d time.Duration) JobOption {
+	return func(opt *jobOption) { opt.jitter = d }
+}
+
+// JobTimeout sets how long a run may last, after which its context is
+// cancelled and it fails with an *api.TimeoutError. By default, runs aren't
+// limited.
+func JobTimeout(d time.Duration) JobOption {
+	return func(opt *jobOption) { opt.timeout = d }
+}
+
+// JobAllowOverlap lets a run start while the previous one is still in
+// progress. By default, it is skipped with ErrOverlap.
+func JobAllowOverlap() JobOption {
+	return func(opt *jobOption) { opt.allowOverlap = true }
+}
+
+// JobMiddleware sets the middlewares wrapping the endpoint of the job, the
+// first being the outermost. They see panics and timeouts as errors, and
+// the name of the job as the endpoint name. Register fails when their types
+// don't match the endpoint.
+func JobMiddleware[I, O any](mw ...api.Middleware[I, O]) JobOption {
+	return func(opt *jobOption) {
+		for _, m := range mw {
+			opt.middlewares = append(opt.middlewares, m)
+		}
+	}
+}
+
+type runnerOption struct {
+	location     *time.Location
+	errorHandler func(job string, err error)
+}
+
+// RunnerOption sets an optional parameter for NewRunner.
+type RunnerOption func(opt *runnerOption)
+
+// RunnerLocation sets the time zone the cron expressions are evaluated in.
+// Defaults to time.Local.
+func RunnerLocation(loc *time.Location) RunnerOption {
+	return func(opt *runnerOption) { opt.location = loc }
+}
+
+// WithErrorHandler sets the function called with the errors of the runs,
+// of their request factory, and ErrOverlap for the runs skipped, with the
+// name of the job. By default, they are dropped.
+func WithErrorHandler(fn func(job string, err error)) RunnerOption {
+	return func(opt *runnerOption) { opt.errorHandler = fn }
+}
+
+// job is a registered job, whose run function calls the endpoint.
+type job struct {
+	name     string
+	schedule Schedule
+	opts     *jobOption
+	running  int32
+	run      func(ctx context.Context, at time.Time) error
+}
+
+// Runner runs the registered jobs on their schedule, from Start until
+// Shutdown.
+type Runner struct {
+	opts *runnerOption
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	started bool
+	closed  bool
+
+	wg     sync.WaitGroup
+	stop   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewRunner creates a Runner without jobs.
+func NewRunner(options ...RunnerOption) *Runner {
+	opts := &runnerOption{location: time.Local}
+	for _, option := range options {
+		option(opts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		opts:   opts,
+		jobs:   make(map[string]*job),
+		stop:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Register registers the job name, calling e on the schedule spec, as
+// parsed by Parse, with the requests made by factory. Jobs registered after
+// Start are scheduled at once. It fails when spec is invalid, name is
+// already registered, or the middlewares of the options don't match e.
+func Register[I, O any](r *Runner, name, spec string, e api.Endpoint[I, O], factory RequestFactory[I], options ...JobOption) error {
+	sched, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+
+	opts := &jobOption{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	// panics and timeouts are converted into errors before reaching the
+	// middlewares of the job
+	mws := []api.Middleware[I, O]{api.EndpointMiddleware[I, O](api.EndpointInfo{Name: name})}
+	for _, m := range opts.middlewares {
+		mw, ok := m.(api.Middleware[I, O])
+		if !ok {
+			return fmt.Errorf("schedule: job %s: middleware %T doesn't match the endpoint", name, m)
+		}
+		if mw != nil {
+			mws = append(mws, mw)
+		}
+	}
+	mws = append(mws, recoverMiddleware[I, O](name))
+	if opts.timeout > 0 {
+		mws = append(mws, api.TimeoutMiddleware[I, O](opts.timeout))
+	}
+	e = api.Chain(mws[0], mws[1:]...)(e)
+
+	j := &job{
+		name:     name,
+		schedule: sched,
+		opts:     opts,
+		run: func(ctx context.Context, at time.Time) (err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					err = &PanicError{Job: name, Value: p}
+				}
+			}()
+
+			request, err := factory(ctx, at)
+			if err != nil {
+				return err
+			}
+			_, err = e(ctx, request)
+			return err
+		},
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return ErrClosed
+	}
+	if _, ok := r.jobs[name]; ok {
+		return fmt.Errorf("schedule: job %s already registered", name)
+	}
+	r.jobs[name] = j
+
+	if r.started {
+		r.wg.Add(1)
+		go r.loop(j)
+	}
+
+	return nil
+}
+
+func recoverMiddleware[I, O any](name string) api.Middleware[I, O] {
+	return func(next api.Endpoint[I, O]) api.Endpoint[I, O] {
+		return func(ctx context.Context, request I) (response O, err error) {
+			defer func() {
+				if p := recover(); p != nil {
+					err = &PanicError{Job: name, Value: p}
+				}
+			}()
+
+			return next(ctx, request)
+		}
+	}
+}
+
+// Start starts running the jobs on their schedule, until Shutdown.
+func (r *Runner) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.started || r.closed {
+		return
+	}
+	r.started = true
+
+	for _, j := range r.jobs {
+		r.wg.Add(1)
+		go r.loop(j)
+	}
+}
+
+// Shutdown stops scheduling runs and waits for the running ones to
+// complete. When ctx is done first, their contexts are cancelled and
+// ctx.Err() is returned.
+func (r *Runner) Shutdown(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.stop)
+	}
+	r.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		r.cancel()
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		return ctx.Err()
+	}
+}
+
+// loop runs j on its schedule until the runner stops.
+func (r *Runner) loop(j *job) {
+	defer r.wg.Done()
+
+	next := j.schedule.Next(time.Now().In(r.opts.location))
+	for !next.IsZero() {
+		at := next
+		if j.opts.jitter > 0 {
+			at = at.Add(time.Duration(rand.Int63n(int64(j.opts.jitter))))
+		}
+
+		timer := time.NewTimer(time.Until(at))
+		select {
+		case <-r.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if j.opts.allowOverlap || atomic.CompareAndSwapInt32(&j.running, 0, 1) {
+			r.wg.Add(1)
+			go r.run(j, next)
+		} else {
+			r.fail(j.name, ErrOverlap)
+		}
+
+		// activations missed while waiting, such as after the system was
+		// suspended, are skipped
+		now := time.Now().In(r.opts.location)
+		if next = j.schedule.Next(next); !next.IsZero() && next.Before(now) {
+			next = j.schedule.Next(now)
+		}
+	}
+}
+
+func (r *Runner) run(j *job, at time.Time) {
+	defer r.wg.Done()
+	if !j.opts.allowOverlap {
+		defer atomic.StoreInt32(&j.running, 0)
+	}
+
+	if err := j.run(r.ctx, at); err != nil {
+		r.fail(j.name, err)
+	}
+}
+
+func (r *Runner) fail(job string, err error) {
+	if r.opts.errorHandler != nil {
+		r.opts.errorHandler(job, err)
+	}
+}
@@ -0,0 +1,260 @@
+package sd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// ErrNoEndpoints is returned by the balanced endpoint when no instance is
+// available: none was discovered, or all of them are evicted.
+var ErrNoEndpoints = fmt.Errorf("%w: no endpoints available", api.ErrUnavailable)
+
+// Factory creates the client endpoint of an instance, such as an
+// httptransport.Client targeting it. The io.Closer, when not nil, is closed
+// when the instance goes away.
+type Factory[I, O any] func(instance string) (api.Endpoint[I, O], io.Closer, error)
+
+// Strategy picks the instance serving a call.
+type Strategy int
+
+const (
+	// RoundRobin cycles through the instances.
+	RoundRobin Strategy = iota
+
+	// LeastLoaded picks the instance with the fewest calls in progress.
+	LeastLoaded
+)
+
+type balancerOption struct {
+	strategy   Strategy
+	evictAfter int
+	evictFor   time.Duration
+	isFailure  func(error) bool
+}
+
+// BalancerOption sets an optional parameter for NewEndpointerBalancer.
+type BalancerOption func(opt *balancerOption)
+
+// WithStrategy sets how the instance of a call is picked. Defaults to
+// RoundRobin.
+func WithStrategy(strategy Strategy) BalancerOption {
+	return func(opt *balancerOption) { opt.strategy = strategy }
+}
+
+// WithEviction evicts the instances failing n consecutive calls for d, after
+// which they get calls again. Defaults to 5 failures and 30 seconds; n = 0
+// disables eviction.
+func WithEviction(n int, d time.Duration) BalancerOption {
+	return func(opt *balancerOption) {
+		opt.evictAfter = n
+		opt.evictFor = d
+	}
+}
+
+// WithFailurePredicate sets the predicate deciding which errors count as
+// instance failures. By default every non-nil error except context
+// cancellation does.
+func WithFailurePredicate(fn func(error) bool) BalancerOption {
+	return func(opt *balancerOption) { opt.isFailure = fn }
+}
+
+type instanceEndpoint[I, O any] struct {
+	instance string
+	endpoint api.Endpoint[I, O]
+	closer   io.Closer
+
+	inFlight int64
+
+	mu          sync.Mutex
+	failures    int
+	evictedTill time.Time
+}
+
+func (ie *instanceEndpoint[I, O]) available(now time.Time) bool {
+	ie.mu.Lock()
+	defer ie.mu.Unlock()
+	return !now.Before(ie.evictedTill)
+}
+
+// EndpointerBalancer turns the instances of an Instancer into client
+// endpoints, created by a Factory, and balances calls across them.
+type EndpointerBalancer[I, O any] struct {
+	instancer Instancer
+	factory   Factory[I, O]
+	opts      *balancerOption
+
+	mu        sync.Mutex
+	key       string
+	retry     bool
+	endpoints []*instanceEndpoint[I, O]
+	next      uint64
+}
+
+// NewEndpointerBalancer creates an EndpointerBalancer over the instances of
+// instancer.
+func NewEndpointerBalancer[I, O any](instancer Instancer, factory Factory[I, O], options ...BalancerOption) *EndpointerBalancer[I, O] {
+	opts := &balancerOption{
+		strategy:   RoundRobin,
+		evictAfter: 5,
+		evictFor:   30 * time.Second,
+		isFailure: func(err error) bool {
+			return err != nil && !errors.Is(err, context.Canceled)
+		},
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return &EndpointerBalancer[I, O]{instancer: instancer, factory: factory, opts: opts}
+}
+
+// Endpoint returns the balanced endpoint, calling the endpoint of the
+// instance picked by the strategy among those not evicted. It fails with
+// ErrNoEndpoints when there is none.
+func (b *EndpointerBalancer[I, O]) Endpoint() api.Endpoint[I, O] {
+	return func(ctx context.Context, request I) (O, error) {
+		ie, err := b.pick()
+		if err != nil {
+			var empty O
+			return empty, err
+		}
+
+		atomic.AddInt64(&ie.inFlight, 1)
+		response, err := ie.endpoint(ctx, request)
+		atomic.AddInt64(&ie.inFlight, -1)
+
+		b.report(ie, err)
+
+		return response, err
+	}
+}
+
+// Close closes the endpoints of the instances and stops the Instancer.
+func (b *EndpointerBalancer[I, O]) Close() error {
+	b.instancer.Stop()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, ie := range b.endpoints {
+		if ie.closer != nil {
+			ie.closer.Close()
+		}
+	}
+	b.endpoints, b.key = nil, ""
+
+	return nil
+}
+
+func (b *EndpointerBalancer[I, O]) pick() (*instanceEndpoint[I, O], error) {
+	endpoints, err := b.sync()
+	if len(endpoints) == 0 {
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrNoEndpoints, err)
+		}
+		return nil, ErrNoEndpoints
+	}
+
+	now := time.Now()
+	available := make([]*instanceEndpoint[I, O], 0, len(endpoints))
+	for _, ie := range endpoints {
+		if ie.available(now) {
+			available = append(available, ie)
+		}
+	}
+	if len(available) == 0 {
+		return nil, ErrNoEndpoints
+	}
+
+	switch b.opts.strategy {
+	case LeastLoaded:
+		best := available[0]
+		for _, ie := range available[1:] {
+			if atomic.LoadInt64(&ie.inFlight) < atomic.LoadInt64(&best.inFlight) {
+				best = ie
+			}
+		}
+		return best, nil
+
+	default:
+		n := atomic.AddUint64(&b.next, 1)
+		return available[(n-1)%uint64(len(available))], nil
+	}
+}
+
+// sync updates the endpoints to the current instances, creating the
+// endpoints of new instances and closing those of the removed ones.
+func (b *EndpointerBalancer[I, O]) sync() ([]*instanceEndpoint[I, O], error) {
+	instances, err := b.instancer.Instances()
+	key := strings.Join(instances, ",")
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if key == b.key && !b.retry {
+		return b.endpoints, err
+	}
+
+	current := make(map[string]*instanceEndpoint[I, O], len(b.endpoints))
+	for _, ie := range b.endpoints {
+		current[ie.instance] = ie
+	}
+
+	failed := false
+	endpoints := make([]*instanceEndpoint[I, O], 0, len(instances))
+	for _, instance := range instances {
+		if ie, ok := current[instance]; ok {
+			endpoints = append(endpoints, ie)
+			delete(current, instance)
+			continue
+		}
+
+		e, closer, ferr := b.factory(instance)
+		if ferr != nil {
+			failed = true
+			continue
+		}
+		endpoints = append(endpoints, &instanceEndpoint[I, O]{instance: instance, endpoint: e, closer: closer})
+	}
+
+	for _, ie := range current {
+		if ie.closer != nil {
+			ie.closer.Close()
+		}
+	}
+
+	// the instances whose endpoint couldn't be created are retried on the
+	// next call
+	b.key, b.retry, b.endpoints = key, failed, endpoints
+	return endpoints, err
+}
+
+// report records the outcome of a call of ie, evicting it after too many
+// consecutive failures.
+func (b *EndpointerBalancer[I, O]) report(ie *instanceEndpoint[I, O], err error) {
+	if b.opts.evictAfter <= 0 {
+		return
+	}
+
+	ie.mu.Lock()
+	defer ie.mu.Unlock()
+
+	if !b.opts.isFailure(err) {
+		ie.failures = 0
+		return
+	}
+
+	ie.failures++
+	if ie.failures >= b.opts.evictAfter {
+		ie.failures = 0
+		ie.evictedTill = time.Now().Add(b.opts.evictFor)
+	}
+}
@@ -0,0 +1,192 @@
+package sd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type consulOption struct {
+	client *http.Client
+	tag    string
+	token  string
+	wait   time.Duration
+}
+
+// ConsulOption sets an optional parameter for NewConsulInstancer.
+type ConsulOption func(opt *consulOption)
+
+// ConsulHTTPClient sets the http client used to reach the agent. Defaults to
+// a client without timeout, as the queries block up to the wait time.
+func ConsulHTTPClient(client *http.Client) ConsulOption {
+	return func(opt *consulOption) { opt.client = client }
+}
+
+// ConsulTag only keeps the instances registered with tag.
+func ConsulTag(tag string) ConsulOption {
+	return func(opt *consulOption) { opt.tag = tag }
+}
+
+// ConsulToken sets the ACL token of the queries.
+func ConsulToken(token string) ConsulOption {
+	return func(opt *consulOption) { opt.token = token }
+}
+
+// ConsulWait sets how long the blocking queries wait for a change before
+// returning. Defaults to 5 minutes.
+func ConsulWait(d time.Duration) ConsulOption {
+	return func(opt *consulOption) { opt.wait = d }
+}
+
+// consulEntry is an entry of the /v1/health/service response.
+type consulEntry struct {
+	Node struct {
+		Address string
+	}
+	Service struct {
+		Address string
+		Port    int
+	}
+}
+
+// ConsulInstancer is an Instancer watching the instances of a service which
+// pass their health checks in Consul, through the HTTP API of an agent.
+type ConsulInstancer struct {
+	cache
+
+	agent   *url.URL
+	service string
+	opts    *consulOption
+	ctx     context.Context
+	cancel  context.CancelFunc
+	once    sync.Once
+}
+
+// NewConsulInstancer creates a ConsulInstancer watching service through the
+// agent reached at addr, such as "http://127.0.0.1:8500". The instances are
+// fetched once before returning, and then watched with blocking queries.
+func NewConsulInstancer(addr, service string, options ...ConsulOption) (*ConsulInstancer, error) {
+	opts := &consulOption{
+		client: &http.Client{},
+		wait:   5 * time.Minute,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	agent, err := url.Parse(strings.TrimSuffix(addr, "/"))
+	if err != nil || agent.Scheme == "" || agent.Host == "" {
+		return nil, fmt.Errorf("invalid consul address %q", addr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &ConsulInstancer{
+		agent:   agent,
+		service: service,
+		opts:    opts,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	instances, index, err := c.fetch(0)
+	c.update(instances, err)
+
+	go c.watch(index)
+
+	return c, nil
+}
+
+// Stop implements Instancer.
+func (c *ConsulInstancer) Stop() {
+	c.once.Do(c.cancel)
+}
+
+func (c *ConsulInstancer) watch(index uint64) {
+	backoff := time.Second
+	for {
+		instances, next, err := c.fetch(index)
+		if c.ctx.Err() != nil {
+			return
+		}
+		c.update(instances, err)
+
+		if err != nil {
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff < time.Minute {
+				backoff *= 2
+			}
+			continue
+		}
+		backoff = time.Second
+
+		// the index going backwards means the agent state was reset
+		if next < index {
+			next = 0
+		}
+		index = next
+	}
+}
+
+// fetch queries the passing instances of the service, blocking until they
+// change from index, when it is not 0.
+func (c *ConsulInstancer) fetch(index uint64) ([]string, uint64, error) {
+	u := *c.agent
+	u.Path += "/v1/health/service/" + url.PathEscape(c.service)
+
+	q := url.Values{"passing": {"true"}}
+	if c.opts.tag != "" {
+		q.Set("tag", c.opts.tag)
+	}
+	if index > 0 {
+		q.Set("index", strconv.FormatUint(index, 10))
+		q.Set("wait", strconv.Itoa(int(c.opts.wait.Seconds()))+"s")
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, index, err
+	}
+	if c.opts.token != "" {
+		req.Header.Set("X-Consul-Token", c.opts.token)
+	}
+
+	resp, err := c.opts.client.Do(req)
+	if err != nil {
+		return nil, index, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, index, fmt.Errorf("consul: %s", resp.Status)
+	}
+
+	var entries []consulEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, index, fmt.Errorf("consul: %w", err)
+	}
+
+	next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+
+	instances := make([]string, 0, len(entries))
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		instances = append(instances, net.JoinHostPort(host, strconv.Itoa(e.Service.Port)))
+	}
+
+	return instances, next, nil
+}
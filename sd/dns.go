@@ -0,0 +1,100 @@
+package sd
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type dnsOption struct {
+	interval time.Duration
+	resolver *net.Resolver
+}
+
+// DNSOption sets an optional parameter for NewDNSSRVInstancer.
+type DNSOption func(opt *dnsOption)
+
+// DNSRefreshInterval sets how often the SRV records are looked up. Defaults
+// to 30 seconds.
+func DNSRefreshInterval(d time.Duration) DNSOption {
+	return func(opt *dnsOption) { opt.interval = d }
+}
+
+// DNSResolver sets the resolver of the lookups. Defaults to
+// net.DefaultResolver.
+func DNSResolver(resolver *net.Resolver) DNSOption {
+	return func(opt *dnsOption) { opt.resolver = resolver }
+}
+
+// DNSSRVInstancer is an Instancer looking up the SRV records of a name, such
+// as the "_http._tcp.users.default.svc.cluster.local" records of a
+// Kubernetes headless service.
+type DNSSRVInstancer struct {
+	cache
+
+	name     string
+	resolver *net.Resolver
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// NewDNSSRVInstancer creates a DNSSRVInstancer looking up the SRV records of
+// name, once before returning and then at every refresh interval.
+func NewDNSSRVInstancer(name string, options ...DNSOption) *DNSSRVInstancer {
+	opts := &dnsOption{
+		interval: 30 * time.Second,
+		resolver: net.DefaultResolver,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	d := &DNSSRVInstancer{
+		name:     name,
+		resolver: opts.resolver,
+		stop:     make(chan struct{}),
+	}
+	d.refresh(opts.interval)
+
+	go func() {
+		ticker := time.NewTicker(opts.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+				d.refresh(opts.interval)
+			}
+		}
+	}()
+
+	return d
+}
+
+// Stop implements Instancer.
+func (d *DNSSRVInstancer) Stop() {
+	d.once.Do(func() { close(d.stop) })
+}
+
+func (d *DNSSRVInstancer) refresh(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_, records, err := d.resolver.LookupSRV(ctx, "", "", d.name)
+	if err != nil {
+		d.update(nil, err)
+		return
+	}
+
+	instances := make([]string, 0, len(records))
+	for _, srv := range records {
+		host := strings.TrimSuffix(srv.Target, ".")
+		instances = append(instances, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+	}
+	d.update(instances, nil)
+}
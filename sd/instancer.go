@@ -0,0 +1,56 @@
+package sd
+
+import (
+	"sort"
+	"sync"
+)
+
+// Instancer discovers the instances of a service, as "host:port" addresses.
+// Implementations keep the list up to date in the background, so Instances
+// is cheap enough to be called on every request.
+type Instancer interface {
+	// Instances returns the current instances, and the error of the latest
+	// discovery, if it failed. The last known instances are kept on errors.
+	Instances() ([]string, error)
+
+	// Stop ends the background discovery.
+	Stop()
+}
+
+// StaticInstancer is an Instancer returning a fixed list of instances.
+type StaticInstancer []string
+
+// Instances implements Instancer.
+func (s StaticInstancer) Instances() ([]string, error) {
+	return append([]string(nil), s...), nil
+}
+
+// Stop implements Instancer.
+func (s StaticInstancer) Stop() {}
+
+// cache holds the latest discovery result of an Instancer.
+type cache struct {
+	mu        sync.RWMutex
+	instances []string
+	err       error
+}
+
+func (c *cache) Instances() ([]string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return append([]string(nil), c.instances...), c.err
+}
+
+// update records the result of a discovery, keeping the previous instances
+// when it failed.
+func (c *cache) update(instances []string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.err = err
+	if err == nil {
+		sort.Strings(instances)
+		c.instances = instances
+	}
+}
@@ -0,0 +1,300 @@
+package sessions
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrCookieTooLarge is passed to the error handler of a cookie Manager when
+// a session is too large for its cookie, which is then not saved.
+var ErrCookieTooLarge = errors.New("sessions: session too large for a cookie")
+
+// maxCookieSize is the size of the largest cookie value browsers accept.
+const maxCookieSize = 4000
+
+type managerOption struct {
+	cookie       string
+	path         string
+	domain       string
+	maxAge       time.Duration
+	secure       bool
+	sameSite     http.SameSite
+	errorHandler func(ctx context.Context, err error)
+}
+
+// ManagerOption sets an optional parameter for a Manager.
+type ManagerOption func(opt *managerOption)
+
+// CookieName sets the name of the session cookie. Defaults to "session".
+func CookieName(name string) ManagerOption {
+	return func(opt *managerOption) { opt.cookie = name }
+}
+
+// CookiePath sets the path and domain of the session cookie. Defaults to "/"
+// and the host of the request.
+func CookiePath(path, domain string) ManagerOption {
+	return func(opt *managerOption) {
+		opt.path = path
+		opt.domain = domain
+	}
+}
+
+// MaxAge sets how long a session lives after it was last modified. Defaults
+// to 24 hours.
+func MaxAge(d time.Duration) ManagerOption {
+	return func(opt *managerOption) { opt.maxAge = d }
+}
+
+// Secure sets whether the session cookie is only sent over HTTPS. Defaults
+// to true; disable it for local development over plain HTTP.
+func Secure(secure bool) ManagerOption {
+	return func(opt *managerOption) { opt.secure = secure }
+}
+
+// SameSite sets the SameSite attribute of the session cookie. Defaults to
+// http.SameSiteLaxMode.
+func SameSite(mode http.SameSite) ManagerOption {
+	return func(opt *managerOption) { opt.sameSite = mode }
+}
+
+// WithErrorHandler sets the function called with the errors of the Store,
+// and those of the sessions which could not be saved, since neither Load nor
+// Save can fail the request. By default, they are dropped.
+func WithErrorHandler(fn func(ctx context.Context, err error)) ManagerOption {
+	return func(opt *managerOption) { opt.errorHandler = fn }
+}
+
+// Manager loads and saves the sessions of the requests. Sessions are only
+// saved, and their cookie sent, once modified, so requests which never touch
+// their session don't create one. The session cookie is always HttpOnly.
+type Manager struct {
+	opts  *managerOption
+	store Store
+	aead  cipher.AEAD
+}
+
+func newManager(options []ManagerOption) *Manager {
+	opts := &managerOption{
+		cookie:   "session",
+		path:     "/",
+		maxAge:   24 * time.Hour,
+		secure:   true,
+		sameSite: http.SameSiteLaxMode,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return &Manager{opts: opts}
+}
+
+// NewCookieManager creates a Manager keeping the sessions in their cookie,
+// encrypted and authenticated with AES-256-GCM under a key derived from
+// secret, which must be at least 32 bytes long. Such sessions need no
+// storage, but are limited to about 4KB, and can't be revoked before they
+// expire: a copy of the cookie stays valid until then.
+func NewCookieManager(secret []byte, options ...ManagerOption) (*Manager, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("sessions: secret must be at least 32 bytes long")
+	}
+
+	key := sha256.Sum256(secret)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	m := newManager(options)
+	m.aead = aead
+	return m, nil
+}
+
+// NewStoreManager creates a Manager keeping the sessions in store, their
+// cookie only carrying their id.
+func NewStoreManager(store Store, options ...ManagerOption) *Manager {
+	m := newManager(options)
+	m.store = store
+	return m
+}
+
+// Load is a RequestFunc loading the session of the request into its
+// context, for FromContext. Requests without a valid session get a new,
+// empty one.
+func (m *Manager) Load(ctx context.Context, r *http.Request) context.Context {
+	var s *Session
+	if c, err := r.Cookie(m.opts.cookie); err == nil && c.Value != "" {
+		s = m.load(ctx, c.Value)
+	}
+
+	if s == nil {
+		var err error
+		if s, err = newSession(); err != nil {
+			m.fail(ctx, err)
+			return ctx
+		}
+	}
+
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+func (m *Manager) load(ctx context.Context, value string) *Session {
+	var data []byte
+	if m.store == nil {
+		var ok bool
+		if data, ok = m.open(value); !ok {
+			return nil
+		}
+	} else {
+		var err error
+		data, err = m.store.Get(ctx, value)
+		if err != nil {
+			if err != ErrNotFound {
+				m.fail(ctx, err)
+			}
+			return nil
+		}
+	}
+
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil
+	}
+	if time.Now().After(rec.ExpiresAt) {
+		return nil
+	}
+	// a store must not serve a session under another id
+	if m.store != nil && rec.ID != value {
+		return nil
+	}
+
+	return sessionOf(&rec)
+}
+
+// Save is a ServerResponseFunc saving the session of the request, when it
+// was modified, and setting its cookie. Like every ServerResponseFunc, it
+// only runs for the successful requests: a session modified by a failing
+// request is not saved.
+func (m *Manager) Save(ctx context.Context, w http.ResponseWriter) context.Context {
+	s, ok := FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty {
+		return ctx
+	}
+
+	if err := m.save(ctx, w, s); err != nil {
+		m.fail(ctx, err)
+		return ctx
+	}
+
+	s.dirty = false
+	s.isNew = false
+	s.rotated = ""
+	return ctx
+}
+
+func (m *Manager) save(ctx context.Context, w http.ResponseWriter, s *Session) error {
+	if m.store != nil && s.rotated != "" {
+		if err := m.store.Delete(ctx, s.rotated); err != nil {
+			return err
+		}
+	}
+
+	if s.destroyed {
+		if m.store != nil && !s.isNew {
+			if err := m.store.Delete(ctx, s.id); err != nil {
+				return err
+			}
+		}
+		c := m.newCookie("")
+		c.MaxAge = -1
+		c.Expires = time.Unix(1, 0)
+		http.SetCookie(w, c)
+		return nil
+	}
+
+	expiresAt := time.Now().Add(m.opts.maxAge)
+	data, err := json.Marshal(s.record(expiresAt))
+	if err != nil {
+		return err
+	}
+
+	value := s.id
+	if m.store == nil {
+		if value, err = m.seal(data); err != nil {
+			return err
+		}
+		if len(value) > maxCookieSize {
+			return ErrCookieTooLarge
+		}
+	} else if err := m.store.Set(ctx, s.id, data, m.opts.maxAge); err != nil {
+		return err
+	}
+
+	c := m.newCookie(value)
+	c.MaxAge = int(m.opts.maxAge / time.Second)
+	c.Expires = expiresAt
+	http.SetCookie(w, c)
+	return nil
+}
+
+func (m *Manager) newCookie(value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     m.opts.cookie,
+		Value:    value,
+		Path:     m.opts.path,
+		Domain:   m.opts.domain,
+		Secure:   m.opts.secure,
+		HttpOnly: true,
+		SameSite: m.opts.sameSite,
+	}
+}
+
+// seal encrypts data, authenticated with the cookie name so a value can't
+// be moved to another cookie sealed with the same secret.
+func (m *Manager) seal(data []byte) (string, error) {
+	nonce := make([]byte, m.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := m.aead.Seal(nonce, nonce, data, []byte(m.opts.cookie))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+func (m *Manager) open(value string) ([]byte, bool) {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(sealed) < m.aead.NonceSize() {
+		return nil, false
+	}
+
+	nonce, sealed := sealed[:m.aead.NonceSize()], sealed[m.aead.NonceSize():]
+	data, err := m.aead.Open(nil, nonce, sealed, []byte(m.opts.cookie))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+func (m *Manager) fail(ctx context.Context, err error) {
+	if m.opts.errorHandler != nil {
+		m.opts.errorHandler(ctx, err)
+	}
+}
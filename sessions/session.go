@@ -0,0 +1,280 @@
+// Package sessions keeps the state of browser sessions across requests,
+// either in the session cookie itself, encrypted, or in a Store, the cookie
+// only carrying the id of the session. A Manager loads the session of the
+// requests into their context with its Load RequestFunc, and saves it with
+// its Save ServerResponseFunc:
+//
+//	m := sessions.NewStoreManager(sessions.NewMemoryStore())
+//	server := httptransport.NewServer(e, dec, enc,
+//		httptransport.ServerBefore(m.Load),
+//		httptransport.ServerAfter(m.Save),
+//	)
+//
+//	// in the endpoint
+//	s, _ := sessions.FromContext(ctx)
+//	s.Set("user_id", user.ID)
+//	s.Rotate()
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by a Store when no session has the requested id,
+// or it expired.
+var ErrNotFound = errors.New("sessions: session not found")
+
+// flashKey is the key of the values holding the flash messages.
+const flashKey = "_flash"
+
+// Session is the state of a browser session. Its values are encoded as
+// JSON. Sessions are safe for concurrent use.
+type Session struct {
+	mu        sync.Mutex
+	id        string
+	values    map[string]json.RawMessage
+	createdAt time.Time
+
+	isNew     bool
+	dirty     bool
+	destroyed bool
+
+	// rotated holds the previous id of a rotated session, to delete it from
+	// the Store.
+	rotated string
+}
+
+// record is the encoded form of a session.
+type record struct {
+	ID        string                     `json:"id"`
+	Values    map[string]json.RawMessage `json:"values,omitempty"`
+	CreatedAt time.Time                  `json:"created_at"`
+	ExpiresAt time.Time                  `json:"expires_at"`
+}
+
+func newSession() (*Session, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		id:        id,
+		values:    make(map[string]json.RawMessage),
+		createdAt: time.Now(),
+		isNew:     true,
+	}, nil
+}
+
+// ID returns the id of the session.
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.id
+}
+
+// IsNew reports whether the session was created by the current request.
+func (s *Session) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.isNew
+}
+
+// CreatedAt returns when the session was created.
+func (s *Session) CreatedAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createdAt
+}
+
+// Set sets the value of key, which must be encodable as JSON.
+func (s *Session) Set(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[key] = data
+	s.dirty = true
+	return nil
+}
+
+// Has reports whether key has a value.
+func (s *Session) Has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.values[key]
+	return ok
+}
+
+// Delete removes the value of key.
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.dirty = true
+	}
+}
+
+// Clear removes every value of the session.
+func (s *Session) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values = make(map[string]json.RawMessage)
+	s.dirty = true
+}
+
+// Get returns the value of key in s, decoded as a T. It reports false when
+// key has no value, or one which is not a T.
+func Get[T any](s *Session, key string) (T, bool) {
+	var value T
+
+	s.mu.Lock()
+	data, ok := s.values[key]
+	s.mu.Unlock()
+	if !ok {
+		return value, false
+	}
+
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, false
+	}
+	return value, true
+}
+
+// AddFlash adds a flash message to the session: a value kept until it is
+// read by Flashes, typically by the page following a redirect.
+func (s *Session) AddFlash(value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var flashes []json.RawMessage
+	if raw, ok := s.values[flashKey]; ok {
+		_ = json.Unmarshal(raw, &flashes)
+	}
+	flashes = append(flashes, data)
+
+	raw, err := json.Marshal(flashes)
+	if err != nil {
+		return err
+	}
+	s.values[flashKey] = raw
+	s.dirty = true
+	return nil
+}
+
+// Flashes returns the flash messages of s decoded as T, and removes them from
+// the session. Messages which are not a T are dropped.
+func Flashes[T any](s *Session) []T {
+	s.mu.Lock()
+	raw, ok := s.values[flashKey]
+	if ok {
+		delete(s.values, flashKey)
+		s.dirty = true
+	}
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	var flashes []json.RawMessage
+	if err := json.Unmarshal(raw, &flashes); err != nil {
+		return nil
+	}
+
+	values := make([]T, 0, len(flashes))
+	for _, data := range flashes {
+		var value T
+		if err := json.Unmarshal(data, &value); err == nil {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Rotate gives the session a new id, keeping its values, when it is saved.
+// Call it when the privileges of the session change, such as on login or
+// logout, so an id planted or leaked before can't be used to ride the
+// session.
+func (s *Session) Rotate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := newID()
+	if err != nil {
+		// the session keeps its id, which is still unguessable
+		return
+	}
+
+	if s.rotated == "" && !s.isNew {
+		s.rotated = s.id
+	}
+	s.id = id
+	s.dirty = true
+}
+
+// Destroy removes the session from the Store, and its cookie from the
+// browser, when it is saved.
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values = make(map[string]json.RawMessage)
+	s.destroyed = true
+	s.dirty = true
+}
+
+func (s *Session) record(expiresAt time.Time) *record {
+	return &record{
+		ID:        s.id,
+		Values:    s.values,
+		CreatedAt: s.createdAt,
+		ExpiresAt: expiresAt,
+	}
+}
+
+func sessionOf(rec *record) *Session {
+	values := rec.Values
+	if values == nil {
+		values = make(map[string]json.RawMessage)
+	}
+	return &Session{id: rec.ID, values: values, createdAt: rec.CreatedAt}
+}
+
+type contextKey struct{}
+
+// FromContext returns the session loaded by Manager.Load.
+func FromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(contextKey{}).(*Session)
+	return s, ok
+}
+
+// newID returns 32 random bytes, base64url encoded.
+func newID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,203 @@
+package sessions
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/likearthian/apikit/internal/storeutil"
+)
+
+// Store keeps the encoded server-side sessions, by id. The redisstore
+// package provides a Store backed by Redis.
+type Store interface {
+	// Get returns the data of the session id, or ErrNotFound.
+	Get(ctx context.Context, id string) ([]byte, error)
+
+	// Set stores the data of the session id, for ttl.
+	Set(ctx context.Context, id string, data []byte, ttl time.Duration) error
+
+	// Delete removes the session id. Unknown ids are ignored.
+	Delete(ctx context.Context, id string) error
+}
+
+type memoryEntry struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// MemoryStore is an in-memory Store, for tests and single instance
+// services. Expired sessions are removed as they are looked up, and by
+// Cleanup.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]memoryEntry
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]memoryEntry)}
+}
+
+// Get implements Store.
+func (s *MemoryStore) Get(_ context.Context, id string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if time.Now().After(e.expiresAt) {
+		delete(s.sessions, id)
+		return nil, ErrNotFound
+	}
+
+	return append([]byte(nil), e.data...), nil
+}
+
+// Set implements Store.
+func (s *MemoryStore) Set(_ context.Context, id string, data []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[id] = memoryEntry{
+		data:      append([]byte(nil), data...),
+		expiresAt: time.Now().Add(ttl),
+	}
+	return nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+	return nil
+}
+
+// Cleanup removes the expired sessions.
+func (s *MemoryStore) Cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, e := range s.sessions {
+		if now.After(e.expiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+}
+
+type sqlStoreOption struct {
+	ph storeutil.Placeholders
+}
+
+// SQLStoreOption sets an optional parameter for SQLStore.
+type SQLStoreOption func(opt *sqlStoreOption)
+
+// SQLDollarPlaceholders makes SQLStore use $1, $2... placeholders, as
+// required by PostgreSQL drivers, instead of ?.
+func SQLDollarPlaceholders() SQLStoreOption {
+	return func(opt *sqlStoreOption) { opt.ph.Dollar = true }
+}
+
+// SQLStore is a Store keeping sessions in a table created with:
+//
+//	CREATE TABLE sessions (
+//		id         VARCHAR(64) PRIMARY KEY,
+//		data       BYTEA NOT NULL,
+//		expires_at TIMESTAMP NOT NULL
+//	)
+//
+// Expired sessions are ignored, and removed by Cleanup, which should run
+// periodically.
+type SQLStore struct {
+	db    *sql.DB
+	table string
+	ph    storeutil.Placeholders
+}
+
+// NewSQLStore creates a SQLStore using table.
+func NewSQLStore(db *sql.DB, table string, options ...SQLStoreOption) (*SQLStore, error) {
+	if !storeutil.ValidIdentifier(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+
+	var opts sqlStoreOption
+	for _, option := range options {
+		option(&opts)
+	}
+
+	return &SQLStore{db: db, table: table, ph: opts.ph}, nil
+}
+
+// Get implements Store.
+func (s *SQLStore) Get(ctx context.Context, id string) ([]byte, error) {
+	query := "SELECT data FROM " + s.table + " WHERE id = " + s.ph.Nth(1) +
+		" AND expires_at > " + s.ph.Nth(2)
+
+	var data []byte
+	err := s.db.QueryRowContext(ctx, query, id, time.Now().UTC()).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Set implements Store. It updates the session, or inserts it when it is
+// new, in a transaction.
+func (s *SQLStore) Set(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	expiresAt := time.Now().Add(ttl).UTC()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "UPDATE " + s.table + " SET data = " + s.ph.Nth(1) +
+		", expires_at = " + s.ph.Nth(2) + " WHERE id = " + s.ph.Nth(3)
+	res, err := tx.ExecContext(ctx, query, data, expiresAt, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		query = "INSERT INTO " + s.table + " (id, data, expires_at) VALUES (" + s.ph.List(3) + ")"
+		if _, err := tx.ExecContext(ctx, query, id, data, expiresAt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete implements Store.
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	query := "DELETE FROM " + s.table + " WHERE id = " + s.ph.Nth(1)
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// Cleanup removes the expired sessions, and returns how many were removed.
+func (s *SQLStore) Cleanup(ctx context.Context) (int64, error) {
+	query := "DELETE FROM " + s.table + " WHERE expires_at <= " + s.ph.Nth(1)
+	res, err := s.db.ExecContext(ctx, query, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type diskOption struct {
+	baseURL       string
+	secret        []byte
+	maxUploadSize int64
+}
+
+// DiskOption sets an optional parameter for NewDiskStore.
+type DiskOption func(opt *diskOption)
+
+// DiskSignedURLs enables SignedURL, returning URLs below baseURL (e.g.
+// "https://api.example.com/files") signed with secret. The DiskStore must
+// then be mounted as the http.Handler of baseURL to serve them.
+func DiskSignedURLs(baseURL string, secret []byte) DiskOption {
+	return func(opt *diskOption) {
+		opt.baseURL = strings.TrimSuffix(baseURL, "/")
+		opt.secret = secret
+	}
+}
+
+// DiskMaxUploadSize sets the maximum size of the objects uploaded through the
+// PUT URLs served by ServeHTTP; larger uploads are rejected with 413 Request
+// Entity Too Large. A size lower than 1 disables the limit. Defaults to
+// 100MB.
+func DiskMaxUploadSize(n int64) DiskOption {
+	return func(opt *diskOption) { opt.maxUploadSize = n }
+}
+
+// DiskStore is a BlobStore keeping objects as files below a root directory,
+// for development and single node deployments. Content types are derived from
+// the key extension.
+type DiskStore struct {
+	root          string
+	baseURL       string
+	basePath      string
+	secret        []byte
+	maxUploadSize int64
+	now           func() time.Time
+}
+
+// NewDiskStore creates a DiskStore rooted at root, creating the directory when
+// it does not exist.
+func NewDiskStore(root string, options ...DiskOption) (*DiskStore, error) {
+	opts := &diskOption{maxUploadSize: 100 * 1024 * 1024}
+	for _, option := range options {
+		option(opts)
+	}
+
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &DiskStore{
+		root:          root,
+		baseURL:       opts.baseURL,
+		secret:        opts.secret,
+		maxUploadSize: opts.maxUploadSize,
+		now:           time.Now,
+	}
+
+	if s.baseURL != "" {
+		u, err := url.Parse(s.baseURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base url: %w", err)
+		}
+		s.basePath = u.Path
+	}
+
+	return s, nil
+}
+
+// Put implements BlobStore. The content is written to a temporary file first,
+// so readers never see a partial object.
+func (s *DiskStore) Put(ctx context.Context, key string, r io.Reader, contentType string) (*Object, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), &ctxReader{ctx: ctx, r: r})
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return nil, err
+	}
+
+	return &Object{
+		Key:          key,
+		Size:         size,
+		ContentType:  contentTypeOf(key),
+		ETag:         `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`,
+		LastModified: s.now(),
+	}, nil
+}
+
+// Get implements BlobStore.
+func (s *DiskStore) Get(_ context.Context, key string) (io.ReadCloser, *Object, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return nil, nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	return f, &Object{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  contentTypeOf(key),
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+// SignedURL implements BlobStore. It fails with ErrSignedURLUnsupported
+// unless the store was created with DiskSignedURLs.
+func (s *DiskStore) SignedURL(_ context.Context, key, method string, ttl time.Duration) (string, error) {
+	if s.secret == nil {
+		return "", ErrSignedURLUnsupported
+	}
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(s.now().Add(ttl).Unix(), 10)
+	query := url.Values{
+		"expires":   {expires},
+		"signature": {s.sign(method, key, expires)},
+	}
+
+	return s.baseURL + "/" + escapeKey(key) + "?" + query.Encode(), nil
+}
+
+// Delete implements BlobStore.
+func (s *DiskStore) Delete(_ context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// ServeHTTP serves the URLs returned by SignedURL: GET requests download the
+// object and PUT requests upload it, up to the size set with
+// DiskMaxUploadSize. Requests with a missing, invalid or expired signature
+// are rejected with 403 Forbidden.
+func (s *DiskStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.secret == nil {
+		http.Error(w, ErrSignedURLUnsupported.Error(), http.StatusNotFound)
+		return
+	}
+
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, s.basePath), "/")
+	if err := ValidateKey(key); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !s.verify(r.Method, key, r.URL.Query()) {
+		http.Error(w, "invalid or expired signature", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		rc, obj, err := s.Get(r.Context(), key)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer rc.Close()
+
+		w.Header().Set("Content-Type", obj.ContentType)
+		http.ServeContent(w, r, path.Base(key), obj.LastModified, rc.(io.ReadSeeker))
+	case http.MethodPut:
+		body := r.Body
+		if s.maxUploadSize > 0 {
+			if r.ContentLength > s.maxUploadSize {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			body = http.MaxBytesReader(w, r.Body, s.maxUploadSize)
+		}
+
+		obj, err := s.Put(r.Context(), key, body, r.Header.Get("Content-Type"))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("ETag", obj.ETag)
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *DiskStore) path(key string) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *DiskStore) sign(method, key, expires string) string {
+	// HEAD requests are allowed by GET urls
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+
+	mac := hmac.New(sha256.New, s.secret)
+	io.WriteString(mac, method+"\n"+key+"\n"+expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *DiskStore) verify(method, key string, query url.Values) bool {
+	expires := query.Get("expires")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || s.now().Unix() > unix {
+		return false
+	}
+
+	expected := s.sign(method, key, expires)
+	return hmac.Equal([]byte(expected), []byte(query.Get("signature")))
+}
+
+func contentTypeOf(key string) string {
+	if ct := mime.TypeByExtension(path.Ext(key)); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// escapeKey escapes the elements of key for use in a URL path.
+func escapeKey(key string) string {
+	elems := strings.Split(key, "/")
+	for i, elem := range elems {
+		elems[i] = url.PathEscape(elem)
+	}
+	return strings.Join(elems, "/")
+}
+
+// ctxReader stops reading once ctx is done, so abandoned uploads don't keep
+// writing.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
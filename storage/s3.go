@@ -0,0 +1,516 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3MinPartSize     = 5 * 1024 * 1024
+	s3MaxPresignTTL   = 7 * 24 * time.Hour
+)
+
+// S3Error is an error response of an S3 compatible service.
+type S3Error struct {
+	Status  int    `xml:"-"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("s3: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+type s3Option struct {
+	region       string
+	sessionToken string
+	pathStyle    bool
+	partSize     int64
+	client       *http.Client
+}
+
+// S3Option sets an optional parameter for NewS3Store.
+type S3Option func(opt *s3Option)
+
+// S3Region sets the region requests are signed for. Defaults to "us-east-1",
+// which MinIO also uses; Google Cloud Storage accepts "auto".
+func S3Region(region string) S3Option {
+	return func(opt *s3Option) { opt.region = region }
+}
+
+// S3SessionToken sets the session token of temporary credentials.
+func S3SessionToken(token string) S3Option {
+	return func(opt *s3Option) { opt.sessionToken = token }
+}
+
+// S3PathStyle addresses the bucket in the URL path
+// (https://host/bucket/key) instead of the host name
+// (https://bucket.host/key), as MinIO and most self hosted services expect.
+func S3PathStyle() S3Option {
+	return func(opt *s3Option) { opt.pathStyle = true }
+}
+
+// S3PartSize sets the size of the parts objects are uploaded in, and so the
+// memory used by each upload. Objects smaller than a part are uploaded with a
+// single request. Defaults to 8MB; the minimum is 5MB.
+func S3PartSize(n int64) S3Option {
+	return func(opt *s3Option) {
+		if n < s3MinPartSize {
+			n = s3MinPartSize
+		}
+		opt.partSize = n
+	}
+}
+
+// S3HTTPClient sets the http client used to reach the service. Defaults to
+// http.DefaultClient.
+func S3HTTPClient(client *http.Client) S3Option {
+	return func(opt *s3Option) { opt.client = client }
+}
+
+// S3Store is a BlobStore backed by a bucket of an S3 compatible service:
+// Amazon S3, MinIO, or Google Cloud Storage through its XML API with HMAC
+// keys. Requests are signed with AWS Signature Version 4.
+type S3Store struct {
+	endpoint     *url.URL
+	bucket       string
+	accessKey    string
+	secretKey    string
+	region       string
+	sessionToken string
+	pathStyle    bool
+	partSize     int64
+	client       *http.Client
+	now          func() time.Time
+}
+
+// NewS3Store creates an S3Store for bucket, reached at endpoint (e.g.
+// "https://s3.eu-west-1.amazonaws.com", "https://storage.googleapis.com" or
+// "http://localhost:9000").
+func NewS3Store(endpoint, bucket, accessKey, secretKey string, options ...S3Option) (*S3Store, error) {
+	opts := &s3Option{
+		region:   "us-east-1",
+		partSize: 8 * 1024 * 1024,
+		client:   http.DefaultClient,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", endpoint)
+	}
+	if bucket == "" {
+		return nil, errors.New("s3 bucket is required")
+	}
+
+	return &S3Store{
+		endpoint:     u,
+		bucket:       bucket,
+		accessKey:    accessKey,
+		secretKey:    secretKey,
+		region:       opts.region,
+		sessionToken: opts.sessionToken,
+		pathStyle:    opts.pathStyle,
+		partSize:     opts.partSize,
+		client:       opts.client,
+		now:          time.Now,
+	}, nil
+}
+
+// Put implements BlobStore. Content larger than the part size is sent as a
+// multipart upload, one part at a time, and the upload is aborted on failure.
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, contentType string) (*Object, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	buf := make([]byte, s.partSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		header := http.Header{"Content-Type": {contentType}}
+		res, err := s.do(ctx, http.MethodPut, key, nil, header, buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		res.Body.Close()
+
+		return &Object{
+			Key:          key,
+			Size:         int64(n),
+			ContentType:  contentType,
+			ETag:         res.Header.Get("ETag"),
+			LastModified: s.now(),
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.putMultipart(ctx, key, r, contentType, buf)
+}
+
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (s *S3Store) putMultipart(ctx context.Context, key string, r io.Reader, contentType string, buf []byte) (*Object, error) {
+	res, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, http.Header{"Content-Type": {contentType}}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = decodeS3XML(res, &initiated)
+	if err != nil {
+		return nil, err
+	}
+
+	abort := func(err error) (*Object, error) {
+		query := url.Values{"uploadId": {initiated.UploadID}}
+		if res, aerr := s.do(context.Background(), http.MethodDelete, key, query, nil, nil); aerr == nil {
+			res.Body.Close()
+		}
+		return nil, err
+	}
+
+	var (
+		parts []s3Part
+		size  int64
+		chunk = buf
+	)
+	for len(chunk) > 0 {
+		query := url.Values{
+			"partNumber": {strconv.Itoa(len(parts) + 1)},
+			"uploadId":   {initiated.UploadID},
+		}
+		res, err := s.do(ctx, http.MethodPut, key, query, nil, chunk)
+		if err != nil {
+			return abort(err)
+		}
+		res.Body.Close()
+
+		parts = append(parts, s3Part{PartNumber: len(parts) + 1, ETag: res.Header.Get("ETag")})
+		size += int64(len(chunk))
+
+		n, err := io.ReadFull(r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return abort(err)
+		}
+		chunk = buf[:n]
+	}
+
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return abort(err)
+	}
+
+	res, err = s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {initiated.UploadID}}, nil, body)
+	if err != nil {
+		return abort(err)
+	}
+
+	// the service may answer 200 and still report an error in the body
+	var completed struct {
+		XMLName xml.Name
+		ETag    string `xml:"ETag"`
+		S3Error
+	}
+	if err := decodeS3XML(res, &completed); err != nil {
+		return abort(err)
+	}
+	if completed.XMLName.Local == "Error" {
+		completed.S3Error.Status = res.StatusCode
+		return abort(&completed.S3Error)
+	}
+
+	return &Object{
+		Key:          key,
+		Size:         size,
+		ContentType:  contentType,
+		ETag:         completed.ETag,
+		LastModified: s.now(),
+	}, nil
+}
+
+// Get implements BlobStore.
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, nil, err
+	}
+
+	res, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	obj := &Object{
+		Key:         key,
+		Size:        res.ContentLength,
+		ContentType: res.Header.Get("Content-Type"),
+		ETag:        res.Header.Get("ETag"),
+	}
+	obj.LastModified, _ = http.ParseTime(res.Header.Get("Last-Modified"))
+
+	return res.Body, obj, nil
+}
+
+// SignedURL implements BlobStore, returning a presigned URL valid for at most
+// 7 days. Clients uploading with a PUT URL should send the Content-Type of the
+// object.
+func (s *S3Store) SignedURL(_ context.Context, key, method string, ttl time.Duration) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	if ttl > s3MaxPresignTTL {
+		ttl = s3MaxPresignTTL
+	}
+
+	u := s.objectURL(key)
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	scope := s.scope(now)
+
+	query := url.Values{
+		"X-Amz-Algorithm":     {s3Algorithm},
+		"X-Amz-Credential":    {s.accessKey + "/" + scope},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {strconv.Itoa(int(ttl / time.Second))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if s.sessionToken != "" {
+		query.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	canonical := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		canonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+
+	query.Set("X-Amz-Signature", s.signature(now, amzDate, scope, canonical))
+	u.RawQuery = canonicalQuery(query)
+
+	return u.String(), nil
+}
+
+// Delete implements BlobStore.
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+
+	res, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	res.Body.Close()
+
+	return nil
+}
+
+// do sends a signed request for key and returns the response when it is
+// successful. Error responses are turned into an *S3Error, wrapping
+// ErrNotFound for missing objects.
+func (s *S3Store) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := s.objectURL(key)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if body == nil {
+		req.Body = http.NoBody
+	}
+	for k, values := range header {
+		req.Header[k] = values
+	}
+
+	s.sign(req, u, query, body)
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		defer res.Body.Close()
+
+		s3err := &S3Error{Status: res.StatusCode}
+		if data, err := io.ReadAll(io.LimitReader(res.Body, 64*1024)); err == nil {
+			_ = xml.Unmarshal(data, s3err)
+		}
+		if s3err.Code == "" {
+			s3err.Code = http.StatusText(res.StatusCode)
+		}
+		if res.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s: %s", ErrNotFound, key, s3err)
+		}
+		return nil, s3err
+	}
+
+	return res, nil
+}
+
+// sign adds the Authorization header of AWS Signature Version 4 to req.
+func (s *S3Store) sign(req *http.Request, u *url.URL, query url.Values, body []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	signed := []string{"host"}
+	headers := map[string]string{"host": u.Host}
+	for k := range req.Header {
+		lk := strings.ToLower(k)
+		if lk == "content-type" || strings.HasPrefix(lk, "x-amz-") {
+			signed = append(signed, lk)
+			headers[lk] = strings.TrimSpace(req.Header.Get(k))
+		}
+	}
+	sort.Strings(signed)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range signed {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		u.EscapedPath(),
+		canonicalQuery(query),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := s.scope(now)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.accessKey, scope, signedHeaders, s.signature(now, amzDate, scope, canonical)))
+}
+
+func (s *S3Store) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+func (s *S3Store) signature(now time.Time, amzDate, scope, canonical string) string {
+	sum := sha256.Sum256([]byte(canonical))
+	stringToSign := s3Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	basePath := strings.TrimSuffix(u.Path, "/")
+	if s.pathStyle {
+		basePath += "/" + s.bucket
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+
+	u.Path = basePath + "/" + key
+	u.RawPath = awsURIEncode(basePath, false) + "/" + awsURIEncode(key, false)
+	return &u
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query with its keys sorted, as signatures require.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			pairs = append(pairs, awsURIEncode(k, true)+"="+awsURIEncode(v, true))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// awsURIEncode percent encodes every byte of s but the unreserved characters,
+// and "/" unless encodeSlash is set.
+func awsURIEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&0x0f])
+		}
+	}
+
+	return b.String()
+}
+
+func decodeS3XML(res *http.Response, v interface{}) error {
+	defer res.Body.Close()
+
+	if err := xml.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("s3: invalid response: %w", err)
+	}
+
+	return nil
+}
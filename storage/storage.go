@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when an object does not exist.
+var ErrNotFound = errors.New("object not found")
+
+// ErrInvalidKey is returned for object keys that are empty, absolute or
+// contain "." or ".." elements.
+var ErrInvalidKey = errors.New("invalid object key")
+
+// ErrSignedURLUnsupported is returned by SignedURL when the store was not
+// configured to sign URLs.
+var ErrSignedURLUnsupported = errors.New("signed urls are not supported")
+
+// Object describes a stored object.
+type Object struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// BlobStore stores objects under slash separated keys such as
+// "avatars/42.png". Implementations must be safe for concurrent use.
+type BlobStore interface {
+	// Put stores the content of r under key, replacing any existing object.
+	// The size of r does not need to be known in advance.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) (*Object, error)
+
+	// Get returns the content of the object stored under key, which the
+	// caller must close, or ErrNotFound.
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+
+	// SignedURL returns a URL allowing anyone holding it to send a request
+	// with the given method (GET to download, PUT to upload) for key, until
+	// ttl elapses.
+	SignedURL(ctx context.Context, key, method string, ttl time.Duration) (string, error)
+
+	// Delete removes the object stored under key. Deleting a missing object
+	// is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// ValidateKey checks that key is a relative, slash separated path without
+// "." or ".." elements, so it maps to the same object on every store and
+// can't escape the root directory of a DiskStore.
+func ValidateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.ContainsAny(key, "\\\x00") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+
+	for _, elem := range strings.Split(key, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+	}
+
+	return nil
+}
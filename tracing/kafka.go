@@ -0,0 +1,44 @@
+package tracing
+
+import (
+	"context"
+
+	httptransport "github.com/likearthian/apikit/transport/http"
+	kafkatransport "github.com/likearthian/apikit/transport/kafka"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// KafkaToContext returns a ConsumerRequestFunc that extracts the remote span
+// context from the traceparent/tracestate headers of a consumed record. Like
+// HTTPToContext, it stores the trace id under
+// httptransport.ContextKeyRequestXTraceID when none is set.
+func KafkaToContext(options ...Option) kafkatransport.ConsumerRequestFunc {
+	opts := makeOptions(options)
+
+	return func(ctx context.Context, rec *kafkatransport.Record) context.Context {
+		ctx = opts.propagator.Extract(ctx, kafkatransport.HeaderCarrier{Record: rec})
+
+		sc := trace.SpanContextFromContext(ctx)
+		if !sc.IsValid() {
+			return ctx
+		}
+
+		if traceID, _ := ctx.Value(httptransport.ContextKeyRequestXTraceID).(string); traceID == "" {
+			ctx = context.WithValue(ctx, httptransport.ContextKeyRequestXTraceID, sc.TraceID().String())
+		}
+
+		return ctx
+	}
+}
+
+// ContextToKafka returns a PublisherRequestFunc that injects the span context
+// found in ctx into the headers of a produced record. It is meant to be used
+// with kafkatransport.PublisherBefore.
+func ContextToKafka(options ...Option) kafkatransport.PublisherRequestFunc {
+	opts := makeOptions(options)
+
+	return func(ctx context.Context, rec *kafkatransport.Record) context.Context {
+		opts.propagator.Inject(ctx, kafkatransport.HeaderCarrier{Record: rec})
+		return ctx
+	}
+}
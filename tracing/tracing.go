@@ -0,0 +1,134 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/likearthian/apikit/api"
+	httptransport "github.com/likearthian/apikit/transport/http"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName identifies the tracer created by this package.
+const InstrumentationName = "github.com/likearthian/apikit/tracing"
+
+type tracingOption struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+	kind       trace.SpanKind
+	attributes []attribute.KeyValue
+}
+
+// Option sets an optional parameter for the tracing helpers.
+type Option func(opt *tracingOption)
+
+// WithTracerProvider sets the provider the tracer is taken from. Defaults to
+// the global provider registered with otel.SetTracerProvider.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(opt *tracingOption) { opt.provider = provider }
+}
+
+// WithPropagator sets the propagator used to read and write trace headers.
+// Defaults to W3C trace context and baggage.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(opt *tracingOption) { opt.propagator = propagator }
+}
+
+// WithSpanKind sets the kind of the spans started by TracingMiddleware.
+// Defaults to trace.SpanKindServer; use trace.SpanKindClient around client
+// endpoints.
+func WithSpanKind(kind trace.SpanKind) Option {
+	return func(opt *tracingOption) { opt.kind = kind }
+}
+
+// WithAttributes adds attributes to every span started by TracingMiddleware.
+func WithAttributes(attrs ...attribute.KeyValue) Option {
+	return func(opt *tracingOption) { opt.attributes = append(opt.attributes, attrs...) }
+}
+
+func makeOptions(options []Option) *tracingOption {
+	opts := &tracingOption{
+		provider: otel.GetTracerProvider(),
+		propagator: propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{},
+		),
+		kind: trace.SpanKindServer,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return opts
+}
+
+// HTTPToContext returns a RequestFunc that extracts the remote span context
+// from the traceparent/tracestate headers of an incoming request. When the
+// request carries a valid trace, its id is also stored under
+// httptransport.ContextKeyRequestXTraceID if no X-Trace-Id header was sent, so
+// logs and traces share the same identifier.
+func HTTPToContext(options ...Option) httptransport.RequestFunc {
+	opts := makeOptions(options)
+
+	return func(ctx context.Context, r *http.Request) context.Context {
+		ctx = opts.propagator.Extract(ctx, propagation.HeaderCarrier(r.Header))
+
+		sc := trace.SpanContextFromContext(ctx)
+		if !sc.IsValid() {
+			return ctx
+		}
+
+		if traceID, _ := ctx.Value(httptransport.ContextKeyRequestXTraceID).(string); traceID == "" {
+			ctx = context.WithValue(ctx, httptransport.ContextKeyRequestXTraceID, sc.TraceID().String())
+		}
+
+		return ctx
+	}
+}
+
+// ContextToHTTP returns a RequestFunc that injects the span context found in
+// ctx into the headers of an outgoing request. It is meant to be used with
+// httptransport.ClientBefore.
+func ContextToHTTP(options ...Option) httptransport.RequestFunc {
+	opts := makeOptions(options)
+
+	return func(ctx context.Context, r *http.Request) context.Context {
+		opts.propagator.Inject(ctx, propagation.HeaderCarrier(r.Header))
+		return ctx
+	}
+}
+
+// TracingMiddleware returns a Middleware starting a span named after the
+// endpoint, or the endpoint stored by api.EndpointMiddleware, around every
+// invocation. Errors returned by the endpoint are
+// recorded on the span, which is then flagged with an error status.
+func TracingMiddleware[I, O any](endpointName string, options ...Option) api.Middleware[I, O] {
+	opts := makeOptions(options)
+	tracer := opts.provider.Tracer(InstrumentationName)
+
+	return func(next api.Endpoint[I, O]) api.Endpoint[I, O] {
+		return func(ctx context.Context, request I) (O, error) {
+			ctx, span := tracer.Start(ctx, api.EndpointNameFromContext(ctx, endpointName),
+				trace.WithSpanKind(opts.kind),
+				trace.WithAttributes(opts.attributes...),
+			)
+			defer span.End()
+
+			if reqID, _ := ctx.Value(httptransport.ContextKeyRequestXRequestID).(string); reqID != "" {
+				span.SetAttributes(attribute.String("request.id", reqID))
+			}
+
+			response, err := next(ctx, request)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+
+			return response, err
+		}
+	}
+}
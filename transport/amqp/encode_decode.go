@@ -0,0 +1,44 @@
+package amqp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// DecodeDeliveryFunc extracts a user-domain request object from a delivery.
+type DecodeDeliveryFunc[T any] func(ctx context.Context, d *Delivery) (request T, err error)
+
+// EncodePublishingFunc encodes the passed object into the message to
+// publish, setting its Body and, when needed, ContentType and Headers.
+type EncodePublishingFunc[T any] func(ctx context.Context, msg *Publishing, payload T) error
+
+// DecodeJSONDelivery is a DecodeDeliveryFunc that JSON decodes the delivery
+// body into T, then validates it when it implements api.Validator.
+func DecodeJSONDelivery[T any](ctx context.Context, d *Delivery) (T, error) {
+	var req T
+	if err := json.Unmarshal(d.Body, &req); err != nil {
+		return req, fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+	}
+
+	if err := api.Validate(ctx, &req); err != nil {
+		return req, err
+	}
+
+	return req, nil
+}
+
+// EncodeJSONPublishing is an EncodePublishingFunc that writes the payload as
+// JSON.
+func EncodeJSONPublishing[T any](_ context.Context, msg *Publishing, payload T) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	msg.ContentType = "application/json"
+	msg.Body = data
+	return nil
+}
@@ -0,0 +1,170 @@
+package amqp
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// ErrNotConfirmed is returned by the Publisher endpoint when the broker
+// negatively acknowledges a message.
+var ErrNotConfirmed = errors.New("amqp: message not confirmed by the broker")
+
+// Delivery modes of a Publishing.
+const (
+	Transient  uint8 = 1
+	Persistent uint8 = 2
+)
+
+// Publishing is a message to publish.
+type Publishing struct {
+	Headers       map[string]interface{}
+	ContentType   string
+	CorrelationID string
+	ReplyTo       string
+	MessageID     string
+	DeliveryMode  uint8
+	Timestamp     time.Time
+	Body          []byte
+}
+
+// Confirmation is the pending confirmation of a published message. It is
+// satisfied by the DeferredConfirmation of amqp091-go.
+type Confirmation interface {
+	WaitContext(ctx context.Context) (bool, error)
+}
+
+// Channel publishes messages. It is satisfied by a thin wrapper around the
+// channel of the client, such as the PublishWithDeferredConfirmWithContext
+// method of an amqp091-go Channel in confirm mode. A nil Confirmation means
+// the channel isn't in confirm mode.
+type Channel interface {
+	Publish(ctx context.Context, exchange, key string, msg *Publishing) (Confirmation, error)
+}
+
+// PublisherRequestFunc may take information from the context and put it in
+// the message to publish. PublisherRequestFuncs are executed after encoding
+// the message, but prior to publishing it.
+type PublisherRequestFunc func(ctx context.Context, msg *Publishing) context.Context
+
+// PublisherFinalizerFunc can be used to perform work at the end of a
+// publication, after the message is confirmed.
+type PublisherFinalizerFunc func(ctx context.Context, err error)
+
+// Publisher wraps a Channel and provides a client endpoint publishing
+// messages to an exchange, and waiting for the broker to confirm them.
+type Publisher[T any] struct {
+	ch           Channel
+	exchange     string
+	key          string
+	enc          EncodePublishingFunc[T]
+	before       []PublisherRequestFunc
+	finalizer    []PublisherFinalizerFunc
+	timeout      time.Duration
+	deliveryMode uint8
+}
+
+type publisherOption struct {
+	before       []PublisherRequestFunc
+	finalizer    []PublisherFinalizerFunc
+	timeout      time.Duration
+	deliveryMode uint8
+}
+
+// PublisherOption sets an optional parameter for publishers.
+type PublisherOption func(opt *publisherOption)
+
+// NewPublisher constructs a publisher publishing the messages encoded by enc
+// to exchange with the routing key key.
+func NewPublisher[T any](
+	ch Channel,
+	exchange, key string,
+	enc EncodePublishingFunc[T],
+	options ...PublisherOption,
+) *Publisher[T] {
+	opts := &publisherOption{
+		timeout:      10 * time.Second,
+		deliveryMode: Persistent,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return &Publisher[T]{
+		ch:           ch,
+		exchange:     exchange,
+		key:          key,
+		enc:          enc,
+		before:       opts.before,
+		finalizer:    opts.finalizer,
+		timeout:      opts.timeout,
+		deliveryMode: opts.deliveryMode,
+	}
+}
+
+// PublisherBefore sets the RequestFuncs that are applied to the outgoing
+// message before it's published.
+func PublisherBefore(before ...PublisherRequestFunc) PublisherOption {
+	return func(p *publisherOption) { p.before = append(p.before, before...) }
+}
+
+// PublisherFinalizer is executed at the end of every publication.
+// By default, no finalizer is registered.
+func PublisherFinalizer(f ...PublisherFinalizerFunc) PublisherOption {
+	return func(p *publisherOption) { p.finalizer = append(p.finalizer, f...) }
+}
+
+// PublisherTimeout sets how long to wait for the confirmation of a message.
+// Defaults to 10 seconds.
+func PublisherTimeout(d time.Duration) PublisherOption {
+	return func(p *publisherOption) { p.timeout = d }
+}
+
+// PublisherDeliveryMode sets the delivery mode of the messages, unless the
+// encoder sets one. Defaults to Persistent.
+func PublisherDeliveryMode(mode uint8) PublisherOption {
+	return func(p *publisherOption) { p.deliveryMode = mode }
+}
+
+// Endpoint returns a usable endpoint that publishes its payload, and returns
+// once the broker confirmed it, or with ErrNotConfirmed.
+func (p Publisher[T]) Endpoint() api.Endpoint[T, struct{}] {
+	return func(ctx context.Context, payload T) (_ struct{}, err error) {
+		if len(p.finalizer) > 0 {
+			defer func() {
+				for _, f := range p.finalizer {
+					f(ctx, err)
+				}
+			}()
+		}
+
+		msg := &Publishing{Timestamp: time.Now()}
+		if err = p.enc(ctx, msg, payload); err != nil {
+			return struct{}{}, err
+		}
+		if msg.DeliveryMode == 0 {
+			msg.DeliveryMode = p.deliveryMode
+		}
+
+		for _, f := range p.before {
+			ctx = f(ctx, msg)
+		}
+
+		tctx, cancel := context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+
+		confirm, err := p.ch.Publish(tctx, p.exchange, p.key, msg)
+		if err != nil || confirm == nil {
+			return struct{}{}, err
+		}
+
+		acked, err := confirm.WaitContext(tctx)
+		if err == nil && !acked {
+			err = ErrNotConfirmed
+		}
+
+		return struct{}{}, err
+	}
+}
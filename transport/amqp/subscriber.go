@@ -0,0 +1,279 @@
+// Package amqp exposes endpoints over AMQP 0.9.1 brokers, such as RabbitMQ:
+// Subscriber processes the deliveries of a queue with an endpoint, and
+// Publisher is a client endpoint publishing messages with confirms.
+//
+// The package doesn't depend on an AMQP client. Deliveries are filled from
+// those of the client, such as amqp091-go, whose Delivery is its own
+// Acknowledger and whose Table can be assigned to Headers as is:
+//
+//	ch.Qos(sub.Prefetch(), 0, false)
+//	deliveries, _ := ch.Consume("orders", "", false, false, false, false, nil)
+//	for d := range deliveries {
+//		sub.ServeDelivery(ctx, &amqptransport.Delivery{
+//			Acknowledger: d, Headers: d.Headers, Body: d.Body, ...
+//		})
+//	}
+package amqp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/logger"
+	trxkit "github.com/likearthian/apikit/transport"
+	httptransport "github.com/likearthian/apikit/transport/http"
+)
+
+// Acknowledger acknowledges a delivery. It is satisfied by the Delivery of
+// amqp091-go.
+type Acknowledger interface {
+	Ack(multiple bool) error
+	Nack(multiple, requeue bool) error
+	Reject(requeue bool) error
+}
+
+// Delivery is a message delivered from a queue.
+type Delivery struct {
+	Acknowledger Acknowledger
+
+	Headers       map[string]interface{}
+	ContentType   string
+	CorrelationID string
+	ReplyTo       string
+	MessageID     string
+	Exchange      string
+	RoutingKey    string
+	Redelivered   bool
+	Body          []byte
+}
+
+// RequeueError is returned by endpoints to have the delivery requeued, to be
+// delivered again.
+type RequeueError struct {
+	Err error
+}
+
+func (e *RequeueError) Error() string { return e.Err.Error() }
+
+func (e *RequeueError) Unwrap() error { return e.Err }
+
+// DeadLetterError is returned by endpoints to have the delivery rejected
+// without requeueing, so the broker routes it to the dead letter exchange of
+// the queue, if any.
+type DeadLetterError struct {
+	Err error
+}
+
+func (e *DeadLetterError) Error() string { return e.Err.Error() }
+
+func (e *DeadLetterError) Unwrap() error { return e.Err }
+
+// Requeue wraps err in a *RequeueError.
+func Requeue(err error) error {
+	return &RequeueError{Err: err}
+}
+
+// DeadLetter wraps err in a *DeadLetterError.
+func DeadLetter(err error) error {
+	return &DeadLetterError{Err: err}
+}
+
+// RequestFunc may take information from a delivery and put it in the request
+// context. RequestFuncs are executed prior to decoding the delivery.
+type RequestFunc func(ctx context.Context, d *Delivery) context.Context
+
+// SubscriberFinalizerFunc can be used to perform work at the end of the
+// processing of a delivery, after it is acknowledged.
+type SubscriberFinalizerFunc func(ctx context.Context, err error)
+
+// Subscriber wraps an endpoint and processes the deliveries of a queue with
+// it, acknowledging them manually. A delivery is acked when the endpoint
+// succeeds. When it fails, a *RequeueError requeues the delivery and a
+// *DeadLetterError rejects it; other errors are decided by the requeue
+// policy.
+type Subscriber[I, O any] struct {
+	e            api.Endpoint[I, O]
+	dec          DecodeDeliveryFunc[I]
+	before       []RequestFunc
+	errorHandler trxkit.ErrorHandler
+	finalizer    []SubscriberFinalizerFunc
+	prefetch     int
+	requeue      func(d *Delivery, err error) bool
+}
+
+type subscriberOption struct {
+	before       []RequestFunc
+	errorHandler trxkit.ErrorHandler
+	finalizer    []SubscriberFinalizerFunc
+	prefetch     int
+	requeue      func(d *Delivery, err error) bool
+}
+
+// SubscriberOption sets an optional parameter for subscribers.
+type SubscriberOption func(opt *subscriberOption)
+
+// NewSubscriber constructs a new subscriber processing deliveries with the
+// provided endpoint. The responses of the endpoint are discarded.
+func NewSubscriber[I, O any](
+	e api.Endpoint[I, O],
+	dec DecodeDeliveryFunc[I],
+	options ...SubscriberOption,
+) *Subscriber[I, O] {
+	opts := &subscriberOption{
+		prefetch: 10,
+		requeue:  DefaultRequeuePolicy,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	s := &Subscriber[I, O]{
+		e:            e,
+		dec:          dec,
+		before:       opts.before,
+		errorHandler: trxkit.NewLogErrorHandler(logger.NewNoopLogger()),
+		finalizer:    opts.finalizer,
+		prefetch:     opts.prefetch,
+		requeue:      opts.requeue,
+	}
+
+	if opts.errorHandler != nil {
+		s.errorHandler = opts.errorHandler
+	}
+
+	return s
+}
+
+// SubscriberBefore functions are executed on the delivery before it is
+// decoded.
+func SubscriberBefore(before ...RequestFunc) SubscriberOption {
+	return func(s *subscriberOption) { s.before = append(s.before, before...) }
+}
+
+// SubscriberErrorHandler is used to handle the errors of the deliveries, and
+// of their acknowledgements. By default, errors are ignored.
+func SubscriberErrorHandler(errorHandler trxkit.ErrorHandler) SubscriberOption {
+	return func(s *subscriberOption) { s.errorHandler = errorHandler }
+}
+
+// SubscriberFinalizer is executed at the end of every delivery.
+// By default, no finalizer is registered.
+func SubscriberFinalizer(f ...SubscriberFinalizerFunc) SubscriberOption {
+	return func(s *subscriberOption) { s.finalizer = append(s.finalizer, f...) }
+}
+
+// SubscriberPrefetch sets how many unacknowledged deliveries the broker may
+// send to the consumer, and how many Serve processes concurrently. Defaults
+// to 10.
+func SubscriberPrefetch(n int) SubscriberOption {
+	return func(s *subscriberOption) { s.prefetch = n }
+}
+
+// SubscriberRequeuePolicy sets the function deciding whether a delivery
+// failing with an error other than *RequeueError and *DeadLetterError is
+// requeued, or rejected. Defaults to DefaultRequeuePolicy.
+func SubscriberRequeuePolicy(fn func(d *Delivery, err error) bool) SubscriberOption {
+	return func(s *subscriberOption) { s.requeue = fn }
+}
+
+// DefaultRequeuePolicy requeues a delivery once, unless its error won't go
+// away by processing it again: it reports a 4xx status code other than 408
+// Request Timeout and 429 Too Many Requests, or wraps api.ErrBadRequest, such
+// as the errors of decoders.
+func DefaultRequeuePolicy(d *Delivery, err error) bool {
+	if d.Redelivered {
+		return false
+	}
+
+	var sc httptransport.StatusCoder
+	if errors.As(err, &sc) {
+		code := sc.StatusCode()
+		return code < 400 || code >= 500 ||
+			code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+	}
+	return !errors.Is(err, api.ErrBadRequest)
+}
+
+// Prefetch returns the prefetch count to set on the channel with Qos.
+func (s Subscriber[I, O]) Prefetch() int {
+	return s.prefetch
+}
+
+// Serve processes the deliveries received on deliveries, up to the prefetch
+// count concurrently, until the channel is closed or ctx is done.
+func (s Subscriber[I, O]) Serve(ctx context.Context, deliveries <-chan *Delivery) error {
+	workers := s.prefetch
+	if workers < 1 {
+		workers = 1
+	}
+
+	sem := make(chan struct{}, workers)
+	defer func() {
+		// wait for the deliveries in progress
+		for i := 0; i < workers; i++ {
+			sem <- struct{}{}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case d, ok := <-deliveries:
+			if !ok {
+				return nil
+			}
+			sem <- struct{}{}
+			go func() {
+				defer func() { <-sem }()
+				s.ServeDelivery(ctx, d)
+			}()
+		}
+	}
+}
+
+// ServeDelivery processes d and acknowledges it.
+func (s Subscriber[I, O]) ServeDelivery(ctx context.Context, d *Delivery) {
+	var err error
+	if len(s.finalizer) > 0 {
+		defer func() {
+			for _, f := range s.finalizer {
+				f(ctx, err)
+			}
+		}()
+	}
+
+	for _, f := range s.before {
+		ctx = f(ctx, d)
+	}
+
+	var request I
+	if request, err = s.dec(ctx, d); err == nil {
+		_, err = s.e(ctx, request)
+	}
+
+	var (
+		ackErr     error
+		requeueErr *RequeueError
+		deadErr    *DeadLetterError
+	)
+	switch {
+	case err == nil:
+		ackErr = d.Acknowledger.Ack(false)
+	case errors.As(err, &requeueErr):
+		s.errorHandler.Handle(ctx, err)
+		ackErr = d.Acknowledger.Nack(false, true)
+	case errors.As(err, &deadErr):
+		s.errorHandler.Handle(ctx, err)
+		ackErr = d.Acknowledger.Reject(false)
+	default:
+		s.errorHandler.Handle(ctx, err)
+		ackErr = d.Acknowledger.Nack(false, s.requeue(d, err))
+	}
+
+	if ackErr != nil {
+		s.errorHandler.Handle(ctx, ackErr)
+	}
+}
@@ -0,0 +1,114 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/apierror"
+)
+
+// Error is a GraphQL error whose extensions are sent in the "extensions"
+// member of the error, by the libraries recognizing the Extensions method:
+// graphql-go/graphql, graph-gophers/graphql-go and, through its error
+// presenter, gqlgen. Endpoints may return it to choose the error sent to the
+// client.
+type Error struct {
+	Message string
+	Err     error
+
+	extensions map[string]interface{}
+}
+
+// NewError returns an Error with message and extensions.
+func NewError(message string, extensions map[string]interface{}) *Error {
+	return &Error{Message: message, extensions: extensions}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Extensions returns the extensions of the error.
+func (e *Error) Extensions() map[string]interface{} {
+	return e.extensions
+}
+
+// ErrorEncoder converts the error of a resolver into the error returned to
+// the GraphQL library.
+type ErrorEncoder func(ctx context.Context, err error) error
+
+// DefaultErrorEncoder returns the *Error wrapped by err, if any, or else
+// converts err with apierror.From into an *Error whose extensions hold its
+// code, its HTTP status and its details, and the field errors of an
+// *api.ValidationError under "fields". The messages of internal errors are
+// not disclosed.
+func DefaultErrorEncoder(_ context.Context, err error) error {
+	var gqlErr *Error
+	if errors.As(err, &gqlErr) {
+		return gqlErr
+	}
+
+	aerr := apierror.From(err)
+	ext := map[string]interface{}{
+		"code":   aerr.Code,
+		"status": aerr.StatusCode(),
+	}
+
+	if aerr.StatusCode() == http.StatusInternalServerError {
+		return &Error{Message: http.StatusText(http.StatusInternalServerError), Err: err, extensions: ext}
+	}
+
+	if len(aerr.Details) > 0 {
+		ext["details"] = aerr.Details
+	}
+	var verr *api.ValidationError
+	if errors.As(err, &verr) {
+		ext["fields"] = verr.Fields
+	}
+
+	return &Error{Message: aerr.Message, Err: err, extensions: ext}
+}
+
+// DecodeArgsFunc extracts a user-domain request object from the arguments of
+// a field, as coerced by the GraphQL library.
+type DecodeArgsFunc[T any] func(ctx context.Context, args map[string]interface{}) (request T, err error)
+
+// DecodeArgs is a DecodeArgsFunc converting the arguments into T through
+// JSON, so they are matched to the `json` tags of its fields, and input
+// objects and lists to its nested structs and slices. T is then validated,
+// with its `validate` tags and its Validate method.
+func DecodeArgs[T any](ctx context.Context, args map[string]interface{}) (T, error) {
+	var req T
+	if len(args) > 0 {
+		data, err := json.Marshal(args)
+		if err != nil {
+			return req, fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+		}
+		if err := json.Unmarshal(data, &req); err != nil {
+			return req, fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+		}
+	}
+
+	if err := api.ValidateStruct(&req, "json"); err != nil {
+		return req, err
+	}
+	if err := api.Validate(ctx, &req); err != nil {
+		return req, err
+	}
+
+	return req, nil
+}
+
+// NoArgs is a DecodeArgsFunc for the endpoints without request, such as a
+// "me" query.
+func NoArgs(context.Context, map[string]interface{}) (struct{}, error) {
+	return struct{}{}, nil
+}
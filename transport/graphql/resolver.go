@@ -0,0 +1,227 @@
+// Package graphql exposes endpoints as the resolvers of the fields of a
+// GraphQL schema. It does not depend on a GraphQL library: a ResolverFunc
+// takes the arguments of a field as coerced by the library, and its errors
+// carry the extensions the libraries send to the clients.
+//
+//	rs := graphql.NewResolvers()
+//	user := graphql.Query(rs, "user", api.Chain(authn, logging)(getUser),
+//		graphql.DecodeArgs[GetUserRequest])
+//
+//	// graphql-go/graphql
+//	fields := graph.Fields{"user": &graph.Field{
+//		Type: userType,
+//		Args: graph.FieldConfigArgument{"id": &graph.ArgumentConfig{Type: graph.ID}},
+//		Resolve: func(p graph.ResolveParams) (interface{}, error) {
+//			return user(p.Context, p.Args)
+//		},
+//	}}
+//
+//	r.Handle("/graphql", graphql.MakeHttpContextMiddleware(
+//		httptransport.AuthTokenToContext)(handler.New(&handler.Config{Schema: &schema})))
+package graphql
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/logger"
+	trxkit "github.com/likearthian/apikit/transport"
+	httptransport "github.com/likearthian/apikit/transport/http"
+)
+
+// Operation types of the resolved fields.
+const (
+	OperationQuery    = "query"
+	OperationMutation = "mutation"
+)
+
+type contextKey int
+
+const (
+	// ContextKeyField is populated in the context of each resolver call
+	// with the name of the field resolved.
+	ContextKeyField contextKey = iota
+
+	// ContextKeyOperation is populated in the context of each resolver
+	// call with the operation type of the field resolved, OperationQuery
+	// or OperationMutation.
+	ContextKeyOperation
+)
+
+// FieldFromContext returns the name of the field resolved.
+func FieldFromContext(ctx context.Context) string {
+	field, _ := ctx.Value(ContextKeyField).(string)
+	return field
+}
+
+// OperationFromContext returns the operation type of the field resolved.
+func OperationFromContext(ctx context.Context) string {
+	op, _ := ctx.Value(ContextKeyOperation).(string)
+	return op
+}
+
+// ResolverFunc resolves a field from its arguments, as coerced by the
+// GraphQL library.
+type ResolverFunc func(ctx context.Context, args map[string]interface{}) (interface{}, error)
+
+// Resolvers holds the resolvers made of endpoints, by operation type and
+// field name.
+type Resolvers struct {
+	mu        sync.RWMutex
+	queries   map[string]ResolverFunc
+	mutations map[string]ResolverFunc
+
+	errorEncoder ErrorEncoder
+	errorHandler trxkit.ErrorHandler
+}
+
+type resolversOption struct {
+	errorEncoder ErrorEncoder
+	errorHandler trxkit.ErrorHandler
+}
+
+// ResolversOption sets an optional parameter for resolvers.
+type ResolversOption func(opt *resolversOption)
+
+// NewResolvers constructs a new registry without resolvers.
+func NewResolvers(options ...ResolversOption) *Resolvers {
+	opts := &resolversOption{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	rs := &Resolvers{
+		queries:      make(map[string]ResolverFunc),
+		mutations:    make(map[string]ResolverFunc),
+		errorEncoder: DefaultErrorEncoder,
+		errorHandler: trxkit.NewLogErrorHandler(logger.NewNoopLogger()),
+	}
+
+	if opts.errorEncoder != nil {
+		rs.errorEncoder = opts.errorEncoder
+	}
+
+	if opts.errorHandler != nil {
+		rs.errorHandler = opts.errorHandler
+	}
+
+	return rs
+}
+
+// ResolversErrorEncoder is used to convert the errors of the endpoints into
+// GraphQL errors. By default, errors are converted with the
+// DefaultErrorEncoder.
+func ResolversErrorEncoder(ee ErrorEncoder) ResolversOption {
+	return func(o *resolversOption) { o.errorEncoder = ee }
+}
+
+// ResolversErrorHandler is used to handle the errors of the endpoints before
+// they are encoded. By default, errors are ignored.
+func ResolversErrorHandler(errorHandler trxkit.ErrorHandler) ResolversOption {
+	return func(o *resolversOption) { o.errorHandler = errorHandler }
+}
+
+// Query makes e the resolver of the field name of the Query type, decoding
+// its arguments with dec, and registers it in rs.
+func Query[I, O any](rs *Resolvers, name string, e api.Endpoint[I, O], dec DecodeArgsFunc[I]) ResolverFunc {
+	return register(rs, OperationQuery, name, e, dec)
+}
+
+// Mutation makes e the resolver of the field name of the Mutation type,
+// decoding its arguments with dec, and registers it in rs.
+func Mutation[I, O any](rs *Resolvers, name string, e api.Endpoint[I, O], dec DecodeArgsFunc[I]) ResolverFunc {
+	return register(rs, OperationMutation, name, e, dec)
+}
+
+// register makes the resolver of a field and stores it, replacing the
+// resolver registered for the same field, if any. It panics when name is
+// empty.
+func register[I, O any](rs *Resolvers, op, name string, e api.Endpoint[I, O], dec DecodeArgsFunc[I]) ResolverFunc {
+	if name == "" {
+		panic("graphql: empty field name")
+	}
+
+	resolver := func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+		ctx = context.WithValue(ctx, ContextKeyOperation, op)
+		ctx = context.WithValue(ctx, ContextKeyField, name)
+
+		request, err := dec(ctx, args)
+		if err != nil {
+			rs.errorHandler.Handle(ctx, err)
+			return nil, rs.errorEncoder(ctx, err)
+		}
+
+		response, err := e(ctx, request)
+		if err != nil {
+			rs.errorHandler.Handle(ctx, err)
+			return nil, rs.errorEncoder(ctx, err)
+		}
+
+		return response, nil
+	}
+
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	if op == OperationMutation {
+		rs.mutations[name] = resolver
+	} else {
+		rs.queries[name] = resolver
+	}
+
+	return resolver
+}
+
+// Queries returns the resolvers of the fields of the Query type, by field
+// name.
+func (rs *Resolvers) Queries() map[string]ResolverFunc {
+	return rs.copy(rs.queries)
+}
+
+// Mutations returns the resolvers of the fields of the Mutation type, by
+// field name.
+func (rs *Resolvers) Mutations() map[string]ResolverFunc {
+	return rs.copy(rs.mutations)
+}
+
+// Resolver returns the resolver of the field name of the operation type op,
+// or nil.
+func (rs *Resolvers) Resolver(op, name string) ResolverFunc {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	if op == OperationMutation {
+		return rs.mutations[name]
+	}
+	return rs.queries[name]
+}
+
+func (rs *Resolvers) copy(m map[string]ResolverFunc) map[string]ResolverFunc {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	resolvers := make(map[string]ResolverFunc, len(m))
+	for name, resolver := range m {
+		resolvers[name] = resolver
+	}
+	return resolvers
+}
+
+// MakeHttpContextMiddleware returns a middleware executing the before
+// functions on the requests of a GraphQL HTTP handler, so what they put in
+// the request context, such as the token read by
+// httptransport.AuthTokenToContext, reaches the resolvers and the
+// middlewares of their endpoints.
+func MakeHttpContextMiddleware(before ...httptransport.RequestFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			for _, f := range before {
+				ctx = f(ctx, r)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
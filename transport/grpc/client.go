@@ -0,0 +1,138 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/likearthian/apikit/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Client wraps a gRPC connection and provides a method that implements
+// api.Endpoint.
+type Client[I, O any] struct {
+	client    *grpc.ClientConn
+	method    string
+	enc       EncodeRequestFunc[I]
+	dec       DecodeResponseFunc[O]
+	grpcReply reflect.Type
+	before    []ClientRequestFunc
+	after     []ClientResponseFunc
+	finalizer []ClientFinalizerFunc
+}
+
+type clientOption struct {
+	before    []ClientRequestFunc
+	after     []ClientResponseFunc
+	finalizer []ClientFinalizerFunc
+}
+
+// ClientOption sets an optional parameter for clients.
+type ClientOption func(opt *clientOption)
+
+// NewClient constructs a usable Client for a single remote endpoint.
+// Pass an zero-value protobuf message of the RPC response type as
+// the grpcReply argument.
+func NewClient[I, O any](
+	cc *grpc.ClientConn,
+	serviceName string,
+	method string,
+	enc EncodeRequestFunc[I],
+	dec DecodeResponseFunc[O],
+	grpcReply interface{},
+	options ...ClientOption,
+) *Client[I, O] {
+	opts := &clientOption{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return &Client[I, O]{
+		client: cc,
+		method: fmt.Sprintf("/%s/%s", serviceName, method),
+		enc:    enc,
+		dec:    dec,
+		// We are using reflect.Indirect here to allow both reply structs and
+		// pointers to these reply structs.
+		grpcReply: reflect.TypeOf(
+			reflect.Indirect(
+				reflect.ValueOf(grpcReply),
+			).Interface(),
+		),
+		before:    opts.before,
+		after:     opts.after,
+		finalizer: opts.finalizer,
+	}
+}
+
+// ClientBefore sets the RequestFuncs that are applied to the outgoing gRPC
+// request before it's invoked.
+func ClientBefore(before ...ClientRequestFunc) ClientOption {
+	return func(c *clientOption) { c.before = append(c.before, before...) }
+}
+
+// ClientAfter sets the ClientResponseFuncs that are applied to the incoming
+// gRPC response prior to it being decoded. This is useful for obtaining
+// response metadata and adding onto the context prior to decoding.
+func ClientAfter(after ...ClientResponseFunc) ClientOption {
+	return func(c *clientOption) { c.after = append(c.after, after...) }
+}
+
+// ClientFinalizer is executed at the end of every gRPC request.
+// By default, no finalizer is registered.
+func ClientFinalizer(f ...ClientFinalizerFunc) ClientOption {
+	return func(c *clientOption) { c.finalizer = append(c.finalizer, f...) }
+}
+
+// Endpoint returns a usable endpoint that will invoke the gRPC specified by the
+// client.
+func (c Client[I, O]) Endpoint() api.Endpoint[I, O] {
+	return func(ctx context.Context, request I) (response O, err error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		if c.finalizer != nil {
+			defer func() {
+				for _, f := range c.finalizer {
+					f(ctx, err)
+				}
+			}()
+		}
+
+		ctx = context.WithValue(ctx, ContextKeyRequestMethod, c.method)
+
+		req, err := c.enc(ctx, request)
+		if err != nil {
+			return response, err
+		}
+
+		md := &metadata.MD{}
+		for _, f := range c.before {
+			ctx = f(ctx, md)
+		}
+		ctx = metadata.NewOutgoingContext(ctx, *md)
+
+		var header, trailer metadata.MD
+		grpcReply := reflect.New(c.grpcReply).Interface()
+		if err = c.client.Invoke(
+			ctx, c.method, req, grpcReply, grpc.Header(&header),
+			grpc.Trailer(&trailer),
+		); err != nil {
+			return response, err
+		}
+
+		for _, f := range c.after {
+			ctx = f(ctx, header, trailer)
+		}
+
+		return c.dec(ctx, grpcReply)
+	}
+}
+
+// ClientFinalizerFunc can be used to perform work at the end of a client gRPC
+// request, after the response is returned. The principal
+// intended use is for error logging.
+// Note: err may be nil.
+type ClientFinalizerFunc func(ctx context.Context, err error)
@@ -0,0 +1,38 @@
+package grpc
+
+type contextKey int
+
+const (
+	// ContextKeyRequestMethod is populated in the context by Interceptor and
+	// by Client. Its value is the full gRPC method name, e.g.
+	// "/package.Service/Method".
+	ContextKeyRequestMethod contextKey = iota
+
+	// ContextKeyRequestAuthority is populated in the context by
+	// PopulateRequestContext. Its value is md[":authority"].
+	ContextKeyRequestAuthority
+
+	// ContextKeyRequestRemoteAddr is populated in the context by
+	// PopulateRequestContext. Its value is the address of the calling peer.
+	ContextKeyRequestRemoteAddr
+
+	// ContextKeyRequestAuthorization is populated in the context by
+	// PopulateRequestContext. Its value is md["authorization"].
+	ContextKeyRequestAuthorization
+
+	// ContextKeyRequestUserAgent is populated in the context by
+	// PopulateRequestContext. Its value is md["user-agent"].
+	ContextKeyRequestUserAgent
+
+	// ContextKeyRequestXRequestID is populated in the context by
+	// PopulateRequestContext. Its value is md["x-request-id"].
+	ContextKeyRequestXRequestID
+
+	// ContextKeyRequestXTraceID is populated in the context by
+	// PopulateRequestContext. Its value is md["x-trace-id"].
+	ContextKeyRequestXTraceID
+
+	// ContextKeyRequestXForwardedFor is populated in the context by
+	// PopulateRequestContext. Its value is md["x-forwarded-for"].
+	ContextKeyRequestXForwardedFor
+)
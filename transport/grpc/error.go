@@ -0,0 +1,132 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorEncoder is responsible for converting an error returned by the decoder,
+// endpoint or encoder into the error handed back to grpc-go. Errors created
+// with the status package should be passed to the client as is; with
+// DefaultErrorEncoder, the errors it doesn't recognize are reported with
+// codes.Internal.
+type ErrorEncoder func(ctx context.Context, err error) error
+
+// StatusCoder is checked by DefaultErrorEncoder. It is the same contract used
+// by the http transport, so errors carrying an HTTP status code keep their
+// meaning when the endpoint is exposed over gRPC.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// GRPCStatuser may be implemented by errors that know their own gRPC status.
+// It takes precedence over StatusCoder in DefaultErrorEncoder.
+type GRPCStatuser interface {
+	GRPCStatus() *status.Status
+}
+
+// DefaultErrorEncoder converts err into a gRPC status error. Errors that
+// already carry a gRPC status are returned untouched, errors implementing
+// StatusCoder are mapped with HTTPStatusToCode, context errors are mapped to
+// their gRPC equivalent and everything else becomes codes.Internal.
+func DefaultErrorEncoder(_ context.Context, err error) error {
+	var gs GRPCStatuser
+	if errors.As(err, &gs) {
+		return gs.GRPCStatus().Err()
+	}
+
+	var sc StatusCoder
+	if errors.As(err, &sc) {
+		return status.Error(HTTPStatusToCode(sc.StatusCode()), err.Error())
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
+
+// MakeErrorEncoder returns an ErrorEncoder that maps errors to an HTTP status
+// code using err2code (e.g. apikit.Err2code) and converts that status into the
+// corresponding gRPC code.
+func MakeErrorEncoder(err2code func(error) int) ErrorEncoder {
+	return func(ctx context.Context, err error) error {
+		var gs GRPCStatuser
+		if errors.As(err, &gs) {
+			return gs.GRPCStatus().Err()
+		}
+
+		return status.Error(HTTPStatusToCode(err2code(err)), err.Error())
+	}
+}
+
+// HTTPStatusToCode maps an HTTP status code to the closest gRPC code.
+func HTTPStatusToCode(code int) codes.Code {
+	switch code {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized, http.StatusNetworkAuthenticationRequired:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		return codes.DeadlineExceeded
+	}
+
+	return codes.Internal
+}
+
+// CodeToHTTPStatus maps a gRPC code to the closest HTTP status code, as
+// grpc-gateway does.
+func CodeToHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
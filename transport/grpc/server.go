@@ -0,0 +1,187 @@
+package grpc
+
+// This package were taken and modified from https://github.com/go-kit/kit by peter bourgon
+
+import (
+	"context"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/logger"
+	trxkit "github.com/likearthian/apikit/transport"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Handler which should be called from the gRPC binding of the service
+// implementation. The incoming request parameter, and returned response
+// parameter, are both gRPC types, not user-domain.
+type Handler interface {
+	ServeGRPC(ctx context.Context, request interface{}) (context.Context, interface{}, error)
+}
+
+// Server wraps an endpoint and implements grpc.Handler.
+type Server[I, O any] struct {
+	e            api.Endpoint[I, O]
+	dec          DecodeRequestFunc[I]
+	enc          EncodeResponseFunc[O]
+	before       []ServerRequestFunc
+	after        []ServerResponseFunc
+	errorEncoder ErrorEncoder
+	finalizer    []ServerFinalizerFunc
+	errorHandler trxkit.ErrorHandler
+}
+
+type serverOption struct {
+	before       []ServerRequestFunc
+	after        []ServerResponseFunc
+	errorEncoder ErrorEncoder
+	errorHandler trxkit.ErrorHandler
+	finalizer    []ServerFinalizerFunc
+}
+
+// ServerOption sets an optional parameter for servers.
+type ServerOption func(opt *serverOption)
+
+// NewServer constructs a new server, which implements wraps the provided
+// endpoint and implements the Handler interface. Consumers should write
+// bindings that adapt the concrete gRPC methods from their compiled protobuf
+// definitions to individual handlers. Request and response objects are from the
+// caller business domain, not gRPC request and reply types.
+func NewServer[I, O any](
+	e api.Endpoint[I, O],
+	dec DecodeRequestFunc[I],
+	enc EncodeResponseFunc[O],
+	options ...ServerOption,
+) *Server[I, O] {
+	opts := &serverOption{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	s := &Server[I, O]{
+		e:            e,
+		dec:          dec,
+		enc:          enc,
+		errorEncoder: DefaultErrorEncoder,
+		errorHandler: trxkit.NewLogErrorHandler(logger.NewNoopLogger()),
+		before:       opts.before,
+		after:        opts.after,
+		finalizer:    opts.finalizer,
+	}
+
+	if opts.errorEncoder != nil {
+		s.errorEncoder = opts.errorEncoder
+	}
+
+	if opts.errorHandler != nil {
+		s.errorHandler = opts.errorHandler
+	}
+
+	return s
+}
+
+// ServerBefore functions are executed on the gRPC request object before the
+// request is decoded.
+func ServerBefore(before ...ServerRequestFunc) ServerOption {
+	return func(s *serverOption) { s.before = append(s.before, before...) }
+}
+
+// ServerAfter functions are executed on the gRPC response writer after the
+// endpoint is invoked, but before anything is written to the client.
+func ServerAfter(after ...ServerResponseFunc) ServerOption {
+	return func(s *serverOption) { s.after = append(s.after, after...) }
+}
+
+// ServerErrorEncoder is used to convert errors into gRPC status errors
+// whenever they're encountered in the processing of a request. By default,
+// errors are converted with the DefaultErrorEncoder.
+func ServerErrorEncoder(ee ErrorEncoder) ServerOption {
+	return func(s *serverOption) { s.errorEncoder = ee }
+}
+
+// ServerErrorHandler is used to handle non-terminal errors. By default, non-terminal errors
+// are ignored.
+func ServerErrorHandler(errorHandler trxkit.ErrorHandler) ServerOption {
+	return func(s *serverOption) { s.errorHandler = errorHandler }
+}
+
+// ServerFinalizer is executed at the end of every gRPC request.
+// By default, no finalizer is registered.
+func ServerFinalizer(f ...ServerFinalizerFunc) ServerOption {
+	return func(s *serverOption) { s.finalizer = append(s.finalizer, f...) }
+}
+
+// ServeGRPC implements the Handler interface.
+func (s Server[I, O]) ServeGRPC(ctx context.Context, req interface{}) (retctx context.Context, resp interface{}, err error) {
+	// Retrieve gRPC metadata.
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		md = metadata.MD{}
+	}
+
+	if len(s.finalizer) > 0 {
+		defer func() {
+			for _, f := range s.finalizer {
+				f(ctx, err)
+			}
+		}()
+	}
+
+	for _, f := range s.before {
+		ctx = f(ctx, md)
+	}
+
+	request, err := s.dec(ctx, req)
+	if err != nil {
+		s.errorHandler.Handle(ctx, err)
+		return ctx, nil, s.errorEncoder(ctx, err)
+	}
+
+	response, err := s.e(ctx, request)
+	if err != nil {
+		s.errorHandler.Handle(ctx, err)
+		return ctx, nil, s.errorEncoder(ctx, err)
+	}
+
+	var mdHeader, mdTrailer metadata.MD
+	for _, f := range s.after {
+		ctx = f(ctx, &mdHeader, &mdTrailer)
+	}
+
+	grpcResp, err := s.enc(ctx, response)
+	if err != nil {
+		s.errorHandler.Handle(ctx, err)
+		return ctx, nil, s.errorEncoder(ctx, err)
+	}
+
+	if len(mdHeader) > 0 {
+		if err = grpc.SendHeader(ctx, mdHeader); err != nil {
+			s.errorHandler.Handle(ctx, err)
+			return ctx, nil, err
+		}
+	}
+
+	if len(mdTrailer) > 0 {
+		if err = grpc.SetTrailer(ctx, mdTrailer); err != nil {
+			s.errorHandler.Handle(ctx, err)
+			return ctx, nil, err
+		}
+	}
+
+	return ctx, grpcResp, nil
+}
+
+// ServerFinalizerFunc can be used to perform work at the end of an gRPC
+// request, after the response has been written to the client.
+type ServerFinalizerFunc func(ctx context.Context, err error)
+
+// Interceptor is a grpc UnaryInterceptor that injects the method name into
+// context so it can be consumed by apikit gRPC middlewares. The Interceptor
+// typically is added at creation time of the grpc-go server.
+// Like this: `grpc.NewServer(grpc.UnaryInterceptor(apigrpc.Interceptor))`
+func Interceptor(
+	ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (resp interface{}, err error) {
+	ctx = context.WithValue(ctx, ContextKeyRequestMethod, info.FullMethod)
+	return handler(ctx, req)
+}
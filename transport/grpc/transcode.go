@@ -0,0 +1,465 @@
+package grpc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/likearthian/apikit/api"
+	httptransport "github.com/likearthian/apikit/transport/http"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Binding binds an HTTP route to a method of a gRPC service, as the
+// google.api.http annotation does.
+type Binding struct {
+	// Method is the name of the method in the service, e.g. "GetUser".
+	Method string
+
+	// Body is the field of the request message the JSON body is decoded
+	// into, "*" for the whole message, or "" when the requests have no
+	// body.
+	Body string
+
+	// ResponseBody is the field of the response message written as the
+	// response body, or "" for the whole message.
+	ResponseBody string
+}
+
+// Transcoder exposes the unary methods of a gRPC service as HTTP handlers,
+// mapping the path parameters, the query parameters and the JSON body of the
+// requests onto the request messages, and the response messages onto JSON.
+// It eases the migration of REST facades to gRPC services:
+//
+//	t := grpctransport.NewTranscoder(conn, pb.File_users_proto.Services().ByName("Users"),
+//		grpctransport.TranscoderBefore(grpctransport.AuthorizationFromHTTPContext))
+//	tc, err := t.Transcode(grpctransport.Binding{Method: "UpdateUser", Body: "user"})
+//	if err != nil {
+//		return err
+//	}
+//
+//	r.Patch("/users/{user.id}", httptransport.NewServer(
+//		api.Chain(authn, logging)(tc.Endpoint), tc.Decode, tc.Encode,
+//		httptransport.ServerBefore(httptransport.PopulateRequestContext, httptransport.ChiURLParamIntoContext),
+//	).ServeHTTP)
+//
+// Path parameters are read from httptransport.ContextKeyURLParams, so the
+// router must populate it; their names are the paths of the fields they set,
+// with the proto or the JSON names of the fields, e.g. "user.id". Query
+// parameters set the fields named likewise, except those of the body; the
+// query parameters naming no field are ignored. The gRPC status errors are
+// converted into errors reporting the HTTP status of their code.
+type Transcoder struct {
+	cc        grpc.ClientConnInterface
+	service   protoreflect.ServiceDescriptor
+	types     protoregistry.MessageTypeResolver
+	before    []ClientRequestFunc
+	after     []ClientResponseFunc
+	marshal   protojson.MarshalOptions
+	unmarshal protojson.UnmarshalOptions
+}
+
+type transcoderOption struct {
+	types     protoregistry.MessageTypeResolver
+	before    []ClientRequestFunc
+	after     []ClientResponseFunc
+	marshal   protojson.MarshalOptions
+	unmarshal protojson.UnmarshalOptions
+}
+
+// TranscoderOption sets an optional parameter for transcoders.
+type TranscoderOption func(opt *transcoderOption)
+
+// NewTranscoder constructs a Transcoder calling the methods of service over
+// cc.
+func NewTranscoder(cc grpc.ClientConnInterface, service protoreflect.ServiceDescriptor, options ...TranscoderOption) *Transcoder {
+	opts := &transcoderOption{
+		types:     protoregistry.GlobalTypes,
+		unmarshal: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return &Transcoder{
+		cc:        cc,
+		service:   service,
+		types:     opts.types,
+		before:    opts.before,
+		after:     opts.after,
+		marshal:   opts.marshal,
+		unmarshal: opts.unmarshal,
+	}
+}
+
+// TranscoderBefore sets the ClientRequestFuncs that are applied to the
+// outgoing gRPC requests before they are invoked.
+func TranscoderBefore(before ...ClientRequestFunc) TranscoderOption {
+	return func(o *transcoderOption) { o.before = append(o.before, before...) }
+}
+
+// TranscoderAfter sets the ClientResponseFuncs that are applied to the
+// incoming gRPC responses before they are encoded.
+func TranscoderAfter(after ...ClientResponseFunc) TranscoderOption {
+	return func(o *transcoderOption) { o.after = append(o.after, after...) }
+}
+
+// TranscoderTypes sets the resolver of the types of the messages. The
+// messages of types it does not know are handled as dynamicpb messages.
+// Defaults to protoregistry.GlobalTypes.
+func TranscoderTypes(types protoregistry.MessageTypeResolver) TranscoderOption {
+	return func(o *transcoderOption) { o.types = types }
+}
+
+// TranscoderMarshalOptions sets the options encoding the response messages
+// into JSON.
+func TranscoderMarshalOptions(marshal protojson.MarshalOptions) TranscoderOption {
+	return func(o *transcoderOption) { o.marshal = marshal }
+}
+
+// TranscoderUnmarshalOptions sets the options decoding the JSON bodies into
+// the request messages. By default, unknown fields are discarded.
+func TranscoderUnmarshalOptions(unmarshal protojson.UnmarshalOptions) TranscoderOption {
+	return func(o *transcoderOption) { o.unmarshal = unmarshal }
+}
+
+// AuthorizationFromHTTPContext is a ClientRequestFunc forwarding the
+// Authorization header of the HTTP request, captured by
+// httptransport.PopulateRequestContext, as the authorization metadata.
+func AuthorizationFromHTTPContext(ctx context.Context, md *metadata.MD) context.Context {
+	if auth, _ := ctx.Value(httptransport.ContextKeyRequestAuthorization).(string); auth != "" {
+		(*md)["authorization"] = []string{auth}
+	}
+	return ctx
+}
+
+// Transcoding holds the functions transcoding the requests of a Binding.
+// Endpoint may be wrapped with middlewares before making the server.
+type Transcoding struct {
+	Decode   httptransport.DecodeRequestFunc[proto.Message]
+	Endpoint api.Endpoint[proto.Message, proto.Message]
+	Encode   httptransport.EncodeResponseFunc[proto.Message]
+}
+
+// Server returns an HTTP server of the transcoding.
+func (tc *Transcoding) Server(options ...httptransport.ServerOption) *httptransport.Server[proto.Message, proto.Message] {
+	return httptransport.NewServer(tc.Endpoint, tc.Decode, tc.Encode, options...)
+}
+
+// Transcode returns the transcoding of b. It fails when the method is not a
+// unary method of the service, or when the body fields are not fields of its
+// messages.
+func (t *Transcoder) Transcode(b Binding) (*Transcoding, error) {
+	md := t.service.Methods().ByName(protoreflect.Name(b.Method))
+	if md == nil {
+		return nil, fmt.Errorf("grpc: no method %s in service %s", b.Method, t.service.FullName())
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, fmt.Errorf("grpc: streaming method %s cannot be transcoded", md.FullName())
+	}
+
+	var bodyField, responseField protoreflect.FieldDescriptor
+	if b.Body != "" && b.Body != "*" {
+		if bodyField = fieldByName(md.Input(), b.Body); bodyField == nil {
+			return nil, fmt.Errorf("grpc: no field %s in message %s", b.Body, md.Input().FullName())
+		}
+	}
+	if b.ResponseBody != "" {
+		if responseField = fieldByName(md.Output(), b.ResponseBody); responseField == nil {
+			return nil, fmt.Errorf("grpc: no field %s in message %s", b.ResponseBody, md.Output().FullName())
+		}
+	}
+
+	input, output := t.messageType(md.Input()), t.messageType(md.Output())
+	method := fmt.Sprintf("/%s/%s", t.service.FullName(), md.Name())
+
+	return &Transcoding{
+		Decode:   t.makeDecoder(input, b.Body, bodyField),
+		Endpoint: t.makeEndpoint(method, output),
+		Encode:   t.makeEncoder(responseField),
+	}, nil
+}
+
+func (t *Transcoder) messageType(desc protoreflect.MessageDescriptor) protoreflect.MessageType {
+	if mt, err := t.types.FindMessageByName(desc.FullName()); err == nil {
+		return mt
+	}
+	return dynamicpb.NewMessageType(desc)
+}
+
+func (t *Transcoder) makeDecoder(input protoreflect.MessageType, body string, bodyField protoreflect.FieldDescriptor) httptransport.DecodeRequestFunc[proto.Message] {
+	return func(ctx context.Context, r *http.Request) (proto.Message, error) {
+		msg := input.New()
+
+		if body != "" {
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(data) > 0 {
+				if bodyField != nil {
+					// The body is decoded as the value of the field, in
+					// an object holding only this field.
+					data = append(append([]byte(`{"`+bodyField.JSONName()+`":`), data...), '}')
+				}
+				if err := t.unmarshal.Unmarshal(data, msg.Interface()); err != nil {
+					return nil, fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+				}
+			}
+		}
+
+		params, _ := ctx.Value(httptransport.ContextKeyURLParams).(map[string]string)
+		for name, value := range params {
+			if err := setField(msg, name, []string{value}); err != nil {
+				if errors.Is(err, errUnknownField) {
+					return nil, fmt.Errorf("grpc: path parameter %s: %w", name, err)
+				}
+				return nil, fmt.Errorf("%w: %s: %s", api.ErrBadRequest, name, err)
+			}
+		}
+
+		if body != "*" {
+			for name, values := range r.URL.Query() {
+				if _, ok := params[name]; ok {
+					continue
+				}
+				if body != "" && (name == body || strings.HasPrefix(name, body+".")) {
+					continue
+				}
+
+				if err := setField(msg, name, values); err != nil && !errors.Is(err, errUnknownField) {
+					return nil, fmt.Errorf("%w: %s: %s", api.ErrBadRequest, name, err)
+				}
+			}
+		}
+
+		req := msg.Interface()
+		if err := api.Validate(ctx, req); err != nil {
+			return nil, err
+		}
+
+		return req, nil
+	}
+}
+
+func (t *Transcoder) makeEndpoint(method string, output protoreflect.MessageType) api.Endpoint[proto.Message, proto.Message] {
+	return func(ctx context.Context, request proto.Message) (proto.Message, error) {
+		ctx = context.WithValue(ctx, ContextKeyRequestMethod, method)
+
+		md := &metadata.MD{}
+		for _, f := range t.before {
+			ctx = f(ctx, md)
+		}
+		ctx = metadata.NewOutgoingContext(ctx, *md)
+
+		var header, trailer metadata.MD
+		reply := output.New().Interface()
+		if err := t.cc.Invoke(ctx, method, request, reply, grpc.Header(&header), grpc.Trailer(&trailer)); err != nil {
+			if st, ok := status.FromError(err); ok {
+				return nil, &statusError{st: st}
+			}
+			return nil, err
+		}
+
+		for _, f := range t.after {
+			ctx = f(ctx, header, trailer)
+		}
+
+		return reply, nil
+	}
+}
+
+func (t *Transcoder) makeEncoder(responseField protoreflect.FieldDescriptor) httptransport.EncodeResponseFunc[proto.Message] {
+	return func(_ context.Context, w http.ResponseWriter, response proto.Message) error {
+		var (
+			body []byte
+			err  error
+		)
+
+		if responseField == nil {
+			body, err = t.marshal.Marshal(response)
+		} else {
+			body, err = t.marshalField(response, responseField)
+		}
+		if err != nil {
+			return err
+		}
+
+		w.Header().Set(httptransport.HeaderContentType, "application/json; charset=utf-8")
+		_, err = w.Write(body)
+		return err
+	}
+}
+
+// marshalField returns the JSON of the field fd of msg. Fields other than
+// singular messages are taken from the JSON of msg, so they are encoded as in
+// the whole message.
+func (t *Transcoder) marshalField(msg proto.Message, fd protoreflect.FieldDescriptor) ([]byte, error) {
+	if fd.Message() != nil && !fd.IsList() && !fd.IsMap() {
+		return t.marshal.Marshal(msg.ProtoReflect().Get(fd).Message().Interface())
+	}
+
+	opts := t.marshal
+	opts.EmitUnpopulated = true
+	data, err := opts.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	name := fd.JSONName()
+	if opts.UseProtoNames {
+		name = string(fd.Name())
+	}
+	if value, ok := fields[name]; ok {
+		return value, nil
+	}
+	return []byte("null"), nil
+}
+
+// statusError is the error of a transcoded call, reporting the HTTP status of
+// its gRPC code, and its gRPC status when served over gRPC again.
+type statusError struct {
+	st *status.Status
+}
+
+func (e *statusError) Error() string {
+	return e.st.Message()
+}
+
+func (e *statusError) StatusCode() int {
+	return CodeToHTTPStatus(e.st.Code())
+}
+
+func (e *statusError) GRPCStatus() *status.Status {
+	return e.st
+}
+
+var errUnknownField = errors.New("unknown field")
+
+// fieldByName returns the field of desc with the proto or the JSON name name.
+func fieldByName(desc protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	fields := desc.Fields()
+	if fd := fields.ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+	return fields.ByJSONName(name)
+}
+
+// setField sets the field at the dotted path of msg from the string values:
+// the last one for a singular field, all of them for a repeated one.
+func setField(msg protoreflect.Message, path string, values []string) error {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		fd := fieldByName(msg.Descriptor(), name)
+		if fd == nil {
+			return errUnknownField
+		}
+		if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+			return fmt.Errorf("%s is not a message field", name)
+		}
+		msg = msg.Mutable(fd).Message()
+	}
+
+	fd := fieldByName(msg.Descriptor(), names[len(names)-1])
+	switch {
+	case fd == nil:
+		return errUnknownField
+	case fd.IsMap():
+		return errors.New("map fields cannot be set from parameters")
+	case fd.IsList():
+		list := msg.Mutable(fd).List()
+		for _, value := range values {
+			v, err := parseValue(fd, value, list.NewElement)
+			if err != nil {
+				return err
+			}
+			list.Append(v)
+		}
+	default:
+		newField := func() protoreflect.Value { return msg.NewField(fd) }
+		v, err := parseValue(fd, values[len(values)-1], newField)
+		if err != nil {
+			return err
+		}
+		msg.Set(fd, v)
+	}
+
+	return nil
+}
+
+// parseValue parses the value of a field of the kind of fd. Messages, such as
+// the well-known timestamps, durations and wrappers, are parsed from their
+// JSON representation, into the message returned by newMessage.
+func parseValue(fd protoreflect.FieldDescriptor, value string, newMessage func() protoreflect.Value) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(value)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(value, 10, 32)
+		return protoreflect.ValueOfInt32(int32(n)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(value, 10, 64)
+		return protoreflect.ValueOfInt64(n), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(value, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(n)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(value, 10, 64)
+		return protoreflect.ValueOfUint64(n), err
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(value, 32)
+		return protoreflect.ValueOfFloat32(float32(f)), err
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(value, 64)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(value), nil
+	case protoreflect.BytesKind:
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			b, err = base64.URLEncoding.DecodeString(value)
+		}
+		return protoreflect.ValueOfBytes(b), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(value)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("invalid value %q of enum %s", value, fd.Enum().FullName())
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		v := newMessage()
+		// Strings are tried first, then the raw value, for the wrappers
+		// of booleans and numbers.
+		if err := protojson.Unmarshal([]byte(strconv.Quote(value)), v.Message().Interface()); err != nil {
+			if err := protojson.Unmarshal([]byte(value), v.Message().Interface()); err != nil {
+				return protoreflect.Value{}, err
+			}
+		}
+		return v, nil
+	}
+
+	return protoreflect.Value{}, fmt.Errorf("unsupported kind %s", fd.Kind())
+}
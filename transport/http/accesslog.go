@@ -0,0 +1,275 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/likearthian/apikit/logger"
+)
+
+const redacted = "[REDACTED]"
+
+type accessLogOption struct {
+	requestBody  int
+	responseBody int
+	redact       []string
+	skip         func(r *http.Request) bool
+}
+
+// AccessLogOption sets an optional parameter for MakeHttpAccessLogMiddleware.
+type AccessLogOption func(opt *accessLogOption)
+
+// AccessLogRequestBody logs the first maxBytes of the request bodies, as read
+// by the handler.
+func AccessLogRequestBody(maxBytes int) AccessLogOption {
+	return func(opt *accessLogOption) { opt.requestBody = maxBytes }
+}
+
+// AccessLogResponseBody logs the first maxBytes of the response bodies.
+func AccessLogResponseBody(maxBytes int) AccessLogOption {
+	return func(opt *accessLogOption) { opt.responseBody = maxBytes }
+}
+
+// AccessLogRedact masks the given fields in the logged JSON and url-encoded
+// form bodies. A plain name, such as "password", matches the fields of that
+// name at any depth, whatever their case, and a dotted path, such as
+// "$.user.token" or "user.token", matches the field at that path from the
+// root, looking through arrays.
+func AccessLogRedact(fields ...string) AccessLogOption {
+	return func(opt *accessLogOption) { opt.redact = append(opt.redact, fields...) }
+}
+
+// AccessLogSkip sets a function reporting the requests not to log, such as
+// health checks.
+func AccessLogSkip(fn func(r *http.Request) bool) AccessLogOption {
+	return func(opt *accessLogOption) { opt.skip = fn }
+}
+
+// MakeHttpAccessLogMiddleware returns an http middleware logging every
+// request with its method, path, status, latency and body sizes, and
+// optionally the start of its bodies, redacted of sensitive fields. Server
+// errors are logged at error level, client errors at warn level, and other
+// requests at info level.
+func MakeHttpAccessLogMiddleware(log logger.Logger, options ...AccessLogOption) func(http.Handler) http.Handler {
+	opts := &accessLogOption{}
+	for _, option := range options {
+		option(opts)
+	}
+	rd := newRedactor(opts.redact)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if opts.skip != nil && opts.skip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			begin := time.Now()
+
+			body := &capturingBody{ReadCloser: r.Body, max: opts.requestBody}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = body
+			}
+
+			iw := &interceptingWriter{ResponseWriter: w, code: http.StatusOK}
+			if opts.responseBody > 0 {
+				iw.capture = &cappedBuffer{max: opts.responseBody}
+			}
+
+			next.ServeHTTP(iw.reimplementInterfaces(), r)
+
+			reqid := w.Header().Get(HeaderXRequestID)
+			if reqid == "" {
+				reqid = r.Header.Get(HeaderXRequestID)
+			}
+
+			fields := []interface{}{
+				"event", "access",
+				"request-id", reqid,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", iw.code,
+				"duration", time.Since(begin),
+				"bytes_in", body.read,
+				"bytes_out", iw.written,
+				"remote_addr", r.RemoteAddr,
+				"user_agent", r.UserAgent(),
+			}
+			if opts.requestBody > 0 && body.buf.Len() > 0 {
+				fields = append(fields, "request_body",
+					rd.redact(body.buf.Bytes(), r.Header.Get(HeaderContentType), body.read > int64(body.buf.Len())))
+			}
+			if iw.capture != nil && iw.capture.Len() > 0 {
+				fields = append(fields, "response_body",
+					rd.redact(iw.capture.Bytes(), w.Header().Get(HeaderContentType), iw.written > int64(iw.capture.Len())))
+			}
+
+			switch {
+			case iw.code >= http.StatusInternalServerError:
+				log.Error("request failed", fields...)
+			case iw.code >= http.StatusBadRequest:
+				log.Warn("request rejected", fields...)
+			default:
+				log.Info("request served", fields...)
+			}
+		})
+	}
+}
+
+// capturingBody counts the bytes read from a request body and keeps the
+// first max of them.
+type capturingBody struct {
+	io.ReadCloser
+	max  int
+	read int64
+	buf  bytes.Buffer
+}
+
+func (b *capturingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if room := b.max - b.buf.Len(); room > 0 && n > 0 {
+		b.buf.Write(p[:minInt(n, room)])
+	}
+	return n, err
+}
+
+// cappedBuffer keeps the first max bytes written to it.
+type cappedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.Len(); room > 0 {
+		b.Buffer.Write(p[:minInt(len(p), room)])
+	}
+	return len(p), nil
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// redactor masks the fields matching its rules in logged bodies.
+type redactor struct {
+	names []string
+	paths [][]string
+	raw   *regexp.Regexp
+}
+
+func newRedactor(rules []string) *redactor {
+	rd := &redactor{}
+
+	var keys []string
+	for _, rule := range rules {
+		rule = strings.TrimPrefix(rule, "$.")
+		if strings.Contains(rule, ".") {
+			path := strings.Split(rule, ".")
+			rd.paths = append(rd.paths, path)
+			keys = append(keys, regexp.QuoteMeta(path[len(path)-1]))
+			continue
+		}
+		rd.names = append(rd.names, rule)
+		keys = append(keys, regexp.QuoteMeta(rule))
+	}
+
+	if len(keys) > 0 {
+		// masks string values of truncated JSON bodies, which can't be parsed
+		rd.raw = regexp.MustCompile(`(?i)("(?:` + strings.Join(keys, "|") + `)"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+	}
+
+	return rd
+}
+
+// redact returns body, of the given content type, with its sensitive fields
+// masked. A truncated body can't be parsed: its JSON string values are masked
+// by field name only.
+func (rd *redactor) redact(body []byte, contentType string, truncated bool) string {
+	if rd.raw == nil {
+		return string(body)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded" && !truncated:
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			break
+		}
+		for k := range values {
+			if rd.match([]string{k}) {
+				values[k] = []string{redacted}
+			}
+		}
+		return values.Encode()
+
+	case !truncated:
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			break
+		}
+		if out, err := json.Marshal(rd.walk(v, nil)); err == nil {
+			return string(out)
+		}
+	}
+
+	return rd.raw.ReplaceAllString(string(body), `$1"`+redacted+`"`)
+}
+
+func (rd *redactor) walk(v interface{}, path []string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			p := append(path[:len(path):len(path)], k)
+			if rd.match(p) {
+				v[k] = redacted
+				continue
+			}
+			v[k] = rd.walk(val, p)
+		}
+	case []interface{}:
+		for i, val := range v {
+			v[i] = rd.walk(val, path)
+		}
+	}
+
+	return v
+}
+
+func (rd *redactor) match(path []string) bool {
+	for _, name := range rd.names {
+		if strings.EqualFold(name, path[len(path)-1]) {
+			return true
+		}
+	}
+
+	for _, rule := range rd.paths {
+		if len(rule) != len(path) {
+			continue
+		}
+
+		matched := true
+		for i := range rule {
+			if !strings.EqualFold(rule[i], path[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,236 @@
+package http
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// AuthTokenToContext is a RequestFunc storing the bearer token of the
+// Authorization header under api.ContextKeyAuthToken, for
+// api.WithJWTAuthEPMiddleware.
+func AuthTokenToContext(ctx context.Context, r *http.Request) context.Context {
+	token, ok := bearerToken(r.Header.Get(HeaderAuthorization))
+	if !ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, api.ContextKeyAuthToken, token)
+}
+
+func bearerToken(authorization string) (string, bool) {
+	parts := strings.SplitN(authorization, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", false
+	}
+
+	token := strings.TrimSpace(parts[1])
+	return token, token != ""
+}
+
+// MakeHttpIntrospectionMiddleware returns an http middleware authenticating
+// requests with the opaque bearer token of their Authorization header through
+// in, requiring every one of scopes. The claims are stored in the request
+// context under api.ContextKeyAuthClaims; failures are written with
+// DefaultErrorEncoder as 401 or 403 responses, and failures of the
+// introspection itself as generic 500 responses.
+func MakeHttpIntrospectionMiddleware(in *api.Introspector, scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, _ := bearerToken(r.Header.Get(HeaderAuthorization))
+			ctx, err := in.Authenticate(r.Context(), token, scopes...)
+			if err != nil {
+				var authErr *api.AuthError
+				if !errors.As(err, &authErr) {
+					// transient failures of the introspection, which may
+					// name its endpoint, are not disclosed
+					err = errors.New(http.StatusText(http.StatusInternalServerError))
+				}
+				DefaultErrorEncoder(ctx, err, w)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// MakeHttpBasicAuthMiddleware returns an http middleware authenticating
+// requests with HTTP basic auth. validate checks the credentials and returns
+// the claims stored in the request context under api.ContextKeyAuthClaims.
+// Missing or rejected credentials get a 401 response with a basic auth
+// challenge.
+func MakeHttpBasicAuthMiddleware(validate func(user, pass string) (any, bool)) func(http.Handler) http.Handler {
+	const challenge = `Basic realm="Restricted", charset="UTF-8"`
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			user, pass, ok := r.BasicAuth()
+			if !ok {
+				DefaultErrorEncoder(ctx, &api.AuthError{Err: api.ErrUnauthorized, Scheme: challenge}, w)
+				return
+			}
+
+			claims, ok := validate(user, pass)
+			if !ok {
+				DefaultErrorEncoder(ctx, &api.AuthError{Err: api.ErrUnauthorized, Scheme: challenge}, w)
+				return
+			}
+
+			ctx = context.WithValue(ctx, api.ContextKeyAuthClaims, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClientCertClaims describes the verified TLS client certificate of a
+// request. MakeHttpClientCertMiddleware stores it under
+// api.ContextKeyAuthClaims.
+type ClientCertClaims struct {
+	Subject        pkix.Name
+	Issuer         pkix.Name
+	SerialNumber   string
+	DNSNames       []string
+	EmailAddresses []string
+	URIs           []string
+	IPAddresses    []string
+	NotAfter       time.Time
+}
+
+// ClientCertClaimsFromContext returns the claims stored by
+// MakeHttpClientCertMiddleware.
+func ClientCertClaimsFromContext(ctx context.Context) (*ClientCertClaims, bool) {
+	claims, ok := ctx.Value(api.ContextKeyAuthClaims).(*ClientCertClaims)
+	return claims, ok
+}
+
+// MakeHttpClientCertMiddleware returns an http middleware authenticating
+// requests with the client certificate verified during the TLS handshake, so
+// the server's tls.Config must set ClientAuth to VerifyClientCertIfGiven or
+// RequireAndVerifyClientCert. The certificate subject and SANs are stored
+// under api.ContextKeyAuthClaims. When validate is not nil, it must also
+// accept the claims, for instance by checking the common name against an
+// allowlist. Requests without an acceptable certificate get a 401 response.
+func MakeHttpClientCertMiddleware(validate func(*ClientCertClaims) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+				DefaultErrorEncoder(ctx, &api.AuthError{Err: api.ErrUnauthorized, Scheme: "TLS"}, w)
+				return
+			}
+
+			claims := clientCertClaims(r.TLS.VerifiedChains[0][0])
+			if validate != nil && !validate(claims) {
+				DefaultErrorEncoder(ctx, &api.AuthError{Err: api.ErrUnauthorized, Scheme: "TLS"}, w)
+				return
+			}
+
+			ctx = context.WithValue(ctx, api.ContextKeyAuthClaims, claims)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func clientCertClaims(cert *x509.Certificate) *ClientCertClaims {
+	claims := &ClientCertClaims{
+		Subject:        cert.Subject,
+		Issuer:         cert.Issuer,
+		SerialNumber:   cert.SerialNumber.String(),
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		NotAfter:       cert.NotAfter,
+	}
+
+	for _, uri := range cert.URIs {
+		claims.URIs = append(claims.URIs, uri.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		claims.IPAddresses = append(claims.IPAddresses, ip.String())
+	}
+
+	return claims
+}
+
+type apikeyOption struct {
+	tenantResolver func(ctx context.Context, claims any) (*api.Tenant, error)
+}
+
+// ApikeyOption sets an optional parameter for MakeHttpApikeyMiddleware.
+type ApikeyOption func(opt *apikeyOption)
+
+// ApikeyTenantResolver maps the claims of a validated key to the tenant it
+// belongs to, stored under api.ContextKeyTenant. The context given to fn
+// already holds the claims. A nil tenant leaves the request without one;
+// errors wrapping api.ErrTenantRequired get a 403 response.
+func ApikeyTenantResolver(fn func(ctx context.Context, claims any) (*api.Tenant, error)) ApikeyOption {
+	return func(opt *apikeyOption) { opt.tenantResolver = fn }
+}
+
+// MakeHttpApikeyMiddleware returns an http middleware authenticating requests
+// with the API key of their X-API-Key header, or of an Authorization header
+// using the ApiKey scheme. validate returns the claims of a valid key, stored
+// in the request context under api.ContextKeyAuthClaims. Missing keys, and
+// keys rejected with an error wrapping api.ErrUnauthorized, get a 401
+// response; other errors are written as they are.
+func MakeHttpApikeyMiddleware(validate func(ctx context.Context, key string) (any, error), options ...ApikeyOption) func(http.Handler) http.Handler {
+	var opts apikeyOption
+	for _, option := range options {
+		option(&opts)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			key := r.Header.Get(HeaderXAPIKey)
+			if key == "" {
+				parts := strings.SplitN(r.Header.Get(HeaderAuthorization), " ", 2)
+				if len(parts) == 2 && strings.EqualFold(parts[0], "ApiKey") {
+					key = strings.TrimSpace(parts[1])
+				}
+			}
+
+			if key == "" {
+				DefaultErrorEncoder(ctx, &api.AuthError{Err: api.ErrUnauthorized, Scheme: "ApiKey"}, w)
+				return
+			}
+
+			claims, err := validate(ctx, key)
+			if err != nil {
+				if errors.Is(err, api.ErrUnauthorized) {
+					err = &api.AuthError{Err: err, Scheme: "ApiKey"}
+				}
+				DefaultErrorEncoder(ctx, err, w)
+				return
+			}
+
+			ctx = context.WithValue(ctx, api.ContextKeyAuthClaims, claims)
+
+			if opts.tenantResolver != nil {
+				tenant, err := opts.tenantResolver(ctx, claims)
+				if err != nil {
+					if errors.Is(err, api.ErrTenantRequired) {
+						err = &api.AuthError{Err: err, Scheme: "ApiKey"}
+					}
+					DefaultErrorEncoder(ctx, err, w)
+					return
+				}
+				if tenant != nil {
+					ctx = context.WithValue(ctx, api.ContextKeyTenant, tenant)
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
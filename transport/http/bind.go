@@ -2,26 +2,86 @@ package http
 
 import (
 	"encoding"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/likearthian/apikit/api"
 )
 
 // BindURLQuery will unmarshal http request query into a struct or map, pointed by dest.
-// dest must be a pointer to struct or map
+// dest must be a pointer to struct or map. Slices are bound from repeated and
+// delimited values alike, ?id=1&id=2 or ?id=1,2, the delimiter being set with
+// the sep option of the tag, as in `query:"id,sep=|"`. Maps with string keys
+// are bound from bracketed keys, filter[name]=x setting the key name of the
+// field tagged `query:"filter"`. Types with a parser registered with
+// RegisterBinder are bound with it. Fields left without a value take the
+// value of their `default` tag. Constraints declared in `validate` tags are checked
+// once the values are bound.
 func BindURLQuery(dest interface{}, query url.Values) error {
-	return bindData(dest, query, "query")
+	if err := bindData(dest, query, "query"); err != nil {
+		return err
+	}
+
+	return api.ValidateStruct(dest, "query")
 }
 
+// BindFormData will unmarshal form values into a struct or map, pointed by
+// dest, using the `form` tag. Fields left without a value take the value of
+// their `default` tag. Constraints declared in `validate` tags are checked
+// once the values are bound.
 func BindFormData(dest interface{}, formData url.Values) error {
-	return bindData(dest, formData, "form")
+	if err := bindData(dest, formData, "form"); err != nil {
+		return err
+	}
+
+	return api.ValidateStruct(dest, "form")
+}
+
+// BindJSON decodes a JSON document read from r into dest and checks the
+// constraints declared in `validate` tags. Malformed documents are reported as
+// api.ErrBadRequest.
+func BindJSON(dest interface{}, r io.Reader) error {
+	if err := json.NewDecoder(r).Decode(dest); err != nil {
+		return fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+	}
+
+	return api.ValidateStruct(dest, "json")
 }
 
 func bindData(ptr interface{}, data map[string][]string, tag string) error {
-	if ptr == nil || len(data) == 0 {
+	return bindSources(ptr, bindSource{tag: tag, data: data, fallback: true})
+}
+
+// bindSource is a set of named values bound to the struct fields carrying the
+// given tag. When fallback is set, fields without the tag are looked up by
+// their Go name.
+type bindSource struct {
+	tag      string
+	data     map[string][]string
+	fallback bool
+}
+
+// bindSources binds every source into the struct or map pointed by ptr in a
+// single pass over its fields. For each field the first source having a value
+// wins, in the order the sources are given. Zero fields without a value, or
+// with an empty one, are set from their `default` tag, slices from a list
+// delimited like their values.
+func bindSources(ptr interface{}, sources ...bindSource) error {
+	empty := true
+	for _, src := range sources {
+		if len(src.data) > 0 {
+			empty = false
+		}
+	}
+
+	if ptr == nil {
 		return nil
 	}
 	typ := reflect.TypeOf(ptr)
@@ -33,8 +93,16 @@ func bindData(ptr interface{}, data map[string][]string, tag string) error {
 
 	// Map
 	if typ.Kind() == reflect.Map {
-		for k, v := range data {
-			val.SetMapIndex(reflect.ValueOf(k), reflect.ValueOf(v[0]))
+		if empty {
+			return nil
+		}
+		if val.IsNil() {
+			val.Set(reflect.MakeMap(typ))
+		}
+		for _, src := range sources {
+			for k, v := range src.data {
+				val.SetMapIndex(reflect.ValueOf(k), reflect.ValueOf(v[0]))
+			}
 		}
 		return nil
 	}
@@ -51,74 +119,265 @@ func bindData(ptr interface{}, data map[string][]string, tag string) error {
 			continue
 		}
 		structFieldKind := structField.Kind()
-		inputFieldName := typeField.Tag.Get(tag)
 
-		if inputFieldName == "" {
-			inputFieldName = typeField.Name
+		rawInputValue, exists, tagged := lookupSources(typeField, sources)
+		if !tagged && structFieldKind == reflect.Struct && !isTimeType(typeField.Type) {
 			// If tag is nil, we inspect if the field is a struct.
-			if structFieldKind == reflect.Struct {
-				if err := bindData(structField.Addr().Interface(), data, tag); err != nil {
-					return err
+			if err := bindSources(structField.Addr().Interface(), sources...); err != nil {
+				return err
+			}
+			continue
+		}
+
+		sep := separator(typeField, sources)
+		if !exists && structFieldKind == reflect.Map && typeField.Type.Key().Kind() == reflect.String {
+			if entries := lookupMapSources(typeField, sources); len(entries) > 0 {
+				if err := setMapField(structField, entries, sep, typeField.Tag.Get("format")); err != nil {
+					return api.NewValidationError(api.FieldError{
+						Field:   boundName(typeField, sources),
+						Code:    "invalid",
+						Message: err.Error(),
+					})
+				}
+			}
+			continue
+		}
+
+		if !exists || isBlank(rawInputValue) {
+			if def, ok := typeField.Tag.Lookup("default"); ok && structField.IsZero() {
+				if err := setField(typeField, structField, []string{def}, sep); err != nil {
+					return fmt.Errorf("invalid default of field %s: %w", typeField.Name, err)
 				}
 				continue
 			}
-			//if _, ok := structField.Addr().Interface().(BindUnmarshaler); !ok && structFieldKind == reflect.Struct {
-			//	if err := bindData(structField.Addr().Interface(), data, tag); err != nil {
-			//		return err
-			//	}
-			//	continue
-			//}
-		}
-
-		rawInputValue, exists := data[inputFieldName]
-		if !exists {
-			// check again with case insensitive method
-			for k, v := range data {
-				if strings.EqualFold(k, inputFieldName) {
-					rawInputValue = v
-					exists = true
-					break
+		}
+
+		if !exists || rawInputValue == nil {
+			continue
+		}
+
+		if err := setField(typeField, structField, rawInputValue, sep); err != nil {
+			return api.NewValidationError(api.FieldError{
+				Field:   boundName(typeField, sources),
+				Code:    "invalid",
+				Message: err.Error(),
+			})
+		}
+	}
+	return nil
+}
+
+// lookupSources returns the raw values bound to field. tagged reports whether
+// the field declares the tag of any source.
+func lookupSources(field reflect.StructField, sources []bindSource) (values []string, exists bool, tagged bool) {
+	for _, src := range sources {
+		name, _, _ := strings.Cut(field.Tag.Get(src.tag), ",")
+		if name == "-" {
+			continue
+		}
+
+		if name == "" {
+			if !src.fallback {
+				continue
+			}
+			name = field.Name
+		} else {
+			tagged = true
+		}
+
+		if values, exists = lookupValue(src.data, name); exists {
+			return values, exists, tagged
+		}
+	}
+
+	return nil, false, tagged
+}
+
+// boundName returns the name field is bound under: its first tag among the
+// sources, or else its Go name.
+func boundName(field reflect.StructField, sources []bindSource) string {
+	for _, src := range sources {
+		if name, _, _ := strings.Cut(field.Tag.Get(src.tag), ","); name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return field.Name
+}
+
+// separator returns the separator of the values of a slice field, set with
+// the sep option of its tag, such as `query:"ids,sep=|"`. It defaults to a
+// comma, and sep=none disables splitting.
+func separator(field reflect.StructField, sources []bindSource) string {
+	for _, src := range sources {
+		_, opts, _ := strings.Cut(field.Tag.Get(src.tag), ",")
+		for _, opt := range strings.Split(opts, ",") {
+			if strings.HasPrefix(opt, "sep=") {
+				sep := strings.TrimPrefix(opt, "sep=")
+				if sep == "none" {
+					return ""
 				}
+				return sep
 			}
 		}
+	}
+
+	return ","
+}
 
-		if !exists {
+// lookupMapSources returns the values bound to the keys of a map field, from
+// the bracketed keys of the first source having any, such as name and status
+// for "filter[name]=x&filter[status]=y".
+func lookupMapSources(field reflect.StructField, sources []bindSource) map[string][]string {
+	for _, src := range sources {
+		name, _, _ := strings.Cut(field.Tag.Get(src.tag), ",")
+		if name == "-" {
 			continue
 		}
+		if name == "" {
+			if !src.fallback {
+				continue
+			}
+			name = field.Name
+		}
 
-		//this part is to handle comma separated value
-		var inputValue []string
-		for _, val := range rawInputValue {
-			strSlice := strings.Split(val, ",")
-			inputValue = append(inputValue, strSlice...)
+		entries := make(map[string][]string)
+		for k, v := range src.data {
+			if len(k) > len(name)+2 && strings.EqualFold(k[:len(name)], name) &&
+				k[len(name)] == '[' && k[len(k)-1] == ']' {
+				entries[k[len(name)+1:len(k)-1]] = v
+			}
 		}
+		if len(entries) > 0 {
+			return entries
+		}
+	}
+
+	return nil
+}
+
+// setMapField adds entries to the map field, converting their values to the
+// element type of the map.
+func setMapField(field reflect.Value, entries map[string][]string, sep, format string) error {
+	if field.IsNil() {
+		field.Set(reflect.MakeMapWithSize(field.Type(), len(entries)))
+	}
+
+	for k, v := range entries {
+		elem := reflect.New(field.Type().Elem()).Elem()
+		if err := setValues(elem, v, sep, format); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+		field.SetMapIndex(reflect.ValueOf(k).Convert(field.Type().Key()), elem)
+	}
+
+	return nil
+}
+
+// isBlank reports whether values holds no value, or a single empty one, such
+// as for "?page_size=".
+func isBlank(values []string) bool {
+	return len(values) == 0 || (len(values) == 1 && values[0] == "")
+}
+
+func lookupValue(data map[string][]string, name string) ([]string, bool) {
+	if v, ok := data[name]; ok {
+		return v, true
+	}
+
+	// check again with case insensitive method
+	for k, v := range data {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
+
+func setField(typeField reflect.StructField, structField reflect.Value, rawInputValue []string, sep string) error {
+	layout := typeField.Tag.Get("format")
+	if layout != "" && isTimeType(typeField.Type) && !isRegistered(typeField.Type) {
+		return setTimeField(rawInputValue[0], layout, structField)
+	}
+
+	return setValues(structField, rawInputValue, sep, layout)
+}
+
+// setValues sets field from its raw values. Slices are bound from every value,
+// each being split on sep unless it is empty, so that ?id=1&id=2 and ?id=1,2
+// bind the same; their elements may implement encoding.TextUnmarshaler, such
+// as uuid.UUID, or have a parser registered with RegisterBinder, which is
+// given format.
+func setValues(field reflect.Value, rawInputValue []string, sep, format string) error {
+	if ok, err := parseRegistered(field, rawInputValue[0], format); ok {
+		return err
+	}
+
+	// Call this first, in case we're dealing with an alias to an array type
+	if ok, err := unmarshalField(field.Kind(), rawInputValue[0], field); ok {
+		return err
+	}
 
-		if inputValue == nil {
+	if field.Kind() != reflect.Slice {
+		return setWithProperType(field.Kind(), rawInputValue[0], field)
+	}
+
+	inputValue := make([]string, 0, len(rawInputValue))
+	for _, val := range rawInputValue {
+		if sep == "" {
+			inputValue = append(inputValue, val)
 			continue
 		}
+		for _, v := range strings.Split(val, sep) {
+			if v != "" {
+				inputValue = append(inputValue, v)
+			}
+		}
+	}
 
-		// Call this first, in case we're dealing with an alias to an array type
-		if ok, err := unmarshalField(typeField.Type.Kind(), inputValue[0], structField); ok {
+	numElems := len(inputValue)
+	sliceOf := field.Type().Elem().Kind()
+	slice := reflect.MakeSlice(field.Type(), numElems, numElems)
+	for j := 0; j < numElems; j++ {
+		if ok, err := parseRegistered(slice.Index(j), inputValue[j], format); ok {
 			if err != nil {
 				return err
 			}
 			continue
 		}
-
-		numElems := len(inputValue)
-		if structFieldKind == reflect.Slice && numElems > 0 {
-			sliceOf := structField.Type().Elem().Kind()
-			slice := reflect.MakeSlice(structField.Type(), numElems, numElems)
-			for j := 0; j < numElems; j++ {
-				if err := setWithProperType(sliceOf, inputValue[j], slice.Index(j)); err != nil {
-					return err
-				}
-			}
-			val.Field(i).Set(slice)
-		} else if err := setWithProperType(typeField.Type.Kind(), inputValue[0], structField); err != nil {
+		if err := setWithProperType(sliceOf, inputValue[j], slice.Index(j)); err != nil {
 			return err
 		}
 	}
+	field.Set(slice)
+	return nil
+}
+
+func isTimeType(typ reflect.Type) bool {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ == reflect.TypeOf(time.Time{})
+}
+
+func setTimeField(value string, layout string, field reflect.Value) error {
+	if field.Kind() == reflect.Ptr {
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		field = field.Elem()
+	}
+
+	if value == "" {
+		return nil
+	}
+
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return err
+	}
+	field.Set(reflect.ValueOf(t))
 	return nil
 }
 
@@ -0,0 +1,95 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// BindRequest populates a T from every part of an HTTP request in a single
+// pass over its fields:
+//
+//	type GetOrderRequest struct {
+//		ID      string    `path:"id"`
+//		Page    int       `query:"page"`
+//		Tenant  string    `header:"X-Tenant"`
+//		Session string    `cookie:"session"`
+//		Since   time.Time `query:"since" format:"2006-01-02"`
+//		Note    string    `json:"note"`
+//	}
+//
+// Path parameters are read from ContextKeyURLParams, whatever router set
+// them (see ChiURLParamIntoContext, URLParamsIntoContext and
+// PathValuesIntoContext), and are also visible to `query` tags, as the
+// default decoders always did. The body is JSON decoded for requests carrying
+// a JSON (or unspecified) content type, and url-encoded forms are bound to
+// `form` tags. Fields without any tag fall back to the query value of the same
+// name. Untagged nested structs are bound field by field, time.Time fields
+// honor the layout given in the `format` tag, and pointers are allocated as
+// needed. Fields left zero take the value of their `default` tag, such as
+// `query:"page_size" default:"20"`, or `default:"a,b"` for slices. Once bound, the request is validated with its `validate` tags and
+// its Validate method, if any.
+func BindRequest[T any](ctx context.Context, r *http.Request) (T, error) {
+	var reqObj T
+
+	if err := bindRequest(ctx, r, &reqObj, true); err != nil {
+		return reqObj, err
+	}
+
+	if err := validateRequest(ctx, &reqObj); err != nil {
+		return reqObj, err
+	}
+
+	return reqObj, nil
+}
+
+func bindRequest(ctx context.Context, r *http.Request, ptr interface{}, decodeBody bool) error {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get(HeaderContentType))
+
+	if decodeBody && r.Body != nil && r.Body != http.NoBody && (contentType == "" || contentType == HttpContentTypeJson) {
+		if err := json.NewDecoder(r.Body).Decode(ptr); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+		}
+	}
+
+	params, _ := ctx.Value(ContextKeyURLParams).(map[string]string)
+
+	query := r.URL.Query()
+	for k, v := range params {
+		//include params into query to be parsed
+		query.Set(k, v)
+	}
+
+	path := make(url.Values, len(params))
+	for k, v := range params {
+		path.Set(k, v)
+	}
+
+	cookies := make(url.Values)
+	for _, c := range r.Cookies() {
+		cookies.Add(c.Name, c.Value)
+	}
+
+	sources := []bindSource{
+		{tag: "path", data: path},
+		{tag: "query", data: query, fallback: true},
+		{tag: "header", data: r.Header},
+		{tag: "cookie", data: cookies},
+	}
+
+	if contentType == HttpContentTypeUrlFormEncoded {
+		if err := r.ParseForm(); err != nil {
+			return fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+		}
+		sources = append(sources, bindSource{tag: "form", data: r.PostForm})
+	}
+
+	return bindSources(ptr, sources...)
+}
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"reflect"
+	"sync"
+)
+
+// ParseFunc parses the raw value of a query, form, path, header or cookie
+// parameter into a T. format is the `format` tag of the field bound, if any,
+// such as a time layout or a decimal precision.
+type ParseFunc[T any] func(value, format string) (T, error)
+
+var (
+	bindersMu sync.RWMutex
+	binders   = make(map[reflect.Type]func(value, format string) (reflect.Value, error))
+)
+
+// RegisterBinder registers fn as the parser of the fields of type T, or *T,
+// and of the elements of []T, bound by BindURLQuery, BindFormData and
+// BindRequest, replacing the parser previously registered for T, if any. It
+// takes precedence over the built-in conversions, including
+// encoding.TextUnmarshaler, so types from other packages, such as
+// decimal.Decimal, may be bound without wrapping them:
+//
+//	httptransport.RegisterBinder(func(value, _ string) (decimal.Decimal, error) {
+//		return decimal.NewFromString(value)
+//	})
+//
+// Empty values leave the fields zero, without calling fn. RegisterBinder is
+// meant to be called at init.
+func RegisterBinder[T any](fn ParseFunc[T]) {
+	bindersMu.Lock()
+	defer bindersMu.Unlock()
+
+	binders[reflect.TypeOf((*T)(nil)).Elem()] = func(value, format string) (reflect.Value, error) {
+		v, err := fn(value, format)
+		return reflect.ValueOf(&v).Elem(), err
+	}
+}
+
+func lookupBinder(typ reflect.Type) (func(value, format string) (reflect.Value, error), bool) {
+	bindersMu.RLock()
+	defer bindersMu.RUnlock()
+
+	fn, ok := binders[typ]
+	return fn, ok
+}
+
+// isRegistered reports whether a parser is registered for typ, or the type it
+// points to.
+func isRegistered(typ reflect.Type) bool {
+	if _, ok := lookupBinder(typ); ok {
+		return true
+	}
+	if typ.Kind() == reflect.Ptr {
+		_, ok := lookupBinder(typ.Elem())
+		return ok
+	}
+	return false
+}
+
+// parseRegistered sets field from value with the parser registered for its
+// type, or the type it points to. ok reports whether there is one.
+func parseRegistered(field reflect.Value, value, format string) (ok bool, err error) {
+	fn, ok := lookupBinder(field.Type())
+	ptr := false
+	if !ok && field.Kind() == reflect.Ptr {
+		fn, ok = lookupBinder(field.Type().Elem())
+		ptr = true
+	}
+	if !ok || value == "" {
+		return ok, nil
+	}
+
+	v, err := fn(value, format)
+	if err != nil {
+		return true, err
+	}
+
+	if ptr {
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		field = field.Elem()
+	}
+	field.Set(v)
+	return true, nil
+}
@@ -0,0 +1,306 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/internal/storeutil"
+)
+
+// CachedResponse is a response kept by a CacheStore.
+type CachedResponse struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+// CacheStore is a shared cache of responses for MakeHttpCacheMiddleware.
+// Implementations must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns the response cached under key, or nil.
+	Get(ctx context.Context, key string) (*CachedResponse, error)
+
+	// Set caches res under key for ttl.
+	Set(ctx context.Context, key string, res *CachedResponse, ttl time.Duration) error
+}
+
+type cacheOption struct {
+	store   CacheStore
+	ttl     time.Duration
+	subject func(r *http.Request) string
+}
+
+// CacheOption sets an optional parameter for MakeHttpCacheMiddleware.
+type CacheOption func(opt *cacheOption)
+
+// CacheWithStore makes the middleware keep successful responses in store for
+// ttl and serve them without calling the handler.
+func CacheWithStore(store CacheStore, ttl time.Duration) CacheOption {
+	return func(opt *cacheOption) {
+		opt.store = store
+		opt.ttl = ttl
+	}
+}
+
+// CacheSubject sets the function returning the caller a response is cached
+// for, part of the cache key. Defaults to the subject of the *api.TokenClaims
+// in the request context, or else a hash of the Authorization and X-API-Key
+// headers.
+func CacheSubject(fn func(r *http.Request) string) CacheOption {
+	return func(opt *cacheOption) { opt.subject = fn }
+}
+
+// MakeHttpCacheMiddleware returns an http middleware computing a strong ETag
+// for successful GET and HEAD responses that don't already have one, and
+// answering requests whose If-None-Match header matches it with 304 Not
+// Modified. Responses are buffered to hash them; streamed responses, which
+// flush or are event streams, are passed through untouched. With
+// CacheWithStore, responses are also kept in a shared cache keyed by method,
+// path, query, caller and the Accept and Accept-Encoding headers, unless their
+// Cache-Control forbids it or they vary by other request headers.
+func MakeHttpCacheMiddleware(options ...CacheOption) func(http.Handler) http.Handler {
+	opts := cacheOption{subject: cacheSubject}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+
+			var key string
+			if opts.store != nil && !strings.Contains(r.Header.Get(HeaderCacheControl), "no-cache") {
+				key = cacheKey(r, opts.subject(r))
+				if res, err := opts.store.Get(ctx, key); err == nil && res != nil {
+					for k, values := range res.Header {
+						w.Header()[k] = append([]string(nil), values...)
+					}
+					writeCached(w, r, res.StatusCode, res.Body)
+					return
+				}
+			}
+
+			bw := &bufferedWriter{ResponseWriter: w, code: http.StatusOK}
+			next.ServeHTTP(bw, r)
+			if bw.passthrough {
+				return
+			}
+
+			body := bw.buf.Bytes()
+			if bw.code == http.StatusOK && w.Header().Get(HeaderETag) == "" {
+				sum := sha256.Sum256(body)
+				w.Header().Set(HeaderETag, `"`+hex.EncodeToString(sum[:16])+`"`)
+			}
+
+			if key != "" && bw.code == http.StatusOK && cacheable(w.Header()) {
+				_ = opts.store.Set(ctx, key, &CachedResponse{
+					StatusCode: bw.code,
+					Header:     w.Header().Clone(),
+					Body:       append([]byte(nil), body...),
+				}, opts.ttl)
+			}
+
+			writeCached(w, r, bw.code, body)
+		})
+	}
+}
+
+// writeCached writes a complete response, or 304 Not Modified when the
+// request's If-None-Match header matches its ETag.
+func writeCached(w http.ResponseWriter, r *http.Request, code int, body []byte) {
+	if code == http.StatusOK && etagMatch(r.Header.Get(HeaderIfNoneMatch), w.Header().Get(HeaderETag)) {
+		h := w.Header()
+		h.Del(HeaderContentType)
+		h.Del(HeaderContentLength)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(code)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+func etagMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cacheVary are the request headers that are part of the cache key, so
+// responses varying by them can be cached.
+var cacheVary = map[string]bool{
+	http.CanonicalHeaderKey(HeaderAccept):         true,
+	http.CanonicalHeaderKey(HeaderAcceptEncoding): true,
+}
+
+func cacheable(h http.Header) bool {
+	cc := strings.ToLower(h.Get(HeaderCacheControl))
+	if strings.Contains(cc, "no-store") || h.Get(HeaderSetCookie) != "" {
+		return false
+	}
+
+	for _, vary := range h.Values(HeaderVary) {
+		for _, name := range strings.Split(vary, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" && !cacheVary[http.CanonicalHeaderKey(name)] {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func cacheKey(r *http.Request, subject string) string {
+	return r.Method + " " + r.URL.Path + "?" + r.URL.Query().Encode() + " " + subject +
+		"\n" + r.Header.Get(HeaderAccept) + "\n" + r.Header.Get(HeaderAcceptEncoding)
+}
+
+func cacheSubject(r *http.Request) string {
+	if claims, ok := api.AuthClaimsFromContext(r.Context()); ok && claims.Subject != "" {
+		return claims.Subject
+	}
+
+	auth := r.Header.Get(HeaderAuthorization) + "\n" + r.Header.Get(HeaderXAPIKey)
+	if auth == "\n" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(auth))
+	return hex.EncodeToString(sum[:])
+}
+
+// bufferedWriter holds the response back until the handler returns, unless it
+// turns out to be a stream.
+type bufferedWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+	passthrough bool
+	buf         bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.wroteHeader {
+		return
+	}
+
+	w.code = code
+	w.wroteHeader = true
+	if strings.HasPrefix(w.Header().Get(HeaderContentType), HttpContentTypeEventStream) {
+		w.startPassthrough()
+	}
+}
+
+func (w *bufferedWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+func (w *bufferedWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.passthrough {
+		w.startPassthrough()
+	}
+	if fl, ok := w.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+func (w *bufferedWriter) startPassthrough() {
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.code)
+	if w.buf.Len() > 0 {
+		io.Copy(w.ResponseWriter, &w.buf)
+	}
+}
+
+// MemoryCacheStore is an in-process CacheStore. Expired responses are evicted
+// periodically.
+type MemoryCacheStore struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	now     func() time.Time
+	sweeper storeutil.Sweeper
+}
+
+type cacheEntry struct {
+	res     *CachedResponse
+	expires time.Time
+}
+
+// NewMemoryCacheStore creates an empty MemoryCacheStore.
+func NewMemoryCacheStore() *MemoryCacheStore {
+	return &MemoryCacheStore{
+		entries: make(map[string]cacheEntry),
+		now:     time.Now,
+	}
+}
+
+// Get implements CacheStore.
+func (s *MemoryCacheStore) Get(_ context.Context, key string) (*CachedResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok || s.now().After(entry.expires) {
+		return nil, nil
+	}
+
+	return entry.res, nil
+}
+
+// Set implements CacheStore.
+func (s *MemoryCacheStore) Set(_ context.Context, key string, res *CachedResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	s.entries[key] = cacheEntry{res: res, expires: now.Add(ttl)}
+
+	return nil
+}
+
+func (s *MemoryCacheStore) sweep(now time.Time) {
+	if !s.sweeper.Due(now) {
+		return
+	}
+
+	storeutil.DeleteExpired(s.entries, now, func(entry cacheEntry) time.Time { return entry.expires })
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/go-chi/chi/v5"
 )
 
+// ChiURLParamIntoContext is a RequestFunc storing the URL parameters of the
+// chi route matched by the request in the context under ContextKeyURLParams.
 func ChiURLParamIntoContext(ctx context.Context, r *http.Request) context.Context {
 	params := make(map[string]string)
 	if rctx := chi.RouteContext(ctx); rctx != nil {
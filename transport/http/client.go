@@ -0,0 +1,325 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// HTTPClient is an interface that models *http.Client.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client wraps a URL and provides a method that implements api.Endpoint.
+type Client[I, O any] struct {
+	client         HTTPClient
+	req            CreateRequestFunc[I]
+	dec            DecodeResponseFunc[O]
+	before         []RequestFunc
+	after          []ClientResponseFunc
+	finalizer      []ClientFinalizerFunc
+	bufferedStream bool
+}
+
+type clientOption struct {
+	client         HTTPClient
+	breaker        *api.CircuitBreaker
+	before         []RequestFunc
+	after          []ClientResponseFunc
+	finalizer      []ClientFinalizerFunc
+	bufferedStream bool
+}
+
+// ClientOption sets an optional parameter for clients.
+type ClientOption func(opt *clientOption)
+
+// NewClient constructs a usable Client for a single remote method.
+func NewClient[I, O any](
+	method string,
+	tgt *url.URL,
+	enc EncodeRequestFunc[I],
+	dec DecodeResponseFunc[O],
+	options ...ClientOption,
+) *Client[I, O] {
+	return NewExplicitClient(makeCreateRequestFunc(method, tgt, enc), dec, options...)
+}
+
+// NewExplicitClient is like NewClient but uses a CreateRequestFunc instead of a
+// method, target URL, and EncodeRequestFunc, which allows for more control over
+// the outgoing HTTP request.
+func NewExplicitClient[I, O any](
+	req CreateRequestFunc[I],
+	dec DecodeResponseFunc[O],
+	options ...ClientOption,
+) *Client[I, O] {
+	opts := &clientOption{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	c := &Client[I, O]{
+		client:         http.DefaultClient,
+		req:            req,
+		dec:            dec,
+		before:         opts.before,
+		after:          opts.after,
+		finalizer:      opts.finalizer,
+		bufferedStream: opts.bufferedStream,
+	}
+
+	if opts.client != nil {
+		c.client = opts.client
+	}
+
+	if opts.breaker != nil {
+		c.client = &breakerClient{next: c.client, breaker: opts.breaker}
+	}
+
+	return c
+}
+
+// SetClient sets the underlying HTTP client used for requests.
+// By default, http.DefaultClient is used.
+func SetClient(client HTTPClient) ClientOption {
+	return func(c *clientOption) { c.client = client }
+}
+
+// ClientCircuitBreaker routes every request through the given circuit breaker.
+// Transport errors and 5xx responses count as failures; while the circuit is
+// open requests fail fast with an *api.CircuitOpenError without reaching the
+// network.
+func ClientCircuitBreaker(cb *api.CircuitBreaker) ClientOption {
+	return func(c *clientOption) { c.breaker = cb }
+}
+
+// ClientBefore adds one or more RequestFuncs to be applied to the outgoing HTTP
+// request before it's invoked.
+func ClientBefore(before ...RequestFunc) ClientOption {
+	return func(c *clientOption) { c.before = append(c.before, before...) }
+}
+
+// ClientAfter adds one or more ClientResponseFuncs, which are applied to the
+// incoming HTTP response prior to it being decoded. This is useful for
+// obtaining anything off of the response and adding it into the context prior
+// to decoding.
+func ClientAfter(after ...ClientResponseFunc) ClientOption {
+	return func(c *clientOption) { c.after = append(c.after, after...) }
+}
+
+// ClientFinalizer adds one or more ClientFinalizerFuncs to be executed at the
+// end of every HTTP request. Finalizers are executed in the order in which they
+// were added. By default, no finalizer is registered.
+func ClientFinalizer(f ...ClientFinalizerFunc) ClientOption {
+	return func(c *clientOption) { c.finalizer = append(c.finalizer, f...) }
+}
+
+// BufferedStream sets whether the HTTP response body is left open, allowing it
+// to be read from later. Useful for transporting a file as a buffered stream.
+// That body has to be drained and closed to properly end the request.
+func BufferedStream(buffered bool) ClientOption {
+	return func(c *clientOption) { c.bufferedStream = buffered }
+}
+
+// Endpoint returns a usable api.Endpoint that calls the remote HTTP endpoint.
+func (c Client[I, O]) Endpoint() api.Endpoint[I, O] {
+	return func(ctx context.Context, request I) (O, error) {
+		ctx, cancel := context.WithCancel(ctx)
+
+		var (
+			response O
+			resp     *http.Response
+			err      error
+		)
+		if c.finalizer != nil {
+			defer func() {
+				if resp != nil {
+					ctx = context.WithValue(ctx, ContextKeyResponseHeaders, resp.Header)
+					ctx = context.WithValue(ctx, ContextKeyResponseSize, resp.ContentLength)
+				}
+				for _, f := range c.finalizer {
+					f(ctx, err)
+				}
+			}()
+		}
+
+		req, err := c.req(ctx, request)
+		if err != nil {
+			cancel()
+			return response, err
+		}
+
+		for _, f := range c.before {
+			ctx = f(ctx, req)
+		}
+
+		resp, err = c.client.Do(req.WithContext(ctx))
+		if err != nil {
+			cancel()
+			return response, err
+		}
+
+		// If the caller asked for a buffered stream, we don't cancel the
+		// context when the endpoint returns. Instead, we should call the
+		// cancel func when closing the response body.
+		if c.bufferedStream {
+			resp.Body = bodyWithCancel{ReadCloser: resp.Body, cancel: cancel}
+		} else {
+			defer resp.Body.Close()
+			defer cancel()
+		}
+
+		for _, f := range c.after {
+			ctx = f(ctx, resp)
+		}
+
+		response, err = c.dec(ctx, resp)
+		return response, err
+	}
+}
+
+// breakerClient is an HTTPClient guarded by a circuit breaker.
+type breakerClient struct {
+	next    HTTPClient
+	breaker *api.CircuitBreaker
+}
+
+func (bc *breakerClient) Do(req *http.Request) (*http.Response, error) {
+	done, err := bc.breaker.Allow()
+	if err != nil {
+		return nil, &api.CircuitOpenError{Name: bc.breaker.Name()}
+	}
+
+	resp, err := bc.next.Do(req)
+	switch {
+	case err != nil:
+		done(err)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		done(&ClientResponseError{Code: resp.StatusCode})
+	default:
+		done(nil)
+	}
+
+	return resp, err
+}
+
+// bodyWithCancel is a wrapper for an io.ReadCloser with also a
+// cancel function which is called when the Close is used
+type bodyWithCancel struct {
+	io.ReadCloser
+
+	cancel context.CancelFunc
+}
+
+func (bwc bodyWithCancel) Close() error {
+	bwc.ReadCloser.Close()
+	bwc.cancel()
+	return nil
+}
+
+// ClientFinalizerFunc can be used to perform work at the end of a client HTTP
+// request, after the response is returned. The principal
+// intended use is for error logging. Additional response parameters are
+// provided in the context under keys with the ContextKeyResponse prefix.
+// Note: err may be nil. There maybe also no additional response parameters
+// depending on when an error occurs.
+type ClientFinalizerFunc func(ctx context.Context, err error)
+
+// EncodeJSONRequest is an EncodeRequestFunc that serializes the request as a
+// JSON object to the Request body. Many JSON-over-HTTP services can use it as
+// a sensible default. If the request implements Headerer, the provided headers
+// will be applied to the request.
+func EncodeJSONRequest[T any](_ context.Context, r *http.Request, request T) error {
+	r.Header.Set(HeaderContentType, "application/json; charset=utf-8")
+	if headerer, ok := any(request).(Headerer); ok {
+		for k := range headerer.Headers() {
+			r.Header.Set(k, headerer.Headers().Get(k))
+		}
+	}
+	var b bytes.Buffer
+	if err := json.NewEncoder(&b).Encode(request); err != nil {
+		return err
+	}
+	r.ContentLength = int64(b.Len())
+	r.Body = io.NopCloser(&b)
+	return nil
+}
+
+// EncodeURLQueryRequest is an EncodeRequestFunc that encodes the request into
+// the URL query of the outgoing request, using the given struct tag as the key
+// name. It is the client-side counterpart of CommonGetRequestDecoder.
+func EncodeURLQueryRequest[T any](tag string) EncodeRequestFunc[T] {
+	return func(_ context.Context, r *http.Request, request T) error {
+		query, err := EncodeToURLQuery(request, tag)
+		if err != nil {
+			return err
+		}
+
+		q := r.URL.Query()
+		for k, values := range query {
+			for _, v := range values {
+				q.Add(k, v)
+			}
+		}
+		r.URL.RawQuery = q.Encode()
+		return nil
+	}
+}
+
+// DecodeJSONResponse is a DecodeResponseFunc that deserializes a JSON response
+// body into T. Responses with a non-2xx status code are returned as an error
+// carrying the status code and the response body.
+func DecodeJSONResponse[T any](_ context.Context, resp *http.Response) (T, error) {
+	var res T
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		return res, &ClientResponseError{Code: resp.StatusCode, Body: body}
+	}
+
+	if resp.StatusCode == http.StatusNoContent {
+		return res, nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return res, err
+	}
+
+	return res, nil
+}
+
+// ClientResponseError is returned by DecodeJSONResponse when the remote
+// endpoint answers with a non-2xx status code. It implements StatusCoder so
+// the error keeps its original status when passed through a Server.
+type ClientResponseError struct {
+	Code int
+	Body []byte
+}
+
+func (e *ClientResponseError) Error() string {
+	return fmt.Sprintf("remote endpoint responded with status %d: %s", e.Code, bytes.TrimSpace(e.Body))
+}
+
+func (e *ClientResponseError) StatusCode() int {
+	return e.Code
+}
+
+func makeCreateRequestFunc[I any](method string, target *url.URL, enc EncodeRequestFunc[I]) CreateRequestFunc[I] {
+	return func(ctx context.Context, request I) (*http.Request, error) {
+		req, err := http.NewRequest(method, target.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = enc(ctx, req, request); err != nil {
+			return nil, err
+		}
+
+		return req, nil
+	}
+}
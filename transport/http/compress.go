@@ -0,0 +1,200 @@
+package http
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// CompressWriter compresses what is written to it. Flush writes out the
+// pending compressed data, which streamed responses need, and Close finishes
+// the compressed stream.
+type CompressWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// CompressorFunc creates a CompressWriter writing to w. Brotli and zstd
+// writers, such as those of github.com/andybalholm/brotli and
+// github.com/klauspost/compress/zstd, satisfy CompressWriter and can be
+// registered with:
+//
+//	RegisterCompressor("br", func(w io.Writer) (CompressWriter, error) {
+//		return brotli.NewWriter(w), nil
+//	})
+//	RegisterCompressor("zstd", func(w io.Writer) (CompressWriter, error) {
+//		return zstd.NewWriter(w)
+//	})
+type CompressorFunc func(w io.Writer) (CompressWriter, error)
+
+// CompressorRegistry holds the compressors available to the response
+// encoders, keyed by content coding (e.g. "gzip"), and decides which
+// responses are worth compressing.
+type CompressorRegistry struct {
+	mu           sync.RWMutex
+	compressors  map[string]CompressorFunc
+	preference   []string
+	minSize      int
+	contentTypes []string
+}
+
+// NewCompressorRegistry returns a registry with a gzip compressor, compressing
+// text, JSON, XML, JavaScript, NDJSON and SVG responses of at least 1KB.
+func NewCompressorRegistry() *CompressorRegistry {
+	r := &CompressorRegistry{
+		compressors: make(map[string]CompressorFunc),
+		minSize:     1024,
+		contentTypes: []string{
+			"text/",
+			"application/json",
+			"application/xml",
+			"application/javascript",
+			HttpContentTypeNDJSON,
+			"image/svg+xml",
+			"+json",
+			"+xml",
+		},
+	}
+
+	r.Register("gzip", func(w io.Writer) (CompressWriter, error) {
+		return gzip.NewWriter(w), nil
+	})
+
+	return r
+}
+
+// DefaultCompressors is the registry used by the response encoders of this
+// package.
+var DefaultCompressors = NewCompressorRegistry()
+
+// RegisterCompressor registers fn for encoding in DefaultCompressors.
+func RegisterCompressor(encoding string, fn CompressorFunc) {
+	DefaultCompressors.Register(encoding, fn)
+}
+
+// Register adds or replaces the compressor of the given content coding.
+// When the client accepts several codings with the same quality, the last
+// registered one is used, so brotli or zstd registered after the default
+// gzip take precedence.
+func (r *CompressorRegistry) Register(encoding string, fn CompressorFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	encoding = strings.ToLower(encoding)
+	if _, ok := r.compressors[encoding]; !ok {
+		r.preference = append([]string{encoding}, r.preference...)
+	}
+	r.compressors[encoding] = fn
+}
+
+// SetMinSize sets the size in bytes under which responses are not
+// compressed. Streamed responses, whose size is unknown, are always
+// compressed.
+func (r *CompressorRegistry) SetMinSize(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.minSize = n
+}
+
+// SetContentTypes sets the content types of the responses worth compressing.
+// Entries ending with "/" match a whole type ("text/"), entries starting with
+// "+" match a structured syntax suffix ("+json"), and others match a media
+// type exactly. Responses of other types, such as images or archives that are
+// already compressed, are sent as they are.
+func (r *CompressorRegistry) SetContentTypes(types ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.contentTypes = types
+}
+
+// Negotiate picks the registered content coding to use for the given
+// Accept-Encoding header value. It returns an empty encoding when the
+// response should not be compressed.
+func (r *CompressorRegistry) Negotiate(acceptEncoding string) (string, CompressorFunc) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	accepted := make(map[string]float64)
+	wildcard := -1.0
+	for _, spec := range parseQualityList(acceptEncoding) {
+		if spec.value == "*" {
+			wildcard = spec.q
+			continue
+		}
+		accepted[spec.value] = spec.q
+	}
+
+	var (
+		best     string
+		bestQ    float64
+		bestFunc CompressorFunc
+	)
+	for _, encoding := range r.preference {
+		q, ok := accepted[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ, bestFunc = encoding, q, r.compressors[encoding]
+		}
+	}
+
+	return best, bestFunc
+}
+
+// compressible reports whether a response of contentType and size bytes, or
+// of unknown size when size is negative, is worth compressing.
+func (r *CompressorRegistry) compressible(contentType string, size int) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if size >= 0 && size < r.minSize {
+		return false
+	}
+
+	mediaType := normalizeMediaType(contentType)
+	for _, t := range r.contentTypes {
+		switch {
+		case strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t),
+			strings.HasPrefix(t, "+") && strings.HasSuffix(mediaType, t),
+			mediaType == t:
+			return true
+		}
+	}
+
+	return false
+}
+
+// compressWriter returns the writer the body of a response of the given size
+// (negative when unknown) must be written to, compressing it with the coding
+// negotiated from the Accept-Encoding header captured by
+// PopulateRequestContext when the response is worth it. The Content-Type
+// header must already be set. flush writes out pending compressed data and
+// done must be called once the body is written.
+func compressWriter(ctx context.Context, w http.ResponseWriter, size int) (out io.Writer, flush func() error, done func() error) {
+	noop := func() error { return nil }
+
+	h := w.Header()
+	if h.Get(HeaderContentEncoding) != "" || !DefaultCompressors.compressible(h.Get(HeaderContentType), size) {
+		return w, noop, noop
+	}
+	h.Add(HeaderVary, HeaderAcceptEncoding)
+
+	acceptEncoding, _ := ctx.Value(ContextKeyRequestAcceptEncoding).(string)
+	encoding, fn := DefaultCompressors.Negotiate(acceptEncoding)
+	if fn == nil {
+		return w, noop, noop
+	}
+
+	cw, err := fn(w)
+	if err != nil {
+		return w, noop, noop
+	}
+
+	h.Set(HeaderContentEncoding, encoding)
+	h.Del(HeaderContentLength)
+	return cw, cw.Flush, cw.Close
+}
@@ -0,0 +1,53 @@
+package http
+
+import (
+	"net/http"
+	"time"
+)
+
+// LastModifier is checked by Server and the response encoders. If a response
+// implements LastModifier, its modification time is sent in the Last-Modified
+// header, and Server answers GET and HEAD requests whose If-Modified-Since
+// header is not older with 304 Not Modified, without calling the encoder.
+type LastModifier interface {
+	LastModified() time.Time
+}
+
+// setLastModified sets the Last-Modified header of response, if it has one,
+// and returns its modification time.
+func setLastModified(w http.ResponseWriter, response interface{}) time.Time {
+	lm, ok := response.(LastModifier)
+	if !ok {
+		return time.Time{}
+	}
+
+	t := lm.LastModified()
+	if t.IsZero() || t.Unix() == 0 {
+		return time.Time{}
+	}
+
+	t = t.UTC().Truncate(time.Second)
+	w.Header().Set(HeaderLastModified, t.Format(http.TimeFormat))
+	return t
+}
+
+// notModified reports whether r is a conditional GET or HEAD request that
+// can be answered with 304 Not Modified for a resource modified at
+// lastModified. If-None-Match takes precedence over If-Modified-Since, as
+// required by RFC 7232.
+func notModified(r *http.Request, lastModified time.Time) bool {
+	if lastModified.IsZero() || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return false
+	}
+
+	if r.Header.Get(HeaderIfNoneMatch) != "" {
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get(HeaderIfModifiedSince))
+	if err != nil {
+		return false
+	}
+
+	return !lastModified.After(since)
+}
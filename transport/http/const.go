@@ -5,14 +5,18 @@ const (
 	HeaderAcceptEncoding      = "Accept-Encoding"
 	HeaderAllow               = "Allow"
 	HeaderAuthorization       = "Authorization"
+	HeaderCacheControl        = "Cache-Control"
 	HeaderContentDisposition  = "Content-Disposition"
 	HeaderContentEncoding     = "Content-Encoding"
 	HeaderContentLength       = "Content-Length"
 	HeaderContentType         = "Content-Type"
 	HeaderCookie              = "Cookie"
 	HeaderSetCookie           = "Set-Cookie"
+	HeaderETag                = "ETag"
 	HeaderIfModifiedSince     = "If-Modified-Since"
+	HeaderIfNoneMatch         = "If-None-Match"
 	HeaderLastModified        = "Last-Modified"
+	HeaderLink                = "Link"
 	HeaderLocation            = "Location"
 	HeaderUpgrade             = "Upgrade"
 	HeaderVary                = "Vary"
@@ -26,8 +30,14 @@ const (
 	HeaderXRealIP             = "X-Real-IP"
 	HeaderXRequestID          = "X-Request-ID"
 	HeaderXRequestedWith      = "X-Requested-With"
+	HeaderXAPIKey             = "X-API-Key"
+	HeaderIdempotencyKey      = "Idempotency-Key"
+	HeaderIdempotentReplayed  = "Idempotent-Replayed"
 	HeaderServer              = "Server"
 	HeaderOrigin              = "Origin"
+	HeaderAPIVersion          = "X-Api-Version"
+	HeaderDeprecation         = "Deprecation"
+	HeaderSunset              = "Sunset"
 
 	// Access control
 	HeaderAccessControlRequestMethod    = "Access-Control-Request-Method"
@@ -64,4 +74,11 @@ const (
 	HttpContentTypeZip            = "application/zip"
 	HttpContentTypePPT            = "application/vnd.ms-powerpoint"
 	HttpContentTypePDF            = "application/pdf"
+	HttpContentTypeMsgPack        = "application/msgpack"
+	HttpContentTypeProtobuf       = "application/x-protobuf"
+	HttpContentTypeEventStream    = "text/event-stream"
+	HttpContentTypeNDJSON         = "application/x-ndjson"
+	HttpContentTypeProblemJSON    = "application/problem+json"
+	HttpContentTypeJSONAPI        = "application/vnd.api+json"
+	HttpContentTypeHAL            = "application/hal+json"
 )
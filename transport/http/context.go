@@ -48,7 +48,8 @@ const (
 	ContextKeyRequestUserAgent
 
 	// ContextKeyRequestXRequestID is populated in the context by
-	// PopulateRequestContext. Its value is r.Header.Get("X-Request-Id").
+	// PopulateRequestContext. Its value is r.Header.Get("X-Request-Id"), or
+	// else the id a Server generates for the request.
 	ContextKeyRequestXRequestID
 
 	// ContextKeyRequestAccept is populated in the context by
@@ -66,6 +67,10 @@ const (
 
 	ContextKeyRequestAcceptEncoding
 
+	// ContextKeyURLParams is populated in the context by
+	// ChiURLParamIntoContext, URLParamsIntoContext or PathValuesIntoContext,
+	// depending on the router. Its value is of type map[string]string, and is
+	// where the decoders read path parameters from.
 	ContextKeyURLParams
 
 	// ContextKeyRequestXTraceID is populated in the context by
@@ -78,4 +83,46 @@ const (
 	ContextKeyRequestScheme
 
 	ContextKeyRequestTLS
+
+	// ContextKeyPanicStack is populated in the context for ServerFinalizerFuncs
+	// when the Server recovered from a panic. Its value is the stack trace of
+	// the panic, of type []byte.
+	ContextKeyPanicStack
+
+	// ContextKeyFields is populated in the context by FieldsIntoContext. Its
+	// value is the list of fields selected by the fields query param, of
+	// type []string.
+	ContextKeyFields
+
+	// ContextKeyWebhookBody is populated in the context by
+	// MakeHttpWebhookMiddleware and VerifyWebhook. Its value is the raw body
+	// of the verified webhook, of type []byte.
+	ContextKeyWebhookBody
+
+	// ContextKeyRawBody is populated in the context by BufferBody. Its value
+	// is the raw request body, of type []byte.
+	ContextKeyRawBody
+
+	// ContextKeyAPIVersion is populated in the context by VersionIntoContext
+	// and VersionedHandler. Its value is the API version requested, of type
+	// string.
+	ContextKeyAPIVersion
+
+	// ContextKeyRequestInfo is populated in the context by
+	// PopulateRequestContext. Its value is of type *RequestInfo, and is read
+	// with RequestInfoFromContext.
+	ContextKeyRequestInfo
+
+	// ContextKeyUserAgentInfo is populated in the context by
+	// UserAgentIntoContext. Its value is of type UserAgentInfo.
+	ContextKeyUserAgentInfo
+
+	// ContextKeyGeoInfo is populated in the context by the RequestFunc of
+	// MakeGeoIPIntoContext. Its value is of type GeoInfo.
+	ContextKeyGeoInfo
+
+	// ContextKeyCSRFToken is populated in the context by
+	// MakeHttpCSRFMiddleware. Its value is the CSRF token of the request, of
+	// type string.
+	ContextKeyCSRFToken
 )
@@ -0,0 +1,221 @@
+package http
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy configures MakeCORSMiddleware. Apply different policies to
+// different routes by mounting one middleware per route group.
+type CORSPolicy struct {
+	// AllowedOrigins lists the origins allowed to make cross-origin requests:
+	// exact origins such as "https://example.com", wildcard subdomains such
+	// as "https://*.example.com", or "*" for any origin.
+	AllowedOrigins []string
+
+	// AllowedOriginPatterns are matched against the origins not found in
+	// AllowedOrigins.
+	AllowedOriginPatterns []*regexp.Regexp
+
+	// AllowedMethods lists the methods allowed for cross-origin requests.
+	// Defaults to GET, HEAD and POST.
+	AllowedMethods []string
+
+	// AllowedHeaders lists the request headers allowed for cross-origin
+	// requests, "*" allowing any header.
+	AllowedHeaders []string
+
+	// ExposedHeaders lists the response headers readable by the client.
+	ExposedHeaders []string
+
+	// AllowCredentials allows requests carrying cookies or HTTP
+	// authentication. It can't be combined with "*" origins, which would let
+	// any site make authenticated requests; list the trusted origins instead.
+	AllowCredentials bool
+
+	// MaxAge sets how long preflight results may be cached. Zero omits the
+	// header.
+	MaxAge time.Duration
+
+	// PreflightPassthrough passes preflight requests to the next handler
+	// after setting the CORS headers, instead of answering them with 204.
+	PreflightPassthrough bool
+}
+
+type corsPolicy struct {
+	CORSPolicy
+	anyOrigin bool
+	origins   map[string]bool
+	wildcards [][2]string
+	methods   map[string]bool
+	anyHeader bool
+	headers   map[string]bool
+}
+
+// MakeCORSMiddleware returns an http middleware applying policy to
+// cross-origin requests and answering their preflight requests. Requests of
+// disallowed origins are passed on without CORS headers, so browsers block
+// their responses. It panics when policy allows credentials for "*" origins.
+func MakeCORSMiddleware(policy CORSPolicy) func(http.Handler) http.Handler {
+	p := newCORSPolicy(policy)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions && r.Header.Get(HeaderAccessControlRequestMethod) != "" {
+				p.preflight(w, r)
+				if p.PreflightPassthrough {
+					next.ServeHTTP(w, r)
+				} else {
+					w.WriteHeader(http.StatusNoContent)
+				}
+				return
+			}
+
+			p.actual(w, r)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func newCORSPolicy(policy CORSPolicy) *corsPolicy {
+	p := &corsPolicy{
+		CORSPolicy: policy,
+		origins:    make(map[string]bool),
+		methods:    make(map[string]bool),
+		headers:    make(map[string]bool),
+	}
+
+	for _, origin := range policy.AllowedOrigins {
+		origin = strings.ToLower(origin)
+		switch {
+		case origin == "*":
+			p.anyOrigin = true
+		case strings.Contains(origin, "*"):
+			prefix, suffix, _ := strings.Cut(origin, "*")
+			p.wildcards = append(p.wildcards, [2]string{prefix, suffix})
+		default:
+			p.origins[origin] = true
+		}
+	}
+
+	if p.anyOrigin && p.AllowCredentials {
+		panic(`cors: AllowCredentials with "*" origins`)
+	}
+
+	if len(p.AllowedMethods) == 0 {
+		p.AllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	for _, method := range p.AllowedMethods {
+		p.methods[strings.ToUpper(method)] = true
+	}
+
+	for _, header := range policy.AllowedHeaders {
+		if header == "*" {
+			p.anyHeader = true
+		}
+		p.headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return p
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+
+	o := strings.ToLower(origin)
+	if p.origins[o] {
+		return true
+	}
+
+	for _, w := range p.wildcards {
+		if len(o) > len(w[0])+len(w[1]) && strings.HasPrefix(o, w[0]) && strings.HasSuffix(o, w[1]) {
+			return true
+		}
+	}
+
+	for _, re := range p.AllowedOriginPatterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *corsPolicy) allowHeaders(requested string) bool {
+	if p.anyHeader || requested == "" {
+		return true
+	}
+
+	for _, header := range strings.Split(requested, ",") {
+		header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+		if header != "" && !p.headers[header] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *corsPolicy) setOrigin(h http.Header, origin string) {
+	if p.anyOrigin {
+		h.Set(HeaderAccessControlAllowOrigin, "*")
+	} else {
+		h.Set(HeaderAccessControlAllowOrigin, origin)
+	}
+
+	if p.AllowCredentials {
+		h.Set(HeaderAccessControlAllowCredentials, "true")
+	}
+}
+
+func (p *corsPolicy) preflight(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add(HeaderVary, HeaderOrigin)
+	h.Add(HeaderVary, HeaderAccessControlRequestMethod)
+	h.Add(HeaderVary, HeaderAccessControlRequestHeaders)
+
+	origin := r.Header.Get(HeaderOrigin)
+	if origin == "" || !p.allowOrigin(origin) {
+		return
+	}
+
+	method := strings.ToUpper(r.Header.Get(HeaderAccessControlRequestMethod))
+	if !p.methods[method] {
+		return
+	}
+
+	requested := r.Header.Get(HeaderAccessControlRequestHeaders)
+	if !p.allowHeaders(requested) {
+		return
+	}
+
+	p.setOrigin(h, origin)
+	h.Set(HeaderAccessControlAllowMethods, method)
+	if requested != "" {
+		h.Set(HeaderAccessControlAllowHeaders, requested)
+	}
+	if p.MaxAge > 0 {
+		h.Set(HeaderAccessControlMaxAge, strconv.Itoa(int(p.MaxAge.Seconds())))
+	}
+}
+
+func (p *corsPolicy) actual(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add(HeaderVary, HeaderOrigin)
+
+	origin := r.Header.Get(HeaderOrigin)
+	if origin == "" || !p.allowOrigin(origin) {
+		return
+	}
+
+	p.setOrigin(h, origin)
+	if len(p.ExposedHeaders) > 0 {
+		h.Set(HeaderAccessControlExposeHeaders, strings.Join(p.ExposedHeaders, ", "))
+	}
+}
@@ -0,0 +1,251 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// CSRFError is written by MakeHttpCSRFMiddleware for the unsafe requests
+// whose CSRF token is missing or doesn't match their cookie. It wraps
+// api.ErrForbidden and reports a 403 status code.
+type CSRFError struct {
+	Reason string
+}
+
+func (e *CSRFError) Error() string {
+	return "csrf: " + e.Reason
+}
+
+func (e *CSRFError) Unwrap() error {
+	return api.ErrForbidden
+}
+
+func (e *CSRFError) StatusCode() int {
+	return http.StatusForbidden
+}
+
+type csrfOption struct {
+	cookie       string
+	header       string
+	field        string
+	path         string
+	domain       string
+	maxAge       time.Duration
+	secure       bool
+	sameSite     http.SameSite
+	exempt       []string
+	exemptFunc   func(r *http.Request) bool
+	errorEncoder ErrorEncoder
+}
+
+// CSRFOption sets an optional parameter for MakeHttpCSRFMiddleware.
+type CSRFOption func(opt *csrfOption)
+
+// CSRFCookie sets the name of the cookie holding the token. Defaults to
+// "csrf_token".
+func CSRFCookie(name string) CSRFOption {
+	return func(opt *csrfOption) { opt.cookie = name }
+}
+
+// CSRFHeader sets the request header echoing the token. Defaults to
+// X-CSRF-Token.
+func CSRFHeader(name string) CSRFOption {
+	return func(opt *csrfOption) { opt.header = name }
+}
+
+// CSRFFormField sets the form field echoing the token, for url-encoded forms
+// without the header. Multipart forms must send the header, so their body,
+// which may stream uploads, is left for the decoder to read. Defaults to
+// "csrf_token"; an empty name disables it.
+func CSRFFormField(name string) CSRFOption {
+	return func(opt *csrfOption) { opt.field = name }
+}
+
+// CSRFCookiePath sets the path and domain of the cookie. Defaults to "/" and
+// the host of the request.
+func CSRFCookiePath(path, domain string) CSRFOption {
+	return func(opt *csrfOption) {
+		opt.path = path
+		opt.domain = domain
+	}
+}
+
+// CSRFMaxAge sets the lifetime of the cookie. Defaults to 12 hours; zero
+// makes it a session cookie.
+func CSRFMaxAge(d time.Duration) CSRFOption {
+	return func(opt *csrfOption) { opt.maxAge = d }
+}
+
+// CSRFSecure sets whether the cookie is only sent over HTTPS. Defaults to
+// true; disable it for local development over plain HTTP.
+func CSRFSecure(secure bool) CSRFOption {
+	return func(opt *csrfOption) { opt.secure = secure }
+}
+
+// CSRFSameSite sets the SameSite attribute of the cookie. Defaults to
+// http.SameSiteLaxMode.
+func CSRFSameSite(mode http.SameSite) CSRFOption {
+	return func(opt *csrfOption) { opt.sameSite = mode }
+}
+
+// CSRFExempt exempts the requests of the given paths from the check, such
+// as the endpoints receiving webhooks. A path ending with "/*" exempts every
+// path below it.
+func CSRFExempt(paths ...string) CSRFOption {
+	return func(opt *csrfOption) { opt.exempt = append(opt.exempt, paths...) }
+}
+
+// CSRFExemptFunc sets a function reporting the requests exempted from the
+// check, such as those authenticated by a bearer token rather than a
+// cookie.
+func CSRFExemptFunc(fn func(r *http.Request) bool) CSRFOption {
+	return func(opt *csrfOption) { opt.exemptFunc = fn }
+}
+
+// CSRFErrorEncoder sets the ErrorEncoder writing the *CSRFError of the
+// rejected requests. Defaults to DefaultErrorEncoder.
+func CSRFErrorEncoder(ee ErrorEncoder) CSRFOption {
+	return func(opt *csrfOption) { opt.errorEncoder = ee }
+}
+
+// MakeHttpCSRFMiddleware returns an http middleware protecting browser
+// facing services against cross-site request forgery with double-submit
+// cookies. Requests without a token cookie are issued one, readable by the
+// scripts of the page, and the token is stored in the request context, for
+// CSRFTokenFromContext, so pages can embed it. Unsafe requests, not GET,
+// HEAD, OPTIONS or TRACE, must echo the token of their cookie in the
+// X-CSRF-Token header, or the csrf_token field of url-encoded forms, which a
+// page of another site can't do; other requests fail with a *CSRFError, a
+// 403 response.
+func MakeHttpCSRFMiddleware(options ...CSRFOption) func(http.Handler) http.Handler {
+	opts := &csrfOption{
+		cookie:       "csrf_token",
+		header:       HeaderXCSRFToken,
+		field:        "csrf_token",
+		path:         "/",
+		maxAge:       12 * time.Hour,
+		secure:       true,
+		sameSite:     http.SameSiteLaxMode,
+		errorEncoder: DefaultErrorEncoder,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			var token string
+			if c, err := r.Cookie(opts.cookie); err == nil && validCSRFToken(c.Value) {
+				token = c.Value
+			}
+
+			if !csrfSafeMethod(r.Method) && !opts.exempted(r) {
+				if token == "" {
+					opts.errorEncoder(ctx, &CSRFError{Reason: "missing token cookie"}, w)
+					return
+				}
+
+				sent := r.Header.Get(opts.header)
+				if sent == "" && opts.field != "" && isURLEncodedForm(r) {
+					sent = r.PostFormValue(opts.field)
+				}
+				if sent == "" {
+					opts.errorEncoder(ctx, &CSRFError{Reason: "missing token"}, w)
+					return
+				}
+				if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+					opts.errorEncoder(ctx, &CSRFError{Reason: "token mismatch"}, w)
+					return
+				}
+			}
+
+			if token == "" {
+				var err error
+				if token, err = newCSRFToken(); err != nil {
+					opts.errorEncoder(ctx, err, w)
+					return
+				}
+				http.SetCookie(w, opts.newCookie(token))
+			}
+			w.Header().Add(HeaderVary, HeaderCookie)
+
+			ctx = context.WithValue(ctx, ContextKeyCSRFToken, token)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// CSRFTokenFromContext returns the CSRF token of the request, stored by
+// MakeHttpCSRFMiddleware.
+func CSRFTokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(ContextKeyCSRFToken).(string)
+	return token, ok
+}
+
+func (opt *csrfOption) exempted(r *http.Request) bool {
+	for _, path := range opt.exempt {
+		if prefix := strings.TrimSuffix(path, "*"); prefix != path {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return true
+			}
+		} else if r.URL.Path == path {
+			return true
+		}
+	}
+
+	return opt.exemptFunc != nil && opt.exemptFunc(r)
+}
+
+func (opt *csrfOption) newCookie(token string) *http.Cookie {
+	c := &http.Cookie{
+		Name:     opt.cookie,
+		Value:    token,
+		Path:     opt.path,
+		Domain:   opt.domain,
+		Secure:   opt.secure,
+		SameSite: opt.sameSite,
+	}
+	if opt.maxAge > 0 {
+		c.MaxAge = int(opt.maxAge / time.Second)
+		c.Expires = time.Now().Add(opt.maxAge)
+	}
+	return c
+}
+
+func csrfSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func isURLEncodedForm(r *http.Request) bool {
+	ct := strings.ToLower(r.Header.Get(HeaderContentType))
+	return strings.HasPrefix(ct, HttpContentTypeUrlFormEncoded)
+}
+
+// newCSRFToken returns 32 random bytes, base64url encoded.
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// validCSRFToken reports whether token may have been issued by
+// newCSRFToken, so tokens planted with another format are replaced.
+func validCSRFToken(token string) bool {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	return err == nil && len(b) == 32
+}
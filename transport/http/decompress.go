@@ -0,0 +1,99 @@
+package http
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// DecompressRequest wraps dec so that request bodies sent with a gzip or
+// deflate Content-Encoding are decompressed transparently before dec reads
+// them, whatever their format (JSON, multipart...). Bodies decompressing to
+// more than maxSize bytes fail with a *RequestTooLargeError, guarding against
+// zip bombs; a maxSize lower than 1 disables the limit. Unknown encodings and
+// corrupt bodies fail with api.ErrBadRequest.
+func DecompressRequest[T any](dec DecodeRequestFunc[T], maxSize int64) DecodeRequestFunc[T] {
+	return func(ctx context.Context, r *http.Request) (T, error) {
+		var empty T
+
+		encoding := strings.ToLower(strings.TrimSpace(r.Header.Get(HeaderContentEncoding)))
+
+		var (
+			zr  io.ReadCloser
+			err error
+		)
+		switch encoding {
+		case "", "identity":
+			return dec(ctx, r)
+		case "gzip", "x-gzip":
+			zr, err = gzip.NewReader(r.Body)
+		case "deflate":
+			zr, err = zlib.NewReader(r.Body)
+		default:
+			return empty, fmt.Errorf("%w: unsupported content encoding %q", api.ErrBadRequest, encoding)
+		}
+		if err != nil {
+			return empty, fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+		}
+
+		body := &decompressedBody{zr: zr, orig: r.Body, remaining: maxSize, limited: maxSize > 0}
+		r.Body = body
+		r.ContentLength = -1
+		r.Header.Del(HeaderContentEncoding)
+		r.Header.Del(HeaderContentLength)
+
+		request, err := dec(ctx, r)
+		if body.exceeded {
+			return empty, &RequestTooLargeError{Limit: maxSize}
+		}
+
+		return request, err
+	}
+}
+
+// decompressedBody reads the decompressed request body, failing once more
+// than the limit has been read.
+type decompressedBody struct {
+	zr        io.ReadCloser
+	orig      io.ReadCloser
+	remaining int64
+	limited   bool
+	exceeded  bool
+}
+
+func (b *decompressedBody) Read(p []byte) (int, error) {
+	if !b.limited {
+		return b.zr.Read(p)
+	}
+
+	if b.remaining < 0 {
+		b.exceeded = true
+		return 0, api.ErrRequestTooLarge
+	}
+
+	// read one byte past the limit to tell a body of exactly the limit from
+	// a larger one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+
+	n, err := b.zr.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		b.exceeded = true
+		return n + int(b.remaining), api.ErrRequestTooLarge
+	}
+
+	return n, err
+}
+
+func (b *decompressedBody) Close() error {
+	b.zr.Close()
+	return b.orig.Close()
+}
@@ -0,0 +1,117 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/logger"
+)
+
+type deprecationOption struct {
+	since   time.Time
+	log     logger.Logger
+	caller  func(ctx context.Context, r *http.Request) string
+	counter func(route, caller string)
+}
+
+// DeprecationOption sets an optional parameter for ServerDeprecated.
+type DeprecationOption func(opt *deprecationOption)
+
+// DeprecationSince sets when the endpoint was deprecated, sent in the
+// Deprecation header. By default, the header is "true".
+func DeprecationSince(t time.Time) DeprecationOption {
+	return func(opt *deprecationOption) { opt.since = t }
+}
+
+// DeprecationLogger sets the logger warning about the calls to the
+// endpoint. Defaults to the logger of the request context, from
+// logger.FromContext.
+func DeprecationLogger(l logger.Logger) DeprecationOption {
+	return func(opt *deprecationOption) { opt.log = l }
+}
+
+// DeprecationCaller sets the function identifying the caller of the
+// endpoint, run after the ServerBefore functions. Defaults to DefaultCaller.
+func DeprecationCaller(fn func(ctx context.Context, r *http.Request) string) DeprecationOption {
+	return func(opt *deprecationOption) { opt.caller = fn }
+}
+
+// DeprecationCounter sets the function counting the calls to the endpoint,
+// by route pattern and caller, such as the one returned by
+// metrics.NewDeprecationCounter.
+func DeprecationCounter(fn func(route, caller string)) DeprecationOption {
+	return func(opt *deprecationOption) { opt.counter = fn }
+}
+
+// DefaultCaller returns the subject of the claims stored in the context by
+// the authentication middlewares, JWT or client certificate, or "anonymous".
+func DefaultCaller(ctx context.Context, _ *http.Request) string {
+	switch claims := ctx.Value(api.ContextKeyAuthClaims).(type) {
+	case *api.TokenClaims:
+		if claims.Subject != "" {
+			return claims.Subject
+		}
+	case *ClientCertClaims:
+		if claims.Subject.CommonName != "" {
+			return claims.Subject.CommonName
+		}
+	}
+	return "anonymous"
+}
+
+// ServerDeprecated marks the endpoint of the Server as deprecated, to be
+// removed at sunset. Its responses, errors included, get the Deprecation
+// header, the Sunset header, unless sunset is zero, and a Link header to
+// link, unless empty, documenting the deprecation. Every call is logged as a
+// warning with the identity of its caller, and counted, so the clients still
+// calling the endpoint can be tracked down.
+func ServerDeprecated(sunset time.Time, link string, options ...DeprecationOption) ServerOption {
+	opts := &deprecationOption{caller: DefaultCaller}
+	for _, option := range options {
+		option(opts)
+	}
+
+	d := &deprecatedEndpoint{
+		Deprecation: Deprecation{Since: opts.since, Sunset: sunset, Link: link},
+		opts:        opts,
+	}
+	return func(s *serverOption) { s.deprecated = d }
+}
+
+type deprecatedEndpoint struct {
+	Deprecation
+	opts *deprecationOption
+}
+
+// record logs and counts a call to the endpoint.
+func (d *deprecatedEndpoint) record(ctx context.Context, r *http.Request) {
+	route := r.URL.Path
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		route = rctx.RoutePattern()
+	}
+	caller := d.opts.caller(ctx, r)
+
+	if d.opts.counter != nil {
+		d.opts.counter(route, caller)
+	}
+
+	fields := []interface{}{
+		"event", "deprecated_call",
+		"method", r.Method,
+		"route", route,
+		"caller", caller,
+		"user_agent", r.UserAgent(),
+	}
+	if !d.Sunset.IsZero() {
+		fields = append(fields, "sunset", d.Sunset.UTC().Format(time.RFC3339))
+	}
+
+	if d.opts.log != nil {
+		d.opts.log.Warn("deprecated endpoint called", fields...)
+	} else {
+		logger.FromContext(ctx).Warn("deprecated endpoint called", fields...)
+	}
+}
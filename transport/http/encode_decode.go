@@ -2,7 +2,6 @@ package http
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -13,6 +12,7 @@ import (
 	"net/http"
 
 	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/likearthian/apikit/api"
 	gohttp "github.com/likearthian/go-http"
 )
 
@@ -26,13 +26,13 @@ type DecodeRequestFunc[T any] func(context.Context, *http.Request) (request T, e
 // object. It's designed to be used in HTTP clients, for client-side
 // endpoints. One straightforward EncodeRequestFunc could be something that JSON
 // encodes the object directly to the request body.
-type EncodeRequestFunc func(context.Context, *http.Request, interface{}) error
+type EncodeRequestFunc[T any] func(context.Context, *http.Request, T) error
 
 // CreateRequestFunc creates an outgoing HTTP request based on the passed
 // request object. It's designed to be used in HTTP clients, for client-side
 // endpoints. It's a more powerful version of EncodeRequestFunc, and can be used
 // if more fine-grained control of the HTTP request is required.
-type CreateRequestFunc func(context.Context, interface{}) (*http.Request, error)
+type CreateRequestFunc[T any] func(context.Context, T) (*http.Request, error)
 
 // EncodeResponseFunc encodes the passed response object to the HTTP response
 // writer. It's designed to be used in HTTP servers, for server-side
@@ -44,45 +44,29 @@ type EncodeResponseFunc[T any] func(context.Context, http.ResponseWriter, T) err
 // response object. It's designed to be used in HTTP clients, for client-side
 // endpoints. One straightforward DecodeResponseFunc could be something that
 // JSON decodes from the response body to the concrete response type.
-type DecodeResponseFunc func(context.Context, *http.Response) (response interface{}, err error)
+type DecodeResponseFunc[T any] func(context.Context, *http.Response) (response T, err error)
 
+// CommonGetRequestDecoder decodes a request with BindRequest.
 func CommonGetRequestDecoder[T any](ctx context.Context, r *http.Request) (T, error) {
-	var reqObj T
-
-	query := r.URL.Query()
-	params, ok := ctx.Value(ContextKeyURLParams).(map[string]string)
-	if ok {
-		//include params into query to be parsed
-		for k, v := range params {
-			query.Add(k, v)
-		}
-	}
-
-	if err := BindURLQuery(&reqObj, query); err != nil {
-		return reqObj, err
-	}
-
-	return reqObj, nil
+	return BindRequest[T](ctx, r)
 }
 
+// CommonPostRequestDecoder decodes a request whose body must be a JSON
+// document, then binds the path, query, header and cookie values like
+// BindRequest does.
 func CommonPostRequestDecoder[T any](ctx context.Context, r *http.Request) (T, error) {
 	var reqObj T
 
-	query := r.URL.Query()
-	params, ok := ctx.Value(ContextKeyURLParams).(map[string]string)
-	if ok {
-		//include params into query to be parsed
-		for k, v := range params {
-			query.Set(k, v)
-		}
-	}
-
 	err := json.NewDecoder(r.Body).Decode(&reqObj)
 	if err != nil {
-		return reqObj, fmt.Errorf("%w: %s", fmt.Errorf("bad request"), err)
+		return reqObj, fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+	}
+
+	if err := bindRequest(ctx, r, &reqObj, false); err != nil {
+		return reqObj, err
 	}
 
-	if err := BindURLQuery(&reqObj, query); err != nil {
+	if err := validateRequest(ctx, &reqObj); err != nil {
 		return reqObj, err
 	}
 
@@ -111,7 +95,7 @@ func CommonFileUploadDecoder[T any, PT FileUploader[T]](ctx context.Context, r *
 		reqObj.AddFile(header.Filename, buf.Bytes(), header.Header.Get("content-type"))
 	}
 
-	if err := BindFormData(reqObj, r.MultipartForm.Value); err != nil {
+	if err := bindData(reqObj, r.MultipartForm.Value, "form"); err != nil {
 		return nil, err
 	}
 
@@ -124,7 +108,11 @@ func CommonFileUploadDecoder[T any, PT FileUploader[T]](ctx context.Context, r *
 		}
 	}
 
-	if err := BindURLQuery(reqObj, query); err != nil {
+	if err := bindData(reqObj, query, "query"); err != nil {
+		return nil, err
+	}
+
+	if err := validateRequest(ctx, reqObj); err != nil {
 		return nil, err
 	}
 
@@ -181,7 +169,7 @@ func CommonFileUploadStreamDecoder[T any, PT FileStreamUploader[T]](ctx context.
 		break
 	}
 
-	if err := BindFormData(reqObj, formData); err != nil {
+	if err := bindData(reqObj, formData, "form"); err != nil {
 		return nil, err
 	}
 
@@ -194,7 +182,11 @@ func CommonFileUploadStreamDecoder[T any, PT FileStreamUploader[T]](ctx context.
 		}
 	}
 
-	if err := BindURLQuery(reqObj, query); err != nil {
+	if err := bindData(reqObj, query, "query"); err != nil {
+		return nil, err
+	}
+
+	if err := validateRequest(ctx, reqObj); err != nil {
 		return nil, err
 	}
 
@@ -212,17 +204,55 @@ func MakeCommonHTTPResponseEncoder(encodeFunc func(context.Context, http.Respons
 	}
 }
 
+// CommonJSONResponseEncoder writes the response as JSON, compressed as the
+// client accepts. Like EncodeJSONResponse, it honors responses implementing
+// Headerer and StatusCoder, such as CreatedResponse and NoContent.
 func CommonJSONResponseEncoder(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	w.Header().Set(gohttp.HeaderContentType, gohttp.HttpContentTypeJson)
-	var gw io.Writer = w
-	if needGzipped(ctx) {
-		w.Header().Set("Content-Encoding", "gzip")
-		gz := gzip.NewWriter(w)
-		defer gz.Close()
-		gw = gz
+	setLastModified(w, response)
+	setLinks(ctx, w, response)
+	code := ResponseStatus(w, response)
+	if code == http.StatusNoContent {
+		w.WriteHeader(code)
+		return nil
 	}
 
-	return json.NewEncoder(gw).Encode(response)
+	body, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	body = append(body, '\n')
+
+	out, _, done := compressWriter(ctx, w, len(body))
+	w.WriteHeader(code)
+	if _, err := out.Write(body); err != nil {
+		done()
+		return err
+	}
+
+	return done()
+}
+
+// EncodeJSONWithStatus writes response as JSON with the given status code,
+// compressed like the responses of CommonJSONResponseEncoder. It suits error
+// encoders sending the same envelope as successful responses.
+func EncodeJSONWithStatus(ctx context.Context, w http.ResponseWriter, status int, response interface{}) error {
+	w.Header().Set(gohttp.HeaderContentType, gohttp.HttpContentTypeJson)
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	body = append(body, '\n')
+
+	out, _, done := compressWriter(ctx, w, len(body))
+	w.WriteHeader(status)
+	if _, err := out.Write(body); err != nil {
+		done()
+		return err
+	}
+
+	return done()
 }
 
 func CommonFileResponseEncoder(ctx context.Context, w http.ResponseWriter, response any) error {
@@ -243,6 +273,16 @@ func CommonFileResponseEncoder(ctx context.Context, w http.ResponseWriter, respo
 	return nil
 }
 
+// validateRequest checks the `validate` tag constraints of the decoded request
+// and then calls its Validate method when it implements api.Validator.
+func validateRequest(ctx context.Context, reqObj interface{}) error {
+	if err := api.ValidateStruct(reqObj, "query", "form", "json"); err != nil {
+		return err
+	}
+
+	return api.Validate(ctx, reqObj)
+}
+
 type requestDecoderOption struct {
 	acceptedFields  map[string]struct{}
 	urlParamsGetter func(context.Context) map[string]string
@@ -258,19 +298,3 @@ func getAcceptFromContext(ctx context.Context) string {
 
 	return ""
 }
-
-func needGzipped(ctx context.Context) bool {
-	val := ctx.Value(ContextKeyRequestAcceptEncoding)
-	enc, ok := val.(string)
-	var gzipped = false
-	if ok {
-		encodings := strings.Split(strings.ToLower(enc), ",")
-		for _, e := range encodings {
-			if strings.TrimSpace(e) == "gzip" {
-				gzipped = true
-			}
-		}
-	}
-
-	return gzipped
-}
@@ -0,0 +1,213 @@
+package http
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Device classes of UserAgentInfo.
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+)
+
+// UserAgentInfo is the client described by a User-Agent header, as parsed by
+// ParseUserAgent. Unknown parts are empty.
+type UserAgentInfo struct {
+	Browser        string `json:"browser,omitempty"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os,omitempty"`
+	OSVersion      string `json:"os_version,omitempty"`
+
+	// Device is one of DeviceDesktop, DeviceMobile, DeviceTablet or
+	// DeviceBot.
+	Device string `json:"device,omitempty"`
+}
+
+// Bot reports whether the client is a crawler or a script.
+func (ua UserAgentInfo) Bot() bool {
+	return ua.Device == DeviceBot
+}
+
+var botMarkers = []string{"bot", "crawler", "spider", "slurp", "curl/", "wget/", "python-requests", "go-http-client", "okhttp", "java/", "headless"}
+
+// browserMarkers lists the tokens of the browsers, the most specific first,
+// since most user agents mention several of them.
+var browserMarkers = []struct {
+	token   string
+	browser string
+}{
+	{"Edg/", "Edge"},
+	{"Edge/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"CriOS/", "Chrome"},
+	{"FxiOS/", "Firefox"},
+	{"Firefox/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"Version/", "Safari"},
+	{"MSIE ", "Internet Explorer"},
+}
+
+var windowsVersions = map[string]string{
+	"10.0": "10",
+	"6.3":  "8.1",
+	"6.2":  "8",
+	"6.1":  "7",
+}
+
+// ParseUserAgent parses the browser, operating system and device class of a
+// User-Agent header, recognizing the common browsers and platforms. It is a
+// heuristic, meant for analytics and security signals, not for serving
+// different content.
+func ParseUserAgent(ua string) UserAgentInfo {
+	var info UserAgentInfo
+	if ua == "" {
+		return info
+	}
+	lower := strings.ToLower(ua)
+
+	for _, marker := range browserMarkers {
+		if version, ok := tokenVersion(ua, marker.token); ok {
+			info.Browser, info.BrowserVersion = marker.browser, version
+			break
+		}
+	}
+	if info.Browser == "" && strings.Contains(ua, "Trident/") {
+		info.Browser = "Internet Explorer"
+		info.BrowserVersion, _ = tokenVersion(ua, "rv:")
+	}
+
+	switch {
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad") || strings.Contains(ua, "iPod"):
+		info.OS = "iOS"
+		if v, ok := tokenVersion(ua, " OS "); ok {
+			info.OSVersion = strings.ReplaceAll(v, "_", ".")
+		}
+	case strings.Contains(ua, "Android"):
+		info.OS = "Android"
+		info.OSVersion, _ = tokenVersion(ua, "Android ")
+	case strings.Contains(ua, "Windows"):
+		info.OS = "Windows"
+		if v, ok := tokenVersion(ua, "Windows NT "); ok {
+			info.OSVersion = windowsVersions[v]
+		}
+	case strings.Contains(ua, "Mac OS X"):
+		info.OS = "macOS"
+		if v, ok := tokenVersion(ua, "Mac OS X "); ok {
+			info.OSVersion = strings.ReplaceAll(v, "_", ".")
+		}
+	case strings.Contains(ua, "CrOS"):
+		info.OS = "ChromeOS"
+	case strings.Contains(ua, "Linux"):
+		info.OS = "Linux"
+	}
+
+	switch {
+	case containsAny(lower, botMarkers):
+		info.Device = DeviceBot
+	case strings.Contains(ua, "iPad") || strings.Contains(lower, "tablet") ||
+		(info.OS == "Android" && !strings.Contains(ua, "Mobile")):
+		info.Device = DeviceTablet
+	case strings.Contains(ua, "Mobi") || strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPod"):
+		info.Device = DeviceMobile
+	default:
+		info.Device = DeviceDesktop
+	}
+
+	return info
+}
+
+// tokenVersion returns the version following token in ua, made of digits,
+// dots and underscores.
+func tokenVersion(ua, token string) (string, bool) {
+	i := strings.Index(ua, token)
+	if i < 0 {
+		return "", false
+	}
+
+	rest := ua[i+len(token):]
+	end := 0
+	for end < len(rest) && (rest[end] >= '0' && rest[end] <= '9' || rest[end] == '.' || rest[end] == '_') {
+		end++
+	}
+	return strings.TrimRight(rest[:end], "._"), true
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// UserAgentIntoContext is a RequestFunc storing the UserAgentInfo of the
+// User-Agent header of the request, for UserAgentFromContext.
+func UserAgentIntoContext(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, ContextKeyUserAgentInfo, ParseUserAgent(r.UserAgent()))
+}
+
+// UserAgentFromContext returns the UserAgentInfo stored by
+// UserAgentIntoContext.
+func UserAgentFromContext(ctx context.Context) (UserAgentInfo, bool) {
+	info, ok := ctx.Value(ContextKeyUserAgentInfo).(UserAgentInfo)
+	return info, ok
+}
+
+// GeoInfo locates the address of a client.
+type GeoInfo struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country, such as "FR".
+	Country string `json:"country,omitempty"`
+
+	// ASN is the number of the autonomous system announcing the address,
+	// and Organization its owner.
+	ASN          uint   `json:"asn,omitempty"`
+	Organization string `json:"organization,omitempty"`
+}
+
+// GeoResolver locates IP addresses, such as with a MaxMind database or a
+// lookup service.
+type GeoResolver interface {
+	Resolve(ctx context.Context, ip net.IP) (GeoInfo, error)
+}
+
+// GeoResolverFunc adapts a function to the GeoResolver interface.
+type GeoResolverFunc func(ctx context.Context, ip net.IP) (GeoInfo, error)
+
+// Resolve implements GeoResolver.
+func (f GeoResolverFunc) Resolve(ctx context.Context, ip net.IP) (GeoInfo, error) {
+	return f(ctx, ip)
+}
+
+// MakeGeoIPIntoContext returns a RequestFunc storing the GeoInfo of the
+// client address, the first address of the X-Forwarded-For header or the
+// remote address, as located by resolver, for GeoFromContext. Nothing is
+// stored when the address can't be parsed or located, so the request is
+// served anyway.
+func MakeGeoIPIntoContext(resolver GeoResolver) RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		ip := net.ParseIP(clientIP(r.Header.Get(HeaderXForwardedFor), r.RemoteAddr))
+		if ip == nil {
+			return ctx
+		}
+
+		info, err := resolver.Resolve(ctx, ip)
+		if err != nil {
+			return ctx
+		}
+		return context.WithValue(ctx, ContextKeyGeoInfo, info)
+	}
+}
+
+// GeoFromContext returns the GeoInfo stored by MakeGeoIPIntoContext.
+func GeoFromContext(ctx context.Context) (GeoInfo, bool) {
+	info, ok := ctx.Value(ContextKeyGeoInfo).(GeoInfo)
+	return info, ok
+}
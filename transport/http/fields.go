@@ -0,0 +1,184 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// FieldsIntoContext is a RequestFunc storing the fields selected by the
+// fields query param, such as ?fields=id,name,owner.email, in the context, for
+// MakeFieldSelectingEncoder.
+func FieldsIntoContext(ctx context.Context, r *http.Request) context.Context {
+	var fields []string
+	for _, v := range r.URL.Query()["fields"] {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				fields = append(fields, f)
+			}
+		}
+	}
+	if len(fields) == 0 {
+		return ctx
+	}
+
+	return context.WithValue(ctx, ContextKeyFields, fields)
+}
+
+// FieldsFromContext returns the fields stored by FieldsIntoContext.
+func FieldsFromContext(ctx context.Context) ([]string, bool) {
+	fields, ok := ctx.Value(ContextKeyFields).([]string)
+	return fields, ok && len(fields) > 0
+}
+
+// MakeFieldSelectingEncoder returns an EncodeResponseFunc encoding responses
+// with next, then pruning the JSON payload to the fields stored in the
+// context by FieldsIntoContext, if any. Fields are dot paths, owner.email
+// keeping only the email of the owner object, and apply to every element of
+// arrays. root is the dot path of the payload in the body, such as "data"
+// for the envelope of apikit.SuccessResponse, whose other members are kept;
+// an empty root selects among the members of the body itself. Bodies which
+// aren't JSON objects or arrays are sent as is.
+func MakeFieldSelectingEncoder[T any](next EncodeResponseFunc[T], root string) EncodeResponseFunc[T] {
+	return func(ctx context.Context, w http.ResponseWriter, response T) error {
+		fields, ok := FieldsFromContext(ctx)
+		if !ok {
+			return next(ctx, w, response)
+		}
+
+		// next encodes into a buffer, uncompressed, and the selected body is
+		// compressed once pruned
+		bw := &fieldsWriter{ResponseWriter: w, status: http.StatusOK}
+		if err := next(context.WithValue(ctx, ContextKeyRequestAcceptEncoding, ""), bw, response); err != nil {
+			return err
+		}
+		vary := w.Header().Values(HeaderVary)
+		w.Header().Del(HeaderVary)
+		for _, v := range vary {
+			if v != HeaderAcceptEncoding {
+				w.Header().Add(HeaderVary, v)
+			}
+		}
+
+		body := bw.buf.Bytes()
+		if strings.Contains(w.Header().Get(HeaderContentType), "json") {
+			if selected, err := SelectFields(body, root, fields); err == nil {
+				body = selected
+			}
+		}
+		w.Header().Del(HeaderContentLength)
+
+		out, _, done := compressWriter(ctx, w, len(body))
+		w.WriteHeader(bw.status)
+		if _, err := out.Write(body); err != nil {
+			done()
+			return err
+		}
+
+		return done()
+	}
+}
+
+// fieldsWriter buffers the body and status code written to it.
+type fieldsWriter struct {
+	http.ResponseWriter
+	buf    bytes.Buffer
+	status int
+}
+
+func (w *fieldsWriter) WriteHeader(code int) { w.status = code }
+
+func (w *fieldsWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+
+// fieldTree is a selection of fields, a nil subtree selecting the whole
+// value of the field.
+type fieldTree map[string]fieldTree
+
+func newFieldTree(fields []string) fieldTree {
+	tree := make(fieldTree)
+	for _, f := range fields {
+		t := tree
+		parts := strings.Split(f, ".")
+		for i, part := range parts {
+			sub, ok := t[part]
+			if ok && sub == nil {
+				// the whole field is already selected
+				break
+			}
+			if i == len(parts)-1 {
+				t[part] = nil
+				break
+			}
+			if !ok {
+				sub = make(fieldTree)
+				t[part] = sub
+			}
+			t = sub
+		}
+	}
+	return tree
+}
+
+// SelectFields prunes the JSON document data to fields, as described by
+// MakeFieldSelectingEncoder. The members of objects are sorted by name.
+func SelectFields(data []byte, root string, fields []string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	tree := newFieldTree(fields)
+	if root == "" {
+		doc = selectFields(doc, tree)
+	} else {
+		parent, ok := doc.(map[string]interface{})
+		path := strings.Split(root, ".")
+		for _, key := range path[:len(path)-1] {
+			if !ok {
+				break
+			}
+			parent, ok = parent[key].(map[string]interface{})
+		}
+		if ok {
+			if v, exists := parent[path[len(path)-1]]; exists {
+				parent[path[len(path)-1]] = selectFields(v, tree)
+			}
+		}
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+func selectFields(v interface{}, tree fieldTree) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		selected := make(map[string]interface{}, len(tree))
+		for name, sub := range tree {
+			value, ok := v[name]
+			if !ok {
+				continue
+			}
+			if sub != nil {
+				value = selectFields(value, sub)
+			}
+			selected[name] = value
+		}
+		return selected
+	case []interface{}:
+		for i := range v {
+			v[i] = selectFields(v[i], tree)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,161 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// HALLinker may be implemented by responses to add links computed at
+// runtime to the _links of their HAL representation, by relation.
+type HALLinker interface {
+	HALLinks() map[string]string
+}
+
+type halLink struct {
+	Href string `json:"href"`
+}
+
+// EncodeHALResponse is an EncodeResponseFunc writing the response as a HAL
+// document, with the application/hal+json content type. The fields of the
+// response are encoded with their json tags, but for those carrying a `hal`
+// tag:
+//
+//	type Order struct {
+//		ID       string  `json:"id"`
+//		Self     string  `json:"-" hal:"link,self"`
+//		Customer string  `json:"-" hal:"link,customer"`
+//		Items    []Item  `json:"items" hal:"embedded"`
+//	}
+//
+// Link fields are moved to _links, under their relation, unless empty, and
+// embedded fields to _embedded, under their JSON name or the relation given
+// in the tag, as HAL representations themselves. The links returned by
+// HALLinker are added to _links. A slice response is represented as a
+// resource embedding its elements under "items". Errors of HAL APIs are
+// usually sent with ProblemDetailsErrorEncoder.
+func EncodeHALResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	v := indirect(reflect.ValueOf(response))
+
+	var (
+		doc interface{}
+		err error
+	)
+	if v.IsValid() && (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) {
+		var items interface{}
+		if items, err = halRepresentation(v); err == nil {
+			doc = map[string]interface{}{"_embedded": map[string]interface{}{"items": items}}
+		}
+	} else {
+		doc, err = halRepresentation(v)
+	}
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	body = append(body, '\n')
+
+	w.Header().Set(HeaderContentType, HttpContentTypeHAL)
+	setLastModified(w, response)
+	setLinks(ctx, w, response)
+
+	out, _, done := compressWriter(ctx, w, len(body))
+	if _, err := out.Write(body); err != nil {
+		done()
+		return err
+	}
+
+	return done()
+}
+
+// halRepresentation returns the HAL representation of a struct, or of the
+// elements of a slice of structs. Other values are represented as is.
+func halRepresentation(v reflect.Value) (interface{}, error) {
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		items := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item, err := halRepresentation(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case reflect.Struct:
+	default:
+		return v.Interface(), nil
+	}
+
+	raw, err := json.Marshal(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		// a struct encoding itself as something else than an object
+		return json.RawMessage(raw), nil
+	}
+
+	links := make(map[string]halLink)
+	embedded := make(map[string]interface{})
+	for _, f := range tagFields(v, "hal") {
+		name := jsonFieldName(f.field)
+		delete(doc, name)
+
+		switch f.opts[0] {
+		case "link":
+			if len(f.opts) < 2 {
+				return nil, fmt.Errorf("hal: link field %s has no relation", f.field.Name)
+			}
+			if href := indirect(f.value); href.IsValid() && !href.IsZero() {
+				links[f.opts[1]] = halLink{Href: fmt.Sprint(href.Interface())}
+			}
+
+		case "embedded":
+			rel := name
+			if len(f.opts) > 1 && f.opts[1] != "" {
+				rel = f.opts[1]
+			}
+			res, err := halRepresentation(f.value)
+			if err != nil {
+				return nil, err
+			}
+			if res != nil {
+				embedded[rel] = res
+			}
+		}
+	}
+
+	if linker, ok := v.Interface().(HALLinker); ok {
+		for rel, href := range linker.HALLinks() {
+			links[rel] = halLink{Href: href}
+		}
+	} else if v.CanAddr() {
+		if linker, ok := v.Addr().Interface().(HALLinker); ok {
+			for rel, href := range linker.HALLinks() {
+				links[rel] = halLink{Href: href}
+			}
+		}
+	}
+
+	if len(links) > 0 {
+		doc["_links"] = links
+	}
+	if len(embedded) > 0 {
+		doc["_embedded"] = embedded
+	}
+
+	return doc, nil
+}
@@ -0,0 +1,331 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/internal/storeutil"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyError is written by MakeHttpIdempotencyMiddleware for rejected
+// retries. It reports a 409 status code for api.ErrIdempotencyInFlight and a
+// 422 status code for api.ErrIdempotencyKeyReused.
+type IdempotencyError struct {
+	Err error
+}
+
+func (e *IdempotencyError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *IdempotencyError) Unwrap() error {
+	return e.Err
+}
+
+func (e *IdempotencyError) StatusCode() int {
+	if errors.Is(e.Err, api.ErrIdempotencyKeyReused) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusConflict
+}
+
+// IdempotentResponse is a response recorded by MakeHttpIdempotencyMiddleware.
+// Fingerprint identifies the request it answered.
+type IdempotentResponse struct {
+	Fingerprint string      `json:"fingerprint"`
+	StatusCode  int         `json:"status_code"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+}
+
+// IdempotencyStore persists the responses of idempotent requests.
+// Implementations must be safe for concurrent use.
+type IdempotencyStore interface {
+	// Begin reserves key for a new request for ttl, the lock TTL, and
+	// returns nil. When key is already reserved, it returns the recorded
+	// response, or api.ErrIdempotencyInFlight while the request is still
+	// being processed.
+	Begin(ctx context.Context, key, fingerprint string, ttl time.Duration) (*IdempotentResponse, error)
+
+	// Complete records the response of the request that reserved key.
+	Complete(ctx context.Context, key string, res *IdempotentResponse, ttl time.Duration) error
+
+	// Release drops the reservation of key, so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+type idempotencyOption struct {
+	ttl     time.Duration
+	lockTTL time.Duration
+	maxBody int64
+	methods map[string]bool
+	scope   func(r *http.Request) string
+}
+
+// IdempotencyOption sets an optional parameter for
+// MakeHttpIdempotencyMiddleware.
+type IdempotencyOption func(opt *idempotencyOption)
+
+// IdempotencyTTL sets how long responses are kept for replay. Defaults to 24
+// hours.
+func IdempotencyTTL(d time.Duration) IdempotencyOption {
+	return func(opt *idempotencyOption) { opt.ttl = d }
+}
+
+// IdempotencyLockTTL sets how long a key is reserved for the request in
+// progress, after which a retry is processed again, in case the instance
+// handling the request crashed. It should exceed the duration of the longest
+// requests. Defaults to 1 minute.
+func IdempotencyLockTTL(d time.Duration) IdempotencyOption {
+	return func(opt *idempotencyOption) { opt.lockTTL = d }
+}
+
+// IdempotencyMaxBody limits the bodies of the requests with an idempotency
+// key, which are read to fingerprint them, to n bytes. Larger bodies fail
+// with a *RequestTooLargeError. Defaults to 1 MiB.
+func IdempotencyMaxBody(n int64) IdempotencyOption {
+	return func(opt *idempotencyOption) { opt.maxBody = n }
+}
+
+// IdempotencyMethods sets the request methods the Idempotency-Key header is
+// honored for. Defaults to POST and PATCH.
+func IdempotencyMethods(methods ...string) IdempotencyOption {
+	return func(opt *idempotencyOption) {
+		opt.methods = make(map[string]bool)
+		for _, m := range methods {
+			opt.methods[m] = true
+		}
+	}
+}
+
+// IdempotencyScope prefixes the idempotency keys with the value returned by fn,
+// for instance the authenticated caller, so clients can't replay each other's
+// responses.
+func IdempotencyScope(fn func(r *http.Request) string) IdempotencyOption {
+	return func(opt *idempotencyOption) { opt.scope = fn }
+}
+
+// MakeHttpIdempotencyMiddleware returns an http middleware honoring the
+// Idempotency-Key request header. The response to the first request with a
+// key is recorded in store and replayed, with an Idempotent-Replayed header,
+// to retries with the same key. Retries arriving while the first request is
+// in progress get a 409 response, and requests reusing the key of a different
+// request a 422 response. Server errors are not recorded, so they can be
+// retried. Keys are reserved for the lock TTL while their request is in
+// progress, and keep their response for the TTL.
+func MakeHttpIdempotencyMiddleware(store IdempotencyStore, options ...IdempotencyOption) func(http.Handler) http.Handler {
+	opts := idempotencyOption{
+		ttl:     24 * time.Hour,
+		lockTTL: time.Minute,
+		maxBody: 1 << 20,
+		methods: map[string]bool{http.MethodPost: true, http.MethodPatch: true},
+	}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			key := r.Header.Get(HeaderIdempotencyKey)
+			if key == "" || !opts.methods[r.Method] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > maxIdempotencyKeyLength {
+				DefaultErrorEncoder(ctx, fmt.Errorf("%w: idempotency key too long", api.ErrBadRequest), w)
+				return
+			}
+
+			if opts.scope != nil {
+				key = opts.scope(r) + ":" + key
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, opts.maxBody))
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					err = &RequestTooLargeError{Limit: opts.maxBody}
+				} else {
+					err = fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+				}
+				DefaultErrorEncoder(ctx, err, w)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			fingerprint := requestFingerprint(r, body)
+			res, err := store.Begin(ctx, key, fingerprint, opts.lockTTL)
+			if err != nil {
+				if errors.Is(err, api.ErrIdempotencyInFlight) {
+					err = &IdempotencyError{Err: err}
+				}
+				DefaultErrorEncoder(ctx, err, w)
+				return
+			}
+
+			if res != nil {
+				if res.Fingerprint != fingerprint {
+					DefaultErrorEncoder(ctx, &IdempotencyError{Err: api.ErrIdempotencyKeyReused}, w)
+					return
+				}
+				replayResponse(w, res)
+				return
+			}
+
+			// the outcome is recorded even when the client is gone, or the
+			// key would stay reserved until it expires
+			storeCtx := api.WithoutCancel(ctx)
+
+			rec := &idempotencyRecorder{ResponseWriter: w, code: http.StatusOK}
+			completed := false
+			defer func() {
+				if !completed {
+					// the handler panicked: let the client retry
+					_ = store.Release(storeCtx, key)
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+
+			if rec.code >= http.StatusInternalServerError {
+				_ = store.Release(storeCtx, key)
+			} else {
+				_ = store.Complete(storeCtx, key, &IdempotentResponse{
+					Fingerprint: fingerprint,
+					StatusCode:  rec.code,
+					Header:      w.Header().Clone(),
+					Body:        rec.body.Bytes(),
+				}, opts.ttl)
+			}
+			completed = true
+		})
+	}
+}
+
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method)
+	io.WriteString(h, " ")
+	io.WriteString(h, r.URL.RequestURI())
+	io.WriteString(h, "\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replayResponse(w http.ResponseWriter, res *IdempotentResponse) {
+	for k, values := range res.Header {
+		w.Header()[k] = append([]string(nil), values...)
+	}
+	w.Header().Set(HeaderIdempotentReplayed, "true")
+	w.WriteHeader(res.StatusCode)
+	w.Write(res.Body)
+}
+
+// idempotencyRecorder writes the response through while keeping a copy.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *idempotencyRecorder) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *idempotencyRecorder) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *idempotencyRecorder) Flush() {
+	if fl, ok := w.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
+// MemoryIdempotencyStore is an in-process IdempotencyStore. Expired keys are
+// evicted periodically.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	now     func() time.Time
+	sweeper storeutil.Sweeper
+}
+
+type idempotencyEntry struct {
+	res     *IdempotentResponse
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore creates an empty MemoryIdempotencyStore.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		entries: make(map[string]*idempotencyEntry),
+		now:     time.Now,
+	}
+}
+
+// Begin implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Begin(_ context.Context, key, _ string, ttl time.Duration) (*IdempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	if entry, ok := s.entries[key]; ok && now.Before(entry.expires) {
+		if entry.res == nil {
+			return nil, api.ErrIdempotencyInFlight
+		}
+		return entry.res, nil
+	}
+
+	s.entries[key] = &idempotencyEntry{expires: now.Add(ttl)}
+	return nil, nil
+}
+
+// Complete implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, res *IdempotentResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = &idempotencyEntry{res: res, expires: s.now().Add(ttl)}
+	return nil
+}
+
+// Release implements IdempotencyStore.
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if !s.sweeper.Due(now) {
+		return
+	}
+
+	storeutil.DeleteExpired(s.entries, now, func(entry *idempotencyEntry) time.Time { return entry.expires })
+}
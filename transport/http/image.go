@@ -0,0 +1,282 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// maxImagePixels bounds the images ImageTransformers decode, so a small
+// upload declaring huge dimensions can't exhaust memory.
+const maxImagePixels = 50 * 1000 * 1000
+
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// ImageTransformer transforms an uploaded image of the given content type,
+// returning the new content and its content type. Transformers are set per
+// form field with DecoderImageTransformers.
+type ImageTransformer func(ctx context.Context, r io.Reader, contentType string) (io.Reader, string, error)
+
+// ResizeImage returns an ImageTransformer scaling JPEG, PNG and GIF images
+// down, keeping their aspect ratio, to fit within maxWidth x maxHeight; a
+// bound lower than 1 is not enforced. Smaller images are left untouched.
+// Resized images keep their format, though animated GIFs keep their first
+// frame only.
+func ResizeImage(maxWidth, maxHeight int) ImageTransformer {
+	return func(ctx context.Context, r io.Reader, contentType string) (io.Reader, string, error) {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, "", err
+		}
+
+		img, format, err := decodeImage(data)
+		if err != nil {
+			return nil, "", err
+		}
+
+		b := img.Bounds()
+		w, h := fitImage(b.Dx(), b.Dy(), maxWidth, maxHeight)
+		if w == b.Dx() && h == b.Dy() {
+			return bytes.NewReader(data), contentType, nil
+		}
+
+		return encodeImage(scaleImage(img, w, h), "image/"+format, 90)
+	}
+}
+
+// ReencodeImage returns an ImageTransformer converting JPEG, PNG and GIF
+// images to contentType, "image/jpeg" with the given quality (1 to 100) or
+// "image/png". Re-encoding also drops any metadata the image carried.
+func ReencodeImage(contentType string, quality int) ImageTransformer {
+	return func(ctx context.Context, r io.Reader, _ string) (io.Reader, string, error) {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, "", err
+		}
+
+		img, _, err := decodeImage(data)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return encodeImage(img, contentType, quality)
+	}
+}
+
+// StripEXIF returns an ImageTransformer removing the EXIF, XMP and comment
+// metadata of JPEG and PNG images, which may reveal where and with what
+// device a photo was taken, without re-encoding them. Photos relying on their
+// EXIF orientation are then shown unrotated. Other images are left untouched.
+func StripEXIF() ImageTransformer {
+	return func(ctx context.Context, r io.Reader, contentType string) (io.Reader, string, error) {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, "", err
+		}
+
+		switch contentType {
+		case "image/jpeg":
+			data, err = stripJPEGMetadata(data)
+		case "image/png":
+			data, err = stripPNGMetadata(data)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		return bytes.NewReader(data), contentType, nil
+	}
+}
+
+func decodeImage(data []byte) (image.Image, string, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid image: %w", err)
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return nil, "", fmt.Errorf("image of %dx%d pixels is too large", cfg.Width, cfg.Height)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid image: %w", err)
+	}
+
+	return img, format, nil
+}
+
+func encodeImage(img image.Image, contentType string, quality int) (io.Reader, string, error) {
+	var buf bytes.Buffer
+
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case "image/png":
+		err = png.Encode(&buf, img)
+	case "image/gif":
+		err = gif.Encode(&buf, img, nil)
+	default:
+		return nil, "", fmt.Errorf("can't encode images to %s", contentType)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &buf, contentType, nil
+}
+
+// fitImage returns the size of a w x h image scaled down to fit within
+// maxWidth x maxHeight.
+func fitImage(w, h, maxWidth, maxHeight int) (int, int) {
+	scale := 1.0
+	if maxWidth > 0 && w > maxWidth {
+		scale = float64(maxWidth) / float64(w)
+	}
+	if maxHeight > 0 && h > maxHeight && float64(maxHeight)/float64(h) < scale {
+		scale = float64(maxHeight) / float64(h)
+	}
+	if scale == 1 {
+		return w, h
+	}
+
+	nw, nh := int(float64(w)*scale+0.5), int(float64(h)*scale+0.5)
+	if nw < 1 {
+		nw = 1
+	}
+	if nh < 1 {
+		nh = 1
+	}
+
+	return nw, nh
+}
+
+// scaleImage scales img down to w x h, averaging the source pixels covered by
+// each destination pixel.
+func scaleImage(img image.Image, w, h int) image.Image {
+	b := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, (y+1)*sh/h
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, (x+1)*sw/w
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+
+			n := (x1 - x0) * (y1 - y0)
+			px := dst.Pix[y*dst.Stride+x*4:]
+			for i := range sum {
+				px[i] = uint8(sum[i] / n)
+			}
+		}
+	}
+
+	return dst
+}
+
+var errInvalidJPEG = errors.New("invalid image: malformed jpeg")
+
+// stripJPEGMetadata drops the APP1 to APP13 and APP15 segments, holding EXIF,
+// XMP and other metadata, and the comment segments of a JPEG image. APP0
+// (JFIF) and APP14 (Adobe), which affect decoding, are kept.
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, errInvalidJPEG
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+
+	for i := 2; ; {
+		if i+4 > len(data) || data[i] != 0xff {
+			return nil, errInvalidJPEG
+		}
+
+		marker := data[i+1]
+		if marker == 0xff {
+			// fill byte
+			i++
+			continue
+		}
+		if marker == 0xda {
+			// start of scan: the compressed image data follows
+			return append(out, data[i:]...), nil
+		}
+
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) {
+			return nil, errInvalidJPEG
+		}
+
+		keep := marker != 0xfe && (marker < 0xe1 || marker > 0xef || marker == 0xee)
+		if keep {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// stripPNGMetadata drops the textual, EXIF and timestamp chunks of a PNG
+// image.
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("invalid image: malformed png")
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+
+	for i := len(pngSignature); i < len(data); {
+		if i+12 > len(data) {
+			return nil, errors.New("invalid image: malformed png")
+		}
+
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) || end < i {
+			return nil, errors.New("invalid image: malformed png")
+		}
+
+		switch string(data[i+4 : i+8]) {
+		case "tEXt", "zTXt", "iTXt", "eXIf", "tIME":
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+
+	return out, nil
+}
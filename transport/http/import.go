@@ -0,0 +1,431 @@
+package http
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/apierror"
+)
+
+// ImportRequest is the request of the endpoint made by MakeImportEndpoint:
+// the CSV or XLSX file uploaded, streamed by the decoder of
+// MakeImportDecoder.
+type ImportRequest struct {
+	FileStreamPayload
+}
+
+// ImportReport is the response of the endpoint made by MakeImportEndpoint.
+// Total counts the rows processed, Accepted those imported, and Rejected
+// lists the others, in the order of the file. Aborted is set when the import
+// stopped after ImportMaxErrors rejected rows, the rows following them being
+// left out.
+type ImportReport struct {
+	Total    int              `json:"total"`
+	Accepted int              `json:"accepted"`
+	Rejected []ImportRowError `json:"rejected"`
+	Aborted  bool             `json:"aborted,omitempty"`
+}
+
+// ImportRowError is a row rejected by the endpoint made by
+// MakeImportEndpoint. Row is the line of the row in CSV files, and its row
+// number in XLSX sheets, the header being at 1. Fields holds the field
+// errors of the rows failing validation. The reasons of server errors are
+// not disclosed, like in the error encoders.
+type ImportRowError struct {
+	Row    int              `json:"row"`
+	Reason string           `json:"reason"`
+	Fields []api.FieldError `json:"fields,omitempty"`
+}
+
+type importOption struct {
+	concurrency int
+	maxRows     int
+	maxErrors   int
+	tag         string
+	comma       rune
+	timeFormat  string
+}
+
+// ImportOption sets an optional parameter for MakeImportEndpoint.
+type ImportOption func(opt *importOption)
+
+// ImportConcurrency sets the number of rows imported concurrently. Defaults
+// to 4.
+func ImportConcurrency(n int) ImportOption {
+	return func(opt *importOption) { opt.concurrency = n }
+}
+
+// ImportMaxRows sets the maximum number of rows of a file. Files with more
+// rows fail with api.ErrBadRequest once the limit is reached, the rows before
+// it having been imported. Defaults to no limit.
+func ImportMaxRows(n int) ImportOption {
+	return func(opt *importOption) { opt.maxRows = n }
+}
+
+// ImportMaxErrors stops the import once n rows were rejected, such as to
+// give up on a file in the wrong layout early. Defaults to no limit.
+func ImportMaxErrors(n int) ImportOption {
+	return func(opt *importOption) { opt.maxErrors = n }
+}
+
+// ImportHeaderTag sets the struct tag matching the columns of the header row
+// to the fields of the rows. Defaults to "xlsx", as for
+// MakeXLSXResponseEncoder, so exported files can be imported back. Fields
+// without the tag are matched by their Go name.
+func ImportHeaderTag(tag string) ImportOption {
+	return func(opt *importOption) { opt.tag = tag }
+}
+
+// ImportCSVComma sets the field delimiter of CSV files. Defaults to ','.
+func ImportCSVComma(r rune) ImportOption {
+	return func(opt *importOption) { opt.comma = r }
+}
+
+// ImportTimeFormat sets the layout of the dates of XLSX cells formatted as
+// dates, which are stored as numbers. Defaults to time.RFC3339, which
+// time.Time fields parse without a `format` tag.
+func ImportTimeFormat(layout string) ImportOption {
+	return func(opt *importOption) { opt.timeFormat = layout }
+}
+
+// MakeImportDecoder returns a DecodeRequestFunc streaming the CSV or XLSX
+// file of a multipart form into an ImportRequest, with MakeMultipartDecoder,
+// only accepting the .csv and .xlsx extensions.
+func MakeImportDecoder(options ...DecoderOption) DecodeRequestFunc[ImportRequest] {
+	options = append([]DecoderOption{DecoderAllowedExtensions(".csv", ".xlsx")}, options...)
+	return MakeMultipartDecoder[ImportRequest](options...)
+}
+
+// MakeImportEndpoint returns an Endpoint importing the rows of a CSV file or
+// of the first sheet of an XLSX workbook, such as an admin upload of users.
+// The first row is the header, naming the fields of T its columns are bound
+// to, like form values. Each following row is bound to a T, validated, and
+// passed to row, with up to ImportConcurrency rows at once; blank rows are
+// skipped. Rows failing are reported in the ImportReport rather than failing
+// the import, which only fails for files which can't be read.
+//
+//	r.Post("/users/import", httptransport.NewServer(
+//		httptransport.MakeImportEndpoint(createUser),
+//		httptransport.MakeImportDecoder(httptransport.DecoderMaxFileSize(10<<20)),
+//		httptransport.EncodeJSONResponse,
+//	))
+func MakeImportEndpoint[T, O any](row api.Endpoint[T, O], options ...ImportOption) api.Endpoint[ImportRequest, ImportReport] {
+	opts := &importOption{
+		concurrency: 4,
+		tag:         "xlsx",
+		comma:       ',',
+		timeFormat:  time.RFC3339,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	if opts.concurrency < 1 {
+		opts.concurrency = 1
+	}
+
+	return func(ctx context.Context, request ImportRequest) (ImportReport, error) {
+		if request.Reader == nil {
+			return ImportReport{}, fmt.Errorf("%w: no file uploaded", api.ErrBadRequest)
+		}
+		defer request.Reader.Close()
+
+		rows, err := opts.rowReader(request.FileStreamPayload)
+		if err != nil {
+			return ImportReport{}, err
+		}
+		defer rows.Close()
+
+		var header []string
+		for header == nil {
+			_, record, err := rows.Read()
+			if err == io.EOF {
+				return ImportReport{}, fmt.Errorf("%w: the file has no header row", api.ErrBadRequest)
+			}
+			if err != nil {
+				return ImportReport{}, importReadError(err)
+			}
+			if !blankRecord(record) {
+				header = importHeader(record)
+			}
+		}
+
+		return importRows(ctx, rows, header, row, opts)
+	}
+}
+
+type importRow struct {
+	n      int
+	record []string
+}
+
+// rowSource reads the rows of an imported file.
+type rowSource interface {
+	Read() (int, []string, error)
+	Close() error
+}
+
+func importRows[T, O any](parent context.Context, rows rowSource, header []string, ep api.Endpoint[T, O], opts *importOption) (ImportReport, error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var (
+		report ImportReport
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+	)
+	reject := func(rerr ImportRowError) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		report.Rejected = append(report.Rejected, rerr)
+		if opts.maxErrors > 0 && len(report.Rejected) >= opts.maxErrors && !report.Aborted {
+			report.Aborted = true
+			cancel()
+		}
+	}
+
+	jobs := make(chan importRow)
+	wg.Add(opts.concurrency)
+	for i := 0; i < opts.concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				// rows received as the import was aborted are left out
+				if ctx.Err() != nil {
+					continue
+				}
+				if rerr := importRecord(ctx, ep, opts, header, job); rerr != nil {
+					reject(*rerr)
+					continue
+				}
+				mu.Lock()
+				report.Accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var (
+		readErr error
+		n       int
+	)
+read:
+	for {
+		line, record, err := rows.Read()
+		if err == io.EOF {
+			break
+		}
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			reject(ImportRowError{Row: perr.StartLine, Reason: perr.Err.Error()})
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		if err != nil {
+			readErr = importReadError(err)
+			break
+		}
+		if blankRecord(record) {
+			continue
+		}
+
+		if n++; opts.maxRows > 0 && n > opts.maxRows {
+			readErr = fmt.Errorf("%w: the file has more than %d rows", api.ErrBadRequest, opts.maxRows)
+			break
+		}
+
+		select {
+		case jobs <- importRow{n: line, record: record}:
+		case <-ctx.Done():
+			break read
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if readErr != nil {
+		return ImportReport{}, readErr
+	}
+	if err := parent.Err(); err != nil {
+		return ImportReport{}, err
+	}
+
+	sort.Slice(report.Rejected, func(i, j int) bool {
+		return report.Rejected[i].Row < report.Rejected[j].Row
+	})
+	if report.Rejected == nil {
+		report.Rejected = []ImportRowError{}
+	}
+	report.Total = report.Accepted + len(report.Rejected)
+
+	return report, nil
+}
+
+// importRecord binds, validates and imports a row, returning its error.
+func importRecord[T, O any](ctx context.Context, ep api.Endpoint[T, O], opts *importOption, header []string, row importRow) *ImportRowError {
+	data := make(map[string][]string)
+	for i, name := range header {
+		if name == "" || i >= len(row.record) {
+			continue
+		}
+		if value := strings.TrimSpace(row.record[i]); value != "" {
+			data[name] = append(data[name], value)
+		}
+	}
+
+	var item T
+	err := bindData(&item, data, opts.tag)
+	if err == nil {
+		err = api.ValidateStruct(&item, opts.tag)
+	}
+	if err == nil {
+		err = api.Validate(ctx, &item)
+	}
+	if err == nil {
+		_, err = ep(ctx, item)
+	}
+	if err == nil {
+		return nil
+	}
+
+	rerr := &ImportRowError{Row: row.n, Reason: importReason(err)}
+	var verr *api.ValidationError
+	if errors.As(err, &verr) {
+		rerr.Fields = verr.Fields
+	}
+	return rerr
+}
+
+// importReason returns the message of err, unless it is a server error.
+func importReason(err error) string {
+	if aerr := apierror.From(err); aerr != nil {
+		return aerr.Message
+	}
+
+	status := http.StatusInternalServerError
+	var sc StatusCoder
+	if errors.As(err, &sc) {
+		status = sc.StatusCode()
+	}
+	if s, ok := apierror.DefaultStatusMapper.Status(err); ok {
+		status = s
+	}
+
+	if status < http.StatusInternalServerError {
+		return err.Error()
+	}
+	return http.StatusText(status)
+}
+
+// rowReader returns the reader of the rows of file, a CSV or XLSX file
+// according to its extension, or its content type.
+func (opts *importOption) rowReader(file FileStreamPayload) (rowSource, error) {
+	ext := strings.ToLower(path.Ext(file.FileName))
+	switch {
+	case ext == ".xlsx" || ext == "" && strings.HasPrefix(file.ContentType, HttpContentTypeXLSX):
+		return openXLSXRows(file.Reader, opts.timeFormat)
+	case ext == ".csv" || ext == "" && strings.HasPrefix(file.ContentType, HttpContentTypeCsv):
+		r := csv.NewReader(file.Reader)
+		r.Comma = opts.comma
+		r.FieldsPerRecord = -1
+		return &csvRows{r: r}, nil
+	}
+
+	return nil, &UploadError{Filename: file.FileName, Reason: "only CSV and XLSX files can be imported"}
+}
+
+type csvRows struct {
+	r *csv.Reader
+}
+
+func (c *csvRows) Read() (int, []string, error) {
+	record, err := c.r.Read()
+	if err != nil {
+		return 0, nil, err
+	}
+	line, _ := c.r.FieldPos(0)
+	return line, record, nil
+}
+
+func (c *csvRows) Close() error {
+	return nil
+}
+
+// openXLSXRows opens the workbook read from r, which is buffered in a
+// temporary file since workbooks are zip archives, read out of order.
+func openXLSXRows(r io.Reader, timeFormat string) (rowSource, error) {
+	tmp, err := os.CreateTemp("", "import-*.xlsx")
+	if err != nil {
+		return nil, err
+	}
+	f := &tempFile{File: tmp}
+
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		f.Close()
+		return nil, importReadError(err)
+	}
+
+	x, err := newXLSXReader(tmp, size, timeFormat)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%w: invalid XLSX file: %s", api.ErrBadRequest, err)
+	}
+
+	return &xlsxRows{xlsxReader: x, file: f}, nil
+}
+
+type xlsxRows struct {
+	*xlsxReader
+	file *tempFile
+}
+
+func (x *xlsxRows) Close() error {
+	x.xlsxReader.Close()
+	return x.file.Close()
+}
+
+// importReadError reports the errors reading a file as api.ErrBadRequest,
+// the errors of the upload itself, such as an *UploadError, aside.
+func importReadError(err error) error {
+	var sc StatusCoder
+	if errors.As(err, &sc) || errors.Is(err, api.ErrBadRequest) {
+		return err
+	}
+	return fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+}
+
+// importHeader returns the names of the columns of the header row, without
+// the byte order mark of the files saved by Excel.
+func importHeader(record []string) []string {
+	header := make([]string, len(record))
+	for i, name := range record {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		header[i] = strings.TrimSpace(name)
+	}
+	return header
+}
+
+func blankRecord(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
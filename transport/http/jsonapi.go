@@ -0,0 +1,361 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/apierror"
+)
+
+// JSONAPIDocument is a JSON:API top-level document, for responses carrying
+// meta or links besides their primary data, such as pagination.
+type JSONAPIDocument struct {
+	Data  interface{}
+	Meta  map[string]interface{}
+	Links map[string]string
+}
+
+type jsonapiIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type jsonapiRelationship struct {
+	Data interface{} `json:"data"`
+}
+
+type jsonapiResource struct {
+	Type          string                         `json:"type"`
+	ID            string                         `json:"id,omitempty"`
+	Attributes    map[string]json.RawMessage     `json:"attributes,omitempty"`
+	Relationships map[string]jsonapiRelationship `json:"relationships,omitempty"`
+}
+
+type jsonapiError struct {
+	Status string                 `json:"status"`
+	Code   string                 `json:"code,omitempty"`
+	Title  string                 `json:"title"`
+	Detail string                 `json:"detail,omitempty"`
+	Source map[string]string      `json:"source,omitempty"`
+	Meta   map[string]interface{} `json:"meta,omitempty"`
+}
+
+// EncodeJSONAPIResponse is an EncodeResponseFunc writing the response as a
+// JSON:API document, with the application/vnd.api+json content type. The
+// response, a struct, a slice of structs, or a *JSONAPIDocument holding
+// them, is converted into resources driven by the `jsonapi` tags of its
+// fields:
+//
+//	type Article struct {
+//		ID       string    `json:"id" jsonapi:"primary,articles"`
+//		Title    string    `json:"title"`
+//		Author   *Person   `json:"author" jsonapi:"relation"`
+//		Comments []Comment `json:"comments" jsonapi:"relation"`
+//	}
+//
+// The primary field gives the id and type of the resource, the relation
+// fields its relationships, named after their JSON names, whose resources
+// are listed once in "included", and the other fields, encoded with their
+// json tags, its attributes.
+func EncodeJSONAPIResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	doc, ok := response.(*JSONAPIDocument)
+	if !ok {
+		doc = &JSONAPIDocument{Data: response}
+	}
+
+	inc := &jsonapiIncluded{seen: make(map[jsonapiIdentifier]bool)}
+	data, err := jsonapiData(reflect.ValueOf(doc.Data), inc)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(struct {
+		Data     interface{}            `json:"data"`
+		Included []*jsonapiResource     `json:"included,omitempty"`
+		Meta     map[string]interface{} `json:"meta,omitempty"`
+		Links    map[string]string      `json:"links,omitempty"`
+	}{data, inc.resources, doc.Meta, doc.Links})
+	if err != nil {
+		return err
+	}
+	body = append(body, '\n')
+
+	w.Header().Set(HeaderContentType, HttpContentTypeJSONAPI)
+	setLinks(ctx, w, response)
+
+	out, _, done := compressWriter(ctx, w, len(body))
+	if _, err := out.Write(body); err != nil {
+		done()
+		return err
+	}
+
+	return done()
+}
+
+// JSONAPIErrorEncoder is an ErrorEncoder writing errors as a JSON:API errors
+// document. The status and code come from apierror.From, field errors of an
+// *api.ValidationError become one error each, pointing at their attribute,
+// and the messages of server errors are not disclosed, unless they come from
+// an *apierror.Error.
+func JSONAPIErrorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
+	aerr := apierror.From(err)
+	status := aerr.StatusCode()
+	if mapped, ok := apierror.DefaultStatusMapper.Status(err); ok {
+		status = mapped
+	}
+
+	detail := aerr.Message
+	var explicit *apierror.Error
+	if status >= http.StatusInternalServerError && !errors.As(err, &explicit) {
+		detail = ""
+	}
+
+	base := jsonapiError{
+		Status: strconv.Itoa(status),
+		Code:   string(aerr.Code),
+		Title:  http.StatusText(status),
+	}
+	if id, ok := RequestIDFromContext(ctx); ok {
+		base.Meta = map[string]interface{}{"request_id": id}
+	}
+
+	var errs []jsonapiError
+	var verr *api.ValidationError
+	if errors.As(err, &verr) && verr.HasErrors() {
+		for _, f := range verr.Fields {
+			e := base
+			e.Detail = f.Message
+			if f.Code != "" {
+				e.Code = f.Code
+			}
+			e.Source = map[string]string{"pointer": "/data/attributes/" + strings.ReplaceAll(f.Field, ".", "/")}
+			errs = append(errs, e)
+		}
+	} else {
+		base.Detail = detail
+		errs = append(errs, base)
+	}
+
+	var headerer Headerer
+	if errors.As(err, &headerer) {
+		for k, values := range headerer.Headers() {
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"errors": errs})
+	w.Header().Set(HeaderContentType, HttpContentTypeJSONAPI)
+	w.WriteHeader(status)
+	w.Write(append(body, '\n'))
+}
+
+// jsonapiIncluded collects the related resources, once each.
+type jsonapiIncluded struct {
+	seen      map[jsonapiIdentifier]bool
+	resources []*jsonapiResource
+}
+
+// jsonapiData converts a struct, or a slice of structs, into resources.
+func jsonapiData(v reflect.Value, inc *jsonapiIncluded) (interface{}, error) {
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	// primary resources are never included
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			if id, err := jsonapiIdentifierOf(v.Index(i)); err == nil {
+				inc.seen[id] = true
+			}
+		}
+
+		resources := make([]*jsonapiResource, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			res, err := jsonapiResourceOf(v.Index(i), inc)
+			if err != nil {
+				return nil, err
+			}
+			resources = append(resources, res)
+		}
+		return resources, nil
+	}
+
+	if id, err := jsonapiIdentifierOf(v); err == nil {
+		inc.seen[id] = true
+	}
+	return jsonapiResourceOf(v, inc)
+}
+
+// jsonapiIdentifierOf returns the type and id of the resource of v, given by
+// its primary field.
+func jsonapiIdentifierOf(v reflect.Value) (jsonapiIdentifier, error) {
+	v = indirect(v)
+	if v.Kind() != reflect.Struct {
+		return jsonapiIdentifier{}, fmt.Errorf("jsonapi: cannot encode %s as a resource", v.Kind())
+	}
+
+	for _, f := range tagFields(v, "jsonapi") {
+		if f.opts[0] != "primary" {
+			continue
+		}
+		if len(f.opts) < 2 {
+			return jsonapiIdentifier{}, fmt.Errorf("jsonapi: primary field %s has no type", f.field.Name)
+		}
+
+		id := jsonapiIdentifier{Type: f.opts[1]}
+		if !f.value.IsZero() {
+			id.ID = fmt.Sprint(indirect(f.value).Interface())
+		}
+		return id, nil
+	}
+
+	return jsonapiIdentifier{}, fmt.Errorf("jsonapi: %s has no primary field", v.Type())
+}
+
+func jsonapiResourceOf(v reflect.Value, inc *jsonapiIncluded) (*jsonapiResource, error) {
+	id, err := jsonapiIdentifierOf(v)
+	if err != nil {
+		return nil, err
+	}
+	v = indirect(v)
+
+	raw, err := json.Marshal(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	res := &jsonapiResource{Type: id.Type, ID: id.ID}
+	if err := json.Unmarshal(raw, &res.Attributes); err != nil {
+		return nil, err
+	}
+
+	for _, f := range tagFields(v, "jsonapi") {
+		name := jsonFieldName(f.field)
+		delete(res.Attributes, name)
+
+		if f.opts[0] == "relation" {
+			if res.Relationships == nil {
+				res.Relationships = make(map[string]jsonapiRelationship)
+			}
+			rel, err := jsonapiRelationOf(f.value, inc)
+			if err != nil {
+				return nil, err
+			}
+			res.Relationships[name] = rel
+		}
+	}
+
+	if len(res.Attributes) == 0 {
+		res.Attributes = nil
+	}
+
+	return res, nil
+}
+
+// jsonapiRelationOf returns the relationship to the resources of a relation
+// field, which are added to inc.
+func jsonapiRelationOf(v reflect.Value, inc *jsonapiIncluded) (jsonapiRelationship, error) {
+	v = indirect(v)
+	if !v.IsValid() {
+		return jsonapiRelationship{}, nil
+	}
+
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		ids := make([]jsonapiIdentifier, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			id, err := inc.add(v.Index(i))
+			if err != nil {
+				return jsonapiRelationship{}, err
+			}
+			ids = append(ids, id)
+		}
+		return jsonapiRelationship{Data: ids}, nil
+	}
+
+	id, err := inc.add(v)
+	if err != nil {
+		return jsonapiRelationship{}, err
+	}
+	return jsonapiRelationship{Data: id}, nil
+}
+
+// add includes the resource of v, unless it already is, and returns its
+// identifier.
+func (inc *jsonapiIncluded) add(v reflect.Value) (jsonapiIdentifier, error) {
+	id, err := jsonapiIdentifierOf(v)
+	if err != nil {
+		return jsonapiIdentifier{}, err
+	}
+	if inc.seen[id] {
+		return id, nil
+	}
+	inc.seen[id] = true
+
+	// the relations of the related resource are included too
+	res, err := jsonapiResourceOf(v, inc)
+	if err != nil {
+		return jsonapiIdentifier{}, err
+	}
+	inc.resources = append(inc.resources, res)
+
+	return id, nil
+}
+
+// taggedField is a struct field carrying the options of a tag.
+type taggedField struct {
+	field reflect.StructField
+	value reflect.Value
+	opts  []string
+}
+
+// tagFields returns the fields of the struct v carrying tag, including those
+// of its embedded structs.
+func tagFields(v reflect.Value, tag string) []taggedField {
+	var fields []taggedField
+	typ := v.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		value, ok := field.Tag.Lookup(tag)
+		if !ok {
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				fields = append(fields, tagFields(v.Field(i), tag)...)
+			}
+			continue
+		}
+
+		fields = append(fields, taggedField{field: field, value: v.Field(i), opts: strings.Split(value, ",")})
+	}
+	return fields
+}
+
+// jsonFieldName returns the name of field in its JSON encoding.
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
@@ -0,0 +1,53 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CursorPaginator is checked by the response encoders. If a response
+// implements CursorPaginator, the cursors of its next and previous pages are
+// sent in a Link header (RFC 5988), as links to the request URI with their
+// cursor in the cursor query param, so clients may follow them without
+// parsing the body. The request URI is taken from the context, as populated
+// by PopulateRequestContext.
+type CursorPaginator interface {
+	PageCursors() (next, prev string)
+}
+
+// setLinks sets the Link header of response, if it has cursors.
+func setLinks(ctx context.Context, w http.ResponseWriter, response interface{}) {
+	pager, ok := response.(CursorPaginator)
+	if !ok {
+		return
+	}
+
+	next, prev := pager.PageCursors()
+	if next == "" && prev == "" {
+		return
+	}
+
+	uri, _ := ctx.Value(ContextKeyRequestURI).(string)
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return
+	}
+
+	var links []string
+	for _, link := range []struct{ rel, cursor string }{{"next", next}, {"prev", prev}} {
+		if link.cursor == "" {
+			continue
+		}
+
+		q := u.Query()
+		q.Del("page")
+		q.Set("cursor", link.cursor)
+		target := url.URL{Path: u.Path, RawPath: u.RawPath, RawQuery: q.Encode()}
+		links = append(links, fmt.Sprintf("<%s>; rel=%q", target.String(), link.rel))
+	}
+
+	w.Header().Add(HeaderLink, strings.Join(links, ", "))
+}
@@ -0,0 +1,53 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/likearthian/apikit/logger"
+)
+
+// LoggerIntoContext returns a RequestFunc storing in the context a Logger
+// derived from l, adding the request id, trace id and client IP to its
+// entries, so endpoints can log with logger.FromContext. It should run after
+// PopulateRequestContext and the tracing RequestFuncs, so those ids are set.
+func LoggerIntoContext(l logger.Logger) RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		reqID, ok := RequestIDFromContext(ctx)
+		if !ok {
+			reqID = r.Header.Get(HeaderXRequestID)
+		}
+
+		traceID, _ := ctx.Value(ContextKeyRequestXTraceID).(string)
+		if traceID == "" {
+			traceID = r.Header.Get("X-Trace-Id")
+		}
+
+		keyvals := []interface{}{
+			"request-id", reqID,
+			"client-ip", clientIP(r.Header.Get("X-Forwarded-For"), r.RemoteAddr),
+		}
+		if traceID != "" {
+			keyvals = append(keyvals, "trace-id", traceID)
+		}
+
+		return logger.IntoContext(ctx, logger.With(l, keyvals...))
+	}
+}
+
+func init() {
+	logger.RegisterContextFields(requestLogFields)
+}
+
+// requestLogFields returns the request and trace ids of ctx, added by the Ctx
+// methods of logger.LoggerV2.
+func requestLogFields(ctx context.Context) []interface{} {
+	var fields []interface{}
+	if reqID, ok := RequestIDFromContext(ctx); ok {
+		fields = append(fields, "request-id", reqID)
+	}
+	if traceID, _ := ctx.Value(ContextKeyRequestXTraceID).(string); traceID != "" {
+		fields = append(fields, "trace-id", traceID)
+	}
+	return fields
+}
@@ -0,0 +1,473 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/storage"
+)
+
+// sniffLen is the number of bytes http.DetectContentType looks at.
+const sniffLen = 512
+
+// UploadError reports an uploaded file rejected by MakeMultipartDecoder. It
+// wraps api.ErrBadRequest and reports a 400 status code.
+type UploadError struct {
+	Field    string
+	Filename string
+	Reason   string
+}
+
+func (e *UploadError) Error() string {
+	return fmt.Sprintf("%s: file %q of field %q: %s", api.ErrBadRequest, e.Filename, e.Field, e.Reason)
+}
+
+func (e *UploadError) Unwrap() error {
+	return api.ErrBadRequest
+}
+
+func (e *UploadError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// BlobUploader is implemented by request DTOs wanting the details of the
+// files MakeMultipartDecoder stored, not just their keys.
+type BlobUploader interface {
+	AddBlob(field, filename string, obj *storage.Object)
+}
+
+type decoderOption struct {
+	maxMemory    int64
+	maxValues    int
+	maxFileSize  int64
+	fieldMaxSize map[string]int64
+	maxFiles     int
+	contentTypes []string
+	extensions   map[string]bool
+	sanitize     bool
+	images       map[string][]ImageTransformer
+	scanner      UploadScanner
+	store        storage.BlobStore
+	keyFunc      func(ctx context.Context, field, filename string) string
+}
+
+// DecoderOption sets an optional parameter for MakeMultipartDecoder.
+type DecoderOption func(opt *decoderOption)
+
+// DecoderMaxMemory sets the maximum size of each non-file form value.
+// Defaults to 5MB.
+func DecoderMaxMemory(n int64) DecoderOption {
+	return func(opt *decoderOption) { opt.maxMemory = n }
+}
+
+// DecoderMaxFormValues sets the maximum number of non-file form values of a
+// request; requests with more fail with api.ErrBadRequest. Defaults to 1000.
+func DecoderMaxFormValues(n int) DecoderOption {
+	return func(opt *decoderOption) { opt.maxValues = n }
+}
+
+// DecoderMaxFileSize sets the maximum size of each uploaded file; larger files
+// fail with an *UploadError. A size lower than 1, the default, disables the
+// limit.
+func DecoderMaxFileSize(n int64) DecoderOption {
+	return func(opt *decoderOption) { opt.maxFileSize = n }
+}
+
+// DecoderFieldMaxSize sets the maximum size of the files uploaded in field,
+// overriding DecoderMaxFileSize.
+func DecoderFieldMaxSize(field string, n int64) DecoderOption {
+	return func(opt *decoderOption) {
+		if opt.fieldMaxSize == nil {
+			opt.fieldMaxSize = make(map[string]int64)
+		}
+		opt.fieldMaxSize[field] = n
+	}
+}
+
+// DecoderMaxFiles sets the maximum number of files of a request. Defaults to
+// no limit.
+func DecoderMaxFiles(n int) DecoderOption {
+	return func(opt *decoderOption) { opt.maxFiles = n }
+}
+
+// DecoderAllowedContentTypes restricts uploads to the given media types, such
+// as "application/pdf", or whole types such as "image/*". The type is sniffed
+// from the first 512 bytes of each file with http.DetectContentType rather
+// than taken from the client, and the sniffed type is the one handed to the
+// endpoint and the BlobStore.
+func DecoderAllowedContentTypes(types ...string) DecoderOption {
+	return func(opt *decoderOption) { opt.contentTypes = types }
+}
+
+// DecoderAllowedExtensions restricts uploads to filenames with one of the
+// given extensions, such as ".png" or "pdf", compared case insensitively.
+func DecoderAllowedExtensions(exts ...string) DecoderOption {
+	return func(opt *decoderOption) {
+		opt.extensions = make(map[string]bool)
+		for _, ext := range exts {
+			opt.extensions["."+strings.TrimPrefix(strings.ToLower(ext), ".")] = true
+		}
+	}
+}
+
+// DecoderImageTransformers applies transformers, in order, to the images
+// uploaded in field, such as ResizeImage(256, 256) and StripEXIF() for an
+// avatar. The content type of the files of field is sniffed as with
+// DecoderAllowedContentTypes, and only files sniffed as image/* are
+// transformed, their filename extension following their new format. Images
+// failing to be transformed are rejected with an *UploadError.
+func DecoderImageTransformers(field string, transformers ...ImageTransformer) DecoderOption {
+	return func(opt *decoderOption) {
+		if opt.images == nil {
+			opt.images = make(map[string][]ImageTransformer)
+		}
+		opt.images[field] = append(opt.images[field], transformers...)
+	}
+}
+
+// DecoderUploadScanner has every uploaded file scanned by scanner before it
+// is stored or handed to the endpoint. Files are scanned as they are stored
+// with DecodeIntoBlobStore, and deleted when rejected; otherwise they are
+// buffered in a temporary file until scanned. Rejected files fail the request
+// with an *UploadRejectedError.
+func DecoderUploadScanner(scanner UploadScanner) DecoderOption {
+	return func(opt *decoderOption) { opt.scanner = scanner }
+}
+
+// DecoderSanitizeFilenames passes the filenames of uploads through
+// SanitizeFilename before handing them to the endpoint and the key function
+// of DecodeIntoBlobStore.
+func DecoderSanitizeFilenames() DecoderOption {
+	return func(opt *decoderOption) { opt.sanitize = true }
+}
+
+// DecodeIntoBlobStore streams every uploaded file into store as it is read,
+// under the key returned by keyFunc, and binds the keys to the `form` fields
+// named after the file fields, so the endpoint receives object keys instead
+// of file contents. A nil keyFunc stores files as "<field>/<uuid><ext>".
+// When decoding fails, the files already stored are deleted.
+func DecodeIntoBlobStore(store storage.BlobStore, keyFunc func(ctx context.Context, field, filename string) string) DecoderOption {
+	return func(opt *decoderOption) {
+		opt.store = store
+		opt.keyFunc = keyFunc
+		if opt.keyFunc == nil {
+			opt.keyFunc = uploadKey
+		}
+	}
+}
+
+// MakeMultipartDecoder returns a DecodeRequestFunc reading a multipart form
+// part by part, without buffering files in memory or on disk. Form values are
+// bound to `form` tags, alongside the path, query, header and cookie values
+// BindRequest binds, and the request is then validated.
+//
+// With DecodeIntoBlobStore, files are stored and their keys bound. Otherwise
+// the first file is handed as it is to the AddFileStream method of *T, as
+// defined by FileStreamPayload, to be read by the endpoint, and the parts
+// following it are left unread.
+//
+// Files breaking the limits set with DecoderMaxFiles, DecoderMaxFileSize,
+// DecoderFieldMaxSize, DecoderAllowedContentTypes or DecoderAllowedExtensions
+// fail the request with an *UploadError, and files rejected by the scanner
+// set with DecoderUploadScanner with an *UploadRejectedError.
+func MakeMultipartDecoder[T any](options ...DecoderOption) DecodeRequestFunc[T] {
+	opts := &decoderOption{maxMemory: 5 * 1024 * 1024, maxValues: 1000}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return func(ctx context.Context, r *http.Request) (T, error) {
+		var reqObj T
+
+		reader, err := r.MultipartReader()
+		if err != nil {
+			return reqObj, fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+		}
+
+		var stored []string
+		fail := func(err error) (T, error) {
+			for _, key := range stored {
+				_ = opts.store.Delete(context.Background(), key)
+			}
+			return reqObj, err
+		}
+
+		formData := url.Values{}
+		files, values := 0, 0
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fail(fmt.Errorf("%w: %s", api.ErrBadRequest, err))
+			}
+
+			name := part.FormName()
+			filename := part.FileName()
+			if filename == "" {
+				values++
+				if opts.maxValues > 0 && values > opts.maxValues {
+					return fail(fmt.Errorf("%w: too many form values, the limit is %d", api.ErrBadRequest, opts.maxValues))
+				}
+
+				value, err := readFormValue(part, opts.maxMemory)
+				if err != nil {
+					return fail(err)
+				}
+				formData.Add(name, value)
+				continue
+			}
+
+			files++
+			if opts.maxFiles > 0 && files > opts.maxFiles {
+				return fail(&UploadError{Field: name, Filename: filename, Reason: fmt.Sprintf("too many files, the limit is %d", opts.maxFiles)})
+			}
+
+			file, contentType, err := opts.checkFile(name, filename, part)
+			if err != nil {
+				return fail(err)
+			}
+
+			if transformers := opts.images[name]; len(transformers) > 0 && strings.HasPrefix(contentType, "image/") {
+				original := contentType
+				for _, transform := range transformers {
+					file, contentType, err = transform(ctx, file, contentType)
+					if err != nil {
+						var uerr *UploadError
+						if !errors.As(err, &uerr) {
+							err = &UploadError{Field: name, Filename: filename, Reason: err.Error()}
+						}
+						return fail(err)
+					}
+				}
+
+				// name re-encoded images after their new format
+				if ext, ok := imageExtensions[contentType]; ok && contentType != original {
+					filename = strings.TrimSuffix(filename, path.Ext(filename)) + ext
+				}
+			}
+			if opts.sanitize {
+				filename = SanitizeFilename(filename)
+			}
+
+			if opts.store == nil {
+				if up, ok := any(&reqObj).(interface {
+					AddFileStream(name string, reader io.ReadCloser, contentType string)
+				}); ok {
+					rc := io.NopCloser(file)
+					if opts.scanner != nil {
+						if rc, err = opts.scannedFile(ctx, name, filename, file); err != nil {
+							return fail(err)
+						}
+					}
+					up.AddFileStream(filename, rc, contentType)
+					break
+				}
+				continue
+			}
+
+			key := opts.keyFunc(ctx, name, filename)
+
+			var obj *storage.Object
+			err = opts.scanUpload(ctx, name, filename, file, func(r io.Reader) (err error) {
+				obj, err = opts.store.Put(ctx, key, r, contentType)
+				return err
+			})
+			if obj != nil {
+				stored = append(stored, key)
+			}
+			if err != nil {
+				return fail(err)
+			}
+
+			formData.Add(name, obj.Key)
+			if up, ok := any(&reqObj).(BlobUploader); ok {
+				up.AddBlob(name, filename, obj)
+			}
+		}
+
+		if err := bindRequest(ctx, r, &reqObj, false); err != nil {
+			return fail(err)
+		}
+
+		if err := bindData(&reqObj, formData, "form"); err != nil {
+			return fail(err)
+		}
+
+		if err := validateRequest(ctx, &reqObj); err != nil {
+			return fail(err)
+		}
+
+		return reqObj, nil
+	}
+}
+
+// checkFile validates the extension and sniffed content type of the file
+// uploaded in field, and returns the reader of its content, enforcing the size
+// limit of field, along with its content type.
+func (opts *decoderOption) checkFile(field, filename string, part *multipart.Part) (io.Reader, string, error) {
+	if opts.extensions != nil && !opts.extensions[strings.ToLower(path.Ext(filename))] {
+		return nil, "", &UploadError{Field: field, Filename: filename, Reason: "file extension not allowed"}
+	}
+
+	limit := opts.maxFileSize
+	if n, ok := opts.fieldMaxSize[field]; ok {
+		limit = n
+	}
+	file := newFileSizeLimiter(part, limit, field, filename)
+
+	contentType := part.Header.Get(HeaderContentType)
+	if len(opts.contentTypes) == 0 && len(opts.images[field]) == 0 {
+		return file, contentType, nil
+	}
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, "", err
+	}
+	head = head[:n]
+
+	contentType = http.DetectContentType(head)
+	if len(opts.contentTypes) > 0 && !contentTypeAllowed(contentType, opts.contentTypes) {
+		return nil, "", &UploadError{Field: field, Filename: filename, Reason: fmt.Sprintf("content type %q not allowed", contentType)}
+	}
+
+	return io.MultiReader(bytes.NewReader(head), file), contentType, nil
+}
+
+func contentTypeAllowed(contentType string, allowed []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range allowed {
+		t = strings.ToLower(t)
+		if t == mediaType || strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SanitizeFilename returns the base name of filename without control
+// characters and characters reserved on common file systems, without leading
+// dots so it can't name a hidden file, and shortened to 255 bytes, keeping its
+// extension. Empty names become "file".
+func SanitizeFilename(filename string) string {
+	filename = filename[strings.LastIndexAny(filename, `/\`)+1:]
+
+	filename = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return -1
+		}
+		return r
+	}, filename)
+	filename = strings.TrimLeft(strings.TrimSpace(filename), ".")
+	filename = strings.TrimRight(filename, ". ")
+
+	if len(filename) > 255 {
+		ext := path.Ext(filename)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		base := filename[:255-len(ext)]
+		for !utf8.ValidString(base) {
+			base = base[:len(base)-1]
+		}
+		filename = base + ext
+	}
+
+	if filename == "" {
+		return "file"
+	}
+
+	return filename
+}
+
+func readFormValue(part io.Reader, maxMemory int64) (string, error) {
+	var b bytes.Buffer
+	n, err := io.CopyN(&b, part, maxMemory+1)
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+	}
+	if n > maxMemory {
+		return "", &RequestTooLargeError{Limit: maxMemory}
+	}
+
+	return b.String(), nil
+}
+
+// fileSizeLimiter fails with an *UploadError once more than limit bytes have
+// been read.
+type fileSizeLimiter struct {
+	r         io.Reader
+	limit     int64
+	remaining int64
+	field     string
+	filename  string
+}
+
+func newFileSizeLimiter(r io.Reader, limit int64, field, filename string) io.Reader {
+	if limit < 1 {
+		return r
+	}
+	return &fileSizeLimiter{r: r, limit: limit, remaining: limit, field: field, filename: filename}
+}
+
+func (l *fileSizeLimiter) err() error {
+	return &UploadError{Field: l.field, Filename: l.filename, Reason: fmt.Sprintf("file exceeds the %d bytes limit", l.limit)}
+}
+
+func (l *fileSizeLimiter) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, l.err()
+	}
+
+	// read one byte past the limit to tell a file of exactly the limit from a
+	// larger one
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), l.err()
+	}
+
+	return n, err
+}
+
+// uploadKey returns "<field>/<uuid><ext>", keeping the extension of filename
+// when it is a plain alphanumeric one.
+func uploadKey(_ context.Context, field, filename string) string {
+	ext := strings.ToLower(path.Ext(strings.ReplaceAll(filename, "\\", "/")))
+	for _, c := range strings.TrimPrefix(ext, ".") {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			ext = ""
+			break
+		}
+	}
+
+	if field = strings.Trim(path.Clean("/"+field), "/"); field == "" {
+		field = "uploads"
+	}
+
+	return field + "/" + NewRequestID() + ext
+}
@@ -0,0 +1,72 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// NDJSONResponseEncoder is an EncodeResponseFunc writing the elements of the
+// iterator as newline delimited JSON, using the default stream options.
+func NDJSONResponseEncoder[T any](ctx context.Context, w http.ResponseWriter, response Iterator[T]) error {
+	return MakeNDJSONResponseEncoder[T]()(ctx, w, response)
+}
+
+// MakeNDJSONResponseEncoder returns an EncodeResponseFunc that writes every
+// element of the iterator as one JSON document per line, served as
+// application/x-ndjson. Use ChanIterator or SliceIterator to stream a channel
+// or a slice. Like MakeStreamingJSONResponseEncoder, elements are flushed
+// periodically and an error after the first line is returned to the Server
+// without affecting the status code.
+func MakeNDJSONResponseEncoder[T any](options ...StreamOption) EncodeResponseFunc[Iterator[T]] {
+	opts := newStreamOption(options)
+	marshal := opts.marshal
+	opts.marshal = func(v interface{}) ([]byte, error) {
+		b, err := marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, it Iterator[T]) error {
+		w.Header().Set(HeaderContentType, HttpContentTypeNDJSON)
+		return writeStream(ctx, w, it, opts, "", "", "")
+	}
+}
+
+// DecodeNDJSONRequest is a DecodeRequestFunc returning an Iterator over the
+// JSON documents of a newline delimited request body. The body is decoded
+// lazily as the endpoint advances the iterator, so it must be consumed before
+// the endpoint returns. A malformed document stops the iteration with an error
+// wrapping api.ErrBadRequest; every decoded element is validated like the
+// other request decoders do.
+func DecodeNDJSONRequest[T any](ctx context.Context, r *http.Request) (Iterator[T], error) {
+	dec := json.NewDecoder(r.Body)
+	record := 0
+
+	return NewIterator(func(ctx context.Context) (T, bool, error) {
+		var v T
+		if err := ctx.Err(); err != nil {
+			return v, false, err
+		}
+
+		record++
+		if err := dec.Decode(&v); err != nil {
+			if err == io.EOF {
+				return v, false, nil
+			}
+			return v, false, fmt.Errorf("%w: record %d: %s", api.ErrBadRequest, record, err)
+		}
+
+		if err := validateRequest(ctx, &v); err != nil {
+			return v, false, fmt.Errorf("record %d: %w", record, err)
+		}
+
+		return v, true, nil
+	}), nil
+}
@@ -0,0 +1,293 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrMarshalerUnsupported may be returned by a MarshalFunc to signal that it
+// cannot encode the given value. The negotiating encoder then moves on to the
+// next acceptable content type instead of failing the request.
+var ErrMarshalerUnsupported = errors.New("marshaler does not support the response type")
+
+// NotAcceptableError is returned by MarshalerRegistry.Negotiate when none of
+// the media types accepted by the client can encode the response. It reports
+// a 406 status code.
+type NotAcceptableError struct {
+	Accept string
+}
+
+func (e *NotAcceptableError) Error() string {
+	return "none of the accepted media types can be produced: " + e.Accept
+}
+
+func (e *NotAcceptableError) StatusCode() int {
+	return http.StatusNotAcceptable
+}
+
+// MarshalFunc serializes a response value into the body of an HTTP response.
+type MarshalFunc func(v interface{}) ([]byte, error)
+
+// MarshalerRegistry holds the marshalers available for content negotiation,
+// keyed by media type (e.g. "application/json").
+type MarshalerRegistry struct {
+	mu         sync.RWMutex
+	marshalers map[string]MarshalFunc
+	fallback   string
+}
+
+// NewMarshalerRegistry returns a registry pre-populated with JSON, XML,
+// MessagePack and Protobuf marshalers, falling back to JSON.
+func NewMarshalerRegistry() *MarshalerRegistry {
+	r := &MarshalerRegistry{
+		marshalers: make(map[string]MarshalFunc),
+		fallback:   HttpContentTypeJson,
+	}
+
+	r.Register(HttpContentTypeJson, json.Marshal)
+	r.Register("application/xml", xml.Marshal)
+	r.Register("text/xml", xml.Marshal)
+	r.Register(HttpContentTypeMsgPack, msgpack.Marshal)
+	r.Register("application/x-msgpack", msgpack.Marshal)
+	r.Register(HttpContentTypeProtobuf, marshalProto)
+
+	return r
+}
+
+// DefaultMarshalers is the registry used by NegotiatingResponseEncoder.
+var DefaultMarshalers = NewMarshalerRegistry()
+
+// RegisterMarshaler registers fn for contentType in DefaultMarshalers.
+func RegisterMarshaler(contentType string, fn MarshalFunc) {
+	DefaultMarshalers.Register(contentType, fn)
+}
+
+// Register adds or replaces the marshaler for the given media type.
+func (r *MarshalerRegistry) Register(contentType string, fn MarshalFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.marshalers[normalizeMediaType(contentType)] = fn
+}
+
+// SetFallback sets the media type used when the Accept header is missing.
+// The media type must have been registered.
+func (r *MarshalerRegistry) SetFallback(contentType string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = normalizeMediaType(contentType)
+}
+
+// Negotiate picks the best registered marshaler for the given Accept header
+// value and encodes v with it. It returns the chosen content type and the
+// encoded body. When a marshaler fails, the next acceptable media type is
+// tried. When none of the accepted media types can encode v, it fails with a
+// *NotAcceptableError; without Accept header, the fallback media type is
+// used.
+func (r *MarshalerRegistry) Negotiate(accept string, v interface{}) (string, []byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	specs := parseQualityList(accept)
+
+	// media types refused with q=0 are not picked by wildcard ranges
+	tried := make(map[string]struct{})
+	for _, spec := range specs {
+		if spec.q == 0 {
+			tried[normalizeMediaType(spec.value)] = struct{}{}
+		}
+	}
+
+	var lastErr error
+	try := func(contentType string) ([]byte, bool) {
+		if _, ok := tried[contentType]; ok {
+			return nil, false
+		}
+		tried[contentType] = struct{}{}
+
+		fn, ok := r.marshalers[contentType]
+		if !ok {
+			return nil, false
+		}
+
+		body, err := fn(v)
+		if err != nil {
+			if !errors.Is(err, ErrMarshalerUnsupported) {
+				lastErr = err
+			}
+			return nil, false
+		}
+		return body, true
+	}
+
+	if len(specs) == 0 {
+		if body, ok := try(r.fallback); ok {
+			return r.fallback, body, nil
+		}
+		if lastErr != nil {
+			return "", nil, lastErr
+		}
+		return "", nil, fmt.Errorf("no marshaler available for %T", v)
+	}
+
+	for _, spec := range specs {
+		if spec.q == 0 {
+			continue
+		}
+
+		for _, contentType := range r.matchLocked(spec.value) {
+			if body, ok := try(contentType); ok {
+				return contentType, body, nil
+			}
+		}
+	}
+
+	if lastErr != nil {
+		return "", nil, lastErr
+	}
+	return "", nil, &NotAcceptableError{Accept: accept}
+}
+
+// matchLocked returns the registered media types matching the media range,
+// which may contain wildcards ("*/*", "application/*"). The fallback media type
+// always comes first so wildcard ranges resolve deterministically.
+func (r *MarshalerRegistry) matchLocked(mediaRange string) []string {
+	mediaRange = normalizeMediaType(mediaRange)
+	if !strings.HasSuffix(mediaRange, "/*") {
+		return []string{mediaRange}
+	}
+
+	prefix := strings.TrimSuffix(mediaRange, "*")
+	if mediaRange == "*/*" {
+		prefix = ""
+	}
+
+	var matches []string
+	for contentType := range r.marshalers {
+		if contentType != r.fallback && strings.HasPrefix(contentType, prefix) {
+			matches = append(matches, contentType)
+		}
+	}
+	sort.Strings(matches)
+
+	if strings.HasPrefix(r.fallback, prefix) {
+		matches = append([]string{r.fallback}, matches...)
+	}
+
+	return matches
+}
+
+// NegotiatingResponseEncoder is an EncodeResponseFunc that picks the response
+// format from the Accept header captured by PopulateRequestContext, using
+// DefaultMarshalers. The response is compressed when the client accepts it.
+func NegotiatingResponseEncoder(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	return MakeNegotiatingResponseEncoder[interface{}](DefaultMarshalers)(ctx, w, response)
+}
+
+// MakeNegotiatingResponseEncoder returns an EncodeResponseFunc that picks the
+// response format from the Accept header captured by PopulateRequestContext,
+// using the marshalers in registry. Responses implementing LastModifier get a
+// Last-Modified header, and those implementing CursorPaginator a Link header.
+// The status and headers of responses implementing StatusCoder and Headerer
+// are honored too.
+func MakeNegotiatingResponseEncoder[T any](registry *MarshalerRegistry) EncodeResponseFunc[T] {
+	return func(ctx context.Context, w http.ResponseWriter, response T) error {
+		code := ResponseStatus(w, response)
+		if code == http.StatusNoContent {
+			setLastModified(w, response)
+			w.WriteHeader(code)
+			return nil
+		}
+
+		accept, _ := ctx.Value(ContextKeyRequestAccept).(string)
+		contentType, body, err := registry.Negotiate(accept, response)
+		if err != nil {
+			return err
+		}
+
+		w.Header().Add(HeaderVary, HeaderAccept)
+		w.Header().Set(HeaderContentType, withCharset(contentType))
+		setLastModified(w, response)
+		setLinks(ctx, w, response)
+
+		out, _, done := compressWriter(ctx, w, len(body))
+		w.WriteHeader(code)
+		if _, err := out.Write(body); err != nil {
+			done()
+			return err
+		}
+
+		return done()
+	}
+}
+
+func marshalProto(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrMarshalerUnsupported
+	}
+
+	return proto.Marshal(msg)
+}
+
+type qualityValue struct {
+	value string
+	q     float64
+}
+
+// parseQualityList parses a header value made of comma separated items with
+// optional q-values (Accept, Accept-Encoding, Accept-Language), ordered by
+// descending quality. Items with equal quality keep their original order.
+func parseQualityList(header string) []qualityValue {
+	var list []qualityValue
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		item := qualityValue{q: 1}
+		params := strings.Split(part, ";")
+		item.value = strings.ToLower(strings.TrimSpace(params[0]))
+		for _, param := range params[1:] {
+			key, val, found := strings.Cut(strings.TrimSpace(param), "=")
+			if !found || strings.TrimSpace(key) != "q" {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+				item.q = q
+			}
+		}
+
+		list = append(list, item)
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].q > list[j].q
+	})
+
+	return list
+}
+
+func normalizeMediaType(contentType string) string {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+func withCharset(contentType string) string {
+	if strings.HasPrefix(contentType, "text/") || strings.HasSuffix(contentType, "json") || strings.HasSuffix(contentType, "xml") {
+		return contentType + "; charset=utf-8"
+	}
+
+	return contentType
+}
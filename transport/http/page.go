@@ -0,0 +1,22 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// MakePageRequestDecoder returns a DecodeRequestFunc parsing the page,
+// order and filters requested in the query string with api.ParsePageRequest,
+// given options.
+//
+//	decoder := httptransport.MakePageRequestDecoder(
+//		api.SortableFields("name", "created_at"),
+//		api.FilterableFields("status"),
+//	)
+func MakePageRequestDecoder(options ...api.PageOption) DecodeRequestFunc[api.PageRequest] {
+	return func(_ context.Context, r *http.Request) (api.PageRequest, error) {
+		return api.ParsePageRequest(r.URL.Query(), options...)
+	}
+}
@@ -0,0 +1,29 @@
+//go:build go1.22
+
+package http
+
+import (
+	"context"
+	"net/http"
+)
+
+// PathValuesIntoContext returns a RequestFunc storing the wildcards called
+// names, of the http.ServeMux pattern matched by the request, in the context
+// under ContextKeyURLParams. For a handler registered on "GET /users/{id}":
+//
+//	httptransport.ServerBefore(httptransport.PathValuesIntoContext("id"))
+//
+// It requires Go 1.22 or later, whose ServeMux supports such patterns when
+// the main module declares go 1.22 or later.
+func PathValuesIntoContext(names ...string) RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		params := make(map[string]string, len(names))
+		for _, name := range names {
+			if v := r.PathValue(name); v != "" {
+				params[name] = v
+			}
+		}
+
+		return context.WithValue(ctx, ContextKeyURLParams, params)
+	}
+}
@@ -0,0 +1,191 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/apierror"
+	"github.com/likearthian/apikit/i18n"
+)
+
+// ProblemDetails is an RFC 7807 problem details object. Extensions hold the
+// extension members, encoded alongside the standard ones.
+type ProblemDetails struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+}
+
+// MarshalJSON encodes the problem as a flat object; extension members never
+// override the standard ones.
+func (p *ProblemDetails) MarshalJSON() ([]byte, error) {
+	m := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+
+	m["type"] = p.Type
+	m["title"] = p.Title
+	m["status"] = p.Status
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+
+	return json.Marshal(m)
+}
+
+// ProblemExtender is implemented by errors adding extension members to the
+// problem details encoding them.
+type ProblemExtender interface {
+	ProblemExtensions() map[string]interface{}
+}
+
+type problemOption struct {
+	typeBase string
+	mapper   *apierror.StatusMapper
+	catalog  *i18n.Catalog
+}
+
+// ProblemOption sets an optional parameter for
+// MakeProblemDetailsErrorEncoder.
+type ProblemOption func(opt *problemOption)
+
+// ProblemTypeBase sets the URI the problem type of errors carrying an
+// apierror code is made of, as base + "/" + code (e.g.
+// "https://example.com/problems/not_found"), which should document the
+// problem. By default the type is "about:blank".
+func ProblemTypeBase(base string) ProblemOption {
+	return func(opt *problemOption) { opt.typeBase = strings.TrimSuffix(base, "/") }
+}
+
+// ProblemStatusMapper sets the StatusMapper whose mappings take precedence
+// over the status reported by errors. Defaults to
+// apierror.DefaultStatusMapper.
+func ProblemStatusMapper(m *apierror.StatusMapper) ProblemOption {
+	return func(opt *problemOption) { opt.mapper = m }
+}
+
+// ProblemCatalog sets the Catalog translating the titles and details of
+// problems into the languages stored in the context by
+// i18n.AcceptLanguageIntoContext. Titles are looked up by i18n.StatusKey and
+// details by the apierror code of the error, filled with its details.
+// Defaults to i18n.DefaultCatalog.
+func ProblemCatalog(c *i18n.Catalog) ProblemOption {
+	return func(opt *problemOption) { opt.catalog = c }
+}
+
+// ProblemDetailsErrorEncoder is an ErrorEncoder writing errors as RFC 7807
+// application/problem+json documents, with the default options of
+// MakeProblemDetailsErrorEncoder.
+func ProblemDetailsErrorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
+	defaultProblemEncoder(ctx, err, w)
+}
+
+var defaultProblemEncoder = MakeProblemDetailsErrorEncoder()
+
+// MakeProblemDetailsErrorEncoder returns an ErrorEncoder writing errors as RFC
+// 7807 application/problem+json documents. The status is the one reported by
+// the error, as for DefaultErrorEncoder, unless the StatusMapper maps the
+// error to another one, and the instance is the request path stored by
+// PopulateRequestContext. Errors wrapping an *apierror.Error add its
+// code and details as extension members, *api.ValidationError its field
+// errors as "errors", and ProblemExtender implementations their own members.
+// The messages of server errors are not disclosed, unless they come from an
+// *apierror.Error.
+func MakeProblemDetailsErrorEncoder(options ...ProblemOption) ErrorEncoder {
+	opts := &problemOption{
+		mapper:  apierror.DefaultStatusMapper,
+		catalog: i18n.DefaultCatalog,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return func(ctx context.Context, err error, w http.ResponseWriter) {
+		problem := &ProblemDetails{
+			Type:       "about:blank",
+			Status:     http.StatusInternalServerError,
+			Extensions: make(map[string]interface{}),
+		}
+
+		var sc StatusCoder
+		if errors.As(err, &sc) {
+			problem.Status = sc.StatusCode()
+		}
+
+		var aerr *apierror.Error
+		if errors.As(err, &aerr) {
+			problem.Status = aerr.StatusCode()
+			problem.Detail = aerr.Message
+			problem.Extensions["code"] = aerr.Code
+			for k, v := range aerr.Details {
+				problem.Extensions[k] = v
+			}
+			if opts.typeBase != "" {
+				problem.Type = opts.typeBase + "/" + string(aerr.Code)
+			}
+		}
+
+		if status, ok := opts.mapper.Status(err); ok {
+			problem.Status = status
+		}
+		if aerr == nil && problem.Status < http.StatusInternalServerError {
+			problem.Detail = err.Error()
+		}
+
+		var verr *api.ValidationError
+		if errors.As(err, &verr) {
+			problem.Extensions["errors"] = verr.Fields
+		}
+
+		var ext ProblemExtender
+		if errors.As(err, &ext) {
+			for k, v := range ext.ProblemExtensions() {
+				problem.Extensions[k] = v
+			}
+		}
+
+		problem.Title = http.StatusText(problem.Status)
+		if title, ok := opts.catalog.Message(ctx, i18n.StatusKey(problem.Status), nil); ok {
+			problem.Title = title
+		}
+		if ae := apierror.From(err); ae != nil {
+			if detail, ok := opts.catalog.Message(ctx, string(ae.Code), ae.Details); ok {
+				problem.Detail = detail
+			}
+		}
+		problem.Instance, _ = ctx.Value(ContextKeyRequestPath).(string)
+		if id, ok := RequestIDFromContext(ctx); ok {
+			problem.Extensions["request_id"] = id
+		}
+
+		body, mErr := problem.MarshalJSON()
+		if mErr != nil {
+			DefaultErrorEncoder(ctx, err, w)
+			return
+		}
+
+		var headerer Headerer
+		if errors.As(err, &headerer) {
+			for k, values := range headerer.Headers() {
+				for _, v := range values {
+					w.Header().Add(k, v)
+				}
+			}
+		}
+
+		w.Header().Set(HeaderContentType, HttpContentTypeProblemJSON)
+		w.WriteHeader(problem.Status)
+		w.Write(body)
+	}
+}
@@ -0,0 +1,106 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/likearthian/apikit/api"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtoMessage constrains a type parameter to a pointer to T implementing
+// proto.Message, so decoders can allocate the message themselves.
+type ProtoMessage[T any] interface {
+	proto.Message
+	*T
+}
+
+// DecodeProtoRequest is a DecodeRequestFunc decoding the request body into a
+// protobuf message. Bodies sent as application/json are decoded with protojson,
+// anything else is expected to be binary protobuf. Malformed bodies are
+// reported as api.ErrBadRequest.
+func DecodeProtoRequest[T any, PT ProtoMessage[T]](ctx context.Context, r *http.Request) (PT, error) {
+	msg := PT(new(T))
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get(HeaderContentType))
+	if contentType == HttpContentTypeJson {
+		err = protojson.Unmarshal(body, msg)
+	} else {
+		err = proto.Unmarshal(body, msg)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+	}
+
+	if err := api.Validate(ctx, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// EncodeProtoResponse is an EncodeResponseFunc writing a protobuf message as
+// application/x-protobuf when the Accept header captured by
+// PopulateRequestContext allows it, and as protojson otherwise. The response
+// is compressed when the client accepts it.
+func EncodeProtoResponse[T proto.Message](ctx context.Context, w http.ResponseWriter, response T) error {
+	accept, _ := ctx.Value(ContextKeyRequestAccept).(string)
+
+	var (
+		body        []byte
+		err         error
+		contentType string
+	)
+
+	if acceptsProto(accept) {
+		contentType = HttpContentTypeProtobuf
+		body, err = proto.Marshal(response)
+	} else {
+		contentType = "application/json; charset=utf-8"
+		body, err = protojson.Marshal(response)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	w.Header().Add(HeaderVary, HeaderAccept)
+	w.Header().Set(HeaderContentType, contentType)
+
+	out, _, done := compressWriter(ctx, w, len(body))
+	if _, err := out.Write(body); err != nil {
+		done()
+		return err
+	}
+
+	return done()
+}
+
+// acceptsProto reports whether protobuf is the preferred media type of the
+// Accept header. Wildcards resolve to JSON.
+func acceptsProto(accept string) bool {
+	for _, spec := range parseQualityList(accept) {
+		if spec.q == 0 {
+			continue
+		}
+
+		switch normalizeMediaType(spec.value) {
+		case HttpContentTypeProtobuf, "application/protobuf", "application/vnd.google.protobuf":
+			return true
+		case HttpContentTypeJson, "*/*", "application/*":
+			return false
+		}
+	}
+
+	return false
+}
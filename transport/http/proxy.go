@@ -0,0 +1,330 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// hopHeaders are the hop-by-hop headers, which apply to a single connection
+// and are not forwarded by proxies.
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// UpstreamError is returned by the Proxy endpoint when the upstream can't be
+// reached. It reports a 504 status code when the request timed out and a 502
+// status code otherwise. Its message is the status text, so the upstream URL
+// doesn't reach the client; URL and Err are kept for logging.
+type UpstreamError struct {
+	URL string
+	Err error
+}
+
+func (e *UpstreamError) Error() string {
+	return http.StatusText(e.StatusCode())
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+func (e *UpstreamError) StatusCode() int {
+	if errors.Is(e.Err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+type proxyOption struct {
+	client          *http.Client
+	rewrite         func(path string) string
+	requestHeaders  []string
+	responseHeaders []string
+	trustedProxies  []string
+}
+
+// ProxyOption sets an optional parameter for NewProxy.
+type ProxyOption func(opt *proxyOption)
+
+// ProxyClient sets the client sending the requests upstream. By default, a
+// client not following redirects, which are passed to the caller, is used.
+func ProxyClient(client *http.Client) ProxyOption {
+	return func(opt *proxyOption) { opt.client = client }
+}
+
+// ProxyStripPrefix removes prefix from the path of the requests, such as
+// "/api" for a proxy mounted on "/api/*".
+func ProxyStripPrefix(prefix string) ProxyOption {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return ProxyRewritePath(func(path string) string {
+		if path == prefix {
+			return "/"
+		}
+		if strings.HasPrefix(path, prefix+"/") {
+			return path[len(prefix):]
+		}
+		return path
+	})
+}
+
+// ProxyRewritePath sets the function rewriting the path of the requests
+// before it is joined to the path of the upstream URL.
+func ProxyRewritePath(fn func(path string) string) ProxyOption {
+	return func(opt *proxyOption) { opt.rewrite = fn }
+}
+
+// ProxyDropRequestHeaders removes the given headers, such as Cookie, from
+// the requests sent upstream.
+func ProxyDropRequestHeaders(names ...string) ProxyOption {
+	return func(opt *proxyOption) { opt.requestHeaders = append(opt.requestHeaders, names...) }
+}
+
+// ProxyDropResponseHeaders removes the given headers, such as Server, from
+// the upstream responses.
+func ProxyDropResponseHeaders(names ...string) ProxyOption {
+	return func(opt *proxyOption) { opt.responseHeaders = append(opt.responseHeaders, names...) }
+}
+
+// ProxyTrustedProxies sets the reverse proxies, given as IPs or CIDR ranges,
+// whose X-Forwarded-For, X-Forwarded-Host, X-Forwarded-Proto and Forwarded
+// headers are passed upstream. By default, the headers, which any client can
+// set, are replaced by the ones of the Proxy.
+func ProxyTrustedProxies(proxies ...string) ProxyOption {
+	return func(opt *proxyOption) { opt.trustedProxies = proxies }
+}
+
+// forwardingHeaders are the headers reporting the original client, host and
+// protocol of a request, only kept from trusted proxies.
+var forwardingHeaders = []string{
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Forwarded-Host",
+	"X-Forwarded-Proto",
+}
+
+// Proxy forwards requests to an upstream URL as an endpoint, so proxied routes
+// get the endpoint middlewares (auth, logging, rate limiting...) and the
+// server options (before and after funcs, finalizers...) of native ones.
+// Request and response bodies are streamed.
+type Proxy struct {
+	target          *url.URL
+	client          *http.Client
+	rewrite         func(path string) string
+	requestHeaders  []string
+	responseHeaders []string
+	trusted         TrustedProxies
+}
+
+// NewProxy creates a Proxy forwarding requests to target, whose path
+// prefixes the path of the requests. It panics when a trusted proxy is
+// invalid.
+func NewProxy(target *url.URL, options ...ProxyOption) *Proxy {
+	opts := &proxyOption{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	trusted, err := ParseTrustedProxies(opts.trustedProxies...)
+	if err != nil {
+		panic(err)
+	}
+
+	if opts.client == nil {
+		opts.client = &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+
+	return &Proxy{
+		target:          target,
+		client:          opts.client,
+		rewrite:         opts.rewrite,
+		requestHeaders:  opts.requestHeaders,
+		responseHeaders: opts.responseHeaders,
+		trusted:         trusted,
+	}
+}
+
+// Handler returns a Server forwarding requests through the Proxy, its
+// endpoint wrapped by middleware when not nil.
+func (p *Proxy) Handler(middleware api.Middleware[*http.Request, *http.Response], options ...ServerOption) *Server[*http.Request, *http.Response] {
+	e := api.Endpoint[*http.Request, *http.Response](p.Endpoint)
+	if middleware != nil {
+		e = middleware(e)
+	}
+
+	return NewServer(e, DecodeProxyRequest, EncodeProxyResponse, options...)
+}
+
+// Endpoint sends r upstream and returns the response, whose body must be
+// closed, as EncodeProxyResponse does.
+func (p *Proxy) Endpoint(ctx context.Context, r *http.Request) (*http.Response, error) {
+	out := r.Clone(ctx)
+	out.RequestURI = ""
+	out.Host = ""
+	if r.ContentLength == 0 {
+		out.Body = nil
+	}
+
+	path := r.URL.Path
+	if p.rewrite != nil {
+		path = p.rewrite(path)
+	}
+
+	u := *p.target
+	u.Path = joinURLPath(p.target.Path, path)
+	u.RawPath = ""
+	switch {
+	case p.target.RawQuery == "":
+		u.RawQuery = r.URL.RawQuery
+	case r.URL.RawQuery != "":
+		u.RawQuery = p.target.RawQuery + "&" + r.URL.RawQuery
+	}
+	out.URL = &u
+
+	removeHopHeaders(out.Header)
+	for _, name := range p.requestHeaders {
+		out.Header.Del(name)
+	}
+
+	if !p.trusted.Trusts(r.RemoteAddr) {
+		for _, name := range forwardingHeaders {
+			out.Header.Del(name)
+		}
+	}
+
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := out.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+			ip = strings.Join(prior, ", ") + ", " + ip
+		}
+		out.Header.Set("X-Forwarded-For", ip)
+	}
+	if out.Header.Get("X-Forwarded-Host") == "" {
+		out.Header.Set("X-Forwarded-Host", r.Host)
+	}
+	if out.Header.Get("X-Forwarded-Proto") == "" {
+		proto := "http"
+		if r.TLS != nil {
+			proto = "https"
+		}
+		out.Header.Set("X-Forwarded-Proto", proto)
+	}
+
+	resp, err := p.client.Do(out)
+	if err != nil {
+		return nil, &UpstreamError{URL: p.target.Redacted(), Err: err}
+	}
+
+	removeHopHeaders(resp.Header)
+	for _, name := range p.responseHeaders {
+		resp.Header.Del(name)
+	}
+
+	return resp, nil
+}
+
+// DecodeProxyRequest is the DecodeRequestFunc of proxied routes, passing the
+// request as is.
+func DecodeProxyRequest(ctx context.Context, r *http.Request) (*http.Request, error) {
+	return r, nil
+}
+
+// EncodeProxyResponse is the EncodeResponseFunc of proxied routes, copying the
+// upstream response to w. Bodies of unknown length, such as event streams,
+// are flushed as they arrive.
+func EncodeProxyResponse(ctx context.Context, w http.ResponseWriter, resp *http.Response) error {
+	defer resp.Body.Close()
+
+	for k, values := range resp.Header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	for k := range resp.Trailer {
+		w.Header().Add("Trailer", k)
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	var err error
+	flusher, ok := w.(http.Flusher)
+	if ok && resp.ContentLength < 0 {
+		err = copyFlushing(w, flusher, resp.Body)
+	} else {
+		_, err = io.Copy(w, resp.Body)
+	}
+	if err != nil {
+		return err
+	}
+
+	for k, values := range resp.Trailer {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+
+	return nil
+}
+
+func copyFlushing(w io.Writer, flusher http.Flusher, r io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			flusher.Flush()
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, f := range h.Values("Connection") {
+		for _, name := range strings.Split(f, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+func joinURLPath(base, path string) string {
+	switch {
+	case base == "":
+		return path
+	case path == "" || path == "/":
+		if strings.HasSuffix(base, "/") || path == "" {
+			return base
+		}
+		return base + "/"
+	}
+
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(path, "/")
+}
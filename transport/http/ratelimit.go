@@ -0,0 +1,130 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// ClientIPKeyFunc is an api.KeyFunc that keys rate limits by client IP: the
+// host of the remote address captured by PopulateRequestContext. The
+// X-Forwarded-For header, which any client can set, is ignored; behind
+// proxies, use MakeClientIPKeyFunc with their addresses.
+func ClientIPKeyFunc(ctx context.Context) string {
+	addr, _ := ctx.Value(ContextKeyRequestRemoteAddr).(string)
+	return remoteHost(addr)
+}
+
+// MakeClientIPKeyFunc returns an api.KeyFunc that keys rate limits by client
+// IP, for the services behind the proxies trustedProxies, given as IPs or
+// CIDR ranges. When the remote address is one of them, the addresses of the
+// X-Forwarded-For header are walked from the right, as appended by the
+// proxies, and the first one which is not a trusted proxy is the client IP.
+// It panics when a trusted proxy is invalid.
+func MakeClientIPKeyFunc(trustedProxies ...string) api.KeyFunc {
+	trusted, err := ParseTrustedProxies(trustedProxies...)
+	if err != nil {
+		panic(err)
+	}
+
+	return func(ctx context.Context) string {
+		xff, _ := ctx.Value(ContextKeyRequestXForwardedFor).(string)
+		addr, _ := ctx.Value(ContextKeyRequestRemoteAddr).(string)
+		return trusted.clientIP(xff, addr)
+	}
+}
+
+// TrustedProxies are the networks of the reverse proxies whose forwarding
+// headers, such as X-Forwarded-For, are trusted.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses the trusted proxies given as IPs or CIDR ranges.
+func ParseTrustedProxies(proxies ...string) (TrustedProxies, error) {
+	trusted := make(TrustedProxies, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			trusted = append(trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		trusted = append(trusted, network)
+	}
+
+	return trusted, nil
+}
+
+// Trusts reports whether the remote address addr, such as the RemoteAddr of
+// a request, is one of the trusted proxies.
+func (t TrustedProxies) Trusts(addr string) bool {
+	ip := net.ParseIP(remoteHost(addr))
+	return ip != nil && t.contains(ip)
+}
+
+func (t TrustedProxies) contains(ip net.IP) bool {
+	for _, network := range t {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the client IP of a request from the remote address addr,
+// and the X-Forwarded-For header value xff when addr is a trusted proxy.
+func (t TrustedProxies) clientIP(xff, addr string) string {
+	client := remoteHost(addr)
+	ip := net.ParseIP(client)
+	if ip == nil || !t.contains(ip) {
+		return client
+	}
+
+	entries := strings.Split(xff, ",")
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := strings.TrimSpace(entries[i])
+		if ip = net.ParseIP(entry); ip == nil {
+			break
+		}
+
+		client = entry
+		if !t.contains(ip) {
+			break
+		}
+	}
+
+	return client
+}
+
+// remoteHost returns the host of the remote address addr.
+func remoteHost(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// clientIP returns the first address of the X-Forwarded-For header value xff
+// when there is one, and the host of the remote address addr otherwise. It is
+// informative only, any client being able to set the header.
+func clientIP(xff, addr string) string {
+	if xff != "" {
+		ip, _, _ := strings.Cut(xff, ",")
+		return strings.TrimSpace(ip)
+	}
+
+	return remoteHost(addr)
+}
@@ -0,0 +1,68 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+)
+
+// BufferBody returns a RequestFunc capturing the request body in the
+// context, for RawBodyFromContext, such as for middlewares checking
+// signatures or recording requests. The body is replayed, so the decoder
+// still reads it whole. Bodies larger than maxSize bytes are not captured,
+// and are replayed as they are; a maxSize lower than 1 captures bodies of
+// any size.
+func BufferBody(maxSize int64) RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		if r.Body == nil || r.Body == http.NoBody {
+			return context.WithValue(ctx, ContextKeyRawBody, []byte{})
+		}
+
+		reader := io.Reader(r.Body)
+		if maxSize > 0 {
+			reader = io.LimitReader(r.Body, maxSize+1)
+		}
+		buf, err := io.ReadAll(reader)
+
+		// what was read is replayed, followed by the rest of the body, or
+		// the read error
+		rest := io.Reader(r.Body)
+		if err != nil {
+			rest = errReader{err: err}
+		}
+		r.Body = &replayedBody{Reader: io.MultiReader(bytes.NewReader(buf), rest), Closer: r.Body}
+
+		if err != nil || (maxSize > 0 && int64(len(buf)) > maxSize) {
+			return ctx
+		}
+		return context.WithValue(ctx, ContextKeyRawBody, buf)
+	}
+}
+
+// ServerBufferBody captures the request bodies of up to maxSize bytes in the
+// context, like BufferBody, before the ServerBefore functions run.
+func ServerBufferBody(maxSize int64) ServerOption {
+	return func(s *serverOption) { s.bufferBody = BufferBody(maxSize) }
+}
+
+// RawBodyFromContext returns the request body captured by BufferBody. It
+// reports false when the body was not captured, such as when it was too
+// large.
+func RawBodyFromContext(ctx context.Context) ([]byte, bool) {
+	body, ok := ctx.Value(ContextKeyRawBody).([]byte)
+	return body, ok
+}
+
+type replayedBody struct {
+	io.Reader
+	io.Closer
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -45,7 +45,8 @@ func SetRequestHeader(key, val string) RequestFunc {
 
 // PopulateRequestContext is a RequestFunc that populates several values into
 // the context from the HTTP request. Those values may be extracted using the
-// corresponding ContextKey type in this package.
+// corresponding ContextKey type in this package, or all at once with
+// RequestInfoFromContext.
 func PopulateRequestContext(ctx context.Context, r *http.Request) context.Context {
 	scheme := "https"
 	if r.TLS == nil {
@@ -74,5 +75,5 @@ func PopulateRequestContext(ctx context.Context, r *http.Request) context.Contex
 	} {
 		ctx = context.WithValue(ctx, k, v)
 	}
-	return ctx
+	return context.WithValue(ctx, ContextKeyRequestInfo, newRequestInfo(r))
 }
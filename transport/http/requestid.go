@@ -0,0 +1,103 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/likearthian/go-http/router"
+)
+
+// maxRequestIDLength bounds the incoming request ids kept by
+// MakeHttpRequestIDMiddleware, so clients can't flood the logs.
+const maxRequestIDLength = 128
+
+// NewRequestID returns a new UUIDv7: a millisecond timestamp followed by
+// random bits, so ids sort by creation time.
+func NewRequestID() string {
+	var u [16]byte
+	binary.BigEndian.PutUint64(u[:8], uint64(time.Now().UnixMilli())<<16)
+	_, _ = rand.Read(u[6:])
+	u[6] = u[6]&0x0f | 0x70
+	u[8] = u[8]&0x3f | 0x80
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+
+	return string(buf[:])
+}
+
+// MakeHttpRequestIDMiddleware returns an http middleware giving every request
+// an id: the X-Request-Id header sent by the client, or a new UUIDv7 when it
+// is missing or invalid. The id is stored in the context under
+// ContextKeyRequestXRequestID, set back on the request header for
+// PopulateRequestContext, and sent in the X-Request-Id response header.
+func MakeHttpRequestIDMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(HeaderXRequestID)
+			if !validRequestID(id) {
+				id = NewRequestID()
+				r.Header.Set(HeaderXRequestID, id)
+			}
+
+			w.Header().Set(HeaderXRequestID, id)
+			ctx := context.WithValue(r.Context(), ContextKeyRequestXRequestID, id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestIDFromContext returns the request id stored under
+// ContextKeyRequestXRequestID.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(ContextKeyRequestXRequestID).(string)
+	return id, ok && id != ""
+}
+
+// withRequestID returns ctx with a request id under
+// ContextKeyRequestXRequestID, unless it already has one there, or from chi's
+// RequestID middleware or the go-http router. The id generated is kept in
+// *id, so a request gets the same one when called again.
+func withRequestID(ctx context.Context, id *string) context.Context {
+	if _, ok := RequestIDFromContext(ctx); ok {
+		return ctx
+	}
+	if middleware.GetReqID(ctx) != "" {
+		return ctx
+	}
+	if rid, ok := router.ReqIDFromContext(ctx); ok && rid != "" {
+		return ctx
+	}
+
+	if *id == "" {
+		*id = NewRequestID()
+	}
+	return context.WithValue(ctx, ContextKeyRequestXRequestID, *id)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// RequestInfo gathers the details of a request, as captured by
+// PopulateRequestContext, so they can be read with RequestInfoFromContext
+// rather than through one context key each.
+type RequestInfo struct {
+	Method     string
+	URI        string
+	Path       string
+	Proto      string
+	Host       string
+	Scheme     string
+	RemoteAddr string
+
+	// ClientIP is the first address of the X-Forwarded-For header, or the
+	// host of RemoteAddr.
+	ClientIP string
+
+	// ForwardedFor lists the addresses of the X-Forwarded-For header.
+	ForwardedFor   []string
+	ForwardedProto string
+
+	UserAgent      string
+	Referer        string
+	Accept         string
+	AcceptEncoding string
+
+	// RequestID is the id of the request, as set by
+	// MakeHttpRequestIDMiddleware, or else its X-Request-Id header.
+	RequestID string
+	TraceID   string
+
+	// Claims are the claims of the authenticated caller, stored under
+	// api.ContextKeyAuthClaims, if any, such as *api.TokenClaims.
+	Claims interface{}
+
+	// Tenant is the tenant of the caller, if any.
+	Tenant *api.Tenant
+}
+
+// newRequestInfo captures the details of r.
+func newRequestInfo(r *http.Request) *RequestInfo {
+	info := &RequestInfo{
+		Method:         r.Method,
+		URI:            r.RequestURI,
+		Path:           r.URL.Path,
+		Proto:          r.Proto,
+		Host:           r.Host,
+		Scheme:         "https",
+		RemoteAddr:     r.RemoteAddr,
+		ForwardedProto: r.Header.Get(HeaderXForwardedProto),
+		UserAgent:      r.Header.Get("User-Agent"),
+		Referer:        r.Header.Get("Referer"),
+		Accept:         r.Header.Get(HeaderAccept),
+		AcceptEncoding: r.Header.Get(HeaderAcceptEncoding),
+		RequestID:      r.Header.Get(HeaderXRequestID),
+		TraceID:        r.Header.Get("X-Trace-Id"),
+	}
+	if r.TLS == nil {
+		info.Scheme = "http"
+	}
+
+	xff := r.Header.Get(HeaderXForwardedFor)
+	for _, ip := range strings.Split(xff, ",") {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			info.ForwardedFor = append(info.ForwardedFor, ip)
+		}
+	}
+	info.ClientIP = clientIP(xff, r.RemoteAddr)
+
+	return info
+}
+
+// RequestInfoFromContext returns the RequestInfo stored by
+// PopulateRequestContext. Its RequestID, Claims and Tenant reflect ctx, so
+// they include the values set after PopulateRequestContext ran, such as by
+// the authentication middlewares of the endpoint.
+func RequestInfoFromContext(ctx context.Context) (RequestInfo, bool) {
+	stored, ok := ctx.Value(ContextKeyRequestInfo).(*RequestInfo)
+	if !ok {
+		return RequestInfo{}, false
+	}
+
+	info := *stored
+	if id, ok := RequestIDFromContext(ctx); ok {
+		info.RequestID = id
+	}
+	info.Claims = ctx.Value(api.ContextKeyAuthClaims)
+	info.Tenant, _ = api.GetTenantFromContext(ctx)
+
+	return info, true
+}
@@ -0,0 +1,147 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/openapi"
+)
+
+// Router mounts Servers on method and path patterns, using chi for routing.
+// Handlers get their URL parameters and request details in the context, as
+// set by ChiURLParamIntoContext and PopulateRequestContext, and routes
+// registered with Route are recorded in the OpenAPI registry of the Router,
+// if any.
+type Router struct {
+	mux      chi.Router
+	prefix   string
+	registry *openapi.Registry
+}
+
+type routerOption struct {
+	registry *openapi.Registry
+}
+
+// RouterOption sets an optional parameter for NewRouter.
+type RouterOption func(opt *routerOption)
+
+// RouterOpenAPI sets the registry recording the operations of the routes.
+func RouterOpenAPI(registry *openapi.Registry) RouterOption {
+	return func(opt *routerOption) { opt.registry = registry }
+}
+
+// NewRouter creates an empty Router.
+func NewRouter(options ...RouterOption) *Router {
+	opts := &routerOption{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return &Router{
+		mux:      chi.NewRouter(),
+		registry: opts.registry,
+	}
+}
+
+// Route mounts s on method and pattern, a chi pattern such as
+// "/users/{id}", and records its operation, annotated with options, in the
+// OpenAPI registry of r.
+func Route[I, O any](r *Router, method, pattern string, s *Server[I, O], options ...openapi.OperationOption) {
+	r.Handle(method, pattern, s)
+
+	if r.registry != nil {
+		openapi.Register[I, O](r.registry, method, r.path(pattern), options...)
+	}
+}
+
+// RouteEndpoint mounts s on method and pattern as Route does, recording its
+// operation under the identity of info: its name as operation id, and its
+// summary, description and tags, applied before options.
+func RouteEndpoint[I, O any](r *Router, method, pattern string, info api.EndpointInfo, s *Server[I, O], options ...openapi.OperationOption) {
+	ops := []openapi.OperationOption{openapi.OperationID(info.Name)}
+	if info.Summary != "" {
+		ops = append(ops, openapi.Summary(info.Summary))
+	}
+	if info.Description != "" {
+		ops = append(ops, openapi.Description(info.Description))
+	}
+	if len(info.Tags) > 0 {
+		ops = append(ops, openapi.Tags(info.Tags...))
+	}
+
+	Route(r, method, pattern, s, append(ops, options...)...)
+}
+
+// Handle mounts h on method and pattern, without recording it in the OpenAPI
+// registry.
+func (r *Router) Handle(method, pattern string, h http.Handler) {
+	r.mux.Method(method, pattern, routeHandler(h))
+}
+
+// Mount attaches h, such as another Router or a file server, below pattern.
+func (r *Router) Mount(pattern string, h http.Handler) {
+	r.mux.Mount(pattern, h)
+}
+
+// Use appends middlewares to the stack of r, wrapping the routes of r and of
+// its groups. As with chi, they must be added before the routes.
+func (r *Router) Use(middlewares ...func(http.Handler) http.Handler) {
+	r.mux.Use(middlewares...)
+}
+
+// With returns a Router adding middlewares to the stack of r for the routes
+// registered on it.
+func (r *Router) With(middlewares ...func(http.Handler) http.Handler) *Router {
+	return &Router{mux: r.mux.With(middlewares...), prefix: r.prefix, registry: r.registry}
+}
+
+// Group calls fn with a Router sharing the path of r and having its own
+// middleware stack, inheriting that of r.
+func (r *Router) Group(fn func(g *Router)) *Router {
+	g := &Router{mux: r.mux.Group(nil), prefix: r.prefix, registry: r.registry}
+	if fn != nil {
+		fn(g)
+	}
+	return g
+}
+
+// Prefix calls fn with a Router whose routes are mounted below pattern, such
+// as "/v1" or "/users/{id}", and which has its own middleware stack.
+func (r *Router) Prefix(pattern string, fn func(sub *Router)) *Router {
+	sub := &Router{prefix: r.path(pattern), registry: r.registry}
+	sub.mux = r.mux.Route(pattern, func(mux chi.Router) {
+		sub.mux = mux
+		if fn != nil {
+			fn(sub)
+		}
+	})
+	return sub
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mux.ServeHTTP(w, req)
+}
+
+// path returns the full path of pattern, registered on r.
+func (r *Router) path(pattern string) string {
+	if r.prefix == "" {
+		return pattern
+	}
+	if pattern == "/" || pattern == "" {
+		return r.prefix
+	}
+
+	return strings.TrimSuffix(r.prefix, "/") + pattern
+}
+
+// routeHandler sets the URL parameters of the matched route and the request
+// details in the context of the requests to h.
+func routeHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := ChiURLParamIntoContext(req.Context(), req)
+		ctx = PopulateRequestContext(ctx, req)
+		h.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
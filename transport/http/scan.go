@@ -0,0 +1,218 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// UploadScanner inspects the content of uploaded files, for instance for
+// malware, before MakeMultipartDecoder hands them over. Scan reads r, the
+// content of the file called name, and returns an error wrapping
+// api.ErrUploadRejected to reject it. Other errors fail the request as is, so
+// uploads are not let through unscanned.
+type UploadScanner interface {
+	Scan(ctx context.Context, name string, r io.Reader) error
+}
+
+// NopUploadScanner is an UploadScanner accepting every file.
+type NopUploadScanner struct{}
+
+// Scan implements UploadScanner.
+func (NopUploadScanner) Scan(context.Context, string, io.Reader) error {
+	return nil
+}
+
+// UploadRejectedError is returned by MakeMultipartDecoder for files rejected
+// by its UploadScanner. It reports a 422 status code.
+type UploadRejectedError struct {
+	Field    string
+	Filename string
+	Err      error
+}
+
+func (e *UploadRejectedError) Error() string {
+	return fmt.Sprintf("file %q of field %q: %s", e.Filename, e.Field, e.Err)
+}
+
+func (e *UploadRejectedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *UploadRejectedError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// scanUpload streams r, the content of the file uploaded in field, to consume
+// while the scanner reads it, and returns once both are done. The scanner may
+// stop reading early: the rest of r is still consumed.
+func (opts *decoderOption) scanUpload(ctx context.Context, field, filename string, r io.Reader, consume func(io.Reader) error) error {
+	if opts.scanner == nil {
+		return consume(r)
+	}
+
+	pr, pw := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		err := opts.scanner.Scan(ctx, filename, pr)
+		// let consume go on when the scanner stops early
+		io.Copy(io.Discard, pr)
+		done <- err
+	}()
+
+	err := consume(io.TeeReader(r, pw))
+	pw.CloseWithError(err)
+
+	scanErr := <-done
+	if err != nil {
+		return err
+	}
+	if errors.Is(scanErr, api.ErrUploadRejected) {
+		return &UploadRejectedError{Field: field, Filename: filename, Err: scanErr}
+	}
+
+	return scanErr
+}
+
+// scannedFile scans the file uploaded in field while buffering it in a
+// temporary file, which is handed to the endpoint once accepted and removed on
+// Close.
+func (opts *decoderOption) scannedFile(ctx context.Context, field, filename string, r io.Reader) (io.ReadCloser, error) {
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return nil, err
+	}
+
+	err = opts.scanUpload(ctx, field, filename, r, func(r io.Reader) error {
+		_, err := io.Copy(tmp, r)
+		return err
+	})
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	return &tempFile{File: tmp}, nil
+}
+
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.File.Name())
+	return err
+}
+
+const clamAVChunkSize = 64 * 1024
+
+type clamAVOption struct {
+	timeout time.Duration
+}
+
+// ClamAVOption sets an optional parameter for NewClamAVScanner.
+type ClamAVOption func(opt *clamAVOption)
+
+// ClamAVTimeout sets the time allowed to scan a file, on top of the deadline
+// of the request context. Defaults to 1 minute.
+func ClamAVTimeout(d time.Duration) ClamAVOption {
+	return func(opt *clamAVOption) { opt.timeout = d }
+}
+
+// ClamAVScanner is an UploadScanner sending files to a clamd daemon over TCP
+// with the INSTREAM command.
+type ClamAVScanner struct {
+	addr    string
+	timeout time.Duration
+	dialer  net.Dialer
+}
+
+// NewClamAVScanner creates a ClamAVScanner for the clamd daemon listening at
+// addr, such as "localhost:3310".
+func NewClamAVScanner(addr string, options ...ClamAVOption) *ClamAVScanner {
+	opts := &clamAVOption{timeout: time.Minute}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return &ClamAVScanner{
+		addr:    addr,
+		timeout: opts.timeout,
+	}
+}
+
+// Scan implements UploadScanner. Infected files, and files larger than the
+// StreamMaxLength of clamd, are rejected.
+func (s *ClamAVScanner) Scan(ctx context.Context, name string, r io.Reader) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	conn, err := s.dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("clamav: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return fmt.Errorf("clamav: %w", err)
+	}
+
+	buf := make([]byte, 4+clamAVChunkSize)
+	for {
+		n, rerr := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				// clamd closes the connection once the stream exceeds its
+				// limit: its reply tells why
+				break
+			}
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return rerr
+		}
+	}
+
+	// a zero length chunk ends the stream
+	conn.Write([]byte{0, 0, 0, 0})
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return fmt.Errorf("clamav: %w", err)
+	}
+	reply = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(reply, "stream:"), "\x00"))
+
+	switch {
+	case reply == "OK":
+		return nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return fmt.Errorf("%w: %s detected", api.ErrUploadRejected, strings.TrimSuffix(reply, " FOUND"))
+	case strings.Contains(reply, "size limit exceeded"):
+		return fmt.Errorf("%w: file too large to be scanned", api.ErrUploadRejected)
+	default:
+		return fmt.Errorf("clamav: %s", reply)
+	}
+}
@@ -5,10 +5,15 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"runtime/debug"
+	"time"
 
 	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/apierror"
 	"github.com/likearthian/apikit/logger"
 	trxkit "github.com/likearthian/apikit/transport"
 )
@@ -22,6 +27,13 @@ type Server[I, O any] struct {
 	errorEncoder ErrorEncoder
 	finalizer    []ServerFinalizerFunc
 	errorHandler trxkit.ErrorHandler
+	maxBody      int64
+	timeout      time.Duration
+	recoverer    bool
+	reporter     PanicReporter
+	cacheControl string
+	bufferBody   RequestFunc
+	deprecated   *deprecatedEndpoint
 }
 
 type serverOption struct {
@@ -30,6 +42,13 @@ type serverOption struct {
 	errorEncoder ErrorEncoder
 	errorHandler trxkit.ErrorHandler
 	finalizer    []ServerFinalizerFunc
+	maxBody      int64
+	timeout      time.Duration
+	recoverer    bool
+	reporter     PanicReporter
+	cacheControl string
+	bufferBody   RequestFunc
+	deprecated   *deprecatedEndpoint
 }
 
 type ServerOption func(opt *serverOption)
@@ -40,7 +59,7 @@ func NewServer[I, O any](
 	enc EncodeResponseFunc[O],
 	options ...ServerOption,
 ) *Server[I, O] {
-	opts := &serverOption{}
+	opts := &serverOption{recoverer: true}
 	for _, option := range options {
 		option(opts)
 	}
@@ -54,6 +73,13 @@ func NewServer[I, O any](
 		before:       opts.before,
 		after:        opts.after,
 		finalizer:    opts.finalizer,
+		maxBody:      opts.maxBody,
+		timeout:      opts.timeout,
+		recoverer:    opts.recoverer,
+		reporter:     opts.reporter,
+		cacheControl: opts.cacheControl,
+		bufferBody:   opts.bufferBody,
+		deprecated:   opts.deprecated,
 	}
 
 	if opts.errorEncoder != nil {
@@ -102,12 +128,170 @@ func ServerFinalizer(f ...ServerFinalizerFunc) ServerOption {
 	return func(s *serverOption) { s.finalizer = append(s.finalizer, f...) }
 }
 
+// ServerMaxRequestBody limits request bodies to n bytes. Larger bodies fail
+// with a *RequestTooLargeError, encoded as a 413 response by the
+// DefaultErrorEncoder. By default, request bodies are not limited.
+func ServerMaxRequestBody(n int64) ServerOption {
+	return func(s *serverOption) { s.maxBody = n }
+}
+
+// ServerTimeout sets an overall deadline of d per request on the request
+// context. When the deadline passes before the endpoint returns, the request
+// fails with an *api.TimeoutError, encoded as a 504 response by the
+// DefaultErrorEncoder, without waiting for the endpoint. By default, requests
+// have no deadline.
+func ServerTimeout(d time.Duration) ServerOption {
+	return func(s *serverOption) { s.timeout = d }
+}
+
+// ServerCacheControl sets the Cache-Control header of successful responses
+// whose encoder or ServerAfter functions did not set one, for instance
+// "private, max-age=60". Use it with MakeHttpCacheMiddleware to let clients
+// revalidate with the ETag.
+func ServerCacheControl(directives string) ServerOption {
+	return func(s *serverOption) { s.cacheControl = directives }
+}
+
+// ServerRecoverer sets whether the Server recovers from panics of the decoder,
+// the endpoint and the encoder. A recovered panic is reported to the
+// PanicReporter, written as a *PanicError through the error encoder, and its
+// stack trace is stored under ContextKeyPanicStack for the finalizers. Enabled
+// by default; disable it to let panics reach the recovery of the router.
+func ServerRecoverer(enabled bool) ServerOption {
+	return func(s *serverOption) { s.recoverer = enabled }
+}
+
+// ServerPanicReporter sets the function panics recovered by the Server are
+// reported to, for instance to send them to an error tracker.
+func ServerPanicReporter(reporter PanicReporter) ServerOption {
+	return func(s *serverOption) { s.reporter = reporter }
+}
+
+// PanicReporter is called with the value and the stack trace of a panic
+// recovered by a Server.
+type PanicReporter func(ctx context.Context, recovered interface{}, stack []byte)
+
+// PanicError is written through the error encoder when a Server recovers from
+// a panic. It reports a 500 status code, and its message is the generic 500
+// status text, so the panic value doesn't reach the client. The error handler
+// gets it wrapped with the panic value and the stack trace.
+type PanicError struct {
+	Recovered interface{}
+	Stack     []byte
+}
+
+func (e *PanicError) Error() string {
+	return http.StatusText(http.StatusInternalServerError)
+}
+
+func (e *PanicError) StatusCode() int {
+	return http.StatusInternalServerError
+}
+
+// endpointPanic carries a panic of an endpoint running in its own goroutine
+// under ServerTimeout back to ServeHTTP, along with its stack trace.
+type endpointPanic struct {
+	recovered interface{}
+	stack     []byte
+}
+
+// RequestTooLargeError is returned by a Server with ServerMaxRequestBody when
+// the request body exceeds the limit. It wraps api.ErrRequestTooLarge and
+// reports a 413 status code.
+type RequestTooLargeError struct {
+	Limit int64
+}
+
+func (e *RequestTooLargeError) Error() string {
+	return fmt.Sprintf("%s: limit is %d bytes", api.ErrRequestTooLarge, e.Limit)
+}
+
+func (e *RequestTooLargeError) Unwrap() error {
+	return api.ErrRequestTooLarge
+}
+
+func (e *RequestTooLargeError) StatusCode() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+// limitedBody records whether the request body hit the limit of
+// http.MaxBytesReader, since decoders don't always wrap the read error.
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		b.exceeded = true
+	}
+	return n, err
+}
+
+// limitError replaces the errors caused by the body limit or the deadline of
+// the request with their typed errors.
+func (s Server[I, O]) limitError(ctx context.Context, err error, body *limitedBody) error {
+	if body != nil && body.exceeded {
+		return &RequestTooLargeError{Limit: s.maxBody}
+	}
+
+	if s.timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &api.TimeoutError{Timeout: s.timeout}
+	}
+
+	return err
+}
+
+// endpoint calls the endpoint, returning an *api.TimeoutError as soon as ctx
+// expires when ServerTimeout is set.
+func (s Server[I, O]) endpoint(ctx context.Context, request I) (O, error) {
+	if s.timeout <= 0 {
+		return s.e(ctx, request)
+	}
+
+	type result struct {
+		response O
+		err      error
+		panic    *endpointPanic
+	}
+
+	done := make(chan result, 1)
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				done <- result{panic: &endpointPanic{recovered: rec, stack: debug.Stack()}}
+			}
+		}()
+
+		response, err := s.e(ctx, request)
+		done <- result{response: response, err: err}
+	}()
+
+	select {
+	case res := <-done:
+		if res.panic != nil {
+			if !s.recoverer {
+				panic(res.panic.recovered)
+			}
+			panic(res.panic)
+		}
+		return res.response, res.err
+	case <-ctx.Done():
+		var empty O
+		return empty, &api.TimeoutError{Timeout: s.timeout}
+	}
+}
+
 // ServeHTTP implements http.Handler.
 func (s Server[I, O]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	// every request gets an id, so the encoders and logs can report it
+	var reqID string
+	ctx := withRequestID(r.Context(), &reqID)
 
 	if len(s.finalizer) > 0 {
-		iw := &interceptingWriter{w, http.StatusOK, 0}
+		iw := &interceptingWriter{ResponseWriter: w, code: http.StatusOK}
 		defer func() {
 			ctx = context.WithValue(ctx, ContextKeyResponseHeaders, iw.Header())
 			ctx = context.WithValue(ctx, ContextKeyResponseSize, iw.written)
@@ -118,19 +302,80 @@ func (s Server[I, O]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w = iw.reimplementInterfaces()
 	}
 
+	if s.recoverer {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			stack := debug.Stack()
+			if p, ok := rec.(*endpointPanic); ok {
+				rec, stack = p.recovered, p.stack
+			}
+
+			ctx = context.WithValue(ctx, ContextKeyPanicStack, stack)
+			if s.reporter != nil {
+				s.reporter(ctx, rec, stack)
+			}
+
+			err := &PanicError{Recovered: rec, Stack: stack}
+			s.errorHandler.Handle(ctx, fmt.Errorf("%w: panic: %v\n%s", err, rec, stack))
+			s.errorEncoder(ctx, err, w)
+		}()
+	}
+
+	if s.deprecated != nil {
+		s.deprecated.setHeaders(w.Header())
+	}
+
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	var body *limitedBody
+	if s.maxBody > 0 {
+		if r.ContentLength > s.maxBody {
+			err := &RequestTooLargeError{Limit: s.maxBody}
+			s.errorHandler.Handle(ctx, err)
+			s.errorEncoder(ctx, err, w)
+			return
+		}
+		body = &limitedBody{ReadCloser: http.MaxBytesReader(w, r.Body, s.maxBody)}
+		r.Body = body
+	}
+
+	if s.bufferBody != nil {
+		ctx = s.bufferBody(ctx, r)
+	}
+
 	for _, f := range s.before {
 		ctx = f(ctx, r)
 	}
+	// PopulateRequestContext stores the X-Request-Id header, even empty
+	ctx = withRequestID(ctx, &reqID)
+
+	if s.deprecated != nil {
+		s.deprecated.record(ctx, r)
+	}
 
 	request, err := s.dec(ctx, r)
 	if err != nil {
+		err = s.limitError(ctx, err, body)
 		s.errorHandler.Handle(ctx, err)
 		s.errorEncoder(ctx, err, w)
 		return
 	}
 
-	response, err := s.e(ctx, request)
+	response, err := s.endpoint(ctx, request)
 	if err != nil {
+		err = s.limitError(ctx, err, body)
 		s.errorHandler.Handle(ctx, err)
 		s.errorEncoder(ctx, err, w)
 		return
@@ -140,6 +385,15 @@ func (s Server[I, O]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		ctx = f(ctx, w)
 	}
 
+	if s.cacheControl != "" && w.Header().Get(HeaderCacheControl) == "" {
+		w.Header().Set(HeaderCacheControl, s.cacheControl)
+	}
+
+	if lastModified := setLastModified(w, response); notModified(r, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
 	if err := s.enc(ctx, w, response); err != nil {
 		s.errorHandler.Handle(ctx, err)
 		s.errorEncoder(ctx, err, w)
@@ -170,20 +424,14 @@ func NopRequestDecoder(ctx context.Context, r *http.Request) (interface{}, error
 // JSON object to the ResponseWriter. Many JSON-over-HTTP services can use it as
 // a sensible default. If the response implements Headerer, the provided headers
 // will be applied to the response. If the response implements StatusCoder, the
-// provided StatusCode will be used instead of 200.
-func EncodeJSONResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+// provided StatusCode will be used instead of 200. If the response implements
+// LastModifier, the Last-Modified header is set, and if it implements
+// CursorPaginator, the Link header.
+func EncodeJSONResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	if headerer, ok := response.(Headerer); ok {
-		for k, values := range headerer.Headers() {
-			for _, v := range values {
-				w.Header().Add(k, v)
-			}
-		}
-	}
-	code := http.StatusOK
-	if sc, ok := response.(StatusCoder); ok {
-		code = sc.StatusCode()
-	}
+	setLastModified(w, response)
+	setLinks(ctx, w, response)
+	code := ResponseStatus(w, response)
 	w.WriteHeader(code)
 	if code == http.StatusNoContent {
 		return nil
@@ -197,9 +445,19 @@ func EncodeJSONResponse(_ context.Context, w http.ResponseWriter, response inter
 // will be applied to the response. If the error implements json.Marshaler, and
 // the marshaling succeeds, a content type of application/json and the JSON
 // encoded form of the error will be used. If the error implements StatusCoder,
-// the provided StatusCode will be used instead of 500.
+// the provided StatusCode will be used instead of 500. Errors wrapping an
+// *apierror.Error are encoded as its JSON form with its status code. A status
+// mapped in apierror.DefaultStatusMapper takes precedence over all of them.
 func DefaultErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
 	contentType, body := "text/plain; charset=utf-8", []byte(err.Error())
+
+	var aerr *apierror.Error
+	if errors.As(err, &aerr) {
+		if jsonBody, marshalErr := json.Marshal(aerr); marshalErr == nil {
+			contentType, body = "application/json; charset=utf-8", jsonBody
+		}
+	}
+
 	if marshaler, ok := err.(json.Marshaler); ok {
 		if jsonBody, marshalErr := marshaler.MarshalJSON(); marshalErr == nil {
 			contentType, body = "application/json; charset=utf-8", jsonBody
@@ -216,6 +474,11 @@ func DefaultErrorEncoder(_ context.Context, err error, w http.ResponseWriter) {
 	code := http.StatusInternalServerError
 	if sc, ok := err.(StatusCoder); ok {
 		code = sc.StatusCode()
+	} else if aerr != nil {
+		code = aerr.StatusCode()
+	}
+	if status, ok := apierror.DefaultStatusMapper.Status(err); ok {
+		code = status
 	}
 	w.WriteHeader(code)
 	w.Write(body)
@@ -239,6 +502,9 @@ type interceptingWriter struct {
 	http.ResponseWriter
 	code    int
 	written int64
+
+	// capture, when set, records the start of the body
+	capture *cappedBuffer
 }
 
 // WriteHeader may not be explicitly called, so care must be taken to
@@ -251,6 +517,9 @@ func (w *interceptingWriter) WriteHeader(code int) {
 func (w *interceptingWriter) Write(p []byte) (int, error) {
 	n, err := w.ResponseWriter.Write(p)
 	w.written += int64(n)
+	if w.capture != nil {
+		w.capture.Write(p[:n])
+	}
 	return n, err
 }
 
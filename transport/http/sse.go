@@ -0,0 +1,175 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// ErrStreamingUnsupported is returned by the SSE encoder when the response
+// writer can't be flushed, which makes incremental delivery impossible.
+var ErrStreamingUnsupported = errors.New("response writer does not support flushing")
+
+// Event is a single Server-Sent Event. Channels of Event let endpoints control
+// the id, event name and retry hint of each message; any other element type is
+// sent as the data of an unnamed event.
+type Event struct {
+	ID    string
+	Event string
+	Data  interface{}
+	Retry time.Duration
+}
+
+type sseOption struct {
+	heartbeat time.Duration
+	retry     time.Duration
+	marshal   func(v interface{}) ([]byte, error)
+}
+
+// SSEOption sets an optional parameter for the SSE encoder.
+type SSEOption func(opt *sseOption)
+
+// SSEHeartbeat sets the interval at which comment lines are written to keep
+// idle connections open through proxies. Defaults to 15 seconds; zero disables
+// heartbeats.
+func SSEHeartbeat(d time.Duration) SSEOption {
+	return func(opt *sseOption) { opt.heartbeat = d }
+}
+
+// SSERetry sends a retry hint to the client when the stream opens.
+func SSERetry(d time.Duration) SSEOption {
+	return func(opt *sseOption) { opt.retry = d }
+}
+
+// SSEMarshaler sets the function used to serialize event data that is not a
+// string or []byte. Defaults to json.Marshal.
+func SSEMarshaler(fn func(v interface{}) ([]byte, error)) SSEOption {
+	return func(opt *sseOption) { opt.marshal = fn }
+}
+
+// MakeSSEResponseEncoder returns an EncodeResponseFunc that streams every value
+// received from the response channel as a Server-Sent Event, flushing after
+// each one. Streaming stops when the channel is closed or when the request
+// context is done, which happens when the client disconnects.
+func MakeSSEResponseEncoder[T any](options ...SSEOption) EncodeResponseFunc[<-chan T] {
+	opts := &sseOption{
+		heartbeat: 15 * time.Second,
+		marshal:   json.Marshal,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, events <-chan T) error {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			return ErrStreamingUnsupported
+		}
+
+		w.Header().Set(HeaderContentType, HttpContentTypeEventStream)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		if opts.retry > 0 {
+			fmt.Fprintf(w, "retry: %d\n\n", opts.retry.Milliseconds())
+		}
+		flusher.Flush()
+
+		var heartbeat <-chan time.Time
+		if opts.heartbeat > 0 {
+			ticker := time.NewTicker(opts.heartbeat)
+			defer ticker.Stop()
+			heartbeat = ticker.C
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-heartbeat:
+				if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+					return err
+				}
+				flusher.Flush()
+			case v, ok := <-events:
+				if !ok {
+					return nil
+				}
+				if err := writeEvent(w, toEvent(v), opts.marshal); err != nil {
+					return err
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+// NewSSEServer constructs a Server for an endpoint that returns a channel of
+// events, encoding it with MakeSSEResponseEncoder.
+func NewSSEServer[I, T any](
+	e api.Endpoint[I, <-chan T],
+	dec DecodeRequestFunc[I],
+	sseOptions []SSEOption,
+	options ...ServerOption,
+) *Server[I, <-chan T] {
+	return NewServer(e, dec, MakeSSEResponseEncoder[T](sseOptions...), options...)
+}
+
+func toEvent(v interface{}) Event {
+	switch ev := v.(type) {
+	case Event:
+		return ev
+	case *Event:
+		return *ev
+	}
+
+	return Event{Data: v}
+}
+
+func writeEvent(w io.Writer, ev Event, marshal func(v interface{}) ([]byte, error)) error {
+	var buf bytes.Buffer
+	if ev.ID != "" {
+		fmt.Fprintf(&buf, "id: %s\n", ev.ID)
+	}
+	if ev.Event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", ev.Event)
+	}
+	if ev.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(ev.Retry.Milliseconds(), 10) + "\n")
+	}
+
+	var data []byte
+	switch d := ev.Data.(type) {
+	case nil:
+	case string:
+		data = []byte(d)
+	case []byte:
+		data = d
+	default:
+		b, err := marshal(d)
+		if err != nil {
+			return err
+		}
+		data = b
+	}
+
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,345 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/likearthian/apikit/apierror"
+)
+
+// precompressed lists the encodings of the precompressed variants looked
+// up by the static handlers, by preference, with their file extension.
+var precompressed = []struct{ encoding, ext string }{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// StaticFile is a file of the file system of a Static handler, ready to be
+// served by EncodeStaticFile.
+type StaticFile struct {
+	Name         string
+	ContentType  string
+	Encoding     string
+	ETag         string
+	CacheControl string
+	ModTime      time.Time
+	Content      io.ReadSeeker
+
+	file    fs.File
+	request *http.Request
+	vary    bool
+}
+
+type staticOption struct {
+	indexFallback bool
+	stripPrefix   string
+	cacheControl  string
+	immutable     func(name string) bool
+}
+
+// StaticOption sets an optional parameter for NewStatic.
+type StaticOption func(opt *staticOption)
+
+// StaticIndexFallback serves index.html for the paths matching no file and
+// having no extension, so the routes of a single page application are
+// handled by its client side router.
+func StaticIndexFallback(fallback bool) StaticOption {
+	return func(opt *staticOption) { opt.indexFallback = fallback }
+}
+
+// StaticStripPrefix removes prefix from the request paths, such as "/assets"
+// for a handler mounted on "/assets/*".
+func StaticStripPrefix(prefix string) StaticOption {
+	return func(opt *staticOption) { opt.stripPrefix = strings.TrimSuffix(prefix, "/") }
+}
+
+// StaticCacheControl sets the Cache-Control header of the files which are not
+// immutable. Defaults to "no-cache", so clients revalidate them with their
+// ETag.
+func StaticCacheControl(value string) StaticOption {
+	return func(opt *staticOption) { opt.cacheControl = value }
+}
+
+// StaticImmutable sets the function reporting whether the file called name
+// is immutable, and can be cached for a year. By default, files whose name
+// carries a content hash, such as "app.3f2a9c1b.js" or "index-DiwrgTda.css",
+// are.
+func StaticImmutable(fn func(name string) bool) StaticOption {
+	return func(opt *staticOption) { opt.immutable = fn }
+}
+
+// Static serves the files of a file system, such as an embed.FS or
+// os.DirFS, with ETag and Last-Modified validators, range requests, and
+// their precompressed brotli (.br) or gzip (.gz) variant when there is one
+// and the client accepts it.
+type Static struct {
+	fsys fs.FS
+	opts *staticOption
+
+	// etags caches the content hashes of the files without modification
+	// time, such as those of an embed.FS, which never change.
+	etags sync.Map
+}
+
+// NewStatic creates a Static serving the files of fsys.
+func NewStatic(fsys fs.FS, options ...StaticOption) *Static {
+	opts := &staticOption{
+		cacheControl: "no-cache",
+		immutable:    hashedAssetName,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return &Static{fsys: fsys, opts: opts}
+}
+
+// StaticHandler returns a Server serving the files of fsys.
+func StaticHandler(fsys fs.FS, options ...ServerOption) *Server[*http.Request, *StaticFile] {
+	return NewStatic(fsys).Handler(options...)
+}
+
+// SPAHandler returns a Server serving the files of fsys, the build of a
+// single page application, falling back to its index.html for client side
+// routes when indexFallback is set.
+func SPAHandler(fsys fs.FS, indexFallback bool, options ...ServerOption) *Server[*http.Request, *StaticFile] {
+	return NewStatic(fsys, StaticIndexFallback(indexFallback)).Handler(options...)
+}
+
+// Handler returns a Server serving the files of s, so that they get the
+// finalizers, logging and other options of the other handlers.
+func (s *Static) Handler(options ...ServerOption) *Server[*http.Request, *StaticFile] {
+	return NewServer(s.Endpoint, decodeStaticRequest, EncodeStaticFile, options...)
+}
+
+func decodeStaticRequest(ctx context.Context, r *http.Request) (*http.Request, error) {
+	return r, nil
+}
+
+// Endpoint opens the file requested by r. Missing files fail with an
+// apierror.NotFound error.
+func (s *Static) Endpoint(ctx context.Context, r *http.Request) (*StaticFile, error) {
+	name := r.URL.Path
+	if s.opts.stripPrefix != "" {
+		name = strings.TrimPrefix(name, s.opts.stripPrefix)
+	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+
+	f, err := s.open(name, r)
+	if errors.Is(err, fs.ErrNotExist) && s.opts.indexFallback && path.Ext(name) == "" {
+		f, err = s.open("index.html", r)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, apierror.NotFound("file %s not found", r.URL.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// open opens name, or the index.html of the directory name, picking its
+// precompressed variant accepted by r, if any.
+func (s *Static) open(name string, r *http.Request) (*StaticFile, error) {
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		name = path.Join(name, "index.html")
+		if info, err = fs.Stat(s.fsys, name); err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return nil, fs.ErrNotExist
+		}
+	}
+
+	sf := &StaticFile{
+		Name:         name,
+		ContentType:  mime.TypeByExtension(path.Ext(name)),
+		CacheControl: s.opts.cacheControl,
+		ModTime:      info.ModTime(),
+		request:      r,
+	}
+	if s.opts.immutable(name) {
+		sf.CacheControl = immutableCacheControl
+	}
+
+	file := name
+	accepted := acceptedEncodings(r.Header.Get(HeaderAcceptEncoding))
+	for _, pc := range precompressed {
+		vinfo, err := fs.Stat(s.fsys, name+pc.ext)
+		if err != nil || vinfo.IsDir() {
+			continue
+		}
+		sf.vary = true
+
+		if accepted[pc.encoding] && sf.Encoding == "" {
+			file, info, sf.Encoding = name+pc.ext, vinfo, pc.encoding
+		}
+	}
+	if sf.Encoding != "" && sf.ContentType == "" {
+		// compressed content can't be sniffed
+		sf.ContentType = "application/octet-stream"
+	}
+
+	f, err := s.fsys.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	sf.file = f
+
+	if rs, ok := f.(io.ReadSeeker); ok {
+		sf.Content = rs
+	} else {
+		data, err := io.ReadAll(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		sf.Content = bytes.NewReader(data)
+	}
+
+	if sf.ETag, err = s.etag(file, info, sf.Content); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return sf, nil
+}
+
+// etag returns the ETag of file: a weak one derived from its size and
+// modification time when it has one, or else a strong one from the hash of
+// its content.
+func (s *Static) etag(file string, info fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if !info.ModTime().IsZero() {
+		return fmt.Sprintf(`W/"%x-%x"`, info.Size(), info.ModTime().UnixNano()), nil
+	}
+
+	if etag, ok := s.etags.Load(file); ok {
+		return etag.(string), nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	etag := `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+	s.etags.Store(file, etag)
+	return etag, nil
+}
+
+// EncodeStaticFile is the EncodeResponseFunc of the static handlers, serving
+// the file with http.ServeContent, which answers conditional and range
+// requests.
+func EncodeStaticFile(ctx context.Context, w http.ResponseWriter, f *StaticFile) error {
+	if f.file != nil {
+		defer f.file.Close()
+	}
+
+	h := w.Header()
+	if f.ContentType != "" {
+		h.Set(HeaderContentType, f.ContentType)
+	}
+	if f.Encoding != "" {
+		h.Set(HeaderContentEncoding, f.Encoding)
+	}
+	if f.vary {
+		h.Add(HeaderVary, HeaderAcceptEncoding)
+	}
+	if f.ETag != "" {
+		h.Set("ETag", f.ETag)
+	}
+	if f.CacheControl != "" {
+		h.Set(HeaderCacheControl, f.CacheControl)
+	}
+
+	r := f.request
+	if r == nil {
+		r = (&http.Request{Method: http.MethodGet, Header: http.Header{}}).WithContext(ctx)
+	}
+
+	http.ServeContent(w, r, path.Base(f.Name), f.ModTime, f.Content)
+	return nil
+}
+
+// acceptedEncodings returns the content codings accepted by an
+// Accept-Encoding header value.
+func acceptedEncodings(acceptEncoding string) map[string]bool {
+	accepted := make(map[string]bool)
+	wildcard := false
+	for _, spec := range parseQualityList(acceptEncoding) {
+		if spec.value == "*" {
+			wildcard = spec.q > 0
+			continue
+		}
+		accepted[spec.value] = spec.q > 0
+	}
+
+	for _, pc := range precompressed {
+		if _, ok := accepted[pc.encoding]; !ok {
+			accepted[pc.encoding] = wildcard
+		}
+	}
+
+	return accepted
+}
+
+// hashedAssetName reports whether name carries a content hash: a dot or dash
+// separated part, before its extension, of at least 8 letters, digits or
+// underscores, with a digit or an upper case letter.
+func hashedAssetName(name string) bool {
+	base := path.Base(name)
+	ext := path.Ext(base)
+	if ext == "" {
+		return false
+	}
+
+	parts := strings.FieldsFunc(strings.TrimSuffix(base, ext), func(r rune) bool {
+		return r == '.' || r == '-'
+	})
+	for _, part := range parts {
+		if len(part) < 8 {
+			continue
+		}
+
+		hashLike, mixed := true, false
+		for _, c := range part {
+			switch {
+			case c >= '0' && c <= '9', c >= 'A' && c <= 'Z':
+				mixed = true
+			case c >= 'a' && c <= 'z', c == '_':
+			default:
+				hashLike = false
+			}
+		}
+		if hashLike && mixed {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,96 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// CreatedResponse is a response sent with a 201 Created status, and a
+// Location header pointing at the created resource, unless empty. Its Value
+// is encoded in place of the CreatedResponse.
+type CreatedResponse[T any] struct {
+	Location string
+	Value    T
+}
+
+// Created returns the CreatedResponse of v, created at location.
+func Created[T any](location string, v T) CreatedResponse[T] {
+	return CreatedResponse[T]{Location: location, Value: v}
+}
+
+// StatusCode implements StatusCoder.
+func (r CreatedResponse[T]) StatusCode() int {
+	return http.StatusCreated
+}
+
+// Headers implements Headerer.
+func (r CreatedResponse[T]) Headers() http.Header {
+	if r.Location == "" {
+		return nil
+	}
+	return http.Header{"Location": {r.Location}}
+}
+
+// MarshalJSON encodes the value of the response.
+func (r CreatedResponse[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Value)
+}
+
+// AcceptedResponse is a response sent with a 202 Accepted status, for
+// requests processed asynchronously. Location, unless empty, points at the
+// status of the processing. Its Value is encoded in place of the
+// AcceptedResponse.
+type AcceptedResponse[T any] struct {
+	Location string
+	Value    T
+}
+
+// Accepted returns the AcceptedResponse of v, whose processing is monitored
+// at location.
+func Accepted[T any](location string, v T) AcceptedResponse[T] {
+	return AcceptedResponse[T]{Location: location, Value: v}
+}
+
+// StatusCode implements StatusCoder.
+func (r AcceptedResponse[T]) StatusCode() int {
+	return http.StatusAccepted
+}
+
+// Headers implements Headerer.
+func (r AcceptedResponse[T]) Headers() http.Header {
+	if r.Location == "" {
+		return nil
+	}
+	return http.Header{"Location": {r.Location}}
+}
+
+// MarshalJSON encodes the value of the response.
+func (r AcceptedResponse[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Value)
+}
+
+// NoContent is a response sent with a 204 No Content status, and no body.
+type NoContent struct{}
+
+// StatusCode implements StatusCoder.
+func (NoContent) StatusCode() int {
+	return http.StatusNoContent
+}
+
+// ResponseStatus adds the headers of a response implementing Headerer to w,
+// and returns the status of a response implementing StatusCoder, or 200. It
+// lets encoders honor the status and headers chosen by the endpoints.
+func ResponseStatus(w http.ResponseWriter, response interface{}) int {
+	if headerer, ok := response.(Headerer); ok {
+		for k, values := range headerer.Headers() {
+			for _, v := range values {
+				w.Header().Add(k, v)
+			}
+		}
+	}
+
+	if sc, ok := response.(StatusCoder); ok {
+		return sc.StatusCode()
+	}
+	return http.StatusOK
+}
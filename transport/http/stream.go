@@ -0,0 +1,201 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// Iterator yields the elements of a streamed response one at a time, in the
+// manner of sql.Rows. Next advances to the following element and reports
+// whether there is one; once it returns false, Err reports the error that
+// stopped the iteration, if any.
+type Iterator[T any] interface {
+	Next(ctx context.Context) bool
+	Value() T
+	Err() error
+}
+
+// NewIterator returns an Iterator calling next for every element. next
+// returns false once the sequence is exhausted, or a non-nil error to abort it.
+func NewIterator[T any](next func(ctx context.Context) (T, bool, error)) Iterator[T] {
+	return &funcIterator[T]{next: next}
+}
+
+// ChanIterator returns an Iterator receiving elements from ch until it is
+// closed or the context passed to Next is done.
+func ChanIterator[T any](ch <-chan T) Iterator[T] {
+	return NewIterator(func(ctx context.Context) (T, bool, error) {
+		select {
+		case <-ctx.Done():
+			var zero T
+			return zero, false, ctx.Err()
+		case v, ok := <-ch:
+			return v, ok, nil
+		}
+	})
+}
+
+// SliceIterator returns an Iterator over the elements of s.
+func SliceIterator[T any](s []T) Iterator[T] {
+	i := 0
+	return NewIterator(func(ctx context.Context) (T, bool, error) {
+		if i >= len(s) {
+			var zero T
+			return zero, false, nil
+		}
+		i++
+		return s[i-1], true, nil
+	})
+}
+
+type funcIterator[T any] struct {
+	next  func(ctx context.Context) (T, bool, error)
+	value T
+	err   error
+	done  bool
+}
+
+func (it *funcIterator[T]) Next(ctx context.Context) bool {
+	if it.done {
+		return false
+	}
+
+	v, ok, err := it.next(ctx)
+	if err != nil || !ok {
+		var zero T
+		it.value, it.err, it.done = zero, err, true
+		return false
+	}
+
+	it.value = v
+	return true
+}
+
+func (it *funcIterator[T]) Value() T {
+	return it.value
+}
+
+func (it *funcIterator[T]) Err() error {
+	return it.err
+}
+
+type streamOption struct {
+	flushEvery int
+	marshal    func(v interface{}) ([]byte, error)
+}
+
+// StreamOption sets an optional parameter for the streaming encoders.
+type StreamOption func(opt *streamOption)
+
+func newStreamOption(options []StreamOption) *streamOption {
+	opts := &streamOption{
+		flushEvery: 100,
+		marshal:    json.Marshal,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return opts
+}
+
+// StreamFlushEvery sets how many elements are written between flushes of the
+// response writer. Defaults to 100; values below 1 flush after every element.
+func StreamFlushEvery(n int) StreamOption {
+	return func(opt *streamOption) { opt.flushEvery = n }
+}
+
+// StreamMarshaler sets the function used to serialize each element. Defaults
+// to json.Marshal.
+func StreamMarshaler(fn func(v interface{}) ([]byte, error)) StreamOption {
+	return func(opt *streamOption) { opt.marshal = fn }
+}
+
+// StreamingJSONResponseEncoder is an EncodeResponseFunc writing the elements of
+// the iterator as a JSON array, using the default stream options.
+func StreamingJSONResponseEncoder[T any](ctx context.Context, w http.ResponseWriter, response Iterator[T]) error {
+	return MakeStreamingJSONResponseEncoder[T]()(ctx, w, response)
+}
+
+// MakeStreamingJSONResponseEncoder returns an EncodeResponseFunc that writes
+// the elements of the iterator as a JSON array one at a time, flushing
+// periodically, so the whole result set never has to be held in memory. The
+// response is compressed when the client accepts it.
+//
+// The status line is sent before the first element, so an iteration or
+// marshaling error can no longer change it. In that case the array is left
+// unterminated, which clients see as a malformed body, and the error is
+// returned to the Server.
+func MakeStreamingJSONResponseEncoder[T any](options ...StreamOption) EncodeResponseFunc[Iterator[T]] {
+	opts := newStreamOption(options)
+
+	return func(ctx context.Context, w http.ResponseWriter, it Iterator[T]) error {
+		w.Header().Set(HeaderContentType, HttpContentTypeJson)
+		return writeStream(ctx, w, it, opts, "[", ",", "]\n")
+	}
+}
+
+// writeStream marshals every element of it to w, writing open before the
+// first element, sep between elements and end after the last one. end is not
+// written when the iteration fails.
+func writeStream[T any](ctx context.Context, w http.ResponseWriter, it Iterator[T], opts *streamOption, open, sep, end string) error {
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	out, flush, done := compressWriter(ctx, w, -1)
+	defer done()
+	w.WriteHeader(http.StatusOK)
+
+	bw := bufio.NewWriter(out)
+	flushAll := func() error {
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	if _, err := bw.WriteString(open); err != nil {
+		return err
+	}
+
+	n := 0
+	for it.Next(ctx) {
+		b, err := opts.marshal(it.Value())
+		if err != nil {
+			bw.Flush()
+			return err
+		}
+
+		if n > 0 {
+			bw.WriteString(sep)
+		}
+		if _, err := bw.Write(b); err != nil {
+			return err
+		}
+
+		n++
+		if opts.flushEvery < 1 || n%opts.flushEvery == 0 {
+			if err := flushAll(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		bw.Flush()
+		return err
+	}
+
+	if _, err := bw.WriteString(end); err != nil {
+		return err
+	}
+
+	return flushAll()
+}
@@ -0,0 +1,23 @@
+package http
+
+import (
+	"context"
+	"net/http"
+)
+
+// URLParamsIntoContext returns a RequestFunc storing the URL parameters
+// returned by vars in the context under ContextKeyURLParams, the key the
+// decoders of this package read them from, for routers other than chi. With
+// gorilla/mux:
+//
+//	httptransport.ServerBefore(httptransport.URLParamsIntoContext(mux.Vars))
+func URLParamsIntoContext(vars func(*http.Request) map[string]string) RequestFunc {
+	return func(ctx context.Context, r *http.Request) context.Context {
+		params := make(map[string]string)
+		for k, v := range vars(r) {
+			params[k] = v
+		}
+
+		return context.WithValue(ctx, ContextKeyURLParams, params)
+	}
+}
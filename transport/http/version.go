@@ -0,0 +1,264 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// UnsupportedVersionError is written by VersionedHandler for the requests of
+// a version it has no handler for. It wraps api.ErrBadRequest and reports a
+// 400 status code.
+type UnsupportedVersionError struct {
+	Version string
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("%s: unsupported API version %q", api.ErrBadRequest, e.Version)
+}
+
+func (e *UnsupportedVersionError) Unwrap() error {
+	return api.ErrBadRequest
+}
+
+func (e *UnsupportedVersionError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+type versionOption struct {
+	vendor string
+	header string
+	def    string
+}
+
+// VersionOption sets an optional parameter for VersionIntoContext and
+// NewVersionedHandler.
+type VersionOption func(opt *versionOption)
+
+// VersionVendor restricts the media types carrying a version in the Accept
+// header to those of vendor, application/vnd.<vendor>.v2+json. By default,
+// the media types of any vendor do.
+func VersionVendor(vendor string) VersionOption {
+	return func(opt *versionOption) { opt.vendor = strings.ToLower(vendor) }
+}
+
+// VersionHeader sets the request header carrying the version. Defaults to
+// X-Api-Version; an empty name disables it.
+func VersionHeader(name string) VersionOption {
+	return func(opt *versionOption) { opt.header = name }
+}
+
+// DefaultVersion sets the version of the requests which don't ask for one.
+// For VersionedHandler, it defaults to the last version registered.
+func DefaultVersion(version string) VersionOption {
+	return func(opt *versionOption) { opt.def = normalizeVersion(version) }
+}
+
+func makeVersionOption(options []VersionOption) *versionOption {
+	opts := &versionOption{header: HeaderAPIVersion}
+	for _, option := range options {
+		option(opts)
+	}
+	return opts
+}
+
+// requestedVersion returns the version requested by r, from the prefix of
+// its path (/v2/...), the vendor media type of its Accept header
+// (application/vnd.myapi.v2+json) or its version header, in that order, or
+// "" when it doesn't ask for one.
+func requestedVersion(r *http.Request, opts *versionOption) string {
+	segment, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if isVersion(segment) {
+		return normalizeVersion(segment)
+	}
+
+	for _, item := range parseQualityList(r.Header.Get(HeaderAccept)) {
+		if v := vendorVersion(item.value, opts.vendor); v != "" {
+			return v
+		}
+	}
+
+	if opts.header != "" {
+		if v := strings.TrimSpace(r.Header.Get(opts.header)); v != "" {
+			return normalizeVersion(v)
+		}
+	}
+
+	return ""
+}
+
+// vendorVersion returns the version of a media type such as
+// application/vnd.myapi.v2+json, if it is one of vendor, or any vendor when
+// vendor is empty.
+func vendorVersion(mediaType, vendor string) string {
+	mediaType, _, _ = strings.Cut(mediaType, ";")
+	rest := strings.TrimPrefix(strings.TrimSpace(mediaType), "application/vnd.")
+	if rest == mediaType {
+		return ""
+	}
+	rest, _, _ = strings.Cut(rest, "+")
+
+	i := strings.LastIndex(rest, ".")
+	if i < 0 || !isVersion(rest[i+1:]) {
+		return ""
+	}
+	if vendor != "" && rest[:i] != vendor {
+		return ""
+	}
+
+	return normalizeVersion(rest[i+1:])
+}
+
+// isVersion reports whether s is a v followed by a number, such as v2.
+func isVersion(s string) bool {
+	if len(s) < 2 || (s[0] != 'v' && s[0] != 'V') {
+		return false
+	}
+	_, err := strconv.ParseUint(s[1:], 10, 32)
+	return err == nil
+}
+
+// normalizeVersion removes the v prefix of a version: v2 and 2 are the same
+// version.
+func normalizeVersion(v string) string {
+	if isVersion(v) {
+		return v[1:]
+	}
+	return v
+}
+
+// VersionIntoContext returns a RequestFunc storing the API version requested,
+// from the prefix of the request path (/v2/...), the vendor media type of the
+// Accept header (application/vnd.myapi.v2+json) or the X-Api-Version header,
+// in that order, for VersionFromContext. Versions are stored without their v
+// prefix, such as "2".
+func VersionIntoContext(options ...VersionOption) RequestFunc {
+	opts := makeVersionOption(options)
+
+	return func(ctx context.Context, r *http.Request) context.Context {
+		v := requestedVersion(r, opts)
+		if v == "" {
+			v = opts.def
+		}
+		if v == "" {
+			return ctx
+		}
+		return context.WithValue(ctx, ContextKeyAPIVersion, v)
+	}
+}
+
+// VersionFromContext returns the API version stored by VersionIntoContext or
+// VersionedHandler.
+func VersionFromContext(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(ContextKeyAPIVersion).(string)
+	return v, ok
+}
+
+// Deprecation describes a deprecated version of an API, announced to its
+// clients with the Deprecation and Sunset response headers.
+type Deprecation struct {
+	// Since is when the version was deprecated. When zero, the Deprecation
+	// header is "true".
+	Since time.Time
+
+	// Sunset is when the version will stop being served, if known.
+	Sunset time.Time
+
+	// Link, if not empty, points at the documentation of the deprecation.
+	Link string
+}
+
+func (d Deprecation) setHeaders(h http.Header) {
+	if d.Since.IsZero() {
+		h.Set(HeaderDeprecation, "true")
+	} else {
+		h.Set(HeaderDeprecation, "@"+strconv.FormatInt(d.Since.Unix(), 10))
+	}
+	if !d.Sunset.IsZero() {
+		h.Set(HeaderSunset, d.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.Link != "" {
+		h.Add(HeaderLink, fmt.Sprintf(`<%s>; rel="deprecation"`, d.Link))
+	}
+}
+
+// VersionedHandler dispatches the requests to the handler of the API version
+// they ask for, as VersionIntoContext finds it, such as the Servers of the
+// same route in two versions:
+//
+//	h := httptransport.NewVersionedHandler(httptransport.VersionVendor("myapi"))
+//	h.Handle("1", getUserV1)
+//	h.Handle("2", getUserV2)
+//	h.Deprecate("1", httptransport.Deprecation{Sunset: sunset})
+//
+// The version is stored in the request context, for VersionFromContext, and
+// echoed in the version header of the response. Requests for a version with
+// no handler get a 400 response, written with DefaultErrorEncoder.
+type VersionedHandler struct {
+	opts         *versionOption
+	handlers     map[string]http.Handler
+	deprecations map[string]Deprecation
+	latest       string
+}
+
+// NewVersionedHandler creates a VersionedHandler without versions.
+func NewVersionedHandler(options ...VersionOption) *VersionedHandler {
+	return &VersionedHandler{
+		opts:         makeVersionOption(options),
+		handlers:     make(map[string]http.Handler),
+		deprecations: make(map[string]Deprecation),
+	}
+}
+
+// Handle registers h as the handler of version, which becomes the default
+// version unless set by DefaultVersion. Versions are registered before
+// serving requests.
+func (vh *VersionedHandler) Handle(version string, h http.Handler) {
+	version = normalizeVersion(version)
+	vh.handlers[version] = h
+	vh.latest = version
+}
+
+// Deprecate marks version as deprecated: its responses get the Deprecation
+// header, and the Sunset and Link headers of d, when set.
+func (vh *VersionedHandler) Deprecate(version string, d Deprecation) {
+	vh.deprecations[normalizeVersion(version)] = d
+}
+
+// ServeHTTP implements http.Handler.
+func (vh *VersionedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v := requestedVersion(r, vh.opts)
+	if v == "" {
+		v = vh.opts.def
+	}
+	if v == "" {
+		v = vh.latest
+	}
+
+	h := w.Header()
+	h.Add(HeaderVary, HeaderAccept)
+	if vh.opts.header != "" {
+		h.Add(HeaderVary, vh.opts.header)
+	}
+
+	handler, ok := vh.handlers[v]
+	if !ok {
+		DefaultErrorEncoder(r.Context(), &UnsupportedVersionError{Version: v}, w)
+		return
+	}
+
+	if vh.opts.header != "" {
+		h.Set(vh.opts.header, v)
+	}
+	if d, ok := vh.deprecations[v]; ok {
+		d.setHeaders(h)
+	}
+
+	ctx := context.WithValue(r.Context(), ContextKeyAPIVersion, v)
+	handler.ServeHTTP(w, r.WithContext(ctx))
+}
@@ -0,0 +1,311 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// ErrInvalidWebhookSignature denotes an inbound webhook whose signature is
+// missing, wrong or too old. It wraps api.ErrUnauthorized.
+var ErrInvalidWebhookSignature = fmt.Errorf("%w: invalid webhook signature", api.ErrUnauthorized)
+
+// WebhookSignatureError is returned for the inbound webhooks rejected by a
+// WebhookVerifier. It wraps ErrInvalidWebhookSignature and reports a 401
+// status code.
+type WebhookSignatureError struct {
+	Reason string
+}
+
+func (e *WebhookSignatureError) Error() string {
+	if e.Reason == "" {
+		return ErrInvalidWebhookSignature.Error()
+	}
+	return ErrInvalidWebhookSignature.Error() + ": " + e.Reason
+}
+
+func (e *WebhookSignatureError) Unwrap() error {
+	return ErrInvalidWebhookSignature
+}
+
+func (e *WebhookSignatureError) StatusCode() int {
+	return http.StatusUnauthorized
+}
+
+// WebhookVerifier checks the signature of an inbound webhook request, given
+// its raw body.
+type WebhookVerifier interface {
+	Verify(r *http.Request, body []byte) error
+}
+
+// WebhookVerifierFunc adapts a function to the WebhookVerifier interface, for
+// custom schemes.
+type WebhookVerifierFunc func(r *http.Request, body []byte) error
+
+// Verify implements WebhookVerifier.
+func (f WebhookVerifierFunc) Verify(r *http.Request, body []byte) error {
+	return f(r, body)
+}
+
+type hmacVerifierOption struct {
+	prefix          string
+	timestampHeader string
+	tolerance       time.Duration
+	payload         func(timestamp string, body []byte) []byte
+	hash            func() hash.Hash
+	base64          bool
+}
+
+// HMACVerifierOption sets an optional parameter for MakeHMACVerifier.
+type HMACVerifierOption func(opt *hmacVerifierOption)
+
+// HMACPrefix sets the prefix of the signature in its header, such as
+// "sha256=".
+func HMACPrefix(prefix string) HMACVerifierOption {
+	return func(opt *hmacVerifierOption) { opt.prefix = prefix }
+}
+
+// HMACTimestamp sets the header carrying the unix timestamp of the webhook,
+// which is rejected when older than tolerance, or when missing. Unless set
+// by HMACPayload, the signed payload becomes the timestamp, a dot, and the
+// body.
+func HMACTimestamp(header string, tolerance time.Duration) HMACVerifierOption {
+	return func(opt *hmacVerifierOption) {
+		opt.timestampHeader = header
+		opt.tolerance = tolerance
+	}
+}
+
+// HMACPayload sets the payload signed by the sender, built from the
+// timestamp, if any, and the raw body.
+func HMACPayload(fn func(timestamp string, body []byte) []byte) HMACVerifierOption {
+	return func(opt *hmacVerifierOption) { opt.payload = fn }
+}
+
+// HMACHash sets the hash of the HMAC. Defaults to SHA-256.
+func HMACHash(fn func() hash.Hash) HMACVerifierOption {
+	return func(opt *hmacVerifierOption) { opt.hash = fn }
+}
+
+// HMACBase64 reads the signature as standard base64 instead of hex.
+func HMACBase64() HMACVerifierOption {
+	return func(opt *hmacVerifierOption) { opt.base64 = true }
+}
+
+// MakeHMACVerifier returns a WebhookVerifier checking the HMAC of the raw
+// body, keyed with secret, carried by header. Its options describe the
+// variants of the scheme.
+func MakeHMACVerifier(secret, header string, options ...HMACVerifierOption) WebhookVerifier {
+	opts := &hmacVerifierOption{hash: sha256.New}
+	for _, option := range options {
+		option(opts)
+	}
+	if opts.payload == nil {
+		opts.payload = func(timestamp string, body []byte) []byte {
+			if opts.timestampHeader == "" {
+				return body
+			}
+			return append([]byte(timestamp+"."), body...)
+		}
+	}
+
+	return WebhookVerifierFunc(func(r *http.Request, body []byte) error {
+		sig := r.Header.Get(header)
+		if sig == "" || !strings.HasPrefix(sig, opts.prefix) {
+			return &WebhookSignatureError{Reason: "missing " + header}
+		}
+		sig = strings.TrimPrefix(sig, opts.prefix)
+
+		var timestamp string
+		if opts.timestampHeader != "" {
+			timestamp = r.Header.Get(opts.timestampHeader)
+			if err := checkWebhookTimestamp(timestamp, opts.tolerance); err != nil {
+				return err
+			}
+		}
+
+		mac := hmac.New(opts.hash, []byte(secret))
+		mac.Write(opts.payload(timestamp, body))
+		expected := hex.EncodeToString(mac.Sum(nil))
+		if opts.base64 {
+			expected = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		}
+
+		if !hmac.Equal([]byte(sig), []byte(expected)) {
+			return &WebhookSignatureError{}
+		}
+		return nil
+	})
+}
+
+// GitHubWebhookVerifier returns a WebhookVerifier checking the
+// X-Hub-Signature-256 header of GitHub webhooks: "sha256=" and the hex
+// HMAC-SHA256 of the body.
+func GitHubWebhookVerifier(secret string) WebhookVerifier {
+	return MakeHMACVerifier(secret, "X-Hub-Signature-256", HMACPrefix("sha256="))
+}
+
+// SlackWebhookVerifier returns a WebhookVerifier checking the
+// X-Slack-Signature header of Slack requests: "v0=" and the hex HMAC-SHA256
+// of "v0:", the X-Slack-Request-Timestamp header, ":" and the body. Requests
+// older than tolerance are rejected.
+func SlackWebhookVerifier(secret string, tolerance time.Duration) WebhookVerifier {
+	return MakeHMACVerifier(secret, "X-Slack-Signature",
+		HMACPrefix("v0="),
+		HMACTimestamp("X-Slack-Request-Timestamp", tolerance),
+		HMACPayload(func(timestamp string, body []byte) []byte {
+			return append([]byte("v0:"+timestamp+":"), body...)
+		}),
+	)
+}
+
+// StripeWebhookVerifier returns a WebhookVerifier checking the
+// Stripe-Signature header of Stripe webhooks, "t=<timestamp>,v1=<signature>",
+// where the signature is the hex HMAC-SHA256 of the timestamp, a dot and the
+// body. Several v1 signatures may be sent while the secret is rolled.
+// Webhooks older than tolerance are rejected. The webhooks package signs its
+// deliveries the same way, in the Webhook-Signature header, which
+// TimestampedWebhookVerifier checks.
+func StripeWebhookVerifier(secret string, tolerance time.Duration) WebhookVerifier {
+	return TimestampedWebhookVerifier(secret, "Stripe-Signature", tolerance)
+}
+
+// TimestampedWebhookVerifier returns a WebhookVerifier checking header as a
+// Stripe-Signature header.
+func TimestampedWebhookVerifier(secret, header string, tolerance time.Duration) WebhookVerifier {
+	return WebhookVerifierFunc(func(r *http.Request, body []byte) error {
+		var timestamp string
+		var sigs []string
+		for _, part := range strings.Split(r.Header.Get(header), ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch key {
+			case "t":
+				timestamp = value
+			case "v1":
+				sigs = append(sigs, value)
+			}
+		}
+		if len(sigs) == 0 {
+			return &WebhookSignatureError{Reason: "missing " + header}
+		}
+		if err := checkWebhookTimestamp(timestamp, tolerance); err != nil {
+			return err
+		}
+
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		expected := hex.EncodeToString(mac.Sum(nil))
+
+		for _, sig := range sigs {
+			if hmac.Equal([]byte(sig), []byte(expected)) {
+				return nil
+			}
+		}
+		return &WebhookSignatureError{}
+	})
+}
+
+// checkWebhookTimestamp checks the unix timestamp of a webhook is within
+// tolerance of now, unless tolerance is 0.
+func checkWebhookTimestamp(timestamp string, tolerance time.Duration) error {
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return &WebhookSignatureError{Reason: "invalid timestamp"}
+	}
+	if tolerance <= 0 {
+		return nil
+	}
+
+	if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+		return &WebhookSignatureError{Reason: "timestamp out of tolerance"}
+	}
+	return nil
+}
+
+// WebhookBodyFromContext returns the raw body of the webhook verified by
+// MakeHttpWebhookMiddleware or VerifyWebhook, such as for decoders of
+// payloads whose exact bytes matter.
+func WebhookBodyFromContext(ctx context.Context) ([]byte, bool) {
+	body, ok := ctx.Value(ContextKeyWebhookBody).([]byte)
+	return body, ok
+}
+
+// readWebhook reads the body of r, up to maxSize bytes unless maxSize is
+// lower than 1, verifies it, and restores it so it can be read again.
+func readWebhook(r *http.Request, v WebhookVerifier, maxSize int64) ([]byte, error) {
+	reader := io.Reader(r.Body)
+	if maxSize > 0 {
+		reader = io.LimitReader(r.Body, maxSize+1)
+	}
+
+	body, err := io.ReadAll(reader)
+	r.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+	}
+	if maxSize > 0 && int64(len(body)) > maxSize {
+		return nil, &RequestTooLargeError{Limit: maxSize}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := v.Verify(r, body); err != nil {
+		var serr *WebhookSignatureError
+		if !errors.As(err, &serr) {
+			err = &WebhookSignatureError{Reason: err.Error()}
+		}
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// MakeHttpWebhookMiddleware returns an http middleware verifying inbound
+// webhooks with v. The raw body, of at most maxSize bytes unless maxSize is
+// lower than 1, is read once for the verification, then restored, so the
+// handler reads it as if untouched; it is also stored in the request context,
+// for WebhookBodyFromContext. Rejected webhooks get a 401 response, written
+// with DefaultErrorEncoder.
+func MakeHttpWebhookMiddleware(v WebhookVerifier, maxSize int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := readWebhook(r, v, maxSize)
+			if err != nil {
+				DefaultErrorEncoder(r.Context(), err, w)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), ContextKeyWebhookBody, body)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// VerifyWebhook wraps dec so that inbound webhooks are verified with v
+// before dec decodes them, failing with a *WebhookSignatureError otherwise.
+// Like MakeHttpWebhookMiddleware, the body is restored for dec, and the ctx
+// passed to dec carries it for WebhookBodyFromContext.
+func VerifyWebhook[T any](dec DecodeRequestFunc[T], v WebhookVerifier, maxSize int64) DecodeRequestFunc[T] {
+	return func(ctx context.Context, r *http.Request) (T, error) {
+		body, err := readWebhook(r, v, maxSize)
+		if err != nil {
+			var empty T
+			return empty, err
+		}
+
+		return dec(context.WithValue(ctx, ContextKeyWebhookBody, body), r)
+	}
+}
@@ -0,0 +1,368 @@
+package http
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type xlsxOption struct {
+	sheetName  string
+	filename   string
+	tag        string
+	timeFormat string
+}
+
+// XLSXOption sets an optional parameter for the xlsx encoders.
+type XLSXOption func(opt *xlsxOption)
+
+// XLSXSheetName sets the name of the worksheet. Defaults to "Sheet1". Names
+// are truncated to the 31 characters Excel allows and characters it forbids
+// are replaced by underscores.
+func XLSXSheetName(name string) XLSXOption {
+	return func(opt *xlsxOption) { opt.sheetName = name }
+}
+
+// XLSXFilename sets the filename of the attachment. Defaults to
+// "export.xlsx".
+func XLSXFilename(filename string) XLSXOption {
+	return func(opt *xlsxOption) { opt.filename = filename }
+}
+
+// XLSXHeaderTag sets the struct tag holding the column headers. Defaults to
+// "xlsx". Fields without the tag fall back to their `json` name, then to their
+// Go name; fields tagged "-" are left out.
+func XLSXHeaderTag(tag string) XLSXOption {
+	return func(opt *xlsxOption) { opt.tag = tag }
+}
+
+// XLSXTimeFormat sets the layout used to write time.Time values. Defaults to
+// "2006-01-02 15:04:05".
+func XLSXTimeFormat(layout string) XLSXOption {
+	return func(opt *xlsxOption) { opt.timeFormat = layout }
+}
+
+// MakeXLSXResponseEncoder returns an EncodeResponseFunc writing a slice of
+// structs as an .xlsx attachment, one row per element below a bold header row.
+func MakeXLSXResponseEncoder[T any](options ...XLSXOption) EncodeResponseFunc[[]T] {
+	enc := MakeXLSXStreamResponseEncoder[T](options...)
+	return func(ctx context.Context, w http.ResponseWriter, response []T) error {
+		return enc(ctx, w, SliceIterator(response))
+	}
+}
+
+// MakeXLSXStreamResponseEncoder returns an EncodeResponseFunc writing the
+// elements of the iterator as an .xlsx attachment. Rows are written straight
+// into the compressed worksheet as they are produced, so the workbook is never
+// held in memory. T must be a struct or a pointer to a struct.
+func MakeXLSXStreamResponseEncoder[T any](options ...XLSXOption) EncodeResponseFunc[Iterator[T]] {
+	opts := &xlsxOption{
+		sheetName:  "Sheet1",
+		filename:   "export.xlsx",
+		tag:        "xlsx",
+		timeFormat: "2006-01-02 15:04:05",
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	var zero T
+	typ := reflect.TypeOf(&zero).Elem()
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	columns := xlsxColumns(typ, opts.tag, nil)
+
+	return func(ctx context.Context, w http.ResponseWriter, it Iterator[T]) error {
+		if typ.Kind() != reflect.Struct {
+			return fmt.Errorf("xlsx: cannot encode rows of type %s, expected a struct", typ)
+		}
+
+		w.Header().Set(HeaderContentType, HttpContentTypeXLSX)
+		w.Header().Set(HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", opts.filename))
+		w.WriteHeader(http.StatusOK)
+
+		zw := zip.NewWriter(w)
+		if err := writeXLSXParts(zw, xlsxSheetName(opts.sheetName)); err != nil {
+			return err
+		}
+
+		sheet, err := zw.Create("xl/worksheets/sheet1.xml")
+		if err != nil {
+			return err
+		}
+
+		bw := bufio.NewWriter(sheet)
+		bw.WriteString(xml.Header)
+		bw.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+		header := make([]string, len(columns))
+		for i, col := range columns {
+			header[i] = col.header
+		}
+		writeXLSXHeader(bw, header)
+
+		row := 1
+		for it.Next(ctx) {
+			row++
+			val := reflect.ValueOf(it.Value())
+			for val.Kind() == reflect.Ptr {
+				if val.IsNil() {
+					break
+				}
+				val = val.Elem()
+			}
+
+			fmt.Fprintf(bw, `<row r="%d">`, row)
+			if val.Kind() == reflect.Struct {
+				for i, col := range columns {
+					fv, ok := fieldByIndex(val, col.index)
+					if ok {
+						writeXLSXCell(bw, xlsxCellRef(i, row), fv, opts.timeFormat)
+					}
+				}
+			}
+			bw.WriteString(`</row>`)
+		}
+
+		if err := it.Err(); err != nil {
+			return err
+		}
+
+		bw.WriteString(`</sheetData></worksheet>`)
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+
+		return zw.Close()
+	}
+}
+
+type xlsxColumn struct {
+	header string
+	index  []int
+}
+
+func xlsxColumns(typ reflect.Type, tag string, index []int) []xlsxColumn {
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var columns []xlsxColumn
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fieldIndex := append(append([]int{}, index...), i)
+
+		name, tagged := field.Tag.Lookup(tag)
+		if !tagged {
+			name = strings.Split(field.Tag.Get("json"), ",")[0]
+		}
+		name = strings.Split(name, ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && !tagged && ft.Kind() == reflect.Struct && !isTimeType(ft) {
+			columns = append(columns, xlsxColumns(ft, tag, fieldIndex)...)
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, xlsxColumn{header: name, index: fieldIndex})
+	}
+
+	return columns
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex but reports false instead of
+// panicking when an embedded pointer is nil.
+func fieldByIndex(val reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && val.Kind() == reflect.Ptr {
+			if val.IsNil() {
+				return reflect.Value{}, false
+			}
+			val = val.Elem()
+		}
+		val = val.Field(x)
+	}
+
+	return val, true
+}
+
+func writeXLSXHeader(w *bufio.Writer, header []string) {
+	w.WriteString(`<row r="1">`)
+	for i, h := range header {
+		writeXLSXString(w, xlsxCellRef(i, 1), h, 1)
+	}
+	w.WriteString(`</row>`)
+}
+
+func writeXLSXCell(w *bufio.Writer, ref string, val reflect.Value, timeFormat string) {
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return
+		}
+		val = val.Elem()
+	}
+
+	if val.CanInterface() {
+		switch v := val.Interface().(type) {
+		case time.Time:
+			if !v.IsZero() {
+				writeXLSXString(w, ref, v.Format(timeFormat), 0)
+			}
+			return
+		case fmt.Stringer:
+			writeXLSXString(w, ref, v.String(), 0)
+			return
+		case encoding.TextMarshaler:
+			if b, err := v.MarshalText(); err == nil {
+				writeXLSXString(w, ref, string(b), 0)
+			}
+			return
+		}
+	}
+
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeXLSXNumber(w, ref, strconv.FormatInt(val.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		writeXLSXNumber(w, ref, strconv.FormatUint(val.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		f := val.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			writeXLSXString(w, ref, strconv.FormatFloat(f, 'f', -1, val.Type().Bits()), 0)
+			return
+		}
+		writeXLSXNumber(w, ref, strconv.FormatFloat(f, 'f', -1, val.Type().Bits()))
+	case reflect.Bool:
+		v := "0"
+		if val.Bool() {
+			v = "1"
+		}
+		fmt.Fprintf(w, `<c r="%s" t="b"><v>%s</v></c>`, ref, v)
+	case reflect.String:
+		writeXLSXString(w, ref, val.String(), 0)
+	default:
+		if val.CanInterface() {
+			writeXLSXString(w, ref, fmt.Sprint(val.Interface()), 0)
+		}
+	}
+}
+
+func writeXLSXNumber(w *bufio.Writer, ref string, v string) {
+	fmt.Fprintf(w, `<c r="%s"><v>%s</v></c>`, ref, v)
+}
+
+func writeXLSXString(w *bufio.Writer, ref string, v string, style int) {
+	fmt.Fprintf(w, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">`, ref, style)
+	xml.EscapeText(w, []byte(v))
+	w.WriteString(`</t></is></c>`)
+}
+
+// xlsxCellRef returns the A1 style reference of the zero based column col in
+// the one based row.
+func xlsxCellRef(col, row int) string {
+	name := ""
+	for col >= 0 {
+		name = string(rune('A'+col%26)) + name
+		col = col/26 - 1
+	}
+
+	return name + strconv.Itoa(row)
+}
+
+func xlsxSheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	if name == "" {
+		return "Sheet1"
+	}
+
+	if runes := []rune(name); len(runes) > 31 {
+		name = string(runes[:31])
+	}
+
+	return name
+}
+
+// writeXLSXParts writes every part of the package but the worksheet itself.
+func writeXLSXParts(zw *zip.Writer, sheetName string) error {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(sheetName))
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, escaped.String())},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, xml.Header+part.content); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+const xlsxContentTypes = `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+	`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+	`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+	`</Types>`
+
+const xlsxRootRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+const xlsxWorkbook = `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+	`<sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets>` +
+	`</workbook>`
+
+const xlsxWorkbookRels = `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+	`</Relationships>`
+
+const xlsxStyles = `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+	`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>` +
+	`</styleSheet>`
@@ -0,0 +1,403 @@
+package http
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xlsxMaxColumns is the number of columns of an Excel worksheet, bounding
+// the records of xlsxReader.
+const xlsxMaxColumns = 16384
+
+// xlsxReader reads the rows of the first worksheet of an .xlsx workbook,
+// streaming the worksheet rather than loading it, the shared strings and
+// styles excepted.
+type xlsxReader struct {
+	sheet      io.ReadCloser
+	dec        *xml.Decoder
+	strings    []string
+	dates      map[int]bool
+	epoch      time.Time
+	timeFormat string
+	row        int
+}
+
+// newXLSXReader opens the workbook of size bytes read from r. Cells styled
+// as dates are read as times formatted with timeFormat.
+func newXLSXReader(r io.ReaderAt, size int64, timeFormat string) (*xlsxReader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	x := &xlsxReader{
+		epoch:      time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC),
+		timeFormat: timeFormat,
+	}
+
+	sheetName, date1904, err := xlsxFirstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+	if date1904 {
+		x.epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if x.strings, err = xlsxSharedStrings(f); err != nil {
+			return nil, err
+		}
+	}
+	if f, ok := files["xl/styles.xml"]; ok {
+		if x.dates, err = xlsxDateStyles(f); err != nil {
+			return nil, err
+		}
+	}
+
+	f, ok := files[sheetName]
+	if !ok {
+		return nil, fmt.Errorf("xlsx: worksheet %q not found", sheetName)
+	}
+	if x.sheet, err = f.Open(); err != nil {
+		return nil, err
+	}
+	x.dec = xml.NewDecoder(x.sheet)
+
+	return x, nil
+}
+
+// Read returns the next row of the worksheet, with its one based number.
+// Missing cells are returned as empty strings. It returns io.EOF after the
+// last row.
+func (x *xlsxReader) Read() (int, []string, error) {
+	var record []string
+	inRow := false
+	for {
+		tok, err := x.dec.Token()
+		if err == io.EOF {
+			return 0, nil, io.EOF
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "row":
+				inRow = true
+				record = record[:0]
+				x.row++
+				if r := xmlAttr(t, "r"); r != "" {
+					if x.row, err = strconv.Atoi(r); err != nil {
+						return 0, nil, fmt.Errorf("xlsx: invalid row %q", r)
+					}
+				}
+
+			case "c":
+				if !inRow {
+					continue
+				}
+				col := len(record)
+				if ref := xmlAttr(t, "r"); ref != "" {
+					if col, err = xlsxColumnIndex(ref); err != nil {
+						return 0, nil, err
+					}
+				}
+				value, err := x.cell(t)
+				if err != nil {
+					return 0, nil, err
+				}
+				for len(record) <= col {
+					record = append(record, "")
+				}
+				record[col] = value
+			}
+
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "row":
+				return x.row, append([]string(nil), record...), nil
+			case "sheetData":
+				return 0, nil, io.EOF
+			}
+		}
+	}
+}
+
+// Close closes the worksheet.
+func (x *xlsxReader) Close() error {
+	return x.sheet.Close()
+}
+
+// cell reads the value of the cell started by start.
+func (x *xlsxReader) cell(start xml.StartElement) (string, error) {
+	value, inline, err := xmlCellText(x.dec)
+	if err != nil {
+		return "", err
+	}
+
+	switch xmlAttr(start, "t") {
+	case "s":
+		i, err := strconv.Atoi(value)
+		if err != nil || i < 0 || i >= len(x.strings) {
+			return "", fmt.Errorf("xlsx: invalid shared string %q", value)
+		}
+		return x.strings[i], nil
+	case "inlineStr":
+		return inline, nil
+	case "b":
+		return strconv.FormatBool(value == "1"), nil
+	case "", "n":
+		style, _ := strconv.Atoi(xmlAttr(start, "s"))
+		if !x.dates[style] || value == "" {
+			return value, nil
+		}
+		days, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return value, nil
+		}
+		d := time.Duration(math.Round(days*86400)) * time.Second
+		return x.epoch.Add(d).Format(x.timeFormat), nil
+	}
+
+	return value, nil
+}
+
+// xmlCellText reads the tokens of a cell up to its end, returning the text
+// of its <v> element and of its inline string.
+func xmlCellText(dec *xml.Decoder) (value, inline string, err error) {
+	var v, is strings.Builder
+	var inV, inT bool
+	for depth := 1; depth > 0; {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", "", err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch t.Name.Local {
+			case "v":
+				inV = true
+			case "t":
+				inT = true
+			case "rPh":
+				// phonetic runs are not part of the text
+				if err := dec.Skip(); err != nil {
+					return "", "", err
+				}
+				depth--
+			}
+		case xml.EndElement:
+			depth--
+			inV, inT = false, false
+		case xml.CharData:
+			if inV {
+				v.Write(t)
+			} else if inT {
+				is.Write(t)
+			}
+		}
+	}
+
+	return v.String(), is.String(), nil
+}
+
+// xlsxFirstSheet returns the name of the part of the first worksheet of the
+// workbook, and whether its dates count from 1904.
+func xlsxFirstSheet(files map[string]*zip.File) (string, bool, error) {
+	var workbook struct {
+		Pr struct {
+			Date1904 string `xml:"date1904,attr"`
+		} `xml:"workbookPr"`
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	f, ok := files["xl/workbook.xml"]
+	if !ok {
+		return "", false, fmt.Errorf("xlsx: workbook not found")
+	}
+	if err := xlsxDecode(f, &workbook); err != nil {
+		return "", false, err
+	}
+	date1904 := workbook.Pr.Date1904 == "1" || workbook.Pr.Date1904 == "true"
+
+	sheet := "xl/worksheets/sheet1.xml"
+	if len(workbook.Sheets) == 0 {
+		return sheet, date1904, nil
+	}
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if f, ok := files["xl/_rels/workbook.xml.rels"]; ok {
+		if err := xlsxDecode(f, &rels); err != nil {
+			return "", false, err
+		}
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].ID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), date1904, nil
+		}
+		return path.Join("xl", rel.Target), date1904, nil
+	}
+
+	return sheet, date1904, nil
+}
+
+func xlsxSharedStrings(f *zip.File) ([]string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var sst []string
+	dec := xml.NewDecoder(rc)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return sst, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "si" {
+			_, text, err := xmlCellText(dec)
+			if err != nil {
+				return nil, err
+			}
+			sst = append(sst, text)
+		}
+	}
+}
+
+// xlsxBuiltinDateFormats are the ids of the built-in number formats showing
+// dates or times.
+var xlsxBuiltinDateFormats = map[int]bool{
+	14: true, 15: true, 16: true, 17: true, 18: true, 19: true, 20: true, 21: true, 22: true,
+	27: true, 28: true, 29: true, 30: true, 31: true, 32: true, 33: true, 34: true, 35: true, 36: true,
+	45: true, 46: true, 47: true,
+	50: true, 51: true, 52: true, 53: true, 54: true, 55: true, 56: true, 57: true, 58: true,
+}
+
+// xlsxDateStyles returns the indexes of the cell styles formatting numbers
+// as dates or times.
+func xlsxDateStyles(f *zip.File) (map[int]bool, error) {
+	var styles struct {
+		NumFmts []struct {
+			ID   int    `xml:"numFmtId,attr"`
+			Code string `xml:"formatCode,attr"`
+		} `xml:"numFmts>numFmt"`
+		CellXfs []struct {
+			NumFmtID int `xml:"numFmtId,attr"`
+		} `xml:"cellXfs>xf"`
+	}
+	if err := xlsxDecode(f, &styles); err != nil {
+		return nil, err
+	}
+
+	formats := make(map[int]bool)
+	for id := range xlsxBuiltinDateFormats {
+		formats[id] = true
+	}
+	for _, nf := range styles.NumFmts {
+		formats[nf.ID] = xlsxIsDateFormat(nf.Code)
+	}
+
+	dates := make(map[int]bool)
+	for i, xf := range styles.CellXfs {
+		if formats[xf.NumFmtID] {
+			dates[i] = true
+		}
+	}
+
+	return dates, nil
+}
+
+// xlsxIsDateFormat reports whether the custom number format code shows a
+// date or a time, ignoring its literal text and its colors and conditions.
+func xlsxIsDateFormat(code string) bool {
+	var quoted, bracket, escaped bool
+	for _, c := range strings.ToLower(code) {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted:
+			quoted = c != '"'
+		case bracket:
+			bracket = c != ']'
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = true
+		case c == '[':
+			bracket = true
+		case strings.ContainsRune("ydhs", c):
+			return true
+		}
+	}
+
+	return false
+}
+
+func xlsxDecode(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// xlsxColumnIndex returns the zero based column of the A1 style reference
+// ref, the reverse of xlsxCellRef.
+func xlsxColumnIndex(ref string) (int, error) {
+	col := 0
+	for _, c := range strings.ToUpper(ref) {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A') + 1
+		if col > xlsxMaxColumns {
+			return 0, fmt.Errorf("xlsx: invalid cell reference %q", ref)
+		}
+	}
+
+	if col == 0 {
+		return 0, fmt.Errorf("xlsx: invalid cell reference %q", ref)
+	}
+	return col - 1, nil
+}
+
+func xmlAttr(start xml.StartElement, name string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
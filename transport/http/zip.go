@@ -0,0 +1,174 @@
+package http
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+type zipOption struct {
+	filename string
+	level    func(p *FileStreamPayload) int
+}
+
+// ZipOption sets an optional parameter for the zip encoders.
+type ZipOption func(opt *zipOption)
+
+// ZipFilename sets the filename of the attachment. Defaults to
+// "archive.zip".
+func ZipFilename(filename string) ZipOption {
+	return func(opt *zipOption) { opt.filename = filename }
+}
+
+// ZipCompressionLevel sets the deflate level of every file, from
+// flate.NoCompression, which stores files as they are, to
+// flate.BestCompression. Defaults to flate.DefaultCompression.
+func ZipCompressionLevel(level int) ZipOption {
+	return func(opt *zipOption) {
+		opt.level = func(*FileStreamPayload) int { return level }
+	}
+}
+
+// ZipFileCompressionLevel sets the deflate level of each file from fn, for
+// instance to store already compressed images and archives without
+// recompressing them.
+func ZipFileCompressionLevel(fn func(p *FileStreamPayload) int) ZipOption {
+	return func(opt *zipOption) { opt.level = fn }
+}
+
+// MakeZipResponseEncoder returns an EncodeResponseFunc streaming the files as
+// a zip attachment. Every Reader is closed, even those left unwritten after a
+// failure.
+func MakeZipResponseEncoder(options ...ZipOption) EncodeResponseFunc[[]FileStreamPayload] {
+	enc := MakeZipStreamResponseEncoder(options...)
+	return func(ctx context.Context, w http.ResponseWriter, response []FileStreamPayload) error {
+		next := 0
+		it := NewIterator(func(ctx context.Context) (FileStreamPayload, bool, error) {
+			if next >= len(response) {
+				return FileStreamPayload{}, false, nil
+			}
+			next++
+			return response[next-1], true, nil
+		})
+
+		err := enc(ctx, w, it)
+		for _, file := range response[next:] {
+			if file.Reader != nil {
+				file.Reader.Close()
+			}
+		}
+
+		return err
+	}
+}
+
+// MakeZipStreamResponseEncoder returns an EncodeResponseFunc streaming the
+// files of the iterator, which may be a ChanIterator, as a zip attachment.
+// Each file is compressed straight to the client as it is read, so neither
+// the files nor the archive are held in memory. Every Reader is closed once
+// written; the files left in the iterator after a failure are not read.
+// Files are named after their FileName, made relative and unique within the
+// archive.
+//
+// The status line is sent before the first file, so a failure can no longer
+// change it; the archive is then left without its central directory, which
+// clients see as a corrupt archive, and the error is returned to the Server.
+func MakeZipStreamResponseEncoder(options ...ZipOption) EncodeResponseFunc[Iterator[FileStreamPayload]] {
+	opts := &zipOption{
+		filename: "archive.zip",
+		level:    func(*FileStreamPayload) int { return flate.DefaultCompression },
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return func(ctx context.Context, w http.ResponseWriter, it Iterator[FileStreamPayload]) error {
+		w.Header().Set(HeaderContentType, HttpContentTypeZip)
+		w.Header().Set(HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", opts.filename))
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		// the deflate level is picked per file: the compressor reads it when
+		// CreateHeader opens the file
+		level := flate.DefaultCompression
+		zw := zip.NewWriter(w)
+		zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+
+		names := make(map[string]int)
+		for it.Next(ctx) {
+			file := it.Value()
+
+			level = opts.level(&file)
+			err := writeZipFile(zw, &file, zipEntryName(file.FileName, names), level)
+			if file.Reader != nil {
+				file.Reader.Close()
+			}
+			if err != nil {
+				return err
+			}
+
+			if flusher, ok := w.(http.Flusher); ok {
+				flusher.Flush()
+			}
+		}
+
+		if err := it.Err(); err != nil {
+			return err
+		}
+
+		return zw.Close()
+	}
+}
+
+func writeZipFile(zw *zip.Writer, file *FileStreamPayload, name string, level int) error {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	}
+	if level == flate.NoCompression {
+		header.Method = zip.Store
+	}
+
+	fw, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	if file.Reader == nil {
+		return nil
+	}
+
+	_, err = io.Copy(fw, file.Reader)
+	return err
+}
+
+// zipEntryName turns filename into a relative path without ".." elements, so
+// extracting the archive can't write outside the target directory, and makes
+// it unique among the names seen so far.
+func zipEntryName(filename string, names map[string]int) string {
+	name := path.Clean("/" + strings.ReplaceAll(filename, "\\", "/"))
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		name = "file"
+	}
+
+	n := names[name]
+	names[name] = n + 1
+	if n == 0 {
+		return name
+	}
+
+	ext := path.Ext(name)
+	unique := fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+	names[unique]++
+	return unique
+}
@@ -0,0 +1,103 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/apierror"
+)
+
+// Error codes defined by the JSON-RPC 2.0 specification.
+const (
+	ParseError     = -32700
+	InvalidRequest = -32600
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	InternalError  = -32603
+
+	// ServerError is the code of the application errors, whose apierror
+	// code and HTTP status are reported in the data of the error object.
+	ServerError = -32000
+)
+
+// Error is a JSON-RPC error object. Endpoints may return it to choose the
+// error object sent to the client.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// ErrorData is the data of the error objects created by
+// DefaultErrorEncoder from application errors.
+type ErrorData struct {
+	Code       apierror.Code          `json:"code"`
+	StatusCode int                    `json:"status_code"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+}
+
+// ErrorEncoder converts the error of a call into the error object sent to
+// the client.
+type ErrorEncoder func(ctx context.Context, err error) *Error
+
+// DefaultErrorEncoder returns the *Error wrapped by err, if any, or else
+// converts err with apierror.From: bad requests, such as the errors of
+// decoders, become InvalidParams errors, internal errors InternalError ones
+// with a generic message, and the others ServerError ones with an ErrorData.
+func DefaultErrorEncoder(_ context.Context, err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+
+	aerr := apierror.From(err)
+	data := ErrorData{Code: aerr.Code, StatusCode: aerr.StatusCode(), Details: aerr.Details}
+
+	switch {
+	case aerr.Code == apierror.CodeBadRequest:
+		return &Error{Code: InvalidParams, Message: aerr.Message, Data: data}
+	case aerr.StatusCode() == http.StatusInternalServerError:
+		return &Error{Code: InternalError, Message: http.StatusText(http.StatusInternalServerError)}
+	default:
+		return &Error{Code: ServerError, Message: aerr.Message, Data: data}
+	}
+}
+
+// DecodeParamsFunc extracts a user-domain request object from the params of
+// a call, which are nil when omitted.
+type DecodeParamsFunc[T any] func(ctx context.Context, params json.RawMessage) (request T, err error)
+
+// EncodeResultFunc encodes the passed response object into the result of a
+// call.
+type EncodeResultFunc[T any] func(ctx context.Context, response T) (json.RawMessage, error)
+
+// DecodeJSONParams is a DecodeParamsFunc that JSON decodes the params into
+// T, then validates it when it implements api.Validator. Omitted params
+// leave T empty.
+func DecodeJSONParams[T any](ctx context.Context, params json.RawMessage) (T, error) {
+	var req T
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			return req, fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+		}
+	}
+
+	if err := api.Validate(ctx, &req); err != nil {
+		return req, err
+	}
+
+	return req, nil
+}
+
+// EncodeJSONResult is an EncodeResultFunc that JSON encodes the response.
+func EncodeJSONResult[T any](_ context.Context, response T) (json.RawMessage, error) {
+	return json.Marshal(response)
+}
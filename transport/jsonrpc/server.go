@@ -0,0 +1,388 @@
+// Package jsonrpc exposes endpoints as the methods of a JSON-RPC 2.0 server,
+// over HTTP and WebSocket, including batch requests and notifications.
+//
+//	s := jsonrpc.NewServer()
+//	jsonrpc.Register(s, "users.get", getUser,
+//		jsonrpc.DecodeJSONParams[GetUserRequest], jsonrpc.EncodeJSONResult[User])
+//
+//	r.Post("/rpc", s.ServeHTTP)
+//	r.Get("/rpc/ws", s.ServeWebSocket)
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/logger"
+	trxkit "github.com/likearthian/apikit/transport"
+	httptransport "github.com/likearthian/apikit/transport/http"
+)
+
+const version = "2.0"
+
+type contextKey int
+
+const (
+	// ContextKeyMethod is populated in the context of each call with the
+	// name of the method called.
+	ContextKeyMethod contextKey = iota
+)
+
+// MethodFromContext returns the name of the method called.
+func MethodFromContext(ctx context.Context) string {
+	method, _ := ctx.Value(ContextKeyMethod).(string)
+	return method
+}
+
+// method calls an endpoint with the params of a call.
+type method func(ctx context.Context, params json.RawMessage) (json.RawMessage, error)
+
+// Register registers e as the method called name of s, decoding the params
+// of the calls with dec and encoding the results with enc. It panics when
+// name is empty or reserved, starting with "rpc.", and replaces the method
+// registered with the same name, if any.
+func Register[I, O any](s *Server, name string, e api.Endpoint[I, O], dec DecodeParamsFunc[I], enc EncodeResultFunc[O]) {
+	if name == "" || strings.HasPrefix(name, "rpc.") {
+		panic("jsonrpc: invalid method name " + name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.methods[name] = func(ctx context.Context, params json.RawMessage) (json.RawMessage, error) {
+		request, err := dec(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := e(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+
+		return enc(ctx, response)
+	}
+}
+
+// Server is a JSON-RPC 2.0 server calling the endpoints registered as its
+// methods.
+type Server struct {
+	mu      sync.RWMutex
+	methods map[string]method
+
+	before       []httptransport.RequestFunc
+	errorEncoder ErrorEncoder
+	errorHandler trxkit.ErrorHandler
+	upgrader     *websocket.Upgrader
+	maxBatch     int
+	maxBodySize  int64
+}
+
+type serverOption struct {
+	before       []httptransport.RequestFunc
+	errorEncoder ErrorEncoder
+	errorHandler trxkit.ErrorHandler
+	upgrader     *websocket.Upgrader
+	maxBatch     int
+	maxBodySize  int64
+}
+
+// ServerOption sets an optional parameter for servers.
+type ServerOption func(opt *serverOption)
+
+// NewServer constructs a new server without methods.
+func NewServer(options ...ServerOption) *Server {
+	opts := &serverOption{
+		maxBatch:    100,
+		maxBodySize: 1 << 20,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	s := &Server{
+		methods:      make(map[string]method),
+		before:       opts.before,
+		errorEncoder: DefaultErrorEncoder,
+		errorHandler: trxkit.NewLogErrorHandler(logger.NewNoopLogger()),
+		upgrader:     &websocket.Upgrader{},
+		maxBatch:     opts.maxBatch,
+		maxBodySize:  opts.maxBodySize,
+	}
+
+	if opts.errorEncoder != nil {
+		s.errorEncoder = opts.errorEncoder
+	}
+
+	if opts.errorHandler != nil {
+		s.errorHandler = opts.errorHandler
+	}
+
+	if opts.upgrader != nil {
+		s.upgrader = opts.upgrader
+	}
+
+	return s
+}
+
+// ServerBefore functions are executed on the HTTP request, or the upgrade
+// request of a WebSocket connection, before the calls are decoded.
+func ServerBefore(before ...httptransport.RequestFunc) ServerOption {
+	return func(s *serverOption) { s.before = append(s.before, before...) }
+}
+
+// ServerErrorEncoder is used to convert the errors of the calls into error
+// objects. By default, errors are converted with the DefaultErrorEncoder.
+func ServerErrorEncoder(ee ErrorEncoder) ServerOption {
+	return func(s *serverOption) { s.errorEncoder = ee }
+}
+
+// ServerErrorHandler is used to handle non-terminal errors. By default, non-terminal errors
+// are ignored.
+func ServerErrorHandler(errorHandler trxkit.ErrorHandler) ServerOption {
+	return func(s *serverOption) { s.errorHandler = errorHandler }
+}
+
+// ServerUpgrader sets the upgrader used to accept WebSocket connections. By
+// default a zero websocket.Upgrader is used, which rejects cross-origin
+// requests.
+func ServerUpgrader(upgrader *websocket.Upgrader) ServerOption {
+	return func(s *serverOption) { s.upgrader = upgrader }
+}
+
+// ServerMaxBatch sets how many calls a batch request may hold. Defaults to
+// 100.
+func ServerMaxBatch(n int) ServerOption {
+	return func(s *serverOption) { s.maxBatch = n }
+}
+
+// ServerMaxBodySize sets the maximum size of an HTTP request body, or of a
+// WebSocket message. Defaults to 1 MiB.
+func ServerMaxBodySize(n int64) ServerOption {
+	return func(s *serverOption) { s.maxBodySize = n }
+}
+
+// request is a JSON-RPC request object. ID is nil for notifications.
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// response is a JSON-RPC response object.
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+var null = json.RawMessage("null")
+
+// ServeHTTP implements http.Handler, serving the requests POSTed as JSON.
+// Requests holding only notifications are answered with 204 No Content.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx := r.Context()
+	for _, f := range s.before {
+		ctx = f(ctx, r)
+	}
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(http.MaxBytesReader(w, r.Body, s.maxBodySize)); err != nil {
+		s.errorHandler.Handle(ctx, err)
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	data := s.handle(ctx, buf.Bytes())
+	if data == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
+
+// ServeWebSocket upgrades the request to a WebSocket connection, and serves
+// every text message received as a request, writing the response, if any,
+// back. Messages are processed sequentially, in the order they are
+// received.
+func (s *Server) ServeWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already replied with an HTTP error
+		s.errorHandler.Handle(r.Context(), err)
+		return
+	}
+	defer conn.Close()
+
+	conn.SetReadLimit(s.maxBodySize)
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	for _, f := range s.before {
+		ctx = f(ctx, r)
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				s.errorHandler.Handle(ctx, err)
+			}
+			return
+		}
+
+		reply := s.handle(ctx, data)
+		if reply == nil {
+			continue
+		}
+
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := conn.WriteMessage(websocket.TextMessage, reply); err != nil {
+			s.errorHandler.Handle(ctx, err)
+			return
+		}
+	}
+}
+
+// handle serves a single or batch request, returning the encoded response,
+// or nil when there is none.
+func (s *Server) handle(ctx context.Context, data []byte) []byte {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '[' {
+		res := s.call(ctx, data)
+		if res == nil {
+			return nil
+		}
+		out, _ := json.Marshal(res)
+		return out
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(data, &batch); err != nil {
+		out, _ := json.Marshal(errorResponse(null, &Error{Code: ParseError, Message: "Parse error"}))
+		return out
+	}
+
+	if len(batch) == 0 || len(batch) > s.maxBatch {
+		message := "Invalid Request"
+		if len(batch) > 0 {
+			message = "Invalid Request: batch too large"
+		}
+		out, _ := json.Marshal(errorResponse(null, &Error{Code: InvalidRequest, Message: message}))
+		return out
+	}
+
+	// the calls of a batch run concurrently, and their responses keep the
+	// order of the batch
+	responses := make([]*response, len(batch))
+	var wg sync.WaitGroup
+	for i, raw := range batch {
+		wg.Add(1)
+		go func(i int, raw json.RawMessage) {
+			defer wg.Done()
+			responses[i] = s.call(ctx, raw)
+		}(i, raw)
+	}
+	wg.Wait()
+
+	replies := make([]*response, 0, len(responses))
+	for _, res := range responses {
+		if res != nil {
+			replies = append(replies, res)
+		}
+	}
+	if len(replies) == 0 {
+		return nil
+	}
+
+	out, _ := json.Marshal(replies)
+	return out
+}
+
+// call serves a single request, returning nil for notifications.
+func (s *Server) call(ctx context.Context, data json.RawMessage) *response {
+	var req request
+	if err := json.Unmarshal(data, &req); err != nil {
+		if _, ok := err.(*json.SyntaxError); ok {
+			return errorResponse(null, &Error{Code: ParseError, Message: "Parse error"})
+		}
+		return errorResponse(null, &Error{Code: InvalidRequest, Message: "Invalid Request"})
+	}
+
+	if req.JSONRPC != version || req.Method == "" || !validID(req.ID) {
+		id := req.ID
+		if !validID(id) || len(id) == 0 {
+			id = null
+		}
+		return errorResponse(id, &Error{Code: InvalidRequest, Message: "Invalid Request"})
+	}
+
+	notification := len(req.ID) == 0
+
+	s.mu.RLock()
+	m, ok := s.methods[req.Method]
+	s.mu.RUnlock()
+	if !ok {
+		if notification {
+			return nil
+		}
+		return errorResponse(req.ID, &Error{Code: MethodNotFound, Message: "Method not found"})
+	}
+
+	params := req.Params
+	if bytes.Equal(bytes.TrimSpace(params), null) {
+		params = nil
+	}
+
+	ctx = context.WithValue(ctx, ContextKeyMethod, req.Method)
+	result, err := m(ctx, params)
+	if err != nil {
+		s.errorHandler.Handle(ctx, err)
+	}
+	if notification {
+		return nil
+	}
+
+	if err != nil {
+		return errorResponse(req.ID, s.errorEncoder(ctx, err))
+	}
+	if len(result) == 0 {
+		result = null
+	}
+
+	return &response{JSONRPC: version, Result: result, ID: req.ID}
+}
+
+func errorResponse(id json.RawMessage, err *Error) *response {
+	return &response{JSONRPC: version, Error: err, ID: id}
+}
+
+// validID reports whether id is absent, or a string, a number or null.
+func validID(id json.RawMessage) bool {
+	if len(id) == 0 {
+		return true
+	}
+	switch id[0] {
+	case '"', '-', 'n', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/logger"
+	trxkit "github.com/likearthian/apikit/transport"
+	httptransport "github.com/likearthian/apikit/transport/http"
+)
+
+// Headers set on the records routed to the retry and dead letter topics.
+const (
+	HeaderRetryCount     = "x-retry-count"
+	HeaderOriginalTopic  = "x-original-topic"
+	HeaderOriginalOffset = "x-original-offset"
+	HeaderError          = "x-error"
+)
+
+// ConsumerRequestFunc may take information from a record and put it in the
+// request context. ConsumerRequestFuncs are executed prior to decoding the
+// record.
+type ConsumerRequestFunc func(ctx context.Context, rec *Record) context.Context
+
+// ConsumerFinalizerFunc can be used to perform work at the end of the
+// processing of a record.
+type ConsumerFinalizerFunc func(ctx context.Context, err error)
+
+// Consumer wraps an endpoint and processes records with it. The offset of a
+// record is committed once the endpoint succeeds. A failed record is routed
+// to the retry topic, until it has been retried the maximum number of
+// times, then to the dead letter topic, and committed. Without those
+// topics, its offset isn't committed and Run stops, so it is processed again
+// when the consumer restarts.
+type Consumer[I, O any] struct {
+	e            api.Endpoint[I, O]
+	dec          DecodeRecordFunc[I]
+	before       []ConsumerRequestFunc
+	errorHandler trxkit.ErrorHandler
+	finalizer    []ConsumerFinalizerFunc
+	retry        *route
+	maxRetries   int
+	deadLetter   *route
+	permanent    func(error) bool
+}
+
+type route struct {
+	producer Producer
+	topic    string
+}
+
+type consumerOption struct {
+	before       []ConsumerRequestFunc
+	errorHandler trxkit.ErrorHandler
+	finalizer    []ConsumerFinalizerFunc
+	retry        *route
+	maxRetries   int
+	deadLetter   *route
+	permanent    func(error) bool
+}
+
+// ConsumerOption sets an optional parameter for consumers.
+type ConsumerOption func(opt *consumerOption)
+
+// NewConsumer constructs a new consumer processing records with the provided
+// endpoint. The responses of the endpoint are discarded.
+func NewConsumer[I, O any](
+	e api.Endpoint[I, O],
+	dec DecodeRecordFunc[I],
+	options ...ConsumerOption,
+) *Consumer[I, O] {
+	opts := &consumerOption{permanent: PermanentError}
+	for _, option := range options {
+		option(opts)
+	}
+
+	c := &Consumer[I, O]{
+		e:            e,
+		dec:          dec,
+		before:       opts.before,
+		errorHandler: trxkit.NewLogErrorHandler(logger.NewNoopLogger()),
+		finalizer:    opts.finalizer,
+		retry:        opts.retry,
+		maxRetries:   opts.maxRetries,
+		deadLetter:   opts.deadLetter,
+		permanent:    opts.permanent,
+	}
+
+	if opts.errorHandler != nil {
+		c.errorHandler = opts.errorHandler
+	}
+
+	return c
+}
+
+// ConsumerBefore functions are executed on the record before it is decoded.
+func ConsumerBefore(before ...ConsumerRequestFunc) ConsumerOption {
+	return func(c *consumerOption) { c.before = append(c.before, before...) }
+}
+
+// ConsumerErrorHandler is used to handle the errors of the records, and of
+// their routing. By default, errors are ignored.
+func ConsumerErrorHandler(errorHandler trxkit.ErrorHandler) ConsumerOption {
+	return func(c *consumerOption) { c.errorHandler = errorHandler }
+}
+
+// ConsumerFinalizer is executed at the end of every record.
+// By default, no finalizer is registered.
+func ConsumerFinalizer(f ...ConsumerFinalizerFunc) ConsumerOption {
+	return func(c *consumerOption) { c.finalizer = append(c.finalizer, f...) }
+}
+
+// ConsumerRetryTopic routes the failed records to topic with producer, up to
+// maxRetries times, counted by their x-retry-count header. The consumer of
+// the retry topic, which may be this one, processes them again.
+func ConsumerRetryTopic(producer Producer, topic string, maxRetries int) ConsumerOption {
+	return func(c *consumerOption) {
+		c.retry = &route{producer: producer, topic: topic}
+		c.maxRetries = maxRetries
+	}
+}
+
+// ConsumerDeadLetterTopic routes the records which failed permanently, or
+// too many times, to topic with producer.
+func ConsumerDeadLetterTopic(producer Producer, topic string) ConsumerOption {
+	return func(c *consumerOption) { c.deadLetter = &route{producer: producer, topic: topic} }
+}
+
+// ConsumerPermanentError sets the predicate deciding which errors send the
+// record to the dead letter topic without retrying it. Defaults to
+// PermanentError.
+func ConsumerPermanentError(fn func(error) bool) ConsumerOption {
+	return func(c *consumerOption) { c.permanent = fn }
+}
+
+// PermanentError reports whether err won't go away by processing the record
+// again: it reports a 4xx status code other than 408 Request Timeout and 429
+// Too Many Requests, or wraps api.ErrBadRequest, such as the errors of
+// decoders.
+func PermanentError(err error) bool {
+	var sc httptransport.StatusCoder
+	if errors.As(err, &sc) {
+		code := sc.StatusCode()
+		return code >= 400 && code < 500 &&
+			code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+	}
+	return errors.Is(err, api.ErrBadRequest)
+}
+
+// Run fetches the records of r and processes them one at a time, until ctx
+// is done or a record can be neither processed nor routed, in which case its
+// error is returned.
+func (c Consumer[I, O]) Run(ctx context.Context, r Reader) error {
+	for {
+		rec, err := r.Fetch(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		if err := c.HandleRecord(ctx, rec); err != nil {
+			return err
+		}
+
+		if err := r.Commit(ctx, rec); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+	}
+}
+
+// HandleRecord processes rec, routing it to the retry or dead letter topic
+// when it fails. It returns nil when the offset of rec can be committed.
+func (c Consumer[I, O]) HandleRecord(ctx context.Context, rec *Record) (err error) {
+	if len(c.finalizer) > 0 {
+		defer func() {
+			for _, f := range c.finalizer {
+				f(ctx, err)
+			}
+		}()
+	}
+
+	for _, f := range c.before {
+		ctx = f(ctx, rec)
+	}
+
+	var request I
+	if request, err = c.dec(ctx, rec); err == nil {
+		_, err = c.e(ctx, request)
+	}
+	if err == nil {
+		return nil
+	}
+
+	c.errorHandler.Handle(ctx, err)
+
+	retries, _ := strconv.Atoi(rec.Header(HeaderRetryCount))
+
+	target := c.deadLetter
+	if c.retry != nil && retries < c.maxRetries && !c.permanent(err) {
+		target = c.retry
+		retries++
+	}
+	if target == nil {
+		return err
+	}
+
+	routed := &Record{
+		Topic:   target.topic,
+		Key:     rec.Key,
+		Value:   rec.Value,
+		Headers: append([]Header(nil), rec.Headers...),
+	}
+	routed.SetHeader(HeaderRetryCount, strconv.Itoa(retries))
+	if routed.Header(HeaderOriginalTopic) == "" {
+		routed.SetHeader(HeaderOriginalTopic, rec.Topic)
+		routed.SetHeader(HeaderOriginalOffset, strconv.FormatInt(rec.Offset, 10))
+	}
+	routed.SetHeader(HeaderError, err.Error())
+
+	if rerr := target.producer.Produce(ctx, routed); rerr != nil {
+		c.errorHandler.Handle(ctx, rerr)
+		return rerr
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// PublisherRequestFunc may take information from the context and put it in
+// the headers of an outgoing record. PublisherRequestFuncs are executed after
+// encoding the record, but prior to producing it.
+type PublisherRequestFunc func(ctx context.Context, rec *Record) context.Context
+
+// PublisherFinalizerFunc can be used to perform work at the end of a
+// publication, after the record is produced.
+type PublisherFinalizerFunc func(ctx context.Context, err error)
+
+// Publisher wraps a Producer and provides a client endpoint publishing
+// records to a topic.
+type Publisher[T any] struct {
+	producer  Producer
+	topic     string
+	enc       EncodeRecordFunc[T]
+	before    []PublisherRequestFunc
+	finalizer []PublisherFinalizerFunc
+}
+
+type publisherOption struct {
+	before    []PublisherRequestFunc
+	finalizer []PublisherFinalizerFunc
+}
+
+// PublisherOption sets an optional parameter for publishers.
+type PublisherOption func(opt *publisherOption)
+
+// NewPublisher constructs a publisher producing the records encoded by enc
+// to topic.
+func NewPublisher[T any](
+	producer Producer,
+	topic string,
+	enc EncodeRecordFunc[T],
+	options ...PublisherOption,
+) *Publisher[T] {
+	opts := &publisherOption{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	return &Publisher[T]{
+		producer:  producer,
+		topic:     topic,
+		enc:       enc,
+		before:    opts.before,
+		finalizer: opts.finalizer,
+	}
+}
+
+// PublisherBefore sets the RequestFuncs that are applied to the outgoing
+// record before it's produced.
+func PublisherBefore(before ...PublisherRequestFunc) PublisherOption {
+	return func(p *publisherOption) { p.before = append(p.before, before...) }
+}
+
+// PublisherFinalizer is executed at the end of every publication.
+// By default, no finalizer is registered.
+func PublisherFinalizer(f ...PublisherFinalizerFunc) PublisherOption {
+	return func(p *publisherOption) { p.finalizer = append(p.finalizer, f...) }
+}
+
+// Endpoint returns a usable endpoint that publishes its payload to the
+// topic.
+func (p Publisher[T]) Endpoint() api.Endpoint[T, struct{}] {
+	return func(ctx context.Context, payload T) (_ struct{}, err error) {
+		if len(p.finalizer) > 0 {
+			defer func() {
+				for _, f := range p.finalizer {
+					f(ctx, err)
+				}
+			}()
+		}
+
+		rec := &Record{Topic: p.topic}
+		if err = p.enc(ctx, rec, payload); err != nil {
+			return struct{}{}, err
+		}
+
+		for _, f := range p.before {
+			ctx = f(ctx, rec)
+		}
+
+		err = p.producer.Produce(ctx, rec)
+		return struct{}{}, err
+	}
+}
@@ -0,0 +1,132 @@
+// Package kafka exposes endpoints over Kafka: Consumer processes the records
+// of a consumer group with an endpoint, and Publisher is a client endpoint
+// producing records.
+//
+// The package doesn't depend on a Kafka client. Records are read through a
+// Reader and written through a Producer, both satisfied by thin wrappers
+// around the client of the service, such as a kafka-go Reader and Writer.
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// Header is a header of a Record.
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Record is a Kafka record.
+type Record struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []Header
+	Time      time.Time
+}
+
+// Header returns the value of the last header called key, or an empty
+// string.
+func (r *Record) Header(key string) string {
+	for i := len(r.Headers) - 1; i >= 0; i-- {
+		if r.Headers[i].Key == key {
+			return string(r.Headers[i].Value)
+		}
+	}
+	return ""
+}
+
+// SetHeader sets the header called key to value, replacing the headers of
+// the same key.
+func (r *Record) SetHeader(key, value string) {
+	headers := make([]Header, 0, len(r.Headers)+1)
+	for _, h := range r.Headers {
+		if h.Key != key {
+			headers = append(headers, h)
+		}
+	}
+	r.Headers = append(headers, Header{Key: key, Value: []byte(value)})
+}
+
+// HeaderCarrier adapts the headers of a Record to the TextMapCarrier
+// interface of OpenTelemetry propagators.
+type HeaderCarrier struct {
+	Record *Record
+}
+
+// Get returns the value of the header called key.
+func (c HeaderCarrier) Get(key string) string {
+	return c.Record.Header(key)
+}
+
+// Set sets the header called key to value.
+func (c HeaderCarrier) Set(key, value string) {
+	c.Record.SetHeader(key, value)
+}
+
+// Keys returns the keys of the headers.
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.Record.Headers))
+	for _, h := range c.Record.Headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
+
+// Reader fetches the records of a consumer group and commits their offsets.
+// It is satisfied by a thin wrapper around the client of the service, such
+// as the FetchMessage and CommitMessages methods of a kafka-go Reader.
+type Reader interface {
+	// Fetch blocks until a record is available, or ctx is done.
+	Fetch(ctx context.Context) (*Record, error)
+
+	// Commit commits the offset of rec.
+	Commit(ctx context.Context, rec *Record) error
+}
+
+// Producer writes records to their topic. It is satisfied by a thin wrapper
+// around the client of the service, such as a kafka-go Writer.
+type Producer interface {
+	Produce(ctx context.Context, rec *Record) error
+}
+
+// DecodeRecordFunc extracts a user-domain request object from a record.
+type DecodeRecordFunc[T any] func(ctx context.Context, rec *Record) (request T, err error)
+
+// EncodeRecordFunc encodes the passed object into the record, setting its
+// Value and, when needed, Key and Headers.
+type EncodeRecordFunc[T any] func(ctx context.Context, rec *Record, payload T) error
+
+// DecodeJSONRecord is a DecodeRecordFunc that JSON decodes the record value
+// into T, then validates it when it implements api.Validator.
+func DecodeJSONRecord[T any](ctx context.Context, rec *Record) (T, error) {
+	var req T
+	if err := json.Unmarshal(rec.Value, &req); err != nil {
+		return req, fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+	}
+
+	if err := api.Validate(ctx, &req); err != nil {
+		return req, err
+	}
+
+	return req, nil
+}
+
+// EncodeJSONRecord is an EncodeRecordFunc that writes the payload as JSON.
+func EncodeJSONRecord[T any](_ context.Context, rec *Record, payload T) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	rec.Value = data
+	return nil
+}
@@ -0,0 +1,169 @@
+package nats
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/logger"
+	trxkit "github.com/likearthian/apikit/transport"
+)
+
+// JetStreamMsg is a message delivered by a JetStream consumer. It is
+// satisfied by jetstream.Msg as is; its Headers can be read by type
+// asserting the message in a decoder or ConsumerBefore function.
+type JetStreamMsg interface {
+	Subject() string
+	Data() []byte
+	Ack() error
+	NakWithDelay(delay time.Duration) error
+	Term() error
+}
+
+// DecodeMessageFunc extracts a user-domain request object from a JetStream
+// message.
+type DecodeMessageFunc[T any] func(ctx context.Context, msg JetStreamMsg) (request T, err error)
+
+// ConsumerRequestFunc may take information from a JetStream message and put
+// it in the request context. ConsumerRequestFuncs are executed prior to
+// decoding the message.
+type ConsumerRequestFunc func(ctx context.Context, msg JetStreamMsg) context.Context
+
+// Consumer wraps an endpoint and processes the messages of a JetStream
+// consumer with it. A message is acknowledged when the endpoint succeeds,
+// and negatively acknowledged, to be redelivered, when it fails, unless the
+// error is permanent, in which case the message is terminated.
+type Consumer[I, O any] struct {
+	e            api.Endpoint[I, O]
+	dec          DecodeMessageFunc[I]
+	before       []ConsumerRequestFunc
+	errorHandler trxkit.ErrorHandler
+	finalizer    []SubscriberFinalizerFunc
+	nakDelay     time.Duration
+	permanent    func(error) bool
+}
+
+type consumerOption struct {
+	before       []ConsumerRequestFunc
+	errorHandler trxkit.ErrorHandler
+	finalizer    []SubscriberFinalizerFunc
+	nakDelay     time.Duration
+	permanent    func(error) bool
+}
+
+// ConsumerOption sets an optional parameter for consumers.
+type ConsumerOption func(opt *consumerOption)
+
+// NewConsumer constructs a new consumer processing messages with the
+// provided endpoint. The responses of the endpoint are discarded.
+func NewConsumer[I, O any](
+	e api.Endpoint[I, O],
+	dec DecodeMessageFunc[I],
+	options ...ConsumerOption,
+) *Consumer[I, O] {
+	opts := &consumerOption{permanent: PermanentError}
+	for _, option := range options {
+		option(opts)
+	}
+
+	c := &Consumer[I, O]{
+		e:            e,
+		dec:          dec,
+		before:       opts.before,
+		errorHandler: trxkit.NewLogErrorHandler(logger.NewNoopLogger()),
+		finalizer:    opts.finalizer,
+		nakDelay:     opts.nakDelay,
+		permanent:    opts.permanent,
+	}
+
+	if opts.errorHandler != nil {
+		c.errorHandler = opts.errorHandler
+	}
+
+	return c
+}
+
+// ConsumerBefore functions are executed on the message before it is
+// decoded.
+func ConsumerBefore(before ...ConsumerRequestFunc) ConsumerOption {
+	return func(c *consumerOption) { c.before = append(c.before, before...) }
+}
+
+// ConsumerErrorHandler is used to handle the errors of the messages, and of
+// their acknowledgements. By default, errors are ignored.
+func ConsumerErrorHandler(errorHandler trxkit.ErrorHandler) ConsumerOption {
+	return func(c *consumerOption) { c.errorHandler = errorHandler }
+}
+
+// ConsumerFinalizer is executed at the end of every message, after it is
+// acknowledged. By default, no finalizer is registered.
+func ConsumerFinalizer(f ...SubscriberFinalizerFunc) ConsumerOption {
+	return func(c *consumerOption) { c.finalizer = append(c.finalizer, f...) }
+}
+
+// ConsumerNakDelay sets the delay before a failed message is redelivered.
+// Defaults to 0, redelivering at once, or after the backoff of the
+// JetStream consumer configuration.
+func ConsumerNakDelay(d time.Duration) ConsumerOption {
+	return func(c *consumerOption) { c.nakDelay = d }
+}
+
+// ConsumerPermanentError sets the predicate deciding which errors terminate
+// the message instead of redelivering it. Defaults to PermanentError.
+func ConsumerPermanentError(fn func(error) bool) ConsumerOption {
+	return func(c *consumerOption) { c.permanent = fn }
+}
+
+// PermanentError reports whether err won't go away by processing the message
+// again: it reports a 4xx status code other than 408 Request Timeout and 429
+// Too Many Requests, or wraps api.ErrBadRequest, such as the errors of
+// decoders.
+func PermanentError(err error) bool {
+	code := statusCode(err)
+	return code >= 400 && code < 500 &&
+		code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
+}
+
+// ServeMsg processes msg and acknowledges it. It is the handler of the
+// consumer, such as with jetstream.Consumer.Consume:
+//
+//	cons.Consume(func(m jetstream.Msg) { consumer.ServeMsg(m) })
+func (c Consumer[I, O]) ServeMsg(msg JetStreamMsg) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var err error
+	if len(c.finalizer) > 0 {
+		defer func() {
+			for _, f := range c.finalizer {
+				f(ctx, err)
+			}
+		}()
+	}
+
+	for _, f := range c.before {
+		ctx = f(ctx, msg)
+	}
+
+	var request I
+	if request, err = c.dec(ctx, msg); err == nil {
+		_, err = c.e(ctx, request)
+	}
+
+	var ackErr error
+	switch {
+	case err == nil:
+		ackErr = msg.Ack()
+	case c.permanent(err):
+		c.errorHandler.Handle(ctx, err)
+		ackErr = msg.Term()
+	default:
+		c.errorHandler.Handle(ctx, err)
+		ackErr = msg.NakWithDelay(c.nakDelay)
+	}
+
+	if ackErr != nil {
+		c.errorHandler.Handle(ctx, ackErr)
+	}
+}
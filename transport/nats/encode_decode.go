@@ -0,0 +1,44 @@
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/likearthian/apikit/api"
+)
+
+// DecodeRequestFunc extracts a user-domain request object from an inbound
+// NATS message.
+type DecodeRequestFunc[T any] func(ctx context.Context, msg *Msg) (request T, err error)
+
+// EncodeResponseFunc encodes the passed response object into the reply
+// message, setting its Data and Header.
+type EncodeResponseFunc[T any] func(ctx context.Context, reply *Msg, response T) error
+
+// DecodeJSONRequest is a DecodeRequestFunc that JSON decodes the message data
+// into T, then validates it when it implements api.Validator.
+func DecodeJSONRequest[T any](ctx context.Context, msg *Msg) (T, error) {
+	var req T
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		return req, fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+	}
+
+	if err := api.Validate(ctx, &req); err != nil {
+		return req, err
+	}
+
+	return req, nil
+}
+
+// EncodeJSONResponse is an EncodeResponseFunc that sends the response as
+// JSON.
+func EncodeJSONResponse[T any](_ context.Context, reply *Msg, response T) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	reply.Data = data
+	return nil
+}
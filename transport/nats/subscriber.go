@@ -0,0 +1,261 @@
+// Package nats exposes endpoints over NATS: Subscriber serves request/reply
+// subjects, and Consumer processes the messages of a JetStream consumer.
+//
+// The package doesn't depend on a NATS client. Subscriber handles Msg values
+// filled from the *nats.Msg of a subscription, and replies through a
+// Publisher, usually a thin wrapper around *nats.Conn:
+//
+//	sub := natstransport.NewSubscriber("users.get", getUser,
+//		natstransport.DecodeJSONRequest[GetUserRequest],
+//		natstransport.EncodeJSONResponse[User])
+//
+//	nc.QueueSubscribe(sub.Subject(), sub.Queue(), func(m *nats.Msg) {
+//		sub.ServeMsg(publisher)(&natstransport.Msg{
+//			Subject: m.Subject, Reply: m.Reply, Header: m.Header, Data: m.Data,
+//		})
+//	})
+package nats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/logger"
+	trxkit "github.com/likearthian/apikit/transport"
+	httptransport "github.com/likearthian/apikit/transport/http"
+)
+
+// Header names of the error replies, as used by the NATS micro services
+// framework.
+const (
+	HeaderServiceError     = "Nats-Service-Error"
+	HeaderServiceErrorCode = "Nats-Service-Error-Code"
+)
+
+// Msg is a NATS message. Its Header has the type underlying nats.Header, so
+// the fields of a *nats.Msg can be assigned to it as is.
+type Msg struct {
+	Subject string
+	Reply   string
+	Header  map[string][]string
+	Data    []byte
+}
+
+// Publisher publishes messages. It is satisfied by a thin wrapper around a
+// *nats.Conn, so this package doesn't depend on the client.
+type Publisher interface {
+	Publish(msg *Msg) error
+}
+
+// RequestFunc may take information from an inbound message and put it in the
+// request context. RequestFuncs are executed prior to decoding the message.
+type RequestFunc func(ctx context.Context, msg *Msg) context.Context
+
+// ResponseFunc may take information from a request context and use it to
+// manipulate the reply message. ResponseFuncs are executed after encoding
+// the response, but prior to publishing it.
+type ResponseFunc func(ctx context.Context, reply *Msg) context.Context
+
+// ErrorEncoder is responsible for encoding an error into the reply message.
+type ErrorEncoder func(ctx context.Context, err error, reply *Msg)
+
+// SubscriberFinalizerFunc can be used to perform work at the end of the
+// handling of a message, after the reply is published.
+type SubscriberFinalizerFunc func(ctx context.Context, err error)
+
+// Subscriber wraps an endpoint and serves the requests published on a
+// subject, replying to their Reply subject, when they have one.
+type Subscriber[I, O any] struct {
+	subject      string
+	queue        string
+	e            api.Endpoint[I, O]
+	dec          DecodeRequestFunc[I]
+	enc          EncodeResponseFunc[O]
+	before       []RequestFunc
+	after        []ResponseFunc
+	errorEncoder ErrorEncoder
+	errorHandler trxkit.ErrorHandler
+	finalizer    []SubscriberFinalizerFunc
+}
+
+type subscriberOption struct {
+	queue        string
+	before       []RequestFunc
+	after        []ResponseFunc
+	errorEncoder ErrorEncoder
+	errorHandler trxkit.ErrorHandler
+	finalizer    []SubscriberFinalizerFunc
+}
+
+// SubscriberOption sets an optional parameter for subscribers.
+type SubscriberOption func(opt *subscriberOption)
+
+// NewSubscriber constructs a new subscriber serving the requests published on
+// subject with the provided endpoint.
+func NewSubscriber[I, O any](
+	subject string,
+	e api.Endpoint[I, O],
+	dec DecodeRequestFunc[I],
+	enc EncodeResponseFunc[O],
+	options ...SubscriberOption,
+) *Subscriber[I, O] {
+	opts := &subscriberOption{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	s := &Subscriber[I, O]{
+		subject:      subject,
+		queue:        opts.queue,
+		e:            e,
+		dec:          dec,
+		enc:          enc,
+		before:       opts.before,
+		after:        opts.after,
+		errorEncoder: DefaultErrorEncoder,
+		errorHandler: trxkit.NewLogErrorHandler(logger.NewNoopLogger()),
+		finalizer:    opts.finalizer,
+	}
+
+	if opts.errorEncoder != nil {
+		s.errorEncoder = opts.errorEncoder
+	}
+
+	if opts.errorHandler != nil {
+		s.errorHandler = opts.errorHandler
+	}
+
+	return s
+}
+
+// SubscriberQueue sets the queue group the subscription should join, so the
+// requests are balanced between the instances of a service.
+func SubscriberQueue(queue string) SubscriberOption {
+	return func(s *subscriberOption) { s.queue = queue }
+}
+
+// SubscriberBefore functions are executed on the inbound message before it is
+// decoded.
+func SubscriberBefore(before ...RequestFunc) SubscriberOption {
+	return func(s *subscriberOption) { s.before = append(s.before, before...) }
+}
+
+// SubscriberAfter functions are executed on the reply message after the
+// response is encoded, but before it is published.
+func SubscriberAfter(after ...ResponseFunc) SubscriberOption {
+	return func(s *subscriberOption) { s.after = append(s.after, after...) }
+}
+
+// SubscriberErrorEncoder is used to encode errors into the reply message. By
+// default, errors are encoded with the DefaultErrorEncoder.
+func SubscriberErrorEncoder(ee ErrorEncoder) SubscriberOption {
+	return func(s *subscriberOption) { s.errorEncoder = ee }
+}
+
+// SubscriberErrorHandler is used to handle non-terminal errors. By default,
+// non-terminal errors are ignored.
+func SubscriberErrorHandler(errorHandler trxkit.ErrorHandler) SubscriberOption {
+	return func(s *subscriberOption) { s.errorHandler = errorHandler }
+}
+
+// SubscriberFinalizer is executed at the end of every message.
+// By default, no finalizer is registered.
+func SubscriberFinalizer(f ...SubscriberFinalizerFunc) SubscriberOption {
+	return func(s *subscriberOption) { s.finalizer = append(s.finalizer, f...) }
+}
+
+// Subject returns the subject to subscribe to.
+func (s Subscriber[I, O]) Subject() string {
+	return s.subject
+}
+
+// Queue returns the queue group to join, or an empty string.
+func (s Subscriber[I, O]) Queue() string {
+	return s.queue
+}
+
+// ServeMsg returns the message handler of the subscription, replying with
+// pub.
+func (s Subscriber[I, O]) ServeMsg(pub Publisher) func(msg *Msg) {
+	return func(msg *Msg) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var err error
+		if len(s.finalizer) > 0 {
+			defer func() {
+				for _, f := range s.finalizer {
+					f(ctx, err)
+				}
+			}()
+		}
+
+		for _, f := range s.before {
+			ctx = f(ctx, msg)
+		}
+
+		reply := &Msg{Subject: msg.Reply, Header: map[string][]string{}}
+
+		var (
+			request  I
+			response O
+		)
+		if request, err = s.dec(ctx, msg); err == nil {
+			if response, err = s.e(ctx, request); err == nil {
+				err = s.enc(ctx, reply, response)
+			}
+		}
+
+		if err != nil {
+			s.errorHandler.Handle(ctx, err)
+			reply = &Msg{Subject: msg.Reply, Header: map[string][]string{}}
+			s.errorEncoder(ctx, err, reply)
+		} else {
+			for _, f := range s.after {
+				ctx = f(ctx, reply)
+			}
+		}
+
+		if msg.Reply == "" {
+			return
+		}
+
+		if perr := pub.Publish(reply); perr != nil {
+			s.errorHandler.Handle(ctx, perr)
+			if err == nil {
+				err = perr
+			}
+		}
+	}
+}
+
+// DefaultErrorEncoder writes the error as a JSON body of the form
+// {"status_code": 500, "error": "..."}, and sets the Nats-Service-Error and
+// Nats-Service-Error-Code headers. If the error implements
+// httptransport.StatusCoder, the provided StatusCode will be used instead of
+// 500, and errors wrapping api.ErrBadRequest report 400.
+func DefaultErrorEncoder(_ context.Context, err error, reply *Msg) {
+	code := statusCode(err)
+
+	reply.Header[HeaderServiceError] = []string{err.Error()}
+	reply.Header[HeaderServiceErrorCode] = []string{strconv.Itoa(code)}
+	reply.Data, _ = json.Marshal(struct {
+		StatusCode int    `json:"status_code"`
+		Error      string `json:"error"`
+	}{code, err.Error()})
+}
+
+func statusCode(err error) int {
+	var sc httptransport.StatusCoder
+	if errors.As(err, &sc) {
+		return sc.StatusCode()
+	}
+	if errors.Is(err, api.ErrBadRequest) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,45 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gorilla/websocket"
+	"github.com/likearthian/apikit/api"
+)
+
+// DecodeMessageFunc extracts a user-domain request object from a single
+// inbound WebSocket message. messageType is websocket.TextMessage or
+// websocket.BinaryMessage.
+type DecodeMessageFunc[T any] func(ctx context.Context, messageType int, data []byte) (request T, err error)
+
+// EncodeMessageFunc encodes the passed response object into a single outbound
+// WebSocket message.
+type EncodeMessageFunc[T any] func(ctx context.Context, response T) (messageType int, data []byte, err error)
+
+// DecodeJSONMessage is a DecodeMessageFunc that JSON decodes the message into
+// T, then validates it when it implements api.Validator.
+func DecodeJSONMessage[T any](ctx context.Context, _ int, data []byte) (T, error) {
+	var req T
+	if err := json.Unmarshal(data, &req); err != nil {
+		return req, fmt.Errorf("%w: %s", api.ErrBadRequest, err)
+	}
+
+	if err := api.Validate(ctx, &req); err != nil {
+		return req, err
+	}
+
+	return req, nil
+}
+
+// EncodeJSONMessage is an EncodeMessageFunc that sends the response as a JSON
+// text message.
+func EncodeJSONMessage[T any](_ context.Context, response T) (int, []byte, error) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return websocket.TextMessage, data, nil
+}
@@ -0,0 +1,306 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/likearthian/apikit/api"
+	"github.com/likearthian/apikit/logger"
+	trxkit "github.com/likearthian/apikit/transport"
+	httptransport "github.com/likearthian/apikit/transport/http"
+)
+
+// Server upgrades HTTP requests to WebSocket connections and serves every
+// inbound message through an endpoint. Messages of a connection are processed
+// sequentially, in the order they are received.
+type Server[I, O any] struct {
+	e            api.Endpoint[I, O]
+	dec          DecodeMessageFunc[I]
+	enc          EncodeMessageFunc[O]
+	upgrader     *websocket.Upgrader
+	before       []httptransport.RequestFunc
+	errorEncoder ErrorEncoder
+	errorHandler trxkit.ErrorHandler
+	finalizer    []ServerFinalizerFunc
+	pingInterval time.Duration
+	pongWait     time.Duration
+	writeWait    time.Duration
+	readLimit    int64
+	closeOnError bool
+}
+
+type serverOption struct {
+	upgrader     *websocket.Upgrader
+	before       []httptransport.RequestFunc
+	errorEncoder ErrorEncoder
+	errorHandler trxkit.ErrorHandler
+	finalizer    []ServerFinalizerFunc
+	pingInterval time.Duration
+	pongWait     time.Duration
+	writeWait    time.Duration
+	readLimit    int64
+	closeOnError bool
+}
+
+// ServerOption sets an optional parameter for servers.
+type ServerOption func(opt *serverOption)
+
+// NewServer constructs a new WebSocket server wrapping the provided endpoint.
+func NewServer[I, O any](
+	e api.Endpoint[I, O],
+	dec DecodeMessageFunc[I],
+	enc EncodeMessageFunc[O],
+	options ...ServerOption,
+) *Server[I, O] {
+	opts := &serverOption{
+		pingInterval: 30 * time.Second,
+		pongWait:     60 * time.Second,
+		writeWait:    10 * time.Second,
+	}
+	for _, option := range options {
+		option(opts)
+	}
+
+	s := &Server[I, O]{
+		e:            e,
+		dec:          dec,
+		enc:          enc,
+		upgrader:     &websocket.Upgrader{},
+		before:       opts.before,
+		errorEncoder: DefaultErrorEncoder,
+		errorHandler: trxkit.NewLogErrorHandler(logger.NewNoopLogger()),
+		finalizer:    opts.finalizer,
+		pingInterval: opts.pingInterval,
+		pongWait:     opts.pongWait,
+		writeWait:    opts.writeWait,
+		readLimit:    opts.readLimit,
+		closeOnError: opts.closeOnError,
+	}
+
+	if opts.upgrader != nil {
+		s.upgrader = opts.upgrader
+	}
+
+	if opts.errorEncoder != nil {
+		s.errorEncoder = opts.errorEncoder
+	}
+
+	if opts.errorHandler != nil {
+		s.errorHandler = opts.errorHandler
+	}
+
+	return s
+}
+
+// ServerUpgrader sets the upgrader used to accept connections, e.g. to
+// configure buffer sizes or the CheckOrigin policy. By default a zero
+// websocket.Upgrader is used, which rejects cross-origin requests.
+func ServerUpgrader(upgrader *websocket.Upgrader) ServerOption {
+	return func(s *serverOption) { s.upgrader = upgrader }
+}
+
+// ServerBefore functions are executed once per connection on the HTTP upgrade
+// request, so the context they build (auth claims, request id...) is shared by
+// every message of the connection.
+func ServerBefore(before ...httptransport.RequestFunc) ServerOption {
+	return func(s *serverOption) { s.before = append(s.before, before...) }
+}
+
+// ServerErrorEncoder is used to encode errors into a message sent back to the
+// client. By default, errors are written with the DefaultErrorEncoder.
+func ServerErrorEncoder(ee ErrorEncoder) ServerOption {
+	return func(s *serverOption) { s.errorEncoder = ee }
+}
+
+// ServerErrorHandler is used to handle non-terminal errors. By default, non-terminal errors
+// are ignored.
+func ServerErrorHandler(errorHandler trxkit.ErrorHandler) ServerOption {
+	return func(s *serverOption) { s.errorHandler = errorHandler }
+}
+
+// ServerFinalizer is executed when a connection is closed.
+// By default, no finalizer is registered.
+func ServerFinalizer(f ...ServerFinalizerFunc) ServerOption {
+	return func(s *serverOption) { s.finalizer = append(s.finalizer, f...) }
+}
+
+// ServerKeepAlive sets the interval between pings and the time to wait for a
+// pong (or any message) before the connection is considered dead. Defaults to
+// 30s and 60s. A zero pingInterval disables pings.
+func ServerKeepAlive(pingInterval, pongWait time.Duration) ServerOption {
+	return func(s *serverOption) {
+		s.pingInterval = pingInterval
+		s.pongWait = pongWait
+	}
+}
+
+// ServerWriteWait sets the time allowed to write a message. Defaults to 10s.
+func ServerWriteWait(d time.Duration) ServerOption {
+	return func(s *serverOption) { s.writeWait = d }
+}
+
+// ServerReadLimit sets the maximum size in bytes of an inbound message.
+func ServerReadLimit(limit int64) ServerOption {
+	return func(s *serverOption) { s.readLimit = limit }
+}
+
+// ServerCloseOnError closes the connection after the first decode or endpoint
+// error instead of reporting it and waiting for the next message.
+func ServerCloseOnError(closeOnError bool) ServerOption {
+	return func(s *serverOption) { s.closeOnError = closeOnError }
+}
+
+// ServerFinalizerFunc can be used to perform work once a connection is
+// closed. err is the error that ended the connection, nil on a normal close.
+type ServerFinalizerFunc func(ctx context.Context, err error)
+
+// ServeHTTP implements http.Handler.
+func (s Server[I, O]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	for _, f := range s.before {
+		ctx = f(ctx, r)
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already replied with an HTTP error.
+		s.errorHandler.Handle(ctx, err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if len(s.finalizer) > 0 {
+		defer func() {
+			for _, f := range s.finalizer {
+				f(ctx, err)
+			}
+		}()
+	}
+
+	if s.readLimit > 0 {
+		conn.SetReadLimit(s.readLimit)
+	}
+
+	if s.pongWait > 0 {
+		conn.SetReadDeadline(time.Now().Add(s.pongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(s.pongWait))
+		})
+	}
+
+	if s.pingInterval > 0 {
+		go s.keepAlive(ctx, conn)
+	}
+
+	err = s.serveConn(ctx, conn)
+}
+
+func (s Server[I, O]) serveConn(ctx context.Context, conn *websocket.Conn) error {
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return nil
+			}
+			return err
+		}
+
+		if s.pongWait > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.pongWait))
+		}
+
+		if err := s.serveMessage(ctx, conn, messageType, data); err != nil {
+			s.errorHandler.Handle(ctx, err)
+			errType, errData := s.errorEncoder(ctx, err)
+			if werr := s.write(conn, errType, errData); werr != nil {
+				return werr
+			}
+
+			if s.closeOnError {
+				s.close(conn, websocket.CloseInternalServerErr, err.Error())
+				return err
+			}
+		}
+	}
+}
+
+func (s Server[I, O]) serveMessage(ctx context.Context, conn *websocket.Conn, messageType int, data []byte) error {
+	request, err := s.dec(ctx, messageType, data)
+	if err != nil {
+		return err
+	}
+
+	response, err := s.e(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	respType, respData, err := s.enc(ctx, response)
+	if err != nil {
+		return err
+	}
+
+	return s.write(conn, respType, respData)
+}
+
+func (s Server[I, O]) keepAlive(ctx context.Context, conn *websocket.Conn) {
+	ticker := time.NewTicker(s.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.writeWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s Server[I, O]) write(conn *websocket.Conn, messageType int, data []byte) error {
+	if s.writeWait > 0 {
+		conn.SetWriteDeadline(time.Now().Add(s.writeWait))
+	}
+
+	return conn.WriteMessage(messageType, data)
+}
+
+func (s Server[I, O]) close(conn *websocket.Conn, code int, text string) {
+	// close reason is limited to 123 bytes by the protocol.
+	if len(text) > 123 {
+		text = text[:123]
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(s.writeWait))
+}
+
+// ErrorEncoder is responsible for encoding an error into the message sent
+// back to the client.
+type ErrorEncoder func(ctx context.Context, err error) (messageType int, data []byte)
+
+// DefaultErrorEncoder writes the error as a JSON text message of the form
+// {"status_code": 500, "error": "..."}. If the error implements
+// httptransport.StatusCoder, the provided StatusCode will be used instead of
+// 500.
+func DefaultErrorEncoder(_ context.Context, err error) (int, []byte) {
+	code := http.StatusInternalServerError
+	var sc httptransport.StatusCoder
+	if errors.As(err, &sc) {
+		code = sc.StatusCode()
+	}
+
+	data, _ := json.Marshal(struct {
+		StatusCode int    `json:"status_code"`
+		Error      string `json:"error"`
+	}{code, err.Error()})
+
+	return websocket.TextMessage, data
+}
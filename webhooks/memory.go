@@ -0,0 +1,111 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	httptransport "github.com/likearthian/apikit/transport/http"
+)
+
+// MemoryStore is an in-memory Store, keeping the last deliveries of every
+// subscription.
+type MemoryStore struct {
+	mu         sync.RWMutex
+	subs       map[string]*Subscription
+	deliveries map[string][]Delivery
+	keep       int
+}
+
+// NewMemoryStore creates an empty MemoryStore keeping the last keep
+// deliveries of every subscription, or all of them when keep is 0.
+func NewMemoryStore(keep int) *MemoryStore {
+	return &MemoryStore{
+		subs:       make(map[string]*Subscription),
+		deliveries: make(map[string][]Delivery),
+		keep:       keep,
+	}
+}
+
+// Subscribe implements Store. The ID and CreatedAt of sub are filled when
+// not set.
+func (s *MemoryStore) Subscribe(_ context.Context, sub *Subscription) error {
+	if sub.ID == "" {
+		sub.ID = httptransport.NewRequestID()
+	}
+	if sub.CreatedAt.IsZero() {
+		sub.CreatedAt = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subs[sub.ID]; ok {
+		return fmt.Errorf("webhooks: subscription %s already exists", sub.ID)
+	}
+	s.subs[sub.ID] = cloneSubscription(sub)
+
+	return nil
+}
+
+// Unsubscribe implements Store.
+func (s *MemoryStore) Unsubscribe(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subs[id]; !ok {
+		return ErrSubscriptionNotFound
+	}
+	delete(s.subs, id)
+	delete(s.deliveries, id)
+
+	return nil
+}
+
+// Subscriptions implements Store. They are returned in the order of their
+// creation.
+func (s *MemoryStore) Subscriptions(_ context.Context, typ string) ([]*Subscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var subs []*Subscription
+	for _, sub := range s.subs {
+		if sub.Matches(typ) {
+			subs = append(subs, cloneSubscription(sub))
+		}
+	}
+	sort.Slice(subs, func(i, k int) bool { return subs[i].CreatedAt.Before(subs[k].CreatedAt) })
+
+	return subs, nil
+}
+
+// LogDelivery implements Store.
+func (s *MemoryStore) LogDelivery(_ context.Context, d *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	log := append(s.deliveries[d.SubscriptionID], *d)
+	if s.keep > 0 && len(log) > s.keep {
+		log = append([]Delivery(nil), log[len(log)-s.keep:]...)
+	}
+	s.deliveries[d.SubscriptionID] = log
+
+	return nil
+}
+
+// Deliveries returns the logged deliveries of the subscription with the
+// given id, oldest first.
+func (s *MemoryStore) Deliveries(id string) []Delivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]Delivery(nil), s.deliveries[id]...)
+}
+
+func cloneSubscription(sub *Subscription) *Subscription {
+	c := *sub
+	c.Events = append([]string(nil), sub.Events...)
+	return &c
+}
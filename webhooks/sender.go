@@ -0,0 +1,346 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/likearthian/apikit/api"
+	httptransport "github.com/likearthian/apikit/transport/http"
+)
+
+type senderOption struct {
+	client       *http.Client
+	workers      int
+	timeout      time.Duration
+	maxAttempts  int
+	backoff      api.BackoffStrategy
+	userAgent    string
+	errorHandler func(err error, d *Delivery)
+}
+
+// SenderOption sets an optional parameter for NewSender.
+type SenderOption func(opt *senderOption)
+
+// HTTPClient sets the client sending the deliveries. Defaults to
+// http.DefaultClient.
+func HTTPClient(client *http.Client) SenderOption {
+	return func(opt *senderOption) { opt.client = client }
+}
+
+// Workers sets how many deliveries are sent concurrently. Defaults to 8.
+func Workers(n int) SenderOption {
+	return func(opt *senderOption) { opt.workers = n }
+}
+
+// Timeout sets the time allowed to each delivery attempt. Defaults to 10
+// seconds.
+func Timeout(d time.Duration) SenderOption {
+	return func(opt *senderOption) { opt.timeout = d }
+}
+
+// MaxAttempts sets how many times a delivery is attempted before giving up.
+// Defaults to 5.
+func MaxAttempts(n int) SenderOption {
+	return func(opt *senderOption) { opt.maxAttempts = n }
+}
+
+// RetryBackoff sets the delay before attempting again a delivery which
+// failed. Defaults to api.ExponentialBackoff(5*time.Second, time.Hour).
+func RetryBackoff(backoff api.BackoffStrategy) SenderOption {
+	return func(opt *senderOption) { opt.backoff = backoff }
+}
+
+// UserAgent sets the User-Agent header of the deliveries. Defaults to
+// "apikit-webhooks".
+func UserAgent(ua string) SenderOption {
+	return func(opt *senderOption) { opt.userAgent = ua }
+}
+
+// WithErrorHandler sets the function called with the deliveries which failed
+// for good, the errors of the Store, and those of the events which could not
+// be published by EmitMiddleware, for which d is nil. By default, they are
+// dropped.
+func WithErrorHandler(fn func(err error, d *Delivery)) SenderOption {
+	return func(opt *senderOption) { opt.errorHandler = fn }
+}
+
+// Sender delivers events to the subscriptions of a Store, in the background.
+// A delivery succeeds when the subscriber answers with a 2xx status. It is
+// retried on network errors and on 408, 429 and 5xx statuses, until
+// MaxAttempts; other statuses fail it at once. Every attempt is logged in
+// the Store.
+type Sender struct {
+	store Store
+	opts  *senderOption
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+
+	slots  chan struct{}
+	stop   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewSender creates a Sender delivering the events to the subscriptions of
+// store, until Close.
+func NewSender(store Store, options ...SenderOption) *Sender {
+	opts := &senderOption{
+		client:      http.DefaultClient,
+		workers:     8,
+		timeout:     10 * time.Second,
+		maxAttempts: 5,
+		backoff:     api.ExponentialBackoff(5*time.Second, time.Hour),
+		userAgent:   "apikit-webhooks",
+	}
+	for _, option := range options {
+		option(opts)
+	}
+	if opts.workers < 1 {
+		opts.workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Sender{
+		store:  store,
+		opts:   opts,
+		slots:  make(chan struct{}, opts.workers),
+		stop:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Publish queues the delivery of an event of type typ, whose data is encoded
+// as JSON, to every subscription receiving it. It returns once the
+// deliveries are queued, not sent.
+func (s *Sender) Publish(ctx context.Context, typ string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("webhooks: %s data: %w", typ, err)
+	}
+
+	e := &Event{
+		ID:   httptransport.NewRequestID(),
+		Type: typ,
+		Time: time.Now(),
+		Data: raw,
+	}
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	subs, err := s.store.Subscriptions(ctx, typ)
+	if err != nil {
+		return err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	for _, sub := range subs {
+		if !sub.Matches(typ) {
+			continue
+		}
+
+		s.wg.Add(1)
+		go s.deliver(sub, e, body)
+	}
+
+	return nil
+}
+
+// Close stops accepting events and abandons the deliveries waiting for a
+// retry, then waits for the attempts in flight to complete. When ctx is done
+// first, they are cancelled and ctx.Err() is returned.
+func (s *Sender) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	defer s.cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Sender) deliver(sub *Subscription, e *Event, body []byte) {
+	defer s.wg.Done()
+
+	// reported when the sender closes before the first attempt
+	last := &Delivery{EventID: e.ID, EventType: e.Type, SubscriptionID: sub.ID, URL: sub.URL}
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-s.stop:
+			s.fail(ErrClosed, last)
+			return
+		default:
+		}
+
+		select {
+		case s.slots <- struct{}{}:
+		case <-s.stop:
+			s.fail(ErrClosed, last)
+			return
+		}
+		d, retry := s.send(sub, e, body, attempt)
+		<-s.slots
+
+		retry = retry && attempt < s.opts.maxAttempts
+		d.Final = !retry
+		s.log(d)
+		last = d
+
+		if !retry {
+			if !d.Succeeded() {
+				s.fail(errors.New(d.Error), d)
+			}
+			return
+		}
+
+		timer := time.NewTimer(s.opts.backoff(attempt))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			s.fail(ErrClosed, d)
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// send attempts a delivery, and reports whether it may be retried when it
+// failed.
+func (s *Sender) send(sub *Subscription, e *Event, body []byte, attempt int) (*Delivery, bool) {
+	d := &Delivery{
+		ID:             httptransport.NewRequestID(),
+		EventID:        e.ID,
+		EventType:      e.Type,
+		SubscriptionID: sub.ID,
+		URL:            sub.URL,
+		Attempt:        attempt,
+		Time:           time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.opts.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		d.Error = err.Error()
+		return d, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", s.opts.userAgent)
+	req.Header.Set(HeaderID, e.ID)
+	req.Header.Set(HeaderEvent, e.Type)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(d.Time.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, d.Time, body))
+
+	res, err := s.opts.client.Do(req)
+	d.Duration = time.Since(d.Time)
+	if err != nil {
+		d.Error = err.Error()
+		return d, true
+	}
+	// drain the body so the connection is reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	res.Body.Close()
+
+	d.StatusCode = res.StatusCode
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return d, false
+	}
+
+	d.Error = fmt.Sprintf("webhooks: unexpected status %d", res.StatusCode)
+	switch {
+	case res.StatusCode >= 500,
+		res.StatusCode == http.StatusRequestTimeout,
+		res.StatusCode == http.StatusTooManyRequests:
+		return d, true
+	}
+	return d, false
+}
+
+func (s *Sender) log(d *Delivery) {
+	// the delivery is logged even when the sender is closing
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.store.LogDelivery(ctx, d); err != nil {
+		s.fail(err, d)
+	}
+}
+
+func (s *Sender) fail(err error, d *Delivery) {
+	if s.opts.errorHandler != nil {
+		s.opts.errorHandler(err, d)
+	}
+}
+
+// Topic is a type of event whose data is a T.
+//
+//	var orderCreated = webhooks.NewTopic[Order]("order.created")
+//
+//	err := orderCreated.Publish(ctx, sender, order)
+type Topic[T any] struct {
+	Type string
+}
+
+// NewTopic creates the Topic of the events of type typ.
+func NewTopic[T any](typ string) Topic[T] {
+	return Topic[T]{Type: typ}
+}
+
+// Publish queues the delivery of an event of the topic with data.
+func (t Topic[T]) Publish(ctx context.Context, s *Sender, data T) error {
+	return s.Publish(ctx, t.Type, data)
+}
+
+// EmitMiddleware returns an endpoint Middleware publishing an event of topic
+// after every successful call, with the data returned by fn, such as the
+// resource created or updated by the call. Failing calls publish nothing,
+// and the errors of Publish are passed to the error handler of s, without
+// failing the call.
+func EmitMiddleware[I, O, T any](s *Sender, topic Topic[T], fn func(ctx context.Context, request I, response O) T) api.Middleware[I, O] {
+	return func(next api.Endpoint[I, O]) api.Endpoint[I, O] {
+		return func(ctx context.Context, request I) (O, error) {
+			response, err := next(ctx, request)
+			if err != nil {
+				return response, err
+			}
+
+			if perr := topic.Publish(ctx, s, fn(ctx, request, response)); perr != nil {
+				s.fail(perr, nil)
+			}
+
+			return response, nil
+		}
+	}
+}
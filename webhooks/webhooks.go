@@ -0,0 +1,175 @@
+// Package webhooks delivers the events of a service to the URLs subscribed
+// to them, as signed JSON POST requests, retrying the failed deliveries with
+// a backoff. Subscriptions and the log of the deliveries are kept by a
+// Store: MemoryStore for tests and single instance services.
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrClosed is returned when publishing events after the Sender is closed,
+// and reported for the deliveries it abandons.
+var ErrClosed = errors.New("webhooks: sender closed")
+
+// ErrSubscriptionNotFound is returned by a Store when no subscription has the
+// requested id.
+var ErrSubscriptionNotFound = errors.New("webhooks: subscription not found")
+
+// ErrInvalidSignature is returned by Verify when the signature of a delivery
+// is missing, malformed, wrong or too old.
+var ErrInvalidSignature = errors.New("webhooks: invalid signature")
+
+// Headers of the delivery requests.
+const (
+	HeaderID        = "Webhook-Id"
+	HeaderEvent     = "Webhook-Event"
+	HeaderTimestamp = "Webhook-Timestamp"
+	HeaderSignature = "Webhook-Signature"
+)
+
+// Subscription is a URL receiving the events of some types. Deliveries are
+// signed with its Secret.
+type Subscription struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Secret string   `json:"-"`
+	Events []string `json:"events"`
+
+	// Disabled subscriptions receive no events.
+	Disabled  bool      `json:"disabled,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Matches reports whether the subscription receives the events of type typ.
+// The "*" event matches every type, and a type ending with ".*" every type
+// starting with what precedes it.
+func (s *Subscription) Matches(typ string) bool {
+	if s.Disabled {
+		return false
+	}
+
+	for _, e := range s.Events {
+		switch {
+		case e == "*", e == typ:
+			return true
+		case strings.HasSuffix(e, ".*") && strings.HasPrefix(typ, e[:len(e)-1]):
+			return true
+		}
+	}
+
+	return false
+}
+
+// Event is the body of the delivery requests.
+type Event struct {
+	ID   string          `json:"id"`
+	Type string          `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Delivery is the log of an attempt to deliver an event to a subscription.
+type Delivery struct {
+	ID             string    `json:"id"`
+	EventID        string    `json:"event_id"`
+	EventType      string    `json:"event_type"`
+	SubscriptionID string    `json:"subscription_id"`
+	URL            string    `json:"url"`
+	Attempt        int       `json:"attempt"`
+	Time           time.Time `json:"time"`
+
+	// StatusCode is the status of the response, or 0 when none was
+	// received.
+	StatusCode int           `json:"status_code,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Error      string        `json:"error,omitempty"`
+
+	// Final is set on the last attempt, which succeeded or won't be
+	// retried.
+	Final bool `json:"final,omitempty"`
+}
+
+// Succeeded reports whether the attempt succeeded.
+func (d *Delivery) Succeeded() bool {
+	return d.Error == ""
+}
+
+// Store keeps the subscriptions and the log of the deliveries.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Subscribe adds a subscription.
+	Subscribe(ctx context.Context, sub *Subscription) error
+
+	// Unsubscribe removes the subscription with the given id, or returns
+	// ErrSubscriptionNotFound.
+	Unsubscribe(ctx context.Context, id string) error
+
+	// Subscriptions returns the subscriptions receiving the events of type
+	// typ.
+	Subscriptions(ctx context.Context, typ string) ([]*Subscription, error)
+
+	// LogDelivery records an attempt to deliver an event.
+	LogDelivery(ctx context.Context, d *Delivery) error
+}
+
+// Sign returns the signature of a delivery of body at timestamp, in the
+// Webhook-Signature header: "t=<unix timestamp>,v1=<hex HMAC-SHA256>", where
+// the HMAC is computed with secret over the timestamp, a dot, and the body.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + signature(secret, t, body)
+}
+
+// Verify checks the Webhook-Signature header of a delivery of body, for the
+// receivers of the webhooks. Signatures older than tolerance are rejected,
+// unless tolerance is 0.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var t string
+	var sigs []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			sigs = append(sigs, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if tolerance > 0 {
+		if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+			return fmt.Errorf("%w: timestamp out of tolerance", ErrInvalidSignature)
+		}
+	}
+
+	expected := signature(secret, t, body)
+	for _, sig := range sigs {
+		if hmac.Equal([]byte(sig), []byte(expected)) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+func signature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}